@@ -1,10 +1,47 @@
 import { post } from './client.js';
 
+const ADMIN_KEY_STORAGE = 'adminApiKey';
+
+/**
+ * The admin API key entered on the admin pages.  It is kept for the
+ * browser session only.
+ *
+ * @returns {string}
+ */
+export function getAdminKey() {
+  return sessionStorage.getItem(ADMIN_KEY_STORAGE) || '';
+}
+
+/**
+ * Remember (or, when empty, forget) the admin API key.
+ *
+ * @param {string} key
+ */
+export function setAdminKey(key) {
+  if (key) {
+    sessionStorage.setItem(ADMIN_KEY_STORAGE, key);
+  } else {
+    sessionStorage.removeItem(ADMIN_KEY_STORAGE);
+  }
+}
+
+/**
+ * Headers authenticating a request to an admin route with the
+ * stored admin API key.
+ *
+ * @returns {object}
+ */
+export function adminHeaders() {
+  const key = getAdminKey();
+  return key ? { Authorization: `Bearer ${key}` } : {};
+}
+
 /**
  * Fund a wallet via the admin faucet.  Creates a coinbase
  * transaction awarding tokens to the specified wallet.  The
  * amount recorded in the database may differ from the fixed
- * reward minted on chain.
+ * reward minted on chain.  Requires an admin key with the
+ * funds role.
  *
  * @param {{ address: string, amount: number }} data
  * @returns {Promise<{ address: string, amount: number, block_hash: string }>}
@@ -13,5 +50,5 @@ export function fundWallet({ address, amount }) {
   if (!address || amount == null || amount <= 0) {
     return Promise.reject({ error: 'Invalid address or amount' });
   }
-  return post('/admin/fund', { address, amount });
+  return post('/admin/fund', { address, amount }, adminHeaders());
 }
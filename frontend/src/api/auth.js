@@ -5,7 +5,8 @@ import { post } from './client.js';
  * Wraps the `POST /auth/request-otp` endpoint.
  *
  * @param {string} email The user's email address
- * @returns {Promise<{email:string, otp:string}>}
+ * @returns {Promise<{email:string, message:string, otp?:string}>}
+ *   `otp` is only present when the server runs with OTP_ECHO=true
  */
 export function requestOtp(email) {
   return post('/auth/request-otp', { email });
@@ -17,7 +18,9 @@ export function requestOtp(email) {
  *
  * @param {string} email The user's email address
  * @param {string} otp The one‑time password provided by the server
- * @returns {Promise<{success:boolean, message:string}>}
+ * @returns {Promise<{success:boolean, message:string, token?:string,
+ *   expires_at?:string, user_id?:string}>} `token` is a session token,
+ *   present when the server has a database
  */
 export function verifyOtp(email, otp) {
   return post('/auth/verify-otp', { email, otp });
@@ -50,13 +50,15 @@ export async function get(endpoint) {
  *
  * @param {string} endpoint Relative API path starting with '/'
  * @param {object} body JSON‑serialisable payload
+ * @param {object} headers Extra request headers, e.g. Authorization
  * @returns {Promise<any>} Parsed JSON response
  */
-export async function post(endpoint, body = {}) {
+export async function post(endpoint, body = {}, headers = {}) {
   const res = await fetch(`${API_BASE_URL}${endpoint}`, {
     method: 'POST',
     headers: {
       'Content-Type': 'application/json',
+      ...headers,
     },
     body: JSON.stringify(body),
   });
@@ -1,12 +1,14 @@
 import { post } from './client.js';
+import { adminHeaders } from './admin.js';
 
 /**
  * Run the global zakat deduction.  This endpoint will iterate
  * over all wallet profiles and deduct the zakat amount from
- * each, mining a block for each deduction.
+ * each, mining a block for each deduction.  Requires an admin
+ * key with the zakat role.
  *
  * @returns {Promise<{ total_wallets: number, processed: number, total_zakat: number, block_hashes: string[] }>}
  */
 export function runZakat() {
-  return post('/zakat/run', {});
+  return post('/zakat/run', {}, adminHeaders());
 }
@@ -1,10 +1,11 @@
 import React, { useState } from "react";
-import { fundWallet } from "../api/admin.js";
+import { fundWallet, getAdminKey, setAdminKey } from "../api/admin.js";
 import { FiCreditCard, FiCheckCircle, FiAlertCircle } from "react-icons/fi";
 
 export default function AdminFundPage() {
   const [address, setAddress] = useState("");
   const [amount, setAmount] = useState("");
+  const [adminKey, setAdminKeyInput] = useState(getAdminKey());
   const [loading, setLoading] = useState(false);
   const [result, setResult] = useState(null);
   const [error, setError] = useState(null);
@@ -26,6 +27,12 @@ export default function AdminFundPage() {
       return;
     }
 
+    if (!adminKey.trim()) {
+      setError("Admin API key is required");
+      return;
+    }
+
+    setAdminKey(adminKey.trim());
     setLoading(true);
     try {
       const res = await fundWallet({
@@ -55,6 +62,21 @@ export default function AdminFundPage() {
       <div className="glass p-8 rounded-2xl shadow-xl">
         <form onSubmit={handleSubmit} className="space-y-6">
 
+          {/* ADMIN KEY FIELD */}
+          <div>
+            <label className="block text-sm text-gray-300 mb-1">
+              Admin API Key
+            </label>
+            <input
+              type="password"
+              autoComplete="off"
+              className="w-full p-3 rounded bg-gray-800 border border-gray-700 text-gray-100 focus:border-primary focus:ring-primary"
+              value={adminKey}
+              onChange={(e) => setAdminKeyInput(e.target.value)}
+              placeholder="Enter your admin API key"
+            />
+          </div>
+
           {/* ADDRESS FIELD */}
           <div>
             <label className="block text-sm text-gray-300 mb-1">
@@ -8,6 +8,7 @@ export default function LoginPage() {
   const [otp, setOtp] = useState("");
   const [otpSent, setOtpSent] = useState(false);
   const [serverOtp, setServerOtp] = useState("");
+  const [otpMessage, setOtpMessage] = useState("");
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState("");
 
@@ -25,7 +26,8 @@ export default function LoginPage() {
     try {
       const resp = await requestOtp(email);
       setOtpSent(true);
-      setServerOtp(resp.otp);
+      setServerOtp(resp.otp || "");
+      setOtpMessage(resp.message || "");
     } catch (err) {
       const message = err?.message || err?.error || "Failed to request OTP";
       setError(message);
@@ -109,12 +111,16 @@ export default function LoginPage() {
           <form onSubmit={handleVerifyOtp} className="space-y-5">
 
             <div className="p-3 rounded bg-gray-800 border border-gray-700 text-sm">
-              <p className="text-gray-300">
-                Demo OTP:
-                <span className="font-mono font-bold text-primary ml-2">
-                  {serverOtp}
-                </span>
-              </p>
+              {serverOtp ? (
+                <p className="text-gray-300">
+                  Demo OTP:
+                  <span className="font-mono font-bold text-primary ml-2">
+                    {serverOtp}
+                  </span>
+                </p>
+              ) : (
+                <p className="text-gray-300">{otpMessage}</p>
+              )}
             </div>
 
             <div>
@@ -2,6 +2,7 @@ import React, { useEffect, useState } from "react";
 import { useAuth } from "../context/AuthContext.jsx";
 import { getWalletReport } from "../api/wallet.js";
 import { runZakat } from "../api/zakat.js";
+import { getAdminKey, setAdminKey } from "../api/admin.js";
 import { FiActivity, FiHeart, FiDatabase } from "react-icons/fi";
 
 export default function ZakatPage() {
@@ -14,6 +15,7 @@ export default function ZakatPage() {
   const [running, setRunning] = useState(false);
   const [zakatResult, setZakatResult] = useState(null);
   const [runError, setRunError] = useState(null);
+  const [adminKey, setAdminKeyInput] = useState(getAdminKey());
 
   const fetchReport = () => {
     if (!walletAddress) return;
@@ -33,10 +35,17 @@ export default function ZakatPage() {
   }, [walletAddress]);
 
   const handleRunZakat = async () => {
-    setRunning(true);
     setRunError(null);
     setZakatResult(null);
 
+    if (!adminKey.trim()) {
+      setRunError("Admin API key is required");
+      return;
+    }
+
+    setAdminKey(adminKey.trim());
+    setRunning(true);
+
     try {
       const result = await runZakat();
       setZakatResult(result);
@@ -96,6 +105,21 @@ export default function ZakatPage() {
         </div>
       )}
 
+      {/* ADMIN KEY */}
+      <div>
+        <label className="block text-sm text-gray-300 mb-1">
+          Admin API Key
+        </label>
+        <input
+          type="password"
+          autoComplete="off"
+          className="w-full p-3 rounded bg-gray-800 border border-gray-700 text-gray-100 focus:border-primary focus:ring-primary"
+          value={adminKey}
+          onChange={(e) => setAdminKeyInput(e.target.value)}
+          placeholder="Enter your admin API key"
+        />
+      </div>
+
       {/* RUN ZAKAT BUTTON */}
       <button
         onClick={handleRunZakat}
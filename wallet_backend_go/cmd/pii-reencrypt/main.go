@@ -0,0 +1,46 @@
+package main
+
+// main.go is the PII re-encryption migration. It rewrites every users
+// and wallet_profiles row whose personal data is still plaintext or is
+// encrypted with a key other than the first of PII_ENCRYPTION_KEYS, and
+// fills in the email and cnic blind indexes. Run it once after enabling
+// encryption and again after each key rotation, before the old key is
+// removed from the list. With --dry-run it only counts the rows.
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+
+	"wallet_backend_go/internal/db"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "count the rows that need rewriting without changing them")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		fmt.Println("No .env file found")
+	}
+
+	client, err := db.NewSupabaseClient()
+	if err != nil {
+		log.Fatalf("supabase: %v", err)
+	}
+	if !client.EncryptsPII() {
+		log.Fatal("PII_ENCRYPTION_KEYS is not set")
+	}
+
+	report, err := client.ReencryptPII(context.Background(), *dryRun)
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if err != nil {
+		log.Printf("re-encryption stopped: %v", err)
+		os.Exit(1)
+	}
+}
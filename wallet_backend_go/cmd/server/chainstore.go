@@ -0,0 +1,96 @@
+package main
+
+// chainstore.go keeps the chain on disk in CHAIN_DATA_DIR so that a
+// restarted node resumes at its tip instead of starting over from
+// genesis. The chain is kept in a BoltDB database, or in the
+// append-only block file when CHAIN_STORAGE=file or the directory
+// already holds one. A data directory that holds only the genesis block
+// is seeded from the blocks mirrored in Supabase, which is the
+// migration path for nodes that ran before the chain was kept on disk:
+// without GENESIS_FILE their genesis was built at startup and never
+// mirrored, so it is first recovered from the mirrored rows.
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/db"
+)
+
+// openChainStorage opens CHAIN_DATA_DIR and makes it the chain's
+// storage, replacing bc's blocks by the stored chain. Without
+// CHAIN_DATA_DIR the chain stays in memory.
+func openChainStorage(bc *blockchain.Blockchain, store db.Store) error {
+	dir := os.Getenv("CHAIN_DATA_DIR")
+	if dir == "" {
+		log.Println("warning: CHAIN_DATA_DIR not set, the chain is kept in memory and lost on restart")
+		return nil
+	}
+	st, err := openStorage(dir)
+	if err != nil {
+		return err
+	}
+	genesis := bc.Blocks[0].Hash
+	if err := bc.UseStorage(st); err != nil {
+		st.Close()
+		return err
+	}
+	// the built-in genesis is stamped with the start time, so only a
+	// genesis file pins the genesis a stored chain must have
+	if os.Getenv("GENESIS_FILE") != "" && !bytes.Equal(bc.Blocks[0].Hash, genesis) {
+		st.Close()
+		return fmt.Errorf("%s holds a chain with genesis %x, not %x from GENESIS_FILE", dir, bc.Blocks[0].Hash, genesis)
+	}
+
+	if len(bc.Blocks) == 1 && store != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		if os.Getenv("GENESIS_FILE") == "" {
+			changed, err := db.SeedGenesis(ctx, store, bc)
+			if err != nil {
+				st.Close()
+				return fmt.Errorf("seeding the genesis block from Supabase: %w", err)
+			}
+			if changed {
+				log.Printf("took on genesis %x from the blocks mirrored in Supabase", bc.Blocks[0].Hash)
+			}
+		}
+		n, err := db.SyncChain(ctx, store, bc)
+		if err != nil {
+			log.Printf("warning: seeding the chain from Supabase stopped after %d blocks: %v", n, err)
+		} else if n > 0 {
+			log.Printf("seeded %d blocks from Supabase", n)
+		}
+	}
+	log.Printf("chain stored in %s, tip at height %d", dir, len(bc.Blocks)-1)
+	return nil
+}
+
+// openStorage opens the chain store in dir: the block file when
+// CHAIN_STORAGE is "file" or dir holds a block file and no database,
+// else the BoltDB database.
+func openStorage(dir string) (blockchain.Storage, error) {
+	kind := os.Getenv("CHAIN_STORAGE")
+	if kind == "" && fileExists(filepath.Join(dir, blockchain.ChainFileName)) && !fileExists(filepath.Join(dir, blockchain.BoltFileName)) {
+		log.Printf("%s holds a block file, keeping the chain in it", dir)
+		kind = "file"
+	}
+	switch kind {
+	case "", "bolt":
+		return blockchain.OpenBoltStorage(dir)
+	case "file":
+		return blockchain.OpenFileStorage(dir)
+	}
+	return nil, fmt.Errorf("CHAIN_STORAGE must be bolt or file, not %q", kind)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,127 @@
+package main
+
+// httpserver.go configures the HTTP server and stops it gracefully. On
+// SIGINT or SIGTERM the server stops accepting connections, lets the
+// requests in flight finish and then has the API drain its own pending
+// work (see api.Server.Shutdown): queued sends are mined, Supabase
+// writes complete and the chain's storage is closed. Everything must be
+// done within SHUTDOWN_TIMEOUT; a second signal stops the process at
+// once.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"wallet_backend_go/internal/api"
+)
+
+const (
+	defaultPort            = "8080"
+	defaultHTTPRead        = 30 // seconds
+	defaultHTTPWrite       = 330
+	defaultHTTPIdle        = 120
+	defaultShutdownTimeout = 60
+	// the mining deadline that REQUEST_TIMEOUT_MINING defaults to
+	defaultMiningDeadline = 300
+)
+
+// envSeconds reads a positive number of seconds from the environment.
+func envSeconds(name string, def int) (time.Duration, error) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return time.Duration(def) * time.Second, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive number of seconds", name)
+	}
+	return time.Duration(n) * time.Second, nil
+}
+
+// newHTTPServer returns the server for handler, listening on PORT with
+// the HTTP_READ_TIMEOUT, HTTP_WRITE_TIMEOUT and HTTP_IDLE_TIMEOUT
+// connection timeouts. The write timeout cuts off any response still
+// being written, so it should exceed the longest route deadline
+// (REQUEST_TIMEOUT_MINING), which answers with a 504 first.
+func newHTTPServer(handler http.Handler) (*http.Server, error) {
+	port := strings.TrimSpace(os.Getenv("PORT"))
+	if port == "" {
+		port = defaultPort
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return nil, fmt.Errorf("PORT %q is not a port number", port)
+	}
+	read, err := envSeconds("HTTP_READ_TIMEOUT", defaultHTTPRead)
+	if err != nil {
+		return nil, err
+	}
+	write, err := envSeconds("HTTP_WRITE_TIMEOUT", defaultHTTPWrite)
+	if err != nil {
+		return nil, err
+	}
+	idle, err := envSeconds("HTTP_IDLE_TIMEOUT", defaultHTTPIdle)
+	if err != nil {
+		return nil, err
+	}
+	if mining, err := envSeconds("REQUEST_TIMEOUT_MINING", defaultMiningDeadline); err == nil && write <= mining {
+		log.Printf("warning: HTTP_WRITE_TIMEOUT (%s) is not longer than REQUEST_TIMEOUT_MINING (%s), mining requests may be cut off without an answer", write, mining)
+	}
+	return &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler,
+		ReadHeaderTimeout: min(read, 10*time.Second),
+		ReadTimeout:       read,
+		WriteTimeout:      write,
+		IdleTimeout:       idle,
+	}, nil
+}
+
+// serve runs hs until SIGINT or SIGTERM, then shuts it and srv down
+// within SHUTDOWN_TIMEOUT.
+func serve(hs *http.Server, srv *api.Server) error {
+	timeout, err := envSeconds("SHUTDOWN_TIMEOUT", defaultShutdownTimeout)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// feed streams never go idle, so they are closed rather than awaited
+	hs.RegisterOnShutdown(srv.CloseFeed)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- hs.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	// a second signal kills the process
+	stop()
+
+	log.Printf("shutting down: finishing requests and pending writes (up to %s)", timeout)
+	sctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := hs.Shutdown(sctx); err != nil {
+		log.Printf("shutdown: requests still running: %v", err)
+	}
+	if err := srv.Shutdown(sctx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("pending work not finished within SHUTDOWN_TIMEOUT (%s)", timeout)
+		}
+		return err
+	}
+	log.Println("server stopped")
+	return nil
+}
@@ -1,37 +1,79 @@
 package main
 
 // main.go boots the REST API server. It initializes a new
-// blockchain with a genesis block paying to a hard-coded address,
-// constructs the API server and listens on port 8080. All routes are
-// versioned under /api/v1.
+// blockchain whose genesis block comes from GENESIS_FILE, or pays a
+// hard-coded address without one, resumes the chain kept in
+// CHAIN_DATA_DIR (see chainstore.go), constructs the API server and
+// listens on PORT (8080 by default). All routes are
+// versioned under /api/v1. SIGHUP reloads the settings that are safe
+// to change at runtime (see reload.go); SIGINT and SIGTERM stop the
+// server gracefully (see httpserver.go). With --explorer (or
+// SERVER_MODE=explorer) it runs a read-only explorer node that follows
+// the writing node through Supabase. With --selfcheck it instead runs the
+// end-to-end smoke test on a throwaway chain and exits non-zero if any
+// step fails.
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 
 	"wallet_backend_go/internal/api"
 	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/bridge"
+	"wallet_backend_go/internal/crypto"
+	"wallet_backend_go/internal/db"
+	"wallet_backend_go/internal/notary"
+	"wallet_backend_go/internal/payout"
+	"wallet_backend_go/internal/policyhook"
 )
 
+// corsOrigins returns the comma-separated CORS_ORIGINS, by default the
+// React frontend on http://localhost:3000. It is read per request so
+// that a config reload applies it.
+func corsOrigins() []string {
+	list := os.Getenv("CORS_ORIGINS")
+	if list == "" {
+		return []string{"http://localhost:3000"}
+	}
+	var origins []string
+	for _, o := range strings.Split(list, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	return origins
+}
+
 // withCORS wraps the given handler and adds CORS headers so that
-// the React frontend (running on http://localhost:3000) can call
-// the Go API on http://localhost:8080 without being blocked.
+// the frontend origins (CORS_ORIGINS) can call the Go API on
+// http://localhost:8080 without being blocked.
 func withCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Allow your frontend origin
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
-		// If you want to be looser during dev, you *could* use "*"
-		// w.Header().Set("Access-Control-Allow-Origin", "*")
+		// Allow the request's origin if it is listed; "*" allows any
+		origin := r.Header.Get("Origin")
+		for _, o := range corsOrigins() {
+			if o == "*" || o == origin {
+				w.Header().Set("Access-Control-Allow-Origin", o)
+				break
+			}
+		}
 
 		// Let proxies / caches know this varies by Origin
 		w.Header().Set("Vary", "Origin")
 
 		// Allowed methods and headers
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Tenant-ID, Authorization, X-View-Key, Idempotency-Key")
+		w.Header().Set("Access-Control-Expose-Headers", "Idempotent-Replayed, X-Total-Count, X-Next-Offset")
 
 		// Handle preflight requests
 		if r.Method == http.MethodOptions {
@@ -44,22 +86,217 @@ func withCORS(next http.Handler) http.Handler {
 	})
 }
 
+// setupProducer loads the node key that signs mined blocks from
+// NODE_PRIVATE_KEY (hex), generating a throwaway key when it is unset,
+// the optional FEE_ADDRESS that collects the fees of mined blocks, and
+// the optional comma-separated NODE_TRUSTED_PRODUCERS allow-list.
+func setupProducer(bc *blockchain.Blockchain) error {
+	var key *blockchain.NodeKey
+	if hexKey := os.Getenv("NODE_PRIVATE_KEY"); hexKey != "" {
+		priv, err := blockchain.PrivateKeyFromHex(hexKey)
+		if err != nil {
+			return err
+		}
+		key = blockchain.NewNodeKey(priv)
+	} else {
+		generated, err := blockchain.GenerateNodeKey()
+		if err != nil {
+			return err
+		}
+		key = generated
+		log.Println("warning: NODE_PRIVATE_KEY not set, signing blocks with a temporary node key")
+	}
+
+	if addr := os.Getenv("FEE_ADDRESS"); addr != "" {
+		if !blockchain.ValidateAddress(addr) {
+			return fmt.Errorf("FEE_ADDRESS %q is not a valid address", addr)
+		}
+		bc.FeeAddress = blockchain.CanonicalAddress(addr)
+	}
+
+	if list := os.Getenv("NODE_TRUSTED_PRODUCERS"); list != "" {
+		bc.TrustedProducers = make(map[string]bool)
+		for _, id := range strings.Split(list, ",") {
+			bc.TrustedProducers[strings.TrimSpace(id)] = true
+		}
+	}
+
+	bc.Producer = key
+	log.Printf("block producer node id: %s", key.ID)
+	return key.SignBlock(bc.Blocks[0])
+}
+
+// newBlockchain creates the chain from the genesis file named by
+// GENESIS_FILE, so that nodes sharing the file agree on the genesis
+// block. Without it the genesis block pays a dummy recipient.
+func newBlockchain() (*blockchain.Blockchain, error) {
+	path := os.Getenv("GENESIS_FILE")
+	if path == "" {
+		return blockchain.NewBlockchain("b2185e5380ecc4f928877552981268dbc04836b6d44942cca8a3e60a29af2211"), nil
+	}
+	g, err := blockchain.LoadGenesisConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	bc := blockchain.NewBlockchainFromGenesis(g, blockchain.SystemClock)
+	log.Printf("chain %s: genesis %x from %s (%d allocations, difficulty %d)",
+		g.ChainID, bc.Blocks[0].Hash, path, len(g.Allocations), g.TargetBits())
+	return bc, nil
+}
+
+// newStore connects to Supabase using SUPABASE_URL and the Supabase
+// keys. Without them it returns nil and the API runs in-memory only.
+func newStore() db.Store {
+	client, err := db.NewSupabaseClient()
+	if err != nil {
+		log.Printf("warning: could not initialize Supabase client: %v", err)
+		return nil
+	}
+	log.Println("Supabase client initialized")
+	if !client.EncryptsPII() {
+		log.Println("warning: PII_ENCRYPTION_KEYS not set, user emails, CNICs and phone numbers are stored in plaintext")
+	}
+	checkRLS(client)
+	return client
+}
+
+// checkRLS verifies that the anon key sees only the public tables. With
+// SUPABASE_RLS_STRICT=true a violated expectation stops the server;
+// otherwise it is logged.
+func checkRLS(client *db.SupabaseClient) {
+	strict := os.Getenv("SUPABASE_RLS_STRICT") == "true"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	findings, err := client.CheckRLS(ctx)
+	switch {
+	case errors.Is(err, db.ErrSharedKey):
+		if strict {
+			log.Fatal("SUPABASE_RLS_STRICT requires separate SUPABASE_SERVICE_KEY and SUPABASE_ANON_KEY")
+		}
+		log.Println("warning: one Supabase key is used for every request; set SUPABASE_SERVICE_KEY and SUPABASE_ANON_KEY")
+		return
+	case err != nil:
+		log.Printf("warning: could not check Supabase row level security: %v", err)
+		return
+	}
+	for _, f := range findings {
+		log.Printf("RLS: table %s: %s", f.Table, f.Problem)
+	}
+	if len(findings) > 0 && strict {
+		log.Fatalf("%d Supabase row level security checks failed", len(findings))
+	}
+}
+
+// runSelfCheck prints the smoke test report and returns the exit code.
+func runSelfCheck() int {
+	report := api.RunSelfCheck(context.Background())
+	for _, st := range report.Steps {
+		status := "PASS"
+		if !st.Passed {
+			status = "FAIL"
+		}
+		fmt.Printf("%-4s %-13s %5dms  %s\n", status, st.Name, st.DurationMS, st.Detail)
+	}
+	if !report.Passed {
+		fmt.Println("selfcheck failed")
+		return 1
+	}
+	fmt.Println("selfcheck passed")
+	return 0
+}
+
 func main() {
-	// Load environment variables from .env (if present)
-	if err := godotenv.Load(); err != nil {
+	selfcheck := flag.Bool("selfcheck", false, "run the end-to-end smoke test on an in-memory chain and exit")
+	explorer := flag.Bool("explorer", false, "run as a read-only explorer node (SERVER_MODE=explorer)")
+	flag.Parse()
+
+	// Load environment variables from .env or CONFIG_FILE (if present)
+	reloader := newConfigReloader()
+	if err := godotenv.Load(reloader.path); err != nil {
 		fmt.Println("No .env file found")
 	}
 
-	// Create a new blockchain with a dummy genesis recipient. In a
-	// real deployment you might take this from config or an env var.
-	bc := blockchain.NewBlockchain("b2185e5380ecc4f928877552981268dbc04836b6d44942cca8a3e60a29af2211")
-	srv := api.NewServer(bc)
+	if *selfcheck {
+		os.Exit(runSelfCheck())
+	}
+	if *explorer {
+		os.Setenv("SERVER_MODE", "explorer")
+	}
+	// hex addresses of wallets created before Base58Check addresses
+	blockchain.AcceptHexAddresses = os.Getenv("LEGACY_HEX_ADDRESSES") != "false"
+
+	bc, err := newBlockchain()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	store := newStore()
+	var srv *api.Server
+	if api.ExplorerMode() {
+		// an explorer mines nothing, so it needs no node key, but it
+		// can only follow a writer that shares its genesis block
+		if store == nil {
+			log.Fatal("SERVER_MODE=explorer needs the Supabase database")
+		}
+		if os.Getenv("GENESIS_FILE") == "" {
+			log.Println("warning: GENESIS_FILE not set, the explorer takes on the genesis of the blocks the writer mirrors")
+		}
+		if err := openChainStorage(bc, store); err != nil {
+			log.Fatalf("chain storage: %v", err)
+		}
+		log.Println("read-only explorer node: no mining, mutating requests are refused")
+		srv = api.NewExplorerServer(bc, store)
+	} else {
+		if err := setupProducer(bc); err != nil {
+			log.Fatalf("node key: %v", err)
+		}
+		ring, err := crypto.LoadKeyring()
+		if err != nil {
+			log.Fatalf("wallet master keys: %v", err)
+		}
+		if ring == nil {
+			log.Println("warning: WALLET_MASTER_KEYS not set, wallet private keys are stored unsealed")
+		}
+		if names := api.AdminsWithoutRoles(); len(names) > 0 {
+			log.Printf("warning: ADMIN_ROLES gives no role to admins %s, they cannot mint or pay out", strings.Join(names, ", "))
+		}
+		if err := api.CheckPeers(); err != nil {
+			log.Fatalf("PEER_ADDRS: %v", err)
+		}
+		if _, err := notary.NewFromEnv(); err != nil {
+			log.Fatalf("anchoring: %v", err)
+		}
+		if _, err := bridge.FromEnv(); err != nil {
+			log.Fatalf("bridge: %v", err)
+		}
+		if adapters, err := payout.FromEnv(); err != nil {
+			log.Fatalf("payouts: %v", err)
+		} else if mode := os.Getenv("PAYOUT_POOL_MODE"); mode != "" && mode != "settle" && mode != "burn" {
+			log.Fatalf("payouts: PAYOUT_POOL_MODE must be settle or burn")
+		} else if len(adapters) > 0 && mode != "burn" && !blockchain.ValidateAddress(os.Getenv("PAYOUT_SETTLEMENT_ADDRESS")) {
+			log.Fatalf("payouts: PAYOUT_SETTLEMENT_ADDRESS must be a wallet address")
+		}
+		if _, err := policyhook.FromEnv(); err != nil {
+			log.Fatalf("policy hooks: %v", err)
+		}
+		if err := api.CheckColdStorage(); err != nil {
+			log.Fatalf("cold storage: %v", err)
+		}
+		if err := openChainStorage(bc, store); err != nil {
+			log.Fatalf("chain storage: %v", err)
+		}
+		srv = api.NewServer(bc, store)
+	}
+	reloader.watch()
 
 	// Wrap the router with CORS middleware
-	handler := withCORS(srv.Router())
+	hs, err := newHTTPServer(withCORS(srv.Router()))
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
 
-	log.Println("Starting blockchain wallet backend on port 8080…")
-	if err := http.ListenAndServe(":8080", handler); err != nil {
+	log.Printf("Starting blockchain wallet backend on %s…", hs.Addr)
+	if err := serve(hs, srv); err != nil {
 		log.Fatalf("server failed: %v", err)
 	}
 }
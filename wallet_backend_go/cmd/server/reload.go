@@ -0,0 +1,146 @@
+package main
+
+// reload.go re-reads the configuration file on SIGHUP. The API reads
+// its settings from the environment on every use, so applying the
+// file's new values to the environment is enough for them to take
+// effect on the next request. Only the settings listed in
+// reloadableSettings are reloaded; the rest (database keys, session
+// secret, genesis, node key, ...) are bound at startup and still need
+// a restart. Variables set in the process environment take precedence
+// over the file, as they do at startup, so they are never reloaded.
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/joho/godotenv"
+)
+
+// reloadableSettings are the settings safe to change on the fly. The
+// value of a secret one is not logged when it changes.
+var reloadableSettings = []struct {
+	name   string
+	secret bool
+}{
+	{"CORS_ORIGINS", false},
+	{"ADMIN_API_KEYS", true},
+	{"ADMIN_ROLES", false},
+	{"ADMIN_TENANTS", false},
+	{"RATE_LIMIT_OTP_IP", false},
+	{"RATE_LIMIT_OTP_IP_BURST", false},
+	{"RATE_LIMIT_OTP_EMAIL", false},
+	{"RATE_LIMIT_OTP_EMAIL_BURST", false},
+	{"RATE_LIMIT_TX_IP", false},
+	{"RATE_LIMIT_TX_IP_BURST", false},
+	{"RATE_LIMIT_TX_ADDRESS", false},
+	{"RATE_LIMIT_TX_ADDRESS_BURST", false},
+	{"PIN_MAX_ATTEMPTS", false},
+	{"PIN_LOCKOUT_MINUTES", false},
+	{"TX_MAX_AMOUNT", false},
+	{"AML_BLOCKED_ADDRESSES", false},
+	{"COOLING_OFF_AMOUNT", false},
+	{"COOLING_OFF_NEW_RECIPIENT", false},
+	{"COOLING_OFF_MINUTES", false},
+	{"DUPLICATE_SEND_WINDOW", false},
+	{"IDEMPOTENCY_TTL", false},
+	{"HANDLE_HOLD_DAYS", false},
+	{"INVITATION_EXPIRY_DAYS", false},
+	{"FAUCET_AMOUNT", false},
+	{"FIAT_RATE", false},
+	{"FIAT_CURRENCY", false},
+	{"FIAT_RATES", false},
+	{"PRICE_FEED_URL", false},
+	{"PRICE_FEED_TTL", false},
+	{"ZAKAT_WALLET_ADDRESS", false},
+	{"ZAKAT_NISAB", false},
+	{"ZAKAT_RUN_MAX_DEVIATION_PCT", false},
+	{"ZAKAT_RUN_MAX_WALLET_DEDUCTION", false},
+	{"REQUEST_TIMEOUT_READ", false},
+	{"REQUEST_TIMEOUT_WRITE", false},
+	{"REQUEST_TIMEOUT_MINING", false},
+	{"FEED_MAX_CLIENTS", false},
+	{"P2P_SYNC_INTERVAL", false},
+	{"ANCHOR_INTERVAL", false},
+	{"BRIDGE_INTERVAL", false},
+	{"BRIDGE_BTC_CONFIRMATIONS", false},
+	{"BRIDGE_ETH_CONFIRMATIONS", false},
+	{"PAYOUT_INTERVAL", false},
+}
+
+// configFile is the file settings are loaded from (CONFIG_FILE,
+// default .env).
+func configFile() string {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return path
+	}
+	return ".env"
+}
+
+// configReloader applies changes of the configuration file.
+type configReloader struct {
+	path  string
+	fixed map[string]bool // set in the process environment
+}
+
+// newConfigReloader must run before the configuration file is loaded,
+// to tell variables of the process environment from the file's.
+func newConfigReloader() *configReloader {
+	rl := &configReloader{path: configFile(), fixed: make(map[string]bool)}
+	for _, s := range reloadableSettings {
+		if _, ok := os.LookupEnv(s.name); ok {
+			rl.fixed[s.name] = true
+		}
+	}
+	return rl
+}
+
+// reload re-reads the file and applies the changed settings, logging
+// each change. A setting removed from the file is unset.
+func (rl *configReloader) reload() {
+	values, err := godotenv.Read(rl.path)
+	if err != nil {
+		log.Printf("config reload: %v; keeping the current settings", err)
+		return
+	}
+
+	changed := 0
+	for _, s := range reloadableSettings {
+		if rl.fixed[s.name] {
+			continue
+		}
+		old, had := os.LookupEnv(s.name)
+		value, ok := values[s.name]
+		if had == ok && old == value {
+			continue
+		}
+		if ok {
+			os.Setenv(s.name, value)
+		} else {
+			os.Unsetenv(s.name)
+		}
+		changed++
+
+		switch {
+		case s.secret:
+			log.Printf("config reload: %s changed", s.name)
+		case !ok:
+			log.Printf("config reload: %s unset (was %q)", s.name, old)
+		default:
+			log.Printf("config reload: %s changed from %q to %q", s.name, old, value)
+		}
+	}
+	log.Printf("config reload: %d settings changed from %s", changed, rl.path)
+}
+
+// watch reloads the configuration whenever the process gets SIGHUP.
+func (rl *configReloader) watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			rl.reload()
+		}
+	}()
+}
@@ -0,0 +1,61 @@
+package main
+
+// main.go is the wallet key migration. It seals every wallet private key
+// that is still stored unsealed, or sealed with a master key other than
+// the first of WALLET_MASTER_KEYS, with that first key. Run it once
+// after setting the master keys and again after each rotation, before
+// the old key is removed from the list. With --dry-run it only counts
+// the rows.
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+
+	"wallet_backend_go/internal/crypto"
+	"wallet_backend_go/internal/db"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "count the rows that need rewriting without changing them")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		fmt.Println("No .env file found")
+	}
+
+	ring, err := crypto.LoadKeyring()
+	if err != nil {
+		log.Fatalf("master keys: %v", err)
+	}
+	if ring == nil {
+		log.Fatal("WALLET_MASTER_KEYS is not set")
+	}
+	client, err := db.NewSupabaseClient()
+	if err != nil {
+		log.Fatalf("supabase: %v", err)
+	}
+
+	report, err := client.MigrateWalletKeys(context.Background(), *dryRun, func(address, key string) (string, bool, error) {
+		if ring.Current(key) {
+			return key, false, nil
+		}
+		privHex, err := ring.Open(address, key)
+		if err != nil {
+			return "", false, err
+		}
+		sealed, err := ring.Seal(address, privHex)
+		return sealed, true, err
+	})
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if err != nil {
+		log.Printf("migration stopped: %v", err)
+		os.Exit(1)
+	}
+}
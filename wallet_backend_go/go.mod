@@ -6,4 +6,10 @@ require github.com/gorilla/mux v1.8.0
 
 require github.com/google/uuid v1.6.0
 
-require github.com/joho/godotenv v1.5.1 // indirect
+require github.com/joho/godotenv v1.5.1
+
+require github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+
+require go.etcd.io/bbolt v1.3.10
+
+require golang.org/x/sys v0.30.0 // indirect
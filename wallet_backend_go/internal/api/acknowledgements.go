@@ -0,0 +1,304 @@
+package api
+
+// acknowledgements.go lets beneficiaries confirm that a disbursement
+// reached them. A disbursement is a transaction spending from the
+// tenant's zakat pool; the beneficiary requests a challenge for one of
+// its outputs paying their wallet and signs it with the wallet key, the
+// same way transaction inputs are signed. The signed challenge is kept
+// in disbursement_acknowledgements and listed in the annual report so
+// donors can check receipts themselves.
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+)
+
+const (
+	// ackChallengeTTL bounds how long a beneficiary has to sign.
+	ackChallengeTTL = 10 * time.Minute
+
+	// ackMaxPending caps the outstanding challenges so that the
+	// unauthenticated challenge endpoint cannot exhaust memory.
+	ackMaxPending = 10000
+)
+
+// ackChallenge is an issued, not yet signed receipt challenge.
+type ackChallenge struct {
+	txid    string
+	wallet  string
+	amount  int
+	message string
+	expires time.Time
+}
+
+// ackChallenges holds the pending challenges, keyed by nonce.
+type ackChallenges struct {
+	mu      sync.Mutex
+	pending map[string]ackChallenge
+}
+
+// start records a challenge. It returns false when too many are
+// pending.
+func (st *ackChallenges) start(nonce string, c ackChallenge, now time.Time) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.pending == nil {
+		st.pending = make(map[string]ackChallenge)
+	}
+	for k, p := range st.pending {
+		if now.After(p.expires) {
+			delete(st.pending, k)
+		}
+	}
+	if len(st.pending) >= ackMaxPending {
+		return false
+	}
+	st.pending[nonce] = c
+	return true
+}
+
+// take removes and returns the challenge of nonce if it belongs to txid
+// and has not expired.
+func (st *ackChallenges) take(nonce, txid string, now time.Time) (ackChallenge, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	c, ok := st.pending[nonce]
+	if !ok || c.txid != txid {
+		return ackChallenge{}, false
+	}
+	delete(st.pending, nonce)
+	return c, !now.After(c.expires)
+}
+
+type ackChallengeRequest struct {
+	WalletAddress string `json:"wallet_address"`
+}
+
+type ackChallengeResponse struct {
+	Challenge string    `json:"challenge"`
+	Message   string    `json:"message"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type acknowledgeRequest struct {
+	Challenge string `json:"challenge"`
+	PublicKey string `json:"public_key"` // hex X||Y
+	Signature string `json:"signature"`  // hex r||s of SHA-256(message)
+}
+
+func disbursementAckID(txid, wallet string) string {
+	return txid + "/" + wallet
+}
+
+// ackMessage is the text a beneficiary signs for a disbursement.
+func ackMessage(txid, wallet string, amount int, nonce string) string {
+	return fmt.Sprintf("Zakat disbursement received\ntxid: %s\nwallet: %s\namount: %d\nchallenge: %s",
+		txid, wallet, amount, nonce)
+}
+
+// disbursedTo returns what the transaction txid paid wallet from the
+// zakat pool, or false if it is no disbursement to wallet.
+func (s *Server) disbursedTo(txid, pool, wallet string) (int, bool) {
+	id, err := hex.DecodeString(txid)
+	if err != nil || wallet == pool {
+		return 0, false
+	}
+	walletHash, err := blockchain.DecodeAddress(wallet)
+	if err != nil {
+		return 0, false
+	}
+
+	s.chainMu.Lock()
+	tx, err := s.BC.FindTransaction(id)
+	s.chainMu.Unlock()
+	if err != nil || tx.IsCoinbase() {
+		return 0, false
+	}
+
+	fromPool := false
+	for _, in := range tx.Vin {
+		if blockchain.PubKeyAddress(in.PubKey) == pool {
+			fromPool = true
+			break
+		}
+	}
+	if !fromPool {
+		return 0, false
+	}
+	amount := 0
+	for _, out := range tx.Vout {
+		if out.IsLockedWith(walletHash) {
+			amount += out.Value
+		}
+	}
+	return amount, amount > 0
+}
+
+// RequestDisbursementAck issues the challenge a beneficiary signs to
+// acknowledge the disbursement txid to their wallet.
+func (s *Server) RequestDisbursementAck(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	txid := mux.Vars(r)["txid"]
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req ackChallengeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	pool, err := s.zakatAddressFor(ctx, tenantID(ctx))
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	amount, ok := s.disbursedTo(txid, pool, req.WalletAddress)
+	if !ok {
+		httpError(w, r, "disbursement not found", http.StatusNotFound)
+		return
+	}
+
+	existing, err := s.DB.GetDisbursementAck(ctx, disbursementAckID(txid, req.WalletAddress))
+	if err != nil {
+		httpError(w, r, "failed to load acknowledgement", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "disbursement_ack_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if existing != nil {
+		httpError(w, r, "disbursement already acknowledged", http.StatusConflict)
+		return
+	}
+
+	buf := make([]byte, 16)
+	if _, err := io.ReadFull(s.Entropy, buf); err != nil {
+		httpError(w, r, "failed to create challenge", http.StatusInternalServerError)
+		return
+	}
+	nonce := hex.EncodeToString(buf)
+	now := s.Clock.Now().UTC()
+	c := ackChallenge{
+		txid:    txid,
+		wallet:  req.WalletAddress,
+		amount:  amount,
+		message: ackMessage(txid, req.WalletAddress, amount, nonce),
+		expires: now.Add(ackChallengeTTL),
+	}
+	if !s.ackChallenges.start(nonce, c, now) {
+		httpError(w, r, "too many pending challenges", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ackChallengeResponse{
+		Challenge: nonce,
+		Message:   c.message,
+		ExpiresAt: c.expires,
+	})
+}
+
+// AcknowledgeDisbursement verifies a beneficiary's signature of their
+// challenge and stores the acknowledgement.
+func (s *Server) AcknowledgeDisbursement(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	txid := mux.Vars(r)["txid"]
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req acknowledgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	now := s.Clock.Now().UTC()
+	c, ok := s.ackChallenges.take(req.Challenge, txid, now)
+	if !ok {
+		httpError(w, r, "invalid or expired challenge", http.StatusBadRequest)
+		return
+	}
+
+	pubKey, err := hex.DecodeString(req.PublicKey)
+	if err != nil {
+		httpError(w, r, "invalid public key", http.StatusBadRequest)
+		return
+	}
+	sig, err := hex.DecodeString(req.Signature)
+	if err != nil {
+		httpError(w, r, "invalid signature", http.StatusBadRequest)
+		return
+	}
+	if !blockchain.SameAddress(blockchain.PubKeyAddress(pubKey), c.wallet) {
+		httpError(w, r, "public key does not match the wallet", http.StatusForbidden)
+		return
+	}
+	if !blockchain.VerifyMessage(pubKey, sig, []byte(c.message)) {
+		s.logEvent(ctx, "warn", "disbursement_ack_rejected",
+			fmt.Sprintf("bad signature acknowledging %s for %s", txid, c.wallet), r.RemoteAddr)
+		httpError(w, r, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	tenant := tenantID(ctx)
+	ack := &models.DisbursementAck{
+		ID:             disbursementAckID(txid, c.wallet),
+		TenantID:       tenant,
+		TxID:           txid,
+		WalletAddress:  c.wallet,
+		Amount:         c.amount,
+		Message:        c.message,
+		PublicKey:      hex.EncodeToString(pubKey),
+		Signature:      hex.EncodeToString(sig),
+		AcknowledgedAt: now,
+	}
+	beneficiaries, err := s.DB.ListBeneficiariesRanked(ctx, tenant, 0)
+	if err != nil {
+		httpError(w, r, "failed to save acknowledgement", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "beneficiary_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	for _, b := range beneficiaries {
+		if b.WalletAddress == c.wallet {
+			ack.BeneficiaryID = b.ID
+			break
+		}
+	}
+
+	created, err := s.DB.CreateDisbursementAck(ctx, ack)
+	if err != nil {
+		httpError(w, r, "failed to save acknowledgement", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "disbursement_ack_save_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if !created {
+		httpError(w, r, "disbursement already acknowledged", http.StatusConflict)
+		return
+	}
+	// annual reports list acknowledgements
+	s.annualReports.reset()
+
+	s.logEvent(ctx, "info", "disbursement_acknowledged",
+		fmt.Sprintf("%s acknowledged %d from %s", c.wallet, c.amount, txid), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(ack)
+}
@@ -0,0 +1,194 @@
+package api
+
+// admin_auth.go authenticates admin requests with API keys. Keys are
+// configured in ADMIN_API_KEYS as comma-separated <name>:<secret> pairs
+// and sent as "Authorization: Bearer <secret>"; the name identifies the
+// admin in audit logs. Without ADMIN_API_KEYS guarded routes refuse
+// every request. Refused attempts are logged as
+// unauthorized_admin_access.
+//
+// Routes that move funds also require a role. ADMIN_ROLES lists the
+// roles of admins as comma-separated <name>=<role>|<role> pairs; an
+// admin it does not list holds no role. ADMIN_TENANTS binds some admins to one tenant as
+// comma-separated <name>=<tenant id> pairs; their requests are scoped
+// to that tenant whatever X-Tenant-ID says, while an admin it does not
+// list manages the whole deployment.
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+type adminCtxKey struct{}
+
+// Admin roles.
+const (
+	// roleFunds mints coins: /admin/fund.
+	roleFunds = "funds"
+	// roleZakat runs zakat, sets the policy and distributes the pool.
+	roleZakat = "zakat"
+)
+
+// selfCheckAdmin names the admin of the startup self-check, which holds
+// every role on its throwaway server.
+const selfCheckAdmin = "selfcheck"
+
+// adminKeys parses ADMIN_API_KEYS into secret hash -> admin name.
+func adminKeys() map[[32]byte]string {
+	keys := make(map[[32]byte]string)
+	for _, pair := range strings.Split(os.Getenv("ADMIN_API_KEYS"), ",") {
+		name, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || name == "" || secret == "" {
+			continue
+		}
+		keys[sha256.Sum256([]byte(secret))] = name
+	}
+	return keys
+}
+
+// allAdminKeys is adminKeys with the key of the startup self-check.
+func (s *Server) allAdminKeys() map[[32]byte]string {
+	keys := adminKeys()
+	if s.selfCheckKey != "" {
+		keys[sha256.Sum256([]byte(s.selfCheckKey))] = selfCheckAdmin
+	}
+	return keys
+}
+
+// adminFor returns the name of the admin owning the bearer token of r,
+// or "" when it matches no key.
+func adminFor(keys map[[32]byte]string, r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	name := ""
+	for k, n := range keys {
+		if subtle.ConstantTimeCompare(k[:], sum[:]) == 1 {
+			name = n
+		}
+	}
+	return name
+}
+
+// requireAdmin lets only requests carrying an admin API key through to
+// next, which can read the admin's name with adminName.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys := s.allAdminKeys()
+		if len(keys) == 0 {
+			s.denyAdmin(w, r, "admin access is not configured", http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("Authorization") == "" {
+			s.denyAdmin(w, r, "admin authentication required", http.StatusUnauthorized)
+			return
+		}
+		name := adminFor(keys, r)
+		if name == "" {
+			s.denyAdmin(w, r, "admin access denied", http.StatusForbidden)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), adminCtxKey{}, name)))
+	}
+}
+
+// adminRoles parses ADMIN_ROLES into admin name -> roles.
+func adminRoles() map[string]map[string]bool {
+	roles := make(map[string]map[string]bool)
+	for _, pair := range strings.Split(os.Getenv("ADMIN_ROLES"), ",") {
+		name, list, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			continue
+		}
+		if roles[name] == nil {
+			roles[name] = make(map[string]bool)
+		}
+		for _, role := range strings.Split(list, "|") {
+			if role = strings.TrimSpace(role); role != "" {
+				roles[name][role] = true
+			}
+		}
+	}
+	return roles
+}
+
+// AdminsWithoutRoles returns the admins of ADMIN_API_KEYS that
+// ADMIN_ROLES gives no role, for a warning at startup.
+func AdminsWithoutRoles() []string {
+	roles := adminRoles()
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range adminKeys() {
+		if len(roles[name]) == 0 && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// adminTenant returns the tenant ADMIN_TENANTS binds the admin name to,
+// or "" for an admin of the whole deployment.
+func adminTenant(name string) string {
+	for _, pair := range strings.Split(os.Getenv("ADMIN_TENANTS"), ",") {
+		n, tenant, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && name != "" && strings.TrimSpace(n) == name {
+			return strings.TrimSpace(tenant)
+		}
+	}
+	return ""
+}
+
+// hasRole reports whether the admin name holds role.
+func (s *Server) hasRole(name, role string) bool {
+	if name == selfCheckAdmin && s.selfCheckKey != "" {
+		return true
+	}
+	return adminRoles()[name][role]
+}
+
+// requireRole is requireAdmin for admins holding role.
+func (s *Server) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return s.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		if !s.hasRole(adminName(r.Context()), role) {
+			s.denyAdmin(w, r, "admin role required", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (s *Server) denyAdmin(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+	}
+	httpError(w, r, msg, code)
+	s.logEvent(r.Context(), "warn", "unauthorized_admin_access",
+		fmt.Sprintf("%s %s refused: %s%s", r.Method, r.URL.Path, msg, deniedAdmin(r.Context())),
+		r.RemoteAddr,
+	)
+}
+
+// deniedAdmin names the admin refused for lacking a role.
+func deniedAdmin(ctx context.Context) string {
+	if name := adminName(ctx); name != "" {
+		return " (admin " + name + ")"
+	}
+	return ""
+}
+
+// adminName returns the admin authenticated by requireAdmin.
+func adminName(ctx context.Context) string {
+	name, _ := ctx.Value(adminCtxKey{}).(string)
+	return name
+}
@@ -0,0 +1,56 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"wallet_backend_go/internal/api"
+	"wallet_backend_go/internal/testutil"
+)
+
+// TestRequireRole checks that only admins ADMIN_ROLES gives a role can
+// mint, and that an admin it does not list holds no role.
+func TestRequireRole(t *testing.T) {
+	t.Setenv("ADMIN_API_KEYS", "ops:ops-secret,treasurer:treasurer-secret,auditor:auditor-secret")
+	t.Setenv("ADMIN_ROLES", "treasurer=funds,auditor=zakat")
+	c := testutil.NewChain(t)
+	h := testutil.NewServer(t, c).Router()
+	to := testutil.Wallet("bob").GetAddress()
+
+	tests := []struct {
+		name, secret string
+		want         int
+	}{
+		{"unlisted admin", "ops-secret", http.StatusForbidden},
+		{"other role", "auditor-secret", http.StatusForbidden},
+		{"funds role", "treasurer-secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/v1/admin/fund", strings.NewReader(`{"address":"`+to+`","amount":100}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+tt.secret)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			testutil.DecodeJSON(t, rec, tt.want, nil)
+		})
+	}
+
+	if got := api.AdminsWithoutRoles(); len(got) != 1 || got[0] != "ops" {
+		t.Errorf("AdminsWithoutRoles() = %v, want [ops]", got)
+	}
+}
+
+// TestSelfCheckHoldsRoles checks that the self-check can mint and run
+// zakat without ADMIN_ROLES listing it.
+func TestSelfCheckHoldsRoles(t *testing.T) {
+	testutil.LowDifficulty(t)
+	t.Setenv("ADMIN_ROLES", "")
+	report := api.RunSelfCheck(context.Background())
+	if !report.Passed {
+		t.Errorf("self-check failed: %+v", report.Steps)
+	}
+}
@@ -0,0 +1,416 @@
+package api
+
+// admin_rebuild.go implements the "rebuild everything" admin action used
+// after bug fixes or data repairs. A rebuild runs in the background as
+// an admin job: it re-validates the chain, rebuilds the UTXO index,
+// drops the cached wallet reports so they are re-projected on next
+// read, reconciles Supabase by re-inserting any block or transaction
+// row that is missing, and migrates the rows of outputs that store their
+// address in the legacy text encoding (see blockchain.LegacyOutputs).
+// Progress is polled through the job status endpoint. Jobs live in
+// memory and are lost on restart.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/db"
+)
+
+const (
+	jobStatusPending   = "pending"
+	jobStatusRunning   = "running"
+	jobStatusCompleted = "completed"
+	jobStatusFailed    = "failed"
+	jobStatusSkipped   = "skipped"
+)
+
+// rebuildSteps are the stages of a rebuild, in order.
+var rebuildSteps = []string{"validate_chain", "reindex_utxo", "rebuild_reports", "reconcile_supabase", "migrate_addresses"}
+
+type adminJobStep struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type adminJob struct {
+	ID         string         `json:"id"`
+	Kind       string         `json:"kind"`
+	Status     string         `json:"status"`
+	Steps      []adminJobStep `json:"steps"`
+	Error      string         `json:"error,omitempty"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+}
+
+// adminJobStore keeps admin jobs in memory.
+type adminJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*adminJob
+}
+
+// start registers a new running job of kind, unless one of the same kind
+// is already running.
+func (st *adminJobStore) start(kind string, steps []string, now time.Time) (*adminJob, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, j := range st.jobs {
+		if j.Kind == kind && j.Status == jobStatusRunning {
+			return nil, false
+		}
+	}
+
+	j := &adminJob{
+		ID:        uuid.NewString(),
+		Kind:      kind,
+		Status:    jobStatusRunning,
+		StartedAt: now.UTC(),
+	}
+	for _, name := range steps {
+		j.Steps = append(j.Steps, adminJobStep{Name: name, Status: jobStatusPending})
+	}
+	if st.jobs == nil {
+		st.jobs = make(map[string]*adminJob)
+	}
+	st.jobs[j.ID] = j
+	return j, true
+}
+
+// running returns a copy of the running job of kind, if any.
+func (st *adminJobStore) running(kind string) (adminJob, bool) {
+	st.mu.Lock()
+	var id string
+	for _, j := range st.jobs {
+		if j.Kind == kind && j.Status == jobStatusRunning {
+			id = j.ID
+		}
+	}
+	st.mu.Unlock()
+
+	if id == "" {
+		return adminJob{}, false
+	}
+	return st.get(id)
+}
+
+// get returns a copy of the job with the given id.
+func (st *adminJobStore) get(id string) (adminJob, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	j, ok := st.jobs[id]
+	if !ok {
+		return adminJob{}, false
+	}
+	cp := *j
+	cp.Steps = append([]adminJobStep(nil), j.Steps...)
+	return cp, true
+}
+
+// setStep updates the status and detail of step i of job id.
+func (st *adminJobStore) setStep(id string, i int, status, detail string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	j := st.jobs[id]
+	j.Steps[i].Status = status
+	j.Steps[i].Detail = detail
+}
+
+// finish marks job id as completed, or failed when err is non-nil.
+func (st *adminJobStore) finish(id string, err error, now time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	j := st.jobs[id]
+	now = now.UTC()
+	j.FinishedAt = &now
+	j.Status = jobStatusCompleted
+	if err != nil {
+		j.Status = jobStatusFailed
+		j.Error = err.Error()
+	}
+}
+
+// AdminRebuild starts a background rebuild of all derived state and
+// returns the job to poll.
+func (s *Server) AdminRebuild(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.adminJobs.start("rebuild", rebuildSteps, s.Clock.Now())
+	if !ok {
+		httpError(w, r, "a rebuild is already in progress", http.StatusConflict)
+		return
+	}
+
+	if s.DB != nil {
+		s.logEvent(r.Context(), "info", "admin_rebuild_started",
+			fmt.Sprintf("rebuild job %s started", job.ID),
+			r.RemoteAddr,
+		)
+	}
+
+	go s.runRebuild(job.ID, r.RemoteAddr)
+
+	snapshot, _ := s.adminJobs.get(job.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(snapshot)
+}
+
+// GetAdminJob reports the progress of an admin job.
+func (s *Server) GetAdminJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.adminJobs.get(mux.Vars(r)["id"])
+	if !ok {
+		httpError(w, r, "job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+// runRebuild executes the rebuild steps of job id in order, stopping at
+// the first failing step.
+func (s *Server) runRebuild(id, ip string) {
+	ctx := context.Background()
+
+	// validate and reindex under chainMu so no block is mined in between
+	s.chainMu.Lock()
+	s.adminJobs.setStep(id, 0, jobStatusRunning, "")
+	if err := s.BC.Validate(); err != nil {
+		s.chainMu.Unlock()
+		s.adminJobs.setStep(id, 0, jobStatusFailed, err.Error())
+		s.failRebuild(ctx, id, ip, err)
+		return
+	}
+	blocks := append([]*blockchain.Block(nil), s.BC.Blocks...)
+	s.adminJobs.setStep(id, 0, jobStatusCompleted, fmt.Sprintf("%d blocks valid", len(blocks)))
+
+	s.adminJobs.setStep(id, 1, jobStatusRunning, "")
+	utxo := s.UTXO.Reindex()
+	s.chainMu.Unlock()
+	s.adminJobs.setStep(id, 1, jobStatusCompleted, fmt.Sprintf("%d transactions with unspent outputs", len(utxo)))
+
+	s.reports.reset()
+	s.adminJobs.setStep(id, 2, jobStatusCompleted, "wallet report cache cleared")
+
+	if s.DB == nil {
+		s.adminJobs.setStep(id, 3, jobStatusSkipped, "database not configured")
+		s.adminJobs.setStep(id, 4, jobStatusSkipped,
+			fmt.Sprintf("database not configured, %d legacy outputs", len(blockchain.LegacyOutputs(blocks))))
+		s.adminJobs.finish(id, nil, s.Clock.Now())
+		return
+	}
+
+	s.adminJobs.setStep(id, 3, jobStatusRunning, "")
+	detail, err := s.reconcileSupabase(ctx, blocks, ip)
+	if err != nil {
+		s.adminJobs.setStep(id, 3, jobStatusFailed, err.Error())
+		s.failRebuild(ctx, id, ip, err)
+		return
+	}
+	s.adminJobs.setStep(id, 3, jobStatusCompleted, detail)
+
+	s.adminJobs.setStep(id, 4, jobStatusRunning, "")
+	migrated, err := s.migrateAddresses(ctx, blocks, ip)
+	if err != nil {
+		s.adminJobs.setStep(id, 4, jobStatusFailed, err.Error())
+		s.failRebuild(ctx, id, ip, err)
+		return
+	}
+	s.adminJobs.setStep(id, 4, jobStatusCompleted, migrated)
+	s.adminJobs.finish(id, nil, s.Clock.Now())
+
+	s.logEvent(ctx, "info", "admin_rebuild_completed",
+		fmt.Sprintf("rebuild job %s completed: %s; %s", id, detail, migrated),
+		ip,
+	)
+}
+
+func (s *Server) failRebuild(ctx context.Context, id, ip string, err error) {
+	s.adminJobs.finish(id, err, s.Clock.Now())
+	if s.DB != nil {
+		s.logEvent(ctx, "error", "admin_rebuild_failed",
+			fmt.Sprintf("rebuild job %s: %v", id, err),
+			ip,
+		)
+	} else {
+		log.Printf("rebuild job %s failed: %v", id, err)
+	}
+}
+
+// reconcileSupabase inserts the block and transaction rows that are
+// missing from Supabase for the given chain. Rows that fail to insert
+// are logged and counted but do not abort the reconciliation.
+func (s *Server) reconcileSupabase(ctx context.Context, blocks []*blockchain.Block, ip string) (string, error) {
+	hashes, err := s.DB.ListBlockHashes(ctx)
+	if err != nil {
+		return "", err
+	}
+	txids, err := s.DB.ListTransactionIDs(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var blockRows []db.BlockRecord
+	var txRows []db.TransactionRecord
+	failed := 0
+	for height, b := range blocks {
+		blockHash := fmt.Sprintf("%x", b.Hash)
+
+		if !hashes[blockHash] {
+			rec, err := db.NewBlockRecord(height, b)
+			if err != nil {
+				failed++
+				s.logEvent(ctx, "error", "rebuild_block_save_failed", err.Error(), ip)
+			} else {
+				blockRows = append(blockRows, rec)
+			}
+		}
+
+		for _, tx := range b.Transactions {
+			if txids[fmt.Sprintf("%x", tx.ID)] {
+				continue
+			}
+			sender, receiver, amount, txType := txParties(tx)
+			rec, err := db.NewTransactionRecord(blockHash, tx, sender, receiver, amount, txType)
+			if err != nil {
+				failed++
+				s.logEvent(ctx, "error", "rebuild_tx_save_failed", err.Error(), ip)
+			} else {
+				txRows = append(txRows, rec)
+			}
+		}
+	}
+
+	// blocks first: transaction rows refer to them
+	restoredBlocks, failedBlocks := insertChunks(blockRows, func(rows []db.BlockRecord) error {
+		return s.DB.InsertBlocks(ctx, rows)
+	}, func(err error) {
+		s.logEvent(ctx, "error", "rebuild_block_save_failed", err.Error(), ip)
+	})
+	restoredTxs, failedTxs := insertChunks(txRows, func(rows []db.TransactionRecord) error {
+		return s.DB.InsertTransactions(ctx, rows)
+	}, func(err error) {
+		s.logEvent(ctx, "error", "rebuild_tx_save_failed", err.Error(), ip)
+	})
+	failed += failedBlocks + failedTxs
+	if failed == 0 {
+		// every row is in Supabase now, including those whose write failed
+		s.persistence.resolveFailed(s.Clock.Now())
+	}
+
+	return fmt.Sprintf("restored %d blocks and %d transactions, %d failed", restoredBlocks, restoredTxs, failed), nil
+}
+
+// migrateAddresses rewrites the receiver of the transaction rows whose
+// output stores its address in the legacy text encoding, which older
+// versions recorded as the hex of that text, to the canonical address.
+// The chain itself is left as it is: the outputs are read through
+// TxOutput.Owner.
+func (s *Server) migrateAddresses(ctx context.Context, blocks []*blockchain.Block, ip string) (string, error) {
+	legacy := blockchain.LegacyOutputs(blocks)
+	if len(legacy) == 0 {
+		return "no legacy outputs", nil
+	}
+	byID := make(map[string]bool, len(legacy))
+	for _, lo := range legacy {
+		byID[fmt.Sprintf("%x", lo.Txid)] = true
+	}
+
+	migrated, failed := 0, 0
+	for _, b := range blocks {
+		for _, tx := range b.Transactions {
+			txid := fmt.Sprintf("%x", tx.ID)
+			if !byID[txid] {
+				continue
+			}
+			rec, err := s.DB.GetTransactionRecord(ctx, txid)
+			if err != nil {
+				return "", err
+			}
+			_, receiver, _, _ := txParties(tx)
+			if rec == nil || rec.Receiver == receiver {
+				continue
+			}
+			if err := s.DB.SetTransactionReceiver(ctx, txid, receiver); err != nil {
+				failed++
+				s.logEvent(ctx, "error", "rebuild_address_migration_failed", err.Error(), ip)
+				continue
+			}
+			migrated++
+		}
+	}
+	return fmt.Sprintf("%d legacy outputs, %d transactions migrated, %d failed", len(legacy), migrated, failed), nil
+}
+
+// insertChunks inserts rows in chunks of db.BatchSize, reporting each
+// failed chunk to onErr, and returns how many rows were inserted and
+// how many failed. A failed chunk does not stop the next.
+func insertChunks[T any](rows []T, insert func([]T) error, onErr func(error)) (int, int) {
+	inserted, failed := 0, 0
+	size := db.BatchSize()
+	for start := 0; start < len(rows); start += size {
+		end := start + size
+		if end > len(rows) {
+			end = len(rows)
+		}
+		if err := insert(rows[start:end]); err != nil {
+			failed += end - start
+			onErr(err)
+			continue
+		}
+		inserted += end - start
+	}
+	return inserted, failed
+}
+
+// txParties derives the sender, receiver, amount and type columns of a
+// transaction row from the transaction itself. Coinbase transactions
+// are recorded as rewards from SYSTEM, or as fees for those collecting
+// the fees of their block or as bridge credits for those crediting
+// deposits made on another chain, and anchor transactions as anchors
+// from SYSTEM; otherwise the receiver is the first output not returning
+// change to the sender.
+func txParties(tx *blockchain.Transaction) (string, string, int, string) {
+	if tx.IsAnchor() {
+		return "SYSTEM", "", 0, "anchor"
+	}
+	if tx.IsCoinbase() {
+		kind := "reward"
+		if tx.IsFeeCoinbase() {
+			kind = "fee"
+		} else if _, ok := tx.BridgeRef(); ok {
+			kind = "bridge"
+		}
+		if len(tx.Vout) == 0 {
+			return "SYSTEM", "", 0, kind
+		}
+		return "SYSTEM", blockchain.EncodeAddress(tx.Vout[0].Owner()), tx.Vout[0].Value, kind
+	}
+
+	sender := ""
+	if len(tx.Vin) > 0 {
+		sender = blockchain.PubKeyAddress(tx.Vin[0].PubKey)
+	}
+	for _, out := range tx.Vout {
+		if to := blockchain.EncodeAddress(out.Owner()); to != sender {
+			return sender, to, out.Value, "send"
+		}
+	}
+	// payment to self
+	if len(tx.Vout) > 0 {
+		return sender, sender, tx.Vout[0].Value, "send"
+	}
+	return sender, "", 0, "send"
+}
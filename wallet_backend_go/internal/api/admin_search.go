@@ -0,0 +1,181 @@
+package api
+
+// admin_search.go is the support desk lookup. GET /admin/search?q=
+// finds users by email or CNIC, wallets and beneficiaries by address
+// (and beneficiaries by CNIC), and transactions by txid, ranked exact
+// match first, then prefix, then substring. It requires an admin API
+// key, and every search is written to the system log with the admin's
+// name so lookups of personal data can be audited.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"wallet_backend_go/internal/db"
+)
+
+const (
+	searchMinQuery     = 3
+	searchMaxQuery     = 128
+	searchDefaultLimit = 20
+	searchMaxLimit     = 100
+)
+
+// Match ranks.
+const (
+	searchExact    = 100
+	searchPrefix   = 60
+	searchContains = 30
+)
+
+type searchHit struct {
+	Kind   string      `json:"kind"`  // user, wallet, beneficiary, transaction
+	ID     string      `json:"id"`    // user/beneficiary id, wallet address or txid
+	Field  string      `json:"field"` // column that matched
+	Match  string      `json:"match"` // exact, prefix or contains
+	Score  int         `json:"score"`
+	Record interface{} `json:"record"`
+}
+
+type searchResponse struct {
+	Query   string      `json:"query"`
+	Count   int         `json:"count"`
+	Results []searchHit `json:"results"`
+}
+
+type searchWallet struct {
+	UserID        string `json:"user_id"`
+	TenantID      string `json:"tenant_id,omitempty"`
+	WalletAddress string `json:"wallet_address"`
+	Status        string `json:"status"`
+}
+
+// validSearchQuery reports whether q only holds characters that can
+// appear in an email, CNIC, address or txid.
+func validSearchQuery(q string) bool {
+	for _, c := range q {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("@._+-", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// matchScore ranks how value matches q, case-insensitively; 0 means it
+// does not.
+func matchScore(value, q string) (int, string) {
+	v, q := strings.ToLower(value), strings.ToLower(q)
+	switch {
+	case v == "":
+		return 0, ""
+	case v == q:
+		return searchExact, "exact"
+	case strings.HasPrefix(v, q):
+		return searchPrefix, "prefix"
+	case strings.Contains(v, q):
+		return searchContains, "contains"
+	}
+	return 0, ""
+}
+
+// bestMatch returns the best scoring of the named fields.
+func bestMatch(q string, fields ...[2]string) (score int, field, match string) {
+	for _, f := range fields {
+		if sc, m := matchScore(f[1], q); sc > score {
+			score, field, match = sc, f[0], m
+		}
+	}
+	return score, field, match
+}
+
+// rankSearch turns the candidate rows into hits, dropping rows that do
+// not actually match (an ilike on an encrypted column can), best first.
+func rankSearch(m *db.SearchMatches, q string) []searchHit {
+	hits := []searchHit{}
+	add := func(kind, id string, record interface{}, fields ...[2]string) {
+		if score, field, match := bestMatch(q, fields...); score > 0 {
+			hits = append(hits, searchHit{Kind: kind, ID: id, Field: field, Match: match, Score: score, Record: record})
+		}
+	}
+
+	for _, u := range m.Users {
+		add("user", u.ID, u, [2]string{"email", u.Email}, [2]string{"cnic", u.CNIC})
+	}
+	for _, wp := range m.Wallets {
+		rec := searchWallet{UserID: wp.UserID, TenantID: wp.TenantID, WalletAddress: wp.WalletAddress, Status: wp.Status}
+		add("wallet", wp.WalletAddress, rec, [2]string{"wallet_address", wp.WalletAddress})
+	}
+	for _, b := range m.Beneficiaries {
+		add("beneficiary", b.ID, b, [2]string{"cnic", b.CNIC}, [2]string{"wallet_address", b.WalletAddress})
+	}
+	for _, tx := range m.Transactions {
+		add("transaction", tx.TxID, tx, [2]string{"txid", tx.TxID})
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].Kind != hits[j].Kind {
+			return hits[i].Kind < hits[j].Kind
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	return hits
+}
+
+// AdminSearch looks up users, wallets, beneficiaries and transactions
+// by partial email, CNIC, wallet address or txid.
+func (s *Server) AdminSearch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if len(q) < searchMinQuery || len(q) > searchMaxQuery {
+		httpError(w, r, "q must be 3 to 128 characters", http.StatusBadRequest)
+		return
+	}
+	if !validSearchQuery(q) {
+		httpError(w, r, "q may only contain letters, digits and @ . _ + -", http.StatusBadRequest)
+		return
+	}
+	limit := searchDefaultLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 || parsed > searchMaxLimit {
+			httpError(w, r, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	matches, err := s.DB.Search(ctx, tenantID(ctx), q, limit)
+	if err != nil {
+		httpError(w, r, "search failed", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "admin_search_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	hits := rankSearch(matches, q)
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	s.logEvent(ctx, "info", "admin_search",
+		fmt.Sprintf("admin %s searched %q: %d results", adminName(ctx), q, len(hits)),
+		r.RemoteAddr,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(searchResponse{Query: q, Count: len(hits), Results: hits})
+}
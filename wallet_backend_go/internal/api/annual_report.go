@@ -0,0 +1,350 @@
+package api
+
+// annual_report.go builds the organization-level annual report: zakat
+// collected, zakat disbursed from the pool by beneficiary category,
+// beneficiaries served and the month-end pool balance. Assembling it
+// scans the chain and Supabase, so it runs on the background worker and
+// the result is cached per tenant and year; clients poll the admin job
+// and fetch the report again once it completes. Reports of past years
+// never change and are kept until restart, the current year's expire
+// after annualReportTTL. Beneficiaries' signed receipt
+// acknowledgements of the year's disbursements are included so they can
+// be checked independently; acknowledging drops the cached reports.
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+)
+
+// annualReportTTL bounds the staleness of the current year's report.
+const annualReportTTL = time.Hour
+
+type poolBalancePoint struct {
+	Month   string `json:"month"` // YYYY-MM
+	Balance int    `json:"balance"`
+}
+
+type annualReport struct {
+	Year                int                `json:"year"`
+	TenantID            string             `json:"tenant_id,omitempty"`
+	PoolAddress         string             `json:"pool_address"`
+	GeneratedAt         time.Time          `json:"generated_at"`
+	ZakatCollected      int                `json:"zakat_collected"`
+	ZakatRecords        int                `json:"zakat_records"`
+	ZakatDisbursed      int                `json:"zakat_disbursed"`
+	DisbursedByCategory map[string]int     `json:"disbursed_by_category"`
+	BeneficiariesServed int                `json:"beneficiaries_served"`
+	PoolBalanceTrend    []poolBalancePoint `json:"pool_balance_trend"`
+
+	// Disbursements counts payments from the pool to a wallet, of
+	// which DisbursementsAcknowledged were confirmed by the recipient.
+	Disbursements             int                      `json:"disbursements"`
+	DisbursementsAcknowledged int                      `json:"disbursements_acknowledged"`
+	AcknowledgedAmount        int                      `json:"acknowledged_amount"`
+	Acknowledgements          []models.DisbursementAck `json:"acknowledgements"`
+}
+
+type cachedAnnualReport struct {
+	report   *annualReport
+	storedAt time.Time
+}
+
+// annualReportCache keeps assembled reports by tenant and year.
+type annualReportCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedAnnualReport
+}
+
+func annualReportKey(tenant string, year int) string {
+	return fmt.Sprintf("%s|%d", tenant, year)
+}
+
+func (c *annualReportCache) get(tenant string, year int, now time.Time) (*annualReport, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[annualReportKey(tenant, year)]
+	if !ok {
+		return nil, false
+	}
+	if year == now.UTC().Year() && now.Sub(e.storedAt) > annualReportTTL {
+		return nil, false
+	}
+	return e.report, true
+}
+
+func (c *annualReportCache) put(tenant string, year int, report *annualReport, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]cachedAnnualReport)
+	}
+	c.entries[annualReportKey(tenant, year)] = cachedAnnualReport{report: report, storedAt: now}
+}
+
+// reset drops every cached report.
+func (c *annualReportCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = nil
+}
+
+// AnnualReport returns the cached annual report for ?year= as JSON, or
+// as CSV with ?format=csv. On a cache miss it starts (or joins) the
+// background job assembling the report and responds 202 with the job.
+func (s *Server) AnnualReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tenant := tenantID(ctx)
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	year, err := strconv.Atoi(r.URL.Query().Get("year"))
+	if err != nil || year < 2000 || year > s.Clock.Now().UTC().Year() {
+		httpError(w, r, "invalid year", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		httpError(w, r, "format must be json or csv", http.StatusBadRequest)
+		return
+	}
+
+	if report, ok := s.annualReports.get(tenant, year, s.Clock.Now()); ok {
+		w.Header().Set(cacheStatusHeader, "HIT")
+		writeAnnualReport(w, report, format)
+		return
+	}
+	w.Header().Set(cacheStatusHeader, "MISS")
+
+	kind := "annual_report:" + annualReportKey(tenant, year)
+	job, ok := s.adminJobs.running(kind)
+	if !ok {
+		if j, started := s.adminJobs.start(kind, []string{"assemble"}, s.Clock.Now()); started {
+			s.startAnnualReport(j.ID, tenant, year)
+			job, _ = s.adminJobs.get(j.ID)
+		} else {
+			// a concurrent request started it first
+			job, _ = s.adminJobs.running(kind)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/v1/admin/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+// startAnnualReport queues the assembly of a report on the worker.
+func (s *Server) startAnnualReport(jobID, tenant string, year int) {
+	s.adminJobs.setStep(jobID, 0, jobStatusRunning, "")
+
+	queued := s.enqueue("annual_report", func(ctx context.Context) error {
+		report, err := s.buildAnnualReport(ctx, tenant, year)
+		if err != nil {
+			s.adminJobs.setStep(jobID, 0, jobStatusFailed, err.Error())
+			s.adminJobs.finish(jobID, err, s.Clock.Now())
+			return err
+		}
+
+		s.annualReports.put(tenant, year, report, s.Clock.Now())
+		s.adminJobs.setStep(jobID, 0, jobStatusCompleted,
+			fmt.Sprintf("zakat collected %d, disbursed %d", report.ZakatCollected, report.ZakatDisbursed))
+		s.adminJobs.finish(jobID, nil, s.Clock.Now())
+		return nil
+	})
+	if !queued {
+		err := fmt.Errorf("background queue full")
+		s.adminJobs.setStep(jobID, 0, jobStatusFailed, err.Error())
+		s.adminJobs.finish(jobID, err, s.Clock.Now())
+	}
+}
+
+// buildAnnualReport assembles the report of tenant for year.
+func (s *Server) buildAnnualReport(ctx context.Context, tenant string, year int) (*annualReport, error) {
+	pool, err := s.zakatAddressFor(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	poolHash, err := blockchain.DecodeAddress(pool)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pool address %s", pool)
+	}
+
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0)
+
+	records, err := s.DB.ListZakatBetween(ctx, tenant, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	beneficiaries, err := s.DB.ListBeneficiariesRanked(ctx, tenant, 0)
+	if err != nil {
+		return nil, err
+	}
+	categories := make(map[string]string, len(beneficiaries))
+	for _, b := range beneficiaries {
+		categories[b.WalletAddress] = b.Category
+	}
+
+	ackList, err := s.DB.ListDisbursementAcks(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	acks := make(map[string]models.DisbursementAck, len(ackList))
+	for _, a := range ackList {
+		acks[a.ID] = a
+	}
+
+	report := &annualReport{
+		Year:                year,
+		TenantID:            tenant,
+		PoolAddress:         pool,
+		GeneratedAt:         s.Clock.Now().UTC(),
+		ZakatRecords:        len(records),
+		DisbursedByCategory: make(map[string]int),
+		PoolBalanceTrend:    []poolBalancePoint{},
+		Acknowledgements:    []models.DisbursementAck{},
+	}
+	for _, zr := range records {
+		report.ZakatCollected += zr.Amount
+	}
+
+	s.chainMu.Lock()
+	blocks := append([]*blockchain.Block(nil), s.BC.Blocks...)
+	s.chainMu.Unlock()
+
+	// Replay the chain tracking the pool's unspent outputs, so both the
+	// month-end balances and the transactions spending from the pool
+	// (disbursements) fall out of one pass.
+	poolOutputs := make(map[string]int) // "txid:vout" -> value
+	balance := 0
+	served := make(map[string]bool)
+	paid := make(map[string]bool) // disbursementAckID
+	month := from.AddDate(0, 1, 0)
+	lastMonth := to
+	if now := s.Clock.Now().UTC(); now.Before(to) {
+		lastMonth = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+	}
+	recordMonths := func(until time.Time) {
+		for !month.After(lastMonth) && !month.After(until) {
+			report.PoolBalanceTrend = append(report.PoolBalanceTrend, poolBalancePoint{
+				Month:   month.AddDate(0, -1, 0).Format("2006-01"),
+				Balance: balance,
+			})
+			month = month.AddDate(0, 1, 0)
+		}
+	}
+
+	for _, b := range blocks {
+		ts := time.Unix(b.Timestamp, 0).UTC()
+		recordMonths(ts)
+
+		for _, tx := range b.Transactions {
+			fromPool := false
+			if !tx.IsCoinbase() {
+				for _, in := range tx.Vin {
+					key := fmt.Sprintf("%x:%d", in.Txid, in.Vout)
+					if v, ok := poolOutputs[key]; ok {
+						fromPool = true
+						balance -= v
+						delete(poolOutputs, key)
+					}
+				}
+			}
+
+			for i, out := range tx.Vout {
+				if out.IsLockedWith(poolHash) {
+					poolOutputs[fmt.Sprintf("%x:%d", tx.ID, i)] = out.Value
+					balance += out.Value
+					continue
+				}
+				if fromPool && !ts.Before(from) && ts.Before(to) {
+					recipient := blockchain.EncodeAddress(out.Owner())
+					category := categories[recipient]
+					if category == "" {
+						category = "uncategorized"
+					}
+					report.ZakatDisbursed += out.Value
+					report.DisbursedByCategory[category] += out.Value
+					served[recipient] = true
+
+					id := disbursementAckID(fmt.Sprintf("%x", tx.ID), recipient)
+					if paid[id] {
+						continue
+					}
+					paid[id] = true
+					report.Disbursements++
+					if a, ok := acks[id]; ok {
+						report.DisbursementsAcknowledged++
+						report.AcknowledgedAmount += a.Amount
+						report.Acknowledgements = append(report.Acknowledgements, a)
+					}
+				}
+			}
+		}
+	}
+	recordMonths(lastMonth)
+	report.BeneficiariesServed = len(served)
+
+	return report, nil
+}
+
+// writeAnnualReport encodes report as JSON or CSV.
+func writeAnnualReport(w http.ResponseWriter, report *annualReport, format string) {
+	if format != "csv" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(report)
+		return
+	}
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	_ = cw.Write([]string{"section", "key", "value"})
+	_ = cw.Write([]string{"summary", "year", strconv.Itoa(report.Year)})
+	_ = cw.Write([]string{"summary", "pool_address", report.PoolAddress})
+	_ = cw.Write([]string{"summary", "zakat_collected", strconv.Itoa(report.ZakatCollected)})
+	_ = cw.Write([]string{"summary", "zakat_records", strconv.Itoa(report.ZakatRecords)})
+	_ = cw.Write([]string{"summary", "zakat_disbursed", strconv.Itoa(report.ZakatDisbursed)})
+	_ = cw.Write([]string{"summary", "beneficiaries_served", strconv.Itoa(report.BeneficiariesServed)})
+	_ = cw.Write([]string{"summary", "disbursements", strconv.Itoa(report.Disbursements)})
+	_ = cw.Write([]string{"summary", "disbursements_acknowledged", strconv.Itoa(report.DisbursementsAcknowledged)})
+	_ = cw.Write([]string{"summary", "acknowledged_amount", strconv.Itoa(report.AcknowledgedAmount)})
+
+	categories := make([]string, 0, len(report.DisbursedByCategory))
+	for c := range report.DisbursedByCategory {
+		categories = append(categories, c)
+	}
+	sort.Strings(categories)
+	for _, c := range categories {
+		_ = cw.Write([]string{"disbursed_by_category", c, strconv.Itoa(report.DisbursedByCategory[c])})
+	}
+	for _, p := range report.PoolBalanceTrend {
+		_ = cw.Write([]string{"pool_balance", p.Month, strconv.Itoa(p.Balance)})
+	}
+	for _, a := range report.Acknowledgements {
+		_ = cw.Write([]string{"acknowledgement", a.ID, a.Signature})
+	}
+	cw.Flush()
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="annual-report-%d.csv"`, report.Year))
+	_, _ = w.Write(buf.Bytes())
+}
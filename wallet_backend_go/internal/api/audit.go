@@ -0,0 +1,283 @@
+package api
+
+// audit.go keeps an audit trail of the mutating API requests (POST and
+// PATCH) for dispute resolution. Each request is stored in api_audit
+// with its body, after private keys, PINs, OTPs and other secrets are
+// redacted, the status and a summary of the response, the session
+// user or admin that made it and the transactions it created, so
+// admins can retrieve what a user did or how a transaction came about.
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/models"
+)
+
+const (
+	maxAuditBody     = 8 << 10 // bytes of request body kept
+	maxAuditResponse = 1 << 10 // bytes of response kept
+
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+
+	redacted = "[redacted]"
+)
+
+// auditRedactedFields are the JSON fields whose values are never
+// stored, compared in lower case without underscores.
+var auditRedactedFields = map[string]bool{
+	"privkey":      true,
+	"privatekey":   true,
+	"pin":          true,
+	"currentpin":   true,
+	"otp":          true,
+	"token":        true,
+	"captchatoken": true,
+	"canceltoken":  true,
+	"cancelurl":    true, // carries the cancel token
+	"viewkey":      true,
+	"secret":       true,
+	"password":     true,
+	"mnemonic":     true, // HD wallet seed words
+	"passphrase":   true,
+	"cnic":         true, // national ID, personal data
+	"contact":      true, // invitee's email or phone
+	"fullname":     true, // donation declarations
+	"homeaddress":  true,
+	"postcode":     true,
+}
+
+// redactJSON replaces the values of secret fields anywhere in v.
+func redactJSON(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			if auditRedactedFields[strings.ToLower(strings.ReplaceAll(k, "_", ""))] {
+				t[k] = redacted
+			} else {
+				t[k] = redactJSON(val)
+			}
+		}
+	case []any:
+		for i := range t {
+			t[i] = redactJSON(t[i])
+		}
+	}
+	return v
+}
+
+// sanitizeBody returns a JSON body with its secrets redacted, cut to
+// max bytes. Bodies that are not JSON are only described, as secrets
+// cannot be told apart in them.
+func sanitizeBody(body []byte, max int) string {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return ""
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Sprintf("[%d bytes, not JSON]", len(body))
+	}
+	out, _ := json.Marshal(redactJSON(v))
+	if len(out) > max {
+		return string(out[:max]) + "…"
+	}
+	return string(out)
+}
+
+// auditNote collects what handlers report about a request.
+type auditNote struct {
+	mu    sync.Mutex
+	txids []string
+}
+
+type auditCtxKey struct{}
+
+// noteAuditTx links the audited request of ctx to a transaction. It
+// does nothing outside an audited request.
+func noteAuditTx(ctx context.Context, txid []byte) {
+	note, ok := ctx.Value(auditCtxKey{}).(*auditNote)
+	if !ok {
+		return
+	}
+	note.mu.Lock()
+	note.txids = append(note.txids, hex.EncodeToString(txid))
+	note.mu.Unlock()
+}
+
+// auditRecorder keeps the status and the start of a response.
+type auditRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *auditRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *auditRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if room := maxAuditResponse*4 - rec.body.Len(); room > 0 {
+		rec.body.Write(p[:min(len(p), room)])
+	}
+	return rec.ResponseWriter.Write(p)
+}
+
+// summary describes the response: its JSON with secrets redacted, or
+// its text (error messages are plain text).
+func (rec *auditRecorder) summary() string {
+	body := bytes.TrimSpace(rec.body.Bytes())
+	if strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+		return sanitizeBody(body, maxAuditResponse)
+	}
+	if len(body) > maxAuditResponse {
+		return string(body[:maxAuditResponse]) + "…"
+	}
+	return string(body)
+}
+
+// withAudit records POST and PATCH requests in api_audit.
+func (s *Server) withAudit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.DB == nil || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			httpError(w, r, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		note := &auditNote{}
+		r = r.WithContext(context.WithValue(r.Context(), auditCtxKey{}, note))
+		rec := &auditRecorder{ResponseWriter: w}
+		start := s.Clock.Now()
+		next.ServeHTTP(rec, r)
+
+		entry := &models.APIAudit{
+			ID:              uuid.New().String(),
+			TenantID:        tenantID(r.Context()),
+			Method:          r.Method,
+			Path:            r.URL.Path,
+			RequestBody:     sanitizeBody(body, maxAuditBody),
+			Status:          rec.status,
+			ResponseSummary: rec.summary(),
+			IP:              r.RemoteAddr,
+			DurationMS:      s.Clock.Now().Sub(start).Milliseconds(),
+			CreatedAt:       s.Clock.Now().UTC(),
+		}
+		if route := mux.CurrentRoute(r); route != nil {
+			entry.Route, _ = route.GetPathTemplate()
+		}
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			if claims, err := s.parseSession(token); err == nil {
+				entry.UserID = claims.Subject
+			} else {
+				entry.Admin = adminFor(adminKeys(), r)
+			}
+		}
+		entry.WalletAddress, entry.TxIDs = auditSubjects(r, body, note)
+
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := s.DB.CreateAPIAudit(ctx, entry); err != nil {
+				log.Printf("failed to save API audit record: %v", err)
+			}
+		}()
+	})
+}
+
+// auditSubjects finds the wallet a request acted on (path or body) and
+// the transactions it referenced (path) or created (noted by handlers).
+func auditSubjects(r *http.Request, body []byte, note *auditNote) (string, []string) {
+	vars := mux.Vars(r)
+	wallet := vars["address"]
+	if wallet == "" {
+		var fields map[string]any
+		_ = json.Unmarshal(body, &fields)
+		for _, k := range []string{"from", "wallet_address", "address"} {
+			if v, ok := fields[k].(string); ok && v != "" {
+				wallet = v
+				break
+			}
+		}
+	}
+
+	txids := []string{}
+	if txid := vars["txid"]; txid != "" {
+		txids = append(txids, txid)
+	}
+	note.mu.Lock()
+	txids = append(txids, note.txids...)
+	note.mu.Unlock()
+	return wallet, txids
+}
+
+type auditListResponse struct {
+	Records []models.APIAudit `json:"records"`
+}
+
+// ListAPIAudit returns the audit records of a user (?user_id=) or a
+// transaction (?txid=), newest first.
+func (s *Server) ListAPIAudit(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	q := r.URL.Query()
+	userID, txid := q.Get("user_id"), q.Get("txid")
+	if userID == "" && txid == "" {
+		httpError(w, r, "user_id or txid is required", http.StatusBadRequest)
+		return
+	}
+	limit := defaultAuditPageSize
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 || n > maxAuditPageSize {
+			httpError(w, r, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	records, err := s.DB.ListAPIAudit(ctx, tenantID(ctx), userID, txid, limit)
+	if err != nil {
+		httpError(w, r, "failed to load audit records", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "api_audit_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if records == nil {
+		records = []models.APIAudit{}
+	}
+	s.logEvent(ctx, "info", "api_audit_viewed",
+		fmt.Sprintf("%s viewed audit records (user %q, txid %q)", adminName(ctx), userID, txid), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(auditListResponse{Records: records})
+}
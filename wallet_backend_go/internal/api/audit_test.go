@@ -0,0 +1,80 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"wallet_backend_go/internal/db"
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/testutil"
+)
+
+// auditStore hands the API audit records to the test.
+type auditStore struct {
+	db.Store
+	audits chan *models.APIAudit
+}
+
+func (s *auditStore) LogSystemEvent(ctx context.Context, level, typ, message, ip string) {}
+
+func (s *auditStore) ListHeldTransfers(ctx context.Context, status string) ([]models.HeldTransfer, error) {
+	return nil, nil
+}
+
+func (s *auditStore) CreateAPIAudit(ctx context.Context, a *models.APIAudit) error {
+	s.audits <- a
+	return nil
+}
+
+func (s *auditStore) next(t *testing.T) *models.APIAudit {
+	t.Helper()
+	select {
+	case a := <-s.audits:
+		return a
+	case <-time.After(5 * time.Second):
+		t.Fatal("no audit record written")
+		return nil
+	}
+}
+
+// TestAuditRedactsSecrets checks that the mnemonic and passphrase of
+// the HD wallet endpoints, in requests and responses, and the keys
+// derived from them never reach the audit records.
+func TestAuditRedactsSecrets(t *testing.T) {
+	c := testutil.NewChain(t)
+	store := &auditStore{audits: make(chan *models.APIAudit, 4)}
+	h := testutil.NewServerWithStore(t, c, store).Router()
+
+	var created struct {
+		Mnemonic  string `json:"mnemonic"`
+		Addresses []struct {
+			PrivateKey string `json:"private_key"`
+		} `json:"addresses"`
+	}
+	rec := testutil.Do(t, h, "POST", "/wallets/hd", map[string]interface{}{"passphrase": "correct horse"})
+	testutil.DecodeJSON(t, rec, http.StatusOK, &created)
+	if created.Mnemonic == "" || len(created.Addresses) == 0 {
+		t.Fatalf("created wallet = %+v, want a mnemonic and an address", created)
+	}
+	secrets := []string{created.Mnemonic, "correct horse", created.Addresses[0].PrivateKey}
+
+	rec = testutil.Do(t, h, "POST", "/wallets/hd/derive", map[string]interface{}{
+		"mnemonic": created.Mnemonic, "passphrase": "correct horse",
+	})
+	testutil.DecodeJSON(t, rec, http.StatusOK, nil)
+
+	for i := 0; i < 2; i++ {
+		a := store.next(t)
+		for _, secret := range secrets {
+			if strings.Contains(a.RequestBody, secret) || strings.Contains(a.ResponseSummary, secret) {
+				t.Errorf("audit of %s keeps %q:\nrequest %s\nresponse %s", a.Path, secret, a.RequestBody, a.ResponseSummary)
+			}
+		}
+		if !strings.Contains(a.RequestBody, `"passphrase":"[redacted]"`) {
+			t.Errorf("audit of %s: request %s, want the passphrase redacted", a.Path, a.RequestBody)
+		}
+	}
+}
@@ -0,0 +1,556 @@
+package api
+
+// beneficiaries.go manages zakat beneficiaries and their needs
+// assessment. Each beneficiary is scored from household size, income
+// and document verification; the score and the criteria that produced
+// it are stored in Supabase so disbursements can be ranked and later
+// audited against the reasons a beneficiary was chosen. Beneficiaries
+// are registered as pending; an admin approves them before the pool
+// distribution (zakat_distribute.go) pays them.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/payout"
+	"wallet_backend_go/internal/zakat"
+)
+
+// Beneficiary statuses.
+const (
+	beneficiaryPending   = "pending"
+	beneficiaryApproved  = "approved"
+	beneficiarySuspended = "suspended"
+)
+
+// Needs assessment weights. Per-capita income bands are in the same
+// local currency as Beneficiary.MonthlyIncome.
+const (
+	scorePerHouseholdMember = 10
+	maxHouseholdScore       = 80
+	scoreDocumentsVerified  = 20
+)
+
+var perCapitaIncomeBands = []struct {
+	Below int
+	Score int
+}{
+	{Below: 5000, Score: 50},
+	{Below: 10000, Score: 35},
+	{Below: 20000, Score: 20},
+}
+
+type beneficiaryRequest struct {
+	FullName          string `json:"full_name"`
+	CNIC              string `json:"cnic"`
+	Category          string `json:"category"`
+	WalletAddress     string `json:"wallet_address"`
+	PayoutMethod      string `json:"payout_method"`
+	PayoutAccount     string `json:"payout_account"`
+	PayoutAccountName string `json:"payout_account_name"`
+	PayoutBankCode    string `json:"payout_bank_code"`
+	MobileNumber      string `json:"mobile_number"`
+	MobileProvider    string `json:"mobile_provider"`
+	HouseholdSize     int    `json:"household_size"`
+	MonthlyIncome     int    `json:"monthly_income"`
+	DocumentsVerified bool   `json:"documents_verified"`
+}
+
+type assessmentRequest struct {
+	HouseholdSize     int  `json:"household_size"`
+	MonthlyIncome     int  `json:"monthly_income"`
+	DocumentsVerified bool `json:"documents_verified"`
+}
+
+// beneficiaryPatch changes the fields it sets.
+type beneficiaryPatch struct {
+	FullName          *string `json:"full_name"`
+	CNIC              *string `json:"cnic"`
+	Category          *string `json:"category"`
+	WalletAddress     *string `json:"wallet_address"`
+	PayoutMethod      *string `json:"payout_method"`
+	PayoutAccount     *string `json:"payout_account"`
+	PayoutAccountName *string `json:"payout_account_name"`
+	PayoutBankCode    *string `json:"payout_bank_code"`
+	MobileNumber      *string `json:"mobile_number"`
+	MobileProvider    *string `json:"mobile_provider"`
+	Status            *string `json:"status"`
+}
+
+type beneficiariesResponse struct {
+	Beneficiaries []models.Beneficiary `json:"beneficiaries"`
+}
+
+// rankedBeneficiary is the part of a beneficiary the ranking shows;
+// identity documents, income and payout details stay out of it.
+type rankedBeneficiary struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+	NeedsScore  int    `json:"needs_score"`
+	Category    string `json:"category"`
+}
+
+type rankedBeneficiariesResponse struct {
+	Beneficiaries []rankedBeneficiary `json:"beneficiaries"`
+}
+
+// scoreBeneficiary computes the needs score of b and records the
+// criteria that contributed to it.
+func scoreBeneficiary(b *models.Beneficiary) {
+	score := 0
+	criteria := []string{}
+
+	if b.HouseholdSize > 0 {
+		hs := b.HouseholdSize * scorePerHouseholdMember
+		if hs > maxHouseholdScore {
+			hs = maxHouseholdScore
+		}
+		score += hs
+		criteria = append(criteria, fmt.Sprintf("household_size=%d (+%d)", b.HouseholdSize, hs))
+
+		perCapita := b.MonthlyIncome / b.HouseholdSize
+		for _, band := range perCapitaIncomeBands {
+			if perCapita < band.Below {
+				score += band.Score
+				criteria = append(criteria, fmt.Sprintf("per_capita_income<%d (+%d)", band.Below, band.Score))
+				break
+			}
+		}
+	}
+
+	if b.DocumentsVerified {
+		score += scoreDocumentsVerified
+		criteria = append(criteria, fmt.Sprintf("documents_verified (+%d)", scoreDocumentsVerified))
+	}
+
+	b.NeedsScore = score
+	b.ScoreCriteria = criteria
+}
+
+// CreateBeneficiary registers a new beneficiary and scores their needs
+// assessment.
+func (s *Server) CreateBeneficiary(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req beneficiaryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.FullName == "" || req.CNIC == "" {
+		httpError(w, r, "full_name, cnic and wallet_address are required", http.StatusBadRequest)
+		return
+	}
+	// a beneficiary without a wallet is paid through a provider
+	if req.WalletAddress == "" && req.PayoutMethod == "" && req.MobileNumber == "" {
+		httpError(w, r, "wallet_address, payout_method or mobile_number is required", http.StatusBadRequest)
+		return
+	}
+	if req.WalletAddress != "" && !blockchain.ValidateAddress(req.WalletAddress) {
+		httpError(w, r, "invalid address", http.StatusBadRequest)
+		return
+	}
+	if req.Category != "" && !zakat.ValidCategory(req.Category) {
+		httpError(w, r, "invalid category", http.StatusBadRequest)
+		return
+	}
+	req.PayoutAccount = payout.NormalizeAccount(req.PayoutMethod, req.PayoutAccount)
+	req.PayoutBankCode = strings.ToUpper(strings.TrimSpace(req.PayoutBankCode))
+	if msg := validPayoutAccount(req.PayoutMethod, req.PayoutAccount, req.PayoutBankCode); msg != "" {
+		httpError(w, r, msg, http.StatusBadRequest)
+		return
+	}
+	req.MobileNumber = payout.NormalizePhone(req.MobileNumber)
+	if msg := validMobileWallet(req.MobileNumber, req.MobileProvider); msg != "" {
+		httpError(w, r, msg, http.StatusBadRequest)
+		return
+	}
+	if req.HouseholdSize < 0 || req.MonthlyIncome < 0 {
+		httpError(w, r, "household_size and monthly_income must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	b := &models.Beneficiary{
+		ID:                uuid.NewString(),
+		TenantID:          tenantID(ctx),
+		FullName:          req.FullName,
+		CNIC:              req.CNIC,
+		Category:          req.Category,
+		WalletAddress:     req.WalletAddress,
+		PayoutMethod:      req.PayoutMethod,
+		PayoutAccount:     req.PayoutAccount,
+		PayoutAccountName: strings.TrimSpace(req.PayoutAccountName),
+		PayoutBankCode:    req.PayoutBankCode,
+		MobileNumber:      req.MobileNumber,
+		MobileProvider:    req.MobileProvider,
+		HouseholdSize:     req.HouseholdSize,
+		MonthlyIncome:     req.MonthlyIncome,
+		DocumentsVerified: req.DocumentsVerified,
+		Status:            beneficiaryPending,
+		CreatedAt:         s.Clock.Now().UTC(),
+	}
+	scoreBeneficiary(b)
+
+	if err := s.DB.CreateBeneficiary(ctx, b); err != nil {
+		httpError(w, r, "failed to create beneficiary", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "beneficiary_create_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	s.logEvent(ctx, "info", "beneficiary_created",
+		fmt.Sprintf("beneficiary %s scored %d", b.ID, b.NeedsScore),
+		r.RemoteAddr,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(b)
+}
+
+// UpdateBeneficiaryAssessment replaces the needs assessment inputs of a
+// beneficiary and re-scores them.
+func (s *Server) UpdateBeneficiaryAssessment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req assessmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.HouseholdSize < 0 || req.MonthlyIncome < 0 {
+		httpError(w, r, "household_size and monthly_income must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	b := s.tenantBeneficiary(w, r, id)
+	if b == nil {
+		return
+	}
+
+	b.HouseholdSize = req.HouseholdSize
+	b.MonthlyIncome = req.MonthlyIncome
+	b.DocumentsVerified = req.DocumentsVerified
+	scoreBeneficiary(b)
+
+	if err := s.DB.UpdateBeneficiary(ctx, b); err != nil {
+		httpError(w, r, "failed to update beneficiary", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "beneficiary_update_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	s.logEvent(ctx, "info", "beneficiary_assessed",
+		fmt.Sprintf("beneficiary %s re-scored %d", b.ID, b.NeedsScore),
+		r.RemoteAddr,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(b)
+}
+
+// RankedBeneficiaries returns the tenant's beneficiaries ordered by
+// needs score so the disbursement workflow can allocate to the most in
+// need first.
+func (s *Server) RankedBeneficiaries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	limit := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 0 {
+			httpError(w, r, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	list, err := s.DB.ListBeneficiariesRanked(ctx, tenantID(ctx), limit)
+	if err != nil {
+		httpError(w, r, "failed to list beneficiaries", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "beneficiary_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	ranked := make([]rankedBeneficiary, 0, len(list))
+	for _, b := range list {
+		ranked = append(ranked, rankedBeneficiary{ID: b.ID, DisplayName: b.FullName, NeedsScore: b.NeedsScore, Category: b.Category})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rankedBeneficiariesResponse{Beneficiaries: ranked})
+}
+
+// tenantBeneficiary loads beneficiary id when it is visible to the
+// tenant. On failure it writes the error response and returns nil.
+func (s *Server) tenantBeneficiary(w http.ResponseWriter, r *http.Request, id string) *models.Beneficiary {
+	ctx := r.Context()
+	b, err := s.DB.GetBeneficiary(ctx, id)
+	if err != nil {
+		httpError(w, r, "failed to load beneficiary", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "beneficiary_get_failed", err.Error(), r.RemoteAddr)
+		return nil
+	}
+	if b == nil || (tenantID(ctx) != "" && b.TenantID != tenantID(ctx)) {
+		httpError(w, r, "beneficiary not found", http.StatusNotFound)
+		return nil
+	}
+	return b
+}
+
+// beneficiaryStatus is the status of b; rows stored before
+// beneficiaries had one are pending.
+func beneficiaryStatus(b *models.Beneficiary) string {
+	if b.Status == "" {
+		return beneficiaryPending
+	}
+	return b.Status
+}
+
+func validBeneficiaryStatus(status string) bool {
+	return status == beneficiaryPending || status == beneficiaryApproved || status == beneficiarySuspended
+}
+
+// ListBeneficiaries returns the tenant's beneficiaries in registration
+// order, optionally filtered by ?status= and ?category=.
+func (s *Server) ListBeneficiaries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != "" && !validBeneficiaryStatus(status) {
+		httpError(w, r, "invalid status", http.StatusBadRequest)
+		return
+	}
+	category := r.URL.Query().Get("category")
+	if category != "" && !zakat.ValidCategory(category) {
+		httpError(w, r, "invalid category", http.StatusBadRequest)
+		return
+	}
+
+	list, err := s.DB.ListBeneficiaries(ctx, tenantID(ctx), status, category)
+	if err != nil {
+		httpError(w, r, "failed to list beneficiaries", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "beneficiary_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if list == nil {
+		list = []models.Beneficiary{}
+	}
+	for i := range list {
+		list[i].Status = beneficiaryStatus(&list[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(beneficiariesResponse{Beneficiaries: list})
+}
+
+// GetBeneficiary returns one beneficiary.
+func (s *Server) GetBeneficiary(w http.ResponseWriter, r *http.Request) {
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	b := s.tenantBeneficiary(w, r, mux.Vars(r)["id"])
+	if b == nil {
+		return
+	}
+	b.Status = beneficiaryStatus(b)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(b)
+}
+
+// UpdateBeneficiary changes a beneficiary's details or status. Approval
+// records the admin who gave it. Moving an approved beneficiary to
+// another wallet or payout account sends them back to pending unless
+// the same request approves them again, so a changed payout address is
+// always reviewed.
+func (s *Server) UpdateBeneficiary(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req beneficiaryPatch
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if (req.FullName != nil && *req.FullName == "") || (req.CNIC != nil && *req.CNIC == "") {
+		httpError(w, r, "full_name, cnic and wallet_address are required", http.StatusBadRequest)
+		return
+	}
+	if req.WalletAddress != nil && *req.WalletAddress != "" && !blockchain.ValidateAddress(*req.WalletAddress) {
+		httpError(w, r, "invalid address", http.StatusBadRequest)
+		return
+	}
+	if req.Category != nil && *req.Category != "" && !zakat.ValidCategory(*req.Category) {
+		httpError(w, r, "invalid category", http.StatusBadRequest)
+		return
+	}
+	if req.Status != nil && !validBeneficiaryStatus(*req.Status) {
+		httpError(w, r, "invalid status", http.StatusBadRequest)
+		return
+	}
+
+	b := s.tenantBeneficiary(w, r, mux.Vars(r)["id"])
+	if b == nil {
+		return
+	}
+	method, account := b.PayoutMethod, b.PayoutAccount
+	holder, bankCode := b.PayoutAccountName, b.PayoutBankCode
+	if req.PayoutMethod != nil {
+		method = *req.PayoutMethod
+		if method == "" {
+			account, holder, bankCode = "", "", ""
+		}
+	}
+	if req.PayoutAccount != nil {
+		account = payout.NormalizeAccount(method, *req.PayoutAccount)
+	}
+	if req.PayoutAccountName != nil {
+		holder = strings.TrimSpace(*req.PayoutAccountName)
+	}
+	if req.PayoutBankCode != nil {
+		bankCode = strings.ToUpper(strings.TrimSpace(*req.PayoutBankCode))
+	}
+	if req.PayoutMethod != nil || req.PayoutAccount != nil || req.PayoutBankCode != nil {
+		if msg := validPayoutAccount(method, account, bankCode); msg != "" {
+			httpError(w, r, msg, http.StatusBadRequest)
+			return
+		}
+	}
+	phone, provider := b.MobileNumber, b.MobileProvider
+	if req.MobileNumber != nil {
+		phone = payout.NormalizePhone(*req.MobileNumber)
+		if phone == "" {
+			provider = ""
+		}
+	}
+	if req.MobileProvider != nil {
+		provider = *req.MobileProvider
+	}
+	if req.MobileNumber != nil || req.MobileProvider != nil {
+		if msg := validMobileWallet(phone, provider); msg != "" {
+			httpError(w, r, msg, http.StatusBadRequest)
+			return
+		}
+	}
+	wallet := b.WalletAddress
+	if req.WalletAddress != nil {
+		wallet = *req.WalletAddress
+	}
+	if wallet == "" && method == "" && phone == "" {
+		httpError(w, r, "wallet_address, payout_method or mobile_number is required", http.StatusBadRequest)
+		return
+	}
+	before := beneficiaryStatus(b)
+	status := before
+
+	if req.FullName != nil {
+		b.FullName = *req.FullName
+	}
+	if req.CNIC != nil {
+		b.CNIC = *req.CNIC
+	}
+	if req.Category != nil {
+		b.Category = *req.Category
+	}
+	if wallet != b.WalletAddress {
+		b.WalletAddress = wallet
+		if status == beneficiaryApproved {
+			status = beneficiaryPending
+		}
+	}
+	if method != b.PayoutMethod || account != b.PayoutAccount || holder != b.PayoutAccountName || bankCode != b.PayoutBankCode {
+		b.PayoutMethod, b.PayoutAccount = method, account
+		b.PayoutAccountName, b.PayoutBankCode = holder, bankCode
+		if status == beneficiaryApproved {
+			status = beneficiaryPending
+		}
+	}
+	if phone != b.MobileNumber || provider != b.MobileProvider {
+		b.MobileNumber, b.MobileProvider = phone, provider
+		if status == beneficiaryApproved {
+			status = beneficiaryPending
+		}
+	}
+	if req.Status != nil {
+		status = *req.Status
+	}
+	if status == beneficiaryApproved && (before != beneficiaryApproved || b.ApprovedAt == nil) {
+		now := s.Clock.Now().UTC()
+		b.ApprovedBy, b.ApprovedAt = adminName(ctx), &now
+	} else if status != beneficiaryApproved {
+		b.ApprovedBy, b.ApprovedAt = "", nil
+	}
+	b.Status = status
+
+	if err := s.DB.UpdateBeneficiary(ctx, b); err != nil {
+		httpError(w, r, "failed to update beneficiary", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "beneficiary_update_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	msg := fmt.Sprintf("beneficiary %s updated by %s", b.ID, adminName(ctx))
+	if status != before {
+		msg = fmt.Sprintf("beneficiary %s %s -> %s by %s", b.ID, before, status, adminName(ctx))
+	}
+	s.logEvent(ctx, "info", "beneficiary_updated", msg, r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(b)
+}
+
+// DeleteBeneficiary removes a beneficiary. Their past disbursements
+// stay on record.
+func (s *Server) DeleteBeneficiary(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	b := s.tenantBeneficiary(w, r, mux.Vars(r)["id"])
+	if b == nil {
+		return
+	}
+	if _, err := s.DB.DeleteBeneficiary(ctx, b.ID); err != nil {
+		httpError(w, r, "failed to delete beneficiary", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "beneficiary_delete_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	s.logEvent(ctx, "info", "beneficiary_deleted",
+		fmt.Sprintf("beneficiary %s deleted by %s", b.ID, adminName(ctx)), r.RemoteAddr)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,199 @@
+package api
+
+// bootstrap.go serves everything the frontend loads after login in one
+// call: the session user's profile, their wallets with balances, their
+// recent transactions, what is waiting on them (held transfers,
+// pledges, invitations), their zakat status and the chain tip.
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/db"
+	"wallet_backend_go/internal/models"
+)
+
+// bootstrapRecentTxs is how many recent transactions are returned.
+const bootstrapRecentTxs = 20
+
+// bootstrapWallet is a wallet profile without its private key.
+type bootstrapWallet struct {
+	WalletAddress string      `json:"wallet_address"`
+	PublicKeyHex  string      `json:"public_key_hex"`
+	AutoZakat     bool        `json:"auto_zakat"`
+	Status        string      `json:"status"`
+	CreatedAt     time.Time   `json:"created_at"`
+	Balance       int         `json:"balance"`
+	BalanceFiat   *fiatAmount `json:"balance_fiat,omitempty"`
+}
+
+// bootstrapNotification is something pending for the user.
+type bootstrapNotification struct {
+	Type   string    `json:"type"` // held_transfer, pledge_due, invitation_pending
+	ID     string    `json:"id"`
+	Amount int       `json:"amount"`
+	At     time.Time `json:"at"` // when it resolves: release, due or expiry
+}
+
+type bootstrapChainTip struct {
+	Height    int    `json:"height"`
+	Hash      string `json:"hash"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type bootstrapZakat struct {
+	TotalPaid  int              `json:"total_paid"`
+	LastPaidAt *time.Time       `json:"last_paid_at"`
+	Projection *zakatProjection `json:"projection"` // null without wallets
+}
+
+type bootstrapResponse struct {
+	User          *models.User            `json:"user"`
+	Wallets       []bootstrapWallet       `json:"wallets"`
+	RecentTxs     []db.TransactionRecord  `json:"recent_transactions"`
+	Notifications []bootstrapNotification `json:"notifications"`
+	Zakat         bootstrapZakat          `json:"zakat"`
+	ChainTip      bootstrapChainTip       `json:"chain_tip"`
+}
+
+// Bootstrap returns the session user's start-up data.
+func (s *Server) Bootstrap(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := sessionFrom(ctx).Subject
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	user, err := s.DB.GetUser(ctx, userID)
+	if err != nil {
+		httpError(w, r, "failed to load user", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "user_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if user == nil {
+		httpError(w, r, "user not found", http.StatusNotFound)
+		return
+	}
+	profiles, err := s.DB.ListWalletProfilesByUser(ctx, userID)
+	if err != nil {
+		httpError(w, r, "failed to list wallet profiles", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "bootstrap_list_wallets_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	resp := bootstrapResponse{
+		User:          user,
+		Wallets:       []bootstrapWallet{},
+		RecentTxs:     []db.TransactionRecord{},
+		Notifications: []bootstrapNotification{},
+	}
+
+	seen := make(map[string]bool)
+	for _, wp := range profiles {
+		bw := bootstrapWallet{
+			WalletAddress: wp.WalletAddress,
+			PublicKeyHex:  wp.PublicKeyHex,
+			AutoZakat:     wp.AutoZakat,
+			Status:        wp.Status,
+			CreatedAt:     wp.CreatedAt,
+		}
+		if balance, _, err := s.balanceForAddress(wp.WalletAddress); err == nil {
+			bw.Balance = balance
+			bw.BalanceFiat = s.fiatFor(r, balance)
+		}
+		resp.Wallets = append(resp.Wallets, bw)
+		if wp.Status == models.WalletStatusDeactivated {
+			continue
+		}
+
+		// only the newest of each wallet can make the cut
+		txs, err := s.DB.QueryTransactionsByWallet(ctx, wp.WalletAddress, blockchain.ListQuery{Limit: bootstrapRecentTxs, Desc: true})
+		if err != nil {
+			httpError(w, r, "failed to list transactions", http.StatusInternalServerError)
+			s.logEvent(ctx, "error", "bootstrap_list_txs_failed", err.Error(), r.RemoteAddr)
+			return
+		}
+		for _, t := range txs {
+			// a transfer between two of the user's wallets is listed once
+			if !seen[t.TxID] {
+				seen[t.TxID] = true
+				resp.RecentTxs = append(resp.RecentTxs, t)
+			}
+		}
+	}
+	sort.SliceStable(resp.RecentTxs, func(i, j int) bool { return resp.RecentTxs[i].Timestamp > resp.RecentTxs[j].Timestamp })
+	if len(resp.RecentTxs) > bootstrapRecentTxs {
+		resp.RecentTxs = resp.RecentTxs[:bootstrapRecentTxs]
+	}
+
+	held, err := s.DB.ListHeldTransfers(ctx, models.HeldTransferHeld)
+	if err != nil {
+		httpError(w, r, "failed to load held transfers", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "bootstrap_list_held_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	for _, ht := range held {
+		if ht.UserID == userID {
+			resp.Notifications = append(resp.Notifications, bootstrapNotification{Type: "held_transfer", ID: ht.ID, Amount: ht.Amount, At: ht.ReleaseAt})
+		}
+	}
+	pledges, err := s.DB.ListPledgesByUser(ctx, userID)
+	if err != nil {
+		httpError(w, r, "failed to load pledges", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "bootstrap_list_pledges_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	for _, p := range pledges {
+		if p.Status == models.PledgePending {
+			resp.Notifications = append(resp.Notifications, bootstrapNotification{Type: "pledge_due", ID: p.ID, Amount: p.Amount, At: p.DueDate})
+		}
+	}
+	invitations, err := s.DB.ListInvitationsBySender(ctx, userID)
+	if err != nil {
+		httpError(w, r, "failed to load invitations", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "bootstrap_list_invitations_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	for _, inv := range invitations {
+		if inv.Status == models.InvitationPending {
+			resp.Notifications = append(resp.Notifications, bootstrapNotification{Type: "invitation_pending", ID: inv.ID, Amount: inv.Amount, At: inv.ExpiresAt})
+		}
+	}
+	sort.SliceStable(resp.Notifications, func(i, j int) bool { return resp.Notifications[i].At.Before(resp.Notifications[j].At) })
+
+	records, err := s.DB.ListZakatByUser(ctx, userID)
+	if err != nil {
+		httpError(w, r, "failed to list zakat records", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "bootstrap_list_zakat_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	for _, zr := range records {
+		resp.Zakat.TotalPaid += zr.Amount
+	}
+	if len(records) > 0 {
+		// records are newest first
+		resp.Zakat.LastPaidAt = &records[0].CreatedAt
+	}
+	if len(profiles) > 0 {
+		projection, err := s.projectZakat(ctx, profiles, records)
+		if err != nil {
+			httpError(w, r, "failed to load zakat policy", http.StatusInternalServerError)
+			s.logEvent(ctx, "error", "zakat_policy_get_failed", err.Error(), r.RemoteAddr)
+			return
+		}
+		resp.Zakat.Projection = &projection
+	}
+
+	s.chainMu.Lock()
+	tip := s.BC.Blocks[len(s.BC.Blocks)-1]
+	resp.ChainTip = bootstrapChainTip{Height: len(s.BC.Blocks) - 1, Hash: hex.EncodeToString(tip.Hash), Timestamp: tip.Timestamp}
+	s.chainMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
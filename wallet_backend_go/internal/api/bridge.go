@@ -0,0 +1,306 @@
+package api
+
+// bridge.go credits campaigns for donations made in BTC and ETH (see
+// package bridge). Every BRIDGE_INTERVAL seconds the leader lists the
+// deposits to the addresses in BRIDGE_ADDRESSES and records each new
+// one as pending. Once a deposit has BRIDGE_BTC_CONFIRMATIONS or
+// BRIDGE_ETH_CONFIRMATIONS confirmations it is priced at the current
+// BTC or ETH rate and the equivalent units are minted to the
+// campaign's wallet in a bridge coinbase, whose data carries the
+// deposit's ref ("btc:<txid>:<index>"). A deposit is marked crediting
+// before its coinbase is mined, so one whose outcome was not recorded
+// is settled from the chain rather than credited twice.
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/bridge"
+	"wallet_backend_go/internal/models"
+)
+
+const (
+	defaultBridgeInterval         = 60 // seconds
+	defaultBTCConfirmations       = 3
+	defaultETHConfirmations       = 12
+	defaultBridgeDepositListLimit = 100
+)
+
+type bridgeDepositsResponse struct {
+	Deposits []models.BridgeDeposit `json:"deposits"`
+}
+
+// bridgeConfirmations is the number of confirmations after which a
+// deposit on chain is credited.
+func bridgeConfirmations(chain string) int {
+	if chain == bridge.ChainETH {
+		return envLimit("BRIDGE_ETH_CONFIRMATIONS", defaultETHConfirmations)
+	}
+	return envLimit("BRIDGE_BTC_CONFIRMATIONS", defaultBTCConfirmations)
+}
+
+// runBridge credits the deposits to the watched addresses every
+// BRIDGE_INTERVAL seconds.
+func (s *Server) runBridge() {
+	for {
+		s.runScheduled("bridge", s.bridgeTick)
+		time.Sleep(time.Duration(envLimit("BRIDGE_INTERVAL", defaultBridgeInterval)) * time.Second)
+	}
+}
+
+// lazyRates loads the price rates once per tick, on first use.
+type lazyRates struct {
+	rates  map[string]float64
+	err    error
+	loaded bool
+}
+
+func (s *Server) bridgeTick() {
+	if s.DB == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	var rates lazyRates
+	for _, w := range s.bridge.Watches {
+		watcher := s.bridge.Watchers[w.Chain]
+		deposits, err := watcher.Deposits(ctx, w.Address)
+		if err != nil {
+			log.Printf("bridge: %s address %s: %v", w.Chain, w.Address, err)
+			continue
+		}
+		if len(deposits) == 0 {
+			continue
+		}
+		cp, err := s.DB.GetCampaign(ctx, w.CampaignID)
+		if err != nil {
+			log.Printf("bridge: failed to load campaign %s: %v", w.CampaignID, err)
+			continue
+		}
+		if cp == nil {
+			s.logEvent(ctx, "warn", "bridge_campaign_missing",
+				fmt.Sprintf("%s address %s: campaign %s not found", w.Chain, w.Address, w.CampaignID), "scheduler")
+			continue
+		}
+		// oldest first
+		for i := len(deposits) - 1; i >= 0; i-- {
+			s.creditBridgeDeposit(ctx, cp, deposits[i], &rates)
+		}
+	}
+}
+
+// creditBridgeDeposit records d and, once it is confirmed, credits it
+// to the campaign. Failures are logged and retried on the next tick.
+func (s *Server) creditBridgeDeposit(ctx context.Context, cp *models.Campaign, d bridge.Deposit, rates *lazyRates) {
+	ref := d.Ref()
+	row, err := s.DB.GetBridgeDeposit(ctx, ref)
+	if err != nil {
+		log.Printf("bridge: failed to load deposit %s: %v", ref, err)
+		return
+	}
+	if row == nil {
+		row = &models.BridgeDeposit{
+			ID:              ref,
+			TenantID:        cp.TenantID,
+			Chain:           d.Chain,
+			ExternalTxID:    d.TxID,
+			ExternalIndex:   d.Index,
+			ExternalAddress: d.Address,
+			ExternalAmount:  d.Amount.String(),
+			Confirmations:   d.Confirmations,
+			CampaignID:      cp.ID,
+			WalletAddress:   cp.WalletAddress,
+			Status:          models.BridgeDepositPending,
+			DetectedAt:      s.Clock.Now().UTC(),
+		}
+		if err := s.DB.CreateBridgeDeposit(ctx, row); err != nil {
+			s.logEvent(ctx, "error", "bridge_deposit_save_failed", fmt.Sprintf("deposit %s: %v", ref, err), "scheduler")
+			return
+		}
+		s.logEvent(ctx, "info", "bridge_deposit_detected",
+			fmt.Sprintf("deposit %s of %s %s to %s for campaign %s, %d confirmations",
+				ref, bridge.Coins(d.Chain, d.Amount).FloatString(bridge.Decimals[d.Chain]), bridge.Currencies[d.Chain],
+				d.Address, cp.ID, d.Confirmations), "scheduler")
+	}
+	switch row.Status {
+	case models.BridgeDepositCredited, models.BridgeDepositIgnored:
+		return
+	case models.BridgeDepositCrediting:
+		if s.settleBridgeCredit(ctx, row) {
+			return
+		}
+	}
+
+	if d.Confirmations < bridgeConfirmations(d.Chain) {
+		if row.Confirmations != d.Confirmations {
+			row.Confirmations = d.Confirmations
+			if err := s.DB.UpdateBridgeDeposit(ctx, row); err != nil {
+				log.Printf("bridge: failed to update deposit %s: %v", ref, err)
+			}
+		}
+		return
+	}
+	row.Confirmations = d.Confirmations
+
+	if !rates.loaded {
+		quote, err := s.currentPrices(ctx)
+		rates.rates, rates.err, rates.loaded = quote.Rates, err, true
+	}
+	currency := bridge.Currencies[d.Chain]
+	rate := rates.rates[currency]
+	if rates.err != nil || rate <= 0 {
+		row.Error = fmt.Sprintf("no %s rate", currency)
+		if rates.err != nil {
+			row.Error += ": " + rates.err.Error()
+		}
+		if err := s.DB.UpdateBridgeDeposit(ctx, row); err != nil {
+			log.Printf("bridge: failed to update deposit %s: %v", ref, err)
+		}
+		return
+	}
+	value := new(big.Rat).Quo(bridge.Coins(d.Chain, d.Amount), new(big.Rat).SetFloat64(rate))
+	units := new(big.Int).Quo(value.Num(), value.Denom())
+
+	row.Rate = rate
+	row.Error = ""
+	if units.Sign() <= 0 {
+		row.Status = models.BridgeDepositIgnored
+		if err := s.DB.UpdateBridgeDeposit(ctx, row); err != nil {
+			log.Printf("bridge: failed to update deposit %s: %v", ref, err)
+			return
+		}
+		s.logEvent(ctx, "warn", "bridge_deposit_ignored",
+			fmt.Sprintf("deposit %s is worth less than one unit at %g %s", ref, rate, currency), "scheduler")
+		return
+	}
+	if !units.IsInt64() || units.Int64() > math.MaxInt32 {
+		row.Error = fmt.Sprintf("worth %s units, more than can be credited", units)
+		if err := s.DB.UpdateBridgeDeposit(ctx, row); err != nil {
+			log.Printf("bridge: failed to update deposit %s: %v", ref, err)
+		}
+		return
+	}
+	row.Units = int(units.Int64())
+	row.WalletAddress = cp.WalletAddress
+
+	// recorded before mining, so a credit whose outcome is lost is found
+	// on the chain instead of minted again
+	row.Status = models.BridgeDepositCrediting
+	if err := s.DB.UpdateBridgeDeposit(ctx, row); err != nil {
+		log.Printf("bridge: failed to update deposit %s: %v", ref, err)
+		return
+	}
+
+	tx := blockchain.NewBridgeTx(row.WalletAddress, row.Units, ref)
+	s.chainMu.Lock()
+	newBlock, err := s.BC.AddBlockContext(ctx, []*blockchain.Transaction{tx})
+	if err != nil {
+		s.chainMu.Unlock()
+		row.Status = models.BridgeDepositPending
+		row.Error = err.Error()
+		if err := s.DB.UpdateBridgeDeposit(ctx, row); err != nil {
+			log.Printf("bridge: failed to update deposit %s: %v", ref, err)
+		}
+		s.logEvent(ctx, "error", "bridge_deposit_credit_failed", fmt.Sprintf("deposit %s: %v", ref, err), "scheduler")
+		return
+	}
+	height := len(s.BC.Blocks) - 1
+	s.reports.invalidateBlock(newBlock)
+	_ = s.UTXO.Reindex()
+	s.persistMinedBlock(newBlock, height, []*blockchain.Transaction{tx}, "bridge")
+	s.chainMu.Unlock()
+
+	s.markBridgeCredited(ctx, row, hex.EncodeToString(tx.ID), hex.EncodeToString(newBlock.Hash))
+	s.logEvent(ctx, "info", "bridge_deposit_credited",
+		fmt.Sprintf("deposit %s credited %d to %s (campaign %s) at %g %s in tx %s",
+			ref, row.Units, row.WalletAddress, row.CampaignID, rate, currency, row.TxID), "scheduler")
+	s.notifyIncomingFunds(row.WalletAddress, row.Units)
+}
+
+// settleBridgeCredit settles a deposit left crediting: it is marked
+// credited if its coinbase is on the chain, and reports true, or else
+// goes back to pending.
+func (s *Server) settleBridgeCredit(ctx context.Context, row *models.BridgeDeposit) bool {
+	s.chainMu.Lock()
+	var txid, blockHash string
+	for i := len(s.BC.Blocks) - 1; i >= 0 && txid == ""; i-- {
+		for _, tx := range s.BC.Blocks[i].Transactions {
+			if ref, ok := tx.BridgeRef(); ok && ref == row.ID {
+				txid, blockHash = hex.EncodeToString(tx.ID), hex.EncodeToString(s.BC.Blocks[i].Hash)
+				break
+			}
+		}
+	}
+	s.chainMu.Unlock()
+
+	if txid == "" {
+		row.Status = models.BridgeDepositPending
+		return false
+	}
+	s.markBridgeCredited(ctx, row, txid, blockHash)
+	return true
+}
+
+func (s *Server) markBridgeCredited(ctx context.Context, row *models.BridgeDeposit, txid, blockHash string) {
+	now := s.Clock.Now().UTC()
+	row.Status = models.BridgeDepositCredited
+	row.TxID, row.BlockHash = txid, blockHash
+	row.CreditedAt = &now
+	if err := s.DB.UpdateBridgeDeposit(ctx, row); err != nil {
+		// settled from the chain on the next tick
+		s.logEvent(ctx, "error", "bridge_deposit_save_failed", fmt.Sprintf("deposit %s: %v", row.ID, err), "scheduler")
+	}
+}
+
+// ListBridgeDeposits returns the deposits made on other chains to the
+// watched addresses, newest first, optionally only those of
+// ?campaign_id= or with ?status=, at most ?limit= (default 100).
+func (s *Server) ListBridgeDeposits(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	q := r.URL.Query()
+	status := q.Get("status")
+	switch status {
+	case "", models.BridgeDepositPending, models.BridgeDepositCrediting, models.BridgeDepositCredited, models.BridgeDepositIgnored:
+	default:
+		httpError(w, r, "invalid status", http.StatusBadRequest)
+		return
+	}
+	limit := defaultBridgeDepositListLimit
+	if l := q.Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 {
+			httpError(w, r, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	list, err := s.DB.ListBridgeDeposits(ctx, tenantID(ctx), q.Get("campaign_id"), status, limit)
+	if err != nil {
+		httpError(w, r, "failed to load bridge deposits", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "bridge_deposit_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if list == nil {
+		list = []models.BridgeDeposit{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(bridgeDepositsResponse{Deposits: list})
+}
@@ -0,0 +1,492 @@
+package api
+
+// campaigns.go serves the public donation portal: unauthenticated,
+// cacheable listings of the active campaigns and the verified
+// organizations (tenants), with search and category filters. Admins
+// create and edit campaigns and verify organizations. A campaign's
+// progress is what its wallet address has received on the chain.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+)
+
+// publicMaxAge is how long clients and CDNs may cache portal responses.
+const publicMaxAge = 60 // seconds
+
+type createCampaignRequest struct {
+	Name          string     `json:"name"`
+	Description   string     `json:"description"`
+	Category      string     `json:"category"`
+	GoalAmount    int        `json:"goal_amount"`
+	WalletAddress string     `json:"wallet_address"`
+	EndsAt        *time.Time `json:"ends_at"`
+}
+
+// updateCampaignRequest changes the fields that are set.
+type updateCampaignRequest struct {
+	Name        *string    `json:"name"`
+	Description *string    `json:"description"`
+	Category    *string    `json:"category"`
+	GoalAmount  *int       `json:"goal_amount"`
+	Active      *bool      `json:"active"`
+	EndsAt      *time.Time `json:"ends_at"`
+}
+
+type tenantProfileRequest struct {
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	Verified    bool   `json:"verified"`
+}
+
+type publicOrganizationRef struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Verified bool   `json:"verified"`
+}
+
+type publicCampaign struct {
+	ID              string                 `json:"id"`
+	Name            string                 `json:"name"`
+	Description     string                 `json:"description"`
+	Category        string                 `json:"category"`
+	GoalAmount      int                    `json:"goal_amount"`
+	Raised          int                    `json:"raised"`
+	Pledged         int                    `json:"pledged"` // outstanding pledges, not yet received
+	ProgressPercent int                    `json:"progress_percent"`
+	WalletAddress   string                 `json:"wallet_address"`
+	EndsAt          *time.Time             `json:"ends_at"`
+	Organization    *publicOrganizationRef `json:"organization,omitempty"`
+	// DonationAddresses take donations in BTC and ETH, credited to the
+	// wallet once confirmed (see bridge.go).
+	DonationAddresses []donationAddress `json:"donation_addresses,omitempty"`
+}
+
+type donationAddress struct {
+	Chain   string `json:"chain"`
+	Address string `json:"address"`
+}
+
+type publicCampaignsResponse struct {
+	Campaigns  []publicCampaign `json:"campaigns"`
+	Total      int              `json:"total"`
+	Offset     int              `json:"offset"`
+	Limit      int              `json:"limit"`
+	NextOffset *int             `json:"next_offset"`
+}
+
+type publicOrganization struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	Category        string `json:"category"`
+	WalletAddress   string `json:"wallet_address"`
+	ActiveCampaigns int    `json:"active_campaigns"`
+}
+
+type publicOrganizationsResponse struct {
+	Organizations []publicOrganization `json:"organizations"`
+}
+
+// normalizeCategory trims and lowercases a category.
+func normalizeCategory(c string) string {
+	return strings.ToLower(strings.TrimSpace(c))
+}
+
+// matchesSearch reports whether q (already lowercased) occurs in any of
+// fields, ignoring case. An empty q matches everything.
+func matchesSearch(q string, fields ...string) bool {
+	if q == "" {
+		return true
+	}
+	for _, f := range fields {
+		if strings.Contains(strings.ToLower(f), q) {
+			return true
+		}
+	}
+	return false
+}
+
+// campaignOpen reports whether a campaign is listed on the portal.
+func campaignOpen(cp *models.Campaign, now time.Time) bool {
+	return cp.Active && (cp.EndsAt == nil || now.Before(*cp.EndsAt))
+}
+
+// writePublicJSON writes v with cache headers for the portal. The ETag
+// is a hash of the body, so unchanged listings revalidate with 304.
+func writePublicJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		httpError(w, r, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", publicMaxAge))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(append(body, '\n'))
+}
+
+// newPublicCampaign returns the portal view of cp with its progress.
+// pledged holds the outstanding pledges by campaign id. The address
+// index must be synced.
+func (s *Server) newPublicCampaign(cp *models.Campaign, orgs map[string]models.Tenant, pledged map[string]int) publicCampaign {
+	summary, _ := s.addrs.Address(cp.WalletAddress, 0, 0)
+	pc := publicCampaign{
+		ID:            cp.ID,
+		Name:          cp.Name,
+		Description:   cp.Description,
+		Category:      cp.Category,
+		GoalAmount:    cp.GoalAmount,
+		Raised:        summary.TotalReceived,
+		Pledged:       pledged[cp.ID],
+		WalletAddress: cp.WalletAddress,
+		EndsAt:        cp.EndsAt,
+	}
+	if cp.GoalAmount > 0 {
+		pc.ProgressPercent = pc.Raised * 100 / cp.GoalAmount
+	}
+	if t, ok := orgs[cp.TenantID]; ok {
+		pc.Organization = &publicOrganizationRef{ID: t.ID, Name: t.Name, Verified: t.Verified}
+	}
+	if s.bridge != nil {
+		for _, w := range s.bridge.WatchesOf(cp.ID) {
+			pc.DonationAddresses = append(pc.DonationAddresses, donationAddress{Chain: w.Chain, Address: w.Address})
+		}
+	}
+	return pc
+}
+
+// tenantsByID loads every tenant keyed by id.
+func (s *Server) tenantsByID(r *http.Request) (map[string]models.Tenant, error) {
+	tenants, err := s.DB.ListTenants(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Tenant, len(tenants))
+	for _, t := range tenants {
+		byID[t.ID] = t
+	}
+	return byID, nil
+}
+
+// ListPublicCampaigns lists the active campaigns, newest first,
+// filtered by ?q= (name or description), ?category= and
+// ?organization_id=, a page at a time.
+func (s *Server) ListPublicCampaigns(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	offset, limit, ok := pageParams(r)
+	if !ok {
+		httpError(w, r, "invalid offset or limit", http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	q := strings.ToLower(strings.TrimSpace(query.Get("q")))
+	category := normalizeCategory(query.Get("category"))
+
+	campaigns, err := s.DB.ListCampaigns(ctx, query.Get("organization_id"), true)
+	if err != nil {
+		httpError(w, r, "failed to load campaigns", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "campaign_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	orgs, err := s.tenantsByID(r)
+	if err != nil {
+		httpError(w, r, "failed to load campaigns", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "campaign_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	pledged, err := s.pledgedByCampaign(ctx)
+	if err != nil {
+		httpError(w, r, "failed to load campaigns", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "campaign_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	var matched []*models.Campaign
+	now := s.Clock.Now()
+	for i := range campaigns {
+		cp := &campaigns[i]
+		if !campaignOpen(cp, now) || (category != "" && cp.Category != category) || !matchesSearch(q, cp.Name, cp.Description) {
+			continue
+		}
+		matched = append(matched, cp)
+	}
+
+	s.syncAddressIndex()
+	resp := publicCampaignsResponse{Campaigns: []publicCampaign{}, Total: len(matched), Offset: offset, Limit: limit}
+	for i := offset; i < len(matched) && len(resp.Campaigns) < limit; i++ {
+		resp.Campaigns = append(resp.Campaigns, s.newPublicCampaign(matched[i], orgs, pledged))
+	}
+	if next := offset + len(resp.Campaigns); next < len(matched) {
+		resp.NextOffset = &next
+	}
+	writePublicJSON(w, r, resp)
+}
+
+// GetPublicCampaign returns one active campaign.
+func (s *Server) GetPublicCampaign(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	cp, err := s.DB.GetCampaign(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, "failed to load campaigns", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "campaign_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if cp == nil || !campaignOpen(cp, s.Clock.Now()) {
+		httpError(w, r, "campaign not found", http.StatusNotFound)
+		return
+	}
+	orgs, err := s.tenantsByID(r)
+	if err != nil {
+		httpError(w, r, "failed to load campaigns", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "campaign_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	pledged, err := s.pledgedByCampaign(ctx)
+	if err != nil {
+		httpError(w, r, "failed to load campaigns", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "campaign_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	s.syncAddressIndex()
+	writePublicJSON(w, r, s.newPublicCampaign(cp, orgs, pledged))
+}
+
+// ListPublicOrganizations lists the verified organizations, filtered by
+// ?q= (name or description) and ?category=.
+func (s *Server) ListPublicOrganizations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	query := r.URL.Query()
+	q := strings.ToLower(strings.TrimSpace(query.Get("q")))
+	category := normalizeCategory(query.Get("category"))
+
+	tenants, err := s.DB.ListTenants(ctx)
+	if err != nil {
+		httpError(w, r, "failed to list tenants", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "tenant_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	campaigns, err := s.DB.ListCampaigns(ctx, "", true)
+	if err != nil {
+		httpError(w, r, "failed to load campaigns", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "campaign_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	open := make(map[string]int)
+	now := s.Clock.Now()
+	for i := range campaigns {
+		if campaignOpen(&campaigns[i], now) {
+			open[campaigns[i].TenantID]++
+		}
+	}
+
+	resp := publicOrganizationsResponse{Organizations: []publicOrganization{}}
+	for _, t := range tenants {
+		if !t.Verified || (category != "" && t.Category != category) || !matchesSearch(q, t.Name, t.Description) {
+			continue
+		}
+		resp.Organizations = append(resp.Organizations, publicOrganization{
+			ID:              t.ID,
+			Name:            t.Name,
+			Description:     t.Description,
+			Category:        t.Category,
+			WalletAddress:   t.ZakatWalletAddress,
+			ActiveCampaigns: open[t.ID],
+		})
+	}
+	writePublicJSON(w, r, resp)
+}
+
+// CreateCampaign adds an active campaign for the tenant of the request.
+func (s *Server) CreateCampaign(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	var req createCampaignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		httpError(w, r, "name is required", http.StatusBadRequest)
+		return
+	}
+	if req.GoalAmount <= 0 {
+		httpError(w, r, "goal_amount must be positive", http.StatusBadRequest)
+		return
+	}
+	if !blockchain.ValidateAddress(req.WalletAddress) {
+		httpError(w, r, "invalid address", http.StatusBadRequest)
+		return
+	}
+
+	cp := &models.Campaign{
+		ID:            uuid.NewString(),
+		TenantID:      tenantID(ctx),
+		Name:          req.Name,
+		Description:   strings.TrimSpace(req.Description),
+		Category:      normalizeCategory(req.Category),
+		GoalAmount:    req.GoalAmount,
+		WalletAddress: req.WalletAddress,
+		Active:        true,
+		EndsAt:        req.EndsAt,
+		CreatedAt:     s.Clock.Now().UTC(),
+	}
+	if err := s.DB.CreateCampaign(ctx, cp); err != nil {
+		httpError(w, r, "failed to create campaign", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "campaign_create_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	s.logEvent(ctx, "info", "campaign_created",
+		fmt.Sprintf("campaign %s (%s) created by %s", cp.ID, cp.Name, adminName(ctx)), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(cp)
+}
+
+// UpdateCampaign edits a campaign; closing it takes it off the portal.
+func (s *Server) UpdateCampaign(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	var req updateCampaignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	cp, err := s.DB.GetCampaign(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, "failed to load campaigns", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "campaign_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if cp == nil || (tenantID(ctx) != "" && cp.TenantID != tenantID(ctx)) {
+		httpError(w, r, "campaign not found", http.StatusNotFound)
+		return
+	}
+
+	if req.Name != nil {
+		cp.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		cp.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Category != nil {
+		cp.Category = normalizeCategory(*req.Category)
+	}
+	if req.GoalAmount != nil {
+		cp.GoalAmount = *req.GoalAmount
+	}
+	if req.Active != nil {
+		cp.Active = *req.Active
+	}
+	if req.EndsAt != nil {
+		cp.EndsAt = req.EndsAt
+	}
+	if cp.Name == "" {
+		httpError(w, r, "name is required", http.StatusBadRequest)
+		return
+	}
+	if cp.GoalAmount <= 0 {
+		httpError(w, r, "goal_amount must be positive", http.StatusBadRequest)
+		return
+	}
+
+	found, err := s.DB.UpdateCampaign(ctx, cp)
+	if err != nil {
+		httpError(w, r, "failed to update campaign", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "campaign_update_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if !found {
+		httpError(w, r, "campaign not found", http.StatusNotFound)
+		return
+	}
+	s.logEvent(ctx, "info", "campaign_updated",
+		fmt.Sprintf("campaign %s updated by %s (active %t)", cp.ID, adminName(ctx), cp.Active), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(cp)
+}
+
+// SetTenantProfile sets an organization's public profile and whether it
+// is verified, which lists it on the portal.
+func (s *Server) SetTenantProfile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	var req tenantProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Description = strings.TrimSpace(req.Description)
+	req.Category = normalizeCategory(req.Category)
+
+	found, err := s.DB.UpdateTenantProfile(ctx, id, req.Description, req.Category, req.Verified)
+	if err != nil {
+		httpError(w, r, "failed to update tenant", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "tenant_profile_update_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if !found {
+		httpError(w, r, "tenant not found", http.StatusNotFound)
+		return
+	}
+	s.logEvent(ctx, "info", "tenant_profile_updated",
+		fmt.Sprintf("tenant %s profile updated by %s (verified %t)", id, adminName(ctx), req.Verified), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"tenant_id":   id,
+		"description": req.Description,
+		"category":    req.Category,
+		"verified":    req.Verified,
+	})
+}
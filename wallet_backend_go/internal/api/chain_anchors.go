@@ -0,0 +1,337 @@
+package api
+
+// chain_anchors.go anchors the chain in a public network (see package
+// notary). Every ANCHOR_INTERVAL minutes the leader stamps the hash of
+// the tip block with the configured client, unless the tip is anchored
+// already, and asks the service to complete the proofs of earlier
+// anchors still pending. GET /anchors/{id}/verify checks an anchor
+// both ways: that the anchored block is still on the chain at its
+// height, and that the proof commits its hash to the public network.
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/notary"
+)
+
+const (
+	defaultAnchorInterval = 60 // minutes
+	defaultAnchorLimit    = 100
+	// anchorUpgradeBatch bounds the pending anchors upgraded per tick.
+	anchorUpgradeBatch = 50
+)
+
+// anchorNotOnChain is the verification status of an anchor whose block
+// is no longer on the chain at its height.
+const anchorNotOnChain = "not_on_chain"
+
+type chainAnchorsResponse struct {
+	Anchors []models.ChainAnchor `json:"anchors"`
+}
+
+type chainAnchorVerification struct {
+	AnchorID  string        `json:"anchor_id"`
+	Height    int           `json:"height"`
+	BlockHash string        `json:"block_hash"`
+	Status    string        `json:"status"` // not_on_chain or the status of the proof
+	OnChain   bool          `json:"on_chain"`
+	Proof     notary.Result `json:"proof"`
+}
+
+// runChainAnchors anchors the tip and upgrades the pending anchors
+// every ANCHOR_INTERVAL minutes.
+func (s *Server) runChainAnchors() {
+	for {
+		s.runScheduled("chain-anchors", s.anchorTick)
+		time.Sleep(time.Duration(envLimit("ANCHOR_INTERVAL", defaultAnchorInterval)) * time.Minute)
+	}
+}
+
+func (s *Server) anchorTick() {
+	if s.DB == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	_, _, _ = s.anchorChainTip(ctx, "scheduler")
+	s.upgradeChainAnchors(ctx)
+}
+
+// anchorChainTip stamps the hash of the tip block and stores the
+// anchor. When the latest anchor is of the tip already it returns that
+// one and false. Failures are logged.
+func (s *Server) anchorChainTip(ctx context.Context, ip string) (*models.ChainAnchor, bool, error) {
+	s.chainMu.Lock()
+	height := len(s.BC.Blocks) - 1
+	hash := append([]byte(nil), s.BC.Blocks[height].Hash...)
+	s.chainMu.Unlock()
+	hashHex := hex.EncodeToString(hash)
+
+	latest, err := s.DB.ListChainAnchors(ctx, "", 1)
+	if err != nil {
+		s.logEvent(ctx, "error", "chain_anchor_failed", err.Error(), ip)
+		return nil, false, err
+	}
+	if len(latest) > 0 && latest[0].BlockHash == hashHex {
+		return &latest[0], false, nil
+	}
+
+	proof, err := s.notary.Stamp(ctx, hash)
+	if err != nil {
+		s.logEvent(ctx, "error", "chain_anchor_failed",
+			fmt.Sprintf("block %d (%s) with %s: %v", height, hashHex, s.notary.Name(), err), ip)
+		return nil, false, err
+	}
+	now := s.Clock.Now().UTC()
+	a := &models.ChainAnchor{
+		ID:        uuid.NewString(),
+		Height:    height,
+		BlockHash: hashHex,
+		Client:    s.notary.Name(),
+		Proof:     hex.EncodeToString(proof),
+		Status:    notary.StatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	// a service may confirm right away; a check that fails stays pending
+	if res, err := s.notary.Verify(ctx, hash, proof); err == nil {
+		a.Status, a.Attestation = res.Status, res.Summary()
+	}
+	if err := s.DB.CreateChainAnchor(ctx, a); err != nil {
+		s.logEvent(ctx, "error", "chain_anchor_save_failed",
+			fmt.Sprintf("anchor of block %d (%s): %v", height, hashHex, err), ip)
+		return nil, false, err
+	}
+	s.logEvent(ctx, "info", "chain_anchored",
+		fmt.Sprintf("anchor %s: block %d (%s) stamped with %s, %s", a.ID, height, hashHex, a.Client, a.Status), ip)
+	return a, true, nil
+}
+
+// upgradeChainAnchors completes the proofs of pending anchors with
+// what their service has committed since.
+func (s *Server) upgradeChainAnchors(ctx context.Context) {
+	pending, err := s.DB.ListChainAnchors(ctx, notary.StatusPending, anchorUpgradeBatch)
+	if err != nil {
+		log.Printf("failed to load pending chain anchors: %v", err)
+		return
+	}
+	for i := range pending {
+		a := &pending[i]
+		if a.Client != s.notary.Name() {
+			continue
+		}
+		digest, err1 := hex.DecodeString(a.BlockHash)
+		proof, err2 := hex.DecodeString(a.Proof)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		// Upgrade returns what it could complete even when a service failed
+		upgraded, err := s.notary.Upgrade(ctx, digest, proof)
+		if err != nil {
+			log.Printf("chain anchor %s: upgrade: %v", a.ID, err)
+		}
+		res, err := s.notary.Verify(ctx, digest, upgraded)
+		if err != nil {
+			log.Printf("chain anchor %s: verify: %v", a.ID, err)
+			continue
+		}
+		if bytes.Equal(upgraded, proof) && res.Status == a.Status {
+			continue
+		}
+		a.Proof = hex.EncodeToString(upgraded)
+		a.Status, a.Attestation = res.Status, res.Summary()
+		a.UpdatedAt = s.Clock.Now().UTC()
+		if err := s.DB.UpdateChainAnchor(ctx, a); err != nil {
+			s.logEvent(ctx, "error", "chain_anchor_save_failed", fmt.Sprintf("anchor %s: %v", a.ID, err), "scheduler")
+			continue
+		}
+		switch res.Status {
+		case notary.StatusInvalid:
+			s.logEvent(ctx, "warn", "chain_anchor_invalid",
+				fmt.Sprintf("anchor %s of block %d: %s", a.ID, a.Height, res.Reason), "scheduler")
+		case notary.StatusAttested, notary.StatusVerified:
+			s.logEvent(ctx, "info", "chain_anchor_confirmed",
+				fmt.Sprintf("anchor %s of block %d: %s in %s", a.ID, a.Height, res.Status, a.Attestation), "scheduler")
+		}
+	}
+}
+
+// ListChainAnchors returns the anchors of the chain, newest first,
+// optionally only those with ?status=, at most ?limit= (default 100).
+func (s *Server) ListChainAnchors(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", notary.StatusPending, notary.StatusAttested, notary.StatusVerified, notary.StatusInvalid:
+	default:
+		httpError(w, r, "invalid status", http.StatusBadRequest)
+		return
+	}
+	limit := defaultAnchorLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 {
+			httpError(w, r, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	list, err := s.DB.ListChainAnchors(ctx, status, limit)
+	if err != nil {
+		httpError(w, r, "failed to load anchors", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "chain_anchor_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if list == nil {
+		list = []models.ChainAnchor{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(chainAnchorsResponse{Anchors: list})
+}
+
+// loadChainAnchor returns the anchor named in the path. On failure it
+// writes the error response and returns nil.
+func (s *Server) loadChainAnchor(w http.ResponseWriter, r *http.Request) *models.ChainAnchor {
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return nil
+	}
+	a, err := s.DB.GetChainAnchor(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, "failed to load anchors", http.StatusInternalServerError)
+		s.logEvent(r.Context(), "error", "chain_anchor_get_failed", err.Error(), r.RemoteAddr)
+		return nil
+	}
+	if a == nil {
+		httpError(w, r, "anchor not found", http.StatusNotFound)
+		return nil
+	}
+	return a
+}
+
+// GetChainAnchor returns one anchor with its proof.
+func (s *Server) GetChainAnchor(w http.ResponseWriter, r *http.Request) {
+	a := s.loadChainAnchor(w, r)
+	if a == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(a)
+}
+
+// VerifyChainAnchor checks that the anchored block is still on the
+// chain at its height and verifies the proof with the anchoring
+// service.
+func (s *Server) VerifyChainAnchor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.notary == nil {
+		httpError(w, r, "external anchoring is not enabled", http.StatusNotFound)
+		return
+	}
+	a := s.loadChainAnchor(w, r)
+	if a == nil {
+		return
+	}
+	if a.Client != s.notary.Name() {
+		httpError(w, r, "anchor made with another client", http.StatusConflict)
+		return
+	}
+	digest, err1 := hex.DecodeString(a.BlockHash)
+	proof, err2 := hex.DecodeString(a.Proof)
+	if err1 != nil || err2 != nil {
+		httpError(w, r, "failed to verify anchor", http.StatusInternalServerError)
+		return
+	}
+
+	resp := chainAnchorVerification{AnchorID: a.ID, Height: a.Height, BlockHash: a.BlockHash}
+	s.chainMu.Lock()
+	resp.OnChain = a.Height < len(s.BC.Blocks) && bytes.Equal(s.BC.Blocks[a.Height].Hash, digest)
+	s.chainMu.Unlock()
+
+	res, err := s.notary.Verify(ctx, digest, proof)
+	if err != nil {
+		httpError(w, r, "failed to verify anchor", http.StatusBadGateway)
+		s.logEvent(ctx, "error", "chain_anchor_verify_failed", fmt.Sprintf("anchor %s: %v", a.ID, err), r.RemoteAddr)
+		return
+	}
+	resp.Proof = res
+	resp.Status = res.Status
+	if !resp.OnChain {
+		resp.Status = anchorNotOnChain
+		s.logEvent(ctx, "warn", "chain_anchor_verify_mismatch",
+			fmt.Sprintf("anchor %s: block %d is no longer %s", a.ID, a.Height, a.BlockHash), r.RemoteAddr)
+	} else if res.Status == notary.StatusInvalid {
+		s.logEvent(ctx, "warn", "chain_anchor_invalid",
+			fmt.Sprintf("anchor %s of block %d: %s", a.ID, a.Height, res.Reason), r.RemoteAddr)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// GetChainAnchorOTS returns the proof of an OpenTimestamps anchor as an
+// .ots file, for checking with the ots tool independently of this
+// server.
+func (s *Server) GetChainAnchorOTS(w http.ResponseWriter, r *http.Request) {
+	a := s.loadChainAnchor(w, r)
+	if a == nil {
+		return
+	}
+	digest, err1 := hex.DecodeString(a.BlockHash)
+	proof, err2 := hex.DecodeString(a.Proof)
+	if a.Client != notary.ClientOpenTimestamps || err1 != nil || err2 != nil {
+		httpError(w, r, "anchor is not an OpenTimestamps proof", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.opentimestamps.v1")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="block-%d.ots"`, a.Height))
+	_, _ = w.Write(notary.OTSFile(digest, proof))
+}
+
+// AnchorChain anchors the tip now rather than on the next tick.
+func (s *Server) AnchorChain(w http.ResponseWriter, r *http.Request) {
+	if s.notary == nil {
+		httpError(w, r, "external anchoring is not enabled", http.StatusNotFound)
+		return
+	}
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	a, created, err := s.anchorChainTip(r.Context(), r.RemoteAddr)
+	if err != nil {
+		httpError(w, r, "failed to anchor the chain", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	_ = json.NewEncoder(w).Encode(a)
+}
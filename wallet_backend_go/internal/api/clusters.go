@@ -0,0 +1,162 @@
+package api
+
+// clusters.go exposes address clustering (see package cluster) to
+// compliance staff. Clustering reads the whole chain, so it runs as an
+// admin job on the background worker and the endpoints serve the last
+// completed result, which says at which height it was computed. Results
+// live in memory and are lost on restart.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/cluster"
+)
+
+const (
+	clusterJobKind = "address_clustering"
+
+	defaultClusterPageSize = 50
+	maxClusterPageSize     = 500
+)
+
+// clusterState holds the last clustering result.
+type clusterState struct {
+	mu      sync.Mutex
+	result  *cluster.Result
+	builtAt time.Time
+}
+
+func (st *clusterState) set(res *cluster.Result, at time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.result, st.builtAt = res, at
+}
+
+func (st *clusterState) get() (*cluster.Result, time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.result, st.builtAt
+}
+
+type clusterListResponse struct {
+	Height   int               `json:"height"`
+	BuiltAt  time.Time         `json:"built_at"`
+	Total    int               `json:"total"`
+	Clusters []cluster.Cluster `json:"clusters"`
+}
+
+type addressClusterResponse struct {
+	Address string          `json:"address"`
+	Height  int             `json:"height"`
+	BuiltAt time.Time       `json:"built_at"`
+	Cluster cluster.Cluster `json:"cluster"`
+}
+
+// BuildAddressClusters starts (or joins) the clustering job and
+// responds 202 with it.
+func (s *Server) BuildAddressClusters(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.adminJobs.running(clusterJobKind)
+	if !ok {
+		if j, started := s.adminJobs.start(clusterJobKind, []string{"cluster_addresses"}, s.Clock.Now()); started {
+			s.startClustering(j.ID, adminName(r.Context()), r.RemoteAddr)
+			job, _ = s.adminJobs.get(j.ID)
+		} else {
+			// a concurrent request started it first
+			job, _ = s.adminJobs.running(clusterJobKind)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/v1/admin/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+// startClustering queues the clustering of the chain on the worker.
+func (s *Server) startClustering(jobID, admin, ip string) {
+	s.adminJobs.setStep(jobID, 0, jobStatusRunning, "")
+
+	queued := s.enqueue(clusterJobKind, func(ctx context.Context) error {
+		s.chainMu.Lock()
+		blocks := append([]*blockchain.Block(nil), s.BC.Blocks...)
+		s.chainMu.Unlock()
+
+		res := cluster.Build(blocks)
+		s.clusters.set(res, s.Clock.Now().UTC())
+
+		detail := fmt.Sprintf("%d linked clusters at height %d", len(res.Clusters), res.Height)
+		s.adminJobs.setStep(jobID, 0, jobStatusCompleted, detail)
+		s.adminJobs.finish(jobID, nil, s.Clock.Now())
+		s.logEvent(ctx, "info", "address_clustering", detail+" (requested by "+admin+")", ip)
+		return nil
+	})
+	if !queued {
+		err := fmt.Errorf("background queue full")
+		s.adminJobs.setStep(jobID, 0, jobStatusFailed, err.Error())
+		s.adminJobs.finish(jobID, err, s.Clock.Now())
+	}
+}
+
+// ListAddressClusters returns the linked clusters of the last
+// clustering run, largest first, capped by ?limit=.
+func (s *Server) ListAddressClusters(w http.ResponseWriter, r *http.Request) {
+	res, builtAt := s.clusters.get()
+	if res == nil {
+		httpError(w, r, "address clusters not built yet", http.StatusNotFound)
+		return
+	}
+
+	limit := defaultClusterPageSize
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 || n > maxClusterPageSize {
+			httpError(w, r, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	clusters := res.Clusters
+	if len(clusters) > limit {
+		clusters = clusters[:limit]
+	}
+	if clusters == nil {
+		clusters = []cluster.Cluster{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(clusterListResponse{
+		Height:   res.Height,
+		BuiltAt:  builtAt,
+		Total:    len(res.Clusters),
+		Clusters: clusters,
+	})
+}
+
+// GetAddressCluster returns the cluster an address belongs to.
+func (s *Server) GetAddressCluster(w http.ResponseWriter, r *http.Request) {
+	address := mux.Vars(r)["address"]
+
+	res, builtAt := s.clusters.get()
+	if res == nil {
+		httpError(w, r, "address clusters not built yet", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(addressClusterResponse{
+		Address: address,
+		Height:  res.Height,
+		BuiltAt: builtAt,
+		Cluster: res.Lookup(address),
+	})
+}
@@ -0,0 +1,578 @@
+package api
+
+// cold_storage.go keeps most of the zakat pool of ZAKAT_WALLET_ADDRESS
+// in a cold wallet (COLD_WALLET_ADDRESS) whose key never reaches the
+// server. Every COLD_SWEEP_INTERVAL minutes the leader sweeps what the
+// pool holds above POOL_HOT_CEILING to the cold wallet, signing with
+// POOL_SWEEP_PRIVATE_KEY. Disbursements are paid from the hot pool
+// only; to pay more, an admin requests a cold-to-hot transfer, which
+// COLD_TRANSFER_APPROVALS distinct admins (the requester included) must
+// approve before a transaction signed offline with the cold key is
+// accepted for it. Tenant pools are not swept.
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+)
+
+const (
+	defaultColdSweepInterval     = 60 // minutes
+	defaultColdTransferApprovals = 2
+	defaultColdTransferListLimit = 100
+)
+
+// coldWalletAddress returns COLD_WALLET_ADDRESS, or "" without cold
+// storage.
+func coldWalletAddress() string {
+	addr := strings.TrimSpace(os.Getenv("COLD_WALLET_ADDRESS"))
+	if addr == "" {
+		return ""
+	}
+	return blockchain.CanonicalAddress(addr)
+}
+
+// coldStoragePool returns the pool kept partly in cold storage, or ""
+// without cold storage.
+func coldStoragePool() string {
+	addr := os.Getenv("ZAKAT_WALLET_ADDRESS")
+	if coldWalletAddress() == "" || addr == "" {
+		return ""
+	}
+	return blockchain.CanonicalAddress(addr)
+}
+
+// poolHotCeiling returns POOL_HOT_CEILING, the most the hot pool keeps,
+// and whether it is set.
+func poolHotCeiling() (int, bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("POOL_HOT_CEILING")))
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// coldSweepKey returns the key of the hot pool that sweeps sign with,
+// or nil when POOL_SWEEP_PRIVATE_KEY is unset or invalid.
+func coldSweepKey() *ecdsa.PrivateKey {
+	dBytes, err := hex.DecodeString(strings.TrimSpace(os.Getenv("POOL_SWEEP_PRIVATE_KEY")))
+	if err != nil || len(dBytes) == 0 {
+		return nil
+	}
+	priv := blockchain.BigIntToPrivateKey(dBytes, blockchain.GetDefaultCurve())
+	return &priv
+}
+
+// coldTransferApprovals is the number of admins that must approve a
+// cold-to-hot transfer (COLD_TRANSFER_APPROVALS, at least 2).
+func coldTransferApprovals() int {
+	return max(envLimit("COLD_TRANSFER_APPROVALS", defaultColdTransferApprovals), 2)
+}
+
+// CheckColdStorage validates the cold storage settings. Without
+// COLD_WALLET_ADDRESS there is nothing to check.
+func CheckColdStorage() error {
+	cold := coldWalletAddress()
+	if cold == "" {
+		return nil
+	}
+	if !blockchain.ValidateAddress(cold) {
+		return fmt.Errorf("COLD_WALLET_ADDRESS must be a wallet address")
+	}
+	pool := coldStoragePool()
+	if pool == "" {
+		return fmt.Errorf("COLD_WALLET_ADDRESS needs ZAKAT_WALLET_ADDRESS")
+	}
+	if pool == cold {
+		return fmt.Errorf("COLD_WALLET_ADDRESS must differ from ZAKAT_WALLET_ADDRESS")
+	}
+	if os.Getenv("POOL_HOT_CEILING") == "" {
+		return nil
+	}
+	if _, ok := poolHotCeiling(); !ok {
+		return fmt.Errorf("POOL_HOT_CEILING must be a non-negative number of units")
+	}
+	priv := coldSweepKey()
+	if priv == nil {
+		return fmt.Errorf("POOL_HOT_CEILING needs POOL_SWEEP_PRIVATE_KEY, the hex key of ZAKAT_WALLET_ADDRESS")
+	}
+	if !blockchain.KeyControlsAddress(&priv.PublicKey, pool) {
+		return fmt.Errorf("POOL_SWEEP_PRIVATE_KEY does not control ZAKAT_WALLET_ADDRESS")
+	}
+	return nil
+}
+
+// coldSweepEnabled reports whether the pool is swept to the cold
+// wallet.
+func coldSweepEnabled() bool {
+	_, ok := poolHotCeiling()
+	return coldStoragePool() != "" && ok && coldSweepKey() != nil
+}
+
+// runColdSweep sweeps the pool every COLD_SWEEP_INTERVAL minutes.
+func (s *Server) runColdSweep() {
+	ticker := time.NewTicker(time.Duration(envLimit("COLD_SWEEP_INTERVAL", defaultColdSweepInterval)) * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.runScheduled("cold_sweep", s.sweepToCold)
+	}
+}
+
+// sweepToCold moves what the hot pool holds above POOL_HOT_CEILING to
+// the cold wallet. Like zakat deductions, sweeps are issued by the
+// server and skip the policy checks.
+func (s *Server) sweepToCold() {
+	if !coldSweepEnabled() {
+		return
+	}
+	pool, cold := coldStoragePool(), coldWalletAddress()
+	ceiling, _ := poolHotCeiling()
+	priv := coldSweepKey()
+	poolHash, err := blockchain.DecodeAddress(pool)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+
+	balance, spendable := s.UTXO.FindSpendableOutputsExcluding(poolHash, math.MaxInt, s.reservedOutputs())
+	excess := balance - ceiling
+	if excess <= 0 {
+		return
+	}
+	payments := []blockchain.Payment{{To: cold, Amount: excess}}
+	tx, err := blockchain.NewSplitTransaction(*priv, payments, s.BC, spendable, poolHash, balance)
+	if err != nil {
+		s.logEvent(ctx, "error", "cold_sweep_failed", fmt.Sprintf("sweep of %d from %s: %v", excess, pool, err), "scheduler")
+		return
+	}
+	newBlock, err := s.BC.AddBlockContext(ctx, []*blockchain.Transaction{tx})
+	if err != nil {
+		s.logEvent(ctx, "error", "cold_sweep_failed", fmt.Sprintf("sweep of %d from %s: %v", excess, pool, err), "scheduler")
+		return
+	}
+	height := len(s.BC.Blocks) - 1
+	s.reports.invalidateBlock(newBlock)
+	_ = s.UTXO.Reindex()
+	s.persistMinedBlock(newBlock, height, []*blockchain.Transaction{tx}, "cold_sweep")
+	s.logEvent(ctx, "info", "cold_sweep",
+		fmt.Sprintf("swept %d from zakat pool %s to cold wallet %s in tx %x (hot balance %d, ceiling %d)",
+			excess, pool, cold, tx.ID, balance, ceiling), "scheduler")
+}
+
+// insufficientPoolFunds is the error of a disbursement the pool cannot
+// pay, pointing at the cold wallet when the pool is kept partly there.
+func insufficientPoolFunds(pool string) string {
+	if cold := coldStoragePool(); cold != "" && blockchain.SameAddress(pool, cold) {
+		return "insufficient hot wallet funds, request a cold-to-hot transfer"
+	}
+	return "insufficient funds"
+}
+
+type coldStorageResponse struct {
+	PoolAddress  string `json:"pool_address"`
+	ColdAddress  string `json:"cold_address"`
+	HotBalance   int    `json:"hot_balance"`
+	ColdBalance  int    `json:"cold_balance"`
+	HotCeiling   *int   `json:"hot_ceiling,omitempty"`
+	SweepEnabled bool   `json:"sweep_enabled"`
+	Approvals    int    `json:"required_approvals"`
+}
+
+type coldTransferRequest struct {
+	Amount int    `json:"amount"`
+	Reason string `json:"reason"`
+}
+
+type coldTransfersResponse struct {
+	ColdTransfers []models.ColdTransfer `json:"cold_transfers"`
+}
+
+// executeColdTransferRequest carries the transaction signed offline
+// with the cold key, as in POST /transactions/submit.
+type executeColdTransferRequest struct {
+	RawHex     string           `json:"raw_hex"`
+	Signatures []inputSignature `json:"signatures,omitempty"`
+}
+
+// requireColdStorage writes an error and returns false unless cold
+// storage and a database are configured.
+func (s *Server) requireColdStorage(w http.ResponseWriter, r *http.Request) bool {
+	if coldStoragePool() == "" {
+		httpError(w, r, "cold storage is not configured", http.StatusNotFound)
+		return false
+	}
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// GetColdStorage reports the balances of the hot pool and the cold
+// wallet and the sweep settings.
+func (s *Server) GetColdStorage(w http.ResponseWriter, r *http.Request) {
+	pool, cold := coldStoragePool(), coldWalletAddress()
+	if pool == "" {
+		httpError(w, r, "cold storage is not configured", http.StatusNotFound)
+		return
+	}
+	resp := coldStorageResponse{
+		PoolAddress:  pool,
+		ColdAddress:  cold,
+		SweepEnabled: coldSweepEnabled(),
+		Approvals:    coldTransferApprovals(),
+	}
+	if ceiling, ok := poolHotCeiling(); ok {
+		resp.HotCeiling = &ceiling
+	}
+	s.chainMu.Lock()
+	resp.HotBalance, _, _ = s.balanceForAddress(pool)
+	resp.ColdBalance, _, _ = s.balanceForAddress(cold)
+	s.chainMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// CreateColdTransfer requests a transfer of amount from the cold wallet
+// to the hot pool. The requesting admin is its first approval.
+func (s *Server) CreateColdTransfer(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !s.requireColdStorage(w, r) {
+		return
+	}
+
+	var req coldTransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.Amount <= 0 {
+		httpError(w, r, "amount must be positive", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		httpError(w, r, "reason is required", http.StatusBadRequest)
+		return
+	}
+
+	admin := adminName(ctx)
+	ct := &models.ColdTransfer{
+		ID:          uuid.NewString(),
+		ColdAddress: coldWalletAddress(),
+		PoolAddress: coldStoragePool(),
+		Amount:      req.Amount,
+		Reason:      req.Reason,
+		Status:      models.ColdTransferPending,
+		RequestedBy: admin,
+		Approvals:   []string{admin},
+		Required:    coldTransferApprovals(),
+		Version:     1,
+		CreatedAt:   s.Clock.Now().UTC(),
+	}
+	if err := s.DB.CreateColdTransfer(ctx, ct); err != nil {
+		httpError(w, r, "failed to save cold transfer", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "cold_transfer_save_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	s.logEvent(ctx, "warn", "cold_transfer_requested",
+		fmt.Sprintf("cold transfer %s of %d from %s to %s requested by %s: %s",
+			ct.ID, ct.Amount, ct.ColdAddress, ct.PoolAddress, admin, ct.Reason), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(ct)
+}
+
+// ListColdTransfers returns the cold transfers, newest first,
+// optionally only those with ?status=, at most ?limit= (default 100).
+func (s *Server) ListColdTransfers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !s.requireColdStorage(w, r) {
+		return
+	}
+
+	q := r.URL.Query()
+	status := q.Get("status")
+	switch status {
+	case "", models.ColdTransferPending, models.ColdTransferApproved, models.ColdTransferExecuted, models.ColdTransferRejected:
+	default:
+		httpError(w, r, "invalid status", http.StatusBadRequest)
+		return
+	}
+	limit := defaultColdTransferListLimit
+	if l := q.Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 {
+			httpError(w, r, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	list, err := s.DB.ListColdTransfers(ctx, status, limit)
+	if err != nil {
+		httpError(w, r, "failed to load cold transfers", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "cold_transfer_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if list == nil {
+		list = []models.ColdTransfer{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(coldTransfersResponse{ColdTransfers: list})
+}
+
+// GetColdTransfer returns one cold transfer.
+func (s *Server) GetColdTransfer(w http.ResponseWriter, r *http.Request) {
+	if !s.requireColdStorage(w, r) {
+		return
+	}
+	ct, ok := s.loadColdTransfer(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ct)
+}
+
+// loadColdTransfer loads the cold transfer of the {id} route variable.
+// On failure it writes the error response and returns false.
+func (s *Server) loadColdTransfer(w http.ResponseWriter, r *http.Request) (*models.ColdTransfer, bool) {
+	ctx := r.Context()
+	ct, err := s.DB.GetColdTransfer(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, "failed to load cold transfer", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "cold_transfer_get_failed", err.Error(), r.RemoteAddr)
+		return nil, false
+	}
+	if ct == nil {
+		httpError(w, r, "cold transfer not found", http.StatusNotFound)
+		return nil, false
+	}
+	return ct, true
+}
+
+// saveColdTransfer writes ct, loaded at version, back. On failure,
+// including a concurrent update, it writes the error response and
+// returns false.
+func (s *Server) saveColdTransfer(w http.ResponseWriter, r *http.Request, ct *models.ColdTransfer, version int) bool {
+	ctx := r.Context()
+	ct.Version = version + 1
+	ok, err := s.DB.UpdateColdTransfer(ctx, ct, version)
+	if err != nil {
+		httpError(w, r, "failed to save cold transfer", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "cold_transfer_save_failed", err.Error(), r.RemoteAddr)
+		return false
+	}
+	if !ok {
+		httpError(w, r, "cold transfer changed meanwhile, retry", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// ApproveColdTransfer records the calling admin's approval. Once
+// enough distinct admins approved, the transfer may be executed.
+func (s *Server) ApproveColdTransfer(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !s.requireColdStorage(w, r) {
+		return
+	}
+	ct, ok := s.loadColdTransfer(w, r)
+	if !ok {
+		return
+	}
+	if ct.Status != models.ColdTransferPending {
+		httpError(w, r, "cold transfer is not awaiting approval", http.StatusConflict)
+		return
+	}
+	admin := adminName(ctx)
+	for _, a := range ct.Approvals {
+		if a == admin {
+			httpError(w, r, "admin already approved this cold transfer", http.StatusConflict)
+			return
+		}
+	}
+
+	version := ct.Version
+	ct.Approvals = append(ct.Approvals, admin)
+	if len(ct.Approvals) >= ct.Required {
+		ct.Status = models.ColdTransferApproved
+	}
+	if !s.saveColdTransfer(w, r, ct, version) {
+		return
+	}
+	s.logEvent(ctx, "warn", "cold_transfer_approved",
+		fmt.Sprintf("cold transfer %s approved by %s (%d of %d)", ct.ID, admin, len(ct.Approvals), ct.Required), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ct)
+}
+
+// RejectColdTransfer cancels a cold transfer that was not executed.
+func (s *Server) RejectColdTransfer(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !s.requireColdStorage(w, r) {
+		return
+	}
+	ct, ok := s.loadColdTransfer(w, r)
+	if !ok {
+		return
+	}
+	if ct.Status != models.ColdTransferPending && ct.Status != models.ColdTransferApproved {
+		httpError(w, r, "cold transfer is already resolved", http.StatusConflict)
+		return
+	}
+
+	version := ct.Version
+	now := s.Clock.Now().UTC()
+	ct.Status = models.ColdTransferRejected
+	ct.ResolvedAt = &now
+	ct.ResolvedBy = adminName(ctx)
+	if !s.saveColdTransfer(w, r, ct, version) {
+		return
+	}
+	s.logEvent(ctx, "warn", "cold_transfer_rejected",
+		fmt.Sprintf("cold transfer %s rejected by %s", ct.ID, ct.ResolvedBy), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ct)
+}
+
+// ExecuteColdTransfer mines the transaction, signed offline with the
+// cold key, that pays an approved cold transfer: its inputs must be the
+// cold wallet's and it must pay exactly the approved amount to the pool,
+// returning any change to the cold wallet.
+func (s *Server) ExecuteColdTransfer(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !s.requireColdStorage(w, r) {
+		return
+	}
+
+	var req executeColdTransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request payload", http.StatusBadRequest)
+		return
+	}
+	tx, err := decodeRawTx(req.RawHex)
+	if err != nil {
+		httpError(w, r, "raw_hex must be a hex-encoded transaction", http.StatusBadRequest)
+		return
+	}
+	if msg := attachSignatures(tx, req.Signatures); msg != "" {
+		httpError(w, r, msg, http.StatusBadRequest)
+		return
+	}
+
+	ct, ok := s.loadColdTransfer(w, r)
+	if !ok {
+		return
+	}
+	if ct.Status != models.ColdTransferApproved {
+		httpError(w, r, "cold transfer is not approved", http.StatusConflict)
+		return
+	}
+	if msg := coldTransferMismatch(tx, ct); msg != "" {
+		httpError(w, r, msg, http.StatusBadRequest)
+		return
+	}
+
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+
+	batch := &offlineBatch{
+		accepted: make(map[string]*blockchain.Transaction),
+		spent:    make(map[string]bool),
+	}
+	if reason := s.validateRawTx(ctx, tx, batch); reason != "" {
+		httpError(w, r, reason, http.StatusBadRequest)
+		return
+	}
+	noteAuditTx(ctx, tx.ID)
+
+	// claim the transfer before mining, so that it is paid once
+	version := ct.Version
+	now := s.Clock.Now().UTC()
+	ct.Status = models.ColdTransferExecuted
+	ct.ResolvedAt = &now
+	ct.ResolvedBy = adminName(ctx)
+	ct.TxID = fmt.Sprintf("%x", tx.ID)
+	if !s.saveColdTransfer(w, r, ct, version) {
+		return
+	}
+
+	newBlock, err := s.BC.AddBlockContext(ctx, []*blockchain.Transaction{tx})
+	if err != nil {
+		// put the transfer back so that it can be executed again
+		ct.Status, ct.ResolvedAt, ct.ResolvedBy, ct.TxID = models.ColdTransferApproved, nil, "", ""
+		if ok, uerr := s.DB.UpdateColdTransfer(context.Background(), ct, ct.Version); uerr != nil || !ok {
+			log.Printf("cold transfer %s not reopened after failed mining: %v", ct.ID, uerr)
+		}
+		mineError(w, r, err)
+		return
+	}
+	height := len(s.BC.Blocks) - 1
+	s.reports.invalidateBlock(newBlock)
+	_ = s.UTXO.Reindex()
+	s.persistMinedBlock(newBlock, height, []*blockchain.Transaction{tx}, "cold_transfer")
+
+	ct.BlockHash = fmt.Sprintf("%x", newBlock.Hash)
+	if ok, err := s.DB.UpdateColdTransfer(ctx, ct, ct.Version); err != nil || !ok {
+		s.logEvent(ctx, "error", "cold_transfer_save_failed",
+			fmt.Sprintf("cold transfer %s mined in block %s, not recorded: %v", ct.ID, ct.BlockHash, err), r.RemoteAddr)
+	}
+	s.logEvent(ctx, "warn", "cold_transfer_executed",
+		fmt.Sprintf("cold transfer %s of %d from %s to %s executed by %s in tx %s",
+			ct.ID, ct.Amount, ct.ColdAddress, ct.PoolAddress, ct.ResolvedBy, ct.TxID), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ct)
+}
+
+// coldTransferMismatch tells how tx fails to pay ct, or returns "" when
+// it spends only cold wallet outputs and pays exactly ct.Amount to the
+// pool with any change back to the cold wallet.
+func coldTransferMismatch(tx *blockchain.Transaction, ct *models.ColdTransfer) string {
+	for _, in := range tx.Vin {
+		if !blockchain.SameAddress(blockchain.PubKeyAddress(in.PubKey), ct.ColdAddress) {
+			return "transaction must spend the cold wallet only"
+		}
+	}
+	paid := 0
+	for _, out := range tx.Vout {
+		owner := blockchain.EncodeAddress(out.Owner())
+		switch {
+		case blockchain.SameAddress(owner, ct.PoolAddress):
+			paid += out.Value
+		case blockchain.SameAddress(owner, ct.ColdAddress):
+		default:
+			return "transaction must pay the zakat pool only"
+		}
+	}
+	if paid != ct.Amount {
+		return fmt.Sprintf("transaction pays the pool %d, not the approved %d", paid, ct.Amount)
+	}
+	return ""
+}
@@ -0,0 +1,518 @@
+package api
+
+// cooling_off.go holds back risky transfers for a cooling-off period so
+// that the owner of a taken-over account can stop them. A send above
+// COOLING_OFF_AMOUNT, or with COOLING_OFF_NEW_RECIPIENT=true the first
+// send to an address the wallet never paid before, is signed as usual
+// but parked in held_transfers for COOLING_OFF_MINUTES (default 30).
+// The wallet's owner is notified with a cancel link; unless cancelled,
+// the transfer is re-validated and mined when the period ends. Status
+// changes are compare-and-set on the stored row, so a cancel and a
+// release, or two instances, never both win.
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/i18n"
+	"wallet_backend_go/internal/models"
+)
+
+const (
+	defaultCoolingOffMinutes = 30
+
+	// heldTransferTick is how often due transfers are released.
+	heldTransferTick = 15 * time.Second
+
+	heldReasonAmount       = "amount"
+	heldReasonNewRecipient = "new_recipient"
+)
+
+// coolingOffAmount is the amount above which transfers are held
+// (COOLING_OFF_AMOUNT); 0 disables the rule.
+func coolingOffAmount() int {
+	n, err := strconv.Atoi(os.Getenv("COOLING_OFF_AMOUNT"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// coolingOffNewRecipient reports whether first transfers to an address
+// are held (COOLING_OFF_NEW_RECIPIENT).
+func coolingOffNewRecipient() bool {
+	return strings.EqualFold(os.Getenv("COOLING_OFF_NEW_RECIPIENT"), "true")
+}
+
+// coolingOffDelay is how long transfers are held (COOLING_OFF_MINUTES).
+func coolingOffDelay() time.Duration {
+	return time.Duration(envLimit("COOLING_OFF_MINUTES", defaultCoolingOffMinutes)) * time.Minute
+}
+
+// publicBaseURL is the externally reachable base URL of the API
+// (PUBLIC_BASE_URL) used in links sent to users.
+func publicBaseURL() string {
+	base := os.Getenv("PUBLIC_BASE_URL")
+	if base == "" {
+		base = "http://localhost:8080"
+	}
+	return strings.TrimRight(base, "/")
+}
+
+func heldCancelURL(id, token string) string {
+	return fmt.Sprintf("%s/api/v1/transfers/held/%s/cancel?token=%s", publicBaseURL(), id, url.QueryEscape(token))
+}
+
+// heldTransfers are the transfers this instance waits to release.
+type heldTransfers struct {
+	mu      sync.Mutex
+	pending map[string]*models.HeldTransfer
+}
+
+func (h *heldTransfers) add(ht *models.HeldTransfer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.pending == nil {
+		h.pending = make(map[string]*models.HeldTransfer)
+	}
+	h.pending[ht.ID] = ht
+}
+
+func (h *heldTransfers) get(id string) *models.HeldTransfer {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.pending[id]
+}
+
+// take removes and returns the transfer with id.
+func (h *heldTransfers) take(id string) *models.HeldTransfer {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ht := h.pending[id]
+	delete(h.pending, id)
+	return ht
+}
+
+// reservedOutputs returns the outputs spent by the pending transfers,
+// keyed "txid:vout", so new sends from the same wallet pick others.
+func (h *heldTransfers) reservedOutputs() map[string]bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	reserved := make(map[string]bool)
+	for _, ht := range h.pending {
+		raw, err := hex.DecodeString(ht.RawTx)
+		if err != nil {
+			continue
+		}
+		tx, err := blockchain.DeserializeTransaction(raw)
+		if err != nil {
+			continue
+		}
+		for _, in := range tx.Vin {
+			reserved[fmt.Sprintf("%x:%d", in.Txid, in.Vout)] = true
+		}
+	}
+	return reserved
+}
+
+// transactions returns the transactions of the pending transfers.
+func (h *heldTransfers) transactions() []*blockchain.Transaction {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var txs []*blockchain.Transaction
+	for _, ht := range h.pending {
+		raw, err := hex.DecodeString(ht.RawTx)
+		if err != nil {
+			continue
+		}
+		tx, err := blockchain.DeserializeTransaction(raw)
+		if err != nil {
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+// due removes and returns the transfers to release at now.
+func (h *heldTransfers) due(now time.Time) []*models.HeldTransfer {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []*models.HeldTransfer
+	for id, ht := range h.pending {
+		if !now.Before(ht.ReleaseAt) {
+			out = append(out, ht)
+			delete(h.pending, id)
+		}
+	}
+	return out
+}
+
+type heldTransferResponse struct {
+	Status    string    `json:"status"` // "held"
+	ID        string    `json:"id"`
+	Reason    string    `json:"reason"`
+	ReleaseAt time.Time `json:"release_at"`
+	CancelURL string    `json:"cancel_url"`
+}
+
+type heldTransferStatus struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// coolingOffReason returns why a transfer must be held, or "" if it can
+// be mined right away. Must be called with chainMu held.
+func (s *Server) coolingOffReason(from, to string, amount int) string {
+	if limit := coolingOffAmount(); limit > 0 && amount > limit {
+		return heldReasonAmount
+	}
+	if coolingOffNewRecipient() && from != to && !s.hasSentTo(from, to) {
+		return heldReasonNewRecipient
+	}
+	return ""
+}
+
+// hasSentTo reports whether a mined transaction signed by from pays to.
+func (s *Server) hasSentTo(from, to string) bool {
+	txs, err := s.BC.GetTransactionsForAddress(to)
+	if err != nil {
+		return false
+	}
+	for _, tx := range txs {
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Vin {
+			if blockchain.SameAddress(blockchain.PubKeyAddress(in.PubKey), from) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// holdTransfer parks a signed transfer for the cooling-off period,
+// notifies the sending wallet's owner and answers 202 Accepted. It
+// reports whether the transfer was held.
+func (s *Server) holdTransfer(w http.ResponseWriter, r *http.Request, tx *blockchain.Transaction, from, to string, amount int, reason string) bool {
+	ctx := r.Context()
+
+	buf := make([]byte, 32)
+	if _, err := io.ReadFull(s.Entropy, buf); err != nil {
+		httpError(w, r, "failed to hold transfer", http.StatusInternalServerError)
+		return false
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	tokenHash := sha256.Sum256([]byte(token))
+	now := s.Clock.Now().UTC()
+	ht := &models.HeldTransfer{
+		ID:              uuid.NewString(),
+		FromAddress:     from,
+		ToAddress:       to,
+		Amount:          amount,
+		RawTx:           hex.EncodeToString(tx.Serialize()),
+		Reason:          reason,
+		Status:          models.HeldTransferHeld,
+		CancelTokenHash: hex.EncodeToString(tokenHash[:]),
+		CreatedAt:       now,
+		ReleaseAt:       now.Add(coolingOffDelay()),
+	}
+
+	if s.DB != nil {
+		wp, err := s.DB.GetWalletProfileByAddress(ctx, from)
+		if err != nil {
+			httpError(w, r, "failed to hold transfer", http.StatusInternalServerError)
+			s.logEvent(ctx, "error", "wallet_profile_get_failed", err.Error(), r.RemoteAddr)
+			return false
+		}
+		if wp != nil {
+			ht.UserID, ht.TenantID = wp.UserID, wp.TenantID
+		}
+		if err := s.DB.CreateHeldTransfer(ctx, ht); err != nil {
+			httpError(w, r, "failed to hold transfer", http.StatusInternalServerError)
+			s.logEvent(ctx, "error", "held_transfer_save_failed", err.Error(), r.RemoteAddr)
+			return false
+		}
+	}
+	s.held.add(ht)
+
+	cancelURL := heldCancelURL(ht.ID, token)
+	s.notifyDetached(ht.UserID, models.NotifyEventTransferHeld, func() string {
+		return i18n.Tf(i18n.Default, "A transfer of %s from wallet %s to %s is on hold until %s. If you did not make it, cancel it now:",
+			fmt.Sprint(amount), from, to, ht.ReleaseAt.Format(time.RFC1123)) + "\n" + cancelURL
+	})
+	s.logEvent(ctx, "info", "transfer_held",
+		fmt.Sprintf("transfer %s of %d from %s to %s held until %s (%s)",
+			ht.ID, amount, from, to, ht.ReleaseAt.Format(time.RFC3339), reason),
+		r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(heldTransferResponse{
+		Status:    models.HeldTransferHeld,
+		ID:        ht.ID,
+		Reason:    reason,
+		ReleaseAt: ht.ReleaseAt,
+		CancelURL: cancelURL,
+	})
+	return true
+}
+
+// resolveHeld moves ht from status from to ht.Status. Without a
+// database the in-memory queue is the only copy and always wins.
+func (s *Server) resolveHeld(ctx context.Context, ht *models.HeldTransfer, from string) (bool, error) {
+	if s.DB == nil {
+		return true, nil
+	}
+	return s.DB.ResolveHeldTransfer(ctx, ht, from)
+}
+
+// runHeldTransfers picks up the transfers held before a restart and
+// releases held transfers as they fall due.
+func (s *Server) runHeldTransfers() {
+	if s.DB != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		held, err := s.DB.ListHeldTransfers(ctx, models.HeldTransferHeld)
+		cancel()
+		if err != nil {
+			log.Printf("failed to load held transfers: %v", err)
+		}
+		for i := range held {
+			s.held.add(&held[i])
+		}
+	}
+
+	ticker := time.NewTicker(heldTransferTick)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.runScheduled("held-transfers", s.releaseDueTransfers)
+	}
+}
+
+// releaseDueTransfers mines every held transfer whose cooling-off
+// period has ended.
+func (s *Server) releaseDueTransfers() {
+	for _, ht := range s.held.due(s.Clock.Now()) {
+		s.releaseTransfer(ht)
+	}
+}
+
+// releaseTransfer re-validates a held transfer against the current
+// chain and mines it, or marks it failed when it no longer applies.
+func (s *Server) releaseTransfer(ht *models.HeldTransfer) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	fail := func(reason string) {
+		now := s.Clock.Now().UTC()
+		ht.Status, ht.ResolvedAt, ht.Error = models.HeldTransferFailed, &now, reason
+		if _, err := s.resolveHeld(ctx, ht, models.HeldTransferHeld); err != nil {
+			s.logEvent(ctx, "error", "held_transfer_update_failed", err.Error(), "worker")
+		}
+		s.logEvent(ctx, "warn", "held_transfer_failed",
+			fmt.Sprintf("held transfer %s not released: %s", ht.ID, reason), "worker")
+	}
+
+	raw, err := hex.DecodeString(ht.RawTx)
+	if err != nil {
+		fail("stored transaction is unreadable")
+		return
+	}
+	tx, err := blockchain.DeserializeTransaction(raw)
+	if err != nil {
+		fail("stored transaction is unreadable")
+		return
+	}
+
+	s.chainMu.Lock()
+	for _, in := range tx.Vin {
+		if s.BC.IsOutputSpent(in.Txid, in.Vout) {
+			s.chainMu.Unlock()
+			fail("inputs already spent")
+			return
+		}
+	}
+	if !s.BC.VerifyTransaction(tx) {
+		s.chainMu.Unlock()
+		fail("invalid transaction")
+		return
+	}
+	// the wallet may have been frozen during the cooling-off period
+	if err := s.BC.CheckPolicy(ctx, tx); err != nil {
+		s.chainMu.Unlock()
+		reason := "failed to validate transaction"
+		if rej, ok := blockchain.AsRejection(err); ok {
+			reason = rej.Reason
+		}
+		fail(reason)
+		return
+	}
+
+	now := s.Clock.Now().UTC()
+	ht.Status, ht.ResolvedAt = models.HeldTransferReleased, &now
+	claimed, err := s.resolveHeld(ctx, ht, models.HeldTransferHeld)
+	if err != nil {
+		s.chainMu.Unlock()
+		// try again on the next tick
+		ht.Status, ht.ResolvedAt = models.HeldTransferHeld, nil
+		s.held.add(ht)
+		s.logEvent(ctx, "error", "held_transfer_update_failed", err.Error(), "worker")
+		return
+	}
+	if !claimed {
+		s.chainMu.Unlock()
+		return // cancelled, or released by another instance
+	}
+
+	newBlock := s.BC.AddBlock([]*blockchain.Transaction{tx})
+	height := len(s.BC.Blocks) - 1
+	s.reports.invalidateBlock(newBlock)
+	_ = s.UTXO.Reindex()
+	s.chainMu.Unlock()
+
+	s.persistMinedBlock(newBlock, height, []*blockchain.Transaction{tx}, "offline")
+	ht.BlockHash = fmt.Sprintf("%x", newBlock.Hash)
+	if _, err := s.resolveHeld(ctx, ht, models.HeldTransferReleased); err != nil {
+		s.logEvent(ctx, "error", "held_transfer_update_failed", err.Error(), "worker")
+	}
+
+	s.maybeAutoZakat(ht.ToAddress, ht.Amount)
+	s.notifyIncomingFunds(ht.ToAddress, ht.Amount)
+	s.logEvent(ctx, "info", "held_transfer_released",
+		fmt.Sprintf("held transfer %s mined in block %s", ht.ID, ht.BlockHash), "worker")
+}
+
+// loadHeldTransfer returns the held transfer id if token is its cancel
+// token. It writes the error response and returns nil otherwise.
+func (s *Server) loadHeldTransfer(w http.ResponseWriter, r *http.Request) *models.HeldTransfer {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	token := r.FormValue("token")
+
+	var ht *models.HeldTransfer
+	if s.DB != nil {
+		stored, err := s.DB.GetHeldTransfer(ctx, id)
+		if err != nil {
+			httpError(w, r, "failed to load held transfer", http.StatusInternalServerError)
+			s.logEvent(ctx, "error", "held_transfer_get_failed", err.Error(), r.RemoteAddr)
+			return nil
+		}
+		ht = stored
+	} else {
+		ht = s.held.get(id)
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	if ht == nil || token == "" ||
+		subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(ht.CancelTokenHash)) != 1 {
+		// unknown ids and wrong tokens are answered alike
+		httpError(w, r, "held transfer not found", http.StatusNotFound)
+		return nil
+	}
+	return ht
+}
+
+var heldCancelPage = template.Must(template.New("cancel").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Text}}</p>
+{{if .Form}}<form method="post"><input type="hidden" name="token" value="{{.Token}}"><button type="submit">{{.Button}}</button></form>{{end}}
+</body></html>
+`))
+
+type heldCancelView struct {
+	Title, Text, Token, Button string
+	Form                       bool
+}
+
+// ShowHeldTransferCancel renders the page behind the cancel link: a
+// confirmation form, so that link scanners opening the link do not
+// cancel the transfer.
+func (s *Server) ShowHeldTransferCancel(w http.ResponseWriter, r *http.Request) {
+	ht := s.loadHeldTransfer(w, r)
+	if ht == nil {
+		return
+	}
+	l := lang(r)
+
+	view := heldCancelView{Title: i18n.T(l, "Cancel transfer")}
+	if ht.Status == models.HeldTransferHeld {
+		view.Text = i18n.Tf(l, "Transfer of %s from wallet %s to %s, on hold until %s.",
+			fmt.Sprint(ht.Amount), ht.FromAddress, ht.ToAddress, ht.ReleaseAt.Format(time.RFC1123))
+		view.Token = r.FormValue("token")
+		view.Button = i18n.T(l, "Cancel transfer")
+		view.Form = true
+	} else {
+		view.Text = i18n.T(l, "transfer is no longer held")
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	_ = heldCancelPage.Execute(w, view)
+}
+
+// CancelHeldTransfer cancels a held transfer before it is released.
+func (s *Server) CancelHeldTransfer(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	ht := s.loadHeldTransfer(w, r)
+	if ht == nil {
+		return
+	}
+	if ht.Status != models.HeldTransferHeld {
+		httpError(w, r, "transfer is no longer held", http.StatusConflict)
+		return
+	}
+
+	cancelled := *ht
+	now := s.Clock.Now().UTC()
+	cancelled.Status, cancelled.ResolvedAt = models.HeldTransferCancelled, &now
+	ok, err := s.resolveHeld(ctx, &cancelled, models.HeldTransferHeld)
+	if err != nil {
+		httpError(w, r, "failed to cancel transfer", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "held_transfer_update_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	// without a database the queue decides who came first
+	if !ok || (s.DB == nil && s.held.take(ht.ID) == nil) {
+		httpError(w, r, "transfer is no longer held", http.StatusConflict)
+		return
+	}
+	s.held.take(ht.ID)
+
+	s.logEvent(ctx, "warn", "transfer_cancelled",
+		fmt.Sprintf("held transfer %s of %d from %s cancelled by its owner", ht.ID, ht.Amount, ht.FromAddress),
+		r.RemoteAddr)
+
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = heldCancelPage.Execute(w, heldCancelView{
+			Title: i18n.T(lang(r), "Cancel transfer"),
+			Text:  i18n.T(lang(r), "The transfer has been cancelled."),
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(heldTransferStatus{ID: ht.ID, Status: models.HeldTransferCancelled})
+}
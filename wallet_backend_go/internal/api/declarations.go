@@ -0,0 +1,259 @@
+package api
+
+// declarations.go records the declarations donors attach to their
+// donations to a charity's campaign for government matching schemes
+// (Gift Aid and the like): the donor's consent for the charity to
+// claim, their name and home address, and the date they declared. The
+// charity exports the donations with a declaration in force to file
+// its claim. A donor can withdraw a declaration; withdrawn ones are
+// left out of later exports.
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+)
+
+// declarationExportYears is how far back an export reaches without
+// ?from=: the claim window of most matching schemes.
+const declarationExportYears = 4
+
+type declarationRequest struct {
+	CampaignID  string     `json:"campaign_id"`
+	FullName    string     `json:"full_name"`
+	HomeAddress string     `json:"home_address"`
+	Postcode    string     `json:"postcode"`
+	Consent     bool       `json:"consent"`
+	DeclaredAt  *time.Time `json:"declared_at"`
+}
+
+type declarationExport struct {
+	From         time.Time                    `json:"from"`
+	To           time.Time                    `json:"to"`
+	Donations    int                          `json:"donations"`
+	TotalAmount  int                          `json:"total_amount"`
+	Declarations []models.DonationDeclaration `json:"declarations"`
+}
+
+// CreateDeclaration attaches the session user's declaration to a
+// donation they sent to a campaign.
+func (s *Server) CreateDeclaration(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	txid := mux.Vars(r)["txid"]
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req declarationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.FullName = strings.TrimSpace(req.FullName)
+	req.HomeAddress = strings.TrimSpace(req.HomeAddress)
+	req.Postcode = strings.ToUpper(strings.TrimSpace(req.Postcode))
+	if !req.Consent {
+		httpError(w, r, "donor consent is required", http.StatusBadRequest)
+		return
+	}
+	if req.FullName == "" || req.HomeAddress == "" || req.Postcode == "" {
+		httpError(w, r, "full_name, home_address and postcode are required", http.StatusBadRequest)
+		return
+	}
+	now := s.Clock.Now().UTC()
+	declaredAt := now
+	if req.DeclaredAt != nil {
+		if req.DeclaredAt.After(now) {
+			httpError(w, r, "declared_at is in the future", http.StatusBadRequest)
+			return
+		}
+		declaredAt = req.DeclaredAt.UTC()
+	}
+
+	rec, err := s.DB.GetTransactionRecord(ctx, txid)
+	if err != nil {
+		httpError(w, r, "failed to load transaction", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "tx_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if rec == nil || rec.Sender == "" {
+		httpError(w, r, "transaction not found", http.StatusNotFound)
+		return
+	}
+	if !s.requireWalletOwner(w, r, rec.Sender) {
+		return
+	}
+	cp, err := s.DB.GetCampaign(ctx, req.CampaignID)
+	if err != nil {
+		httpError(w, r, "failed to load campaigns", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "campaign_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if cp == nil {
+		httpError(w, r, "campaign not found", http.StatusNotFound)
+		return
+	}
+	if !blockchain.SameAddress(rec.Receiver, cp.WalletAddress) {
+		httpError(w, r, "transaction did not pay this campaign", http.StatusBadRequest)
+		return
+	}
+	existing, err := s.DB.GetDonationDeclaration(ctx, txid)
+	if err != nil {
+		httpError(w, r, "failed to load declaration", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "declaration_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if existing != nil && existing.WithdrawnAt == nil {
+		httpError(w, r, "donation already has a declaration", http.StatusConflict)
+		return
+	}
+
+	d := &models.DonationDeclaration{
+		ID:            uuid.NewString(),
+		TxID:          txid,
+		TenantID:      cp.TenantID,
+		CampaignID:    cp.ID,
+		UserID:        sessionFrom(ctx).Subject,
+		WalletAddress: rec.Sender,
+		Amount:        rec.Amount,
+		DonatedAt:     time.Unix(rec.Timestamp, 0).UTC(),
+		FullName:      req.FullName,
+		HomeAddress:   req.HomeAddress,
+		Postcode:      req.Postcode,
+		Consent:       true,
+		DeclaredAt:    declaredAt,
+		CreatedAt:     now,
+	}
+	if err := s.DB.CreateDonationDeclaration(ctx, d); err != nil {
+		httpError(w, r, "failed to save declaration", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "declaration_create_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	s.logEvent(ctx, "info", "declaration_created", fmt.Sprintf("declaration %s for %s to campaign %s", d.ID, txid, cp.ID), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(d)
+}
+
+// WithdrawDeclaration withdraws the session user's declaration of a
+// donation. Claims already filed are not affected.
+func (s *Server) WithdrawDeclaration(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	txid := mux.Vars(r)["txid"]
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	d, err := s.DB.GetDonationDeclaration(ctx, txid)
+	if err != nil {
+		httpError(w, r, "failed to load declaration", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "declaration_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if d == nil || d.WithdrawnAt != nil || d.UserID != sessionFrom(ctx).Subject {
+		httpError(w, r, "declaration not found", http.StatusNotFound)
+		return
+	}
+	ok, err := s.DB.WithdrawDonationDeclaration(ctx, txid, s.Clock.Now().UTC())
+	if err != nil {
+		httpError(w, r, "failed to withdraw declaration", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "declaration_withdraw_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if !ok {
+		httpError(w, r, "declaration not found", http.StatusNotFound)
+		return
+	}
+	s.logEvent(ctx, "info", "declaration_withdrawn", fmt.Sprintf("declaration %s for %s", d.ID, txid), r.RemoteAddr)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExportDeclarations lists the donations to the tenant's campaigns made
+// in [?from, ?to) that carry a declaration in force, as JSON or, with
+// ?format=csv, as the CSV a claim is filed from.
+func (s *Server) ExportDeclarations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	to := s.Clock.Now().UTC()
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			httpError(w, r, "invalid to date", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	from := to.AddDate(-declarationExportYears, 0, 0)
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil || !t.Before(to) {
+			httpError(w, r, "invalid from date", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+
+	rows, err := s.DB.ListDonationDeclarations(ctx, tenantID(ctx), from, to)
+	if err != nil {
+		httpError(w, r, "failed to load declarations", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "declaration_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	export := declarationExport{From: from, To: to, Donations: len(rows), Declarations: rows}
+	if export.Declarations == nil {
+		export.Declarations = []models.DonationDeclaration{}
+	}
+	for _, d := range rows {
+		export.TotalAmount += d.Amount
+	}
+	s.logEvent(ctx, "info", "declarations_exported",
+		fmt.Sprintf("%d declarations from %s to %s", len(rows), from.Format("2006-01-02"), to.Format("2006-01-02")), r.RemoteAddr)
+
+	if q.Get("format") != "csv" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(export)
+		return
+	}
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	_ = cw.Write([]string{"txid", "donated_at", "amount", "campaign_id", "full_name", "home_address", "postcode", "declared_at"})
+	for _, d := range rows {
+		_ = cw.Write([]string{
+			d.TxID,
+			d.DonatedAt.Format("2006-01-02"),
+			strconv.Itoa(d.Amount),
+			d.CampaignID,
+			d.FullName,
+			d.HomeAddress,
+			d.Postcode,
+			d.DeclaredAt.Format("2006-01-02"),
+		})
+	}
+	cw.Flush()
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="declarations-%s-%s.csv"`,
+		from.Format("20060102"), to.Format("20060102")))
+	_, _ = w.Write(buf.Bytes())
+}
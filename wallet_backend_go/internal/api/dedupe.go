@@ -0,0 +1,73 @@
+package api
+
+// dedupe.go rejects accidental double submissions of a send. Frontends
+// resubmit when a response is slow, so a send with the same from, to
+// and amount as one accepted within the last DUPLICATE_SEND_WINDOW
+// seconds is refused unless the client sets allow_duplicate. The
+// window lives in memory, per instance.
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultDuplicateSendWindow = 60 * time.Second
+
+// duplicateSendWindow is how long an accepted send blocks an identical
+// one (DUPLICATE_SEND_WINDOW, seconds, default 60; 0 disables the
+// check).
+func duplicateSendWindow() time.Duration {
+	v := os.Getenv("DUPLICATE_SEND_WINDOW")
+	if v == "" {
+		return defaultDuplicateSendWindow
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return defaultDuplicateSendWindow
+	}
+	return time.Duration(n) * time.Second
+}
+
+// recentSends remembers when each (from, to, amount) was last accepted.
+type recentSends struct {
+	mu   sync.Mutex
+	sent map[string]time.Time
+}
+
+func sendKey(from, to string, amount int) string {
+	return fmt.Sprintf("%s|%s|%d", from, to, amount)
+}
+
+// duplicate reports whether an identical send was accepted within
+// window before now.
+func (d *recentSends) duplicate(from, to string, amount int, now time.Time, window time.Duration) bool {
+	if window <= 0 {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	at, ok := d.sent[sendKey(from, to, amount)]
+	return ok && now.Sub(at) < window
+}
+
+// record marks a send as accepted at now and drops entries that have
+// left the window.
+func (d *recentSends) record(from, to string, amount int, now time.Time, window time.Duration) {
+	if window <= 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.sent == nil {
+		d.sent = make(map[string]time.Time)
+	}
+	for k, at := range d.sent {
+		if now.Sub(at) >= window {
+			delete(d.sent, k)
+		}
+	}
+	d.sent[sendKey(from, to, amount)] = now
+}
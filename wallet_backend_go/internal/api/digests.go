@@ -0,0 +1,344 @@
+package api
+
+// digests.go emails admins a weekly or monthly digest of their
+// organization: zakat collected, zakat disbursed from the pool, new
+// registrations and system errors. Each admin API key subscribes per
+// tenant. A scheduler checks the subscriptions every digestTick and
+// sends the digest of a period once it has ended, rendered from the
+// admin_digest email template; a failed send is retried on the next
+// tick. The scheduler only runs when SMTP is configured.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/templates"
+)
+
+// digestTick is how often the scheduler looks for due digests.
+const digestTick = 15 * time.Minute
+
+type digestSubscriptionRequest struct {
+	Email     string `json:"email"`
+	Frequency string `json:"frequency"`
+	Active    bool   `json:"active"`
+}
+
+// digestSummary is the content of one digest.
+type digestSummary struct {
+	TenantID       string    `json:"tenant_id,omitempty"`
+	Frequency      string    `json:"frequency"`
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	ZakatCollected int       `json:"zakat_collected"`
+	ZakatRecords   int       `json:"zakat_records"`
+	Disbursed      int       `json:"disbursed"`
+	Disbursements  int       `json:"disbursements"`
+	Registrations  int       `json:"registrations"`
+	Errors         int       `json:"errors"`
+}
+
+type digestPreviewResponse struct {
+	Summary digestSummary `json:"summary"`
+	Subject string        `json:"subject"`
+	HTML    string        `json:"html"`
+}
+
+func validDigestFrequency(f string) bool {
+	return f == models.DigestWeekly || f == models.DigestMonthly
+}
+
+// digestPeriod returns the last period of frequency that ended by now:
+// the week from Monday 00:00 UTC, or the calendar month.
+func digestPeriod(frequency string, now time.Time) (from, to time.Time) {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if frequency == models.DigestMonthly {
+		to = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return to.AddDate(0, -1, 0), to
+	}
+	to = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	return to.AddDate(0, 0, -7), to
+}
+
+func digestSubscriptionID(tenant, admin string) string {
+	if tenant == "" {
+		return admin
+	}
+	return tenant + "/" + admin
+}
+
+// buildDigest gathers the digest of tenant for [from, to).
+func (s *Server) buildDigest(ctx context.Context, tenant, frequency string, from, to time.Time) (*digestSummary, error) {
+	sum := &digestSummary{TenantID: tenant, Frequency: frequency, From: from, To: to}
+
+	records, err := s.DB.ListZakatBetween(ctx, tenant, from, to)
+	if err != nil {
+		return nil, err
+	}
+	sum.ZakatRecords = len(records)
+	for _, zr := range records {
+		sum.ZakatCollected += zr.Amount
+	}
+
+	if sum.Registrations, err = s.DB.CountUsersCreatedBetween(ctx, tenant, from, to); err != nil {
+		return nil, err
+	}
+	if sum.Errors, err = s.DB.CountSystemLogsBetween(ctx, "error", from, to); err != nil {
+		return nil, err
+	}
+
+	pool, err := s.zakatAddressFor(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	if poolHash, err := blockchain.DecodeAddress(pool); err == nil {
+		s.chainMu.Lock()
+		blocks := append([]*blockchain.Block(nil), s.BC.Blocks...)
+		s.chainMu.Unlock()
+		sum.Disbursed, sum.Disbursements = poolDisbursements(blocks, poolHash, from, to)
+	}
+	return sum, nil
+}
+
+// poolDisbursements totals the payments out of the pool mined in
+// [from, to), counting one payment per transaction and recipient.
+func poolDisbursements(blocks []*blockchain.Block, poolHash []byte, from, to time.Time) (amount, count int) {
+	poolOutputs := make(map[string]bool) // "txid:vout"
+	for _, b := range blocks {
+		ts := time.Unix(b.Timestamp, 0).UTC()
+		inPeriod := !ts.Before(from) && ts.Before(to)
+		for _, tx := range b.Transactions {
+			fromPool := false
+			if !tx.IsCoinbase() {
+				for _, in := range tx.Vin {
+					key := fmt.Sprintf("%x:%d", in.Txid, in.Vout)
+					if poolOutputs[key] {
+						fromPool = true
+						delete(poolOutputs, key)
+					}
+				}
+			}
+			paid := make(map[string]bool)
+			for i, out := range tx.Vout {
+				if out.IsLockedWith(poolHash) {
+					poolOutputs[fmt.Sprintf("%x:%d", tx.ID, i)] = true
+					continue
+				}
+				if fromPool && inPeriod {
+					amount += out.Value
+					if recipient := blockchain.EncodeAddress(out.Owner()); !paid[recipient] {
+						paid[recipient] = true
+						count++
+					}
+				}
+			}
+		}
+	}
+	return amount, count
+}
+
+// renderDigest renders the admin_digest email of sum for admin.
+func (s *Server) renderDigest(ctx context.Context, admin string, sum *digestSummary) (templates.Message, error) {
+	return s.renderEmail(ctx, sum.TenantID, templates.AdminDigest, map[string]string{
+		"admin":           admin,
+		"frequency":       sum.Frequency,
+		"from":            sum.From.Format("2006-01-02"),
+		"to":              sum.To.Format("2006-01-02"),
+		"zakat_collected": strconv.Itoa(sum.ZakatCollected),
+		"zakat_records":   strconv.Itoa(sum.ZakatRecords),
+		"disbursed":       strconv.Itoa(sum.Disbursed),
+		"disbursements":   strconv.Itoa(sum.Disbursements),
+		"registrations":   strconv.Itoa(sum.Registrations),
+		"errors":          strconv.Itoa(sum.Errors),
+	})
+}
+
+// runDigests sends the due digests every digestTick.
+func (s *Server) runDigests() {
+	ticker := time.NewTicker(digestTick)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.runScheduled("digests", s.sendDueDigests)
+	}
+}
+
+// sendDueDigests sends every subscription the digest of its last ended
+// period, unless it was sent already.
+func (s *Server) sendDueDigests() {
+	if s.DB == nil || s.mailer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	subs, err := s.DB.ListDigestSubscriptions(ctx)
+	if err != nil {
+		log.Printf("failed to load digest subscriptions: %v", err)
+		return
+	}
+	now := s.Clock.Now()
+	for _, sub := range subs {
+		from, to := digestPeriod(sub.Frequency, now)
+		if !sub.SentThrough.Before(to) {
+			continue
+		}
+		if err := s.sendDigest(ctx, &sub, from, to); err != nil {
+			s.logEvent(ctx, "error", "digest_send_failed",
+				fmt.Sprintf("digest %s to %s: %v", sub.ID, sub.Email, err), "scheduler")
+			continue
+		}
+		if err := s.DB.MarkDigestSent(ctx, sub.ID, to, s.Clock.Now()); err != nil {
+			s.logEvent(ctx, "error", "digest_update_failed", err.Error(), "scheduler")
+		}
+	}
+}
+
+func (s *Server) sendDigest(ctx context.Context, sub *models.DigestSubscription, from, to time.Time) error {
+	sum, err := s.buildDigest(ctx, sub.TenantID, sub.Frequency, from, to)
+	if err != nil {
+		return err
+	}
+	msg, err := s.renderDigest(ctx, sub.Admin, sum)
+	if err != nil {
+		return err
+	}
+	if err := s.mailer.SendHTML(ctx, sub.Email, msg.Subject, msg.HTML); err != nil {
+		return err
+	}
+	s.logEvent(ctx, "info", "digest_sent",
+		fmt.Sprintf("%s digest %s..%s sent to admin %s", sub.Frequency, from.Format("2006-01-02"), to.Format("2006-01-02"), sub.Admin), "scheduler")
+	return nil
+}
+
+// GetDigestSubscription returns the calling admin's subscription for
+// the tenant of the request.
+func (s *Server) GetDigestSubscription(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	sub, err := s.DB.GetDigestSubscription(ctx, digestSubscriptionID(tenantID(ctx), adminName(ctx)))
+	if err != nil {
+		httpError(w, r, "failed to load digest subscription", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "digest_subscription_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if sub == nil {
+		httpError(w, r, "digest subscription not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(sub)
+}
+
+// SaveDigestSubscription subscribes the calling admin to the digest of
+// the tenant of the request, or changes or pauses the subscription. The
+// first digest covers the first period that ends after subscribing or
+// changing the frequency.
+func (s *Server) SaveDigestSubscription(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tenant, admin := tenantID(ctx), adminName(ctx)
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	var req digestSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if addr, err := mail.ParseAddress(req.Email); err != nil || addr.Address != req.Email {
+		httpError(w, r, "invalid email", http.StatusBadRequest)
+		return
+	}
+	if !validDigestFrequency(req.Frequency) {
+		httpError(w, r, "frequency must be weekly or monthly", http.StatusBadRequest)
+		return
+	}
+
+	id := digestSubscriptionID(tenant, admin)
+	existing, err := s.DB.GetDigestSubscription(ctx, id)
+	if err != nil {
+		httpError(w, r, "failed to load digest subscription", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "digest_subscription_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	now := s.Clock.Now().UTC()
+	_, periodEnd := digestPeriod(req.Frequency, now)
+	sub := &models.DigestSubscription{
+		ID:          id,
+		TenantID:    tenant,
+		Admin:       admin,
+		Email:       req.Email,
+		Frequency:   req.Frequency,
+		Active:      req.Active,
+		SentThrough: periodEnd,
+		UpdatedAt:   now,
+	}
+	if existing != nil {
+		sub.LastSentAt = existing.LastSentAt
+		if existing.Frequency == req.Frequency {
+			sub.SentThrough = existing.SentThrough
+		}
+	}
+	if err := s.DB.SaveDigestSubscription(ctx, sub); err != nil {
+		httpError(w, r, "failed to save digest subscription", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "digest_subscription_save_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	s.logEvent(ctx, "info", "digest_subscription_saved",
+		fmt.Sprintf("admin %s %s digest (active %t)", admin, sub.Frequency, sub.Active), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(sub)
+}
+
+// PreviewDigest renders the digest of the last ended ?frequency= period
+// (weekly by default) for the tenant of the request without sending it.
+func (s *Server) PreviewDigest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	frequency := r.URL.Query().Get("frequency")
+	if frequency == "" {
+		frequency = models.DigestWeekly
+	}
+	if !validDigestFrequency(frequency) {
+		httpError(w, r, "frequency must be weekly or monthly", http.StatusBadRequest)
+		return
+	}
+
+	from, to := digestPeriod(frequency, s.Clock.Now())
+	sum, err := s.buildDigest(ctx, tenantID(ctx), frequency, from, to)
+	if err != nil {
+		httpError(w, r, "failed to build digest", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "digest_build_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	msg, err := s.renderDigest(ctx, adminName(ctx), sum)
+	if err != nil {
+		httpError(w, r, "failed to build digest", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "digest_build_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(digestPreviewResponse{Summary: *sum, Subject: msg.Subject, HTML: msg.HTML})
+}
@@ -0,0 +1,472 @@
+package api
+
+// disbursement_templates.go keeps the fixed splits admins use to
+// disburse from the zakat pool to the same beneficiaries again and
+// again. A template lists beneficiaries with a percentage each. Executing
+// it with an amount pays every beneficiary its share in a single
+// transaction from the pool, one output each. The pool's key is given
+// with every execution; the server does not keep it.
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+)
+
+const (
+	maxTemplateShares = 100
+
+	// percentTolerance absorbs float error when shares are summed.
+	percentTolerance = 1e-6
+)
+
+type disbursementTemplateRequest struct {
+	Name   string                     `json:"name"`
+	Shares []models.DisbursementShare `json:"shares"`
+}
+
+type disbursementTemplatesResponse struct {
+	Templates []models.DisbursementTemplate `json:"templates"`
+}
+
+type executeTemplateRequest struct {
+	Amount  int    `json:"amount"`
+	PrivKey string `json:"private_key"`   // the zakat pool's key
+	DryRun  bool   `json:"dry_run"`       // compute the payouts without sending
+	PIN     string `json:"pin,omitempty"` // when the pool's owner has a transaction PIN
+}
+
+type templatePayout struct {
+	BeneficiaryID string  `json:"beneficiary_id,omitempty"`
+	WalletAddress string  `json:"wallet_address"`
+	Label         string  `json:"label,omitempty"`
+	Percent       float64 `json:"percent"`
+	Amount        int     `json:"amount"`
+}
+
+type executeTemplateResponse struct {
+	TemplateID  string           `json:"template_id"`
+	PoolAddress string           `json:"pool_address"`
+	Amount      int              `json:"amount"`
+	Payouts     []templatePayout `json:"payouts"`
+	DryRun      bool             `json:"dry_run"`
+	TxID        string           `json:"txid,omitempty"`
+	BlockHash   string           `json:"block_hash,omitempty"`
+	BlockHeight int              `json:"block_height,omitempty"`
+}
+
+// validateShares checks a template's shares and returns the message to
+// report, or "" if they are valid. Wallet addresses of shares naming a
+// beneficiary are filled in by the caller.
+func validateShares(shares []models.DisbursementShare) string {
+	if len(shares) == 0 {
+		return "at least one share is required"
+	}
+	if len(shares) > maxTemplateShares {
+		return "too many shares"
+	}
+	total := 0.0
+	seen := make(map[string]bool, len(shares))
+	for _, sh := range shares {
+		if sh.Percent <= 0 || math.IsNaN(sh.Percent) || math.IsInf(sh.Percent, 0) {
+			return "share percent must be positive"
+		}
+		total += sh.Percent
+		key := "w:" + sh.WalletAddress
+		if sh.BeneficiaryID != "" {
+			key = "b:" + sh.BeneficiaryID
+		} else if !blockchain.ValidateAddress(sh.WalletAddress) {
+			return "invalid address"
+		}
+		if seen[key] {
+			return "duplicate beneficiary in shares"
+		}
+		seen[key] = true
+	}
+	if math.Abs(total-100) > percentTolerance {
+		return "share percentages must add up to 100"
+	}
+	return ""
+}
+
+// splitAmount divides amount by the percentages of shares. Each share
+// gets its rounded-down part; the units left over go one each to the
+// shares with the largest fractions, earlier shares first on ties, so
+// the parts add up to amount exactly.
+func splitAmount(amount int, shares []models.DisbursementShare) []int {
+	total := 0.0
+	for _, sh := range shares {
+		total += sh.Percent
+	}
+	parts := make([]int, len(shares))
+	fracs := make([]float64, len(shares))
+	left := amount
+	for i, sh := range shares {
+		exact := float64(amount) * sh.Percent / total
+		parts[i] = int(math.Floor(exact))
+		fracs[i] = exact - float64(parts[i])
+		left -= parts[i]
+	}
+	order := make([]int, len(shares))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return fracs[order[a]] > fracs[order[b]] })
+	for i := 0; left > 0 && len(order) > 0; i = (i + 1) % len(order) {
+		parts[order[i]]++
+		left--
+	}
+	return parts
+}
+
+// resolveShares fills in the wallet address of every share that names
+// a beneficiary, from the beneficiary's current record. It returns the
+// message to report, or "" on success.
+func (s *Server) resolveShares(r *http.Request, shares []models.DisbursementShare) (string, int, error) {
+	ctx := r.Context()
+	for i := range shares {
+		sh := &shares[i]
+		if sh.BeneficiaryID == "" {
+			continue
+		}
+		b, err := s.DB.GetBeneficiary(ctx, sh.BeneficiaryID)
+		if err != nil {
+			return "failed to load beneficiary", http.StatusInternalServerError, err
+		}
+		if b == nil || (tenantID(ctx) != "" && b.TenantID != tenantID(ctx)) {
+			return "beneficiary not found", http.StatusBadRequest, nil
+		}
+		if !blockchain.ValidateAddress(b.WalletAddress) {
+			return "beneficiary has no wallet", http.StatusBadRequest, nil
+		}
+		sh.WalletAddress = b.WalletAddress
+		if sh.Label == "" {
+			sh.Label = b.FullName
+		}
+	}
+	return "", 0, nil
+}
+
+// decodeTemplateRequest reads and checks a template body. On failure
+// it writes the error response and returns false.
+func (s *Server) decodeTemplateRequest(w http.ResponseWriter, r *http.Request) (disbursementTemplateRequest, bool) {
+	var req disbursementTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return req, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		httpError(w, r, "name is required", http.StatusBadRequest)
+		return req, false
+	}
+	for i := range req.Shares {
+		req.Shares[i].BeneficiaryID = strings.TrimSpace(req.Shares[i].BeneficiaryID)
+		req.Shares[i].Label = strings.TrimSpace(req.Shares[i].Label)
+		if req.Shares[i].BeneficiaryID != "" {
+			// resolved at execution time
+			req.Shares[i].WalletAddress = ""
+		}
+	}
+	if msg := validateShares(req.Shares); msg != "" {
+		httpError(w, r, msg, http.StatusBadRequest)
+		return req, false
+	}
+	// a template naming an unknown beneficiary is refused now rather
+	// than at execution
+	shares := append([]models.DisbursementShare(nil), req.Shares...)
+	if msg, status, err := s.resolveShares(r, shares); msg != "" {
+		httpError(w, r, msg, status)
+		if err != nil {
+			s.logEvent(r.Context(), "error", "beneficiary_get_failed", err.Error(), r.RemoteAddr)
+		}
+		return req, false
+	}
+	return req, true
+}
+
+// tenantTemplate loads the template of the request's {id} when it is
+// visible to the tenant. On failure it writes the error response and
+// returns nil.
+func (s *Server) tenantTemplate(w http.ResponseWriter, r *http.Request) *models.DisbursementTemplate {
+	ctx := r.Context()
+	t, err := s.DB.GetDisbursementTemplate(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, "failed to load disbursement templates", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "disbursement_template_get_failed", err.Error(), r.RemoteAddr)
+		return nil
+	}
+	if t == nil || (tenantID(ctx) != "" && t.TenantID != tenantID(ctx)) {
+		httpError(w, r, "disbursement template not found", http.StatusNotFound)
+		return nil
+	}
+	return t
+}
+
+// CreateDisbursementTemplate stores a template for the tenant.
+func (s *Server) CreateDisbursementTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	req, ok := s.decodeTemplateRequest(w, r)
+	if !ok {
+		return
+	}
+
+	now := s.Clock.Now().UTC()
+	t := &models.DisbursementTemplate{
+		ID:        uuid.NewString(),
+		TenantID:  tenantID(ctx),
+		Name:      req.Name,
+		Shares:    req.Shares,
+		CreatedBy: adminName(ctx),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.DB.CreateDisbursementTemplate(ctx, t); err != nil {
+		httpError(w, r, "failed to save disbursement template", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "disbursement_template_create_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	s.logEvent(ctx, "info", "disbursement_template_created",
+		fmt.Sprintf("disbursement template %s (%s) with %d shares created by %s", t.ID, t.Name, len(t.Shares), adminName(ctx)), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(t)
+}
+
+// ListDisbursementTemplates returns the tenant's templates by name.
+func (s *Server) ListDisbursementTemplates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	templates, err := s.DB.ListDisbursementTemplates(ctx, tenantID(ctx))
+	if err != nil {
+		httpError(w, r, "failed to load disbursement templates", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "disbursement_template_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if templates == nil {
+		templates = []models.DisbursementTemplate{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(disbursementTemplatesResponse{Templates: templates})
+}
+
+// GetDisbursementTemplate returns one template.
+func (s *Server) GetDisbursementTemplate(w http.ResponseWriter, r *http.Request) {
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	t := s.tenantTemplate(w, r)
+	if t == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(t)
+}
+
+// UpdateDisbursementTemplate replaces a template's name and shares.
+func (s *Server) UpdateDisbursementTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	t := s.tenantTemplate(w, r)
+	if t == nil {
+		return
+	}
+	req, ok := s.decodeTemplateRequest(w, r)
+	if !ok {
+		return
+	}
+
+	t.Name, t.Shares, t.UpdatedAt = req.Name, req.Shares, s.Clock.Now().UTC()
+	found, err := s.DB.UpdateDisbursementTemplate(ctx, t)
+	if err != nil {
+		httpError(w, r, "failed to save disbursement template", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "disbursement_template_update_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if !found {
+		httpError(w, r, "disbursement template not found", http.StatusNotFound)
+		return
+	}
+	s.logEvent(ctx, "info", "disbursement_template_updated",
+		fmt.Sprintf("disbursement template %s (%s) updated by %s", t.ID, t.Name, adminName(ctx)), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(t)
+}
+
+// DeleteDisbursementTemplate removes a template.
+func (s *Server) DeleteDisbursementTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	t := s.tenantTemplate(w, r)
+	if t == nil {
+		return
+	}
+	if _, err := s.DB.DeleteDisbursementTemplate(ctx, t.ID); err != nil {
+		httpError(w, r, "failed to delete disbursement template", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "disbursement_template_delete_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	s.logEvent(ctx, "info", "disbursement_template_deleted",
+		fmt.Sprintf("disbursement template %s (%s) deleted by %s", t.ID, t.Name, adminName(ctx)), r.RemoteAddr)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExecuteDisbursementTemplate splits an amount by a template and pays
+// the parts from the tenant's zakat pool in one transaction. With
+// dry_run it only returns the payouts.
+func (s *Server) ExecuteDisbursementTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	var req executeTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Amount <= 0 {
+		httpError(w, r, "amount must be positive", http.StatusBadRequest)
+		return
+	}
+	t := s.tenantTemplate(w, r)
+	if t == nil {
+		return
+	}
+	shares := append([]models.DisbursementShare(nil), t.Shares...)
+	if msg, status, err := s.resolveShares(r, shares); msg != "" {
+		httpError(w, r, msg, status)
+		if err != nil {
+			s.logEvent(ctx, "error", "beneficiary_get_failed", err.Error(), r.RemoteAddr)
+		}
+		return
+	}
+	pool, err := s.zakatAddressFor(ctx, tenantID(ctx))
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := executeTemplateResponse{TemplateID: t.ID, PoolAddress: pool, Amount: req.Amount, DryRun: req.DryRun}
+	payments := make([]blockchain.Payment, 0, len(shares))
+	for i, amount := range splitAmount(req.Amount, shares) {
+		if amount == 0 {
+			httpError(w, r, "amount too small to split", http.StatusBadRequest)
+			return
+		}
+		sh := shares[i]
+		resp.Payouts = append(resp.Payouts, templatePayout{
+			BeneficiaryID: sh.BeneficiaryID,
+			WalletAddress: sh.WalletAddress,
+			Label:         sh.Label,
+			Percent:       sh.Percent,
+			Amount:        amount,
+		})
+		payments = append(payments, blockchain.Payment{To: sh.WalletAddress, Amount: amount})
+	}
+	if req.DryRun {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	dBytes, err := hex.DecodeString(req.PrivKey)
+	if err != nil || len(dBytes) == 0 {
+		httpError(w, r, "invalid private key", http.StatusBadRequest)
+		return
+	}
+	priv := blockchain.BigIntToPrivateKey(dBytes, blockchain.GetDefaultCurve())
+	if !blockchain.KeyControlsAddress(&priv.PublicKey, pool) {
+		s.logEvent(ctx, "warn", "sender_mismatch",
+			fmt.Sprintf("template %s executed with a key of %s, not the pool %s", t.ID, blockchain.AddressOf(&priv.PublicKey), pool), r.RemoteAddr)
+		httpError(w, r, "private key does not match the zakat pool", http.StatusForbidden)
+		return
+	}
+	if !s.requireTransactionPIN(w, r, pool, req.PIN) {
+		return
+	}
+	if denial := s.askPolicyHooks(ctx, s.templateAction(ctx, resp)); denial != nil {
+		httpError(w, r, denial.Reason, http.StatusForbidden)
+		return
+	}
+
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+
+	poolHash, _ := blockchain.DecodeAddress(pool)
+	acc, spendable := s.UTXO.FindSpendableOutputsExcluding(poolHash, req.Amount, s.reservedOutputs())
+	if acc < req.Amount {
+		httpError(w, r, insufficientPoolFunds(pool), http.StatusBadRequest)
+		return
+	}
+	tx, err := blockchain.NewSplitTransaction(priv, payments, s.BC, spendable, poolHash, acc)
+	if err != nil {
+		httpError(w, r, "failed to create transaction", http.StatusBadRequest)
+		return
+	}
+	noteAuditTx(ctx, tx.ID)
+	if !s.BC.VerifyTransaction(tx) {
+		httpError(w, r, "invalid transaction", http.StatusBadRequest)
+		return
+	}
+	if err := s.BC.CheckPolicy(ctx, tx); err != nil {
+		policyError(w, r, err)
+		return
+	}
+	newBlock, err := s.BC.AddBlockContext(ctx, []*blockchain.Transaction{tx})
+	if err != nil {
+		mineError(w, r, err)
+		return
+	}
+	height := len(s.BC.Blocks) - 1
+	s.reports.invalidateBlock(newBlock)
+	_ = s.UTXO.Reindex()
+	s.persistMinedBlock(newBlock, height, []*blockchain.Transaction{tx}, "disbursement")
+
+	resp.TxID = fmt.Sprintf("%x", tx.ID)
+	resp.BlockHash = fmt.Sprintf("%x", newBlock.Hash)
+	resp.BlockHeight = height
+	s.logEvent(ctx, "info", "disbursement_template_executed",
+		fmt.Sprintf("template %s (%s) disbursed %d from %s to %d beneficiaries in tx %s by %s",
+			t.ID, t.Name, req.Amount, pool, len(payments), resp.TxID, adminName(ctx)), r.RemoteAddr)
+	for _, p := range payments {
+		s.notifyIncomingFunds(p.To, p.Amount)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
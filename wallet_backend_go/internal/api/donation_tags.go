@@ -0,0 +1,201 @@
+package api
+
+// donation_tags.go lets users classify the transfers they sent as zakat,
+// sadaqah or another donation and mark them tax-deductible, and builds
+// the year-end tax summary from those tags. Zakat deducted by zakat
+// runs needs no tag: it is always counted, as deductible zakat with its
+// zakat receipt. Each line of the summary carries the receipt to file
+// with the tax return.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/models"
+)
+
+type donationTagRequest struct {
+	Category      string `json:"category"`
+	TaxDeductible bool   `json:"tax_deductible"`
+}
+
+// taxSummaryItem is one donation of the summary.
+type taxSummaryItem struct {
+	Date          time.Time `json:"date"`
+	Source        string    `json:"source"` // tag, zakat_run
+	TxID          string    `json:"txid,omitempty"`
+	ReceiptID     string    `json:"receipt_id,omitempty"` // zakat receipt
+	ReceiptURL    string    `json:"receipt_url"`
+	WalletAddress string    `json:"wallet_address"`
+	Recipient     string    `json:"recipient,omitempty"`
+	Category      string    `json:"category"`
+	TaxDeductible bool      `json:"tax_deductible"`
+	Amount        int       `json:"amount"`
+}
+
+type taxSummaryResponse struct {
+	Year               int              `json:"year"`
+	UserID             string           `json:"user_id"`
+	TotalGiven         int              `json:"total_given"`
+	TotalTaxDeductible int              `json:"total_tax_deductible"`
+	ByCategory         map[string]int   `json:"by_category"`
+	Items              []taxSummaryItem `json:"items"`
+}
+
+func validDonationCategory(c string) bool {
+	return c == models.DonationZakat || c == models.DonationSadaqah || c == models.DonationOther
+}
+
+func txReceiptURL(txid string) string {
+	return fmt.Sprintf("%s/api/v1/transactions/%s/receipt", publicBaseURL(), txid)
+}
+
+// TagTransaction sets the donation category of a transfer sent from
+// one of the session user's wallets.
+func (s *Server) TagTransaction(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	txid := mux.Vars(r)["txid"]
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req donationTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !validDonationCategory(req.Category) {
+		httpError(w, r, "category must be zakat, sadaqah or other", http.StatusBadRequest)
+		return
+	}
+
+	rec, err := s.DB.GetTransactionRecord(ctx, txid)
+	if err != nil {
+		httpError(w, r, "failed to load transaction", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "tx_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if rec == nil || rec.Sender == "" {
+		httpError(w, r, "transaction not found", http.StatusNotFound)
+		return
+	}
+	if rec.Type == "zakat" {
+		httpError(w, r, "zakat deductions are counted without a tag", http.StatusConflict)
+		return
+	}
+	if !s.requireWalletOwner(w, r, rec.Sender) {
+		return
+	}
+
+	tag := &models.DonationTag{
+		TxID:          txid,
+		TenantID:      tenantID(ctx),
+		UserID:        sessionFrom(ctx).Subject,
+		WalletAddress: rec.Sender,
+		Recipient:     rec.Receiver,
+		Amount:        rec.Amount,
+		Category:      req.Category,
+		TaxDeductible: req.TaxDeductible,
+		MinedAt:       time.Unix(rec.Timestamp, 0).UTC(),
+		UpdatedAt:     s.Clock.Now().UTC(),
+	}
+	if err := s.DB.SaveDonationTag(ctx, tag); err != nil {
+		httpError(w, r, "failed to save donation tag", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "donation_tag_save_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(tag)
+}
+
+// TaxSummary adds up the session user's donations of ?year=: their
+// tagged transfers and the zakat deducted from their wallets.
+func (s *Server) TaxSummary(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := sessionFrom(ctx).Subject
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	year, err := strconv.Atoi(r.URL.Query().Get("year"))
+	if err != nil || year < 2000 || year > s.Clock.Now().UTC().Year() {
+		httpError(w, r, "invalid year", http.StatusBadRequest)
+		return
+	}
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0)
+
+	tags, err := s.DB.ListDonationTags(ctx, userID, from, to)
+	if err != nil {
+		httpError(w, r, "failed to load donation tags", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "donation_tag_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	zakat, err := s.DB.ListZakatByUser(ctx, userID)
+	if err != nil {
+		httpError(w, r, "failed to list zakat records", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "zakat_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	resp := taxSummaryResponse{
+		Year:   year,
+		UserID: userID,
+		ByCategory: map[string]int{
+			models.DonationZakat:   0,
+			models.DonationSadaqah: 0,
+			models.DonationOther:   0,
+		},
+		Items: []taxSummaryItem{},
+	}
+	add := func(it taxSummaryItem) {
+		resp.Items = append(resp.Items, it)
+		resp.TotalGiven += it.Amount
+		resp.ByCategory[it.Category] += it.Amount
+		if it.TaxDeductible {
+			resp.TotalTaxDeductible += it.Amount
+		}
+	}
+	for _, t := range tags {
+		add(taxSummaryItem{
+			Date:          t.MinedAt,
+			Source:        "tag",
+			TxID:          t.TxID,
+			ReceiptURL:    txReceiptURL(t.TxID),
+			WalletAddress: t.WalletAddress,
+			Recipient:     t.Recipient,
+			Category:      t.Category,
+			TaxDeductible: t.TaxDeductible,
+			Amount:        t.Amount,
+		})
+	}
+	for _, zr := range zakat {
+		if zr.CreatedAt.Before(from) || !zr.CreatedAt.Before(to) {
+			continue
+		}
+		add(taxSummaryItem{
+			Date:          zr.CreatedAt,
+			Source:        "zakat_run",
+			ReceiptID:     zr.ID,
+			ReceiptURL:    receiptVerifyURL(zr.ID),
+			WalletAddress: zr.WalletAddress,
+			Category:      models.DonationZakat,
+			TaxDeductible: true,
+			Amount:        zr.Amount,
+		})
+	}
+	sort.SliceStable(resp.Items, func(i, j int) bool { return resp.Items[i].Date.Before(resp.Items[j].Date) })
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,337 @@
+package api
+
+// email_templates.go manages the notification email templates (see
+// package templates): admins list them, override the embedded defaults
+// per tenant, preview them with sample or custom data, and set the
+// tenant's branding variables. renderEmail is what senders use to build
+// a message.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/i18n"
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/templates"
+)
+
+// brandKeyPattern restricts branding variable names to what templates
+// can reference as {{.Brand.<key>}}.
+var brandKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// maxBrandValue bounds a single branding value.
+const maxBrandValue = 512
+
+type emailTemplateView struct {
+	Name      string     `json:"name"`
+	Subject   string     `json:"subject"`
+	Body      string     `json:"body"`
+	Source    string     `json:"source"` // embedded, custom
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+type emailTemplatesResponse struct {
+	Templates []emailTemplateView `json:"templates"`
+	Brand     map[string]string   `json:"brand"`
+}
+
+type saveEmailTemplateRequest struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+type previewEmailRequest struct {
+	Subject string            `json:"subject"` // draft to preview instead of the saved template
+	Body    string            `json:"body"`
+	Data    map[string]string `json:"data"` // overrides the sample data
+}
+
+type previewEmailResponse struct {
+	Name    string `json:"name"`
+	Source  string `json:"source"` // embedded, custom, draft
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+}
+
+func emailTemplateID(tenant, name string) string {
+	if tenant == "" {
+		return name
+	}
+	return tenant + "/" + name
+}
+
+// emailTemplates returns every template of the tenant, with its
+// overrides applied.
+func (s *Server) emailTemplates(ctx context.Context, tenant string) ([]emailTemplateView, error) {
+	custom := make(map[string]models.EmailTemplate)
+	if s.DB != nil {
+		rows, err := s.DB.ListEmailTemplates(ctx, tenant)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range rows {
+			custom[t.Name] = t
+		}
+	}
+
+	views := make([]emailTemplateView, 0, len(templates.Names))
+	for _, name := range templates.Names {
+		if t, ok := custom[name]; ok {
+			updated := t.UpdatedAt
+			views = append(views, emailTemplateView{Name: name, Subject: t.Subject, Body: t.Body, Source: "custom", UpdatedAt: &updated})
+			continue
+		}
+		t, err := templates.Default(name)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, emailTemplateView{Name: name, Subject: t.Subject, Body: t.Body, Source: "embedded"})
+	}
+	return views, nil
+}
+
+// emailBrand returns the branding variables of a tenant: the defaults,
+// the organization name (tenant name or RECEIPT_ORGANIZATION) and the
+// tenant's own variables, in increasing precedence.
+func (s *Server) emailBrand(ctx context.Context, tenant string) (map[string]string, error) {
+	vars := map[string]string{"organization_name": os.Getenv("RECEIPT_ORGANIZATION")}
+	if tenant != "" && s.DB != nil {
+		t, err := s.DB.GetTenant(ctx, tenant)
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			vars["organization_name"] = t.Name
+			for k, v := range t.Branding {
+				vars[k] = v
+			}
+		}
+	}
+	return templates.Brand(vars), nil
+}
+
+// renderEmail renders the tenant's template name with data.
+func (s *Server) renderEmail(ctx context.Context, tenant, name string, data map[string]string) (templates.Message, error) {
+	views, err := s.emailTemplates(ctx, tenant)
+	if err != nil {
+		return templates.Message{}, err
+	}
+	brand, err := s.emailBrand(ctx, tenant)
+	if err != nil {
+		return templates.Message{}, err
+	}
+	for _, v := range views {
+		if v.Name == name {
+			return templates.Render(templates.Template{Subject: v.Subject, Body: v.Body}, templates.Context{Brand: brand, Data: data})
+		}
+	}
+	return templates.Message{}, fmt.Errorf("unknown template %q", name)
+}
+
+// ListEmailTemplates returns the tenant's templates and branding.
+func (s *Server) ListEmailTemplates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	views, err := s.emailTemplates(ctx, tenantID(ctx))
+	if err != nil {
+		httpError(w, r, "failed to load email templates", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "email_template_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	brand, err := s.emailBrand(ctx, tenantID(ctx))
+	if err != nil {
+		httpError(w, r, "failed to load email templates", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "email_template_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(emailTemplatesResponse{Templates: views, Brand: brand})
+}
+
+// SaveEmailTemplate overrides a template for the tenant. The template
+// must render with the sample data before it is stored.
+func (s *Server) SaveEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := mux.Vars(r)["name"]
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	if !templates.Known(name) {
+		httpError(w, r, "email template not found", http.StatusNotFound)
+		return
+	}
+
+	var req saveEmailTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Subject) == "" || strings.TrimSpace(req.Body) == "" {
+		httpError(w, r, "subject and body are required", http.StatusBadRequest)
+		return
+	}
+
+	brand, err := s.emailBrand(ctx, tenantID(ctx))
+	if err != nil {
+		httpError(w, r, "failed to save email template", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "email_template_save_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	tmpl := templates.Template{Subject: req.Subject, Body: req.Body}
+	if _, err := templates.Render(tmpl, templates.Context{Brand: brand, Data: templates.SampleData(name)}); err != nil {
+		httpError(w, r, i18n.Tf(lang(r), "invalid template: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	t := &models.EmailTemplate{
+		ID:        emailTemplateID(tenantID(ctx), name),
+		TenantID:  tenantID(ctx),
+		Name:      name,
+		Subject:   req.Subject,
+		Body:      req.Body,
+		UpdatedAt: s.Clock.Now().UTC(),
+	}
+	if err := s.DB.SaveEmailTemplate(ctx, t); err != nil {
+		httpError(w, r, "failed to save email template", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "email_template_save_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	s.logEvent(ctx, "info", "email_template_saved",
+		fmt.Sprintf("email template %s updated", t.ID),
+		r.RemoteAddr,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(emailTemplateView{Name: name, Subject: t.Subject, Body: t.Body, Source: "custom", UpdatedAt: &t.UpdatedAt})
+}
+
+// PreviewEmailTemplate renders a template (or a draft of it) with the
+// sample data, optionally overridden. With ?format=html the page itself
+// is returned so it can be opened in a browser.
+func (s *Server) PreviewEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := mux.Vars(r)["name"]
+
+	if !templates.Known(name) {
+		httpError(w, r, "email template not found", http.StatusNotFound)
+		return
+	}
+
+	var req previewEmailRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, r, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	views, err := s.emailTemplates(ctx, tenantID(ctx))
+	if err != nil {
+		httpError(w, r, "failed to load email templates", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "email_template_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	brand, err := s.emailBrand(ctx, tenantID(ctx))
+	if err != nil {
+		httpError(w, r, "failed to load email templates", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "email_template_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	var tmpl templates.Template
+	source := ""
+	for _, v := range views {
+		if v.Name == name {
+			tmpl, source = templates.Template{Subject: v.Subject, Body: v.Body}, v.Source
+		}
+	}
+	if req.Subject != "" || req.Body != "" {
+		source = "draft"
+		if req.Subject != "" {
+			tmpl.Subject = req.Subject
+		}
+		if req.Body != "" {
+			tmpl.Body = req.Body
+		}
+	}
+
+	data := templates.SampleData(name)
+	for k, v := range req.Data {
+		data[k] = v
+	}
+
+	msg, err := templates.Render(tmpl, templates.Context{Brand: brand, Data: data})
+	if err != nil {
+		httpError(w, r, i18n.Tf(lang(r), "invalid template: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(msg.HTML))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(previewEmailResponse{Name: name, Source: source, Subject: msg.Subject, HTML: msg.HTML})
+}
+
+// SetTenantBranding replaces the email branding variables of a tenant,
+// on behalf of one of its admins (see requireTenantAdmin).
+func (s *Server) SetTenantBranding(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tenant := mux.Vars(r)["id"]
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var vars map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&vars); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	for k, v := range vars {
+		if !brandKeyPattern.MatchString(k) || len(v) > maxBrandValue {
+			httpError(w, r, "invalid branding variable", http.StatusBadRequest)
+			return
+		}
+	}
+
+	found, err := s.DB.UpdateTenantBranding(ctx, tenant, vars)
+	if err != nil {
+		httpError(w, r, "failed to update branding", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "tenant_branding_update_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if !found {
+		httpError(w, r, "tenant not found", http.StatusNotFound)
+		return
+	}
+
+	s.logEvent(ctx, "info", "tenant_branding_updated",
+		fmt.Sprintf("branding of tenant %s updated (%d variables) by %s", tenant, len(vars), tenantActor(ctx)),
+		r.RemoteAddr,
+	)
+
+	brand, err := s.emailBrand(ctx, tenant)
+	if err != nil {
+		brand = templates.Brand(vars)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"tenant_id": tenant, "branding": brand})
+}
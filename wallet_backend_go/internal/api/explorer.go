@@ -0,0 +1,88 @@
+package api
+
+// explorer.go serves aggregate views for the block explorer so that its
+// pages need a single call each. Address pages read the address index,
+// which is brought up to date with the chain on every request.
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+const (
+	defaultExplorerPageSize = 25
+	maxExplorerPageSize     = 100
+)
+
+type explorerAddressResponse struct {
+	blockchain.AddressSummary
+	Transactions []blockchain.AddressTx `json:"transactions"`
+	Offset       int                    `json:"offset"`
+	Limit        int                    `json:"limit"`
+	NextOffset   *int                   `json:"next_offset,omitempty"` // set while more transactions follow
+}
+
+// syncAddressIndex indexes the blocks mined since the last call.
+func (s *Server) syncAddressIndex() {
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+	s.addrs.Sync(s.BC.Blocks)
+}
+
+// pageParams reads ?offset= and ?limit= (1 to maxExplorerPageSize).
+func pageParams(r *http.Request) (offset, limit int, ok bool) {
+	offset, limit = 0, defaultExplorerPageSize
+	q := r.URL.Query()
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, false
+		}
+		offset = n
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxExplorerPageSize {
+			return 0, 0, false
+		}
+		limit = n
+	}
+	return offset, limit, true
+}
+
+// ExplorerAddress returns the balance, totals, first and last seen
+// heights and a page of the most recent transactions of an address.
+func (s *Server) ExplorerAddress(w http.ResponseWriter, r *http.Request) {
+	address := mux.Vars(r)["address"]
+	pubKeyHash, err := blockchain.DecodeAddress(address)
+	if err != nil {
+		httpError(w, r, "invalid address", http.StatusBadRequest)
+		return
+	}
+	address = blockchain.EncodeAddress(pubKeyHash) // the index keys are canonical
+	offset, limit, ok := pageParams(r)
+	if !ok {
+		httpError(w, r, "invalid offset or limit", http.StatusBadRequest)
+		return
+	}
+
+	s.syncAddressIndex()
+	summary, txs := s.addrs.Address(address, offset, limit)
+
+	resp := explorerAddressResponse{
+		AddressSummary: summary,
+		Transactions:   txs,
+		Offset:         offset,
+		Limit:          limit,
+	}
+	if next := offset + len(txs); next < summary.TxCount {
+		resp.NextOffset = &next
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,260 @@
+package api
+
+// explorer_charts.go aggregates chain activity into time series for the
+// explorer's charts: daily transactions, active addresses and block
+// intervals, and monthly zakat collected by the pool. Series cover a
+// window ending now, have one point per bucket (empty buckets included)
+// and are computed from the tail of the chain, which is ordered by
+// time, so only the blocks inside the window are read.
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+// Chart metrics.
+const (
+	chartTransactions   = "transactions_per_day"
+	chartActiveAddrs    = "active_addresses"
+	chartBlockInterval  = "block_interval"
+	chartZakatCollected = "zakat_collected_per_month"
+)
+
+const (
+	maxChartDays   = 366
+	maxChartMonths = 120
+)
+
+type chartPoint struct {
+	Bucket string  `json:"bucket"` // YYYY-MM-DD or YYYY-MM
+	Value  float64 `json:"value"`
+}
+
+type chartResponse struct {
+	Metric string       `json:"metric"`
+	Window string       `json:"window"`
+	Unit   string       `json:"unit"` // day, month
+	From   time.Time    `json:"from"`
+	To     time.Time    `json:"to"`
+	Points []chartPoint `json:"points"`
+}
+
+// chartBuckets are the n day or month buckets of a window, the first
+// starting at start.
+type chartBuckets struct {
+	monthly bool
+	start   time.Time
+	n       int
+}
+
+func (b chartBuckets) index(t time.Time) int {
+	t = t.UTC()
+	if b.monthly {
+		return (t.Year()-b.start.Year())*12 + int(t.Month()-b.start.Month())
+	}
+	return int(t.Sub(b.start) / (24 * time.Hour))
+}
+
+func (b chartBuckets) label(i int) string {
+	if b.monthly {
+		return b.start.AddDate(0, i, 0).Format("2006-01")
+	}
+	return b.start.AddDate(0, 0, i).Format("2006-01-02")
+}
+
+// parseChartWindow parses ?window= as "<n>d" or "<n>m" (days or months)
+// into buckets of the metric's unit ending with the bucket of now.
+func parseChartWindow(window string, monthly bool, now time.Time) (chartBuckets, bool) {
+	if len(window) < 2 {
+		return chartBuckets{}, false
+	}
+	n, err := strconv.Atoi(window[:len(window)-1])
+	if err != nil || n <= 0 {
+		return chartBuckets{}, false
+	}
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	// the window ends with today's bucket and starts on from
+	var from time.Time
+	switch window[len(window)-1] {
+	case 'd':
+		from = today.AddDate(0, 0, -(n - 1))
+	case 'm':
+		from = time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -(n - 1), 0)
+		if !monthly {
+			from = today.AddDate(0, -n, 1)
+		}
+	default:
+		return chartBuckets{}, false
+	}
+
+	b := chartBuckets{monthly: monthly, start: from}
+	limit := maxChartDays
+	if monthly {
+		b.start = time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+		limit = maxChartMonths
+	}
+	b.n = b.index(today) + 1
+	return b, b.n <= limit
+}
+
+// ExplorerChart returns the series of a chart metric over ?window=
+// (default 30d for daily metrics, 12m for zakat collected).
+func (s *Server) ExplorerChart(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	metric := mux.Vars(r)["metric"]
+
+	monthly := false
+	window := r.URL.Query().Get("window")
+	switch metric {
+	case chartTransactions, chartActiveAddrs, chartBlockInterval:
+		if window == "" {
+			window = "30d"
+		}
+	case chartZakatCollected:
+		monthly = true
+		if window == "" {
+			window = "12m"
+		}
+	default:
+		httpError(w, r, "unknown chart metric", http.StatusNotFound)
+		return
+	}
+
+	buckets, ok := parseChartWindow(strings.ToLower(window), monthly, s.Clock.Now())
+	if !ok {
+		httpError(w, r, "invalid window", http.StatusBadRequest)
+		return
+	}
+
+	var pool string
+	if metric == chartZakatCollected {
+		var err error
+		pool, err = s.zakatAddressFor(ctx, tenantID(ctx))
+		if err != nil {
+			httpError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// blocks are appended in time order: walk back to the window start
+	// and one block further, which block intervals are measured from
+	s.chainMu.Lock()
+	first := len(s.BC.Blocks)
+	for first > 0 && !time.Unix(s.BC.Blocks[first-1].Timestamp, 0).Before(buckets.start) {
+		first--
+	}
+	if first > 0 {
+		first--
+	}
+	blocks := append([]*blockchain.Block(nil), s.BC.Blocks[first:]...)
+	s.chainMu.Unlock()
+
+	values := make([]float64, buckets.n)
+	switch metric {
+	case chartTransactions:
+		forBlocksInWindow(blocks, buckets, func(i int, _ int, b *blockchain.Block) {
+			for _, tx := range b.Transactions {
+				if !tx.IsCoinbase() {
+					values[i]++
+				}
+			}
+		})
+	case chartActiveAddrs:
+		active := make([]map[string]bool, buckets.n)
+		forBlocksInWindow(blocks, buckets, func(i int, _ int, b *blockchain.Block) {
+			if active[i] == nil {
+				active[i] = make(map[string]bool)
+			}
+			for _, tx := range b.Transactions {
+				if !tx.IsCoinbase() {
+					for _, in := range tx.Vin {
+						active[i][blockchain.PubKeyAddress(in.PubKey)] = true
+					}
+				}
+				for _, out := range tx.Vout {
+					active[i][blockchain.EncodeAddress(out.Owner())] = true
+				}
+			}
+		})
+		for i, set := range active {
+			values[i] = float64(len(set))
+		}
+	case chartBlockInterval:
+		counts := make([]int, buckets.n)
+		forBlocksInWindow(blocks, buckets, func(i int, j int, b *blockchain.Block) {
+			if j == 0 {
+				return
+			}
+			values[i] += float64(b.Timestamp - blocks[j-1].Timestamp)
+			counts[i]++
+		})
+		for i, n := range counts {
+			if n > 0 {
+				values[i] /= float64(n)
+			}
+		}
+	case chartZakatCollected:
+		forBlocksInWindow(blocks, buckets, func(i int, _ int, b *blockchain.Block) {
+			for _, tx := range b.Transactions {
+				if tx.IsCoinbase() || spendsFrom(tx, pool) {
+					continue
+				}
+				for _, out := range tx.Vout {
+					if blockchain.EncodeAddress(out.Owner()) == pool {
+						values[i] += float64(out.Value)
+					}
+				}
+			}
+		})
+	}
+
+	resp := chartResponse{
+		Metric: metric,
+		Window: window,
+		Unit:   "day",
+		From:   buckets.start,
+		To:     s.Clock.Now().UTC(),
+		Points: make([]chartPoint, buckets.n),
+	}
+	if monthly {
+		resp.Unit = "month"
+	}
+	for i := range resp.Points {
+		resp.Points[i] = chartPoint{Bucket: buckets.label(i), Value: values[i]}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// forBlocksInWindow calls fn with the bucket and position of each block
+// that falls into the window.
+func forBlocksInWindow(blocks []*blockchain.Block, buckets chartBuckets, fn func(bucket, j int, b *blockchain.Block)) {
+	for j, b := range blocks {
+		ts := time.Unix(b.Timestamp, 0)
+		if ts.Before(buckets.start) {
+			continue
+		}
+		if i := buckets.index(ts); i < buckets.n {
+			fn(i, j, b)
+		}
+	}
+}
+
+// spendsFrom reports whether one of tx's inputs is signed by address.
+func spendsFrom(tx *blockchain.Transaction, address string) bool {
+	for _, in := range tx.Vin {
+		if blockchain.SameAddress(blockchain.PubKeyAddress(in.PubKey), address) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,253 @@
+package api
+
+// faucet.go is the public testnet faucet. When NETWORK=testnet the
+// server exposes POST /faucet, which mines a coinbase transaction of a
+// small fixed amount (FAUCET_AMOUNT) to the requested address. Each
+// address can be dripped once per faucetWindow, and when
+// FAUCET_CAPTCHA_SECRET is set every request must carry a CAPTCHA token
+// that the provider's siteverify endpoint accepts.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+const (
+	// faucetWindow is how long an address waits between drips.
+	faucetWindow = 24 * time.Hour
+
+	defaultFaucetAmount     = 100
+	defaultCaptchaVerifyURL = "https://hcaptcha.com/siteverify"
+)
+
+// testnetMode reports whether the server runs as a public testnet.
+func testnetMode() bool {
+	return strings.EqualFold(os.Getenv("NETWORK"), "testnet")
+}
+
+// faucetAmount returns the units paid per drip (FAUCET_AMOUNT).
+func faucetAmount() int {
+	n, err := strconv.Atoi(os.Getenv("FAUCET_AMOUNT"))
+	if err != nil || n <= 0 {
+		return defaultFaucetAmount
+	}
+	return n
+}
+
+type faucetRequest struct {
+	Address      string `json:"address"`
+	CaptchaToken string `json:"captcha_token"`
+}
+
+type faucetResponse struct {
+	Address    string    `json:"address"`
+	Amount     int       `json:"amount"`
+	BlockHash  string    `json:"block_hash"`
+	NextDripAt time.Time `json:"next_drip_at"`
+}
+
+// faucetLimiter remembers when each address was last dripped.
+type faucetLimiter struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// reserve claims a drip for address. It returns false and the time the
+// address may try again if it was dripped within the window.
+func (l *faucetLimiter) reserve(address string, now time.Time) (bool, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.last == nil {
+		l.last = make(map[string]time.Time)
+	}
+	if t, ok := l.last[address]; ok && now.Sub(t) < faucetWindow {
+		return false, t.Add(faucetWindow)
+	}
+
+	// drop expired entries so the map does not grow without bound
+	for a, t := range l.last {
+		if now.Sub(t) >= faucetWindow {
+			delete(l.last, a)
+		}
+	}
+	l.last[address] = now
+	return true, now.Add(faucetWindow)
+}
+
+// release gives back a drip reserved for address that was not paid.
+func (l *faucetLimiter) release(address string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.last, address)
+}
+
+// verifyCaptcha checks token with the CAPTCHA provider. hCaptcha,
+// reCAPTCHA and Turnstile share the siteverify protocol, selected with
+// FAUCET_CAPTCHA_VERIFY_URL.
+func verifyCaptcha(ctx context.Context, secret, token, remoteIP string) (bool, error) {
+	verifyURL := os.Getenv("FAUCET_CAPTCHA_VERIFY_URL")
+	if verifyURL == "" {
+		verifyURL = defaultCaptchaVerifyURL
+	}
+
+	form := url.Values{"secret": {secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return false, fmt.Errorf("captcha verify error: %s", resp.Status)
+	}
+
+	var out struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return false, err
+	}
+	return out.Success, nil
+}
+
+// logFaucetConfig warns at startup when the faucet runs without CAPTCHA.
+func logFaucetConfig() {
+	if os.Getenv("FAUCET_CAPTCHA_SECRET") == "" {
+		log.Println("warning: testnet faucet enabled without FAUCET_CAPTCHA_SECRET, requests are not CAPTCHA checked")
+	}
+}
+
+// Faucet drips testnet funds to an address.
+func (s *Server) Faucet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if !s.requireFlag(w, r, flagFaucet) {
+		return
+	}
+
+	var req faucetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !blockchain.ValidateAddress(req.Address) {
+		httpError(w, r, "invalid address", http.StatusBadRequest)
+		return
+	}
+
+	if secret := os.Getenv("FAUCET_CAPTCHA_SECRET"); secret != "" {
+		if req.CaptchaToken == "" {
+			httpError(w, r, "captcha_token is required", http.StatusBadRequest)
+			return
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		ok, err := verifyCaptcha(ctx, secret, req.CaptchaToken, host)
+		if err != nil {
+			httpError(w, r, "captcha verification failed", http.StatusBadGateway)
+			if s.DB != nil {
+				s.logEvent(ctx, "error", "faucet_captcha_failed", err.Error(), r.RemoteAddr)
+			}
+			return
+		}
+		if !ok {
+			httpError(w, r, "invalid captcha", http.StatusForbidden)
+			return
+		}
+	}
+
+	reserved, next := s.faucet.reserve(req.Address, s.Clock.Now().UTC())
+	if !reserved {
+		w.Header().Set("Retry-After", strconv.Itoa(int(next.Sub(s.Clock.Now()).Seconds())+1))
+		httpError(w, r, "address was funded in the last 24 hours", http.StatusTooManyRequests)
+		return
+	}
+	// the window is shared by every instance
+	claim, claimed, err := s.reserveFaucetDrip(ctx, req.Address)
+	if err != nil {
+		s.faucet.release(req.Address)
+		httpError(w, r, "lock service unavailable", http.StatusServiceUnavailable)
+		if s.DB != nil {
+			s.logEvent(ctx, "error", "lock_failed", err.Error(), r.RemoteAddr)
+		}
+		return
+	}
+	if !claimed {
+		s.faucet.release(req.Address)
+		httpError(w, r, "address was funded in the last 24 hours", http.StatusTooManyRequests)
+		return
+	}
+
+	amount := faucetAmount()
+	cbTx := blockchain.NewFaucetTx(req.Address, amount)
+	noteAuditTx(ctx, cbTx.ID)
+
+	s.chainMu.Lock()
+	newBlock, err := s.BC.AddBlockContext(ctx, []*blockchain.Transaction{cbTx})
+	if err != nil {
+		s.chainMu.Unlock()
+		s.faucet.release(req.Address)
+		s.releaseFaucetDrip(req.Address, claim)
+		mineError(w, r, err)
+		return
+	}
+	height := len(s.BC.Blocks) - 1
+	s.reports.invalidateBlock(newBlock)
+	_ = s.UTXO.Reindex()
+	s.chainMu.Unlock()
+
+	blockHashHex := fmt.Sprintf("%x", newBlock.Hash)
+
+	if s.DB != nil {
+		mined := []*blockchain.Transaction{cbTx}
+		s.persistence.start(newBlock, mined, "faucet", s.Clock.Now())
+		var persistErr error
+		if err := s.DB.SaveBlock(ctx, height, newBlock); err != nil {
+			s.logEvent(ctx, "error", "faucet_save_block_failed", err.Error(), r.RemoteAddr)
+			persistErr = err
+		}
+		if err := s.DB.SaveTransaction(ctx, blockHashHex, cbTx, "SYSTEM", req.Address, amount, "faucet"); err != nil {
+			s.logEvent(ctx, "error", "faucet_save_tx_failed", err.Error(), r.RemoteAddr)
+			persistErr = err
+		}
+		s.persistence.finish(mined, persistErr, s.Clock.Now())
+		s.reports.invalidateBlock(newBlock)
+		s.logEvent(ctx, "info", "testnet_faucet",
+			fmt.Sprintf("dripped %d to %s", amount, req.Address),
+			r.RemoteAddr,
+		)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(faucetResponse{
+		Address:    req.Address,
+		Amount:     amount,
+		BlockHash:  blockHashHex,
+		NextDripAt: next,
+	})
+}
@@ -0,0 +1,490 @@
+package api
+
+// feed.go pushes chain events to clients as they happen so that the
+// frontend need not poll /blocks: a block joining the chain, each of
+// its transactions, a zakat deduction and funds arriving in a wallet.
+// GET /ws serves the feed over a WebSocket when the request asks for an
+// upgrade and as server-sent events otherwise. Clients may narrow it to
+// some addresses (?address=) and event types (?types=). Events carry
+// only what the chain and the public receipts already show, so the feed
+// needs no session, like the explorer.
+//
+// The WebSocket side is the small part of RFC 6455 a push feed needs:
+// the handshake, unfragmented text frames out, and close and ping
+// frames in. A client that falls a whole buffer behind is dropped
+// rather than allowed to slow down mining, which publishes the events.
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+const (
+	defaultFeedClients = 500
+	feedMaxAddresses   = 50
+	feedBuffer         = 64 // events queued per client before it is dropped
+	feedHeartbeat      = 30 * time.Second
+
+	wsGUID         = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsMaxFrame     = 4096 // largest frame accepted from a client
+	wsWriteTimeout = 10 * time.Second
+)
+
+// Feed event types.
+const (
+	feedBlock          = "block"
+	feedTransaction    = "transaction"
+	feedZakatDeduction = "zakat_deduction"
+	feedWalletFunded   = "wallet_funded"
+)
+
+var feedTypes = map[string]bool{
+	feedBlock:          true,
+	feedTransaction:    true,
+	feedZakatDeduction: true,
+	feedWalletFunded:   true,
+}
+
+// WebSocket opcodes.
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+	wsPing  = 0x9
+	wsPong  = 0xa
+)
+
+// feedEvent is one event of the feed. Which fields are set depends on
+// the type.
+type feedEvent struct {
+	Seq       uint64 `json:"seq"`
+	Type      string `json:"type"`
+	Height    *int   `json:"height,omitempty"`
+	BlockHash string `json:"block_hash,omitempty"`
+	TxCount   int    `json:"tx_count,omitempty"`
+	TxID      string `json:"txid,omitempty"`
+	TxType    string `json:"tx_type,omitempty"` // send, reward, fee
+	Sender    string `json:"sender,omitempty"`
+	Receiver  string `json:"receiver,omitempty"`
+	Address   string `json:"wallet_address,omitempty"`
+	Amount    int    `json:"amount,omitempty"`
+	ReceiptID string `json:"receipt_id,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+
+	// addresses are the canonical addresses the event concerns.
+	addresses []string
+}
+
+// feedClient is one connected client and its filters.
+type feedClient struct {
+	types     map[string]bool // nil for every type
+	addresses map[string]bool // canonical; nil for every address
+	events    chan feedEvent  // closed when the client is dropped
+	// shutdown is set before events is closed when the server stops.
+	shutdown bool
+}
+
+func (c *feedClient) wants(ev feedEvent) bool {
+	if c.types != nil && !c.types[ev.Type] {
+		return false
+	}
+	if c.addresses == nil {
+		return true
+	}
+	for _, a := range ev.addresses {
+		if c.addresses[a] {
+			return true
+		}
+	}
+	return false
+}
+
+// eventFeed fans the events out to the connected clients.
+type eventFeed struct {
+	mu      sync.Mutex
+	seq     uint64
+	clients map[*feedClient]bool
+}
+
+// subscribe adds c, or reports false when FEED_MAX_CLIENTS (default
+// 500) are connected already.
+func (f *eventFeed) subscribe(c *feedClient) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.clients) >= envLimit("FEED_MAX_CLIENTS", defaultFeedClients) {
+		return false
+	}
+	if f.clients == nil {
+		f.clients = make(map[*feedClient]bool)
+	}
+	f.clients[c] = true
+	return true
+}
+
+func (f *eventFeed) unsubscribe(c *feedClient) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.clients[c] {
+		delete(f.clients, c)
+		close(c.events)
+	}
+}
+
+// closeAll drops every client because the server is stopping.
+func (f *eventFeed) closeAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for c := range f.clients {
+		delete(f.clients, c)
+		c.shutdown = true
+		close(c.events)
+	}
+}
+
+// CloseFeed disconnects the clients of GET /ws, which would otherwise
+// keep a shutting-down HTTP server waiting for as long as they listen.
+func (s *Server) CloseFeed() {
+	s.feed.closeAll()
+}
+
+// publish queues ev for every client that wants it without waiting on
+// any of them.
+func (f *eventFeed) publish(ev feedEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	ev.Seq = f.seq
+	for c := range f.clients {
+		if !c.wants(ev) {
+			continue
+		}
+		select {
+		case c.events <- ev:
+		default:
+			delete(f.clients, c)
+			close(c.events)
+		}
+	}
+}
+
+// publishBlock publishes a block joining the chain and its
+// transactions. It is the chain's OnBlock hook.
+func (f *eventFeed) publishBlock(height int, b *blockchain.Block) {
+	hash := hex.EncodeToString(b.Hash)
+	block := feedEvent{Type: feedBlock, Height: &height, BlockHash: hash, TxCount: len(b.Transactions), Timestamp: b.Timestamp}
+	var txEvents []feedEvent
+	for _, tx := range b.Transactions {
+		sender, receiver, amount, txType := txParties(tx)
+		ev := feedEvent{
+			Type:      feedTransaction,
+			Height:    &height,
+			BlockHash: hash,
+			TxID:      hex.EncodeToString(tx.ID),
+			TxType:    txType,
+			Sender:    sender,
+			Receiver:  receiver,
+			Amount:    amount,
+			Timestamp: b.Timestamp,
+		}
+		for _, a := range []string{sender, receiver} {
+			if a != "" && a != "SYSTEM" {
+				ev.addresses = append(ev.addresses, blockchain.CanonicalAddress(a))
+			}
+		}
+		block.addresses = append(block.addresses, ev.addresses...)
+		txEvents = append(txEvents, ev)
+	}
+	f.publish(block)
+	for _, ev := range txEvents {
+		f.publish(ev)
+	}
+}
+
+// Feed streams the events matching the request's filters until the
+// client goes away: over a WebSocket when asked for one, as
+// server-sent events otherwise.
+func (s *Server) Feed(w http.ResponseWriter, r *http.Request) {
+	c := &feedClient{events: make(chan feedEvent, feedBuffer)}
+	q := r.URL.Query()
+
+	for _, v := range q["address"] {
+		for _, a := range strings.Split(v, ",") {
+			if a = strings.TrimSpace(a); a == "" {
+				continue
+			}
+			if _, err := blockchain.DecodeAddress(a); err != nil {
+				httpError(w, r, "invalid address", http.StatusBadRequest)
+				return
+			}
+			if c.addresses == nil {
+				c.addresses = make(map[string]bool)
+			}
+			c.addresses[blockchain.CanonicalAddress(a)] = true
+		}
+	}
+	if len(c.addresses) > feedMaxAddresses {
+		httpError(w, r, "too many addresses", http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("types"); v != "" {
+		c.types = make(map[string]bool)
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if !feedTypes[t] {
+				httpError(w, r, "unknown event type", http.StatusBadRequest)
+				return
+			}
+			c.types[t] = true
+		}
+	}
+
+	if websocketRequested(r) {
+		s.serveWebSocket(w, r, c)
+		return
+	}
+	s.serveEventStream(w, r, c)
+}
+
+// serveEventStream writes the events as server-sent events, each with
+// its sequence number as id, and a comment line as heartbeat.
+func (s *Server) serveEventStream(w http.ResponseWriter, r *http.Request, c *feedClient) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httpError(w, r, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	if !s.feed.subscribe(c) {
+		httpError(w, r, "too many feed clients", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.feed.unsubscribe(c)
+
+	// the stream outlives the HTTP server's write timeout
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(feedHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case ev, ok := <-c.events:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(ev)
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Type, data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// websocketRequested reports whether r asks to upgrade to a WebSocket.
+func websocketRequested(r *http.Request) bool {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, v := range strings.Split(r.Header.Get("Connection"), ",") {
+		if strings.EqualFold(strings.TrimSpace(v), "upgrade") {
+			return true
+		}
+	}
+	return false
+}
+
+// serveWebSocket completes the handshake and writes each event as a
+// JSON text message, pinging the client on every heartbeat. A client
+// that neither answers nor sends anything for two heartbeats is
+// disconnected.
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request, c *feedClient) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		httpError(w, r, "unsupported websocket handshake", http.StatusBadRequest)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		httpError(w, r, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	if !s.feed.subscribe(c) {
+		httpError(w, r, "too many feed clients", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.feed.unsubscribe(c)
+
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	// the HTTP server's read and write deadlines stay on the hijacked
+	// connection; the feed sets its own
+	_ = conn.SetDeadline(time.Time{})
+	accept := sha1.Sum([]byte(key + wsGUID))
+	ws := &wsConn{conn: conn}
+	if err := ws.send([]byte("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(accept[:]) + "\r\n\r\n")); err != nil {
+		return
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		ws.readLoop(rw.Reader)
+		close(closed)
+	}()
+
+	heartbeat := time.NewTicker(feedHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case ev, ok := <-c.events:
+			if !ok {
+				// 1001 going away when the server stops, otherwise
+				// dropped for falling behind: 1008 policy violation
+				code := []byte{0x03, 0xf0}
+				if c.shutdown {
+					code = []byte{0x03, 0xe9}
+				}
+				_ = ws.writeFrame(wsClose, code)
+				return
+			}
+			data, _ := json.Marshal(ev)
+			if err := ws.writeFrame(wsText, data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := ws.writeFrame(wsPing, nil); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// wsConn is the server side of a WebSocket connection.
+type wsConn struct {
+	mu   sync.Mutex // serializes writes of the feed and the read loop
+	conn net.Conn
+}
+
+func (ws *wsConn) send(b []byte) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	// socket deadlines are wall-clock time, whatever s.Clock says
+	_ = ws.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err := ws.conn.Write(b)
+	return err
+}
+
+// writeFrame writes one unmasked, unfragmented frame.
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	return ws.send(append(frame, payload...))
+}
+
+// readLoop reads the client's frames until the connection fails or
+// closes, answering pings and echoing the close. Data frames are
+// ignored; the filters are fixed at connection time.
+func (ws *wsConn) readLoop(br *bufio.Reader) {
+	for {
+		_ = ws.conn.SetReadDeadline(time.Now().Add(2 * feedHeartbeat))
+		opcode, payload, err := readFrame(br)
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case wsClose:
+			_ = ws.writeFrame(wsClose, payload)
+			return
+		case wsPing:
+			if err := ws.writeFrame(wsPong, payload); err != nil {
+				return
+			}
+		}
+	}
+}
+
+var errFrame = errors.New("malformed websocket frame")
+
+// readFrame reads one frame from a client, which must mask it, and
+// returns it unmasked.
+func readFrame(br *bufio.Reader) (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(br, head[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := head[0] & 0x0f
+	if head[1]&0x80 == 0 {
+		return 0, nil, errFrame
+	}
+	n := uint64(head[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxFrame {
+		return 0, nil, errFrame
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(br, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
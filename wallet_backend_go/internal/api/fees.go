@@ -0,0 +1,52 @@
+package api
+
+// fees.go records the fees senders add to their sends. A fee is left
+// out of the change, so the inputs of the transaction hold it beyond
+// the outputs; the block that mines the transaction starts with a
+// coinbase paying the fees of all its transactions to FEE_ADDRESS (see
+// Blockchain.FeeAddress). That coinbase is stored as a "fee"
+// transaction from SYSTEM alongside the transactions it collected from.
+
+import (
+	"context"
+	"encoding/json"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/db"
+)
+
+// feeCoinbase returns the coinbase collecting the fees of b, or nil if
+// it has none.
+func feeCoinbase(b *blockchain.Block) *blockchain.Transaction {
+	if len(b.Transactions) > 0 && b.Transactions[0].IsFeeCoinbase() {
+		return b.Transactions[0]
+	}
+	return nil
+}
+
+// addFeeRecord queues the transaction row of b's fee coinbase, if any.
+func addFeeRecord(ctx context.Context, batch *db.Batch, blockHash string, b *blockchain.Block) error {
+	cb := feeCoinbase(b)
+	if cb == nil {
+		return nil
+	}
+	sender, receiver, amount, txType := txParties(cb)
+	return batch.AddTransaction(ctx, blockHash, cb, sender, receiver, amount, txType)
+}
+
+// feesPaid adds up the fees of the transactions address sent, read
+// from their stored form and priced against the chain.
+func (s *Server) feesPaid(address string, txs []db.TransactionRecord) int {
+	total := 0
+	for _, t := range txs {
+		if !blockchain.SameAddress(t.Sender, address) || len(t.RawJSON) == 0 {
+			continue
+		}
+		var tx blockchain.Transaction
+		if err := json.Unmarshal(t.RawJSON, &tx); err != nil {
+			continue
+		}
+		total += s.BC.TxFee(&tx)
+	}
+	return total
+}
@@ -0,0 +1,226 @@
+package api
+
+// flags.go is a lightweight feature-flag subsystem for gating risky
+// features without redeploying. Flags are stored in the feature_flags
+// table per environment (APP_ENV) and optionally per tenant: a tenant
+// row overrides the environment row, which overrides the flag's
+// built-in default. Rows are cached for flagCacheTTL, so a toggle
+// reaches other instances within that time; the instance handling the
+// toggle sees it immediately.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/models"
+)
+
+// flagCacheTTL bounds how long a stored toggle can go unnoticed.
+const flagCacheTTL = 30 * time.Second
+
+// Feature flags.
+const (
+	flagFaucet       = "faucet"
+	flagOfflineBatch = "offline_batch"
+	flagAutoZakat    = "auto_zakat"
+)
+
+type flagSpec struct {
+	Default     bool
+	Description string
+}
+
+// knownFlags lists every flag with its default when nothing is stored.
+// Toggling a flag that is not listed here is rejected.
+var knownFlags = map[string]flagSpec{
+	flagFaucet:       {Default: true, Description: "testnet faucet (POST /faucet, NETWORK=testnet only)"},
+	flagOfflineBatch: {Default: true, Description: "offline transaction batches (POST /transactions/offline-batch)"},
+	flagAutoZakat:    {Default: true, Description: "pay zakat as you earn on incoming transfers"},
+}
+
+// appEnvironment names the environment flags are stored for (APP_ENV,
+// default "development").
+func appEnvironment() string {
+	if env := os.Getenv("APP_ENV"); env != "" {
+		return env
+	}
+	return "development"
+}
+
+func flagID(environment, tenant, key string) string {
+	return environment + "/" + tenant + "/" + key
+}
+
+// flagCache holds the stored flags of this environment.
+type flagCache struct {
+	mu       sync.Mutex
+	rows     map[string]models.FeatureFlag // by id
+	loadedAt time.Time
+}
+
+func (c *flagCache) invalidate() {
+	c.mu.Lock()
+	c.loadedAt = time.Time{}
+	c.mu.Unlock()
+}
+
+// flagRows returns the stored flags, reloading them when the cache has
+// expired. If Supabase cannot be reached the stale rows are kept.
+func (s *Server) flagRows(ctx context.Context) map[string]models.FeatureFlag {
+	if s.DB == nil {
+		return nil
+	}
+
+	s.flags.mu.Lock()
+	defer s.flags.mu.Unlock()
+
+	if s.Clock.Now().Sub(s.flags.loadedAt) < flagCacheTTL {
+		return s.flags.rows
+	}
+
+	rows, err := s.DB.ListFeatureFlags(ctx, appEnvironment())
+	if err != nil {
+		log.Printf("failed to load feature flags: %v", err)
+		return s.flags.rows
+	}
+	s.flags.rows = make(map[string]models.FeatureFlag, len(rows))
+	for _, f := range rows {
+		s.flags.rows[f.ID] = f
+	}
+	s.flags.loadedAt = s.Clock.Now()
+	return s.flags.rows
+}
+
+// resolveFlag returns whether key is enabled for tenant and where the
+// value comes from: "tenant", "environment" or "default".
+func (s *Server) resolveFlag(ctx context.Context, tenant, key string) (bool, string) {
+	rows := s.flagRows(ctx)
+	env := appEnvironment()
+	if tenant != "" {
+		if f, ok := rows[flagID(env, tenant, key)]; ok {
+			return f.Enabled, "tenant"
+		}
+	}
+	if f, ok := rows[flagID(env, "", key)]; ok {
+		return f.Enabled, "environment"
+	}
+	return knownFlags[key].Default, "default"
+}
+
+// flagEnabled reports whether key is enabled for tenant.
+func (s *Server) flagEnabled(ctx context.Context, tenant, key string) bool {
+	enabled, _ := s.resolveFlag(ctx, tenant, key)
+	return enabled
+}
+
+// requireFlag writes 403 and returns false when key is disabled for the
+// requesting tenant.
+func (s *Server) requireFlag(w http.ResponseWriter, r *http.Request, key string) bool {
+	if s.flagEnabled(r.Context(), tenantID(r.Context()), key) {
+		return true
+	}
+	httpError(w, r, "feature is disabled", http.StatusForbidden)
+	return false
+}
+
+type featureFlagView struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	Source      string `json:"source"` // tenant, environment or default
+}
+
+type featureFlagsResponse struct {
+	Environment string            `json:"environment"`
+	TenantID    string            `json:"tenant_id,omitempty"`
+	Flags       []featureFlagView `json:"flags"`
+}
+
+type setFeatureFlagRequest struct {
+	Enabled   *bool  `json:"enabled"`
+	UpdatedBy string `json:"updated_by"`
+}
+
+// ListFeatureFlags returns every known flag as resolved for the
+// requesting tenant.
+func (s *Server) ListFeatureFlags(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tenant := tenantID(ctx)
+
+	keys := make([]string, 0, len(knownFlags))
+	for k := range knownFlags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	resp := featureFlagsResponse{Environment: appEnvironment(), TenantID: tenant, Flags: []featureFlagView{}}
+	for _, k := range keys {
+		enabled, source := s.resolveFlag(ctx, tenant, k)
+		resp.Flags = append(resp.Flags, featureFlagView{
+			Key:         k,
+			Description: knownFlags[k].Description,
+			Enabled:     enabled,
+			Source:      source,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// SetFeatureFlag toggles a flag for the requesting tenant, or for the
+// whole environment when the request is unscoped.
+func (s *Server) SetFeatureFlag(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key := mux.Vars(r)["key"]
+	tenant := tenantID(ctx)
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	if _, ok := knownFlags[key]; !ok {
+		httpError(w, r, "unknown feature flag", http.StatusNotFound)
+		return
+	}
+
+	var req setFeatureFlagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	env := appEnvironment()
+	f := &models.FeatureFlag{
+		ID:          flagID(env, tenant, key),
+		Environment: env,
+		TenantID:    tenant,
+		Key:         key,
+		Enabled:     *req.Enabled,
+		UpdatedBy:   req.UpdatedBy,
+		UpdatedAt:   s.Clock.Now().UTC(),
+	}
+	if err := s.DB.SaveFeatureFlag(ctx, f); err != nil {
+		httpError(w, r, "failed to save feature flag", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "feature_flag_save_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	s.flags.invalidate()
+
+	s.logEvent(ctx, "info", "feature_flag_updated",
+		fmt.Sprintf("flag %s=%t in %s tenant=%q by %q", key, f.Enabled, env, tenant, req.UpdatedBy),
+		r.RemoteAddr,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(f)
+}
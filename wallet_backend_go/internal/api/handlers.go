@@ -6,14 +6,15 @@ package api
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 	"time"
      "sync"
      "crypto/rand"
@@ -22,33 +23,159 @@ import (
 	"github.com/gorilla/mux"
 
 	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/bridge"
+	"wallet_backend_go/internal/payout"
+	"wallet_backend_go/internal/policyhook"
 	"wallet_backend_go/internal/db"
+	"wallet_backend_go/internal/i18n"
+	"wallet_backend_go/internal/lock"
+	"wallet_backend_go/internal/logship"
 	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/notify"
+	"wallet_backend_go/internal/notary"
+	"wallet_backend_go/internal/p2p"
 )
 
 // Server encapsulates the blockchain and its UTXO set. It exposes
 // methods that implement the REST API for wallet creation,
 // querying balances and sending transactions.
 type otpEntry struct {
-    Code    string
-    Expires time.Time
+    Code     string
+    Expires  time.Time
+    Attempts int // wrong codes entered so far
 }
 
 type Server struct {
     BC   *blockchain.Blockchain
     UTXO *blockchain.UTXOSet
-    DB   *db.SupabaseClient
+    DB   db.Store // nil when no database is configured
 
-    otpMu sync.Mutex
-    otps  map[string]otpEntry // key = email
+    // Clock times OTP expiry and Entropy feeds wallet keys and OTP
+    // codes. newServer sets the system clock and crypto/rand; tests
+    // replace them with deterministic sources.
+    Clock   blockchain.Clock
+    Entropy io.Reader
+
+    otpMu       sync.Mutex
+    otps        map[string]otpEntry // key = email
+    rateLimiter rateLimiter
+
+    // chainMu serializes mining so that concurrent requests and the
+    // background worker never build on the same tip.
+    chainMu sync.Mutex
+    jobs    chan backgroundJob
+
+    zakatGuard zakatRunGuard
+    reports    reportCache
+    adminJobs  adminJobStore
+
+    // zakatSchedule starts zakat runs automatically; nil when
+    // ZAKAT_SCHEDULE is not set.
+    zakatSchedule *zakatSchedule
+
+    annualReports annualReportCache
+
+    // notifiers are the external notification channels configured
+    // on this server, keyed by channel name.
+    notifiers map[string]notify.Notifier
+
+    // mailer sends the admin digests; nil when SMTP is not configured.
+    mailer *notify.Email
+
+    // logShipper forwards system logs to an external collector; nil
+    // when LOG_SHIP_SINK is not set.
+    logShipper *logship.Shipper
+
+    faucet  faucetLimiter
+    sandbox sandboxState
+    flags   flagCache
+
+    maintenance maintenanceState
+
+    // selfCheckKey is the secret of an extra admin that the self-check
+    // uses on its throwaway server; empty elsewhere.
+    selfCheckKey string
+
+    sessions sessionKeeper
+    walletKeys walletKeys
+    webauthn webauthnState
+
+    held heldTransfers
+    sends recentSends
+    idempotency idempotencyCache
+
+    ackChallenges ackChallenges
+
+    // persistence tracks the Supabase writes of mined transactions.
+    persistence persistenceTracker
+
+    // prices caches the fiat rates of the price feed.
+    prices priceCache
+
+    // pledgeMu serializes pledge payments with cancellations.
+    pledgeMu sync.Mutex
+
+    // handleMu serializes handle claims, transfers and releases.
+    handleMu sync.Mutex
+
+    // locks coordinates work between instances (see locks.go).
+    locks lock.Locker
+    // leader elects the instance that runs the schedulers; nil when
+    // the locks are local and this instance always leads.
+    leader *lock.Elector
+
+    // mempool queues sends for the background miner when
+    // MINING_MODE=mempool; nil when sends are mined inline.
+    mempool     *blockchain.Mempool
+    sendTenants sendTenants
+
+    // readOnly marks an explorer node (see readonly.go), which follows
+    // the writer's blocks as recorded in follow.
+    readOnly bool
+    follow   explorerSync
+
+    // addrs indexes the chain by address for the explorer.
+    addrs    blockchain.AddressIndex
+    clusters clusterState
+
+    // feed pushes chain events to the clients of GET /ws.
+    feed eventFeed
+
+    // peers syncs the chain with the nodes in PEER_ADDRS; nil without.
+    peers *peerNode
+
+    // notary anchors the chain in a public network; nil when
+    // ANCHOR_CLIENT is not set.
+    notary notary.Client
+
+    // bridge watches the BTC and ETH donation addresses of campaigns;
+    // nil when BRIDGE_ADDRESSES is not set.
+    bridge *bridge.Config
+
+    // payouts are the providers paying beneficiaries outside the
+    // chain, by payout method.
+    payouts map[string]payout.Adapter
+
+    // policyHooks are the external policy services asked about
+    // transactions and disbursements (see policy_hooks.go).
+    policyHooks policyhook.Services
+
+    // metrics are served to Prometheus (see metrics.go).
+    metrics *serverMetrics
+
+    // poolAlerts remembers the pool balance alerts raised (see
+    // pool_alerts.go).
+    poolAlerts poolAlerts
 }
 
 type walletReportResponse struct {
     WalletAddress string                `json:"wallet_address"`
     Balance       int                   `json:"balance"`
+    BalanceFiat   *fiatAmount           `json:"balance_fiat,omitempty"`
     TotalSent     int                   `json:"total_sent"`
     TotalReceived int                   `json:"total_received"`
     TotalZakat    int                   `json:"total_zakat"`
+    TotalFees     int                   `json:"total_fees"` // fees paid on the wallet's sends
     Transactions  []db.TransactionRecord `json:"transactions"`
     ZakatRecords  []models.ZakatRecord  `json:"zakat_records"`
 }
@@ -58,28 +185,137 @@ type systemLogsResponse struct {
 }
 
 
-// NewServer constructs a Server with the provided blockchain. It
-// initializes the UTXO set wrapper around the blockchain and tries
-// to create a Supabase client. If Supabase env vars are missing,
-// DB will be nil and the API will still work in-memory.
-func NewServer(bc *blockchain.Blockchain) *Server {
-	var supa *db.SupabaseClient
-
-	client, err := db.NewSupabaseClient()
-	if err != nil {
-		log.Printf("warning: could not initialize Supabase client: %v", err)
-		supa = nil
+// NewServer constructs a Server with the provided blockchain and
+// store. It initializes the UTXO set wrapper around the blockchain.
+// store may be nil, in which case the API still works in-memory and
+// endpoints that need the database report it as not configured.
+func NewServer(bc *blockchain.Blockchain, store db.Store) *Server {
+	s := newServer(bc, store)
+	s.notifiers = loadNotifiers()
+	s.logShipper = logship.NewFromEnv()
+	s.mailer = notify.NewEmailFromEnv()
+	s.useLocker(newLocker(store))
+	go s.runWorker()
+	go s.runHeldTransfers()
+	go s.runPledges()
+	go s.runInvitations()
+	s.startZakatSchedule()
+	if mempoolMode() {
+		log.Println("sends are queued in the mempool and mined in the background")
+		s.startMempool()
+	}
+	if s.mailer != nil {
+		log.Println("admin digest emails enabled")
+		go s.runDigests()
+	}
+	if poolAlertDropPct() > 0 {
+		s.logPoolAlertConfig()
+		go s.runPoolAlerts()
+	}
+	if coldSweepEnabled() {
+		ceiling, _ := poolHotCeiling()
+		log.Printf("cold storage: zakat pool funds above %d are swept to %s", ceiling, coldWalletAddress())
+		go s.runColdSweep()
+	}
+	if sandboxMode() {
+		log.Println("sandbox mode: chain and database are reset nightly")
+		go s.runSandbox()
+	}
+	if peers, err := p2p.PeersFromEnv(); err != nil {
+		log.Printf("p2p: %v", err)
+	} else if len(peers) > 0 {
+		log.Printf("p2p: syncing with %d peers", len(peers))
+		s.startPeers(peers)
+	}
+	if client, err := notary.NewFromEnv(); err != nil {
+		log.Printf("anchoring: %v", err)
+	} else if client != nil {
+		log.Printf("anchoring the chain with %s", client.Name())
+		s.notary = client
+		go s.runChainAnchors()
+	}
+	if cfg, err := bridge.FromEnv(); err != nil {
+		log.Printf("bridge: %v", err)
+	} else if cfg != nil {
+		log.Printf("bridge: watching %d BTC/ETH addresses", len(cfg.Watches))
+		s.bridge = cfg
+		go s.runBridge()
+	}
+	if adapters, err := payout.FromEnv(); err != nil {
+		log.Printf("payouts: %v", err)
+	} else if len(adapters) > 0 {
+		for method := range adapters {
+			if payoutPoolMode() == payoutModeBurn {
+				log.Printf("payouts: paying %s beneficiaries, burning their parts", method)
+			} else {
+				log.Printf("payouts: paying %s beneficiaries to %s", method, payoutSettlementAddress())
+			}
+		}
+		s.payouts = adapters
+		go s.runPayouts()
+	}
+	if hooks, err := policyhook.FromEnv(); err != nil {
+		log.Printf("policy hooks: %v", err)
 	} else {
-		supa = client
-		log.Println("Supabase client initialized")
+		for _, h := range hooks {
+			mode := "closed"
+			if h.FailOpen {
+				mode = "open"
+			}
+			log.Printf("policy hooks: asking %s about %s, failing %s", h.Name, strings.Join(h.Actions, " and "), mode)
+		}
+		s.policyHooks = hooks
 	}
+	return s
+}
 
-	return &Server{
-		BC:   bc,
-		UTXO: &blockchain.UTXOSet{BC: bc},
-		DB:   supa,
-        otps: make(map[string]otpEntry),
+// NewEphemeralServer constructs a Server around bc and store, which
+// may be nil or a fake, without notification channels and without the
+// sandbox reset. The background worker runs. Tests and tools use it to
+// serve a chain of their own.
+func NewEphemeralServer(bc *blockchain.Blockchain, store db.Store) *Server {
+	s := newServer(bc, store)
+	go s.runWorker()
+	go s.runHeldTransfers()
+	go s.runPledges()
+	go s.runInvitations()
+	return s
+}
+
+// newServer builds a Server with its policy checks registered but
+// starts nothing.
+func newServer(bc *blockchain.Blockchain, store db.Store) *Server {
+	s := &Server{
+		BC:    bc,
+		UTXO:  &blockchain.UTXOSet{BC: bc},
+		DB:    store,
+		otps:  make(map[string]otpEntry),
+		jobs:  make(chan backgroundJob, jobQueueSize),
+		locks: lock.NewLocal(),
+
+		Clock:   blockchain.SystemClock,
+		Entropy: rand.Reader,
+	}
+	s.registerValidators()
+	s.initMetrics()
+	bc.OnBlock = s.feed.publishBlock
+	return s
+}
+
+// logEvent writes a system log row when a database is configured and
+// ships the event when log shipping is.
+func (s *Server) logEvent(ctx context.Context, level, typ, message, ip string) {
+	s.logShipper.Ship(models.SystemLog{
+		Level:     level,
+		Type:      typ,
+		Message:   message,
+		IP:        ip,
+		Timestamp: s.Clock.Now().UTC(),
+	})
+	if s.DB == nil {
+		return
 	}
+	s.DB.LogSystemEvent(ctx, level, typ, message, ip)
 }
 
 // Health responds with a simple JSON object indicating service
@@ -94,7 +330,11 @@ func (s *Server) Health(w http.ResponseWriter, r *http.Request) {
 // application you would not return the raw private key; instead you
 // would prompt the user to securely store it client side.
 func (s *Server) CreateWallet(w http.ResponseWriter, r *http.Request) {
-	wallet := blockchain.NewWallet()
+	wallet, err := blockchain.NewWalletFrom(s.Entropy)
+	if err != nil {
+		httpError(w, r, "failed to create wallet", http.StatusInternalServerError)
+		return
+	}
 	resp := map[string]string{
 		"address":     wallet.GetAddress(),
 		"private_key": hex.EncodeToString(wallet.PrivateKey.D.Bytes()),
@@ -105,22 +345,18 @@ func (s *Server) CreateWallet(w http.ResponseWriter, r *http.Request) {
 
 // helper: compute balance + pubKeyHash for an address
 func (s *Server) balanceForAddress(address string) (int, []byte, error) {
-	if !blockchain.ValidateAddress(address) {
-		return 0, nil, fmt.Errorf("invalid address")
-	}
-
-	pubKeyHash, err := hex.DecodeString(address)
+	pubKeyHash, err := blockchain.DecodeAddress(address)
 	if err != nil {
 		return 0, nil, fmt.Errorf("invalid address")
 	}
 
+	// FindUTXO matches outputs through TxOutput.Owner, which also reads
+	// the legacy text encoding of old coinbase outputs
 	UTXOs := s.BC.FindUTXO(pubKeyHash)
 	balance := 0
 	for _, outs := range UTXOs {
 		for _, out := range outs {
-			if string(out.PubKeyHash) == string(pubKeyHash) {
-				balance += out.Value
-			}
+			balance += out.Value
 		}
 	}
 
@@ -128,10 +364,10 @@ func (s *Server) balanceForAddress(address string) (int, []byte, error) {
 }
 
 
-func generateOTP(length int) (string, error) {
+func generateOTP(entropy io.Reader, length int) (string, error) {
     result := ""
     for i := 0; i < length; i++ {
-        n, err := rand.Int(rand.Reader, big.NewInt(10))
+        n, err := rand.Int(entropy, big.NewInt(10))
         if err != nil {
             return "", err
         }
@@ -146,26 +382,35 @@ func (s *Server) WalletReport(w http.ResponseWriter, r *http.Request) {
     address := vars["address"]
 
     if address == "" {
-        http.Error(w, "address is required", http.StatusBadRequest)
+        httpError(w, r, "address is required", http.StatusBadRequest)
         return
     }
 
     if s.DB == nil {
-        http.Error(w, "database not configured", http.StatusInternalServerError)
+        httpError(w, r, "database not configured", http.StatusInternalServerError)
         return
     }
 
+    if cached, ok := s.reports.get(address, s.Clock.Now()); ok {
+        cached.BalanceFiat = s.fiatFor(r, cached.Balance)
+        w.Header().Set(cacheStatusHeader, "HIT")
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(cached)
+        return
+    }
+    gen := s.reports.generation(address)
+
      balance, _, err := s.balanceForAddress(address)
     if err != nil {
-        http.Error(w, "invalid address", http.StatusBadRequest)
+        httpError(w, r, "invalid address", http.StatusBadRequest)
         return
     }
 
     // 2) Transactions involving this wallet
     txs, err := s.DB.ListTransactionsByWallet(ctx, address)
     if err != nil {
-        http.Error(w, "failed to list transactions", http.StatusInternalServerError)
-        s.DB.LogSystemEvent(ctx, "error", "wallet_report_list_txs_failed", err.Error(), r.RemoteAddr)
+        httpError(w, r, "failed to list transactions", http.StatusInternalServerError)
+        s.logEvent(ctx, "error", "wallet_report_list_txs_failed", err.Error(), r.RemoteAddr)
         return
     }
 
@@ -173,10 +418,11 @@ func (s *Server) WalletReport(w http.ResponseWriter, r *http.Request) {
     totalSent := 0
     totalReceived := 0
     for _, t := range txs {
-        if t.Sender == address {
+        // rows may hold the address in either encoding
+        if blockchain.SameAddress(t.Sender, address) {
             totalSent += t.Amount
         }
-        if t.Receiver == address {
+        if blockchain.SameAddress(t.Receiver, address) {
             totalReceived += t.Amount
         }
     }
@@ -184,8 +430,8 @@ func (s *Server) WalletReport(w http.ResponseWriter, r *http.Request) {
     // 4) Zakat records for this wallet
     zakatRecords, err := s.DB.ListZakatByWallet(ctx, address)
     if err != nil {
-        http.Error(w, "failed to list zakat records", http.StatusInternalServerError)
-        s.DB.LogSystemEvent(ctx, "error", "wallet_report_list_zakat_failed", err.Error(), r.RemoteAddr)
+        httpError(w, r, "failed to list zakat records", http.StatusInternalServerError)
+        s.logEvent(ctx, "error", "wallet_report_list_zakat_failed", err.Error(), r.RemoteAddr)
         return
     }
 
@@ -200,10 +446,15 @@ func (s *Server) WalletReport(w http.ResponseWriter, r *http.Request) {
         TotalSent:     totalSent,
         TotalReceived: totalReceived,
         TotalZakat:    totalZakat,
+        TotalFees:     s.feesPaid(address, txs),
         Transactions:  txs,
         ZakatRecords:  zakatRecords,
     }
+    // fiat depends on the request, so it is added after caching
+    s.reports.put(address, gen, resp, s.Clock.Now())
+    resp.BalanceFiat = s.fiatFor(r, balance)
 
+    w.Header().Set(cacheStatusHeader, "MISS")
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(resp)
 }
@@ -212,7 +463,7 @@ func (s *Server) SystemLogs(w http.ResponseWriter, r *http.Request) {
     ctx := r.Context()
 
     if s.DB == nil {
-        http.Error(w, "database not configured", http.StatusInternalServerError)
+        httpError(w, r, "database not configured", http.StatusInternalServerError)
         return
     }
 
@@ -227,8 +478,8 @@ func (s *Server) SystemLogs(w http.ResponseWriter, r *http.Request) {
 
     logs, err := s.DB.ListSystemLogs(ctx, limit)
     if err != nil {
-        http.Error(w, "failed to list system logs", http.StatusInternalServerError)
-        s.DB.LogSystemEvent(ctx, "error", "system_logs_list_failed", err.Error(), r.RemoteAddr)
+        httpError(w, r, "failed to list system logs", http.StatusInternalServerError)
+        s.logEvent(ctx, "error", "system_logs_list_failed", err.Error(), r.RemoteAddr)
         return
     }
 
@@ -248,20 +499,46 @@ func (s *Server) GetBalance(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	address := vars["address"]
 
-	balance, _, err := s.balanceForAddress(address)
+	balance, pubKeyHash, err := s.balanceForAddress(address)
 	if err != nil {
-		http.Error(w, "invalid address", http.StatusBadRequest)
+		httpError(w, r, "invalid address", http.StatusBadRequest)
 		return
 	}
 
+	resp := balanceResponse{Balance: balance, Fiat: s.fiatFor(r, balance)}
+	if r.URL.Query().Get("include_pending") == "true" {
+		debits, credits := s.pendingFor(pubKeyHash)
+		resp.Confirmed = &balance
+		resp.PendingDebits = &debits
+		resp.PendingCredits = &credits
+		pending := credits - debits
+		resp.Pending = &pending
+		available := balance - debits
+		resp.Available = &available
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]int{"balance": balance})
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+type balanceResponse struct {
+	Balance int         `json:"balance"`
+	Fiat    *fiatAmount `json:"fiat,omitempty"`
+
+	// with ?include_pending=true
+	Confirmed      *int `json:"confirmed,omitempty"`
+	PendingDebits  *int `json:"pending_debits,omitempty"`
+	PendingCredits *int `json:"pending_credits,omitempty"`
+	Pending        *int `json:"pending,omitempty"`   // credits less debits
+	Available      *int `json:"available,omitempty"` // confirmed less pending debits
 }
 
 type registerRequest struct {
-	FullName string `json:"full_name"`
-	Email    string `json:"email"`
-	CNIC     string `json:"cnic"`
+	FullName      string `json:"full_name"`
+	Email         string `json:"email"`
+	CNIC          string `json:"cnic"`
+	Phone         string `json:"phone"`
+	NotifyChannel string `json:"notify_channel"`
 }
 
 type registerResponse struct {
@@ -291,8 +568,9 @@ type requestOTPRequest struct {
 }
 
 type requestOTPResponse struct {
-    Email string `json:"email"`
-    OTP   string `json:"otp"` // in real life you would NOT return this
+    Email   string `json:"email"`
+    Message string `json:"message"`
+    OTP     string `json:"otp,omitempty"` // only with OTP_ECHO=true, see otp_guard.go
 }
 
 type verifyOTPRequest struct {
@@ -303,6 +581,11 @@ type verifyOTPRequest struct {
 type verifyOTPResponse struct {
     Success bool   `json:"success"`
     Message string `json:"message"`
+
+    // session token, issued when a database is configured
+    Token     string     `json:"token,omitempty"`
+    ExpiresAt *time.Time `json:"expires_at,omitempty"`
+    UserID    string     `json:"user_id,omitempty"`
 }
 
 // txRequest defines the payload expected in a send transaction request.
@@ -313,7 +596,16 @@ type txRequest struct {
 	From    string `json:"from"`
 	To      string `json:"to"`
 	Amount  int    `json:"amount"`
+	Fee     int    `json:"fee,omitempty"` // paid to FEE_ADDRESS by the block's coinbase
 	PrivKey string `json:"privKey"`
+	PIN     string `json:"pin,omitempty"` // when the sender has a transaction PIN
+
+	// AllowDuplicate sends even if an identical transfer was just
+	// accepted.
+	AllowDuplicate bool `json:"allow_duplicate,omitempty"`
+	// IdempotencyKey, like the Idempotency-Key header, makes retries
+	// of the send get its first response (see idempotency.go).
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
 
@@ -322,40 +614,69 @@ func (s *Server) RequestOTP(w http.ResponseWriter, r *http.Request) {
 
     var req requestOTPRequest
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        http.Error(w, "invalid request body", http.StatusBadRequest)
+        httpError(w, r, "invalid request body", http.StatusBadRequest)
         return
     }
 
     if req.Email == "" {
-        http.Error(w, "email is required", http.StatusBadRequest)
+        httpError(w, r, "email is required", http.StatusBadRequest)
         return
     }
 
-    code, err := generateOTP(6)
-    if err != nil {
-        http.Error(w, "failed to generate otp", http.StatusInternalServerError)
+    if !s.allowRate(w, r, rateOTP, "email", strings.ToLower(req.Email)) {
         return
     }
 
-    s.otpMu.Lock()
-    s.otps[req.Email] = otpEntry{
-        Code:    code,
-        Expires: time.Now().Add(5 * time.Minute),
+    code, err := generateOTP(s.Entropy, 6)
+    if err != nil {
+        httpError(w, r, "failed to generate otp", http.StatusInternalServerError)
+        return
     }
-    s.otpMu.Unlock()
 
+    // Only registered emails get a code that can be verified, but the
+    // response is the same either way. Without a database every email
+    // counts as registered.
+    var user *models.User
+    registered := s.DB == nil
     if s.DB != nil {
-        s.DB.LogSystemEvent(ctx, "info", "otp_generated",
+        u, err := s.DB.GetUserByEmail(ctx, tenantID(ctx), req.Email)
+        if err != nil {
+            s.logEvent(ctx, "error", "otp_user_lookup_failed", err.Error(), r.RemoteAddr)
+        }
+        user, registered = u, u != nil
+    }
+
+    if registered {
+        s.otpMu.Lock()
+        s.otps[req.Email] = otpEntry{
+            Code:    code,
+            Expires: s.Clock.Now().Add(5 * time.Minute),
+        }
+        s.otpMu.Unlock()
+
+        s.logEvent(ctx, "info", "otp_generated",
             fmt.Sprintf("otp generated for email=%s", req.Email),
             r.RemoteAddr,
         )
+        // delivered in the background so the response time does not
+        // depend on whether the email is registered
+        if user != nil {
+            text := i18n.Tf(lang(r), "Your one-time password is %s", code)
+            s.notifyDetached(user.ID, models.NotifyEventOTP, func() string { return text })
+        }
+    } else {
+        s.logEvent(ctx, "info", "otp_unknown_email",
+            fmt.Sprintf("otp requested for unregistered email=%s", req.Email),
+            r.RemoteAddr,
+        )
     }
 
-    // In a real app, you would send this via email.
-    // For the project/demo, returning it in JSON is enough to show OTP flow.
     resp := requestOTPResponse{
-        Email: req.Email,
-        OTP:   code,
+        Email:   req.Email,
+        Message: i18n.T(lang(r), "if the email is registered, a one-time password has been sent"),
+    }
+    if otpEcho() {
+        resp.OTP = code
     }
 
     w.Header().Set("Content-Type", "application/json")
@@ -368,154 +689,317 @@ func (s *Server) VerifyOTP(w http.ResponseWriter, r *http.Request) {
 
     var req verifyOTPRequest
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        http.Error(w, "invalid request body", http.StatusBadRequest)
+        httpError(w, r, "invalid request body", http.StatusBadRequest)
         return
     }
 
     if req.Email == "" || req.OTP == "" {
-        http.Error(w, "email and otp are required", http.StatusBadRequest)
+        httpError(w, r, "email and otp are required", http.StatusBadRequest)
         return
     }
 
-    s.otpMu.Lock()
-    entry, ok := s.otps[req.Email]
-    s.otpMu.Unlock()
-
-    if !ok {
-        if s.DB != nil {
-            s.DB.LogSystemEvent(ctx, "warn", "otp_not_found",
-                fmt.Sprintf("no otp for email=%s", req.Email),
-                r.RemoteAddr,
-            )
-        }
+    if !s.consumeOTP(req.Email, req.OTP) {
+        // unknown, expired and wrong codes are answered alike
+        s.logEvent(ctx, "warn", "otp_invalid",
+            fmt.Sprintf("invalid otp for email=%s", req.Email),
+            r.RemoteAddr,
+        )
+        w.Header().Set("Content-Type", "application/json")
         w.WriteHeader(http.StatusUnauthorized)
         json.NewEncoder(w).Encode(verifyOTPResponse{
             Success: false,
-            Message: "invalid or expired otp",
+            Message: i18n.T(lang(r), "invalid or expired otp"),
         })
         return
     }
 
-    if time.Now().After(entry.Expires) || entry.Code != req.OTP {
-        if s.DB != nil {
-            s.DB.LogSystemEvent(ctx, "warn", "otp_invalid",
-                fmt.Sprintf("invalid otp for email=%s", req.Email),
-                r.RemoteAddr,
-            )
-        }
-        w.WriteHeader(http.StatusUnauthorized)
-        json.NewEncoder(w).Encode(verifyOTPResponse{
-            Success: false,
-            Message: "invalid or expired otp",
-        })
-        return
-    }
+    s.logEvent(ctx, "info", "otp_verified",
+        fmt.Sprintf("otp verified for email=%s", req.Email),
+        r.RemoteAddr,
+    )
 
-    // OTP valid – consider the user "authenticated" for this demo.
+    resp := verifyOTPResponse{
+        Success: true,
+        Message: i18n.T(lang(r), "otp verified"),
+    }
     if s.DB != nil {
-        s.DB.LogSystemEvent(ctx, "info", "otp_verified",
-            fmt.Sprintf("otp verified for email=%s", req.Email),
-            r.RemoteAddr,
-        )
+        user, err := s.DB.GetUserByEmail(ctx, tenantID(ctx), req.Email)
+        if err != nil || user == nil {
+            httpError(w, r, "failed to load user", http.StatusInternalServerError)
+            if err != nil {
+                s.logEvent(ctx, "error", "user_get_failed", err.Error(), r.RemoteAddr)
+            }
+            return
+        }
+        session, err := s.issueSession(user, authMethodOTP)
+        if err != nil {
+            httpError(w, r, "failed to create session", http.StatusInternalServerError)
+            return
+        }
+        resp.Token = session.Token
+        resp.ExpiresAt = &session.ExpiresAt
+        resp.UserID = session.UserID
+
+        // the code reached the user's notify_channel, so they hold that
+        // contact and can claim what was sent to it; an echoed code
+        // proves nothing
+        if !otpEcho() {
+            s.claimInvitations(user)
+        }
     }
 
-    // Optionally: delete OTP so it can't be reused
-    s.otpMu.Lock()
-    delete(s.otps, req.Email)
-    s.otpMu.Unlock()
-
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(verifyOTPResponse{
-        Success: true,
-        Message: "otp verified",
-    })
+    json.NewEncoder(w).Encode(resp)
+}
+
+// mineError reports a block that was not mined: a storage failure is a
+// server error, anything else means the request ran out of time.
+func mineError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, blockchain.ErrStorage) {
+		log.Printf("block not mined: %v", err)
+		httpError(w, r, "failed to store block", http.StatusInternalServerError)
+		return
+	}
+	httpError(w, r, "request timed out", http.StatusGatewayTimeout)
 }
 
 // SendTransaction constructs, signs and broadcasts a new transaction.
 // It expects a JSON body containing from, to, amount and privKey.
 // The transaction is mined into a new block immediately for
-// demonstration purposes. Errors in decoding or signing are
-// reported with HTTP 400.
+// demonstration purposes and the response is its receipt (see
+// tx_receipts.go), which is also stored; with MINING_MODE=mempool it is
+// queued for the background miner instead (see mempool.go). Errors in
+// decoding or signing are reported with HTTP 400.
 func (s *Server) SendTransaction(w http.ResponseWriter, r *http.Request) {
 	var req txRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request payload", http.StatusBadRequest)
+		httpError(w, r, "invalid request payload", http.StatusBadRequest)
 		return
 	}
-	if !blockchain.ValidateAddress(req.From) || !blockchain.ValidateAddress(req.To) {
-		http.Error(w, "invalid address", http.StatusBadRequest)
+	idemKey := requestIdempotencyKey(r, req.IdempotencyKey)
+	if idemKey != "" && !validIdempotencyKey(idemKey) {
+		httpError(w, r, "invalid idempotency key", http.StatusBadRequest)
 		return
 	}
-	if req.Amount <= 0 {
-		http.Error(w, "amount must be positive", http.StatusBadRequest)
+	if !s.validSendRequest(w, r, &req) {
 		return
 	}
 	// decode private key big integer
 	dBytes, err := hex.DecodeString(req.PrivKey)
-	if err != nil {
-		http.Error(w, "invalid private key", http.StatusBadRequest)
+	if err != nil || len(dBytes) == 0 {
+		httpError(w, r, "invalid private key", http.StatusBadRequest)
 		return
 	}
 	// reconstruct ECDSA private key
 	curve := blockchain.GetDefaultCurve()
 	priv := blockchain.BigIntToPrivateKey(dBytes, curve)
+	// the key must own from, or the stored sender would be spoofed; this
+	// comes before the PIN so a wrong key cannot use up the owner's attempts
+	if !blockchain.KeyControlsAddress(&priv.PublicKey, req.From) {
+		s.logEvent(r.Context(), "warn", "sender_mismatch",
+			fmt.Sprintf("send from %s with a key of %s", req.From, blockchain.AddressOf(&priv.PublicKey)), r.RemoteAddr)
+		httpError(w, r, "private key does not match from address", http.StatusForbidden)
+		return
+	}
+	if !s.allowRate(w, r, rateTx, "address", blockchain.CanonicalAddress(req.From)) {
+		return
+	}
+	if !s.requireTransactionPIN(w, r, req.From, req.PIN) {
+		return
+	}
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+
+	// a retry of a send made with a key gets the first response; the
+	// response is kept before chainMu is released to the next retry
+	if idemKey != "" {
+		reqHash := sendRequestHash(req)
+		prev, err := s.lookupIdempotent(r.Context(), req.From, idemKey)
+		if err != nil {
+			httpError(w, r, "failed to check idempotency key", http.StatusInternalServerError)
+			s.logEvent(r.Context(), "error", "idempotency_lookup_failed", err.Error(), r.RemoteAddr)
+			return
+		}
+		if prev != nil {
+			if prev.RequestHash != reqHash {
+				httpError(w, r, "idempotency key was used for a different request", http.StatusUnprocessableEntity)
+				return
+			}
+			s.logEvent(r.Context(), "info", "idempotent_replay",
+				fmt.Sprintf("send from %s with key %s replayed (tx %s)", req.From, idemKey, prev.TxID), r.RemoteAddr)
+			replayIdempotent(w, prev)
+			return
+		}
+		rec := &idempotentRecorder{ResponseWriter: w}
+		w = rec
+		defer s.rememberIdempotent(r.Context(), req.From, idemKey, reqHash, rec)
+	}
+
+	// a slow response makes frontends submit the same send twice; a
+	// key tells retries apart from new sends
+	window := duplicateSendWindow()
+	if idemKey == "" && !req.AllowDuplicate && s.sends.duplicate(req.From, req.To, req.Amount, s.Clock.Now(), window) {
+		s.logEvent(r.Context(), "warn", "duplicate_send",
+			fmt.Sprintf("duplicate send of %d from %s to %s", req.Amount, req.From, req.To), r.RemoteAddr)
+		httpError(w, r, "duplicate transaction", http.StatusConflict)
+		return
+	}
+
 	// find spendable outputs
-	fromPubKeyHash, _ := hex.DecodeString(req.From)
-	amount, spendable := s.UTXO.FindSpendableOutputs(fromPubKeyHash, req.Amount)
-	if amount < req.Amount {
-		http.Error(w, "insufficient funds", http.StatusBadRequest)
+	fromPubKeyHash, _ := blockchain.DecodeAddress(req.From)
+	// coins of held transfers are spoken for
+	amount, spendable := s.UTXO.FindSpendableOutputsExcluding(fromPubKeyHash, req.Amount+req.Fee, s.reservedOutputs())
+	if amount < req.Amount+req.Fee {
+		httpError(w, r, "insufficient funds", http.StatusBadRequest)
 		return
 	}
-	// build transaction
-	tx, err := blockchain.NewUTXOTransaction(priv, req.To, req.Amount, s.BC, spendable, fromPubKeyHash, amount)
+	// build transaction; the fee is what it leaves out of the change
+	tx, err := blockchain.NewFeeTransaction(priv, req.To, req.Amount, req.Fee, s.BC, spendable, fromPubKeyHash, amount)
 	if err != nil {
-		http.Error(w, "failed to create transaction", http.StatusBadRequest)
+		httpError(w, r, "failed to create transaction", http.StatusBadRequest)
 		return
 	}
+	noteAuditTx(r.Context(), tx.ID)
 	// verify transaction before adding
 	if !s.BC.VerifyTransaction(tx) {
-		http.Error(w, "invalid transaction", http.StatusBadRequest)
+		httpError(w, r, "invalid transaction", http.StatusBadRequest)
+		return
+	}
+	// policy checks (freeze, limit, AML) may veto it
+	if err := s.BC.CheckPolicy(r.Context(), tx); err != nil {
+		policyError(w, r, err)
 		return
 	}
+	s.finishSend(w, r, tx, req, window)
+}
 
-	// mine new block
-	newBlock := s.BC.AddBlock([]*blockchain.Transaction{tx})
+// validSendRequest resolves and checks the parties, amount and fee of
+// a send, canonicalizing the addresses in req. It answers the request
+// and returns false when they are invalid.
+func (s *Server) validSendRequest(w http.ResponseWriter, r *http.Request, req *txRequest) bool {
+	// to may name a handle such as @amna (see handles.go)
+	to, ok := s.resolveRecipient(w, r, req.To)
+	if !ok {
+		return false
+	}
+	req.To = to
+	if !blockchain.ValidateAddress(req.From) || !blockchain.ValidateAddress(req.To) {
+		httpError(w, r, "invalid address", http.StatusBadRequest)
+		return false
+	}
+	// record both parties in the current encoding even when given in hex
+	req.From, req.To = blockchain.CanonicalAddress(req.From), blockchain.CanonicalAddress(req.To)
+	if req.Amount <= 0 {
+		httpError(w, r, "amount must be positive", http.StatusBadRequest)
+		return false
+	}
+	if req.Fee < 0 {
+		httpError(w, r, "fee must not be negative", http.StatusBadRequest)
+		return false
+	}
+	if req.Fee > 0 && s.BC.FeeAddress == "" {
+		httpError(w, r, "this node does not collect fees", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// finishSend holds, queues or mines tx, a verified send of req.Amount
+// from req.From to req.To, and answers the request. Must be called with
+// chainMu held.
+func (s *Server) finishSend(w http.ResponseWriter, r *http.Request, tx *blockchain.Transaction, req txRequest, window time.Duration) {
+	// large or first-time transfers wait out the cooling-off period
+	if reason := s.coolingOffReason(req.From, req.To, req.Amount); reason != "" {
+		if s.holdTransfer(w, r, tx, req.From, req.To, req.Amount, reason) {
+			s.sends.record(req.From, req.To, req.Amount, s.Clock.Now(), window)
+		}
+		return
+	}
+	if s.mempool != nil {
+		s.queueSend(w, r, tx, req, window)
+		return
+	}
+
+	// mine new block; a request past its deadline stops mining
+	newBlock, err := s.BC.AddBlockContext(r.Context(), []*blockchain.Transaction{tx})
+	if err != nil {
+		mineError(w, r, err)
+		return
+	}
+	s.reports.invalidateBlock(newBlock)
+	s.sends.record(req.From, req.To, req.Amount, s.Clock.Now(), window)
 
 	// persist block + transaction to Supabase (if DB is configured)
 	height := len(s.BC.Blocks) - 1
+	receipt := s.newTransactionReceipt(tx, newBlock, height, req.From, req.To, req.Amount)
+	receipt.TenantID = tenantID(r.Context())
 	if s.DB != nil {
 		blockHash := fmt.Sprintf("%x", newBlock.Hash)
 		fromAddress := req.From
 		toAddress := req.To
 		sentAmount := req.Amount
+		s.persistence.start(newBlock, []*blockchain.Transaction{tx}, "send", s.Clock.Now())
 
-		go func(b *blockchain.Block, h int, bh, from, to string, amt int, tx *blockchain.Transaction) {
+		go func(b *blockchain.Block, h int, bh, from, to string, amt int, tx *blockchain.Transaction, rc models.TransactionReceipt) {
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
 
 			// save block
+			var persistErr error
 			if err := s.DB.SaveBlock(ctx, h, b); err != nil {
 				log.Printf("failed to save block to Supabase: %v", err)
+				persistErr = err
 			}
 
 			// save transaction
 			if err := s.DB.SaveTransaction(ctx, bh, tx, from, to, amt, "send"); err != nil {
 				log.Printf("failed to save transaction to Supabase: %v", err)
+				persistErr = err
+			}
+			if cb := feeCoinbase(b); cb != nil {
+				sender, receiver, amount, txType := txParties(cb)
+				if err := s.DB.SaveTransaction(ctx, bh, cb, sender, receiver, amount, txType); err != nil {
+					log.Printf("failed to save fee transaction to Supabase: %v", err)
+					persistErr = err
+				}
+			}
+
+			// save receipt
+			if err := s.DB.CreateTransactionReceipt(ctx, &rc); err != nil {
+				log.Printf("failed to save transaction receipt to Supabase: %v", err)
+				persistErr = err
 			}
-		}(newBlock, height, blockHash, fromAddress, toAddress, sentAmount, tx)
+			s.persistence.finish([]*blockchain.Transaction{tx}, persistErr, s.Clock.Now())
+			s.reports.invalidateBlock(b)
+		}(newBlock, height, blockHash, fromAddress, toAddress, sentAmount, tx, receipt)
 	}
 
 	// update UTXO set
 	_ = s.UTXO.Reindex()
 
+	// "pay zakat as you earn" for the receiver, if they opted in
+	s.maybeAutoZakat(req.To, req.Amount)
+	s.notifyIncomingFunds(req.To, req.Amount)
+
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]string{"status": "transaction mined"})
+	_ = json.NewEncoder(w).Encode(sendResponse{Status: "transaction mined", TransactionReceipt: receipt})
 }
 
-// ListBlocks returns a summary of all blocks in the chain.
+// ListBlocks returns a summary of the blocks in the chain, optionally
+// a page of them by time range (see listing.go).
 func (s *Server) ListBlocks(w http.ResponseWriter, r *http.Request) {
+	lq, msg := listQueryParams(r, false)
+	if msg != "" {
+		httpError(w, r, msg, http.StatusBadRequest)
+		return
+	}
+
+	s.chainMu.Lock()
+	summaries, total := s.BC.QueryBlocks(lq)
+	s.chainMu.Unlock()
+
+	setListHeaders(w, lq, len(summaries), total)
 	w.Header().Set("Content-Type", "application/json")
-	summaries := s.BC.ListBlocks()
 	_ = json.NewEncoder(w).Encode(summaries)
 }
 
@@ -526,13 +1010,13 @@ func (s *Server) GetBlock(w http.ResponseWriter, r *http.Request) {
 
 	idx, err := strconv.Atoi(idxStr)
 	if err != nil {
-		http.Error(w, "invalid block index", http.StatusBadRequest)
+		httpError(w, r, "invalid block index", http.StatusBadRequest)
 		return
 	}
 
 	block, ok := s.BC.GetBlockByIndex(idx)
 	if !ok {
-		http.Error(w, "block not found", http.StatusNotFound)
+		httpError(w, r, "block not found", http.StatusNotFound)
 		return
 	}
 
@@ -540,45 +1024,96 @@ func (s *Server) GetBlock(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(block)
 }
 
+type chainInfoResponse struct {
+	ChainID     string `json:"chain_id,omitempty"`
+	GenesisHash string `json:"genesis_hash"`
+	Difficulty  int    `json:"difficulty"`
+	Height      int    `json:"height"`
+}
+
+// ChainInfo identifies the chain this node runs, so operators can check
+// that nodes agree on the genesis block.
+func (s *Server) ChainInfo(w http.ResponseWriter, r *http.Request) {
+	s.chainMu.Lock()
+	resp := chainInfoResponse{
+		ChainID:     s.BC.ChainID,
+		GenesisHash: hex.EncodeToString(s.BC.Blocks[0].Hash),
+		Difficulty:  blockchain.Difficulty(),
+		Height:      len(s.BC.Blocks) - 1,
+	}
+	s.chainMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
 func (s *Server) Register(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var req registerRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	if req.FullName == "" || req.Email == "" || req.CNIC == "" {
-		http.Error(w, "full_name, email and cnic are required", http.StatusBadRequest)
+		httpError(w, r, "full_name, email and cnic are required", http.StatusBadRequest)
+		return
+	}
+
+	phone := ""
+	if req.Phone != "" {
+		if phone = notify.NormalizePhone(req.Phone); phone == "" {
+			httpError(w, r, "invalid phone number", http.StatusBadRequest)
+			return
+		}
+	}
+	if !validNotifyChannel(req.NotifyChannel) {
+		httpError(w, r, "notify_channel must be email or whatsapp", http.StatusBadRequest)
+		return
+	}
+	if req.NotifyChannel == notify.ChannelWhatsApp && phone == "" {
+		httpError(w, r, "phone is required for whatsapp notifications", http.StatusBadRequest)
 		return
 	}
 
 	// 1) Create blockchain wallet (using your existing wallet logic)
-	wallet := blockchain.NewWallet()
+	wallet, err := blockchain.NewWalletFrom(s.Entropy)
+	if err != nil {
+		httpError(w, r, "failed to create wallet", http.StatusInternalServerError)
+		return
+	}
 	address := wallet.GetAddress()
 
 	// Convert keys to hex strings
 	privKeyHex := blockchain.PrivateKeyToHex(&wallet.PrivateKey)
 	pubKeyHex := hex.EncodeToString(wallet.PublicKey)
 
-	// "Encrypt" private key (for assignment we can just base64 it)
-	encryptedPriv := base64.StdEncoding.EncodeToString([]byte(privKeyHex))
+	encryptedPriv, err := s.sealWalletKey(address, privKeyHex)
+	if err != nil {
+		httpError(w, r, "failed to create wallet", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "wallet_key_seal_failed", err.Error(), r.RemoteAddr)
+		return
+	}
 
 	// 2) Create user record
 	user := &models.User{
-		ID:        uuid.NewString(),
-		FullName:  req.FullName,
-		Email:     req.Email,
-		CNIC:      req.CNIC,
-		CreatedAt: time.Now().UTC(),
+		ID:            uuid.NewString(),
+		TenantID:      tenantID(ctx),
+		FullName:      req.FullName,
+		Email:         req.Email,
+		CNIC:          req.CNIC,
+		Phone:         phone,
+		NotifyChannel: req.NotifyChannel,
+		Role:          models.RoleUser,
+		CreatedAt:     s.Clock.Now().UTC(),
 	}
 
 	if s.DB != nil {
 		if err := s.DB.CreateUser(ctx, user); err != nil {
-			http.Error(w, "failed to create user", http.StatusInternalServerError)
+			httpError(w, r, "failed to create user", http.StatusInternalServerError)
 			if s.DB != nil {
-				s.DB.LogSystemEvent(ctx, "error", "user_create_failed", err.Error(), r.RemoteAddr)
+				s.logEvent(ctx, "error", "user_create_failed", err.Error(), r.RemoteAddr)
 			}
 			return
 		}
@@ -587,21 +1122,23 @@ func (s *Server) Register(w http.ResponseWriter, r *http.Request) {
 		wp := &models.WalletProfile{
 			ID:                  uuid.NewString(),
 			UserID:              user.ID,
+			TenantID:            user.TenantID,
 			WalletAddress:       address,
 			PublicKeyHex:        pubKeyHex,
 			EncryptedPrivateKey: encryptedPriv,
-			CreatedAt:           time.Now().UTC(),
+			Status:              models.WalletStatusActive,
+			CreatedAt:           s.Clock.Now().UTC(),
 		}
 
 		if err := s.DB.CreateWalletProfile(ctx, wp); err != nil {
-			http.Error(w, "failed to create wallet profile", http.StatusInternalServerError)
+			httpError(w, r, "failed to create wallet profile", http.StatusInternalServerError)
 			if s.DB != nil {
-				s.DB.LogSystemEvent(ctx, "error", "wallet_profile_create_failed", err.Error(), r.RemoteAddr)
+				s.logEvent(ctx, "error", "wallet_profile_create_failed", err.Error(), r.RemoteAddr)
 			}
 			return
 		}
 
-		s.DB.LogSystemEvent(ctx, "info", "user_registered",
+		s.logEvent(ctx, "info", "user_registered",
 			fmt.Sprintf("user %s registered with wallet %s", user.Email, address),
 			r.RemoteAddr,
 		)
@@ -619,165 +1156,43 @@ func (s *Server) Register(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		httpError(w, r, "failed to encode response", http.StatusInternalServerError)
 		return
 	}
 }
 
-// Zakat run response
-type zakatRunResponse struct {
-	TotalWallets int      `json:"total_wallets"`
-	Processed    int      `json:"processed"`
-	TotalZakat   int      `json:"total_zakat"`
-	BlockHashes  []string `json:"block_hashes"`
-}
-
-// RunZakat calculates 2.5% zakat for each wallet and sends it to the Zakat pool wallet.
-func (s *Server) RunZakat(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
-	if s.DB == nil {
-		http.Error(w, "database not configured", http.StatusInternalServerError)
-		return
-	}
-
-	zakatAddress := os.Getenv("ZAKAT_WALLET_ADDRESS")
-	if zakatAddress == "" {
-		http.Error(w, "ZAKAT_WALLET_ADDRESS not set", http.StatusInternalServerError)
-		return
-	}
-
-	// 1) Fetch all wallet profiles from Supabase
-	profiles, err := s.DB.ListWalletProfiles(ctx)
-	if err != nil {
-		http.Error(w, "failed to list wallet profiles", http.StatusInternalServerError)
-		s.DB.LogSystemEvent(ctx, "error", "zakat_list_wallets_failed", err.Error(), r.RemoteAddr)
-		return
-	}
-
-	processed := 0
-	totalZakat := 0
-	var blockHashes []string
-
-	for _, wp := range profiles {
-		addr := wp.WalletAddress
-
-		// compute balance
-		balance, pubKeyHash, balErr := s.balanceForAddress(addr)
-		if balErr != nil || balance <= 0 {
-			if balErr != nil {
-				s.DB.LogSystemEvent(ctx, "error", "zakat_balance_failed", balErr.Error(), r.RemoteAddr)
-			}
-			continue
-		}
-
-		// zakat = 2.5% => balance * 25 / 1000
-		zakatAmount := (balance * 25) / 1000
-		if zakatAmount <= 0 {
-			continue
-		}
-
-		// Decode "encrypted" private key (base64 of hex string)
-		decoded, decErr := base64.StdEncoding.DecodeString(wp.EncryptedPrivateKey)
-		if decErr != nil {
-			s.DB.LogSystemEvent(ctx, "error", "zakat_privkey_decode_failed", decErr.Error(), r.RemoteAddr)
-			continue
-		}
-
-		privHex := string(decoded)
-		privKey, pkErr := blockchain.PrivateKeyFromHex(privHex)
-		if pkErr != nil {
-			s.DB.LogSystemEvent(ctx, "error", "zakat_privkey_reconstruct_failed", pkErr.Error(), r.RemoteAddr)
-			continue
-		}
-
-		// Find spendable outputs for zakat amount
-		amount, spendable := s.UTXO.FindSpendableOutputs(pubKeyHash, zakatAmount)
-		if amount < zakatAmount {
-			// not enough balance in UTXOs (should not normally happen if balance check is correct)
-			continue
-		}
-
-		// Create zakat transaction
-		tx, txErr := blockchain.NewUTXOTransaction(*privKey, zakatAddress, zakatAmount, s.BC, spendable, pubKeyHash, amount)
-		if txErr != nil {
-			s.DB.LogSystemEvent(ctx, "error", "zakat_tx_create_failed", txErr.Error(), r.RemoteAddr)
-			continue
-		}
-
-		// Verify transaction
-		if !s.BC.VerifyTransaction(tx) {
-			s.DB.LogSystemEvent(ctx, "error", "zakat_tx_verify_failed", "verification failed", r.RemoteAddr)
-			continue
-		}
-
-		// Mine block with this zakat transaction
-		newBlock := s.BC.AddBlock([]*blockchain.Transaction{tx})
-		blockHashHex := fmt.Sprintf("%x", newBlock.Hash)
-		blockHashes = append(blockHashes, blockHashHex)
-		processed++
-		totalZakat += zakatAmount
-
-		// Update UTXO set (rebuild)
-		_ = s.UTXO.Reindex()
-
-		// Save block & transaction as zakat_deduction
-		height := len(s.BC.Blocks) - 1
-		if saveBlkErr := s.DB.SaveBlock(ctx, height, newBlock); saveBlkErr != nil {
-			s.DB.LogSystemEvent(ctx, "error", "zakat_block_save_failed", saveBlkErr.Error(), r.RemoteAddr)
-		}
-
-		if saveTxErr := s.DB.SaveTransaction(ctx, blockHashHex, tx, addr, zakatAddress, zakatAmount, "zakat_deduction"); saveTxErr != nil {
-			s.DB.LogSystemEvent(ctx, "error", "zakat_tx_save_failed", saveTxErr.Error(), r.RemoteAddr)
-		}
-
-		// Save zakat record
-		zr := &models.ZakatRecord{
-			ID:            uuid.NewString(),
-			UserID:        wp.UserID,
-			WalletAddress: addr,
-			Amount:        zakatAmount,
-			BlockHash:     blockHashHex,
-			CreatedAt:     time.Now().UTC(),
-		}
-		if zrErr := s.DB.SaveZakatRecord(ctx, zr); zrErr != nil {
-			s.DB.LogSystemEvent(ctx, "error", "zakat_record_save_failed", zrErr.Error(), r.RemoteAddr)
-		}
-	}
-
-	s.DB.LogSystemEvent(ctx, "info", "zakat_run",
-		fmt.Sprintf("zakat run processed=%d total_zakat=%d", processed, totalZakat),
-		r.RemoteAddr,
-	)
-
-	resp := zakatRunResponse{
-		TotalWallets: len(profiles),
-		Processed:    processed,
-		TotalZakat:   totalZakat,
-		BlockHashes:  blockHashes,
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(resp)
-}
-
-// GetWalletTransactions returns all transactions that involve the
-// given wallet address as a recipient.
+// GetWalletTransactions returns the transactions that involve the
+// given wallet address as a recipient, optionally a page of them by
+// time range and type (see listing.go).
 func (s *Server) GetWalletTransactions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	vars := mux.Vars(r)
 	address := vars["address"]
 
 	if !blockchain.ValidateAddress(address) {
-		http.Error(w, "invalid address", http.StatusBadRequest)
+		httpError(w, r, "invalid address", http.StatusBadRequest)
+		return
+	}
+	lq, msg := listQueryParams(r, true)
+	if msg != "" {
+		httpError(w, r, msg, http.StatusBadRequest)
 		return
 	}
+	var pool string
+	if len(lq.Types) > 0 {
+		// without a zakat pool no send is a deduction
+		pool, _ = s.zakatAddressFor(ctx, tenantID(ctx))
+	}
 
-	txs, err := s.BC.GetTransactionsForAddress(address)
+	s.chainMu.Lock()
+	txs, total, err := s.BC.QueryTransactionsForAddress(address, lq, txKind(pool))
+	s.chainMu.Unlock()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	setListHeaders(w, lq, len(txs), total)
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(txs)
 }
@@ -788,35 +1203,48 @@ func (s *Server) FundWallet(w http.ResponseWriter, r *http.Request) {
 
 	var req fundWalletRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	if req.Address == "" || req.Amount <= 0 {
-		http.Error(w, "address and positive amount are required", http.StatusBadRequest)
+		httpError(w, r, "address and positive amount are required", http.StatusBadRequest)
 		return
 	}
 
 	if !blockchain.ValidateAddress(req.Address) {
-		http.Error(w, "invalid address", http.StatusBadRequest)
+		httpError(w, r, "invalid address", http.StatusBadRequest)
 		return
 	}
 
 	// 1) Create coinbase transaction paying to this address
 	cbTx := blockchain.NewCoinbaseTx(req.Address, "admin_faucet_reward")
+	noteAuditTx(ctx, cbTx.ID)
 
 	// 2) Mine block with this coinbase tx
-	newBlock := s.BC.AddBlock([]*blockchain.Transaction{cbTx})
+	s.chainMu.Lock()
+	newBlock, err := s.BC.AddBlockContext(ctx, []*blockchain.Transaction{cbTx})
+	if err != nil {
+		s.chainMu.Unlock()
+		mineError(w, r, err)
+		return
+	}
+	height := len(s.BC.Blocks) - 1
+	s.reports.invalidateBlock(newBlock)
 
 	// 3) Rebuild UTXO set
 	_ = s.UTXO.Reindex()
+	s.chainMu.Unlock()
 
 	blockHashHex := fmt.Sprintf("%x", newBlock.Hash)
 
 	if s.DB != nil {
+		s.persistence.start(newBlock, newBlock.Transactions, "reward", s.Clock.Now())
+		var persistErr error
 		// save block
-		if err := s.DB.SaveBlock(ctx, len(s.BC.Blocks)-1, newBlock); err != nil {
-			s.DB.LogSystemEvent(ctx, "error", "faucet_save_block_failed", err.Error(), r.RemoteAddr)
+		if err := s.DB.SaveBlock(ctx, height, newBlock); err != nil {
+			s.logEvent(ctx, "error", "faucet_save_block_failed", err.Error(), r.RemoteAddr)
+			persistErr = err
 		}
 		// save tx as reward
 		if len(newBlock.Transactions) > 0 {
@@ -828,15 +1256,21 @@ func (s *Server) FundWallet(w http.ResponseWriter, r *http.Request) {
 				req.Amount,
 				"reward",
 			); err != nil {
-				s.DB.LogSystemEvent(ctx, "error", "faucet_save_tx_failed", err.Error(), r.RemoteAddr)
+				s.logEvent(ctx, "error", "faucet_save_tx_failed", err.Error(), r.RemoteAddr)
+				persistErr = err
 			}
 		}
-		s.DB.LogSystemEvent(ctx, "info", "faucet_fund",
-			fmt.Sprintf("funded %d to %s", req.Amount, req.Address),
+		s.persistence.finish(newBlock.Transactions, persistErr, s.Clock.Now())
+		s.reports.invalidateBlock(newBlock)
+		s.logEvent(ctx, "info", "faucet_fund",
+			fmt.Sprintf("funded %d to %s by %s", req.Amount, req.Address, adminName(ctx)),
 			r.RemoteAddr,
 		)
 	}
 
+	s.maybeAutoZakat(req.Address, cbTx.Vout[0].Value)
+	s.notifyIncomingFunds(req.Address, cbTx.Vout[0].Value)
+
 	resp := fundWalletResponse{
 		Address:   req.Address,
 		Amount:    req.Amount,
@@ -852,31 +1286,204 @@ func (s *Server) FundWallet(w http.ResponseWriter, r *http.Request) {
 // versioning is prefixed on all routes.
 func (s *Server) Router() http.Handler {
 	r := mux.NewRouter()
+	r.Use(s.withMetrics)
+	r.Use(s.withTenant)
+	r.Use(s.withReadOnly)
+	r.Use(s.withMaintenance)
+	r.Use(s.withAudit)
+	r.Use(s.withDeadline)
+	r.HandleFunc("/metrics", s.Metrics).Methods("GET")
 	api := r.PathPrefix("/api/v1").Subrouter()
 
 	api.HandleFunc("/register", s.Register).Methods("POST")
 	api.HandleFunc("/health", s.Health).Methods("GET")
-	api.HandleFunc("/admin/fund", s.FundWallet).Methods("POST")
+	api.HandleFunc("/ready", s.Ready).Methods("GET")
+	api.HandleFunc("/ws", s.Feed).Methods("GET")
+	api.HandleFunc("/p2p/tip", s.PeerTip).Methods("GET")
+	api.HandleFunc("/p2p/headers", s.PeerHeaders).Methods("GET")
+	api.HandleFunc("/p2p/blocks", s.PeerBlocks).Methods("GET")
+	api.HandleFunc("/p2p/announce", s.PeerAnnounce).Methods("POST")
+	api.HandleFunc("/webhooks/whatsapp", s.VerifyWhatsAppWebhook).Methods("GET")
+	api.HandleFunc("/webhooks/whatsapp", s.WhatsAppWebhook).Methods("POST")
+	api.HandleFunc("/webhooks/payouts/{method}", s.PayoutWebhook).Methods("POST")
+	api.HandleFunc("/admin/fund", s.requireRole(roleFunds, s.FundWallet)).Methods("POST")
+	if testnetMode() {
+		logFaucetConfig()
+		api.HandleFunc("/faucet", s.Faucet).Methods("POST")
+	}
+	if sandboxMode() {
+		api.HandleFunc("/sandbox/info", s.SandboxInfo).Methods("GET")
+	}
 
-    api.HandleFunc("/auth/request-otp", s.RequestOTP).Methods("POST")
-api.HandleFunc("/auth/verify-otp", s.VerifyOTP).Methods("POST")
+	api.HandleFunc("/auth/request-otp", s.limitRate(rateOTP, s.RequestOTP)).Methods("POST")
+	api.HandleFunc("/auth/verify-otp", s.limitRate(rateOTP, s.VerifyOTP)).Methods("POST")
+	api.HandleFunc("/auth/webauthn/register/begin", s.requireSession(s.BeginPasskeyRegistration)).Methods("POST")
+	api.HandleFunc("/auth/webauthn/register/finish", s.requireSession(s.FinishPasskeyRegistration)).Methods("POST")
+	api.HandleFunc("/auth/webauthn/login/begin", s.BeginPasskeyLogin).Methods("POST")
+	api.HandleFunc("/auth/webauthn/login/finish", s.FinishPasskeyLogin).Methods("POST")
+	api.HandleFunc("/auth/webauthn/credentials", s.requireSession(s.ListPasskeys)).Methods("GET")
+	api.HandleFunc("/me/bootstrap", s.requireSession(s.Bootstrap)).Methods("GET")
+	api.HandleFunc("/me/pin", s.requireSession(s.GetPINStatus)).Methods("GET")
+	api.HandleFunc("/me/pin", s.requireSession(s.SetPIN)).Methods("PUT")
+	api.HandleFunc("/me/pin", s.requireSession(s.DeletePIN)).Methods("DELETE")
+	api.HandleFunc("/me/pin/reset", s.requireSession(s.limitRate(rateOTP, s.ResetPIN))).Methods("POST")
+	api.HandleFunc("/transfers/held/{id}/cancel", s.ShowHeldTransferCancel).Methods("GET")
+	api.HandleFunc("/transfers/held/{id}/cancel", s.CancelHeldTransfer).Methods("POST")
 
 
 	// Zakat endpoint
-	api.HandleFunc("/zakat/run", s.RunZakat).Methods("POST")
+	api.HandleFunc("/zakat/run", s.requireRole(roleZakat, s.RunZakat)).Methods("POST")
+	api.HandleFunc("/zakat/runs/{id}", s.GetZakatRun).Methods("GET")
+	api.HandleFunc("/zakat/schedule", s.GetZakatSchedule).Methods("GET")
+	api.HandleFunc("/zakat/runs/{id}/resume", s.requireRole(roleZakat, s.ResumeZakatRun)).Methods("POST")
+	api.HandleFunc("/zakat/runs/{id}/confirm", s.requireRole(roleZakat, s.ConfirmZakatRun)).Methods("POST")
+	api.HandleFunc("/zakat/runs/{id}/verify", s.VerifyZakatRun).Methods("GET")
+	api.HandleFunc("/zakat/policy", s.GetZakatPolicy).Methods("GET")
+	api.HandleFunc("/zakat/policy", s.requireRole(roleZakat, s.SaveZakatPolicy)).Methods("PUT")
+	api.HandleFunc("/zakat/policy/versions", s.ListZakatPolicyVersions).Methods("GET")
+	api.HandleFunc("/zakat/distribute", s.requireRole(roleZakat, s.DistributeZakat)).Methods("POST")
+	api.HandleFunc("/zakat/disbursements", s.requireAdmin(s.ListDisbursements)).Methods("GET")
+	api.HandleFunc("/admin/payouts", s.requireAdmin(s.ListPayouts)).Methods("GET")
+	api.HandleFunc("/admin/payouts/{id}/retry", s.requireRole(roleZakat, s.RetryPayout)).Methods("POST")
+	api.HandleFunc("/admin/cold-storage", s.requireRole(roleFunds, s.GetColdStorage)).Methods("GET")
+	api.HandleFunc("/admin/cold-transfers", s.requireRole(roleFunds, s.CreateColdTransfer)).Methods("POST")
+	api.HandleFunc("/admin/cold-transfers", s.requireRole(roleFunds, s.ListColdTransfers)).Methods("GET")
+	api.HandleFunc("/admin/cold-transfers/{id}", s.requireRole(roleFunds, s.GetColdTransfer)).Methods("GET")
+	api.HandleFunc("/admin/cold-transfers/{id}/approve", s.requireRole(roleFunds, s.ApproveColdTransfer)).Methods("POST")
+	api.HandleFunc("/admin/cold-transfers/{id}/reject", s.requireRole(roleFunds, s.RejectColdTransfer)).Methods("POST")
+	api.HandleFunc("/admin/cold-transfers/{id}/execute", s.requireRole(roleFunds, s.ExecuteColdTransfer)).Methods("POST")
+	api.HandleFunc("/zakat/receipts/{id}", s.GetReceipt).Methods("GET")
+	api.HandleFunc("/zakat/receipts/{id}/pdf", s.GetReceiptPDF).Methods("GET")
+	api.HandleFunc("/users/{id}/zakat", s.requireSessionOrAdmin(s.UserZakat)).Methods("GET")
+	api.HandleFunc("/users/{id}/preferences", s.requireSession(s.GetPreferences)).Methods("GET")
+	api.HandleFunc("/users/{id}/preferences", s.requireSession(s.UpdatePreferences)).Methods("PUT")
+	api.HandleFunc("/admin/rebuild", s.requireAdmin(s.AdminRebuild)).Methods("POST")
+	api.HandleFunc("/admin/jobs/{id}", s.requireAdmin(s.GetAdminJob)).Methods("GET")
+	api.HandleFunc("/admin/persistence/failures", s.requireAdmin(s.ListPersistenceFailures)).Methods("GET")
+	api.HandleFunc("/admin/utxo-snapshot", s.requireAdmin(s.UTXOSnapshot)).Methods("GET")
+	api.HandleFunc("/admin/flags", s.requireAdmin(s.ListFeatureFlags)).Methods("GET")
+	api.HandleFunc("/admin/maintenance", s.requireAdmin(s.GetMaintenance)).Methods("GET")
+	api.HandleFunc("/admin/selfcheck", s.requireAdmin(s.SelfCheck)).Methods("POST")
+	api.HandleFunc("/admin/metrics/database", s.requireAdmin(s.DatabaseMetrics)).Methods("GET")
+	api.HandleFunc("/admin/search", s.requireAdmin(s.AdminSearch)).Methods("GET")
+	api.HandleFunc("/admin/audit", s.requireAdmin(s.ListAPIAudit)).Methods("GET")
+	api.HandleFunc("/admin/clusters", s.requireAdmin(s.ListAddressClusters)).Methods("GET")
+	api.HandleFunc("/admin/clusters/build", s.requireAdmin(s.BuildAddressClusters)).Methods("POST")
+	api.HandleFunc("/admin/clusters/address/{address}", s.requireAdmin(s.GetAddressCluster)).Methods("GET")
+	api.HandleFunc("/admin/maintenance", s.requireAdmin(s.SetMaintenance)).Methods("PUT")
+	api.HandleFunc("/admin/flags/{key}", s.requireAdmin(s.SetFeatureFlag)).Methods("PUT")
+	api.HandleFunc("/admin/email-templates", s.requireAdmin(s.ListEmailTemplates)).Methods("GET")
+	api.HandleFunc("/admin/digests/subscription", s.requireAdmin(s.GetDigestSubscription)).Methods("GET")
+	api.HandleFunc("/admin/digests/subscription", s.requireAdmin(s.SaveDigestSubscription)).Methods("PUT")
+	api.HandleFunc("/admin/digests/preview", s.requireAdmin(s.PreviewDigest)).Methods("GET")
+	api.HandleFunc("/admin/email-templates/{name}", s.requireAdmin(s.SaveEmailTemplate)).Methods("PUT")
+	api.HandleFunc("/admin/email-templates/{name}/preview", s.requireAdmin(s.PreviewEmailTemplate)).Methods("POST")
+	api.HandleFunc("/admin/transactions/{txid}/notes", s.requireAdmin(s.AnnotateTransaction)).Methods("PATCH")
+	api.HandleFunc("/admin/transactions/{txid}/notes", s.requireAdmin(s.GetTransactionNotes)).Methods("GET")
+	api.HandleFunc("/admin/anchors", s.requireAdmin(s.AnchorChain)).Methods("POST")
+	api.HandleFunc("/anchors", s.ListChainAnchors).Methods("GET")
+	api.HandleFunc("/admin/bridge/deposits", s.requireAdmin(s.ListBridgeDeposits)).Methods("GET")
+	api.HandleFunc("/anchors/{id}", s.GetChainAnchor).Methods("GET")
+	api.HandleFunc("/anchors/{id}/verify", s.VerifyChainAnchor).Methods("GET")
+	api.HandleFunc("/anchors/{id}/ots", s.GetChainAnchorOTS).Methods("GET")
+	api.HandleFunc("/solvency/epochs", s.requireAdmin(s.CreateSolvencyEpoch)).Methods("POST")
+	api.HandleFunc("/solvency/epochs/{id}", s.GetSolvencyEpoch).Methods("GET")
+	api.HandleFunc("/solvency/epochs/{id}/proofs/{beneficiaryID}", s.GetSolvencyProof).Methods("GET")
+
+	// Beneficiary endpoints
+	api.HandleFunc("/beneficiaries", s.requireAdmin(s.CreateBeneficiary)).Methods("POST")
+	api.HandleFunc("/beneficiaries/ranked", s.requireRole(roleZakat, s.RankedBeneficiaries)).Methods("GET")
+	api.HandleFunc("/beneficiaries/{id}/assessment", s.requireRole(roleZakat, s.UpdateBeneficiaryAssessment)).Methods("PUT")
+	api.HandleFunc("/beneficiaries", s.requireAdmin(s.ListBeneficiaries)).Methods("GET")
+	api.HandleFunc("/beneficiaries/{id}", s.requireAdmin(s.GetBeneficiary)).Methods("GET")
+	api.HandleFunc("/beneficiaries/{id}", s.requireAdmin(s.UpdateBeneficiary)).Methods("PATCH")
+	api.HandleFunc("/beneficiaries/{id}", s.requireAdmin(s.DeleteBeneficiary)).Methods("DELETE")
+	api.HandleFunc("/disbursements/{txid}/acknowledgement/challenge", s.RequestDisbursementAck).Methods("POST")
+	api.HandleFunc("/disbursements/{txid}/acknowledgement", s.AcknowledgeDisbursement).Methods("POST")
+
+	// Disbursement templates: fixed splits paid from the zakat pool
+	api.HandleFunc("/admin/disbursement-templates", s.requireAdmin(s.CreateDisbursementTemplate)).Methods("POST")
+	api.HandleFunc("/admin/disbursement-templates", s.requireAdmin(s.ListDisbursementTemplates)).Methods("GET")
+	api.HandleFunc("/admin/disbursement-templates/{id}", s.requireAdmin(s.GetDisbursementTemplate)).Methods("GET")
+	api.HandleFunc("/admin/disbursement-templates/{id}", s.requireAdmin(s.UpdateDisbursementTemplate)).Methods("PUT")
+	api.HandleFunc("/admin/disbursement-templates/{id}", s.requireAdmin(s.DeleteDisbursementTemplate)).Methods("DELETE")
+	api.HandleFunc("/admin/disbursement-templates/{id}/execute", s.requireRole(roleZakat, s.ExecuteDisbursementTemplate)).Methods("POST")
+
+	// Tenant (organization) endpoints
+	api.HandleFunc("/tenants", s.requireAdmin(s.CreateTenant)).Methods("POST")
+	api.HandleFunc("/tenants", s.ListTenants).Methods("GET")
+	api.HandleFunc("/tenants/{id}/users/{userID}/role", s.requireTenantAdmin(s.SetTenantUserRole)).Methods("PUT")
+	api.HandleFunc("/tenants/{id}/branding", s.requireTenantAdmin(s.SetTenantBranding)).Methods("PUT")
+	api.HandleFunc("/admin/tenants/{id}/profile", s.requireAdmin(s.SetTenantProfile)).Methods("PUT")
+
+	// Donation portal: public, cacheable browsing of campaigns and organizations
+	api.HandleFunc("/admin/campaigns", s.requireAdmin(s.CreateCampaign)).Methods("POST")
+	api.HandleFunc("/admin/campaigns/{id}", s.requireAdmin(s.UpdateCampaign)).Methods("PATCH")
+	api.HandleFunc("/admin/declarations", s.requireAdmin(s.ExportDeclarations)).Methods("GET")
+	api.HandleFunc("/public/campaigns", s.ListPublicCampaigns).Methods("GET")
+	api.HandleFunc("/public/campaigns/{id}", s.GetPublicCampaign).Methods("GET")
+	api.HandleFunc("/public/organizations", s.ListPublicOrganizations).Methods("GET")
+
+	// Pledges: commit to a campaign now, paid from a wallet on the due date
+	api.HandleFunc("/pledges", s.requireSession(s.CreatePledge)).Methods("POST")
+	api.HandleFunc("/pledges", s.requireSession(s.ListPledges)).Methods("GET")
+	api.HandleFunc("/pledges/{id}", s.requireSession(s.GetPledge)).Methods("GET")
+	api.HandleFunc("/pledges/{id}", s.requireSession(s.CancelPledge)).Methods("DELETE")
 
 	// Wallet endpoints
 	api.HandleFunc("/wallets", s.CreateWallet).Methods("POST")
+	api.HandleFunc("/wallets/hd", s.CreateHDWallet).Methods("POST")
+	api.HandleFunc("/wallets/hd/derive", s.DeriveHDWallet).Methods("POST")
+	api.HandleFunc("/wallets/hd/recover", s.RecoverHDWallet).Methods("POST")
 	api.HandleFunc("/wallets/{address}/balance", s.GetBalance).Methods("GET")
 	api.HandleFunc("/wallets/{address}/transactions", s.GetWalletTransactions).Methods("GET")
+	api.HandleFunc("/wallets/{address}/sync", s.SyncWallet).Methods("GET")
+	api.HandleFunc("/wallets/{address}/privacy", s.AddressPrivacy).Methods("GET")
+	api.HandleFunc("/wallets/{address}/settings", s.requireSession(s.UpdateWalletSettings)).Methods("PUT")
+	api.HandleFunc("/wallets/{address}/deactivate", s.requireSessionOrAdmin(s.DeactivateWallet)).Methods("POST")
+	api.HandleFunc("/wallets/{address}/view-keys", s.requireSession(s.CreateViewKey)).Methods("POST")
+	api.HandleFunc("/wallets/{address}/view-keys", s.requireSession(s.ListViewKeys)).Methods("GET")
+	api.HandleFunc("/wallets/{address}/view-keys/{id}", s.requireSession(s.RevokeViewKey)).Methods("DELETE")
+	api.HandleFunc("/view/wallet", s.ViewWallet).Methods("GET")
+	api.HandleFunc("/wallets/{address}/handle", s.GetWalletHandle).Methods("GET")
+	api.HandleFunc("/wallets/{address}/handle", s.requireSession(s.ClaimHandle)).Methods("POST")
+	api.HandleFunc("/wallets/{address}/handle", s.requireSession(s.TransferHandle)).Methods("PUT")
+	api.HandleFunc("/wallets/{address}/handle", s.requireSession(s.ReleaseHandle)).Methods("DELETE")
+	api.HandleFunc("/resolve/{handle}", s.ResolveHandle).Methods("GET")
 
 	// Transaction endpoint
-	api.HandleFunc("/transactions", s.SendTransaction).Methods("POST")
+	api.HandleFunc("/transactions", s.limitRate(rateTx, s.SendTransaction)).Methods("POST")
+	api.HandleFunc("/transactions/prepare", s.PrepareTransaction).Methods("POST")
+	api.HandleFunc("/transactions/submit", s.limitRate(rateTx, s.SubmitTransaction)).Methods("POST")
+	api.HandleFunc("/transactions/decode", s.DecodeTransaction).Methods("POST")
+	api.HandleFunc("/transactions/offline-batch", s.limitRate(rateTx, s.SubmitOfflineBatch)).Methods("POST")
+	api.HandleFunc("/transactions/{txid}/receipt", s.GetTransactionReceipt).Methods("GET")
+	api.HandleFunc("/transactions/{txid}/status", s.GetTransactionStatus).Methods("GET")
+	api.HandleFunc("/transactions/{txid}/tag", s.requireSession(s.TagTransaction)).Methods("PUT")
+	api.HandleFunc("/transactions/{txid}/declaration", s.requireSession(s.CreateDeclaration)).Methods("POST")
+	api.HandleFunc("/transactions/{txid}/declaration", s.requireSession(s.WithdrawDeclaration)).Methods("DELETE")
+	api.HandleFunc("/invitations", s.CreateInvitation).Methods("POST")
+	api.HandleFunc("/invitations", s.requireSession(s.ListInvitations)).Methods("GET")
+
+	// Fiat rates and conversion
+	api.HandleFunc("/rates", s.GetRates).Methods("GET")
+	api.HandleFunc("/convert", s.Convert).Methods("POST")
+
+	// Stealth (one-time) receive addresses
+	api.HandleFunc("/stealth/requests", s.CreateStealthRequest).Methods("POST")
+	api.HandleFunc("/stealth/scan", s.ScanStealth).Methods("POST")
+	api.HandleFunc("/stealth/claim", s.ClaimStealth).Methods("POST")
 
 	// Block explorer endpoints
+	api.HandleFunc("/chain", s.ChainInfo).Methods("GET")
 	api.HandleFunc("/blocks", s.ListBlocks).Methods("GET")
+	api.HandleFunc("/mempool", s.ListMempool).Methods("GET")
 	api.HandleFunc("/blocks/{index}", s.GetBlock).Methods("GET")
+	api.HandleFunc("/explorer/address/{address}", s.ExplorerAddress).Methods("GET")
+	api.HandleFunc("/explorer/charts/{metric}", s.ExplorerChart).Methods("GET")
 	api.HandleFunc("/reports/wallet/{address}", s.WalletReport).Methods("GET")
+	api.HandleFunc("/reports/annual", s.AnnualReport).Methods("GET")
+	api.HandleFunc("/reports/tax-summary", s.requireSession(s.TaxSummary)).Methods("GET")
 api.HandleFunc("/logs/system", s.SystemLogs).Methods("GET")
 
 
@@ -0,0 +1,110 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/testutil"
+)
+
+// balanceBody is the response of GET /wallets/{address}/balance.
+type balanceBody struct {
+	Balance int `json:"balance"`
+}
+
+func balanceOf(t *testing.T, h http.Handler, w *blockchain.Wallet) int {
+	t.Helper()
+	var body balanceBody
+	testutil.DecodeJSON(t, testutil.Do(t, h, "GET", "/wallets/"+w.GetAddress()+"/balance", nil), http.StatusOK, &body)
+	return body.Balance
+}
+
+func TestGetBalance(t *testing.T) {
+	c := testutil.NewChain(t)
+	alice := testutil.Wallet("alice")
+	c.Fund(t, alice)
+	h := testutil.NewServer(t, c).Router()
+
+	if got, want := balanceOf(t, h, alice), c.Balance(alice); got != want {
+		t.Errorf("balance of funded wallet = %d, want %d", got, want)
+	}
+	if got := balanceOf(t, h, testutil.Wallet("bob")); got != 0 {
+		t.Errorf("balance of unfunded wallet = %d, want 0", got)
+	}
+
+	rec := testutil.Do(t, h, "GET", "/wallets/not-an-address/balance", nil)
+	testutil.DecodeJSON(t, rec, http.StatusBadRequest, nil)
+}
+
+func TestSendTransaction(t *testing.T) {
+	c := testutil.NewChain(t)
+	alice, bob := testutil.Wallet("alice"), testutil.Wallet("bob")
+	c.Fund(t, alice)
+	funded := c.Balance(alice)
+	h := testutil.NewServer(t, c).Router()
+
+	var receipt struct {
+		Status      string `json:"status"`
+		TxID        string `json:"txid"`
+		BlockHeight int    `json:"block_height"`
+		From        string `json:"from"`
+		To          string `json:"to"`
+		Amount      int    `json:"amount"`
+	}
+	rec := testutil.Do(t, h, "POST", "/transactions", map[string]interface{}{
+		"from":    alice.GetAddress(),
+		"to":      bob.GetAddress(),
+		"amount":  1200,
+		"privKey": testutil.PrivateKeyHex(alice),
+	})
+	testutil.DecodeJSON(t, rec, http.StatusOK, &receipt)
+
+	if receipt.Status != "transaction mined" || receipt.TxID == "" {
+		t.Fatalf("receipt = %+v, want a mined transaction", receipt)
+	}
+	if receipt.From != alice.GetAddress() || receipt.To != bob.GetAddress() || receipt.Amount != 1200 {
+		t.Errorf("receipt = %+v, want 1200 from alice to bob", receipt)
+	}
+	if tip := len(c.BC.Blocks) - 1; receipt.BlockHeight != tip {
+		t.Errorf("block height = %d, want the tip %d", receipt.BlockHeight, tip)
+	}
+	if got := balanceOf(t, h, bob); got != 1200 {
+		t.Errorf("bob's balance = %d, want 1200", got)
+	}
+	if got := balanceOf(t, h, alice); got != funded-1200 {
+		t.Errorf("alice's balance = %d, want %d", got, funded-1200)
+	}
+}
+
+func TestSendTransactionRejects(t *testing.T) {
+	c := testutil.NewChain(t)
+	alice, bob := testutil.Wallet("alice"), testutil.Wallet("bob")
+	c.Fund(t, alice)
+	h := testutil.NewServer(t, c).Router()
+	height := len(c.BC.Blocks)
+
+	tests := []struct {
+		name string
+		body map[string]interface{}
+		want int
+	}{
+		{"key of another wallet", map[string]interface{}{
+			"from": alice.GetAddress(), "to": bob.GetAddress(), "amount": 10, "privKey": testutil.PrivateKeyHex(bob),
+		}, http.StatusForbidden},
+		{"more than the balance", map[string]interface{}{
+			"from": alice.GetAddress(), "to": bob.GetAddress(), "amount": c.Balance(alice) + 1, "privKey": testutil.PrivateKeyHex(alice),
+		}, http.StatusBadRequest},
+		{"invalid key", map[string]interface{}{
+			"from": alice.GetAddress(), "to": bob.GetAddress(), "amount": 10, "privKey": "zz",
+		}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.DecodeJSON(t, testutil.Do(t, h, "POST", "/transactions", tt.body), tt.want, nil)
+		})
+	}
+	if len(c.BC.Blocks) != height {
+		t.Errorf("chain grew to %d blocks, want %d", len(c.BC.Blocks), height)
+	}
+}
@@ -0,0 +1,368 @@
+package api
+
+// handles.go lets users claim a human-readable handle such as @amna for
+// a registered wallet they own. Anyone can resolve a handle to its
+// address, and POST /transactions accepts "@handle" in place of a raw
+// to address. A wallet has at most one handle and a handle points at
+// one wallet. The owner can move the handle to another wallet of theirs
+// or release it; a released handle is held back for HANDLE_HOLD_DAYS,
+// during which only its previous owner may claim it again, so payments
+// meant for them do not reach a newcomer.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+)
+
+const defaultHandleHoldDays = 30
+
+// handlePattern accepts 3 to 20 lower case letters, digits and
+// underscores starting with a letter.
+var handlePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{2,19}$`)
+
+// reservedHandles could be mistaken for the service itself.
+var reservedHandles = map[string]bool{
+	"admin":     true,
+	"support":   true,
+	"zakat":     true,
+	"zakatpool": true,
+	"pool":      true,
+	"faucet":    true,
+	"system":    true,
+	"treasury":  true,
+}
+
+// handleHoldPeriod is how long a released handle is held back
+// (HANDLE_HOLD_DAYS, default 30 days, 0 to free it at once).
+func handleHoldPeriod() time.Duration {
+	days := defaultHandleHoldDays
+	if v := os.Getenv("HANDLE_HOLD_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			days = n
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// normalizeHandle lower-cases a handle and strips a leading @. It
+// reports false when the result is not a valid handle.
+func normalizeHandle(raw string) (string, bool) {
+	h := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(raw), "@"))
+	return h, handlePattern.MatchString(h)
+}
+
+type claimHandleRequest struct {
+	Handle string `json:"handle"`
+}
+
+type transferHandleRequest struct {
+	ToAddress string `json:"to_address"`
+}
+
+type handleResponse struct {
+	Handle        string    `json:"handle"` // with the @
+	WalletAddress string    `json:"wallet_address"`
+	Status        string    `json:"status,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at,omitempty"`
+}
+
+func newHandleResponse(h *models.WalletHandle) handleResponse {
+	return handleResponse{
+		Handle:        "@" + h.Handle,
+		WalletAddress: h.WalletAddress,
+		Status:        h.Status,
+		UpdatedAt:     h.UpdatedAt,
+	}
+}
+
+// resolveRecipient turns "@handle" into the address it points at;
+// anything else is returned unchanged. On failure it writes the error
+// response and returns false.
+func (s *Server) resolveRecipient(w http.ResponseWriter, r *http.Request, to string) (string, bool) {
+	ctx := r.Context()
+
+	if !strings.HasPrefix(to, "@") {
+		return to, true
+	}
+	handle, ok := normalizeHandle(to)
+	if !ok {
+		httpError(w, r, "invalid handle", http.StatusBadRequest)
+		return "", false
+	}
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return "", false
+	}
+	h, err := s.DB.GetWalletHandle(ctx, handle)
+	if err != nil {
+		httpError(w, r, "failed to resolve handle", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "wallet_handle_get_failed", err.Error(), r.RemoteAddr)
+		return "", false
+	}
+	if h == nil || h.Status != models.HandleActive {
+		httpError(w, r, "handle not found", http.StatusNotFound)
+		return "", false
+	}
+	return h.WalletAddress, true
+}
+
+// ResolveHandle returns the wallet address of a handle.
+func (s *Server) ResolveHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	handle, ok := normalizeHandle(mux.Vars(r)["handle"])
+	if !ok {
+		httpError(w, r, "invalid handle", http.StatusBadRequest)
+		return
+	}
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	h, err := s.DB.GetWalletHandle(ctx, handle)
+	if err != nil {
+		httpError(w, r, "failed to resolve handle", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "wallet_handle_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if h == nil || h.Status != models.HandleActive {
+		httpError(w, r, "handle not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(handleResponse{Handle: "@" + h.Handle, WalletAddress: h.WalletAddress})
+}
+
+// GetWalletHandle returns the handle of a wallet.
+func (s *Server) GetWalletHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	address := mux.Vars(r)["address"]
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	if !blockchain.ValidateAddress(address) {
+		httpError(w, r, "invalid address", http.StatusBadRequest)
+		return
+	}
+	h, err := s.DB.GetWalletHandleByAddress(ctx, address)
+	if err != nil {
+		httpError(w, r, "failed to load handle", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "wallet_handle_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if h == nil {
+		httpError(w, r, "wallet has no handle", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(newHandleResponse(h))
+}
+
+// ClaimHandle gives the session user's wallet a handle.
+func (s *Server) ClaimHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	address := mux.Vars(r)["address"]
+
+	var req claimHandleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	handle, ok := normalizeHandle(req.Handle)
+	if !ok {
+		httpError(w, r, "invalid handle", http.StatusBadRequest)
+		return
+	}
+	if reservedHandles[handle] {
+		httpError(w, r, "handle is reserved", http.StatusConflict)
+		return
+	}
+	if !s.requireWalletOwner(w, r, address) {
+		return
+	}
+	userID := sessionFrom(ctx).Subject
+
+	s.handleMu.Lock()
+	defer s.handleMu.Unlock()
+
+	current, err := s.DB.GetWalletHandleByAddress(ctx, address)
+	if err != nil {
+		httpError(w, r, "failed to load handle", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "wallet_handle_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if current != nil {
+		httpError(w, r, "wallet already has a handle", http.StatusConflict)
+		return
+	}
+	prev, err := s.DB.GetWalletHandle(ctx, handle)
+	if err != nil {
+		httpError(w, r, "failed to load handle", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "wallet_handle_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	now := s.Clock.Now().UTC()
+	if prev != nil {
+		if prev.Status == models.HandleActive {
+			httpError(w, r, "handle is taken", http.StatusConflict)
+			return
+		}
+		held := prev.ReleasedAt != nil && now.Before(prev.ReleasedAt.Add(handleHoldPeriod()))
+		if held && prev.UserID != userID {
+			httpError(w, r, "handle was released recently", http.StatusConflict)
+			return
+		}
+	}
+
+	h := &models.WalletHandle{
+		ID:            uuid.NewString(),
+		Handle:        handle,
+		TenantID:      tenantID(ctx),
+		WalletAddress: address,
+		UserID:        userID,
+		Status:        models.HandleActive,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := s.DB.CreateWalletHandle(ctx, h); err != nil {
+		httpError(w, r, "failed to claim handle", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "wallet_handle_create_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	s.logEvent(ctx, "info", "wallet_handle_claimed",
+		fmt.Sprintf("handle @%s claimed for wallet %s", handle, address), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(newHandleResponse(h))
+}
+
+// TransferHandle moves a wallet's handle to another wallet of the same
+// user.
+func (s *Server) TransferHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	address := mux.Vars(r)["address"]
+
+	var req transferHandleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !blockchain.ValidateAddress(req.ToAddress) {
+		httpError(w, r, "invalid address", http.StatusBadRequest)
+		return
+	}
+	if req.ToAddress == address {
+		httpError(w, r, "to_address must be another wallet", http.StatusBadRequest)
+		return
+	}
+	if !s.requireWalletOwner(w, r, address) || !s.requireWalletOwner(w, r, req.ToAddress) {
+		return
+	}
+
+	s.handleMu.Lock()
+	defer s.handleMu.Unlock()
+
+	h, err := s.DB.GetWalletHandleByAddress(ctx, address)
+	if err != nil {
+		httpError(w, r, "failed to load handle", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "wallet_handle_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if h == nil {
+		httpError(w, r, "wallet has no handle", http.StatusNotFound)
+		return
+	}
+	target, err := s.DB.GetWalletHandleByAddress(ctx, req.ToAddress)
+	if err != nil {
+		httpError(w, r, "failed to load handle", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "wallet_handle_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if target != nil {
+		httpError(w, r, "wallet already has a handle", http.StatusConflict)
+		return
+	}
+
+	h.WalletAddress = req.ToAddress
+	h.UpdatedAt = s.Clock.Now().UTC()
+	if !s.updateHandle(w, r, h) {
+		return
+	}
+	s.logEvent(ctx, "info", "wallet_handle_transferred",
+		fmt.Sprintf("handle @%s moved from wallet %s to %s", h.Handle, address, req.ToAddress), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(newHandleResponse(h))
+}
+
+// ReleaseHandle gives up a wallet's handle.
+func (s *Server) ReleaseHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	address := mux.Vars(r)["address"]
+
+	if !s.requireWalletOwner(w, r, address) {
+		return
+	}
+
+	s.handleMu.Lock()
+	defer s.handleMu.Unlock()
+
+	h, err := s.DB.GetWalletHandleByAddress(ctx, address)
+	if err != nil {
+		httpError(w, r, "failed to load handle", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "wallet_handle_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if h == nil {
+		httpError(w, r, "wallet has no handle", http.StatusNotFound)
+		return
+	}
+
+	now := s.Clock.Now().UTC()
+	h.Status = models.HandleReleased
+	h.UpdatedAt = now
+	h.ReleasedAt = &now
+	if !s.updateHandle(w, r, h) {
+		return
+	}
+	s.logEvent(ctx, "info", "wallet_handle_released",
+		fmt.Sprintf("handle @%s of wallet %s released", h.Handle, address), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(newHandleResponse(h))
+}
+
+// updateHandle stores a change to an active handle. On failure it
+// writes the error response and returns false.
+func (s *Server) updateHandle(w http.ResponseWriter, r *http.Request, h *models.WalletHandle) bool {
+	ctx := r.Context()
+
+	found, err := s.DB.UpdateWalletHandle(ctx, h)
+	if err != nil {
+		httpError(w, r, "failed to update handle", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "wallet_handle_update_failed", err.Error(), r.RemoteAddr)
+		return false
+	}
+	if !found {
+		httpError(w, r, "wallet has no handle", http.StatusNotFound)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,227 @@
+package api
+
+// hd_wallets.go creates and recovers hierarchical deterministic
+// wallets (see blockchain/hdwallet.go). A new HD wallet is a BIP‑39
+// mnemonic; its addresses are derived from the mnemonic, an optional
+// passphrase and an account number, by index. Like POST /wallets, the
+// server keeps nothing: the mnemonic and the derived private keys are
+// returned to the client, which must store them.
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+const (
+	defaultMnemonicWords = 12
+	maxHDDerive          = 100
+	defaultHDGapLimit    = 20
+)
+
+type hdWalletRequest struct {
+	Words      int    `json:"words"` // 12 (default), 15, 18, 21 or 24
+	Passphrase string `json:"passphrase"`
+	Account    int    `json:"account"`
+	Count      int    `json:"count"` // addresses to derive, default 1
+}
+
+type hdDeriveRequest struct {
+	Mnemonic   string `json:"mnemonic"`
+	Passphrase string `json:"passphrase"`
+	Account    int    `json:"account"`
+	Start      int    `json:"start"` // first index
+	Count      int    `json:"count"` // default 1
+}
+
+type hdRecoverRequest struct {
+	Mnemonic   string `json:"mnemonic"`
+	Passphrase string `json:"passphrase"`
+	Account    int    `json:"account"`
+	GapLimit   int    `json:"gap_limit"` // unused addresses in a row that end the scan, default 20
+}
+
+type hdAddress struct {
+	Index      int    `json:"index"`
+	Path       string `json:"path"`
+	Address    string `json:"address"`
+	PrivateKey string `json:"private_key"`
+	Balance    *int   `json:"balance,omitempty"`  // recovery only
+	TxCount    *int   `json:"tx_count,omitempty"` // recovery only
+}
+
+type hdWalletResponse struct {
+	Mnemonic  string      `json:"mnemonic,omitempty"` // only when the wallet is created
+	Account   int         `json:"account"`
+	Path      string      `json:"path"` // of the account; address i is at path/i
+	Addresses []hdAddress `json:"addresses"`
+	NextIndex *int        `json:"next_index,omitempty"` // recovery: the first index after the last used one
+	Scanned   int         `json:"scanned,omitempty"`    // recovery: addresses checked
+}
+
+func validHDRange(account, start, count int) bool {
+	return account >= 0 && uint64(account) <= uint64(blockchain.MaxHDIndex) &&
+		start >= 0 && count >= 1 && count <= maxHDDerive &&
+		uint64(start+count-1) <= uint64(blockchain.MaxHDIndex)
+}
+
+func validMnemonicWords(words int) bool {
+	for _, n := range blockchain.MnemonicWordCounts {
+		if n == words {
+			return true
+		}
+	}
+	return false
+}
+
+// hdAddressAt returns wallet index of the account key.
+func hdAddressAt(account *blockchain.HDKey, path string, index int) hdAddress {
+	wallet := account.Child(uint32(index)).Wallet()
+	return hdAddress{
+		Index:      index,
+		Path:       fmt.Sprintf("%s/%d", path, index),
+		Address:    wallet.GetAddress(),
+		PrivateKey: hex.EncodeToString(wallet.PrivateKey.D.Bytes()),
+	}
+}
+
+// deriveHD derives count addresses of the account from index start.
+func deriveHD(mnemonic, passphrase string, account, start, count int) (hdWalletResponse, error) {
+	key, err := blockchain.HDAccountKey(blockchain.MnemonicSeed(mnemonic, passphrase), uint32(account))
+	if err != nil {
+		return hdWalletResponse{}, err
+	}
+	resp := hdWalletResponse{Account: account, Path: blockchain.HDAccountPath(uint32(account))}
+	for i := start; i < start+count; i++ {
+		resp.Addresses = append(resp.Addresses, hdAddressAt(key, resp.Path, i))
+	}
+	return resp, nil
+}
+
+// CreateHDWallet generates a mnemonic and returns it with the first
+// addresses of the account.
+func (s *Server) CreateHDWallet(w http.ResponseWriter, r *http.Request) {
+	var req hdWalletRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Words == 0 {
+		req.Words = defaultMnemonicWords
+	}
+	if req.Count == 0 {
+		req.Count = 1
+	}
+	if !validMnemonicWords(req.Words) {
+		httpError(w, r, "words must be 12, 15, 18, 21 or 24", http.StatusBadRequest)
+		return
+	}
+	if !validHDRange(req.Account, 0, req.Count) {
+		httpError(w, r, "invalid derivation range", http.StatusBadRequest)
+		return
+	}
+
+	mnemonic, err := blockchain.NewMnemonic(s.Entropy, req.Words)
+	if err != nil {
+		httpError(w, r, "failed to create wallet", http.StatusInternalServerError)
+		return
+	}
+	resp, err := deriveHD(mnemonic, req.Passphrase, req.Account, 0, req.Count)
+	if err != nil {
+		httpError(w, r, "failed to create wallet", http.StatusInternalServerError)
+		return
+	}
+	resp.Mnemonic = mnemonic
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// DeriveHDWallet returns count addresses of the account of a mnemonic
+// from index start.
+func (s *Server) DeriveHDWallet(w http.ResponseWriter, r *http.Request) {
+	var req hdDeriveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Count == 0 {
+		req.Count = 1
+	}
+	if !blockchain.ValidMnemonic(req.Mnemonic) {
+		httpError(w, r, "invalid mnemonic", http.StatusBadRequest)
+		return
+	}
+	if !validHDRange(req.Account, req.Start, req.Count) {
+		httpError(w, r, "invalid derivation range", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := deriveHD(req.Mnemonic, req.Passphrase, req.Account, req.Start, req.Count)
+	if err != nil {
+		httpError(w, r, "invalid derivation range", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// RecoverHDWallet reconstructs the addresses of the account of a
+// mnemonic: it derives addresses in order until gap_limit in a row
+// have never appeared on chain, and returns those that have, with
+// their balances.
+func (s *Server) RecoverHDWallet(w http.ResponseWriter, r *http.Request) {
+	var req hdRecoverRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.GapLimit == 0 {
+		req.GapLimit = defaultHDGapLimit
+	}
+	if !blockchain.ValidMnemonic(req.Mnemonic) {
+		httpError(w, r, "invalid mnemonic", http.StatusBadRequest)
+		return
+	}
+	if !validHDRange(req.Account, 0, req.GapLimit) {
+		httpError(w, r, "invalid derivation range", http.StatusBadRequest)
+		return
+	}
+
+	key, err := blockchain.HDAccountKey(blockchain.MnemonicSeed(req.Mnemonic, req.Passphrase), uint32(req.Account))
+	if err != nil {
+		httpError(w, r, "invalid derivation range", http.StatusBadRequest)
+		return
+	}
+	resp := hdWalletResponse{
+		Account:   req.Account,
+		Path:      blockchain.HDAccountPath(uint32(req.Account)),
+		Addresses: []hdAddress{},
+	}
+
+	s.syncAddressIndex()
+	next, gap := 0, 0
+	for i := 0; gap < req.GapLimit && uint64(i) <= uint64(blockchain.MaxHDIndex); i++ {
+		a := hdAddressAt(key, resp.Path, i)
+		resp.Scanned++
+		summary, _ := s.addrs.Address(a.Address, 0, 0)
+		if summary.TxCount == 0 {
+			gap++
+			continue
+		}
+		gap = 0
+		a.Balance, a.TxCount = &summary.Balance, &summary.TxCount
+		resp.Addresses = append(resp.Addresses, a)
+		next = i + 1
+	}
+	resp.NextIndex = &next
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,202 @@
+package api
+
+// idempotency.go replays the outcome of a send to retries of it. A
+// client that sends POST /transactions with an Idempotency-Key header
+// (or idempotency_key field) and retries after a timeout gets the
+// response of the first attempt, marked Idempotent-Replayed, rather
+// than a second transfer. Keys are scoped to the sending address and
+// kept for IDEMPOTENCY_TTL hours. The check runs under chainMu, so a
+// retry arriving while the first attempt is still mining waits for its
+// outcome. Only successful responses are kept: a send that failed, or
+// ran out of time before its block was mined, runs again when retried.
+// Outcomes are cached in memory and stored in the idempotency_keys
+// table, with secrets redacted, for the other instances and restarts.
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"wallet_backend_go/internal/models"
+)
+
+const (
+	defaultIdempotencyTTL = 24 // hours
+	maxIdempotencyKeyLen  = 255
+)
+
+// idempotencyHeader names the key of a request.
+const idempotencyHeader = "Idempotency-Key"
+
+// idempotencyTTL is how long an outcome is replayed (IDEMPOTENCY_TTL,
+// hours).
+func idempotencyTTL() time.Duration {
+	return time.Duration(envLimit("IDEMPOTENCY_TTL", defaultIdempotencyTTL)) * time.Hour
+}
+
+// requestIdempotencyKey returns the key of r: the header, or else the
+// key given in the body.
+func requestIdempotencyKey(r *http.Request, field string) string {
+	if k := r.Header.Get(idempotencyHeader); k != "" {
+		return k
+	}
+	return field
+}
+
+// validIdempotencyKey accepts 1 to 255 printable ASCII characters, as
+// UUIDs and most client-generated keys are.
+func validIdempotencyKey(k string) bool {
+	if k == "" || len(k) > maxIdempotencyKeyLen {
+		return false
+	}
+	for i := 0; i < len(k); i++ {
+		if k[i] < 0x21 || k[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// sendRequestHash identifies what a send asks for, so a key reused for
+// a different send is told apart from a retry.
+func sendRequestHash(req txRequest) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d|%d", req.From, req.To, req.Amount, req.Fee)))
+	return hex.EncodeToString(h[:])
+}
+
+// idempotencyCache keeps the outcomes of this instance, unredacted.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	entries map[string]models.IdempotencyKey
+}
+
+func idempotencyCacheKey(scope, key string) string {
+	return scope + "|" + key
+}
+
+func (c *idempotencyCache) get(scope, key string, now time.Time) *models.IdempotencyKey {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k, ok := c.entries[idempotencyCacheKey(scope, key)]
+	if !ok || !now.Before(k.ExpiresAt) {
+		return nil
+	}
+	return &k
+}
+
+// put caches k and drops the expired outcomes.
+func (c *idempotencyCache) put(k models.IdempotencyKey, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]models.IdempotencyKey)
+	}
+	for id, e := range c.entries {
+		if !now.Before(e.ExpiresAt) {
+			delete(c.entries, id)
+		}
+	}
+	c.entries[idempotencyCacheKey(k.Scope, k.Key)] = k
+}
+
+// lookupIdempotent returns the unexpired outcome of key under scope, or
+// nil when the request has not been made.
+func (s *Server) lookupIdempotent(ctx context.Context, scope, key string) (*models.IdempotencyKey, error) {
+	now := s.Clock.Now()
+	if k := s.idempotency.get(scope, key, now); k != nil {
+		return k, nil
+	}
+	if s.DB == nil {
+		return nil, nil
+	}
+	k, err := s.DB.GetIdempotencyKey(ctx, scope, key)
+	if err != nil || k == nil || !now.Before(k.ExpiresAt) {
+		return nil, err
+	}
+	s.idempotency.put(*k, now)
+	return k, nil
+}
+
+// replayIdempotent writes the stored response of k, ended with a
+// newline as json.Encoder ends the original.
+func replayIdempotent(w http.ResponseWriter, k *models.IdempotencyKey) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(k.StatusCode)
+	_, _ = w.Write(k.Response)
+	_, _ = w.Write([]byte("\n"))
+}
+
+// idempotentRecorder keeps the response of a request made with a key.
+type idempotentRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *idempotentRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *idempotentRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(p)
+	return rec.ResponseWriter.Write(p)
+}
+
+// rememberIdempotent keeps the response in rec as the outcome of key,
+// unless it is an error.
+func (s *Server) rememberIdempotent(ctx context.Context, scope, key, requestHash string, rec *idempotentRecorder) {
+	if rec.status < 200 || rec.status > 299 {
+		return
+	}
+	body := bytes.TrimSpace(rec.body.Bytes())
+	var ids struct {
+		TxID      string `json:"txid"`
+		BlockHash string `json:"block_hash"`
+	}
+	_ = json.Unmarshal(body, &ids)
+
+	now := s.Clock.Now().UTC()
+	k := models.IdempotencyKey{
+		Key:         key,
+		TenantID:    tenantID(ctx),
+		Scope:       scope,
+		RequestHash: requestHash,
+		StatusCode:  rec.status,
+		Response:    json.RawMessage(append([]byte(nil), body...)),
+		TxID:        ids.TxID,
+		BlockHash:   ids.BlockHash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(idempotencyTTL()),
+	}
+	s.idempotency.put(k, now)
+	if s.DB == nil {
+		return
+	}
+
+	// the stored copy goes without the cancel links of held transfers
+	var v any
+	if err := json.Unmarshal(body, &v); err == nil {
+		k.Response, _ = json.Marshal(redactJSON(v))
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.DB.SaveIdempotencyKey(ctx, &k); err != nil {
+			log.Printf("failed to save idempotency key of %s: %v", scope, err)
+		}
+	}()
+}
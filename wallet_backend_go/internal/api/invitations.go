@@ -0,0 +1,521 @@
+package api
+
+// invitations.go lets a wallet send to the email address or phone
+// number of someone who has not registered yet. The funds are mined to
+// a one-time escrow address whose key the server generates and keeps
+// (encrypted like wallet keys), and the recipient is invited over email
+// or WhatsApp. Once a user registered with that contact proves they
+// hold it, by verifying the OTP sent to it, the escrow is paid out to
+// their wallet; invitations still pending after
+// INVITATION_EXPIRY_DAYS are refunded to the sending wallet. Only a
+// hash of the contact is stored. Payouts are compare-and-set on the
+// stored row, so a claim and a refund, or two instances, never both
+// spend the escrow.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/i18n"
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/notify"
+)
+
+const (
+	defaultInvitationExpiryDays = 14
+
+	// invitationTick is how often expired invitations are refunded.
+	invitationTick = 5 * time.Minute
+
+	maxInvitationMessage = 140 // characters
+)
+
+// invitationExpiry is how long an invitation waits for its recipient
+// (INVITATION_EXPIRY_DAYS).
+func invitationExpiry() time.Duration {
+	return time.Duration(envLimit("INVITATION_EXPIRY_DAYS", defaultInvitationExpiryDays)) * 24 * time.Hour
+}
+
+type createInvitationRequest struct {
+	From    string `json:"from"`
+	PrivKey string `json:"privKey"`
+	PIN     string `json:"pin,omitempty"`
+	Amount  int    `json:"amount"`
+	Contact string `json:"contact"` // email address or phone number
+	Message string `json:"message"`
+}
+
+// invitationView is an invitation as shown to its sender, without the
+// escrow key.
+type invitationView struct {
+	ID            string     `json:"id"`
+	FromAddress   string     `json:"from_address"`
+	ContactType   string     `json:"contact_type"`
+	Contact       string     `json:"contact"` // masked
+	Amount        int        `json:"amount"`
+	Message       string     `json:"message,omitempty"`
+	EscrowAddress string     `json:"escrow_address"`
+	EscrowTxID    string     `json:"escrow_txid"`
+	Status        string     `json:"status"`
+	ToAddress     string     `json:"to_address,omitempty"`
+	PayoutTxID    string     `json:"payout_txid,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+}
+
+func newInvitationView(inv *models.Invitation) invitationView {
+	return invitationView{
+		ID:            inv.ID,
+		FromAddress:   inv.FromAddress,
+		ContactType:   inv.ContactType,
+		Contact:       inv.ContactMasked,
+		Amount:        inv.Amount,
+		Message:       inv.Message,
+		EscrowAddress: inv.EscrowAddress,
+		EscrowTxID:    inv.EscrowTxID,
+		Status:        inv.Status,
+		ToAddress:     inv.ToAddress,
+		PayoutTxID:    inv.PayoutTxID,
+		CreatedAt:     inv.CreatedAt,
+		ExpiresAt:     inv.ExpiresAt,
+		ResolvedAt:    inv.ResolvedAt,
+	}
+}
+
+type createInvitationResponse struct {
+	invitationView
+	BlockHash string `json:"block_hash"`
+	Invited   bool   `json:"invited"` // false when no channel could deliver the invitation
+}
+
+type invitationListResponse struct {
+	Invitations []invitationView `json:"invitations"`
+}
+
+// normalizeContact returns the contact type and normalized form of an
+// email address or phone number, or false if it is neither.
+func normalizeContact(raw string) (string, string, bool) {
+	raw = strings.TrimSpace(raw)
+	if strings.Contains(raw, "@") {
+		addr, err := mail.ParseAddress(raw)
+		if err != nil || addr.Address != raw {
+			return "", "", false
+		}
+		return models.ContactEmail, strings.ToLower(raw), true
+	}
+	if phone := notify.NormalizePhone(raw); phone != "" {
+		return models.ContactPhone, phone, true
+	}
+	return "", "", false
+}
+
+// contactHash is the stored form of a normalized contact.
+func contactHash(kind, contact string) string {
+	sum := sha256.Sum256([]byte(kind + ":" + contact))
+	return hex.EncodeToString(sum[:])
+}
+
+// maskContact keeps enough of a contact for the sender to recognize it:
+// a***@example.org or ******4567.
+func maskContact(kind, contact string) string {
+	if kind == models.ContactEmail {
+		local, domain, _ := strings.Cut(contact, "@")
+		if local == "" {
+			return "***@" + domain
+		}
+		return local[:1] + "***@" + domain
+	}
+	if len(contact) <= 4 {
+		return contact
+	}
+	return strings.Repeat("*", len(contact)-4) + contact[len(contact)-4:]
+}
+
+// CreateInvitation sends funds to the escrow of an invitation for an
+// unregistered email address or phone number and invites its owner.
+func (s *Server) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req createInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !blockchain.ValidateAddress(req.From) {
+		httpError(w, r, "invalid address", http.StatusBadRequest)
+		return
+	}
+	if req.Amount <= 0 {
+		httpError(w, r, "amount must be positive", http.StatusBadRequest)
+		return
+	}
+	kind, contact, ok := normalizeContact(req.Contact)
+	if !ok {
+		httpError(w, r, "contact must be an email address or phone number", http.StatusBadRequest)
+		return
+	}
+	req.Message = strings.TrimSpace(req.Message)
+	if utf8.RuneCountInString(req.Message) > maxInvitationMessage {
+		httpError(w, r, "message is too long", http.StatusBadRequest)
+		return
+	}
+	dBytes, err := hex.DecodeString(req.PrivKey)
+	if err != nil || len(dBytes) == 0 {
+		httpError(w, r, "invalid private key", http.StatusBadRequest)
+		return
+	}
+	priv := blockchain.BigIntToPrivateKey(dBytes, blockchain.GetDefaultCurve())
+	if !blockchain.KeyControlsAddress(&priv.PublicKey, req.From) {
+		httpError(w, r, "private key does not match from address", http.StatusForbidden)
+		return
+	}
+	if !s.requireTransactionPIN(w, r, req.From, req.PIN) {
+		return
+	}
+	// registered recipients are paid directly
+	if kind == models.ContactEmail {
+		u, err := s.DB.GetUserByEmail(ctx, tenantID(ctx), contact)
+		if err != nil {
+			httpError(w, r, "failed to load user", http.StatusInternalServerError)
+			s.logEvent(ctx, "error", "user_lookup_failed", err.Error(), r.RemoteAddr)
+			return
+		}
+		if u != nil {
+			httpError(w, r, "contact is already registered", http.StatusConflict)
+			return
+		}
+	}
+
+	escrow, err := blockchain.NewWalletFrom(s.Entropy)
+	if err != nil {
+		httpError(w, r, "failed to create invitation", http.StatusInternalServerError)
+		return
+	}
+	now := s.Clock.Now().UTC()
+	inv := &models.Invitation{
+		ID:            uuid.NewString(),
+		TenantID:      tenantID(ctx),
+		FromAddress:   req.From,
+		ContactType:   kind,
+		ContactHash:   contactHash(kind, contact),
+		ContactMasked: maskContact(kind, contact),
+		Amount:        req.Amount,
+		Message:       req.Message,
+		EscrowAddress: escrow.GetAddress(),
+		EscrowKey:     blockchain.PrivateKeyToHex(&escrow.PrivateKey),
+		Status:        models.InvitationPending,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(invitationExpiry()),
+	}
+	sender := ""
+	if wp, err := s.DB.GetWalletProfileByAddress(ctx, req.From); err == nil && wp != nil {
+		inv.SenderUserID = wp.UserID
+		if u, err := s.DB.GetUser(ctx, wp.UserID); err == nil && u != nil {
+			sender = u.FullName
+		}
+	}
+	if sender == "" {
+		sender = req.From
+	}
+
+	s.chainMu.Lock()
+	fromHash, _ := blockchain.DecodeAddress(req.From)
+	acc, spendable := s.UTXO.FindSpendableOutputsExcluding(fromHash, req.Amount, s.reservedOutputs())
+	if acc < req.Amount {
+		s.chainMu.Unlock()
+		httpError(w, r, "insufficient funds", http.StatusBadRequest)
+		return
+	}
+	tx, err := blockchain.NewUTXOTransaction(priv, inv.EscrowAddress, req.Amount, s.BC, spendable, fromHash, acc)
+	if err != nil {
+		s.chainMu.Unlock()
+		httpError(w, r, "failed to create transaction", http.StatusBadRequest)
+		return
+	}
+	noteAuditTx(ctx, tx.ID)
+	if !s.BC.VerifyTransaction(tx) {
+		s.chainMu.Unlock()
+		httpError(w, r, "invalid transaction", http.StatusBadRequest)
+		return
+	}
+	if err := s.BC.CheckPolicy(ctx, tx); err != nil {
+		s.chainMu.Unlock()
+		policyError(w, r, err)
+		return
+	}
+	// the row goes first so a funded escrow is never without its key
+	inv.EscrowTxID = fmt.Sprintf("%x", tx.ID)
+	if err := s.DB.CreateInvitation(ctx, inv); err != nil {
+		s.chainMu.Unlock()
+		httpError(w, r, "failed to create invitation", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "invitation_create_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	newBlock, err := s.BC.AddBlockContext(ctx, []*blockchain.Transaction{tx})
+	if err != nil {
+		s.chainMu.Unlock()
+		failed := s.Clock.Now().UTC()
+		inv.Status, inv.ResolvedAt, inv.LastError = models.InvitationFailed, &failed, err.Error()
+		if _, uerr := s.DB.ResolveInvitation(context.Background(), inv, models.InvitationPending); uerr != nil {
+			s.logEvent(ctx, "error", "invitation_update_failed", uerr.Error(), r.RemoteAddr)
+		}
+		mineError(w, r, err)
+		return
+	}
+	height := len(s.BC.Blocks) - 1
+	s.reports.invalidateBlock(newBlock)
+	_ = s.UTXO.Reindex()
+	s.chainMu.Unlock()
+	s.persistMinedBlock(newBlock, height, []*blockchain.Transaction{tx}, "invitation")
+
+	invited := s.sendInvitation(ctx, inv, contact, sender)
+	s.logEvent(ctx, "info", "invitation_created",
+		fmt.Sprintf("invitation %s: %d from %s held in escrow %s for %s %s until %s",
+			inv.ID, inv.Amount, inv.FromAddress, inv.EscrowAddress, kind, inv.ContactMasked, inv.ExpiresAt.Format(time.RFC3339)),
+		r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(createInvitationResponse{
+		invitationView: newInvitationView(inv),
+		BlockHash:      fmt.Sprintf("%x", newBlock.Hash),
+		Invited:        invited,
+	})
+}
+
+// sendInvitation tells the recipient about the funds waiting for them,
+// by email or WhatsApp. It reports whether the message went out.
+func (s *Server) sendInvitation(ctx context.Context, inv *models.Invitation, contact, sender string) bool {
+	text := i18n.Tf(i18n.Default, "%s sent you %s on ZakatWallet. Register with this contact before %s to receive it.",
+		sender, fmt.Sprint(inv.Amount), inv.ExpiresAt.Format("2006-01-02"))
+	if inv.Message != "" {
+		text += "\n\n" + inv.Message
+	}
+
+	var err error
+	switch inv.ContactType {
+	case models.ContactEmail:
+		if s.mailer == nil {
+			return false
+		}
+		body := "<p>" + strings.ReplaceAll(html.EscapeString(text), "\n", "<br>") + "</p>"
+		err = s.mailer.SendHTML(ctx, contact, i18n.T(i18n.Default, "You have been sent funds"), body)
+	case models.ContactPhone:
+		n, ok := s.notifiers[notify.ChannelWhatsApp]
+		if !ok {
+			return false
+		}
+		_, err = n.Send(ctx, notify.Message{To: contact, Text: text})
+	}
+	if err != nil {
+		s.logEvent(ctx, "error", "invitation_send_failed",
+			fmt.Sprintf("invitation %s to %s: %v", inv.ID, inv.ContactMasked, err), "notifier")
+		return false
+	}
+	return true
+}
+
+// ListInvitations lists the invitations the session user sent.
+func (s *Server) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	invs, err := s.DB.ListInvitationsBySender(ctx, sessionFrom(ctx).Subject)
+	if err != nil {
+		httpError(w, r, "failed to load invitations", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "invitation_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	resp := invitationListResponse{Invitations: []invitationView{}}
+	for i := range invs {
+		resp.Invitations = append(resp.Invitations, newInvitationView(&invs[i]))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// claimInvitations queues the payout of the pending invitations for
+// the contact u just proved they hold, by entering the OTP sent to
+// their notify_channel, to their oldest active wallet.
+func (s *Server) claimInvitations(u *models.User) {
+	if s.DB == nil {
+		return
+	}
+	var hash string
+	if u.NotifyChannel == notify.ChannelWhatsApp {
+		if u.Phone == "" {
+			return
+		}
+		hash = contactHash(models.ContactPhone, u.Phone)
+	} else {
+		kind, contact, ok := normalizeContact(u.Email)
+		if !ok {
+			return
+		}
+		hash = contactHash(kind, contact)
+	}
+
+	s.enqueue("invitation-claims", func(ctx context.Context) error {
+		invs, err := s.DB.ListPendingInvitations(ctx, u.TenantID, hash)
+		if err != nil || len(invs) == 0 {
+			return err
+		}
+		wallets, err := s.DB.ListWalletProfilesByUser(ctx, u.ID)
+		if err != nil {
+			return err
+		}
+		address := ""
+		var created time.Time
+		for _, wp := range wallets {
+			if wp.Status == models.WalletStatusActive && (address == "" || wp.CreatedAt.Before(created)) {
+				address, created = wp.WalletAddress, wp.CreatedAt
+			}
+		}
+		if address == "" {
+			return nil // refunded once they expire
+		}
+		now := s.Clock.Now()
+		for i := range invs {
+			if !now.Before(invs[i].ExpiresAt) {
+				continue // refunded on the next tick
+			}
+			s.payOutInvitation(ctx, &invs[i], models.InvitationClaimed, address)
+		}
+		return nil
+	})
+}
+
+// runInvitations refunds expired invitations every invitationTick.
+func (s *Server) runInvitations() {
+	ticker := time.NewTicker(invitationTick)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.runScheduled("invitations", s.refundExpiredInvitations)
+	}
+}
+
+// refundExpiredInvitations pays the escrow of every expired pending
+// invitation back to its sender.
+func (s *Server) refundExpiredInvitations() {
+	if s.DB == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	invs, err := s.DB.ListPendingInvitations(ctx, "", "")
+	if err != nil {
+		log.Printf("failed to load invitations: %v", err)
+		return
+	}
+	now := s.Clock.Now()
+	for i := range invs {
+		if !now.Before(invs[i].ExpiresAt) {
+			s.payOutInvitation(ctx, &invs[i], models.InvitationRefunded, invs[i].FromAddress)
+		}
+	}
+}
+
+// payOutInvitation moves a pending invitation to status and pays its
+// escrow to to. When the payout fails the invitation goes back to
+// pending to be tried again, or to failed if the escrow cannot pay.
+func (s *Server) payOutInvitation(ctx context.Context, inv *models.Invitation, status, to string) {
+	now := s.Clock.Now().UTC()
+	inv.Status, inv.ToAddress, inv.ResolvedAt, inv.LastError = status, to, &now, ""
+	claimed, err := s.DB.ResolveInvitation(ctx, inv, models.InvitationPending)
+	if err != nil {
+		s.logEvent(ctx, "error", "invitation_update_failed", err.Error(), "worker")
+		return
+	}
+	if !claimed {
+		return // paid out by another instance
+	}
+
+	txid, permanent, err := s.payEscrow(ctx, inv, to)
+	if err != nil {
+		inv.LastError = err.Error()
+		if permanent {
+			inv.Status = models.InvitationFailed
+		} else {
+			inv.Status, inv.ToAddress, inv.ResolvedAt = models.InvitationPending, "", nil
+		}
+		if _, uerr := s.DB.ResolveInvitation(ctx, inv, status); uerr != nil {
+			s.logEvent(ctx, "error", "invitation_update_failed", uerr.Error(), "worker")
+		}
+		s.logEvent(ctx, "warn", "invitation_payout_failed",
+			fmt.Sprintf("invitation %s not %s: %v", inv.ID, status, err), "worker")
+		return
+	}
+
+	inv.PayoutTxID = txid
+	if _, err := s.DB.ResolveInvitation(ctx, inv, status); err != nil {
+		s.logEvent(ctx, "error", "invitation_update_failed", err.Error(), "worker")
+	}
+	s.notifyIncomingFunds(to, inv.Amount)
+	s.logEvent(ctx, "info", "invitation_"+status,
+		fmt.Sprintf("invitation %s: escrow %s paid %d to %s in tx %s", inv.ID, inv.EscrowAddress, inv.Amount, to, txid), "worker")
+}
+
+// payEscrow mines the transfer of an invitation's escrow to to and
+// returns its txid. permanent reports errors retrying cannot fix.
+func (s *Server) payEscrow(ctx context.Context, inv *models.Invitation, to string) (txid string, permanent bool, err error) {
+	key, err := blockchain.PrivateKeyFromHex(inv.EscrowKey)
+	if err != nil {
+		return "", true, fmt.Errorf("escrow key unreadable")
+	}
+	escrowHash, err := blockchain.DecodeAddress(inv.EscrowAddress)
+	if err != nil {
+		return "", true, err
+	}
+
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+
+	acc, spendable := s.UTXO.FindSpendableOutputsExcluding(escrowHash, inv.Amount, s.reservedOutputs())
+	if acc < inv.Amount {
+		return "", true, fmt.Errorf("escrow holds %d of %d", acc, inv.Amount)
+	}
+	tx, err := blockchain.NewUTXOTransaction(*key, to, inv.Amount, s.BC, spendable, escrowHash, acc)
+	if err != nil {
+		return "", false, err
+	}
+	if !s.BC.VerifyTransaction(tx) {
+		return "", false, fmt.Errorf("transaction verification failed")
+	}
+	if err := s.BC.CheckPolicy(ctx, tx); err != nil {
+		return "", false, err
+	}
+	newBlock, err := s.BC.AddBlockContext(ctx, []*blockchain.Transaction{tx})
+	if err != nil {
+		return "", false, err
+	}
+	height := len(s.BC.Blocks) - 1
+	s.reports.invalidateBlock(newBlock)
+	_ = s.UTXO.Reindex()
+	s.persistMinedBlock(newBlock, height, []*blockchain.Transaction{tx}, "invitation")
+
+	return fmt.Sprintf("%x", tx.ID), false, nil
+}
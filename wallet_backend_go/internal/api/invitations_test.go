@@ -0,0 +1,104 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"wallet_backend_go/internal/db"
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/testutil"
+)
+
+// invitationStore holds registered users and one pending invitation
+// for every contact, and counts the attempts to pay invitations out.
+type invitationStore struct {
+	db.Store
+
+	mu       sync.Mutex
+	users    map[string]*models.User
+	wallets  []models.WalletProfile
+	resolved int
+}
+
+func (s *invitationStore) LogSystemEvent(ctx context.Context, level, typ, message, ip string) {}
+
+func (s *invitationStore) CreateAPIAudit(ctx context.Context, a *models.APIAudit) error { return nil }
+
+func (s *invitationStore) ListHeldTransfers(ctx context.Context, status string) ([]models.HeldTransfer, error) {
+	return nil, nil
+}
+
+func (s *invitationStore) CreateUser(ctx context.Context, u *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[u.Email] = u
+	return nil
+}
+
+func (s *invitationStore) GetUserByEmail(ctx context.Context, tenantID, email string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.users[email], nil
+}
+
+func (s *invitationStore) CreateWalletProfile(ctx context.Context, wp *models.WalletProfile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.wallets = append(s.wallets, *wp)
+	return nil
+}
+
+func (s *invitationStore) ListWalletProfilesByUser(ctx context.Context, userID string) ([]models.WalletProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]models.WalletProfile(nil), s.wallets...), nil
+}
+
+func (s *invitationStore) ListPendingInvitations(ctx context.Context, tenantID, contactHash string) ([]models.Invitation, error) {
+	return []models.Invitation{{
+		ID: "inv-" + contactHash[:8], ContactHash: contactHash, Amount: 500,
+		Status: models.InvitationPending, ExpiresAt: testutil.Epoch.Add(24 * time.Hour),
+	}}, nil
+}
+
+func (s *invitationStore) ResolveInvitation(ctx context.Context, inv *models.Invitation, fromStatus string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resolved++
+	return false, nil // as if another instance had paid it out
+}
+
+// TestRegisterDoesNotClaimInvitations checks that registering with the
+// email and phone an invitation was sent to, and logging in with an
+// OTP echoed back to the client, does not release the escrow: neither
+// proves the user holds the contact.
+func TestRegisterDoesNotClaimInvitations(t *testing.T) {
+	t.Setenv("OTP_ECHO", "true")
+	c := testutil.NewChain(t)
+	store := &invitationStore{users: make(map[string]*models.User)}
+	h := testutil.NewServerWithStore(t, c, store).Router()
+
+	rec := testutil.Do(t, h, "POST", "/register", map[string]interface{}{
+		"full_name": "Invitee", "email": "invitee@example.org", "cnic": "35202-1234567-1",
+		"phone": "+92 300 1234567", "notify_channel": "whatsapp",
+	})
+	testutil.DecodeJSON(t, rec, http.StatusOK, nil)
+
+	var otp struct {
+		OTP string `json:"otp"`
+	}
+	testutil.DecodeJSON(t, testutil.Do(t, h, "POST", "/auth/request-otp", map[string]string{"email": "invitee@example.org"}), http.StatusOK, &otp)
+	rec = testutil.Do(t, h, "POST", "/auth/verify-otp", map[string]string{"email": "invitee@example.org", "otp": otp.OTP})
+	testutil.DecodeJSON(t, rec, http.StatusOK, nil)
+
+	// payouts run on the background worker
+	time.Sleep(100 * time.Millisecond)
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.resolved != 0 {
+		t.Errorf("%d invitation payouts attempted for an unverified contact, want none", store.resolved)
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+// listing.go reads the paging, filter and sort parameters of the block
+// and transaction listings (GET /blocks and
+// GET /wallets/{address}/transactions). Without parameters a listing
+// returns everything, oldest first, as it always has; the headers
+// X-Total-Count and X-Next-Offset tell a client paging with ?limit=
+// how many entries match and where the next page starts.
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+const maxListLimit = 1000
+
+const (
+	totalCountHeader = "X-Total-Count"
+	nextOffsetHeader = "X-Next-Offset"
+)
+
+// listTxTypes are the kinds ?type= selects transactions by.
+var listTxTypes = map[string]bool{
+	"send":            true,
+	"reward":          true,
+	"fee":             true,
+	"anchor":          true,
+	"bridge":          true,
+	"zakat_deduction": true,
+}
+
+// listQueryParams reads ?offset=, ?limit= (1 to 1000), ?from= and ?to=
+// (dates or RFC 3339 times, to exclusive), ?order= (asc or desc) and,
+// when withTypes, ?type= (comma-separated kinds). On failure it returns
+// the error message.
+func listQueryParams(r *http.Request, withTypes bool) (blockchain.ListQuery, string) {
+	var lq blockchain.ListQuery
+	q := r.URL.Query()
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return lq, "invalid offset or limit"
+		}
+		lq.Offset = n
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxListLimit {
+			return lq, "invalid offset or limit"
+		}
+		lq.Limit = n
+	}
+	if v := q.Get("from"); v != "" {
+		t, ok := parseListTime(v)
+		if !ok {
+			return lq, "invalid from date"
+		}
+		lq.Since = t.Unix()
+	}
+	if v := q.Get("to"); v != "" {
+		t, ok := parseListTime(v)
+		if !ok || (lq.Since != 0 && t.Unix() <= lq.Since) {
+			return lq, "invalid to date"
+		}
+		lq.Until = t.Unix()
+	}
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		lq.Desc = true
+	default:
+		return lq, "invalid order"
+	}
+	if v := q.Get("type"); v != "" && withTypes {
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if !listTxTypes[t] {
+				return lq, "invalid type"
+			}
+			lq.Types = append(lq.Types, t)
+		}
+	}
+	return lq, ""
+}
+
+func parseListTime(v string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+	t, err := time.Parse("2006-01-02", v)
+	return t, err == nil
+}
+
+// setListHeaders sets the total and, while more entries follow the
+// page, the offset of the next page.
+func setListHeaders(w http.ResponseWriter, lq blockchain.ListQuery, page, total int) {
+	w.Header().Set(totalCountHeader, strconv.Itoa(total))
+	if next := lq.Offset + page; page > 0 && next < total {
+		w.Header().Set(nextOffsetHeader, strconv.Itoa(next))
+	}
+}
+
+// txKind returns the kind of a transaction for ?type=: the kind
+// txParties gives it, or zakat_deduction for a send to the zakat pool.
+func txKind(pool string) func(*blockchain.Transaction) string {
+	return func(tx *blockchain.Transaction) string {
+		_, receiver, _, kind := txParties(tx)
+		if kind == "send" && pool != "" && blockchain.SameAddress(receiver, pool) {
+			return "zakat_deduction"
+		}
+		return kind
+	}
+}
@@ -0,0 +1,32 @@
+package api
+
+// locale.go applies the client's Accept-Language preference to error
+// messages. Fiat equivalents of amounts are formatted in the client's
+// language too (see fiatFor in rates.go); without a rate for
+// FIAT_CURRENCY (default PKR) no fiat fields are returned.
+
+import (
+	"net/http"
+
+	"wallet_backend_go/internal/i18n"
+)
+
+// fiatAmount is a locale-formatted fiat equivalent of a chain amount.
+type fiatAmount struct {
+	Currency  string  `json:"currency"`
+	Amount    float64 `json:"amount"`
+	Formatted string  `json:"formatted"`
+}
+
+// lang returns the negotiated response language of the request.
+func lang(r *http.Request) string {
+	return i18n.Negotiate(r.Header.Get("Accept-Language"))
+}
+
+// httpError writes a plain text error translated into the client's
+// language.
+func httpError(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	l := lang(r)
+	w.Header().Set("Content-Language", l)
+	http.Error(w, i18n.T(l, msg), code)
+}
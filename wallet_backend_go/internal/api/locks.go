@@ -0,0 +1,143 @@
+package api
+
+// locks.go connects the server to the lock service (package lock) that
+// coordinates API replicas. Zakat runs take a lock so that only one
+// replica deducts at a time, faucet drips take a lock per address that
+// lasts the faucet window, transaction PIN checks take a lock per user
+// so that concurrent wrong PINs are all counted, the background schedulers run each tick
+// under a lock, and when the lock service is shared mining takes a lock
+// per block. With a shared backend the instances also elect a leader,
+// and only the leader runs the background schedulers. With the default
+// local backend every lock is in-process and a single instance behaves
+// as before.
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"wallet_backend_go/internal/db"
+	"wallet_backend_go/internal/lock"
+)
+
+// Lock names.
+const (
+	lockZakatRun     = "zakat-run"
+	lockMine         = "mine"
+	lockFaucetPrefix = "faucet:"
+	lockPINPrefix    = "pin:"
+	lockScheduler    = "scheduler:"
+	lockLeader       = "leader"
+)
+
+const (
+	zakatRunLockTTL  = time.Minute
+	mineLockTTL      = 30 * time.Second
+	pinLockTTL       = 30 * time.Second
+	schedulerLockTTL = time.Minute
+	leaderTTL        = 15 * time.Second
+)
+
+// newLocker returns the lock service selected by LOCK_BACKEND.
+func newLocker(store db.Store) lock.Locker {
+	var leases lock.LeaseStore
+	if store != nil {
+		leases = store
+	}
+	l := lock.NewFromEnv(leases)
+	if lock.Shared(l) {
+		log.Printf("using %s locks shared between instances", lock.Name(l))
+	}
+	return l
+}
+
+// useLocker switches the server to l and, when l is shared, makes
+// mining take the mine lock and campaigns for leadership.
+func (s *Server) useLocker(l lock.Locker) {
+	s.locks = l
+	if lock.Shared(l) {
+		s.BC.MineLock = s.mineLock
+		s.leader = lock.NewElector(l, lockLeader, leaderTTL)
+		go s.leader.Run(context.Background())
+	}
+}
+
+// isLeader reports whether this instance runs the schedulers.
+func (s *Server) isLeader() bool {
+	return s.leader == nil || s.leader.IsLeader()
+}
+
+// mineLock is the chain's MineLock. If the lock service fails the
+// block is mined without the lock rather than not at all.
+func (s *Server) mineLock(ctx context.Context) (func(), error) {
+	h, err := lock.Lock(ctx, s.locks, lockMine, mineLockTTL)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Printf("mining without the mine lock: %v", err)
+		return func() {}, nil
+	}
+	return h.Release, nil
+}
+
+// runScheduled runs one tick of the background job name on the leader,
+// unless another instance is running it (an old leader finishing its
+// tick during a failover).
+func (s *Server) runScheduled(name string, tick func()) {
+	if !s.isLeader() {
+		return
+	}
+	_, err := lock.Run(context.Background(), s.locks, lockScheduler+name, schedulerLockTTL, func(context.Context) { tick() })
+	if err != nil {
+		log.Printf("skipping %s: lock failed: %v", name, err)
+	}
+}
+
+// lockZakatRun takes the zakat run lock. On failure it writes the error
+// response and returns nil.
+func (s *Server) lockZakatRun(w http.ResponseWriter, r *http.Request) *lock.Held {
+	h, err := lock.TryLock(r.Context(), s.locks, lockZakatRun, zakatRunLockTTL)
+	if err != nil {
+		httpError(w, r, "lock service unavailable", http.StatusServiceUnavailable)
+		s.logEvent(r.Context(), "error", "lock_failed", err.Error(), r.RemoteAddr)
+		return nil
+	}
+	if h == nil {
+		httpError(w, r, "a zakat run is in progress on another instance", http.StatusConflict)
+		return nil
+	}
+	return h
+}
+
+// lockPIN waits for the PIN lock of userID. On failure it writes the
+// error response and returns nil.
+func (s *Server) lockPIN(w http.ResponseWriter, r *http.Request, userID string) *lock.Held {
+	h, err := lock.Lock(r.Context(), s.locks, lockPINPrefix+userID, pinLockTTL)
+	if err != nil {
+		httpError(w, r, "lock service unavailable", http.StatusServiceUnavailable)
+		s.logEvent(r.Context(), "error", "lock_failed", err.Error(), r.RemoteAddr)
+		return nil
+	}
+	return h
+}
+
+// reserveFaucetDrip claims the faucet window for address across
+// instances. It returns the token to release the claim with, and false
+// if the address was dripped on another instance.
+func (s *Server) reserveFaucetDrip(ctx context.Context, address string) (string, bool, error) {
+	token := lock.NewToken()
+	ok, err := s.locks.Acquire(ctx, lockFaucetPrefix+address, token, faucetWindow)
+	return token, ok, err
+}
+
+// releaseFaucetDrip gives back a claim of reserveFaucetDrip that was
+// not paid.
+func (s *Server) releaseFaucetDrip(address, token string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.locks.Release(ctx, lockFaucetPrefix+address, token); err != nil {
+		log.Printf("failed to release faucet claim of %s: %v", address, err)
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+// maintenance.go is the admin-togglable maintenance mode used during
+// chain migrations and reconciliations. While it is on, every mutating
+// request (anything but GET, HEAD and OPTIONS) gets 503 with a
+// Retry-After header; reads keep working. The maintenance switch itself
+// and the chain rebuild, which is what maintenance windows are for, stay
+// available, as does the self-check, which never touches the live
+// chain. The state lives in memory, so each instance is toggled
+// separately and a restart turns it off.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultMaintenanceRetryAfter is announced when the admin gives none.
+const defaultMaintenanceRetryAfter = 5 * time.Minute
+
+// maintenanceExempt lists the mutating routes that stay available.
+var maintenanceExempt = map[string]bool{
+	"/api/v1/admin/maintenance": true,
+	"/api/v1/admin/rebuild":     true,
+	"/api/v1/admin/selfcheck":   true,
+}
+
+type maintenanceState struct {
+	mu         sync.Mutex
+	enabled    bool
+	reason     string
+	retryAfter time.Duration
+	since      time.Time
+	updatedBy  string
+}
+
+type maintenanceRequest struct {
+	Enabled           *bool  `json:"enabled"`
+	Reason            string `json:"reason"`
+	RetryAfterSeconds int    `json:"retry_after_seconds"`
+	UpdatedBy         string `json:"updated_by"`
+}
+
+type maintenanceResponse struct {
+	Enabled           bool       `json:"enabled"`
+	Reason            string     `json:"reason,omitempty"`
+	RetryAfterSeconds int        `json:"retry_after_seconds,omitempty"`
+	Since             *time.Time `json:"since,omitempty"`
+	UpdatedBy         string     `json:"updated_by,omitempty"`
+}
+
+// status returns the current state for the API.
+func (m *maintenanceState) status() maintenanceResponse {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.enabled {
+		return maintenanceResponse{}
+	}
+	since := m.since
+	return maintenanceResponse{
+		Enabled:           true,
+		Reason:            m.reason,
+		RetryAfterSeconds: int(m.retryAfter.Seconds()),
+		Since:             &since,
+		UpdatedBy:         m.updatedBy,
+	}
+}
+
+// withMaintenance rejects mutating requests while maintenance is on.
+func (s *Server) withMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if maintenanceExempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		st := s.maintenance.status()
+		if !st.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(st.RetryAfterSeconds))
+		httpError(w, r, "service is under maintenance, please retry later", http.StatusServiceUnavailable)
+	})
+}
+
+// GetMaintenance reports whether maintenance mode is on.
+func (s *Server) GetMaintenance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.maintenance.status())
+}
+
+// SetMaintenance turns maintenance mode on or off.
+func (s *Server) SetMaintenance(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req maintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.RetryAfterSeconds < 0 {
+		httpError(w, r, "retry_after_seconds must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	retryAfter := time.Duration(req.RetryAfterSeconds) * time.Second
+	if retryAfter == 0 {
+		retryAfter = defaultMaintenanceRetryAfter
+	}
+
+	m := &s.maintenance
+	m.mu.Lock()
+	m.enabled = *req.Enabled
+	m.reason = req.Reason
+	m.retryAfter = retryAfter
+	m.since = s.Clock.Now().UTC()
+	m.updatedBy = req.UpdatedBy
+	m.mu.Unlock()
+
+	if s.DB != nil {
+		s.logEvent(ctx, "warn", "maintenance_mode",
+			fmt.Sprintf("maintenance enabled=%t by %q: %s", *req.Enabled, req.UpdatedBy, req.Reason),
+			r.RemoteAddr,
+		)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.maintenance.status())
+}
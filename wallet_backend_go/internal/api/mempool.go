@@ -0,0 +1,329 @@
+package api
+
+// mempool.go mines sends in the background. With MINING_MODE=mempool a
+// send is verified, queued in the mempool and answered at once with
+// 202 Accepted; a miner goroutine batches the queued transactions into
+// one block every MEMPOOL_MINE_INTERVAL seconds, or as soon as
+// MEMPOOL_BATCH_SIZE of them are waiting. The other ways of mining
+// (zakat, faucet, offline batches, ...) still mine inline. The pool
+// lives in memory: queued sends are lost when the instance stops.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/db"
+	"wallet_backend_go/internal/models"
+)
+
+const (
+	defaultMempoolSize     = 5000
+	defaultMempoolBatch    = 50
+	defaultMempoolInterval = 10 // seconds
+)
+
+// mempoolMode reports whether sends are queued instead of mined inline.
+func mempoolMode() bool {
+	return os.Getenv("MINING_MODE") == "mempool"
+}
+
+func mempoolBatchSize() int {
+	return envLimit("MEMPOOL_BATCH_SIZE", defaultMempoolBatch)
+}
+
+// sendTenants remembers the tenant of each queued send for its receipt.
+type sendTenants struct {
+	mu      sync.Mutex
+	tenants map[string]string // by txid
+}
+
+func (t *sendTenants) set(txid, tenant string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tenants == nil {
+		t.tenants = make(map[string]string)
+	}
+	t.tenants[txid] = tenant
+}
+
+func (t *sendTenants) take(txid string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tenant := t.tenants[txid]
+	delete(t.tenants, txid)
+	return tenant
+}
+
+// startMempool creates the mempool and starts its miner.
+func (s *Server) startMempool() {
+	s.mempool = blockchain.NewMempool(envLimit("MEMPOOL_MAX_SIZE", defaultMempoolSize))
+	interval := time.Duration(envLimit("MEMPOOL_MINE_INTERVAL", defaultMempoolInterval)) * time.Second
+	go s.runMiner(interval)
+}
+
+// reservedOutputs returns the outputs that held transfers and queued
+// sends spend, keyed "txid:vout", so new transactions pick others.
+func (s *Server) reservedOutputs() map[string]bool {
+	reserved := s.held.reservedOutputs()
+	if s.mempool != nil {
+		for k := range s.mempool.Reserved() {
+			reserved[k] = true
+		}
+	}
+	return reserved
+}
+
+// pendingFor adds up what the transactions waiting to be mined, the
+// queued sends and the held transfers, take from the address with
+// public key hash pubKeyHash (the outputs they spend less the change)
+// and pay to it.
+func (s *Server) pendingFor(pubKeyHash []byte) (debits, credits int) {
+	txs := s.held.transactions()
+	if s.mempool != nil {
+		for _, e := range s.mempool.List() {
+			txs = append(txs, e.Tx)
+		}
+	}
+	for _, tx := range txs {
+		spent := 0
+		for _, in := range tx.Vin {
+			prev, err := s.BC.FindTransaction(in.Txid)
+			if err != nil || in.Vout < 0 || in.Vout >= len(prev.Vout) {
+				continue
+			}
+			if out := prev.Vout[in.Vout]; out.IsLockedWith(pubKeyHash) {
+				spent += out.Value
+			}
+		}
+		paid := 0
+		for _, out := range tx.Vout {
+			if out.IsLockedWith(pubKeyHash) {
+				paid += out.Value
+			}
+		}
+		if spent > 0 {
+			debits += spent - paid
+		} else {
+			credits += paid
+		}
+	}
+	return debits, credits
+}
+
+type queuedSendResponse struct {
+	Status   string    `json:"status"` // pending
+	TxID     string    `json:"txid"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Amount   int       `json:"amount"`
+	QueuedAt time.Time `json:"queued_at"`
+}
+
+// queueSend adds a verified send to the mempool and answers 202.
+func (s *Server) queueSend(w http.ResponseWriter, r *http.Request, tx *blockchain.Transaction, req txRequest, window time.Duration) {
+	now := s.Clock.Now()
+	err := s.mempool.Add(blockchain.MempoolEntry{Tx: tx, From: req.From, To: req.To, Amount: req.Amount, AddedAt: now})
+	switch {
+	case errors.Is(err, blockchain.ErrMempoolFull):
+		httpError(w, r, "mempool is full", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		httpError(w, r, "transaction spends an output of a pending transaction", http.StatusConflict)
+		return
+	}
+	txid := fmt.Sprintf("%x", tx.ID)
+	s.sends.record(req.From, req.To, req.Amount, now, window)
+	s.sendTenants.set(txid, tenantID(r.Context()))
+	if s.mempool.Pending() >= mempoolBatchSize() {
+		s.mempool.Signal()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(queuedSendResponse{
+		Status: blockchain.MempoolPending, TxID: txid,
+		From: req.From, To: req.To, Amount: req.Amount, QueuedAt: now,
+	})
+}
+
+// runMiner mines the mempool on every tick and whenever a full batch
+// is waiting, one block per batch until it is empty.
+func (s *Server) runMiner(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.mempool.Ready():
+		}
+		for s.mempool.Pending() > 0 {
+			if !s.mineMempool() {
+				break
+			}
+		}
+	}
+}
+
+// mineMempool mines one batch and reports whether it made progress.
+// Transactions that are no longer valid (an input was spent meanwhile,
+// or a policy check now rejects them) are dropped from the pool.
+func (s *Server) mineMempool() bool {
+	entries := s.mempool.Take(mempoolBatchSize())
+	if len(entries) == 0 {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	s.chainMu.Lock()
+	var txs []*blockchain.Transaction
+	var txids []string
+	var mined []blockchain.MempoolEntry
+	for _, e := range entries {
+		txid := fmt.Sprintf("%x", e.Tx.ID)
+		if reason := s.recheckQueued(ctx, e.Tx); reason != "" {
+			s.mempool.Drop(txid, reason)
+			s.sendTenants.take(txid)
+			s.logEvent(ctx, "warn", "mempool_tx_dropped", fmt.Sprintf("transaction %s dropped: %s", txid, reason), "miner")
+			continue
+		}
+		txs = append(txs, e.Tx)
+		txids = append(txids, txid)
+		mined = append(mined, e)
+	}
+	if len(txs) == 0 {
+		s.chainMu.Unlock()
+		return true
+	}
+	newBlock, err := s.BC.AddBlockContext(context.Background(), txs)
+	if err != nil {
+		s.chainMu.Unlock()
+		s.mempool.Requeue(txids)
+		s.logEvent(ctx, "error", "mempool_mine_failed", err.Error(), "miner")
+		return false
+	}
+	height := len(s.BC.Blocks) - 1
+	s.reports.invalidateBlock(newBlock)
+	_ = s.UTXO.Reindex()
+	s.chainMu.Unlock()
+	s.mempool.Mined(txids)
+
+	var receipts []models.TransactionReceipt
+	for _, e := range mined {
+		rc := s.newTransactionReceipt(e.Tx, newBlock, height, e.From, e.To, e.Amount)
+		rc.TenantID = s.sendTenants.take(fmt.Sprintf("%x", e.Tx.ID))
+		receipts = append(receipts, rc)
+	}
+	s.persistQueuedSends(newBlock, height, txs, mined, receipts)
+	for _, e := range mined {
+		s.maybeAutoZakat(e.To, e.Amount)
+		s.notifyIncomingFunds(e.To, e.Amount)
+	}
+	return true
+}
+
+// persistQueuedSends writes a block mined from the mempool with its
+// sends and their receipts to Supabase, like persistMinedBlock but with
+// the parties the senders named.
+func (s *Server) persistQueuedSends(b *blockchain.Block, height int, txs []*blockchain.Transaction, sends []blockchain.MempoolEntry, receipts []models.TransactionReceipt) {
+	if s.DB == nil {
+		return
+	}
+
+	s.persistence.start(b, txs, "send", s.Clock.Now())
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var persistErr error
+		blockHash := fmt.Sprintf("%x", b.Hash)
+		batch := db.NewBatch(s.DB)
+		if err := batch.AddBlock(ctx, height, b); err != nil {
+			log.Printf("failed to save block to Supabase: %v", err)
+			persistErr = err
+		}
+		for _, e := range sends {
+			if err := batch.AddTransaction(ctx, blockHash, e.Tx, e.From, e.To, e.Amount, "send"); err != nil {
+				log.Printf("failed to save transaction to Supabase: %v", err)
+				persistErr = err
+			}
+		}
+		if err := addFeeRecord(ctx, batch, blockHash, b); err != nil {
+			log.Printf("failed to save fee transaction to Supabase: %v", err)
+			persistErr = err
+		}
+		if err := batch.Flush(ctx); err != nil {
+			log.Printf("failed to save send block to Supabase: %v", err)
+			persistErr = err
+		}
+		for i := range receipts {
+			if err := s.DB.CreateTransactionReceipt(ctx, &receipts[i]); err != nil {
+				log.Printf("failed to save transaction receipt to Supabase: %v", err)
+				persistErr = err
+			}
+		}
+		s.persistence.finish(txs, persistErr, s.Clock.Now())
+		s.reports.invalidateBlock(b)
+	}()
+}
+
+// recheckQueued returns why a queued transaction can no longer be
+// mined, or "" if it still can. The caller holds chainMu.
+func (s *Server) recheckQueued(ctx context.Context, tx *blockchain.Transaction) string {
+	for _, in := range tx.Vin {
+		if s.BC.IsOutputSpent(in.Txid, in.Vout) {
+			return "inputs already spent"
+		}
+	}
+	if !s.BC.VerifyTransaction(tx) {
+		return "invalid transaction"
+	}
+	if err := s.BC.CheckPolicy(ctx, tx); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+type mempoolTx struct {
+	TxID     string    `json:"txid"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Amount   int       `json:"amount"`
+	Status   string    `json:"status"` // pending or mining
+	QueuedAt time.Time `json:"queued_at"`
+}
+
+type mempoolResponse struct {
+	Enabled      bool        `json:"enabled"`
+	Pending      int         `json:"pending"`
+	Mining       int         `json:"mining"`
+	Transactions []mempoolTx `json:"transactions"`
+}
+
+// ListMempool lists the queued transactions, oldest first.
+func (s *Server) ListMempool(w http.ResponseWriter, r *http.Request) {
+	resp := mempoolResponse{Enabled: s.mempool != nil, Transactions: []mempoolTx{}}
+	if s.mempool != nil {
+		for _, e := range s.mempool.List() {
+			if e.Status == blockchain.MempoolMining {
+				resp.Mining++
+			} else {
+				resp.Pending++
+			}
+			resp.Transactions = append(resp.Transactions, mempoolTx{
+				TxID: fmt.Sprintf("%x", e.Tx.ID), From: e.From, To: e.To, Amount: e.Amount,
+				Status: e.Status, QueuedAt: e.AddedAt,
+			})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,163 @@
+package api
+
+// metrics.go exposes the server's Prometheus metrics on GET /metrics:
+// requests by route and status, how long blocks take to mine and the
+// UTXO set to reindex, the mempool, zakat runs and the Supabase calls.
+// With METRICS_TOKEN set, scrapes must send it as a bearer token.
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/db"
+	"wallet_backend_go/internal/metrics"
+	"wallet_backend_go/internal/models"
+)
+
+const metricsPrefix = "zakatwallet_"
+
+// miningBuckets bound the time, in seconds, a block's proof-of-work
+// takes.
+var miningBuckets = []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+type serverMetrics struct {
+	registry *metrics.Registry
+
+	requests        *metrics.Counter   // method, route, status
+	requestDuration *metrics.Histogram // method, route
+	mining          *metrics.Histogram
+	reindex         *metrics.Histogram
+	zakatRuns       *metrics.Counter // status
+	zakatItems      *metrics.Counter // status
+	zakatDeducted   *metrics.Counter
+	supabaseCalls   *metrics.Counter   // operation, outcome
+	supabaseLatency *metrics.Histogram // operation
+}
+
+// callObserver is implemented by stores reporting their calls, such as
+// the Supabase client.
+type callObserver interface {
+	ObserveCalls(fn func(op, outcome string, elapsed time.Duration))
+}
+
+// initMetrics registers the server's metrics and hooks them into the
+// chain, the UTXO set and the store.
+func (s *Server) initMetrics() {
+	reg := metrics.NewRegistry()
+	m := &serverMetrics{
+		registry: reg,
+		requests: reg.Counter(metricsPrefix+"http_requests_total",
+			"HTTP requests answered, by method, route template and status.", "method", "route", "status"),
+		requestDuration: reg.Histogram(metricsPrefix+"http_request_duration_seconds",
+			"Time taken to answer HTTP requests, by method and route template.", metrics.DefBuckets, "method", "route"),
+		mining: reg.Histogram(metricsPrefix+"block_mining_duration_seconds",
+			"Time the proof-of-work of blocks mined by this node took.", miningBuckets),
+		reindex: reg.Histogram(metricsPrefix+"utxo_reindex_duration_seconds",
+			"Time rebuilding the UTXO set took.", metrics.DefBuckets),
+		zakatRuns: reg.Counter(metricsPrefix+"zakat_runs_total",
+			"Zakat runs finished or paused for review, by status.", "status"),
+		zakatItems: reg.Counter(metricsPrefix+"zakat_run_wallets_total",
+			"Wallets processed by zakat runs, by outcome (done, skipped, failed).", "status"),
+		zakatDeducted: reg.Counter(metricsPrefix+"zakat_deducted_units_total",
+			"Zakat deducted by zakat runs, in coin units."),
+		supabaseCalls: reg.Counter(metricsPrefix+"supabase_calls_total",
+			"Supabase calls, by client operation and outcome (ok, error, rejected, aborted).", "operation", "outcome"),
+		supabaseLatency: reg.Histogram(metricsPrefix+"supabase_call_duration_seconds",
+			"Time Supabase calls that went out took, by client operation.", metrics.DefBuckets, "operation"),
+	}
+	reg.GaugeFunc(metricsPrefix+"mempool_size", "Sends queued in the mempool.", func() float64 {
+		if s.mempool == nil {
+			return 0
+		}
+		return float64(s.mempool.Pending())
+	})
+	s.metrics = m
+
+	s.BC.OnMined = func(elapsed time.Duration) {
+		m.mining.Observe(elapsed.Seconds())
+	}
+	s.UTXO.OnReindex = func(elapsed time.Duration) {
+		m.reindex.Observe(elapsed.Seconds())
+	}
+	if co, ok := s.DB.(callObserver); ok {
+		co.ObserveCalls(func(op, outcome string, elapsed time.Duration) {
+			m.supabaseCalls.Inc(op, outcome)
+			if outcome != db.CallRejected {
+				m.supabaseLatency.Observe(elapsed.Seconds(), op)
+			}
+		})
+	}
+}
+
+// metricsRecorder keeps the status of a response.
+type metricsRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *metricsRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *metricsRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(p)
+}
+
+// withMetrics counts and times the requests of every route but the
+// streaming ones, which last as long as their client listens.
+func (s *Server) withMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		tpl, err := route.GetPathTemplate()
+		if err != nil || streamingRoutes[r.Method+" "+tpl] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &metricsRecorder{ResponseWriter: w}
+		start := s.Clock.Now()
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		s.metrics.requests.Inc(r.Method, tpl, strconv.Itoa(rec.status))
+		s.metrics.requestDuration.Observe(s.Clock.Now().Sub(start).Seconds(), r.Method, tpl)
+	})
+}
+
+// recordZakatItem counts a wallet a zakat run is done with.
+func (s *Server) recordZakatItem(status string, amount int) {
+	s.metrics.zakatItems.Inc(status)
+	if status == models.ZakatItemDone && amount > 0 {
+		s.metrics.zakatDeducted.Add(float64(amount))
+	}
+}
+
+// Metrics serves the metrics in the Prometheus text format.
+func (s *Server) Metrics(w http.ResponseWriter, r *http.Request) {
+	if token := strings.TrimSpace(os.Getenv("METRICS_TOKEN")); token != "" {
+		got, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			httpError(w, r, "invalid metrics token", http.StatusUnauthorized)
+			return
+		}
+	}
+	s.metrics.registry.Handler().ServeHTTP(w, r)
+}
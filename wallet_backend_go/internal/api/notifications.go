@@ -0,0 +1,314 @@
+package api
+
+// notifications.go delivers OTPs, incoming funds notices and zakat
+// receipts to users over external channels (see package notify) and
+// records each delivery in notification_deliveries. Which channels an
+// event goes to is set by the user's notification preferences; channels
+// not configured on this server are skipped, and the OTP is still
+// returned by /auth/request-otp. Provider status callbacks arrive on
+// /webhooks/whatsapp.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/i18n"
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/notify"
+)
+
+// maxWebhookBody bounds provider callback payloads.
+const maxWebhookBody = 1 << 20
+
+// loadNotifiers returns the channels configured in the environment.
+func loadNotifiers() map[string]notify.Notifier {
+	notifiers := make(map[string]notify.Notifier)
+	if wa := notify.NewWhatsAppFromEnv(); wa != nil {
+		notifiers[notify.ChannelWhatsApp] = wa
+		log.Println("WhatsApp notifications enabled")
+	}
+	return notifiers
+}
+
+// validNotifyChannel reports whether channel may be chosen by a user
+// as their primary channel.
+func validNotifyChannel(channel string) bool {
+	return channel == "" || channel == notify.ChannelEmail || channel == notify.ChannelWhatsApp
+}
+
+// preferenceEvents lists the events users control, in display order.
+var preferenceEvents = []string{
+	models.NotifyEventIncomingFunds,
+	models.NotifyEventZakatDeduction,
+	models.NotifyEventReminders,
+	models.NotifyEventMarketing,
+}
+
+func knownPreferenceEvent(event string) bool {
+	for _, e := range preferenceEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultPreferences delivers every event except marketing on the
+// user's notify_channel (email when unset); marketing is opt-in.
+func defaultPreferences(u *models.User) *models.NotificationPreferences {
+	channel := u.NotifyChannel
+	if channel == "" {
+		channel = notify.ChannelEmail
+	}
+
+	p := &models.NotificationPreferences{
+		UserID:   u.ID,
+		TenantID: u.TenantID,
+		Events:   make(map[string][]string, len(preferenceEvents)),
+	}
+	for _, e := range preferenceEvents {
+		p.Events[e] = []string{channel}
+	}
+	p.Events[models.NotifyEventMarketing] = []string{}
+	return p
+}
+
+// preferencesFor returns the user's stored preferences laid over the
+// defaults, so events added later start with their default channels.
+func (s *Server) preferencesFor(ctx context.Context, u *models.User) (*models.NotificationPreferences, error) {
+	p := defaultPreferences(u)
+
+	stored, err := s.DB.GetNotificationPreferences(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if stored != nil {
+		for e, channels := range stored.Events {
+			if knownPreferenceEvent(e) {
+				p.Events[e] = channels
+			}
+		}
+		p.UpdatedAt = stored.UpdatedAt
+	}
+	return p, nil
+}
+
+// recipientFor returns the address of u on channel, or "" if the user
+// cannot be reached there.
+func recipientFor(u *models.User, channel string) string {
+	switch channel {
+	case notify.ChannelWhatsApp, notify.ChannelSMS:
+		return u.Phone
+	case notify.ChannelEmail:
+		return u.Email
+	}
+	return ""
+}
+
+// notifyUser is the notification dispatcher: it sends text to u on
+// every channel the event is enabled for and that is configured on this
+// server, recording each delivery. OTPs, held and reverted transfer
+// notices bypass the preferences and go to the user's notify_channel. It
+// returns the channels that accepted the message.
+func (s *Server) notifyUser(ctx context.Context, u *models.User, event, text string) []string {
+	if u == nil || len(s.notifiers) == 0 {
+		return nil
+	}
+
+	channels := []string{u.NotifyChannel}
+	if event != models.NotifyEventOTP && event != models.NotifyEventTransferHeld && event != models.NotifyEventTransferReverted {
+		prefs, err := s.preferencesFor(ctx, u)
+		if err != nil {
+			s.logEvent(ctx, "error", "notification_preferences_failed", err.Error(), "notifier")
+			return nil
+		}
+		channels = prefs.Events[event]
+	}
+
+	var sent []string
+	for _, channel := range channels {
+		n, ok := s.notifiers[channel]
+		to := recipientFor(u, channel)
+		if !ok || to == "" {
+			continue
+		}
+		if s.deliver(ctx, n, u, event, to, text) {
+			sent = append(sent, channel)
+		}
+	}
+	return sent
+}
+
+// deliver sends one message and records it in notification_deliveries.
+func (s *Server) deliver(ctx context.Context, n notify.Notifier, u *models.User, event, to, text string) bool {
+	d := &models.NotificationDelivery{
+		ID:        uuid.NewString(),
+		TenantID:  u.TenantID,
+		UserID:    u.ID,
+		Channel:   n.Channel(),
+		Event:     event,
+		Recipient: to,
+		Status:    models.DeliverySent,
+		CreatedAt: s.Clock.Now().UTC(),
+	}
+	d.UpdatedAt = d.CreatedAt
+
+	id, err := n.Send(ctx, notify.Message{To: to, Text: text})
+	if err != nil {
+		d.Status = models.DeliveryFailed
+		d.Error = err.Error()
+		s.logEvent(ctx, "error", "notification_send_failed",
+			fmt.Sprintf("%s %s to user %s: %v", n.Channel(), event, u.ID, err), "notifier")
+	}
+	d.ProviderMessageID = id
+
+	if err := s.DB.CreateNotificationDelivery(ctx, d); err != nil {
+		s.logEvent(ctx, "error", "notification_record_failed", err.Error(), "notifier")
+	}
+	return d.Status == models.DeliverySent
+}
+
+// notifyDetached runs a notification outside the caller so a slow
+// provider never holds up a transfer or a zakat run.
+func (s *Server) notifyDetached(userID, event string, text func() string) {
+	if s.DB == nil || len(s.notifiers) == 0 || userID == "" {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		u, err := s.DB.GetUser(ctx, userID)
+		if err != nil {
+			s.logEvent(ctx, "error", "notification_user_lookup_failed", err.Error(), "notifier")
+			return
+		}
+		s.notifyUser(ctx, u, event, text())
+	}()
+}
+
+// notifyZakatReceipt tells the owner of a wallet that zakat was
+// deducted, with the link to the receipt, and publishes the deduction
+// on the feed.
+func (s *Server) notifyZakatReceipt(zr *models.ZakatRecord) {
+	address := blockchain.CanonicalAddress(zr.WalletAddress)
+	s.feed.publish(feedEvent{
+		Type:      feedZakatDeduction,
+		BlockHash: zr.BlockHash,
+		Address:   address,
+		Amount:    zr.Amount,
+		ReceiptID: zr.ID,
+		Timestamp: zr.CreatedAt.Unix(),
+		addresses: []string{address},
+	})
+	s.notifyDetached(zr.UserID, models.NotifyEventZakatDeduction, func() string {
+		return i18n.Tf(i18n.Default, "Zakat of %s was deducted from wallet %s", fmt.Sprint(zr.Amount), zr.WalletAddress) +
+			"\n" + receiptVerifyURL(zr.ID)
+	})
+}
+
+// notifyIncomingFunds tells the owner of a registered wallet that it
+// received amount units and publishes the funding on the feed.
+func (s *Server) notifyIncomingFunds(address string, amount int) {
+	canonical := blockchain.CanonicalAddress(address)
+	s.feed.publish(feedEvent{
+		Type:      feedWalletFunded,
+		Address:   canonical,
+		Amount:    amount,
+		Timestamp: s.Clock.Now().Unix(),
+		addresses: []string{canonical},
+	})
+	if s.DB == nil || len(s.notifiers) == 0 {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		wp, err := s.DB.GetWalletProfileByAddress(ctx, address)
+		if err != nil || wp == nil {
+			return
+		}
+		u, err := s.DB.GetUser(ctx, wp.UserID)
+		if err != nil {
+			s.logEvent(ctx, "error", "notification_user_lookup_failed", err.Error(), "notifier")
+			return
+		}
+		s.notifyUser(ctx, u, models.NotifyEventIncomingFunds,
+			i18n.Tf(i18n.Default, "You received %s in wallet %s", fmt.Sprint(amount), address))
+	}()
+}
+
+// VerifyWhatsAppWebhook answers the subscription handshake of the
+// WhatsApp Business API with the challenge when the verify token
+// matches WHATSAPP_VERIFY_TOKEN.
+func (s *Server) VerifyWhatsAppWebhook(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	token := os.Getenv("WHATSAPP_VERIFY_TOKEN")
+	if token == "" || q.Get("hub.mode") != "subscribe" || q.Get("hub.verify_token") != token {
+		httpError(w, r, "invalid verify token", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(q.Get("hub.challenge")))
+}
+
+// WhatsAppWebhook records delivery status callbacks. The payload must be
+// signed with WHATSAPP_APP_SECRET.
+func (s *Server) WhatsAppWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	secret := os.Getenv("WHATSAPP_APP_SECRET")
+	if s.DB == nil || secret == "" {
+		httpError(w, r, "whatsapp webhook not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !notify.VerifyWhatsAppSignature(secret, body, r.Header.Get("X-Hub-Signature-256")) {
+		s.logEvent(ctx, "warn", "whatsapp_webhook_bad_signature", "signature mismatch", r.RemoteAddr)
+		httpError(w, r, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	statuses, err := notify.ParseWhatsAppWebhook(body)
+	if err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	updated := 0
+	for _, st := range statuses {
+		at := st.Timestamp
+		if at.IsZero() {
+			at = s.Clock.Now().UTC()
+		}
+		found, err := s.DB.UpdateNotificationStatus(ctx, st.MessageID, st.Status, st.Error, at)
+		if err != nil {
+			s.logEvent(ctx, "error", "notification_status_update_failed", err.Error(), r.RemoteAddr)
+			continue
+		}
+		if found {
+			updated++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int{"received": len(statuses), "updated": updated})
+}
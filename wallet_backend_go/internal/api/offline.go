@@ -0,0 +1,351 @@
+package api
+
+// offline.go accepts transactions that field agents signed while
+// offline. Once the agent is back online the whole batch is submitted;
+// items are validated in client-timestamp order against the chain and
+// against the items accepted before them, so one offline transaction
+// may spend the change of an earlier one. Accepted items are mined
+// together in a single block and every item gets its own verdict.
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/db"
+	"wallet_backend_go/internal/i18n"
+)
+
+// maxOfflineBatch bounds the number of transactions per batch.
+const maxOfflineBatch = 100
+
+type offlineTx struct {
+	// RawHex is the hex encoding of Transaction.Serialize.
+	RawHex          string    `json:"raw_hex"`
+	ClientTimestamp time.Time `json:"client_timestamp"`
+	ClientRef       string    `json:"client_ref,omitempty"`
+}
+
+type offlineBatchRequest struct {
+	Transactions []offlineTx `json:"transactions"`
+	// PINs holds, by sender address, the transaction PIN of senders
+	// who set one.
+	PINs map[string]string `json:"pins,omitempty"`
+}
+
+type offlineTxResult struct {
+	Index     int    `json:"index"`
+	ClientRef string `json:"client_ref,omitempty"`
+	Txid      string `json:"txid,omitempty"`
+	Status    string `json:"status"` // "accepted" or "rejected"
+	Reason    string `json:"reason,omitempty"`
+}
+
+type offlineBatchResponse struct {
+	Accepted  int               `json:"accepted"`
+	Rejected  int               `json:"rejected"`
+	BlockHash string            `json:"block_hash,omitempty"`
+	Results   []offlineTxResult `json:"results"`
+}
+
+// offlineBatch tracks the state built up while validating a batch.
+type offlineBatch struct {
+	accepted map[string]*blockchain.Transaction // by hex txid
+	spent    map[string]bool                    // "txid:vout" spent by accepted items
+}
+
+// SubmitOfflineBatch validates, mines and reports on a batch of
+// pre-signed offline transactions.
+func (s *Server) SubmitOfflineBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if !s.requireFlag(w, r, flagOfflineBatch) {
+		return
+	}
+
+	var req offlineBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Transactions) == 0 || len(req.Transactions) > maxOfflineBatch {
+		httpError(w, r, fmt.Sprintf("batch must contain 1 to %d transactions", maxOfflineBatch), http.StatusBadRequest)
+		return
+	}
+
+	// validate in the order the agent created the transactions
+	order := make([]int, len(req.Transactions))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return req.Transactions[order[a]].ClientTimestamp.Before(req.Transactions[order[b]].ClientTimestamp)
+	})
+
+	results := make([]offlineTxResult, len(req.Transactions))
+	batch := &offlineBatch{
+		accepted: make(map[string]*blockchain.Transaction),
+		spent:    make(map[string]bool),
+	}
+	var mined []*blockchain.Transaction
+
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+
+	for _, i := range order {
+		item := req.Transactions[i]
+		res := offlineTxResult{Index: i, ClientRef: item.ClientRef, Status: "rejected"}
+
+		tx, reason := s.validateOfflineTx(ctx, item, batch)
+		if tx != nil {
+			res.Txid = fmt.Sprintf("%x", tx.ID)
+		}
+		if reason == "" {
+			res.Status = "accepted"
+			mined = append(mined, tx)
+			noteAuditTx(ctx, tx.ID)
+		} else {
+			res.Reason = i18n.T(lang(r), reason)
+		}
+		results[i] = res
+	}
+
+	// the PINs are checked once the signatures show each sender's key
+	// signed, so a stranger cannot use up the owners' attempts; a
+	// wrong one refuses the whole batch, as nothing is mined yet
+	pins := make(map[string]string, len(req.PINs))
+	for addr, pin := range req.PINs {
+		pins[blockchain.CanonicalAddress(addr)] = pin
+	}
+	checked := make(map[string]bool)
+	for _, tx := range mined {
+		for _, from := range txSenders(tx) {
+			if checked[from] {
+				continue
+			}
+			checked[from] = true
+			if !s.requireTransactionPIN(w, r, from, pins[from]) {
+				return
+			}
+		}
+	}
+
+	resp := offlineBatchResponse{Accepted: len(mined), Rejected: len(results) - len(mined), Results: results}
+
+	if len(mined) > 0 {
+		newBlock, err := s.BC.AddBlockContext(ctx, mined)
+		if err != nil {
+			mineError(w, r, err)
+			return
+		}
+		height := len(s.BC.Blocks) - 1
+		s.reports.invalidateBlock(newBlock)
+		_ = s.UTXO.Reindex()
+		resp.BlockHash = fmt.Sprintf("%x", newBlock.Hash)
+
+		s.persistMinedBlock(newBlock, height, mined, "offline")
+		for _, tx := range mined {
+			_, receiver, amount, _ := txParties(tx)
+			s.maybeAutoZakat(receiver, amount)
+			s.notifyIncomingFunds(receiver, amount)
+		}
+	}
+
+	if s.DB != nil {
+		s.logEvent(ctx, "info", "offline_batch",
+			fmt.Sprintf("offline batch: %d accepted, %d rejected", resp.Accepted, resp.Rejected),
+			r.RemoteAddr,
+		)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// validateOfflineTx decodes and checks one offline transaction. It
+// returns the decoded transaction (when decodable) and a rejection
+// reason, or "" if the transaction was accepted into the batch. Must be
+// called with chainMu held.
+func (s *Server) validateOfflineTx(ctx context.Context, item offlineTx, batch *offlineBatch) (*blockchain.Transaction, string) {
+	tx, err := decodeRawTx(item.RawHex)
+	if err != nil {
+		return nil, "raw_hex must be a hex-encoded transaction"
+	}
+	return tx, s.validateRawTx(ctx, tx, batch)
+}
+
+// txSenders returns the distinct addresses whose keys sign the inputs
+// of tx, in input order.
+func txSenders(tx *blockchain.Transaction) []string {
+	var senders []string
+	seen := make(map[string]bool)
+	for _, in := range tx.Vin {
+		from := blockchain.PubKeyAddress(in.PubKey)
+		if !seen[from] {
+			seen[from] = true
+			senders = append(senders, from)
+		}
+	}
+	return senders
+}
+
+// decodeRawTx decodes the hex encoding of Transaction.Serialize.
+func decodeRawTx(rawHex string) (*blockchain.Transaction, error) {
+	raw, err := hex.DecodeString(rawHex)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 {
+		return nil, errors.New("empty transaction")
+	}
+	return blockchain.DeserializeTransaction(raw)
+}
+
+// validateRawTx checks a signed transaction built outside the node
+// against the chain and the transactions accepted into batch before
+// it, and accepts it into batch. It returns the rejection reason, or ""
+// if the transaction was accepted. Must be called with chainMu held.
+func (s *Server) validateRawTx(ctx context.Context, tx *blockchain.Transaction, batch *offlineBatch) string {
+	if tx.IsCoinbase() {
+		return "coinbase transactions are not accepted"
+	}
+	if !bytes.Equal(tx.ComputeID(), tx.ID) {
+		return "transaction id does not match its contents"
+	}
+	if len(tx.Vin) == 0 || len(tx.Vout) == 0 {
+		return "transaction has no inputs or outputs"
+	}
+	// like Blockchain.VerifyTransaction, a time-locked output cannot be
+	// spent by dating the spend into the future
+	if tx.LockTime > s.Clock.Now().Unix() {
+		return "transaction lock time has not passed"
+	}
+
+	txid := fmt.Sprintf("%x", tx.ID)
+	if batch.accepted[txid] != nil {
+		return "duplicate transaction in batch"
+	}
+	if _, err := s.BC.FindTransaction(tx.ID); err == nil {
+		return "transaction already mined"
+	}
+
+	totalOut := 0
+	for _, out := range tx.Vout {
+		if out.Value <= 0 {
+			return "output amounts must be positive"
+		}
+		totalOut += out.Value
+	}
+
+	prevTXs := make(map[string]blockchain.Transaction)
+	totalIn := 0
+	var spends []string
+	for _, in := range tx.Vin {
+		prevID := fmt.Sprintf("%x", in.Txid)
+		outpoint := fmt.Sprintf("%s:%d", prevID, in.Vout)
+
+		var prev blockchain.Transaction
+		if p := batch.accepted[prevID]; p != nil {
+			prev = *p
+		} else {
+			p, err := s.BC.FindTransaction(in.Txid)
+			if err != nil {
+				return "input references an unknown transaction"
+			}
+			prev = p
+			if s.BC.IsOutputSpent(in.Txid, in.Vout) {
+				return "input already spent"
+			}
+		}
+		if in.Vout < 0 || in.Vout >= len(prev.Vout) {
+			return "input references an unknown output"
+		}
+		if batch.spent[outpoint] {
+			return "input already spent"
+		}
+		for _, sp := range spends {
+			if sp == outpoint {
+				return "input spent twice"
+			}
+		}
+
+		// the signer must own the output it spends
+		out := prev.Vout[in.Vout]
+		owner := sha256.Sum256(in.PubKey)
+		if !out.IsLockedWith(owner[:]) {
+			return "input is not owned by the signer"
+		}
+
+		prevTXs[prevID] = prev
+		totalIn += out.Value
+		spends = append(spends, outpoint)
+	}
+
+	if totalOut > totalIn {
+		return "outputs exceed inputs"
+	}
+	if !tx.Verify(prevTXs) {
+		return "invalid signature"
+	}
+	if err := s.BC.CheckPolicy(ctx, tx); err != nil {
+		if rej, ok := blockchain.AsRejection(err); ok {
+			return rej.Reason
+		}
+		return "failed to validate transaction"
+	}
+
+	batch.accepted[txid] = tx
+	for _, sp := range spends {
+		batch.spent[sp] = true
+	}
+	return ""
+}
+
+// persistMinedBlock saves the block and its transactions, recorded as
+// txType, to Supabase in the background, like SendTransaction does.
+func (s *Server) persistMinedBlock(b *blockchain.Block, height int, txs []*blockchain.Transaction, txType string) {
+	if s.DB == nil {
+		return
+	}
+
+	s.persistence.start(b, txs, txType, s.Clock.Now())
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// one round trip per kind instead of one per transaction
+		var persistErr error
+		blockHash := fmt.Sprintf("%x", b.Hash)
+		batch := db.NewBatch(s.DB)
+		if err := batch.AddBlock(ctx, height, b); err != nil {
+			log.Printf("failed to save block to Supabase: %v", err)
+			persistErr = err
+		}
+		for _, tx := range txs {
+			sender, receiver, amount, _ := txParties(tx)
+			if err := batch.AddTransaction(ctx, blockHash, tx, sender, receiver, amount, txType); err != nil {
+				log.Printf("failed to save transaction to Supabase: %v", err)
+				persistErr = err
+			}
+		}
+		if err := addFeeRecord(ctx, batch, blockHash, b); err != nil {
+			log.Printf("failed to save fee transaction to Supabase: %v", err)
+			persistErr = err
+		}
+		if err := batch.Flush(ctx); err != nil {
+			log.Printf("failed to save %s block to Supabase: %v", txType, err)
+			persistErr = err
+		}
+		s.persistence.finish(txs, persistErr, s.Clock.Now())
+		s.reports.invalidateBlock(b)
+	}()
+}
@@ -0,0 +1,86 @@
+package api_test
+
+import (
+	"encoding/hex"
+	"net/http"
+	"testing"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/testutil"
+)
+
+// timeLocked mines a transfer of amount from one wallet to an output
+// only to can spend, from unlock on, and returns it.
+func timeLocked(t *testing.T, c *testutil.Chain, from, to *blockchain.Wallet, amount int, unlock int64) *blockchain.Transaction {
+	t.Helper()
+	fromHash, _ := blockchain.DecodeAddress(from.GetAddress())
+	toHash, _ := blockchain.DecodeAddress(to.GetAddress())
+	acc, spendable := c.UTXO.FindSpendableOutputs(fromHash, amount)
+	tx, prevTXs, err := blockchain.NewUnsignedTransaction(
+		[]blockchain.Payment{{To: to.GetAddress(), Amount: amount}}, 0, c.BC, spendable, fromHash, acc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Vout[0], err = blockchain.NewConditionOutput(amount, blockchain.TimeLock(unlock, toHash)); err != nil {
+		t.Fatal(err)
+	}
+	tx.ID = nil
+	tx.SetID()
+	if err := tx.Sign(from.PrivateKey, prevTXs); err != nil {
+		t.Fatal(err)
+	}
+	c.BC.AddBlock([]*blockchain.Transaction{tx})
+	return tx
+}
+
+func TestFutureLockTimeRejected(t *testing.T) {
+	c := testutil.NewChain(t)
+	alice, bob := testutil.Wallet("alice"), testutil.Wallet("bob")
+	c.Fund(t, alice)
+	unlock := c.Clock.Now().Add(time.Hour).Unix()
+	locked := timeLocked(t, c, alice, bob, 1000, unlock)
+	h := testutil.NewServer(t, c).Router()
+	height := len(c.BC.Blocks)
+
+	// dating the spend at the unlock time satisfies the output's
+	// condition, but the chain's clock has not got there yet
+	bobHash, _ := blockchain.DecodeAddress(bob.GetAddress())
+	spend := &blockchain.Transaction{
+		Vin:      []blockchain.TxInput{{Txid: locked.ID, Vout: 0}},
+		Vout:     []blockchain.TxOutput{{Value: 1000, PubKeyHash: bobHash}},
+		LockTime: unlock,
+	}
+	spend.SetID()
+	if err := spend.Sign(bob.PrivateKey, map[string]blockchain.Transaction{hex.EncodeToString(locked.ID): *locked}); err != nil {
+		t.Fatal(err)
+	}
+	raw := hex.EncodeToString(spend.Serialize())
+
+	submit := map[string]interface{}{"raw_hex": raw}
+	testutil.DecodeJSON(t, testutil.Do(t, h, "POST", "/transactions/submit", submit), http.StatusBadRequest, nil)
+
+	var batch struct {
+		Accepted int `json:"accepted"`
+		Rejected int `json:"rejected"`
+		Results  []struct {
+			Reason string `json:"reason"`
+		} `json:"results"`
+	}
+	rec := testutil.Do(t, h, "POST", "/transactions/offline-batch", map[string]interface{}{
+		"transactions": []map[string]interface{}{{"raw_hex": raw, "client_timestamp": c.Clock.Now()}},
+	})
+	testutil.DecodeJSON(t, rec, http.StatusOK, &batch)
+	if batch.Accepted != 0 || batch.Rejected != 1 || batch.Results[0].Reason != "transaction lock time has not passed" {
+		t.Errorf("offline batch = %+v, want the spend rejected for its lock time", batch)
+	}
+	if len(c.BC.Blocks) != height {
+		t.Fatalf("chain grew to %d blocks, want %d", len(c.BC.Blocks), height)
+	}
+
+	c.Clock.Advance(time.Hour)
+	testutil.DecodeJSON(t, testutil.Do(t, h, "POST", "/transactions/submit", submit), http.StatusOK, nil)
+	if len(c.BC.Blocks) != height+1 {
+		t.Errorf("chain has %d blocks once unlocked, want %d", len(c.BC.Blocks), height+1)
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+// otp_guard.go keeps the OTP endpoints from revealing which emails are
+// registered and from being brute forced. request-otp answers every
+// well-formed request the same way and only issues a code to registered
+// emails, and a code is discarded after otpMaxAttempts wrong guesses.
+// The endpoints are paced by the OTP token buckets of rate_limit.go.
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// otpMaxAttempts wrong codes invalidate an OTP.
+const otpMaxAttempts = 5
+
+func envLimit(name string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || n <= 0 {
+		return def
+	}
+	return n
+}
+
+// otpEcho reports whether request-otp returns the code in its response
+// (OTP_ECHO=true), for demos and local development without an email or
+// WhatsApp channel. Unregistered emails then get a code that is never
+// accepted.
+func otpEcho() bool {
+	return os.Getenv("OTP_ECHO") == "true"
+}
+
+// clientHost returns the IP of the client without the port.
+func clientHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// consumeOTP reports whether code is the current OTP of email, removing
+// it if so. The code is looked up, checked and consumed under one lock
+// so concurrent guesses cannot exceed otpMaxAttempts.
+func (s *Server) consumeOTP(email, code string) bool {
+	s.otpMu.Lock()
+	defer s.otpMu.Unlock()
+
+	entry, ok := s.otps[email]
+	if !ok {
+		return false
+	}
+	now := s.Clock.Now()
+	if !now.After(entry.Expires) && entry.Code == code {
+		delete(s.otps, email)
+		return true
+	}
+	entry.Attempts++
+	if entry.Attempts >= otpMaxAttempts || now.After(entry.Expires) {
+		delete(s.otps, email)
+	} else {
+		s.otps[email] = entry
+	}
+	return false
+}
@@ -0,0 +1,372 @@
+package api
+
+// p2p.go connects a writing node to the other writing nodes in
+// PEER_ADDRS (see internal/p2p). It serves the peer API, the tip and
+// the headers and blocks of the chain, takes announcements of new
+// blocks, announces its own and pulls a longer chain from its peers
+// every P2P_SYNC_INTERVAL seconds or as soon as one is announced. Blocks
+// from peers are checked (proof-of-work, producer signatures,
+// transactions, double spends) before they join the chain, and mirrored
+// to Supabase like mined ones.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/db"
+	"wallet_backend_go/internal/i18n"
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/p2p"
+)
+
+const (
+	defaultP2PSyncInterval = 30 // seconds
+	p2pRequestTimeout      = 30 * time.Second
+	p2pAnnounceQueue       = 64
+)
+
+// peerNode is the node's link to its peers; nil without PEER_ADDRS.
+type peerNode struct {
+	syncer   *p2p.Syncer
+	wake     chan struct{}
+	announce chan p2p.Header
+
+	mu      sync.Mutex
+	lastErr map[string]string // peer -> last sync error
+}
+
+// CheckPeers refuses PEER_ADDRS on a node that mints coinbases its
+// peers do not accept (see Blockchain.Adopt): testnet faucet drips,
+// bridge credits and the funding blocks of a sandbox.
+func CheckPeers() error {
+	peers, err := p2p.PeersFromEnv()
+	if err != nil || len(peers) == 0 {
+		return err
+	}
+	switch {
+	case testnetMode():
+		return fmt.Errorf("cannot be set with NETWORK=testnet, peers refuse faucet drips")
+	case sandboxMode():
+		return fmt.Errorf("cannot be set with SANDBOX=true, peers refuse its funding blocks")
+	case strings.TrimSpace(os.Getenv("BRIDGE_ADDRESSES")) != "":
+		return fmt.Errorf("cannot be set with BRIDGE_ADDRESSES, peers refuse bridge credits")
+	}
+	return nil
+}
+
+// startPeers starts syncing with peers and announcing mined blocks to
+// them.
+func (s *Server) startPeers(peers []string) {
+	s.peers = &peerNode{
+		syncer: &p2p.Syncer{
+			Peers:  peers,
+			Client: p2p.NewClient(p2pRequestTimeout),
+			Chain:  serverChain{s},
+		},
+		wake:     make(chan struct{}, 1),
+		announce: make(chan p2p.Header, p2pAnnounceQueue),
+		lastErr:  make(map[string]string),
+	}
+	publish := s.BC.OnBlock
+	s.BC.OnBlock = func(height int, b *blockchain.Block) {
+		if publish != nil {
+			publish(height, b)
+		}
+		select {
+		case s.peers.announce <- p2p.HeaderOf(height, b):
+		default:
+			// peers that miss an announcement catch up when they poll
+		}
+	}
+	go s.runPeerSync()
+	go s.runAnnouncer()
+}
+
+// runPeerSync pulls from the peers on every tick and on every
+// announcement.
+func (s *Server) runPeerSync() {
+	for {
+		s.syncPeers()
+		interval := time.Duration(envLimit("P2P_SYNC_INTERVAL", defaultP2PSyncInterval)) * time.Second
+		select {
+		case <-time.After(interval):
+		case <-s.peers.wake:
+		}
+	}
+}
+
+func (s *Server) syncPeers() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	n, errs := s.peers.syncer.Sync(ctx)
+	if n > 0 {
+		log.Printf("p2p: adopted %d blocks from peers", n)
+	}
+
+	s.peers.mu.Lock()
+	defer s.peers.mu.Unlock()
+	for _, peer := range s.peers.syncer.Peers {
+		msg := ""
+		if err := errs[peer]; err != nil {
+			msg = err.Error()
+		}
+		if msg != s.peers.lastErr[peer] && msg != "" {
+			// log each new problem once rather than on every tick
+			log.Printf("p2p: sync from %s: %s", peer, msg)
+		}
+		s.peers.lastErr[peer] = msg
+	}
+}
+
+// runAnnouncer tells the peers about every block added to the chain.
+func (s *Server) runAnnouncer() {
+	for h := range s.peers.announce {
+		ctx, cancel := context.WithTimeout(context.Background(), p2pRequestTimeout)
+		for peer, err := range s.peers.syncer.Announce(ctx, h) {
+			log.Printf("p2p: announce block %d to %s: %v", h.Height, peer, err)
+		}
+		cancel()
+	}
+}
+
+// serverChain is the server's chain as p2p.Syncer sees it.
+type serverChain struct{ s *Server }
+
+func (c serverChain) Tip() p2p.Header {
+	c.s.chainMu.Lock()
+	defer c.s.chainMu.Unlock()
+	height := len(c.s.BC.Blocks) - 1
+	return p2p.HeaderOf(height, c.s.BC.Blocks[height])
+}
+
+func (c serverChain) Header(height int) (p2p.Header, bool) {
+	c.s.chainMu.Lock()
+	defer c.s.chainMu.Unlock()
+	if height < 0 || height >= len(c.s.BC.Blocks) {
+		return p2p.Header{}, false
+	}
+	return p2p.HeaderOf(height, c.s.BC.Blocks[height]), true
+}
+
+func (c serverChain) Adopt(fork int, blocks []*blockchain.Block) error {
+	return c.s.adoptBlocks(fork, blocks)
+}
+
+// adoptBlocks replaces the blocks above fork with blocks received from
+// a peer, reindexes the UTXO set and mirrors the change to Supabase.
+// Transactions of the blocks it drops that the new blocks do not carry
+// are reverted: their rows go, and the senders are told to send again.
+func (s *Server) adoptBlocks(fork int, blocks []*blockchain.Block) error {
+	s.chainMu.Lock()
+	dropped, err := s.BC.Adopt(fork, blocks)
+	if err != nil && !errors.Is(err, blockchain.ErrStorage) {
+		s.chainMu.Unlock()
+		return err
+	}
+	added := s.BC.Blocks[min(fork+1, len(s.BC.Blocks)):]
+	for _, b := range dropped {
+		s.reports.invalidateBlock(b)
+	}
+	for _, b := range added {
+		s.reports.invalidateBlock(b)
+	}
+	_ = s.UTXO.Reindex()
+	s.chainMu.Unlock()
+
+	carried := make(map[string]bool)
+	for _, b := range added {
+		for _, tx := range b.Transactions {
+			carried[fmt.Sprintf("%x", tx.ID)] = true
+		}
+	}
+	var droppedHashes, reverted []string
+	var revertedTxs []*blockchain.Transaction
+	for _, b := range dropped {
+		droppedHashes = append(droppedHashes, fmt.Sprintf("%x", b.Hash))
+		for _, tx := range b.Transactions {
+			if txid := fmt.Sprintf("%x", tx.ID); !carried[txid] {
+				reverted = append(reverted, txid)
+				revertedTxs = append(revertedTxs, tx)
+			}
+		}
+	}
+
+	ctx := context.Background()
+	if len(dropped) > 0 {
+		s.logEvent(ctx, "warn", "chain_reorg",
+			fmt.Sprintf("switched to a peer's chain at height %d, dropping %d blocks; reverted transactions: %s",
+				fork, len(dropped), strings.Join(reverted, ", ")),
+			"")
+		for _, tx := range revertedTxs {
+			s.flagRevertedTx(ctx, tx)
+		}
+	}
+	s.persistPeerBlocks(fork+1, added, droppedHashes, reverted)
+	return err
+}
+
+// flagRevertedTx logs a transaction a reorg took off the chain and
+// tells the owner of its sending wallet that it must be sent again.
+func (s *Server) flagRevertedTx(ctx context.Context, tx *blockchain.Transaction) {
+	from, to, amount, kind := txParties(tx)
+	txid := fmt.Sprintf("%x", tx.ID)
+	s.logEvent(ctx, "warn", "tx_reverted",
+		fmt.Sprintf("%s %s of %d from %s to %s was reverted by a chain reorg", kind, txid, amount, from, to), "")
+	if tx.IsCoinbase() || s.DB == nil || len(s.notifiers) == 0 {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		wp, err := s.DB.GetWalletProfileByAddress(ctx, from)
+		if err != nil || wp == nil {
+			return
+		}
+		u, err := s.DB.GetUser(ctx, wp.UserID)
+		if err != nil {
+			s.logEvent(ctx, "error", "notification_user_lookup_failed", err.Error(), "notifier")
+			return
+		}
+		text := i18n.Tf(i18n.Default, "Your transfer of %s to %s (transaction %s) was reverted by a chain reorganization; please send it again",
+			fmt.Sprint(amount), to, txid)
+		s.notifyUser(ctx, u, models.NotifyEventTransferReverted, text)
+	}()
+}
+
+// persistPeerBlocks mirrors a reorg to Supabase: it removes the rows of
+// the dropped blocks and the receipts of the reverted transactions,
+// then writes the blocks received from a peer, the first at height
+// first, with their transactions. Dropping first keeps one block per
+// height for readers such as db.SyncChain.
+func (s *Server) persistPeerBlocks(first int, blocks []*blockchain.Block, droppedHashes, reverted []string) {
+	if s.DB == nil || (len(blocks) == 0 && len(droppedHashes) == 0) {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		if err := s.DB.DropBlocks(ctx, droppedHashes, reverted); err != nil {
+			s.logEvent(ctx, "error", "chain_reorg_persist_failed",
+				fmt.Sprintf("failed to remove dropped blocks %s from Supabase: %v", strings.Join(droppedHashes, ", "), err), "")
+		}
+
+		batch := db.NewBatch(s.DB)
+		for i, b := range blocks {
+			if err := batch.AddBlock(ctx, first+i, b); err != nil {
+				log.Printf("failed to save peer block to Supabase: %v", err)
+			}
+			blockHash := fmt.Sprintf("%x", b.Hash)
+			for _, tx := range b.Transactions {
+				sender, receiver, amount, txType := txParties(tx)
+				if err := batch.AddTransaction(ctx, blockHash, tx, sender, receiver, amount, txType); err != nil {
+					log.Printf("failed to save peer transaction to Supabase: %v", err)
+				}
+			}
+		}
+		if err := batch.Flush(ctx); err != nil {
+			log.Printf("failed to save peer blocks to Supabase: %v", err)
+		}
+	}()
+}
+
+// chainRange reads ?from= and ?limit= (1 to max, by default max).
+func chainRange(r *http.Request, max int) (from, limit int, ok bool) {
+	limit = max
+	q := r.URL.Query()
+	if v := q.Get("from"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, false
+		}
+		from = n
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > max {
+			return 0, 0, false
+		}
+		limit = n
+	}
+	return from, limit, true
+}
+
+// PeerTip returns the header of the last block.
+func (s *Server) PeerTip(w http.ResponseWriter, r *http.Request) {
+	tip := serverChain{s}.Tip()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(tip)
+}
+
+// PeerHeaders returns the headers of the blocks from ?from= on.
+func (s *Server) PeerHeaders(w http.ResponseWriter, r *http.Request) {
+	from, limit, ok := chainRange(r, p2p.MaxHeaders)
+	if !ok {
+		httpError(w, r, "invalid from or limit", http.StatusBadRequest)
+		return
+	}
+	headers := []p2p.Header{}
+	s.chainMu.Lock()
+	for h := from; h < len(s.BC.Blocks) && len(headers) < limit; h++ {
+		headers = append(headers, p2p.HeaderOf(h, s.BC.Blocks[h]))
+	}
+	s.chainMu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(headers)
+}
+
+// PeerBlocks returns the blocks from ?from= on, in full.
+func (s *Server) PeerBlocks(w http.ResponseWriter, r *http.Request) {
+	from, limit, ok := chainRange(r, p2p.MaxBlocks)
+	if !ok {
+		httpError(w, r, "invalid from or limit", http.StatusBadRequest)
+		return
+	}
+	s.chainMu.Lock()
+	blocks := []*blockchain.Block{}
+	if from < len(s.BC.Blocks) {
+		blocks = append(blocks, s.BC.Blocks[from:min(from+limit, len(s.BC.Blocks))]...)
+	}
+	s.chainMu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(blocks)
+}
+
+// PeerAnnounce takes a peer's announcement of a new block. A block
+// above our tip wakes the sync, which pulls from the configured peers
+// only: the announcement itself is not trusted.
+func (s *Server) PeerAnnounce(w http.ResponseWriter, r *http.Request) {
+	if s.peers == nil {
+		httpError(w, r, "peer sync is not enabled", http.StatusNotFound)
+		return
+	}
+	var h p2p.Header
+	if err := json.NewDecoder(r.Body).Decode(&h); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	status := "known"
+	if h.Height > (serverChain{s}).Tip().Height {
+		status = "syncing"
+		select {
+		case s.peers.wake <- struct{}{}:
+		default:
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
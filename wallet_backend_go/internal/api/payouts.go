@@ -0,0 +1,517 @@
+package api
+
+// payouts.go pays the beneficiaries who are paid outside the chain (see
+// package payout), to a stablecoin address, a bank account or a mobile
+// wallet. Each disbursement goes by a channel: the beneficiary's wallet
+// or one of their payout methods, by default their payout_method (see
+// defaultChannel); a distribution may pick another one per beneficiary.
+// A distribution takes the parts paid outside the chain out of the pool
+// on chain and records a pending payout for each part. PAYOUT_POOL_MODE decides how the parts
+// leave the pool: settle (the default) pays them to the settlement
+// wallet in PAYOUT_SETTLEMENT_ADDRESS, which funds the providers, and
+// burn burns them, for providers funded in fiat off chain. Every
+// PAYOUT_INTERVAL seconds the leader submits the pending payouts: each
+// is priced at the current rate of the provider's currency and sent
+// with its id as the idempotency key, so a payout submitted twice is
+// paid once. The provider's webhooks, posted to
+// /webhooks/payouts/{method}, report whether it completed or failed.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/payout"
+)
+
+const (
+	defaultPayoutInterval  = 30 // seconds
+	payoutMaxAttempts      = 5
+	payoutBatchSize        = 100
+	defaultPayoutListLimit = 100
+)
+
+// channelWallet is the channel paying a beneficiary's wallet on chain.
+const channelWallet = "wallet"
+
+// Pool modes.
+const (
+	payoutModeSettle = "settle"
+	payoutModeBurn   = "burn"
+)
+
+type payoutsResponse struct {
+	Payouts []models.Payout `json:"payouts"`
+}
+
+// validPayoutAccount checks a beneficiary's payout method, account and
+// bank code and returns the message to report, or "" if they are valid.
+func validPayoutAccount(method, account, bankCode string) string {
+	if method == "" {
+		if account != "" || bankCode != "" {
+			return "payout_account needs a payout_method"
+		}
+		return ""
+	}
+	if !payout.Known(method) {
+		return "invalid payout method"
+	}
+	if !payout.ValidAccount(method, account) {
+		return "invalid payout account"
+	}
+	if bankCode != "" && (method != payout.MethodBank || !payout.ValidBankCode(bankCode)) {
+		return "invalid bank code"
+	}
+	return ""
+}
+
+// validMobileWallet checks a beneficiary's mobile wallet number and
+// provider and returns the message to report, or "" if they are valid.
+func validMobileWallet(number, provider string) string {
+	if number == "" && provider == "" {
+		return ""
+	}
+	if !payout.IsMobile(provider) {
+		return "invalid mobile provider"
+	}
+	if !payout.ValidAccount(provider, number) {
+		return "invalid mobile number"
+	}
+	return ""
+}
+
+// payoutAccount returns b's account for method, or "" if b has none.
+func payoutAccount(b *models.Beneficiary, method string) string {
+	switch {
+	case method == "":
+		return ""
+	case method == b.PayoutMethod:
+		return b.PayoutAccount
+	case method == b.MobileProvider:
+		return b.MobileNumber
+	}
+	return ""
+}
+
+// defaultChannel returns the channel b is paid by unless a distribution
+// picks another: b's payout method, else b's wallet, else b's mobile
+// wallet.
+func defaultChannel(b *models.Beneficiary) string {
+	switch {
+	case b.PayoutMethod != "":
+		return b.PayoutMethod
+	case b.WalletAddress != "":
+		return channelWallet
+	case b.MobileProvider != "":
+		return b.MobileProvider
+	}
+	return channelWallet
+}
+
+func payoutSettlementAddress() string {
+	return strings.TrimSpace(os.Getenv("PAYOUT_SETTLEMENT_ADDRESS"))
+}
+
+func payoutPoolMode() string {
+	if m := strings.TrimSpace(os.Getenv("PAYOUT_POOL_MODE")); m != "" {
+		return m
+	}
+	return payoutModeSettle
+}
+
+// payoutRecipient returns the payment on chain, without its amount, of
+// b's part paid by channel: to b's wallet or, when b is paid through a
+// provider, to the settlement wallet or burned. When b cannot be paid
+// by channel it returns the reason.
+func (s *Server) payoutRecipient(b models.Beneficiary, channel string) (blockchain.Payment, string) {
+	if channel == channelWallet {
+		if !blockchain.ValidateAddress(b.WalletAddress) {
+			return blockchain.Payment{}, "has no valid wallet"
+		}
+		return blockchain.Payment{To: b.WalletAddress}, ""
+	}
+	if payoutAccount(&b, channel) == "" {
+		return blockchain.Payment{}, "has no " + channel + " account"
+	}
+	if s.payouts[channel] == nil {
+		return blockchain.Payment{}, fmt.Sprintf("is paid by %s, which is not configured", channel)
+	}
+	if payoutPoolMode() == payoutModeBurn {
+		return blockchain.Payment{Burn: true}, ""
+	}
+	settlement := payoutSettlementAddress()
+	if !blockchain.ValidateAddress(settlement) {
+		return blockchain.Payment{}, "is paid by " + channel + ", but PAYOUT_SETTLEMENT_ADDRESS is not set"
+	}
+	return blockchain.Payment{To: settlement}, ""
+}
+
+// newPayout returns a pending payout of units to b's account for method.
+func newPayout(b *models.Beneficiary, method, tenant, disbursementID string, units int, now time.Time) models.Payout {
+	name, bankCode := b.FullName, ""
+	if method == b.PayoutMethod {
+		if b.PayoutAccountName != "" {
+			name = b.PayoutAccountName
+		}
+		bankCode = b.PayoutBankCode
+	}
+	return models.Payout{
+		ID:             uuid.NewString(),
+		TenantID:       tenant,
+		DisbursementID: disbursementID,
+		BeneficiaryID:  b.ID,
+		Method:         method,
+		Account:        payoutAccount(b, method),
+		Name:           name,
+		BankCode:       bankCode,
+		Units:          units,
+		Status:         models.PayoutPending,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+}
+
+// recordPayouts records a pending payout for every disbursement paid
+// through a provider. A disbursement without a wallet address was
+// burned.
+func (s *Server) recordPayouts(ctx context.Context, records []models.Disbursement, beneficiaries map[string]models.Beneficiary, ip string) {
+	now := s.Clock.Now().UTC()
+	var payouts []models.Payout
+	for _, d := range records {
+		if d.PayoutMethod == "" {
+			continue
+		}
+		b := beneficiaries[d.BeneficiaryID]
+		p := newPayout(&b, d.PayoutMethod, d.TenantID, d.ID, d.Amount, now)
+		p.Burned = d.WalletAddress == ""
+		payouts = append(payouts, p)
+	}
+	if err := s.DB.CreatePayouts(ctx, payouts); err != nil {
+		// the parts left the pool on chain; the log names them
+		for _, p := range payouts {
+			s.logEvent(ctx, "error", "payout_save_failed",
+				fmt.Sprintf("%s payout of %d to beneficiary %s for disbursement %s: %v", p.Method, p.Units, p.BeneficiaryID, p.DisbursementID, err), ip)
+		}
+	}
+}
+
+// runPayouts submits the pending payouts every PAYOUT_INTERVAL seconds.
+func (s *Server) runPayouts() {
+	for {
+		s.runScheduled("payouts", s.payoutTick)
+		time.Sleep(time.Duration(envLimit("PAYOUT_INTERVAL", defaultPayoutInterval)) * time.Second)
+	}
+}
+
+func (s *Server) payoutTick() {
+	if s.DB == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	pending, err := s.DB.ListPayouts(ctx, "", models.PayoutPending, payoutBatchSize)
+	if err != nil {
+		log.Printf("payouts: failed to list pending payouts: %v", err)
+		return
+	}
+	var rates lazyRates
+	for i := range pending {
+		s.submitPayout(ctx, &pending[i], &rates)
+	}
+}
+
+// submitPayout sends p to its provider. A payout is priced once, on its
+// first attempt; failures are retried on the next tick up to
+// payoutMaxAttempts times, and a transfer the provider rejects fails at
+// once.
+func (s *Server) submitPayout(ctx context.Context, p *models.Payout, rates *lazyRates) {
+	a := s.payouts[p.Method]
+	if a == nil {
+		s.savePayoutError(ctx, p, fmt.Sprintf("%s payouts are not configured", p.Method))
+		return
+	}
+	if p.Amount == "" {
+		if !rates.loaded {
+			quote, err := s.currentPrices(ctx)
+			rates.rates, rates.err, rates.loaded = quote.Rates, err, true
+		}
+		currency := a.Currency()
+		rate := rates.rates[currency]
+		if rate <= 0 {
+			rate = rates.rates[payout.Pegs[currency]]
+		}
+		if rates.err != nil || rate <= 0 {
+			msg := fmt.Sprintf("no %s rate", currency)
+			if rates.err != nil {
+				msg += ": " + rates.err.Error()
+			}
+			s.savePayoutError(ctx, p, msg)
+			return
+		}
+		value := new(big.Rat).Mul(big.NewRat(int64(p.Units), 1), new(big.Rat).SetFloat64(rate))
+		p.Amount, p.Currency, p.Rate = value.FloatString(2), currency, rate
+	}
+
+	p.Attempts++
+	res, err := a.Send(ctx, payout.Transfer{
+		Reference: p.ID,
+		Amount:    p.Amount,
+		Currency:  p.Currency,
+		Account:   p.Account,
+		Name:      p.Name,
+		BankCode:  p.BankCode,
+	})
+	if err != nil {
+		if errors.Is(err, payout.ErrRejected) || p.Attempts >= payoutMaxAttempts {
+			s.finishPayout(ctx, p, models.PayoutFailed, err.Error(), "scheduler")
+			return
+		}
+		s.savePayoutError(ctx, p, err.Error())
+		s.logEvent(ctx, "warn", "payout_submit_failed",
+			fmt.Sprintf("payout %s (attempt %d): %v", p.ID, p.Attempts, err), "scheduler")
+		return
+	}
+
+	p.ExternalRef, p.ProviderStatus = res.ExternalRef, res.ProviderStatus
+	switch res.Status {
+	case payout.StatusCompleted:
+		s.finishPayout(ctx, p, models.PayoutCompleted, "", "scheduler")
+	case payout.StatusFailed:
+		s.finishPayout(ctx, p, models.PayoutFailed, res.Detail, "scheduler")
+	default:
+		p.Status, p.Error, p.UpdatedAt = models.PayoutSubmitted, "", s.Clock.Now().UTC()
+		if err := s.DB.UpdatePayout(ctx, p); err != nil {
+			// submitted again, under the same reference, on the next tick
+			log.Printf("payouts: failed to update payout %s: %v", p.ID, err)
+			return
+		}
+		s.logEvent(ctx, "info", "payout_submitted",
+			fmt.Sprintf("payout %s of %s %s (%d units) to beneficiary %s submitted as %s %s",
+				p.ID, p.Amount, p.Currency, p.Units, p.BeneficiaryID, p.Method, p.ExternalRef), "scheduler")
+	}
+}
+
+func (s *Server) savePayoutError(ctx context.Context, p *models.Payout, msg string) {
+	p.Error, p.UpdatedAt = msg, s.Clock.Now().UTC()
+	if err := s.DB.UpdatePayout(ctx, p); err != nil {
+		log.Printf("payouts: failed to update payout %s: %v", p.ID, err)
+	}
+}
+
+// finishPayout records the outcome of p.
+func (s *Server) finishPayout(ctx context.Context, p *models.Payout, status, detail, ip string) {
+	now := s.Clock.Now().UTC()
+	p.Status, p.Error, p.UpdatedAt = status, detail, now
+	if status == models.PayoutCompleted {
+		p.CompletedAt = &now
+	}
+	if err := s.DB.UpdatePayout(ctx, p); err != nil {
+		s.logEvent(ctx, "error", "payout_save_failed", fmt.Sprintf("payout %s %s: %v", p.ID, status, err), ip)
+		return
+	}
+	if status == models.PayoutCompleted {
+		s.logEvent(ctx, "info", "payout_completed",
+			fmt.Sprintf("payout %s of %s %s to beneficiary %s completed (%s %s)", p.ID, p.Amount, p.Currency, p.BeneficiaryID, p.Method, p.ExternalRef), ip)
+		return
+	}
+	s.logEvent(ctx, "error", "payout_failed",
+		fmt.Sprintf("payout %s of %d units to beneficiary %s failed: %s", p.ID, p.Units, p.BeneficiaryID, detail), ip)
+}
+
+// PayoutWebhook applies the status changes a provider reports for its
+// transfers. Payouts that completed or failed keep their outcome.
+func (s *Server) PayoutWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	method := mux.Vars(r)["method"]
+
+	a := s.payouts[method]
+	if s.DB == nil || a == nil {
+		httpError(w, r, "payout webhook not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !a.VerifyWebhook(r.Header, body) {
+		s.logEvent(ctx, "warn", "payout_webhook_bad_signature", method+": signature mismatch", r.RemoteAddr)
+		httpError(w, r, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	updates, err := a.ParseWebhook(body)
+	if err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	updated := 0
+	for _, u := range updates {
+		var p *models.Payout
+		if u.Reference != "" {
+			p, err = s.DB.GetPayout(ctx, u.Reference)
+		} else {
+			p, err = s.DB.FindPayout(ctx, method, u.ExternalRef)
+		}
+		if err != nil {
+			// the provider delivers the webhook again
+			httpError(w, r, "failed to update payout", http.StatusInternalServerError)
+			s.logEvent(ctx, "error", "payout_get_failed", err.Error(), r.RemoteAddr)
+			return
+		}
+		if p == nil || p.Method != method {
+			s.logEvent(ctx, "warn", "payout_webhook_unknown",
+				fmt.Sprintf("%s transfer %s (reference %q) matches no payout", method, u.ExternalRef, u.Reference), r.RemoteAddr)
+			continue
+		}
+		if p.Status == models.PayoutCompleted || p.Status == models.PayoutFailed {
+			continue
+		}
+		if p.ExternalRef == "" {
+			p.ExternalRef = u.ExternalRef
+		}
+		changed := u.ProviderStatus != p.ProviderStatus
+		p.ProviderStatus = u.ProviderStatus
+		switch u.Status {
+		case payout.StatusCompleted:
+			s.finishPayout(ctx, p, models.PayoutCompleted, "", r.RemoteAddr)
+		case payout.StatusFailed:
+			s.finishPayout(ctx, p, models.PayoutFailed, u.Detail, r.RemoteAddr)
+		default:
+			// a bank transfer reports its way to settlement, e.g.
+			// processing and sent
+			if p.Status == models.PayoutSubmitted && !changed {
+				continue
+			}
+			p.Status, p.Error, p.UpdatedAt = models.PayoutSubmitted, "", s.Clock.Now().UTC()
+			if err := s.DB.UpdatePayout(ctx, p); err != nil {
+				httpError(w, r, "failed to update payout", http.StatusInternalServerError)
+				s.logEvent(ctx, "error", "payout_save_failed", fmt.Sprintf("payout %s: %v", p.ID, err), r.RemoteAddr)
+				return
+			}
+		}
+		updated++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int{"received": len(updates), "updated": updated})
+}
+
+// ListPayouts returns the tenant's external payouts, oldest first,
+// optionally only those with ?status=, at most ?limit= (default 100).
+func (s *Server) ListPayouts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	q := r.URL.Query()
+	status := q.Get("status")
+	switch status {
+	case "", models.PayoutPending, models.PayoutSubmitted, models.PayoutCompleted, models.PayoutFailed:
+	default:
+		httpError(w, r, "invalid status", http.StatusBadRequest)
+		return
+	}
+	limit := defaultPayoutListLimit
+	if l := q.Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 {
+			httpError(w, r, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	list, err := s.DB.ListPayouts(ctx, tenantID(ctx), status, limit)
+	if err != nil {
+		httpError(w, r, "failed to load payouts", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "payout_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if list == nil {
+		list = []models.Payout{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(payoutsResponse{Payouts: list})
+}
+
+// RetryPayout queues a failed payout again as a new payout, with a new
+// reference, to the beneficiary's current account for the payout's
+// method.
+func (s *Server) RetryPayout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	p, err := s.DB.GetPayout(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, "failed to load payouts", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "payout_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if p == nil || (tenantID(ctx) != "" && p.TenantID != tenantID(ctx)) {
+		httpError(w, r, "payout not found", http.StatusNotFound)
+		return
+	}
+	if p.Status != models.PayoutFailed {
+		httpError(w, r, "only failed payouts can be retried", http.StatusConflict)
+		return
+	}
+	if p.RetryID != "" {
+		httpError(w, r, "payout already retried", http.StatusConflict)
+		return
+	}
+
+	b, err := s.DB.GetBeneficiary(ctx, p.BeneficiaryID)
+	if err != nil {
+		httpError(w, r, "failed to load beneficiary", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "beneficiary_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if b == nil || payoutAccount(b, p.Method) == "" || beneficiaryStatus(b) != beneficiaryApproved {
+		httpError(w, r, "beneficiary has no approved payout account", http.StatusConflict)
+		return
+	}
+
+	now := s.Clock.Now().UTC()
+	retry := newPayout(b, p.Method, p.TenantID, p.DisbursementID, p.Units, now)
+	retry.Burned = p.Burned
+	if err := s.DB.CreatePayouts(ctx, []models.Payout{retry}); err != nil {
+		httpError(w, r, "failed to retry payout", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "payout_save_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	p.RetryID, p.UpdatedAt = retry.ID, now
+	if err := s.DB.UpdatePayout(ctx, p); err != nil {
+		s.logEvent(ctx, "error", "payout_save_failed", fmt.Sprintf("payout %s: %v", p.ID, err), r.RemoteAddr)
+	}
+
+	s.logEvent(ctx, "info", "payout_retried",
+		fmt.Sprintf("payout %s retried as %s by %s", p.ID, retry.ID, adminName(ctx)), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(retry)
+}
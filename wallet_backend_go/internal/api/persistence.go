@@ -0,0 +1,207 @@
+package api
+
+// persistence.go tracks whether the Supabase rows of mined transactions
+// were written. Most handlers answer as soon as a block is mined and
+// write the block and transaction rows afterwards, so a "mined"
+// response says nothing about the off-chain records. Each transaction
+// is pending until its rows are written, then persisted or failed.
+// Clients poll GET /transactions/{txid}/status and operators list the
+// failures at GET /admin/persistence/failures; a rebuild restores the
+// missing rows. The records live in memory and are lost on restart.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+const (
+	persistPending   = "pending"
+	persistPersisted = "persisted"
+	persistFailed    = "failed"
+)
+
+// maxTrackedPersistence bounds the records kept; the oldest go first.
+const maxTrackedPersistence = 10000
+
+// persistenceRecord is the persistence status of one transaction.
+type persistenceRecord struct {
+	TxID      string    `json:"txid"`
+	BlockHash string    `json:"block_hash"`
+	Type      string    `json:"type"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// persistenceTracker keeps the persistence status of recently mined
+// transactions.
+type persistenceTracker struct {
+	mu      sync.Mutex
+	records map[string]*persistenceRecord
+	order   []string // txids, oldest first
+
+	// writing counts the blocks being written, for shutdown to wait on.
+	writing sync.WaitGroup
+}
+
+// start marks txs of block b as pending. Every start is followed by
+// one finish.
+func (p *persistenceTracker) start(b *blockchain.Block, txs []*blockchain.Transaction, txType string, now time.Time) {
+	p.writing.Add(1)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.records == nil {
+		p.records = make(map[string]*persistenceRecord)
+	}
+	now = now.UTC()
+	for _, tx := range txs {
+		txid := fmt.Sprintf("%x", tx.ID)
+		if _, ok := p.records[txid]; !ok {
+			p.order = append(p.order, txid)
+		}
+		p.records[txid] = &persistenceRecord{
+			TxID:      txid,
+			BlockHash: fmt.Sprintf("%x", b.Hash),
+			Type:      txType,
+			Status:    persistPending,
+			UpdatedAt: now,
+		}
+	}
+	for len(p.order) > maxTrackedPersistence {
+		delete(p.records, p.order[0])
+		p.order = p.order[1:]
+	}
+}
+
+// finish marks txs as persisted, or failed with err when it is non-nil.
+func (p *persistenceTracker) finish(txs []*blockchain.Transaction, err error, now time.Time) {
+	defer p.writing.Done()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now = now.UTC()
+	for _, tx := range txs {
+		rec, ok := p.records[fmt.Sprintf("%x", tx.ID)]
+		if !ok {
+			continue
+		}
+		rec.Status, rec.Error, rec.UpdatedAt = persistPersisted, "", now
+		if err != nil {
+			rec.Status, rec.Error = persistFailed, err.Error()
+		}
+	}
+}
+
+// resolveFailed marks every failed record as persisted, after a rebuild
+// restored the missing rows.
+func (p *persistenceTracker) resolveFailed(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now = now.UTC()
+	for _, rec := range p.records {
+		if rec.Status == persistFailed {
+			rec.Status, rec.Error, rec.UpdatedAt = persistPersisted, "", now
+		}
+	}
+}
+
+// get returns a copy of the record of txid.
+func (p *persistenceTracker) get(txid string) (persistenceRecord, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rec, ok := p.records[txid]
+	if !ok {
+		return persistenceRecord{}, false
+	}
+	return *rec, true
+}
+
+// failed returns the failed records, most recent first.
+func (p *persistenceTracker) failed() []persistenceRecord {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := []persistenceRecord{}
+	for _, rec := range p.records {
+		if rec.Status == persistFailed {
+			out = append(out, *rec)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UpdatedAt.After(out[j].UpdatedAt) })
+	return out
+}
+
+type txStatusResponse struct {
+	TxID          string `json:"txid"`
+	Mined         bool   `json:"mined"`
+	BlockHash     string `json:"block_hash,omitempty"`
+	BlockHeight   *int   `json:"block_height,omitempty"`
+	Confirmations int    `json:"confirmations"`
+	// Persistence is pending, persisted or failed, or unknown when this
+	// instance did not mine the transaction or no longer remembers it.
+	Persistence      string `json:"persistence"`
+	PersistenceError string `json:"persistence_error,omitempty"`
+	// Mempool is pending, mining or dropped while the transaction is, or
+	// was, queued for the background miner (MINING_MODE=mempool).
+	Mempool       string `json:"mempool,omitempty"`
+	MempoolReason string `json:"mempool_reason,omitempty"`
+}
+
+// GetTransactionStatus reports whether a transaction is mined and
+// whether its Supabase rows were written.
+func (s *Server) GetTransactionStatus(w http.ResponseWriter, r *http.Request) {
+	txid := mux.Vars(r)["txid"]
+
+	resp := txStatusResponse{TxID: txid, Persistence: "unknown"}
+	s.chainMu.Lock()
+	for h, b := range s.BC.Blocks {
+		for _, tx := range b.Transactions {
+			if fmt.Sprintf("%x", tx.ID) == txid {
+				height := h
+				resp.Mined = true
+				resp.BlockHash = fmt.Sprintf("%x", b.Hash)
+				resp.BlockHeight = &height
+				resp.Confirmations = len(s.BC.Blocks) - h
+			}
+		}
+	}
+	s.chainMu.Unlock()
+
+	rec, tracked := s.persistence.get(txid)
+	queued := false
+	if s.mempool != nil && !resp.Mined {
+		var e blockchain.MempoolEntry
+		if e, queued = s.mempool.Get(txid); queued {
+			resp.Mempool, resp.MempoolReason = e.Status, e.Reason
+		}
+	}
+	if !resp.Mined && !tracked && !queued {
+		httpError(w, r, "transaction not found", http.StatusNotFound)
+		return
+	}
+	if tracked {
+		resp.Persistence = rec.Status
+		resp.PersistenceError = rec.Error
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// ListPersistenceFailures lists the transactions whose Supabase rows
+// could not be written.
+func (s *Server) ListPersistenceFailures(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string][]persistenceRecord{"failures": s.persistence.failed()})
+}
@@ -0,0 +1,381 @@
+package api
+
+// pin.go adds an optional per-user transaction PIN. Once a user sets
+// one, sends from any of their wallets must carry it, independently of
+// how they logged in. PINs are stored as Argon2id hashes in
+// transaction_pins; wrong PINs are counted there, and after
+// PIN_MAX_ATTEMPTS (default 5) the PIN is locked for
+// PIN_LOCKOUT_MINUTES (default 15). A forgotten or locked PIN is reset
+// with an OTP sent through /auth/request-otp.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"wallet_backend_go/internal/argon2"
+	"wallet_backend_go/internal/models"
+)
+
+const (
+	defaultPINMaxAttempts = 5
+	defaultPINLockout     = 15 // minutes
+
+	minPINLength = 4
+	maxPINLength = 8
+)
+
+// pinMaxAttempts is the number of consecutive wrong PINs that lock the
+// PIN (PIN_MAX_ATTEMPTS).
+func pinMaxAttempts() int {
+	return envLimit("PIN_MAX_ATTEMPTS", defaultPINMaxAttempts)
+}
+
+// pinLockout is how long a PIN stays locked (PIN_LOCKOUT_MINUTES).
+func pinLockout() time.Duration {
+	return time.Duration(envLimit("PIN_LOCKOUT_MINUTES", defaultPINLockout)) * time.Minute
+}
+
+// validPIN reports whether pin is 4 to 8 digits.
+func validPIN(pin string) bool {
+	if len(pin) < minPINLength || len(pin) > maxPINLength {
+		return false
+	}
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+type setPINRequest struct {
+	PIN        string `json:"pin"`
+	CurrentPIN string `json:"current_pin"` // required to change an existing PIN
+}
+
+type deletePINRequest struct {
+	CurrentPIN string `json:"current_pin"`
+}
+
+type resetPINRequest struct {
+	OTP string `json:"otp"`
+	PIN string `json:"pin"`
+}
+
+type pinStatusResponse struct {
+	Enabled        bool       `json:"enabled"`
+	FailedAttempts int        `json:"failed_attempts"`
+	LockedUntil    *time.Time `json:"locked_until,omitempty"`
+}
+
+func pinStatus(p *models.TransactionPIN, now time.Time) pinStatusResponse {
+	if p == nil {
+		return pinStatusResponse{}
+	}
+	resp := pinStatusResponse{Enabled: true, FailedAttempts: p.FailedAttempts}
+	if p.LockedUntil != nil && now.Before(*p.LockedUntil) {
+		resp.LockedUntil = p.LockedUntil
+	}
+	return resp
+}
+
+// checkPIN verifies pin against the stored PIN, counting wrong PINs and
+// locking the PIN after pinMaxAttempts. Checks of one user's PIN take
+// turns under the PIN lock and count from the stored row, so that
+// concurrent wrong PINs cannot overwrite each other's count. On failure
+// it writes the error response and returns false.
+func (s *Server) checkPIN(w http.ResponseWriter, r *http.Request, stored *models.TransactionPIN, pin string) bool {
+	ctx := r.Context()
+
+	held := s.lockPIN(w, r, stored.UserID)
+	if held == nil {
+		return false
+	}
+	defer held.Release()
+	stored, err := s.DB.GetTransactionPIN(ctx, stored.UserID)
+	if err != nil {
+		httpError(w, r, "failed to check transaction pin", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "pin_get_failed", err.Error(), r.RemoteAddr)
+		return false
+	}
+	if stored == nil {
+		// removed while waiting for the lock
+		return true
+	}
+	now := s.Clock.Now()
+
+	if stored.LockedUntil != nil && now.Before(*stored.LockedUntil) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(stored.LockedUntil.Sub(now).Seconds())+1))
+		httpError(w, r, "transaction pin locked, try again later", http.StatusLocked)
+		return false
+	}
+	if pin == "" {
+		httpError(w, r, "transaction pin required", http.StatusForbidden)
+		return false
+	}
+
+	ok, err := argon2.Verify(stored.Hash, []byte(pin))
+	if err != nil {
+		httpError(w, r, "failed to check transaction pin", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "pin_hash_invalid",
+			fmt.Sprintf("user %s: %v", stored.UserID, err), r.RemoteAddr)
+		return false
+	}
+	if ok {
+		if stored.FailedAttempts > 0 || stored.LockedUntil != nil {
+			if err := s.DB.UpdateTransactionPINAttempts(ctx, stored.UserID, 0, nil); err != nil {
+				s.logEvent(ctx, "error", "pin_attempts_update_failed", err.Error(), r.RemoteAddr)
+			}
+		}
+		return true
+	}
+
+	attempts := stored.FailedAttempts + 1
+	var lockedUntil *time.Time
+	if attempts >= pinMaxAttempts() {
+		until := now.Add(pinLockout()).UTC()
+		lockedUntil = &until
+		attempts = 0
+	}
+	if err := s.DB.UpdateTransactionPINAttempts(ctx, stored.UserID, attempts, lockedUntil); err != nil {
+		// without the counter the PIN could be guessed freely
+		httpError(w, r, "failed to check transaction pin", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "pin_attempts_update_failed", err.Error(), r.RemoteAddr)
+		return false
+	}
+
+	if lockedUntil != nil {
+		s.logEvent(ctx, "warn", "pin_locked",
+			fmt.Sprintf("transaction pin of user %s locked until %s", stored.UserID, lockedUntil.Format(time.RFC3339)),
+			r.RemoteAddr)
+		w.Header().Set("Retry-After", strconv.Itoa(int(pinLockout().Seconds())))
+		httpError(w, r, "transaction pin locked, try again later", http.StatusLocked)
+		return false
+	}
+	s.logEvent(ctx, "warn", "pin_invalid",
+		fmt.Sprintf("wrong transaction pin for user %s (%d/%d)", stored.UserID, attempts, pinMaxAttempts()),
+		r.RemoteAddr)
+	httpError(w, r, "invalid transaction pin", http.StatusForbidden)
+	return false
+}
+
+// requireTransactionPIN checks pin for a spend from address when the
+// wallet's owner has set a transaction PIN. Wallets without an owner
+// or PIN, and servers without a database, need none. On failure it
+// writes the error response and returns false.
+func (s *Server) requireTransactionPIN(w http.ResponseWriter, r *http.Request, address, pin string) bool {
+	if s.DB == nil {
+		return true
+	}
+	ctx := r.Context()
+
+	profile, err := s.DB.GetWalletProfileByAddress(ctx, address)
+	if err != nil {
+		httpError(w, r, "failed to check transaction pin", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "wallet_profile_get_failed", err.Error(), r.RemoteAddr)
+		return false
+	}
+	if profile == nil || profile.UserID == "" {
+		return true
+	}
+	stored, err := s.DB.GetTransactionPIN(ctx, profile.UserID)
+	if err != nil {
+		httpError(w, r, "failed to check transaction pin", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "pin_get_failed", err.Error(), r.RemoteAddr)
+		return false
+	}
+	if stored == nil {
+		return true
+	}
+	return s.checkPIN(w, r, stored, pin)
+}
+
+// savePIN hashes pin and stores it as the user's PIN, clearing any
+// failed attempts and lockout.
+func (s *Server) savePIN(w http.ResponseWriter, r *http.Request, session *sessionClaims, pin string) (*models.TransactionPIN, bool) {
+	ctx := r.Context()
+
+	hash, err := argon2.Hash(s.Entropy, []byte(pin), argon2.DefaultParams)
+	if err != nil {
+		httpError(w, r, "failed to save transaction pin", http.StatusInternalServerError)
+		return nil, false
+	}
+	record := &models.TransactionPIN{
+		UserID:    session.Subject,
+		TenantID:  session.TenantID,
+		Hash:      hash,
+		UpdatedAt: s.Clock.Now().UTC(),
+	}
+	if err := s.DB.SaveTransactionPIN(ctx, record); err != nil {
+		httpError(w, r, "failed to save transaction pin", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "pin_save_failed", err.Error(), r.RemoteAddr)
+		return nil, false
+	}
+	return record, true
+}
+
+// loadPIN returns the signed-in user's PIN, or nil if there is none.
+func (s *Server) loadPIN(w http.ResponseWriter, r *http.Request) (*models.TransactionPIN, bool) {
+	ctx := r.Context()
+
+	stored, err := s.DB.GetTransactionPIN(ctx, sessionFrom(ctx).Subject)
+	if err != nil {
+		httpError(w, r, "failed to load transaction pin", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "pin_get_failed", err.Error(), r.RemoteAddr)
+		return nil, false
+	}
+	return stored, true
+}
+
+// GetPINStatus reports whether the signed-in user has a transaction PIN
+// and whether it is locked.
+func (s *Server) GetPINStatus(w http.ResponseWriter, r *http.Request) {
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	stored, ok := s.loadPIN(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(pinStatus(stored, s.Clock.Now()))
+}
+
+// SetPIN sets the signed-in user's transaction PIN, or changes it when
+// the current PIN is given.
+func (s *Server) SetPIN(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session := sessionFrom(ctx)
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req setPINRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !validPIN(req.PIN) {
+		httpError(w, r, "pin must be 4 to 8 digits", http.StatusBadRequest)
+		return
+	}
+
+	stored, ok := s.loadPIN(w, r)
+	if !ok {
+		return
+	}
+	if stored != nil && !s.checkPIN(w, r, stored, req.CurrentPIN) {
+		return
+	}
+
+	record, ok := s.savePIN(w, r, session, req.PIN)
+	if !ok {
+		return
+	}
+	event, verb := "pin_set", "set"
+	if stored != nil {
+		event, verb = "pin_changed", "changed"
+	}
+	s.logEvent(ctx, "info", event,
+		fmt.Sprintf("transaction pin %s for user %s", verb, session.Subject), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(pinStatus(record, s.Clock.Now()))
+}
+
+// DeletePIN removes the signed-in user's transaction PIN after checking
+// it.
+func (s *Server) DeletePIN(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session := sessionFrom(ctx)
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req deletePINRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	stored, ok := s.loadPIN(w, r)
+	if !ok {
+		return
+	}
+	if stored == nil {
+		httpError(w, r, "no transaction pin set", http.StatusNotFound)
+		return
+	}
+	if !s.checkPIN(w, r, stored, req.CurrentPIN) {
+		return
+	}
+
+	if err := s.DB.DeleteTransactionPIN(ctx, session.Subject); err != nil {
+		httpError(w, r, "failed to remove transaction pin", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "pin_delete_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	s.logEvent(ctx, "info", "pin_removed",
+		fmt.Sprintf("transaction pin removed for user %s", session.Subject), r.RemoteAddr)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResetPIN replaces a forgotten or locked transaction PIN. The user
+// first requests an OTP for their email through /auth/request-otp.
+func (s *Server) ResetPIN(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session := sessionFrom(ctx)
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req resetPINRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.OTP == "" {
+		httpError(w, r, "otp is required", http.StatusBadRequest)
+		return
+	}
+	if !validPIN(req.PIN) {
+		httpError(w, r, "pin must be 4 to 8 digits", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.DB.GetUser(ctx, session.Subject)
+	if err != nil || user == nil {
+		httpError(w, r, "failed to load user", http.StatusInternalServerError)
+		if err != nil {
+			s.logEvent(ctx, "error", "user_get_failed", err.Error(), r.RemoteAddr)
+		}
+		return
+	}
+	if !s.consumeOTP(user.Email, req.OTP) {
+		s.logEvent(ctx, "warn", "otp_invalid",
+			fmt.Sprintf("invalid otp for pin reset of user %s", user.ID), r.RemoteAddr)
+		httpError(w, r, "invalid or expired otp", http.StatusUnauthorized)
+		return
+	}
+
+	record, ok := s.savePIN(w, r, session, req.PIN)
+	if !ok {
+		return
+	}
+	s.logEvent(ctx, "info", "pin_reset",
+		fmt.Sprintf("transaction pin reset by otp for user %s", user.ID), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(pinStatus(record, s.Clock.Now()))
+}
@@ -0,0 +1,107 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"wallet_backend_go/internal/argon2"
+	"wallet_backend_go/internal/db"
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/testutil"
+)
+
+// pinStore holds one user's wallet and transaction PIN. Reads of the PIN
+// are slow, so that checks racing each other read the same count.
+type pinStore struct {
+	db.Store
+
+	address string
+
+	mu  sync.Mutex
+	pin models.TransactionPIN
+}
+
+func (s *pinStore) LogSystemEvent(ctx context.Context, level, typ, message, ip string) {}
+
+func (s *pinStore) CreateAPIAudit(ctx context.Context, a *models.APIAudit) error { return nil }
+
+func (s *pinStore) ListHeldTransfers(ctx context.Context, status string) ([]models.HeldTransfer, error) {
+	return nil, nil
+}
+
+func (s *pinStore) GetWalletProfileByAddress(ctx context.Context, address string) (*models.WalletProfile, error) {
+	if address != s.address {
+		return nil, nil
+	}
+	return &models.WalletProfile{WalletAddress: address, UserID: s.pin.UserID}, nil
+}
+
+func (s *pinStore) GetTransactionPIN(ctx context.Context, userID string) (*models.TransactionPIN, error) {
+	s.mu.Lock()
+	pin := s.pin
+	s.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	return &pin, nil
+}
+
+func (s *pinStore) UpdateTransactionPINAttempts(ctx context.Context, userID string, failedAttempts int, lockedUntil *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pin.FailedAttempts = failedAttempts
+	s.pin.LockedUntil = lockedUntil
+	return nil
+}
+
+// TestConcurrentWrongPINsLock checks that wrong PINs sent at once are
+// all counted: as many as PIN_MAX_ATTEMPTS lock the PIN.
+func TestConcurrentWrongPINsLock(t *testing.T) {
+	const attempts = 5
+	t.Setenv("PIN_MAX_ATTEMPTS", "5")
+	c := testutil.NewChain(t)
+	alice, bob := testutil.Wallet("alice"), testutil.Wallet("bob")
+	c.Fund(t, alice)
+
+	hash, err := argon2.Hash(bytes.NewReader(bytes.Repeat([]byte{1}, 16)), []byte("1234"),
+		argon2.Params{Time: 1, Memory: 64, Threads: 1, SaltLen: 16, KeyLen: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &pinStore{address: alice.GetAddress(), pin: models.TransactionPIN{UserID: "alice", Hash: hash}}
+	h := testutil.NewServerWithStore(t, c, store).Router()
+
+	codes := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := testutil.Do(t, h, "POST", "/transactions", map[string]interface{}{
+				"from":    alice.GetAddress(),
+				"to":      bob.GetAddress(),
+				"amount":  100,
+				"privKey": testutil.PrivateKeyHex(alice),
+				"pin":     "9999",
+			})
+			codes <- rec.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := make(map[int]int)
+	for code := range codes {
+		counts[code]++
+	}
+	if counts[http.StatusForbidden] != attempts-1 || counts[http.StatusLocked] != 1 {
+		t.Errorf("responses = %v, want %d wrong PINs and one lock", counts, attempts-1)
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.pin.LockedUntil == nil {
+		t.Errorf("pin not locked after %d concurrent wrong PINs (%d attempts counted)", attempts, store.pin.FailedAttempts)
+	}
+}
@@ -0,0 +1,368 @@
+package api
+
+// pledges.go lets donors commit to a campaign now and pay later. A
+// pledge names the campaign, the amount, the due date and one of the
+// pledger's registered wallets. A scheduler reminds the pledger
+// pledgeReminderLead before the due date and, from the due date on,
+// pays the pledge from the wallet with the wallet's stored key. While
+// the wallet lacks the funds it retries every pledgeRetryInterval, up
+// to pledgeMaxAttempts times, then marks the pledge failed. Outstanding
+// pledges are shown on the donation portal apart from what campaigns
+// have received.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/i18n"
+	"wallet_backend_go/internal/models"
+)
+
+const (
+	// pledgeTick is how often the scheduler looks for due pledges.
+	pledgeTick = 5 * time.Minute
+
+	pledgeReminderLead  = 72 * time.Hour
+	pledgeRetryInterval = 24 * time.Hour
+	pledgeMaxAttempts   = 3
+)
+
+type createPledgeRequest struct {
+	CampaignID    string    `json:"campaign_id"`
+	WalletAddress string    `json:"wallet_address"`
+	Amount        int       `json:"amount"`
+	DueDate       time.Time `json:"due_date"`
+	PIN           string    `json:"pin"`
+}
+
+type pledgeListResponse struct {
+	Pledges []models.Pledge `json:"pledges"`
+}
+
+// pledgedByCampaign sums the pending pledges of every campaign.
+func (s *Server) pledgedByCampaign(ctx context.Context) (map[string]int, error) {
+	pending, err := s.DB.ListPledgesByStatus(ctx, models.PledgePending)
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[string]int)
+	for _, p := range pending {
+		sums[p.CampaignID] += p.Amount
+	}
+	return sums, nil
+}
+
+// CreatePledge records the session user's pledge to an open campaign.
+// The wallet's transaction PIN, if set, authorizes the later payment.
+func (s *Server) CreatePledge(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	var req createPledgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Amount <= 0 {
+		httpError(w, r, "amount must be positive", http.StatusBadRequest)
+		return
+	}
+	now := s.Clock.Now().UTC()
+	if !req.DueDate.After(now) {
+		httpError(w, r, "due_date must be in the future", http.StatusBadRequest)
+		return
+	}
+	if !s.requireWalletOwner(w, r, req.WalletAddress) {
+		return
+	}
+	cp, err := s.DB.GetCampaign(ctx, req.CampaignID)
+	if err != nil {
+		httpError(w, r, "failed to load campaigns", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "campaign_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if cp == nil || !campaignOpen(cp, now) {
+		httpError(w, r, "campaign not found", http.StatusNotFound)
+		return
+	}
+	if cp.EndsAt != nil && req.DueDate.After(*cp.EndsAt) {
+		httpError(w, r, "due_date is after the campaign ends", http.StatusBadRequest)
+		return
+	}
+	if !s.requireTransactionPIN(w, r, req.WalletAddress, req.PIN) {
+		return
+	}
+
+	p := &models.Pledge{
+		ID:            uuid.NewString(),
+		TenantID:      cp.TenantID,
+		CampaignID:    cp.ID,
+		UserID:        sessionFrom(ctx).Subject,
+		WalletAddress: req.WalletAddress,
+		Amount:        req.Amount,
+		DueDate:       req.DueDate.UTC(),
+		Status:        models.PledgePending,
+		CreatedAt:     now,
+	}
+	if err := s.DB.CreatePledge(ctx, p); err != nil {
+		httpError(w, r, "failed to create pledge", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "pledge_create_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	s.logEvent(ctx, "info", "pledge_created",
+		fmt.Sprintf("pledge %s of %d to campaign %s from %s due %s", p.ID, p.Amount, cp.ID, p.WalletAddress, p.DueDate.Format(time.RFC3339)), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// ListPledges returns the session user's pledges.
+func (s *Server) ListPledges(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	pledges, err := s.DB.ListPledgesByUser(ctx, sessionFrom(ctx).Subject)
+	if err != nil {
+		httpError(w, r, "failed to load pledges", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "pledge_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if pledges == nil {
+		pledges = []models.Pledge{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(pledgeListResponse{Pledges: pledges})
+}
+
+// ownPledge loads the pledge of the request's {id} when it belongs to
+// the session user. On failure it writes the error response and returns
+// nil.
+func (s *Server) ownPledge(w http.ResponseWriter, r *http.Request) *models.Pledge {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return nil
+	}
+	p, err := s.DB.GetPledge(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, "failed to load pledges", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "pledge_get_failed", err.Error(), r.RemoteAddr)
+		return nil
+	}
+	if p == nil || p.UserID != sessionFrom(ctx).Subject {
+		httpError(w, r, "pledge not found", http.StatusNotFound)
+		return nil
+	}
+	return p
+}
+
+// GetPledge returns one of the session user's pledges.
+func (s *Server) GetPledge(w http.ResponseWriter, r *http.Request) {
+	p := s.ownPledge(w, r)
+	if p == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// CancelPledge withdraws a pending pledge.
+func (s *Server) CancelPledge(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// not while the scheduler may be paying it
+	s.pledgeMu.Lock()
+	defer s.pledgeMu.Unlock()
+
+	p := s.ownPledge(w, r)
+	if p == nil {
+		return
+	}
+	if p.Status != models.PledgePending {
+		httpError(w, r, "pledge is not pending", http.StatusConflict)
+		return
+	}
+	p.Status = models.PledgeCancelled
+	ok, err := s.DB.UpdatePledge(ctx, p, models.PledgePending)
+	if err != nil {
+		httpError(w, r, "failed to update pledge", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "pledge_update_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if !ok {
+		httpError(w, r, "pledge is not pending", http.StatusConflict)
+		return
+	}
+	s.logEvent(ctx, "info", "pledge_cancelled", "pledge "+p.ID+" cancelled", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// runPledges reminds pledgers and pays due pledges every pledgeTick.
+func (s *Server) runPledges() {
+	ticker := time.NewTicker(pledgeTick)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.runScheduled("pledges", s.processPledges)
+	}
+}
+
+// processPledges sends the reminders that are due and attempts the
+// payment of every due pledge not attempted within pledgeRetryInterval.
+func (s *Server) processPledges() {
+	if s.DB == nil {
+		return
+	}
+	s.pledgeMu.Lock()
+	defer s.pledgeMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	pending, err := s.DB.ListPledgesByStatus(ctx, models.PledgePending)
+	if err != nil {
+		log.Printf("failed to load pledges: %v", err)
+		return
+	}
+	now := s.Clock.Now().UTC()
+	for i := range pending {
+		p := &pending[i]
+		switch {
+		case p.DueDate.After(now):
+			if p.RemindedAt == nil && p.DueDate.Sub(now) <= pledgeReminderLead {
+				s.remindPledge(ctx, p, now)
+			}
+		case p.LastAttemptAt == nil || now.Sub(*p.LastAttemptAt) >= pledgeRetryInterval:
+			s.fulfillPledge(ctx, p, now)
+		}
+	}
+}
+
+// notifyPledger sends text to the pledger on the reminders channels.
+func (s *Server) notifyPledger(ctx context.Context, p *models.Pledge, text string) {
+	u, err := s.DB.GetUser(ctx, p.UserID)
+	if err != nil {
+		s.logEvent(ctx, "error", "notification_user_lookup_failed", err.Error(), "scheduler")
+		return
+	}
+	s.notifyUser(ctx, u, models.NotifyEventReminders, text)
+}
+
+func (s *Server) remindPledge(ctx context.Context, p *models.Pledge, now time.Time) {
+	s.notifyPledger(ctx, p, i18n.Tf(i18n.Default, "Your pledge of %s will be paid from wallet %s on %s",
+		fmt.Sprint(p.Amount), p.WalletAddress, p.DueDate.Format("2006-01-02")))
+	p.RemindedAt = &now
+	if _, err := s.DB.UpdatePledge(ctx, p, models.PledgePending); err != nil {
+		s.logEvent(ctx, "error", "pledge_update_failed", err.Error(), "scheduler")
+	}
+}
+
+// fulfillPledge pays p from the pledger's wallet to the campaign. A
+// closed campaign or an unusable wallet fails the pledge at once; a
+// shortfall or a rejected transaction counts as one failed attempt.
+func (s *Server) fulfillPledge(ctx context.Context, p *models.Pledge, now time.Time) {
+	txid, blockHash, to, permanent, err := s.payPledge(ctx, p, now)
+
+	p.Attempts++
+	p.LastAttemptAt = &now
+	if err == nil {
+		p.Status, p.LastError, p.TxID, p.BlockHash, p.FulfilledAt = models.PledgeFulfilled, "", txid, blockHash, &now
+	} else {
+		p.LastError = err.Error()
+		if permanent || p.Attempts >= pledgeMaxAttempts {
+			p.Status = models.PledgeFailed
+		}
+	}
+	if _, uerr := s.DB.UpdatePledge(ctx, p, models.PledgePending); uerr != nil {
+		s.logEvent(ctx, "error", "pledge_update_failed", uerr.Error(), "scheduler")
+	}
+
+	switch {
+	case err == nil:
+		s.logEvent(ctx, "info", "pledge_fulfilled",
+			fmt.Sprintf("pledge %s paid %d from %s in block %s", p.ID, p.Amount, p.WalletAddress, blockHash), "scheduler")
+		s.notifyPledger(ctx, p, i18n.Tf(i18n.Default, "Your pledge of %s was paid from wallet %s", fmt.Sprint(p.Amount), p.WalletAddress))
+		s.notifyIncomingFunds(to, p.Amount)
+	case p.Status == models.PledgeFailed:
+		s.logEvent(ctx, "warn", "pledge_failed",
+			fmt.Sprintf("pledge %s failed after %d attempts: %v", p.ID, p.Attempts, err), "scheduler")
+		s.notifyPledger(ctx, p, i18n.Tf(i18n.Default, "Your pledge of %s could not be paid from wallet %s", fmt.Sprint(p.Amount), p.WalletAddress))
+	default:
+		s.logEvent(ctx, "warn", "pledge_attempt_failed",
+			fmt.Sprintf("pledge %s attempt %d: %v", p.ID, p.Attempts, err), "scheduler")
+	}
+}
+
+// payPledge mines the payment of p and returns its txid, block hash
+// and recipient. permanent reports errors retrying cannot fix.
+func (s *Server) payPledge(ctx context.Context, p *models.Pledge, now time.Time) (txid, blockHash, to string, permanent bool, err error) {
+	cp, err := s.DB.GetCampaign(ctx, p.CampaignID)
+	if err != nil {
+		return "", "", "", false, err
+	}
+	if cp == nil || !campaignOpen(cp, now) {
+		return "", "", "", true, fmt.Errorf("campaign is closed")
+	}
+	wp, err := s.DB.GetWalletProfileByAddress(ctx, p.WalletAddress)
+	if err != nil {
+		return "", "", "", false, err
+	}
+	if wp == nil || wp.Status == models.WalletStatusDeactivated {
+		return "", "", "", true, fmt.Errorf("wallet is not active")
+	}
+	key, err := s.walletPrivateKey(wp)
+	if err != nil {
+		return "", "", "", true, fmt.Errorf("wallet key unreadable")
+	}
+	fromHash, err := blockchain.DecodeAddress(p.WalletAddress)
+	if err != nil {
+		return "", "", "", true, err
+	}
+
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+
+	acc, spendable := s.UTXO.FindSpendableOutputsExcluding(fromHash, p.Amount, s.reservedOutputs())
+	if acc < p.Amount {
+		return "", "", "", false, fmt.Errorf("insufficient funds")
+	}
+	tx, err := blockchain.NewUTXOTransaction(*key, cp.WalletAddress, p.Amount, s.BC, spendable, fromHash, acc)
+	if err != nil {
+		return "", "", "", false, err
+	}
+	if !s.BC.VerifyTransaction(tx) {
+		return "", "", "", false, fmt.Errorf("transaction verification failed")
+	}
+	if err := s.BC.CheckPolicy(ctx, tx); err != nil {
+		return "", "", "", false, err
+	}
+	newBlock, err := s.BC.AddBlockContext(ctx, []*blockchain.Transaction{tx})
+	if err != nil {
+		return "", "", "", false, err
+	}
+	height := len(s.BC.Blocks) - 1
+	s.reports.invalidateBlock(newBlock)
+	_ = s.UTXO.Reindex()
+	s.persistMinedBlock(newBlock, height, []*blockchain.Transaction{tx}, "pledge")
+
+	return fmt.Sprintf("%x", tx.ID), fmt.Sprintf("%x", newBlock.Hash), cp.WalletAddress, false, nil
+}
@@ -0,0 +1,113 @@
+package api
+
+// policy.go registers this deployment's transaction policy checks on
+// the blockchain's validator chain. They run, in order, on every user
+// transaction (POST /transactions and the offline batch) before it is
+// mined; zakat deductions and coinbase transactions are minted by the
+// server and bypass them.
+//
+//	freeze    senders whose wallet profile is deactivated cannot send
+//	limit     TX_MAX_AMOUNT caps the amount sent to others per transaction
+//	aml       AML_BLOCKED_ADDRESSES lists addresses that may neither send nor receive
+//	external  the policy services of POLICY_HOOKS may deny it (see policy_hooks.go)
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+// registerValidators installs the policy checks on the chain.
+func (s *Server) registerValidators() {
+	s.BC.RegisterValidator(blockchain.NewValidator("freeze", s.freezeValidator))
+	s.BC.RegisterValidator(blockchain.NewValidator("limit", limitValidator))
+	s.BC.RegisterValidator(blockchain.NewValidator("aml", amlValidator))
+	s.BC.RegisterValidator(blockchain.NewValidator("external", s.hookValidator))
+}
+
+// freezeValidator vetoes transactions signed by a deactivated wallet.
+func (s *Server) freezeValidator(ctx context.Context, tx *blockchain.Transaction) error {
+	for _, sender := range tx.Senders() {
+		active, err := s.walletActive(ctx, blockchain.EncodeAddress(sender))
+		if err != nil {
+			return fmt.Errorf("check wallet status: %w", err)
+		}
+		if !active {
+			return blockchain.Reject("freeze", "wallet is deactivated")
+		}
+	}
+	return nil
+}
+
+// txMaxAmount returns the per-transaction limit (TX_MAX_AMOUNT), or 0
+// when there is none.
+func txMaxAmount() int {
+	n, err := strconv.Atoi(os.Getenv("TX_MAX_AMOUNT"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// limitValidator vetoes transactions sending more than TX_MAX_AMOUNT;
+// change returned to the sender does not count.
+func limitValidator(_ context.Context, tx *blockchain.Transaction) error {
+	max := txMaxAmount()
+	if max == 0 {
+		return nil
+	}
+	sent := 0
+	for _, out := range tx.ExternalOutputs() {
+		sent += out.Value
+	}
+	if sent > max {
+		return blockchain.Reject("limit", "amount exceeds the transaction limit")
+	}
+	return nil
+}
+
+// amlBlockedAddresses returns the screened addresses from the
+// comma-separated AML_BLOCKED_ADDRESSES, in either address encoding.
+func amlBlockedAddresses() map[string]bool {
+	blocked := make(map[string]bool)
+	for _, a := range strings.Split(os.Getenv("AML_BLOCKED_ADDRESSES"), ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			blocked[blockchain.CanonicalAddress(a)] = true
+		}
+	}
+	return blocked
+}
+
+// amlValidator vetoes transactions from or to a blocked address.
+func amlValidator(_ context.Context, tx *blockchain.Transaction) error {
+	blocked := amlBlockedAddresses()
+	if len(blocked) == 0 {
+		return nil
+	}
+	for _, sender := range tx.Senders() {
+		if blocked[blockchain.EncodeAddress(sender)] {
+			return blockchain.Reject("aml", "address is blocked by AML screening")
+		}
+	}
+	for _, out := range tx.Vout {
+		if blocked[blockchain.EncodeAddress(out.Owner())] {
+			return blockchain.Reject("aml", "address is blocked by AML screening")
+		}
+	}
+	return nil
+}
+
+// policyError writes the response for a failed CheckPolicy: 403 with the
+// validator's reason for a veto, 500 when a check could not run.
+func policyError(w http.ResponseWriter, r *http.Request, err error) {
+	if rej, ok := blockchain.AsRejection(err); ok {
+		httpError(w, r, rej.Reason, http.StatusForbidden)
+		return
+	}
+	httpError(w, r, "failed to validate transaction", http.StatusInternalServerError)
+}
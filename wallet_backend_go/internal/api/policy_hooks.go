@@ -0,0 +1,123 @@
+package api
+
+// policy_hooks.go asks the external policy services of POLICY_HOOKS
+// (see package policyhook) about transactions and disbursements. For
+// transactions they are the last of the chain's policy checks (see
+// policy.go), so they see every user transaction the local checks let
+// through, and a denial is answered like any policy veto. Disbursements
+// (zakat distributions and template executions) are asked about once
+// their payouts are known and before the pool's transaction is built;
+// that transaction then passes the transaction check too.
+
+import (
+	"context"
+	"fmt"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/policyhook"
+)
+
+// hookValidator vetoes transactions a policy service denies.
+func (s *Server) hookValidator(ctx context.Context, tx *blockchain.Transaction) error {
+	if !s.policyHooks.Handles(policyhook.ActionTransaction) {
+		return nil
+	}
+	from, _, _, _ := txParties(tx)
+	a := policyhook.Action{
+		Type:     policyhook.ActionTransaction,
+		ID:       fmt.Sprintf("%x", tx.ID),
+		TenantID: tenantID(ctx),
+		From:     from,
+		Time:     s.Clock.Now().UTC(),
+	}
+	senders := tx.Senders()
+	for _, out := range tx.Vout {
+		o := policyhook.Output{Amount: out.Value}
+		if cond, err := out.Condition(); err != nil || cond.Kind != blockchain.CondBurn {
+			o.Address = blockchain.EncodeAddress(out.Owner())
+		}
+		for _, sender := range senders {
+			if out.IsLockedWith(sender) {
+				o.Change = true
+			}
+		}
+		if !o.Change {
+			a.Amount += out.Value
+		}
+		a.Outputs = append(a.Outputs, o)
+	}
+	if denial := s.askPolicyHooks(ctx, a); denial != nil {
+		return blockchain.Reject("external", denial.Reason)
+	}
+	return nil
+}
+
+// askPolicyHooks asks the policy services about a and returns the
+// denial, if any. Denials and services that could not be asked are
+// logged.
+func (s *Server) askPolicyHooks(ctx context.Context, a policyhook.Action) *policyhook.Denial {
+	denial := s.policyHooks.Check(ctx, a, func(svc *policyhook.Service, err error) {
+		mode := "closed"
+		if svc.FailOpen {
+			mode = "open"
+		}
+		s.logEvent(ctx, "error", "policy_hook_failed",
+			fmt.Sprintf("policy service %s not asked about %s %s (fails %s): %v", svc.Name, a.Type, a.ID, mode, err), "policy")
+	})
+	if denial != nil {
+		s.logEvent(ctx, "warn", "policy_hook_denied",
+			fmt.Sprintf("policy service %s denied %s %s: %s", denial.Service, a.Type, a.ID, denial.Reason), "policy")
+	}
+	return denial
+}
+
+// distributionAction is the disbursement action of a zakat
+// distribution about to be paid.
+func (s *Server) distributionAction(ctx context.Context, resp distributeResponse) policyhook.Action {
+	a := policyhook.Action{
+		Type:     policyhook.ActionDisbursement,
+		ID:       resp.DistributionID,
+		TenantID: tenantID(ctx),
+		Actor:    adminName(ctx),
+		Source:   "zakat_distribution",
+		From:     resp.PoolAddress,
+		Amount:   resp.Distributed,
+		Time:     s.Clock.Now().UTC(),
+	}
+	for _, p := range resp.Payouts {
+		o := policyhook.Output{
+			Amount:        p.Amount,
+			BeneficiaryID: p.BeneficiaryID,
+			Category:      p.Category,
+			PayoutMethod:  p.PayoutMethod,
+		}
+		if !p.Burned {
+			o.Address = p.WalletAddress
+		}
+		a.Outputs = append(a.Outputs, o)
+	}
+	return a
+}
+
+// templateAction is the disbursement action of a template execution
+// about to be paid.
+func (s *Server) templateAction(ctx context.Context, resp executeTemplateResponse) policyhook.Action {
+	a := policyhook.Action{
+		Type:     policyhook.ActionDisbursement,
+		ID:       resp.TemplateID,
+		TenantID: tenantID(ctx),
+		Actor:    adminName(ctx),
+		Source:   "disbursement_template",
+		From:     resp.PoolAddress,
+		Amount:   resp.Amount,
+		Time:     s.Clock.Now().UTC(),
+	}
+	for _, p := range resp.Payouts {
+		a.Outputs = append(a.Outputs, policyhook.Output{
+			Address:       p.WalletAddress,
+			Amount:        p.Amount,
+			BeneficiaryID: p.BeneficiaryID,
+		})
+	}
+	return a
+}
@@ -0,0 +1,303 @@
+package api
+
+// pool_alerts.go watches the balance of every zakat pool (each tenant's
+// and ZAKAT_WALLET_ADDRESS) to catch unauthorized disbursements
+// quickly. Every POOL_ALERT_INTERVAL seconds the leader replays the
+// pool's outputs on the chain and compares its balance with the highest
+// it was within the last POOL_ALERT_WINDOW_MINUTES. A drop of more than
+// POOL_ALERT_DROP_PCT percent is logged as pool_balance_drop, posted to
+// POOL_ALERT_WEBHOOK_URL and emailed to POOL_ALERT_EMAILS, once per
+// pool and window. The monitor is off while POOL_ALERT_DROP_PCT is
+// unset or 0.
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/templates"
+)
+
+const (
+	defaultPoolAlertInterval = 60 // seconds
+	defaultPoolAlertWindow   = 60 // minutes
+	poolAlertWebhookTimeout  = 10 * time.Second
+)
+
+// poolAlertDropPct returns the drop, in percent, that raises an alert
+// (0 when the monitor is off).
+func poolAlertDropPct() float64 {
+	pct, err := strconv.ParseFloat(os.Getenv("POOL_ALERT_DROP_PCT"), 64)
+	if err != nil || pct <= 0 || pct > 100 {
+		return 0
+	}
+	return pct
+}
+
+func poolAlertWindow() time.Duration {
+	return time.Duration(envLimit("POOL_ALERT_WINDOW_MINUTES", defaultPoolAlertWindow)) * time.Minute
+}
+
+// poolAlertEmails returns the addresses alerts are emailed to.
+func poolAlertEmails() []string {
+	var out []string
+	for _, e := range strings.Split(os.Getenv("POOL_ALERT_EMAILS"), ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// poolAlert is an alert as posted to POOL_ALERT_WEBHOOK_URL.
+type poolAlert struct {
+	Type          string    `json:"type"` // pool_balance_drop
+	TenantID      string    `json:"tenant_id,omitempty"`
+	PoolAddress   string    `json:"pool_address"`
+	PeakBalance   int       `json:"peak_balance"`
+	PeakAt        time.Time `json:"peak_at"`
+	Balance       int       `json:"balance"`
+	DropPct       float64   `json:"drop_pct"`
+	ThresholdPct  float64   `json:"threshold_pct"`
+	WindowMinutes int       `json:"window_minutes"`
+	DetectedAt    time.Time `json:"detected_at"`
+}
+
+// poolAlerts remembers when each pool last raised an alert.
+type poolAlerts struct {
+	mu      sync.Mutex
+	alerted map[string]time.Time // pool address -> time of the alert
+}
+
+// due reports whether pool may raise an alert at now, and if so
+// records that it does.
+func (p *poolAlerts) due(pool string, now time.Time, window time.Duration) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if last, ok := p.alerted[pool]; ok && now.Sub(last) < window {
+		return false
+	}
+	if p.alerted == nil {
+		p.alerted = make(map[string]time.Time)
+	}
+	p.alerted[pool] = now
+	return true
+}
+
+// runPoolAlerts checks the pools every POOL_ALERT_INTERVAL seconds.
+func (s *Server) runPoolAlerts() {
+	ticker := time.NewTicker(time.Duration(envLimit("POOL_ALERT_INTERVAL", defaultPoolAlertInterval)) * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.runScheduled("pool_alerts", s.checkPoolBalances)
+	}
+}
+
+// alertPools returns the zakat pools to watch, by address, with the
+// tenant each belongs to ("" for ZAKAT_WALLET_ADDRESS).
+func (s *Server) alertPools(ctx context.Context) (map[string]string, error) {
+	pools := make(map[string]string)
+	if addr := os.Getenv("ZAKAT_WALLET_ADDRESS"); addr != "" {
+		pools[blockchain.CanonicalAddress(addr)] = ""
+	}
+	if s.DB == nil {
+		return pools, nil
+	}
+	tenants, err := s.DB.ListTenants(ctx)
+	if err != nil {
+		return pools, err
+	}
+	for _, t := range tenants {
+		if t.ZakatWalletAddress != "" {
+			pools[blockchain.CanonicalAddress(t.ZakatWalletAddress)] = t.ID
+		}
+	}
+	return pools, nil
+}
+
+// checkPoolBalances raises an alert for every pool whose balance fell
+// by more than POOL_ALERT_DROP_PCT within the window.
+func (s *Server) checkPoolBalances() {
+	threshold := poolAlertDropPct()
+	if threshold == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	pools, err := s.alertPools(ctx)
+	if err != nil {
+		s.logEvent(ctx, "error", "pool_alert_check_failed", fmt.Sprintf("failed to list tenant pools: %v", err), "monitor")
+	}
+	if len(pools) == 0 {
+		return
+	}
+	s.chainMu.Lock()
+	blocks := append([]*blockchain.Block(nil), s.BC.Blocks...)
+	s.chainMu.Unlock()
+
+	window := poolAlertWindow()
+	now := s.Clock.Now().UTC()
+	for pool, tenant := range pools {
+		poolHash, err := blockchain.DecodeAddress(pool)
+		if err != nil {
+			continue
+		}
+		peak, peakAt, balance := poolBalanceHistory(blocks, poolHash, now.Add(-window))
+		if peak <= 0 || balance >= peak {
+			continue
+		}
+		drop := float64(peak-balance) / float64(peak) * 100
+		if drop <= threshold || !s.poolAlerts.due(pool, now, window) {
+			continue
+		}
+		s.raisePoolAlert(ctx, poolAlert{
+			Type:          "pool_balance_drop",
+			TenantID:      tenant,
+			PoolAddress:   pool,
+			PeakBalance:   peak,
+			PeakAt:        peakAt,
+			Balance:       balance,
+			DropPct:       drop,
+			ThresholdPct:  threshold,
+			WindowMinutes: int(window.Minutes()),
+			DetectedAt:    now,
+		})
+	}
+}
+
+// poolBalanceHistory replays the pool's outputs through blocks and
+// returns the highest balance the pool had since from, when it had it,
+// and its balance after the last block. The balance is taken at from
+// and after every later block.
+func poolBalanceHistory(blocks []*blockchain.Block, poolHash []byte, from time.Time) (peak int, peakAt time.Time, balance int) {
+	outputs := make(map[string]int) // "txid:vout" -> value
+	inWindow := false
+	for _, b := range blocks {
+		ts := time.Unix(b.Timestamp, 0).UTC()
+		if !inWindow && !ts.Before(from) {
+			inWindow = true
+			peak, peakAt = balance, from
+		}
+		for _, tx := range b.Transactions {
+			if !tx.IsCoinbase() {
+				for _, in := range tx.Vin {
+					key := fmt.Sprintf("%x:%d", in.Txid, in.Vout)
+					if v, ok := outputs[key]; ok {
+						balance -= v
+						delete(outputs, key)
+					}
+				}
+			}
+			for i, out := range tx.Vout {
+				if out.IsLockedWith(poolHash) {
+					outputs[fmt.Sprintf("%x:%d", tx.ID, i)] = out.Value
+					balance += out.Value
+				}
+			}
+		}
+		if inWindow && balance > peak {
+			peak, peakAt = balance, ts
+		}
+	}
+	if !inWindow {
+		peak, peakAt = balance, from
+	}
+	return peak, peakAt, balance
+}
+
+// raisePoolAlert logs a, posts it to the webhook and emails it.
+func (s *Server) raisePoolAlert(ctx context.Context, a poolAlert) {
+	s.logEvent(ctx, "error", "pool_balance_drop",
+		fmt.Sprintf("zakat pool %s tenant=%q fell %.1f%% from %d to %d within %d minutes (alert above %.1f%%)",
+			a.PoolAddress, a.TenantID, a.DropPct, a.PeakBalance, a.Balance, a.WindowMinutes, a.ThresholdPct),
+		"monitor")
+
+	if url := strings.TrimSpace(os.Getenv("POOL_ALERT_WEBHOOK_URL")); url != "" {
+		if err := postPoolAlert(ctx, url, a); err != nil {
+			s.logEvent(ctx, "error", "pool_alert_webhook_failed", fmt.Sprintf("pool alert for %s: %v", a.PoolAddress, err), "monitor")
+		}
+	}
+
+	emails := poolAlertEmails()
+	if len(emails) == 0 || s.mailer == nil {
+		return
+	}
+	msg, err := s.renderEmail(ctx, a.TenantID, templates.PoolAlert, map[string]string{
+		"pool_address":   a.PoolAddress,
+		"peak_balance":   strconv.Itoa(a.PeakBalance),
+		"peak_at":        a.PeakAt.Format("2006-01-02 15:04"),
+		"balance":        strconv.Itoa(a.Balance),
+		"drop_pct":       strconv.FormatFloat(a.DropPct, 'f', 1, 64),
+		"threshold_pct":  strconv.FormatFloat(a.ThresholdPct, 'f', 1, 64),
+		"window_minutes": strconv.Itoa(a.WindowMinutes),
+	})
+	if err != nil {
+		s.logEvent(ctx, "error", "pool_alert_email_failed", fmt.Sprintf("pool alert for %s: %v", a.PoolAddress, err), "monitor")
+		return
+	}
+	for _, to := range emails {
+		if err := s.mailer.SendHTML(ctx, to, msg.Subject, msg.HTML); err != nil {
+			s.logEvent(ctx, "error", "pool_alert_email_failed", fmt.Sprintf("pool alert for %s to %s: %v", a.PoolAddress, to, err), "monitor")
+		}
+	}
+}
+
+// postPoolAlert posts a to url, signed in X-Alert-Signature with
+// POOL_ALERT_WEBHOOK_SECRET when it is set.
+func postPoolAlert(ctx context.Context, url string, a poolAlert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, poolAlertWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret := os.Getenv("POOL_ALERT_WEBHOOK_SECRET"); secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Alert-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// logPoolAlertConfig reports at startup what the monitor watches for.
+func (s *Server) logPoolAlertConfig() {
+	targets := []string{"the system log"}
+	if os.Getenv("POOL_ALERT_WEBHOOK_URL") != "" {
+		targets = append(targets, "the webhook")
+	}
+	if n := len(poolAlertEmails()); n > 0 {
+		if s.mailer == nil {
+			log.Println("warning: POOL_ALERT_EMAILS set but SMTP is not configured, pool alerts are not emailed")
+		} else {
+			targets = append(targets, fmt.Sprintf("%d email addresses", n))
+		}
+	}
+	log.Printf("pool alerts: drops above %.1f%% within %s are reported to %s",
+		poolAlertDropPct(), poolAlertWindow(), strings.Join(targets, ", "))
+}
@@ -0,0 +1,138 @@
+package api
+
+// preferences.go exposes the notification preferences of a user: which
+// events (incoming funds, zakat deduction, reminders, marketing) are
+// delivered on which channels. The dispatcher in notifications.go
+// enforces them.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/notify"
+)
+
+type updatePreferencesRequest struct {
+	Events map[string][]string `json:"events"`
+}
+
+// loadPreferenceUser fetches the user of a preferences request, writing
+// the error response itself when it cannot.
+func (s *Server) loadPreferenceUser(ctx context.Context, w http.ResponseWriter, r *http.Request) *models.User {
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return nil
+	}
+
+	u, err := s.DB.GetUser(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, "failed to load user", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "user_get_failed", err.Error(), r.RemoteAddr)
+		return nil
+	}
+	if u == nil || (tenantID(ctx) != "" && u.TenantID != tenantID(ctx)) {
+		httpError(w, r, "user not found", http.StatusNotFound)
+		return nil
+	}
+	return u
+}
+
+// GetPreferences returns the user's notification preferences, with the
+// defaults filled in for events they never changed. Only the session
+// user can read their own.
+func (s *Server) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if mux.Vars(r)["id"] != sessionFrom(ctx).Subject {
+		httpError(w, r, "preferences belong to another user", http.StatusForbidden)
+		return
+	}
+	u := s.loadPreferenceUser(ctx, w, r)
+	if u == nil {
+		return
+	}
+
+	prefs, err := s.preferencesFor(ctx, u)
+	if err != nil {
+		httpError(w, r, "failed to load preferences", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "preferences_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(prefs)
+}
+
+// UpdatePreferences sets the channels of the given events; events left
+// out of the request keep their current channels. An empty list turns
+// an event off. Only the session user can change their own.
+func (s *Server) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if mux.Vars(r)["id"] != sessionFrom(ctx).Subject {
+		httpError(w, r, "preferences belong to another user", http.StatusForbidden)
+		return
+	}
+	u := s.loadPreferenceUser(ctx, w, r)
+	if u == nil {
+		return
+	}
+
+	var req updatePreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	prefs, err := s.preferencesFor(ctx, u)
+	if err != nil {
+		httpError(w, r, "failed to load preferences", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "preferences_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	for event, channels := range req.Events {
+		if !knownPreferenceEvent(event) {
+			httpError(w, r, "unknown notification event", http.StatusBadRequest)
+			return
+		}
+
+		seen := make(map[string]bool)
+		out := []string{}
+		for _, c := range channels {
+			if !notify.ValidChannel(c) {
+				httpError(w, r, "unknown notification channel", http.StatusBadRequest)
+				return
+			}
+			if (c == notify.ChannelWhatsApp || c == notify.ChannelSMS) && u.Phone == "" {
+				httpError(w, r, "a phone number is required for sms and whatsapp", http.StatusBadRequest)
+				return
+			}
+			if !seen[c] {
+				seen[c] = true
+				out = append(out, c)
+			}
+		}
+		prefs.Events[event] = out
+	}
+
+	prefs.UpdatedAt = s.Clock.Now().UTC()
+	if err := s.DB.SaveNotificationPreferences(ctx, prefs); err != nil {
+		httpError(w, r, "failed to save preferences", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "preferences_save_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	s.logEvent(ctx, "info", "preferences_updated",
+		fmt.Sprintf("notification preferences of user %s updated", u.ID),
+		r.RemoteAddr,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(prefs)
+}
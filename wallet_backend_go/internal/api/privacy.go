@@ -0,0 +1,41 @@
+package api
+
+// privacy.go rates the privacy of an address from its history on the
+// chain (see package privacy), so the wallet can warn a user who keeps
+// receiving on one address and suggest deriving new ones.
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/i18n"
+	"wallet_backend_go/internal/privacy"
+)
+
+// AddressPrivacy returns the privacy report of an address, with its
+// warnings in the request's language.
+func (s *Server) AddressPrivacy(w http.ResponseWriter, r *http.Request) {
+	pubKeyHash, err := blockchain.DecodeAddress(mux.Vars(r)["address"])
+	if err != nil {
+		httpError(w, r, "invalid address", http.StatusBadRequest)
+		return
+	}
+
+	// blocks are only appended, so the slice taken under the lock
+	// stays valid while it is read
+	s.chainMu.Lock()
+	blocks := s.BC.Blocks
+	s.chainMu.Unlock()
+
+	rep := privacy.Analyze(blocks, blockchain.EncodeAddress(pubKeyHash))
+	for i := range rep.Warnings {
+		rep.Warnings[i].Message = i18n.T(lang(r), rep.Warnings[i].Message)
+		rep.Warnings[i].Suggestion = i18n.T(lang(r), rep.Warnings[i].Suggestion)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rep)
+}
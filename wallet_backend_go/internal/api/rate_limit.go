@@ -0,0 +1,167 @@
+package api
+
+// rate_limit.go paces the OTP and transaction endpoints with token
+// buckets, so that request-otp cannot be spammed to enumerate emails,
+// codes cannot be guessed faster than the buckets refill and sends
+// cannot be hammered to keep the miner busy. Every client IP has a
+// bucket per class of endpoints, checked before the body is read, and
+// every email (OTP) or sending address (transactions) has one too,
+// checked once the handler knows it; a send is charged to its address
+// only after its key or signatures proved the sender, so nobody can use
+// up another wallet's bucket. A bucket holds
+// RATE_LIMIT_<CLASS>_<KIND>_BURST tokens and refills at
+// RATE_LIMIT_<CLASS>_<KIND> tokens per minute; 0 turns that limit off.
+// The buckets live in memory, per instance.
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateClass is a group of endpoints sharing limits.
+type rateClass string
+
+const (
+	rateOTP rateClass = "otp"
+	rateTx  rateClass = "tx"
+)
+
+// rateSetting is the limit of a bucket: tokens per minute and burst
+// size.
+type rateSetting struct {
+	perMinute float64
+	burst     float64
+}
+
+// defaultRates are the limits by class and key kind ("ip", "email",
+// "address").
+var defaultRates = map[string]rateSetting{
+	"otp_ip":     {perMinute: 5, burst: 10},
+	"otp_email":  {perMinute: 1, burst: 3},
+	"tx_ip":      {perMinute: 30, burst: 60},
+	"tx_address": {perMinute: 10, burst: 20},
+}
+
+// rateLimitPruneInterval is how often buckets that refilled are
+// dropped, so that the map does not grow without bound.
+const rateLimitPruneInterval = time.Minute
+
+// rateFor returns the limit of class per key kind, read from
+// RATE_LIMIT_<CLASS>_<KIND> and its _BURST. ok is false when the limit
+// is off.
+func rateFor(class rateClass, kind string) (rateSetting, bool) {
+	name := string(class) + "_" + kind
+	rate := defaultRates[name]
+	env := "RATE_LIMIT_" + strings.ToUpper(name)
+	if v := strings.TrimSpace(os.Getenv(env)); v != "" {
+		if n, err := strconv.ParseFloat(v, 64); err == nil && n >= 0 {
+			rate.perMinute = n
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv(env + "_BURST")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			rate.burst = float64(n)
+		}
+	}
+	if rate.perMinute == 0 {
+		return rate, false
+	}
+	rate.burst = max(rate.burst, 1)
+	return rate, true
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // when the bucket is full again
+	logged  bool      // the current run of refusals was logged
+}
+
+// rateLimiter keeps a token bucket per key.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	pruned  time.Time
+}
+
+// take takes a token from the bucket of key. When the bucket is empty
+// it returns false, how long until a token is back, and whether this
+// is the first refusal since the key was last let through.
+func (l *rateLimiter) take(key string, rate rateSetting, now time.Time) (ok bool, wait time.Duration, first bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.buckets == nil {
+		l.buckets = make(map[string]*tokenBucket)
+	}
+	if now.Sub(l.pruned) >= rateLimitPruneInterval {
+		for k, b := range l.buckets {
+			if !now.Before(b.full) {
+				delete(l.buckets, k)
+			}
+		}
+		l.pruned = now
+	}
+
+	perSecond := rate.perMinute / 60
+	b, found := l.buckets[key]
+	if !found {
+		b = &tokenBucket{tokens: rate.burst, updated: now}
+		l.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(rate.burst, b.tokens+elapsed*perSecond)
+		b.updated = now
+	}
+	if b.tokens < 1 {
+		first = !b.logged
+		b.logged = true
+		wait = time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+		return false, wait, first
+	}
+	b.tokens--
+	b.logged = false
+	b.full = now.Add(time.Duration((rate.burst - b.tokens) / perSecond * float64(time.Second)))
+	return true, 0, false
+}
+
+// allowRate takes a token for key (of kind "ip", "email" or "address")
+// in class. Over the limit it writes 429 with Retry-After, logs the
+// first refusal of the run as rate_limited and returns false.
+func (s *Server) allowRate(w http.ResponseWriter, r *http.Request, class rateClass, kind, key string) bool {
+	rate, on := rateFor(class, kind)
+	if !on || key == "" {
+		return true
+	}
+	ok, wait, first := s.rateLimiter.take(string(class)+"|"+kind+"|"+key, rate, s.Clock.Now())
+	if ok {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	httpError(w, r, "too many requests, try again later", http.StatusTooManyRequests)
+	if first {
+		s.logEvent(r.Context(), "warn", "rate_limited",
+			fmt.Sprintf("%s %s limit reached for %s=%s on %s %s (%g per minute, burst %g)",
+				class, kind, kind, key, r.Method, r.URL.Path, rate.perMinute, rate.burst),
+			r.RemoteAddr)
+	}
+	return false
+}
+
+// limitRate applies the per-IP limit of class to next before the
+// request body is read.
+func (s *Server) limitRate(class rateClass, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.allowRate(w, r, class, "ip", clientHost(r)) {
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,289 @@
+package api
+
+// rates.go serves the fiat value of chain units and converts donation
+// amounts between fiat currencies and units. Rates are the value of one
+// chain unit in each currency. They come from the price feed at
+// PRICE_FEED_URL, cached for PRICE_FEED_TTL seconds, or from the
+// configuration (FIAT_CURRENCY with FIAT_RATE, and FIAT_RATES) when no
+// feed is set. When the feed fails the last fetched rates are served
+// marked stale. Every answer echoes the rates and their timestamp so
+// clients can show exactly what was used; fiat fields on balances and
+// receipts use the same rates.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wallet_backend_go/internal/i18n"
+)
+
+// unitsCurrency names chain units in conversions.
+const unitsCurrency = "units"
+
+const (
+	defaultPriceFeedTTL = 5 * time.Minute
+	maxPriceFeedBody    = 1 << 20
+
+	// priceFeedRetry spaces the fetches while the feed is failing.
+	priceFeedRetry = 30 * time.Second
+)
+
+// priceQuote is a set of rates and where they came from.
+type priceQuote struct {
+	Currency string             `json:"currency"` // the display currency, FIAT_CURRENCY
+	Rates    map[string]float64 `json:"rates"`    // currency -> value of one unit
+	Source   string             `json:"source"`   // feed, config
+	AsOf     time.Time          `json:"as_of"`
+	Stale    bool               `json:"stale"` // the feed failed; these are the last fetched rates
+}
+
+// priceFeedResponse is what PRICE_FEED_URL returns. Timestamp is
+// optional; the fetch time is used without it.
+type priceFeedResponse struct {
+	Rates     map[string]float64 `json:"rates"`
+	Timestamp *time.Time         `json:"timestamp"`
+}
+
+type convertRequest struct {
+	Amount float64 `json:"amount"`
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+}
+
+type convertResponse struct {
+	Amount    float64   `json:"amount"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Result    float64   `json:"result"`
+	Formatted string    `json:"formatted,omitempty"` // fiat results only
+	Rate      float64   `json:"rate"`                // To per From
+	Source    string    `json:"source"`
+	AsOf      time.Time `json:"as_of"`
+	Stale     bool      `json:"stale"`
+}
+
+// priceCache keeps the last quote fetched from the price feed.
+type priceCache struct {
+	mu        sync.Mutex
+	quote     *priceQuote
+	fetchedAt time.Time // of quote
+	failedAt  time.Time // of the last failed fetch
+}
+
+func fiatCurrency() string {
+	if c := os.Getenv("FIAT_CURRENCY"); c != "" {
+		return strings.ToUpper(c)
+	}
+	return "PKR"
+}
+
+func priceFeedTTL() time.Duration {
+	if n, err := strconv.Atoi(os.Getenv("PRICE_FEED_TTL")); err == nil && n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	return defaultPriceFeedTTL
+}
+
+// configuredRates returns the rates of FIAT_RATES ("USD:0.0036,...")
+// and FIAT_RATE, which is the rate of FIAT_CURRENCY.
+func configuredRates() map[string]float64 {
+	rates := make(map[string]float64)
+	for _, pair := range strings.Split(os.Getenv("FIAT_RATES"), ",") {
+		code, value, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			continue
+		}
+		if rate, err := strconv.ParseFloat(value, 64); err == nil && rate > 0 {
+			rates[strings.ToUpper(strings.TrimSpace(code))] = rate
+		}
+	}
+	if rate, err := strconv.ParseFloat(os.Getenv("FIAT_RATE"), 64); err == nil && rate > 0 {
+		rates[fiatCurrency()] = rate
+	}
+	return rates
+}
+
+// fetchPrices reads the price feed.
+func fetchPrices(ctx context.Context, feedURL string) (*priceFeedResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("price feed error: %s - %s", resp.Status, string(body))
+	}
+	var feed priceFeedResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxPriceFeedBody)).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("decode price feed: %w", err)
+	}
+	return &feed, nil
+}
+
+// currentPrices returns the rates in effect, fetching the feed when the
+// cached quote has expired. It fails only when no rates are available.
+func (s *Server) currentPrices(ctx context.Context) (priceQuote, error) {
+	now := s.Clock.Now().UTC()
+	feedURL := os.Getenv("PRICE_FEED_URL")
+	if feedURL == "" {
+		rates := configuredRates()
+		if len(rates) == 0 {
+			return priceQuote{}, fmt.Errorf("no fiat rates configured")
+		}
+		return priceQuote{Currency: fiatCurrency(), Rates: rates, Source: "config", AsOf: now}, nil
+	}
+
+	p := &s.prices
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fresh := p.quote != nil && now.Sub(p.fetchedAt) < priceFeedTTL()
+	if fresh || now.Sub(p.failedAt) < priceFeedRetry {
+		if p.quote == nil {
+			return priceQuote{}, fmt.Errorf("price feed unavailable")
+		}
+		return *p.quote, nil
+	}
+	feed, err := fetchPrices(ctx, feedURL)
+	if err == nil {
+		rates := make(map[string]float64, len(feed.Rates))
+		for code, rate := range feed.Rates {
+			if rate > 0 && !math.IsInf(rate, 0) {
+				rates[strings.ToUpper(code)] = rate
+			}
+		}
+		if len(rates) == 0 {
+			err = fmt.Errorf("price feed returned no rates")
+		} else {
+			asOf := now
+			if feed.Timestamp != nil {
+				asOf = feed.Timestamp.UTC()
+			}
+			p.quote = &priceQuote{Currency: fiatCurrency(), Rates: rates, Source: "feed", AsOf: asOf}
+			p.fetchedAt = now
+			return *p.quote, nil
+		}
+	}
+
+	p.failedAt = now
+	s.logEvent(ctx, "warn", "price_feed_failed", err.Error(), "prices")
+	if p.quote == nil {
+		return priceQuote{}, err
+	}
+	p.quote.Stale = true
+	return *p.quote, nil
+}
+
+// fiatFor converts units into the display currency, or returns nil if
+// it has no rate.
+func (s *Server) fiatFor(r *http.Request, units int) *fiatAmount {
+	quote, err := s.currentPrices(r.Context())
+	if err != nil {
+		return nil
+	}
+	rate, ok := quote.Rates[quote.Currency]
+	if !ok {
+		return nil
+	}
+
+	amount := float64(units) * rate
+	return &fiatAmount{
+		Currency:  quote.Currency,
+		Amount:    amount,
+		Formatted: i18n.FormatMoney(lang(r), quote.Currency, amount),
+	}
+}
+
+// GetRates returns the rates in effect.
+func (s *Server) GetRates(w http.ResponseWriter, r *http.Request) {
+	quote, err := s.currentPrices(r.Context())
+	if err != nil {
+		httpError(w, r, "exchange rates unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(quote)
+}
+
+// Convert converts an amount between a fiat currency and chain units,
+// or between two fiat currencies. Units are rounded down to whole
+// units, which is what can be sent.
+func (s *Server) Convert(w http.ResponseWriter, r *http.Request) {
+	var req convertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Amount <= 0 || math.IsInf(req.Amount, 0) || math.IsNaN(req.Amount) {
+		httpError(w, r, "amount must be positive", http.StatusBadRequest)
+		return
+	}
+	normalize := func(c string) string {
+		c = strings.TrimSpace(c)
+		if strings.EqualFold(c, unitsCurrency) {
+			return unitsCurrency
+		}
+		return strings.ToUpper(c)
+	}
+	req.From, req.To = normalize(req.From), normalize(req.To)
+
+	quote, err := s.currentPrices(r.Context())
+	if err != nil {
+		httpError(w, r, "exchange rates unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	// value of one unit of c in units
+	perUnit := func(c string) (float64, bool) {
+		if c == unitsCurrency {
+			return 1, true
+		}
+		rate, ok := quote.Rates[c]
+		return rate, ok
+	}
+	fromRate, ok1 := perUnit(req.From)
+	toRate, ok2 := perUnit(req.To)
+	if !ok1 || !ok2 {
+		httpError(w, r, "unsupported currency", http.StatusBadRequest)
+		return
+	}
+
+	resp := convertResponse{
+		Amount: req.Amount,
+		From:   req.From,
+		To:     req.To,
+		Rate:   toRate / fromRate,
+		Source: quote.Source,
+		AsOf:   quote.AsOf,
+		Stale:  quote.Stale,
+	}
+	resp.Result = req.Amount / fromRate * toRate
+	if req.To == unitsCurrency {
+		// tolerate float error just below a whole unit
+		resp.Result = math.Floor(resp.Result + 1e-9)
+	} else {
+		resp.Formatted = i18n.FormatMoney(lang(r), req.To, resp.Result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,71 @@
+package api
+
+// readiness.go reports whether this instance can serve traffic. The
+// process being up is /health; /ready additionally fails while the
+// Supabase circuit breaker is open, so load balancers route around an
+// instance whose database calls are failing fast. The breaker and the
+// per-operation call statistics of the Supabase client are exposed to
+// admins as metrics.
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"wallet_backend_go/internal/db"
+)
+
+// statsReporter is implemented by stores that keep client statistics,
+// such as the Supabase client.
+type statsReporter interface {
+	Stats() db.ClientStats
+}
+
+type readinessDatabase struct {
+	Configured bool   `json:"configured"`
+	Breaker    string `json:"breaker,omitempty"` // closed, open or half_open
+}
+
+type readinessResponse struct {
+	Status   string            `json:"status"` // ready or degraded
+	Database readinessDatabase `json:"database"`
+	Leader   bool              `json:"leader"` // runs the background schedulers
+	// ReadOnly and Sync describe an explorer node (see readonly.go).
+	ReadOnly bool                `json:"read_only,omitempty"`
+	Sync     *explorerSyncStatus `json:"sync,omitempty"`
+}
+
+// Ready returns 200 when the instance can serve requests and 503 while
+// the database circuit breaker is open. Without a database the API
+// runs in memory and is always ready.
+func (s *Server) Ready(w http.ResponseWriter, r *http.Request) {
+	resp := readinessResponse{Status: "ready", Database: readinessDatabase{Configured: s.DB != nil}, Leader: s.isLeader()}
+	if s.readOnly {
+		resp.Leader = false
+		resp.ReadOnly = true
+		resp.Sync = s.follow.status()
+	}
+	if sr, ok := s.DB.(statsReporter); ok {
+		resp.Database.Breaker = sr.Stats().Breaker.State
+		if resp.Database.Breaker == db.BreakerOpen {
+			resp.Status = "degraded"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status != "ready" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// DatabaseMetrics returns the Supabase client's breaker state and call
+// statistics per operation.
+func (s *Server) DatabaseMetrics(w http.ResponseWriter, r *http.Request) {
+	sr, ok := s.DB.(statsReporter)
+	if !ok {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(sr.Stats())
+}
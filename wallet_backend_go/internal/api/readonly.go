@@ -0,0 +1,147 @@
+package api
+
+// readonly.go runs the server as a read-only explorer node
+// (SERVER_MODE=explorer). Such a node mines nothing and runs no
+// background jobs; it follows the writing node by importing the blocks
+// the writer mirrors to Supabase every EXPLORER_SYNC_INTERVAL seconds
+// and serves the explorer, reports and other reads from that chain and
+// the shared database. Requests that change state are refused, so any
+// number of explorer nodes can sit behind a load balancer next to the
+// single writing node.
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/bridge"
+	"wallet_backend_go/internal/db"
+	"wallet_backend_go/internal/logship"
+)
+
+const defaultExplorerSyncInterval = 5 // seconds
+
+// readOnlyAllowed lists the POST routes that only compute an answer and
+// are served by explorer nodes too.
+var readOnlyAllowed = map[string]bool{
+	"/api/v1/transactions/decode":  true,
+	"/api/v1/transactions/prepare": true,
+	"/api/v1/convert":              true,
+	"/api/v1/stealth/scan":         true,
+}
+
+// ExplorerMode reports whether SERVER_MODE selects a read-only explorer
+// node.
+func ExplorerMode() bool {
+	return os.Getenv("SERVER_MODE") == "explorer"
+}
+
+// explorerSync records how the node's chain keeps up with the writer.
+type explorerSync struct {
+	mu       sync.Mutex
+	lastSync time.Time
+	lastErr  string
+}
+
+type explorerSyncStatus struct {
+	LastSyncAt *time.Time `json:"last_sync_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+func (e *explorerSync) status() *explorerSyncStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	st := &explorerSyncStatus{LastError: e.lastErr}
+	if !e.lastSync.IsZero() {
+		at := e.lastSync
+		st.LastSyncAt = &at
+	}
+	return st
+}
+
+// NewExplorerServer constructs a read-only Server that follows the
+// blocks in store, which must not be nil.
+func NewExplorerServer(bc *blockchain.Blockchain, store db.Store) *Server {
+	s := newServer(bc, store)
+	s.readOnly = true
+	s.logShipper = logship.NewFromEnv()
+	// listed with the campaigns; the writer credits them
+	s.bridge, _ = bridge.FromEnv()
+	interval := time.Duration(envLimit("EXPLORER_SYNC_INTERVAL", defaultExplorerSyncInterval)) * time.Second
+	go s.runFollower(interval)
+	return s
+}
+
+// runFollower imports the writer's new blocks on every tick.
+func (s *Server) runFollower(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.followChain()
+		<-ticker.C
+	}
+}
+
+// followChain imports the blocks mirrored since the last call.
+func (s *Server) followChain() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	s.chainMu.Lock()
+	var err error
+	if len(s.BC.Blocks) == 1 && os.Getenv("GENESIS_FILE") == "" {
+		// the writer's genesis was built at its startup; take it on
+		_, err = db.SeedGenesis(ctx, s.DB, s.BC)
+	}
+	tip := len(s.BC.Blocks)
+	n := 0
+	if err == nil {
+		n, err = db.SyncChain(ctx, s.DB, s.BC)
+	}
+	if n > 0 {
+		for _, b := range s.BC.Blocks[tip:] {
+			s.reports.invalidateBlock(b)
+		}
+		_ = s.UTXO.Reindex()
+	}
+	s.chainMu.Unlock()
+
+	s.follow.mu.Lock()
+	defer s.follow.mu.Unlock()
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	} else {
+		s.follow.lastSync = s.Clock.Now().UTC()
+	}
+	if msg != s.follow.lastErr && msg != "" {
+		// log each new problem once rather than on every tick
+		log.Printf("explorer sync: %v", err)
+	}
+	s.follow.lastErr = msg
+}
+
+// withReadOnly refuses requests that change state on explorer nodes.
+func (s *Server) withReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.readOnly {
+			next.ServeHTTP(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if readOnlyAllowed[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+		httpError(w, r, "this is a read-only explorer node", http.StatusMethodNotAllowed)
+	})
+}
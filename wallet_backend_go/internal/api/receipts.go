@@ -0,0 +1,159 @@
+package api
+
+// receipts.go serves zakat receipts. A receipt is the public view of a
+// zakat record: anyone holding the receipt id can check it against the
+// chain, and the PDF version links to that check through a QR code.
+// The verification link is built from PUBLIC_BASE_URL and the printed
+// organization is the record's tenant, falling back to
+// RECEIPT_ORGANIZATION.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/i18n"
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/receipt"
+)
+
+type receiptResponse struct {
+	ReceiptID     string    `json:"receipt_id"`
+	WalletAddress string    `json:"wallet_address"`
+	Amount        int       `json:"amount"`
+	CreatedAt     time.Time `json:"created_at"`
+	BlockHash     string    `json:"block_hash"`
+	BlockHeight   int       `json:"block_height"`
+	Confirmations int       `json:"confirmations"`
+	Verified      bool      `json:"verified"`
+	VerifyURL     string    `json:"verify_url"`
+}
+
+// receiptVerifyURL returns the public verification link of a receipt.
+func receiptVerifyURL(id string) string {
+	return fmt.Sprintf("%s/api/v1/zakat/receipts/%s", publicBaseURL(), id)
+}
+
+// loadReceipt fetches the zakat record behind a receipt and writes the
+// error response itself when it cannot.
+func (s *Server) loadReceipt(w http.ResponseWriter, r *http.Request) *models.ZakatRecord {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return nil
+	}
+
+	zr, err := s.DB.GetZakatRecord(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, "failed to load receipt", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "receipt_get_failed", err.Error(), r.RemoteAddr)
+		return nil
+	}
+	if zr == nil {
+		httpError(w, r, "receipt not found", http.StatusNotFound)
+		return nil
+	}
+	return zr
+}
+
+// verifyReceipt checks the record against the chain: its block must be
+// on the chain and contain a transaction paying the recorded amount
+// away from the wallet. It returns the block height (-1 if unknown).
+func (s *Server) verifyReceipt(zr *models.ZakatRecord) (int, bool) {
+	wallet, err := blockchain.DecodeAddress(zr.WalletAddress)
+	if err != nil {
+		return -1, false
+	}
+
+	for h, b := range s.BC.Blocks {
+		if fmt.Sprintf("%x", b.Hash) != zr.BlockHash {
+			continue
+		}
+		for _, tx := range b.Transactions {
+			for _, out := range tx.Vout {
+				if out.Value == zr.Amount && !out.IsLockedWith(wallet) {
+					return h, true
+				}
+			}
+		}
+		return h, false
+	}
+	return -1, false
+}
+
+// GetReceipt is the public verification endpoint of a zakat receipt.
+func (s *Server) GetReceipt(w http.ResponseWriter, r *http.Request) {
+	zr := s.loadReceipt(w, r)
+	if zr == nil {
+		return
+	}
+
+	height, verified := s.verifyReceipt(zr)
+	resp := receiptResponse{
+		ReceiptID:     zr.ID,
+		WalletAddress: zr.WalletAddress,
+		Amount:        zr.Amount,
+		CreatedAt:     zr.CreatedAt,
+		BlockHash:     zr.BlockHash,
+		BlockHeight:   height,
+		Verified:      verified,
+		VerifyURL:     receiptVerifyURL(zr.ID),
+	}
+	if height >= 0 {
+		resp.Confirmations = len(s.BC.Blocks) - height
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// GetReceiptPDF renders a zakat receipt as a branded PDF.
+func (s *Server) GetReceiptPDF(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	zr := s.loadReceipt(w, r)
+	if zr == nil {
+		return
+	}
+
+	org := os.Getenv("RECEIPT_ORGANIZATION")
+	if org == "" {
+		org = "ZakatWallet"
+	}
+	if zr.TenantID != "" {
+		if t, err := s.DB.GetTenant(ctx, zr.TenantID); err == nil && t != nil {
+			org = t.Name
+		}
+	}
+
+	rec := receipt.Receipt{
+		ID:            zr.ID,
+		Organization:  org,
+		WalletAddress: zr.WalletAddress,
+		Amount:        zr.Amount,
+		Date:          zr.CreatedAt,
+		BlockHash:     zr.BlockHash,
+		VerifyURL:     receiptVerifyURL(zr.ID),
+	}
+	// the PDF uses a Latin font, so fiat is always formatted in English
+	if fiat := s.fiatFor(r, zr.Amount); fiat != nil {
+		rec.FiatAmount = i18n.FormatMoney(i18n.English, fiat.Currency, fiat.Amount)
+	}
+
+	pdf, err := receipt.RenderPDF(rec)
+	if err != nil {
+		httpError(w, r, "failed to render receipt", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "receipt_render_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="zakat-receipt-%s.pdf"`, zr.ID))
+	_, _ = w.Write(pdf)
+}
@@ -0,0 +1,131 @@
+package api
+
+// report_cache.go caches wallet report payloads per address. A report
+// needs several Supabase queries plus a chain scan, while its inputs
+// only change when a block touching the wallet is mined, so entries are
+// dropped whenever such a block is added (and again once the block's
+// rows are persisted). A TTL bounds staleness from edits made directly
+// in Supabase.
+
+import (
+	"sync"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+// reportCacheTTL is the maximum age of a cached wallet report.
+const reportCacheTTL = 5 * time.Minute
+
+// cacheStatusHeader reports HIT or MISS on cached endpoints for debugging.
+const cacheStatusHeader = "Cache-Status"
+
+type cachedReport struct {
+	report   walletReportResponse
+	storedAt time.Time
+}
+
+type reportCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedReport
+	// gens counts invalidations per address and epoch counts resets, so
+	// a report computed while a block was being mined is not stored over
+	// the invalidation.
+	gens  map[string]uint64
+	epoch uint64
+}
+
+// reportGen snapshots the invalidation state of one address.
+type reportGen struct {
+	addr  uint64
+	epoch uint64
+}
+
+// get returns the cached report of address, if fresh.
+func (c *reportCache) get(address string, now time.Time) (walletReportResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[address]
+	if !ok || now.Sub(e.storedAt) > reportCacheTTL {
+		return walletReportResponse{}, false
+	}
+	return e.report, true
+}
+
+// generation returns the invalidation state of address; pass it to put
+// so stale computations are discarded.
+func (c *reportCache) generation(address string) reportGen {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return reportGen{addr: c.gens[address], epoch: c.epoch}
+}
+
+// put stores report unless address was invalidated since gen was read.
+func (c *reportCache) put(address string, gen reportGen, report walletReportResponse, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if (reportGen{addr: c.gens[address], epoch: c.epoch}) != gen {
+		return
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]cachedReport)
+	}
+	c.entries[address] = cachedReport{report: report, storedAt: now}
+}
+
+// invalidate drops the cached reports of the given addresses.
+func (c *reportCache) invalidate(addresses ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.gens == nil {
+		c.gens = make(map[string]uint64)
+	}
+	for _, a := range addresses {
+		delete(c.entries, a)
+		c.gens[a]++
+	}
+}
+
+// invalidateBlock drops the cached reports of every address that sends
+// or receives in b.
+func (c *reportCache) invalidateBlock(b *blockchain.Block) {
+	c.invalidate(blockAddresses(b)...)
+}
+
+// reset drops every cached report.
+func (c *reportCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = nil
+	c.epoch++
+}
+
+// blockAddresses lists the addresses touched by the transactions of b.
+// Input addresses are derived from the spender's public key the same
+// way Wallet.GetAddress does.
+func blockAddresses(b *blockchain.Block) []string {
+	seen := make(map[string]bool)
+	var out []string
+	add := func(a string) {
+		if !seen[a] {
+			seen[a] = true
+			out = append(out, a)
+		}
+	}
+
+	for _, tx := range b.Transactions {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Vin {
+				add(blockchain.PubKeyAddress(in.PubKey))
+			}
+		}
+		for _, o := range tx.Vout {
+			add(blockchain.EncodeAddress(o.Owner()))
+		}
+	}
+	return out
+}
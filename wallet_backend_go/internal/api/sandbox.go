@@ -0,0 +1,257 @@
+package api
+
+// sandbox.go runs the sandbox deployment integrators test against. With
+// SANDBOX=true the server wipes the chain (back to genesis) and the
+// Supabase tables at startup and every night at SANDBOX_RESET_HOUR
+// (UTC), then re-seeds them with the fixtures of package sandbox: a
+// sandbox tenant, its users and wallets, and a few funded transfers.
+// GET /sandbox/info announces the schedule and the fixture identities.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/db"
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/sandbox"
+)
+
+// sandboxMode reports whether this deployment is a resettable sandbox.
+func sandboxMode() bool {
+	return strings.EqualFold(os.Getenv("SANDBOX"), "true")
+}
+
+// sandboxResetHour returns the UTC hour of the nightly reset.
+func sandboxResetHour() int {
+	h, err := strconv.Atoi(os.Getenv("SANDBOX_RESET_HOUR"))
+	if err != nil || h < 0 || h > 23 {
+		return 0
+	}
+	return h
+}
+
+// nextSandboxReset returns the first reset time after now.
+func nextSandboxReset(now time.Time) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), sandboxResetHour(), 0, 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// sandboxState tracks the resets of the sandbox.
+type sandboxState struct {
+	mu        sync.Mutex
+	lastReset time.Time
+	lastError string
+	nextReset time.Time
+}
+
+type sandboxFixtureView struct {
+	sandbox.User
+	Balance int `json:"balance"`
+}
+
+type sandboxInfoResponse struct {
+	Sandbox      bool                 `json:"sandbox"`
+	TenantID     string               `json:"tenant_id"`
+	ResetHourUTC int                  `json:"reset_hour_utc"`
+	LastResetAt  *time.Time           `json:"last_reset_at,omitempty"`
+	LastError    string               `json:"last_error,omitempty"`
+	NextResetAt  time.Time            `json:"next_reset_at"`
+	Height       int                  `json:"height"`
+	Fixtures     []sandboxFixtureView `json:"fixtures"`
+}
+
+// runSandbox seeds the sandbox and then resets it every night.
+func (s *Server) runSandbox() {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		err := s.resetSandbox(ctx)
+		cancel()
+
+		now := s.Clock.Now().UTC()
+		s.sandbox.mu.Lock()
+		s.sandbox.lastReset = now
+		s.sandbox.lastError = ""
+		if err != nil {
+			s.sandbox.lastError = err.Error()
+			log.Printf("sandbox reset failed: %v", err)
+		}
+		s.sandbox.nextReset = nextSandboxReset(now)
+		next := s.sandbox.nextReset
+		s.sandbox.mu.Unlock()
+
+		time.Sleep(next.Sub(s.Clock.Now()))
+	}
+}
+
+// resetSandbox wipes the chain and Supabase and re-seeds the fixtures.
+func (s *Server) resetSandbox(ctx context.Context) error {
+	users, err := sandbox.Users()
+	if err != nil {
+		return err
+	}
+
+	// Rebuild the chain first so the mined blocks can be persisted
+	// once the tables are empty.
+	s.chainMu.Lock()
+	if err := s.BC.Reset(); err != nil {
+		s.chainMu.Unlock()
+		return err
+	}
+	_ = s.UTXO.Reindex()
+
+	var funding []*blockchain.Transaction
+	for _, u := range users {
+		if u.Funded {
+			funding = append(funding, blockchain.NewCoinbaseTx(u.WalletAddress, "sandbox_funding"))
+		}
+	}
+	if len(funding) > 0 {
+		s.BC.AddBlock(funding)
+		_ = s.UTXO.Reindex()
+	}
+
+	for _, t := range sandbox.Transfers() {
+		from, to := users[t.From], users[t.To]
+		priv, err := blockchain.PrivateKeyFromHex(from.PrivateKeyHex)
+		if err != nil {
+			s.chainMu.Unlock()
+			return err
+		}
+		pubKeyHash, _ := blockchain.DecodeAddress(from.WalletAddress)
+
+		acc, spendable := s.UTXO.FindSpendableOutputs(pubKeyHash, t.Amount)
+		tx, err := blockchain.NewUTXOTransaction(*priv, to.WalletAddress, t.Amount, s.BC, spendable, pubKeyHash, acc)
+		if err != nil {
+			s.chainMu.Unlock()
+			return fmt.Errorf("fixture transfer %s -> %s: %w", from.Email, to.Email, err)
+		}
+		s.BC.AddBlock([]*blockchain.Transaction{tx})
+		_ = s.UTXO.Reindex()
+	}
+	blocks := append([]*blockchain.Block(nil), s.BC.Blocks...)
+	s.chainMu.Unlock()
+
+	s.reports.reset()
+	s.annualReports.reset()
+
+	if s.DB == nil {
+		return nil
+	}
+
+	if err := s.DB.WipeSandboxData(ctx); err != nil {
+		return err
+	}
+
+	now := s.Clock.Now().UTC()
+	if err := s.DB.CreateTenant(ctx, &models.Tenant{ID: sandbox.TenantID, Name: sandbox.TenantName, CreatedAt: now}); err != nil {
+		return err
+	}
+	for _, u := range users {
+		user := &models.User{
+			ID:        u.ID,
+			TenantID:  sandbox.TenantID,
+			FullName:  u.FullName,
+			Email:     u.Email,
+			CNIC:      u.CNIC,
+			Role:      models.RoleUser,
+			CreatedAt: now,
+		}
+		if err := s.DB.CreateUser(ctx, user); err != nil {
+			return err
+		}
+		sealed, err := s.sealWalletKey(u.WalletAddress, u.PrivateKeyHex)
+		if err != nil {
+			return err
+		}
+		wp := &models.WalletProfile{
+			ID:                  u.ID,
+			UserID:              u.ID,
+			TenantID:            sandbox.TenantID,
+			WalletAddress:       u.WalletAddress,
+			PublicKeyHex:        u.PublicKeyHex,
+			EncryptedPrivateKey: sealed,
+			Status:              models.WalletStatusActive,
+			CreatedAt:           now,
+		}
+		if err := s.DB.CreateWalletProfile(ctx, wp); err != nil {
+			return err
+		}
+	}
+
+	batch := db.NewBatch(s.DB)
+	for height, b := range blocks {
+		if err := batch.AddBlock(ctx, height, b); err != nil {
+			return err
+		}
+		if height == 0 {
+			continue
+		}
+		hash := fmt.Sprintf("%x", b.Hash)
+		for _, tx := range b.Transactions {
+			sender, receiver, amount, typ := txParties(tx)
+			if err := batch.AddTransaction(ctx, hash, tx, sender, receiver, amount, typ); err != nil {
+				return err
+			}
+		}
+	}
+	if err := batch.Flush(ctx); err != nil {
+		return err
+	}
+
+	s.logEvent(ctx, "info", "sandbox_reset",
+		fmt.Sprintf("sandbox re-seeded with %d users and %d blocks", len(users), len(blocks)),
+		"sandbox",
+	)
+	return nil
+}
+
+// SandboxInfo announces the reset schedule and the fixture identities.
+func (s *Server) SandboxInfo(w http.ResponseWriter, r *http.Request) {
+	users, err := sandbox.Users()
+	if err != nil {
+		httpError(w, r, "failed to load sandbox fixtures", http.StatusInternalServerError)
+		return
+	}
+
+	s.sandbox.mu.Lock()
+	resp := sandboxInfoResponse{
+		Sandbox:      true,
+		TenantID:     sandbox.TenantID,
+		ResetHourUTC: sandboxResetHour(),
+		LastError:    s.sandbox.lastError,
+		NextResetAt:  s.sandbox.nextReset,
+		Fixtures:     make([]sandboxFixtureView, 0, len(users)),
+	}
+	if !s.sandbox.lastReset.IsZero() {
+		last := s.sandbox.lastReset
+		resp.LastResetAt = &last
+	}
+	s.sandbox.mu.Unlock()
+	if resp.NextResetAt.IsZero() {
+		resp.NextResetAt = nextSandboxReset(s.Clock.Now().UTC())
+	}
+
+	s.chainMu.Lock()
+	resp.Height = len(s.BC.Blocks) - 1
+	s.chainMu.Unlock()
+
+	for _, u := range users {
+		balance, _, _ := s.balanceForAddress(u.WalletAddress)
+		resp.Fixtures = append(resp.Fixtures, sandboxFixtureView{User: u, Balance: balance})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
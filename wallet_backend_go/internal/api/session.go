@@ -0,0 +1,187 @@
+package api
+
+// session.go issues and checks session tokens: HS256 JSON Web Tokens
+// signed with SESSION_SECRET that carry the user id, tenant and the
+// authentication method ("otp" or "webauthn"). OTP verification and
+// passkey login return one; clients send it back as
+// "Authorization: Bearer <token>" on routes wrapped in requireSession.
+// Without SESSION_SECRET a random key is generated at startup, so
+// sessions neither survive a restart nor work across instances.
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wallet_backend_go/internal/models"
+)
+
+const defaultSessionTTL = 12 * time.Hour
+
+// Authentication methods recorded in sessions.
+const (
+	authMethodOTP      = "otp"
+	authMethodWebAuthn = "webauthn"
+)
+
+// jwtHeader is the only header issued and accepted.
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+type sessionClaims struct {
+	Subject  string   `json:"sub"` // user id
+	TenantID string   `json:"tid,omitempty"`
+	Methods  []string `json:"amr"`
+	IssuedAt int64    `json:"iat"`
+	Expires  int64    `json:"exp"`
+}
+
+type sessionResponse struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UserID    string    `json:"user_id"`
+}
+
+type sessionCtxKey struct{}
+
+// sessionKeeper holds the signing key, loaded on first use.
+type sessionKeeper struct {
+	once sync.Once
+	key  []byte
+}
+
+func (k *sessionKeeper) secret() []byte {
+	k.once.Do(func() {
+		if secret := os.Getenv("SESSION_SECRET"); secret != "" {
+			k.key = []byte(secret)
+			return
+		}
+		k.key = make([]byte, 32)
+		if _, err := rand.Read(k.key); err != nil {
+			panic(err)
+		}
+		log.Println("warning: SESSION_SECRET not set, sessions are signed with a temporary key")
+	})
+	return k.key
+}
+
+// sessionTTL is how long a session token is valid
+// (SESSION_TTL_MINUTES, default 720).
+func sessionTTL() time.Duration {
+	if n, err := strconv.Atoi(os.Getenv("SESSION_TTL_MINUTES")); err == nil && n > 0 {
+		return time.Duration(n) * time.Minute
+	}
+	return defaultSessionTTL
+}
+
+func (s *Server) signSession(payload string) string {
+	mac := hmac.New(sha256.New, s.sessions.secret())
+	mac.Write([]byte(jwtHeader + "." + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// issueSession returns a session token for u.
+func (s *Server) issueSession(u *models.User, method string) (*sessionResponse, error) {
+	now := s.Clock.Now()
+	expires := now.Add(sessionTTL())
+	claims := sessionClaims{
+		Subject:  u.ID,
+		TenantID: u.TenantID,
+		Methods:  []string{method},
+		IssuedAt: now.Unix(),
+		Expires:  expires.Unix(),
+	}
+	raw, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	return &sessionResponse{
+		Token:     jwtHeader + "." + payload + "." + s.signSession(payload),
+		TokenType: "Bearer",
+		ExpiresAt: time.Unix(claims.Expires, 0).UTC(),
+		UserID:    u.ID,
+	}, nil
+}
+
+var errInvalidSession = errors.New("invalid session token")
+
+// parseSession checks a token's signature and expiry.
+func (s *Server) parseSession(token string) (*sessionClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return nil, errInvalidSession
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidSession
+	}
+	want, _ := base64.RawURLEncoding.DecodeString(s.signSession(parts[1]))
+	if !hmac.Equal(sig, want) {
+		return nil, errInvalidSession
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errInvalidSession
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(raw, &claims); err != nil || claims.Subject == "" {
+		return nil, errInvalidSession
+	}
+	if s.Clock.Now().Unix() >= claims.Expires {
+		return nil, errInvalidSession
+	}
+	return &claims, nil
+}
+
+// requireSession lets only requests with a valid session token through
+// to next, which can read the claims with sessionFrom.
+func (s *Server) requireSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="session"`)
+			httpError(w, r, "session required", http.StatusUnauthorized)
+			return
+		}
+		claims, err := s.parseSession(token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="session", error="invalid_token"`)
+			httpError(w, r, "invalid or expired session", http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), sessionCtxKey{}, claims)))
+	}
+}
+
+// requireSessionOrAdmin is requireSession for requests carrying a
+// session token and requireAdmin for the others. next tells them apart
+// with sessionFrom.
+func (s *Server) requireSessionOrAdmin(next http.HandlerFunc) http.HandlerFunc {
+	session, admin := s.requireSession(next), s.requireAdmin(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if _, err := s.parseSession(token); err == nil {
+			session(w, r)
+			return
+		}
+		admin(w, r)
+	}
+}
+
+// sessionFrom returns the session authenticated by requireSession.
+func sessionFrom(ctx context.Context) *sessionClaims {
+	claims, _ := ctx.Value(sessionCtxKey{}).(*sessionClaims)
+	return claims
+}
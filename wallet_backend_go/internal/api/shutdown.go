@@ -0,0 +1,73 @@
+package api
+
+// shutdown.go finishes the work a stopping server still holds once the
+// HTTP server has stopped taking requests, so that nothing a client was
+// told about is lost: the sends queued in the mempool are mined, the
+// queued background jobs run, the Supabase writes of mined blocks
+// complete and the shipped logs are sent. Then the chain's storage is
+// closed.
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// Shutdown drains the server's pending work and closes the chain's
+// storage, after which no block can be mined. It stops waiting when
+// ctx is done and then returns ctx's error; the storage is closed
+// either way.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.mempool != nil {
+		for s.mempool.Pending() > 0 && ctx.Err() == nil {
+			if !s.mineMempool() {
+				log.Printf("shutdown: %d queued sends not mined", s.mempool.Pending())
+				break
+			}
+		}
+	}
+
+	// the worker runs jobs in order, so once this one runs the jobs
+	// queued before it have run
+	if !s.readOnly {
+		drained := make(chan struct{})
+		select {
+		case s.jobs <- backgroundJob{Name: "shutdown", Run: func(context.Context) error {
+			close(drained)
+			return nil
+		}}:
+			waitFor(ctx, drained)
+		case <-ctx.Done():
+		}
+	}
+
+	written := make(chan struct{})
+	go func() {
+		s.persistence.writing.Wait()
+		close(written)
+	}()
+	waitFor(ctx, written)
+
+	s.logShipper.Close(ctx)
+
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+	var err error
+	if st := s.BC.Store; st != nil {
+		if cerr := st.Close(); cerr != nil {
+			err = fmt.Errorf("close chain storage: %w", cerr)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// waitFor waits until done is closed or ctx is done.
+func waitFor(ctx context.Context, done <-chan struct{}) {
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,269 @@
+package api
+
+// solvency.go publishes proof-of-solvency epochs for the zakat pool. An
+// administrator commits the allocations pledged to beneficiaries; the
+// server puts them into a Merkle-sum tree (see package solvency),
+// records the pool's on-chain holdings and the UTXO set root at the same
+// height, and stores the epoch. The root and totals are public, and each
+// beneficiary can fetch the inclusion proof of their own allocation.
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/solvency"
+)
+
+type allocationRequest struct {
+	BeneficiaryID string `json:"beneficiary_id"`
+	Amount        int    `json:"amount"`
+}
+
+type solvencyEpochRequest struct {
+	Allocations []allocationRequest `json:"allocations"`
+}
+
+// solvencyEpochView is the public part of an epoch; the leaves stay
+// private so beneficiaries only see their own allocation.
+type solvencyEpochView struct {
+	ID               string    `json:"id"`
+	TenantID         string    `json:"tenant_id,omitempty"`
+	PoolAddress      string    `json:"pool_address"`
+	PoolHoldings     int       `json:"pool_holdings"`
+	TotalLiabilities int       `json:"total_liabilities"`
+	RootHash         string    `json:"root_hash"`
+	Solvent          bool      `json:"solvent"`
+	Height           int       `json:"height"`
+	UTXORoot         string    `json:"utxo_root"`
+	LeafCount        int       `json:"leaf_count"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+type proofStepView struct {
+	Hash string `json:"hash"`
+	Sum  int    `json:"sum"`
+	Left bool   `json:"left"`
+}
+
+type solvencyProofResponse struct {
+	EpochID          string              `json:"epoch_id"`
+	RootHash         string              `json:"root_hash"`
+	TotalLiabilities int                 `json:"total_liabilities"`
+	Leaf             models.SolvencyLeaf `json:"leaf"`
+	Path             []proofStepView     `json:"path"`
+}
+
+func epochView(e *models.SolvencyEpoch) solvencyEpochView {
+	return solvencyEpochView{
+		ID:               e.ID,
+		TenantID:         e.TenantID,
+		PoolAddress:      e.PoolAddress,
+		PoolHoldings:     e.PoolHoldings,
+		TotalLiabilities: e.TotalLiabilities,
+		RootHash:         e.RootHash,
+		Solvent:          e.Solvent,
+		Height:           e.Height,
+		UTXORoot:         e.UTXORoot,
+		LeafCount:        len(e.Leaves),
+		CreatedAt:        e.CreatedAt,
+	}
+}
+
+func solvencyLeaves(e *models.SolvencyEpoch) []solvency.Leaf {
+	leaves := make([]solvency.Leaf, len(e.Leaves))
+	for i, l := range e.Leaves {
+		leaves[i] = solvency.Leaf{ID: l.BeneficiaryID, Amount: uint64(l.Amount), Salt: l.Salt}
+	}
+	return leaves
+}
+
+// CreateSolvencyEpoch commits the given allocations and the pool's
+// current holdings as a new epoch, on behalf of an admin.
+func (s *Server) CreateSolvencyEpoch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tenant := tenantID(ctx)
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req solvencyEpochRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	epoch := &models.SolvencyEpoch{
+		ID:        uuid.NewString(),
+		TenantID:  tenant,
+		Leaves:    []models.SolvencyLeaf{},
+		CreatedAt: s.Clock.Now().UTC(),
+	}
+
+	seen := make(map[string]bool)
+	for _, a := range req.Allocations {
+		if a.BeneficiaryID == "" || a.Amount <= 0 {
+			httpError(w, r, "each allocation needs a beneficiary_id and a positive amount", http.StatusBadRequest)
+			return
+		}
+		if seen[a.BeneficiaryID] {
+			httpError(w, r, "duplicate beneficiary in allocations", http.StatusBadRequest)
+			return
+		}
+		seen[a.BeneficiaryID] = true
+
+		b, err := s.DB.GetBeneficiary(ctx, a.BeneficiaryID)
+		if err != nil {
+			httpError(w, r, "failed to load beneficiary", http.StatusInternalServerError)
+			s.logEvent(ctx, "error", "beneficiary_get_failed", err.Error(), r.RemoteAddr)
+			return
+		}
+		if b == nil || (tenant != "" && b.TenantID != tenant) {
+			httpError(w, r, "beneficiary not found", http.StatusNotFound)
+			return
+		}
+
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			httpError(w, r, "failed to create solvency epoch", http.StatusInternalServerError)
+			return
+		}
+		epoch.Leaves = append(epoch.Leaves, models.SolvencyLeaf{
+			BeneficiaryID: a.BeneficiaryID,
+			Amount:        a.Amount,
+			Salt:          hex.EncodeToString(salt),
+		})
+		epoch.TotalLiabilities += a.Amount
+	}
+
+	pool, err := s.zakatAddressFor(ctx, tenant)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	poolHash, _ := blockchain.DecodeAddress(pool)
+	epoch.PoolAddress = pool
+
+	// holdings and the UTXO root are taken at the same height
+	s.chainMu.Lock()
+	epoch.Height = len(s.BC.Blocks) - 1
+	unspent := s.UTXO.UnspentOutputs()
+	s.chainMu.Unlock()
+
+	utxoLeaves := make([][]byte, 0, len(unspent))
+	for _, u := range unspent {
+		utxoLeaves = append(utxoLeaves, blockchain.UTXOLeaf(u.TxID, u.Vout, u.Output))
+		if u.Output.IsLockedWith(poolHash) {
+			epoch.PoolHoldings += u.Output.Value
+		}
+	}
+	epoch.UTXORoot = fmt.Sprintf("%x", blockchain.MerkleRoot(utxoLeaves))
+
+	root := solvency.Root(solvencyLeaves(epoch))
+	epoch.RootHash = fmt.Sprintf("%x", root.Hash)
+	epoch.Solvent = epoch.PoolHoldings >= epoch.TotalLiabilities
+
+	if err := s.DB.CreateSolvencyEpoch(ctx, epoch); err != nil {
+		httpError(w, r, "failed to create solvency epoch", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "solvency_epoch_create_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	level, typ := "info", "solvency_epoch"
+	if !epoch.Solvent {
+		level, typ = "warn", "solvency_shortfall"
+	}
+	s.logEvent(ctx, level, typ,
+		fmt.Sprintf("epoch %s: holdings %d, liabilities %d, root %s, by %s", epoch.ID, epoch.PoolHoldings, epoch.TotalLiabilities, epoch.RootHash, adminName(ctx)),
+		r.RemoteAddr,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(epochView(epoch))
+}
+
+// loadSolvencyEpoch fetches an epoch (or "latest") of the requesting
+// tenant, writing the error response itself on failure.
+func (s *Server) loadSolvencyEpoch(w http.ResponseWriter, r *http.Request) *models.SolvencyEpoch {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return nil
+	}
+
+	epoch, err := s.DB.GetSolvencyEpoch(ctx, tenantID(ctx), mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, "failed to load solvency epoch", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "solvency_epoch_get_failed", err.Error(), r.RemoteAddr)
+		return nil
+	}
+	if epoch == nil || (tenantID(ctx) != "" && epoch.TenantID != tenantID(ctx)) {
+		httpError(w, r, "solvency epoch not found", http.StatusNotFound)
+		return nil
+	}
+	return epoch
+}
+
+// GetSolvencyEpoch publishes the root and totals of an epoch.
+func (s *Server) GetSolvencyEpoch(w http.ResponseWriter, r *http.Request) {
+	epoch := s.loadSolvencyEpoch(w, r)
+	if epoch == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(epochView(epoch))
+}
+
+// GetSolvencyProof returns the inclusion proof of a beneficiary's
+// allocation in an epoch.
+func (s *Server) GetSolvencyProof(w http.ResponseWriter, r *http.Request) {
+	epoch := s.loadSolvencyEpoch(w, r)
+	if epoch == nil {
+		return
+	}
+
+	beneficiaryID := mux.Vars(r)["beneficiaryID"]
+	index := -1
+	for i, l := range epoch.Leaves {
+		if l.BeneficiaryID == beneficiaryID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		httpError(w, r, "allocation not found", http.StatusNotFound)
+		return
+	}
+
+	path, err := solvency.Prove(solvencyLeaves(epoch), index)
+	if err != nil {
+		httpError(w, r, "allocation not found", http.StatusNotFound)
+		return
+	}
+
+	resp := solvencyProofResponse{
+		EpochID:          epoch.ID,
+		RootHash:         epoch.RootHash,
+		TotalLiabilities: epoch.TotalLiabilities,
+		Leaf:             epoch.Leaves[index],
+		Path:             make([]proofStepView, 0, len(path)),
+	}
+	for _, step := range path {
+		resp.Path = append(resp.Path, proofStepView{Hash: fmt.Sprintf("%x", step.Hash), Sum: int(step.Sum), Left: step.Left})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,294 @@
+package api
+
+// stealth.go lets beneficiaries receive to one-time (stealth)
+// addresses. For every payment request a fresh address is derived from
+// the wallet's public key, so donors paying different requests cannot
+// tell from the explorer that the payments reach the same wallet, nor
+// look up the wallet's other income from the address they paid. The
+// wallet finds its payments by scanning the published requests with its
+// private key and claims them into its own address.
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+)
+
+const maxStealthMemo = 140 // characters
+
+type stealthRequestRequest struct {
+	PublicKey string `json:"public_key"` // hex X||Y, 64 bytes
+	Amount    int    `json:"amount"`
+	Memo      string `json:"memo"`
+}
+
+type stealthScanRequest struct {
+	PrivKey string `json:"private_key"`
+}
+
+type stealthClaimRequest struct {
+	PrivKey string `json:"private_key"`
+	PIN     string `json:"pin"`
+}
+
+// stealthPayment is a payment request the scanning wallet owns.
+type stealthPayment struct {
+	models.StealthPaymentRequest
+	Balance int    `json:"balance"`
+	PrivKey string `json:"private_key"` // one-time key, spends the address
+}
+
+type stealthScanResponse struct {
+	Payments []stealthPayment `json:"payments"`
+	Total    int              `json:"total"`
+}
+
+type stealthClaimed struct {
+	Address string `json:"address"`
+	Amount  int    `json:"amount"`
+	Txid    string `json:"txid"`
+}
+
+type stealthClaimResponse struct {
+	To        string           `json:"to"`
+	Claimed   []stealthClaimed `json:"claimed"`
+	Total     int              `json:"total"`
+	BlockHash string           `json:"block_hash"`
+}
+
+// CreateStealthRequest derives a one-time address for a payment to the
+// wallet with the given public key and publishes its ephemeral key.
+func (s *Server) CreateStealthRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req stealthRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	raw, err := hex.DecodeString(req.PublicKey)
+	if err != nil {
+		httpError(w, r, "invalid public key", http.StatusBadRequest)
+		return
+	}
+	pub, err := blockchain.ParsePublicKey(raw)
+	if err != nil {
+		httpError(w, r, "invalid public key", http.StatusBadRequest)
+		return
+	}
+	if req.Amount < 0 {
+		httpError(w, r, "amount must not be negative", http.StatusBadRequest)
+		return
+	}
+	req.Memo = strings.TrimSpace(req.Memo)
+	if utf8.RuneCountInString(req.Memo) > maxStealthMemo {
+		httpError(w, r, "memo is too long", http.StatusBadRequest)
+		return
+	}
+
+	address, ephemeral, err := blockchain.NewStealthAddress(pub, s.Entropy)
+	if err != nil {
+		httpError(w, r, "failed to create payment request", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "stealth_request_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	sr := &models.StealthPaymentRequest{
+		ID:                 uuid.New().String(),
+		TenantID:           tenantID(ctx),
+		Address:            address,
+		EphemeralPublicKey: hex.EncodeToString(ephemeral),
+		Amount:             req.Amount,
+		Memo:               req.Memo,
+		CreatedAt:          s.Clock.Now().UTC(),
+	}
+	if err := s.DB.CreateStealthRequest(ctx, sr); err != nil {
+		httpError(w, r, "failed to create payment request", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "stealth_request_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	// the log names the one-time address only, never the wallet
+	s.logEvent(ctx, "info", "stealth_request_created", "payment request for one-time address "+address, r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(sr)
+}
+
+// scanStealth returns the tenant's payment requests that belong to
+// priv, with their balances and one-time keys. It writes the error
+// response itself and returns false when it cannot.
+func (s *Server) scanStealth(w http.ResponseWriter, r *http.Request, privHex string) ([]stealthPayment, bool) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return nil, false
+	}
+	dBytes, err := hex.DecodeString(privHex)
+	if err != nil || len(dBytes) == 0 {
+		httpError(w, r, "invalid private key", http.StatusBadRequest)
+		return nil, false
+	}
+	priv := blockchain.BigIntToPrivateKey(dBytes, blockchain.GetDefaultCurve())
+
+	requests, err := s.DB.ListStealthRequests(ctx, tenantID(ctx))
+	if err != nil {
+		httpError(w, r, "failed to load payment requests", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "stealth_list_failed", err.Error(), r.RemoteAddr)
+		return nil, false
+	}
+
+	payments := []stealthPayment{}
+	for _, sr := range requests {
+		ephemeral, err := hex.DecodeString(sr.EphemeralPublicKey)
+		if err != nil {
+			continue
+		}
+		key, err := blockchain.StealthPrivateKey(&priv, ephemeral)
+		if err != nil || blockchain.AddressOf(&key.PublicKey) != sr.Address {
+			continue // someone else's
+		}
+		balance, _, err := s.balanceForAddress(sr.Address)
+		if err != nil {
+			continue
+		}
+		payments = append(payments, stealthPayment{
+			StealthPaymentRequest: sr,
+			Balance:               balance,
+			PrivKey:               blockchain.PrivateKeyToHex(key),
+		})
+	}
+	return payments, true
+}
+
+// ScanStealth lists the payment requests of the wallet whose private
+// key is given, with what each one-time address holds.
+func (s *Server) ScanStealth(w http.ResponseWriter, r *http.Request) {
+	var req stealthScanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	payments, ok := s.scanStealth(w, r, req.PrivKey)
+	if !ok {
+		return
+	}
+	resp := stealthScanResponse{Payments: payments}
+	for _, p := range payments {
+		resp.Total += p.Balance
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// walletAddressOf returns the address of the wallet of pub: its legacy
+// address if a wallet was registered under it, the canonical one
+// otherwise.
+func (s *Server) walletAddressOf(ctx context.Context, pub *ecdsa.PublicKey) string {
+	addrs := blockchain.AddressesOf(pub)
+	if s.DB != nil {
+		for _, a := range addrs[1:] {
+			if wp, err := s.DB.GetWalletProfileByAddress(ctx, a); err == nil && wp != nil {
+				return a
+			}
+		}
+	}
+	return addrs[0]
+}
+
+// ClaimStealth sweeps every funded one-time address of the wallet into
+// the wallet's own address. Each address is spent by a transaction of
+// its own, so the claim does not join them in one transaction's inputs;
+// all are mined in one block.
+func (s *Server) ClaimStealth(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req stealthClaimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	payments, ok := s.scanStealth(w, r, req.PrivKey)
+	if !ok {
+		return
+	}
+	dBytes, _ := hex.DecodeString(req.PrivKey) // checked by scanStealth
+	priv := blockchain.BigIntToPrivateKey(dBytes, blockchain.GetDefaultCurve())
+	to := s.walletAddressOf(ctx, &priv.PublicKey)
+	if !s.requireTransactionPIN(w, r, to, req.PIN) {
+		return
+	}
+
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+
+	resp := stealthClaimResponse{To: to, Claimed: []stealthClaimed{}}
+	var txs []*blockchain.Transaction
+	reserved := s.reservedOutputs()
+	for _, p := range payments {
+		key, err := blockchain.PrivateKeyFromHex(p.PrivKey)
+		if err != nil {
+			continue
+		}
+		pubKeyHash, _ := blockchain.DecodeAddress(p.Address)
+		// spend everything the address holds
+		amount, spendable := s.UTXO.FindSpendableOutputsExcluding(pubKeyHash, p.Balance, reserved)
+		if amount <= 0 {
+			continue
+		}
+		tx, err := blockchain.NewUTXOTransaction(*key, to, amount, s.BC, spendable, pubKeyHash, amount)
+		if err != nil || !s.BC.VerifyTransaction(tx) {
+			httpError(w, r, "failed to create transaction", http.StatusInternalServerError)
+			s.logEvent(ctx, "error", "stealth_claim_failed", fmt.Sprintf("claim from %s: %v", p.Address, err), r.RemoteAddr)
+			return
+		}
+		if err := s.BC.CheckPolicy(ctx, tx); err != nil {
+			policyError(w, r, err)
+			return
+		}
+		txs = append(txs, tx)
+		noteAuditTx(ctx, tx.ID)
+		resp.Claimed = append(resp.Claimed, stealthClaimed{Address: p.Address, Amount: amount, Txid: fmt.Sprintf("%x", tx.ID)})
+		resp.Total += amount
+	}
+	if len(txs) == 0 {
+		httpError(w, r, "nothing to claim", http.StatusBadRequest)
+		return
+	}
+
+	newBlock, err := s.BC.AddBlockContext(ctx, txs)
+	if err != nil {
+		mineError(w, r, err)
+		return
+	}
+	height := len(s.BC.Blocks) - 1
+	s.reports.invalidateBlock(newBlock)
+	_ = s.UTXO.Reindex()
+	resp.BlockHash = fmt.Sprintf("%x", newBlock.Hash)
+	s.persistMinedBlock(newBlock, height, txs, "stealth_claim")
+
+	s.logEvent(ctx, "info", "stealth_claimed",
+		fmt.Sprintf("%d claimed from %d one-time addresses into %s", resp.Total, len(txs), to), r.RemoteAddr)
+	s.maybeAutoZakat(to, resp.Total)
+	s.notifyIncomingFunds(to, resp.Total)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
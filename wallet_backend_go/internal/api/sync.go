@@ -0,0 +1,134 @@
+package api
+
+// sync.go serves incremental wallet updates to mobile clients. A client
+// remembers the chain height it last synced to and asks only for what
+// changed after it, instead of re-downloading the full history.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+)
+
+// syncTransaction is the wallet-centric view of a transaction mined
+// after the client's height.
+type syncTransaction struct {
+	Txid        string `json:"txid"`
+	BlockHeight int    `json:"block_height"`
+	BlockHash   string `json:"block_hash"`
+	Timestamp   int64  `json:"timestamp"`
+	Received    int    `json:"received"`
+	Sent        int    `json:"sent"`
+}
+
+type walletSyncResponse struct {
+	WalletAddress string               `json:"wallet_address"`
+	SinceHeight   int                  `json:"since_height"`
+	Height        int                  `json:"height"`
+	Balance       int                  `json:"balance"`
+	BalanceDelta  int                  `json:"balance_delta"`
+	Transactions  []syncTransaction    `json:"transactions"`
+	ZakatRecords  []models.ZakatRecord `json:"zakat_records"`
+}
+
+// SyncWallet returns the transactions, zakat records and balance change
+// of a wallet in blocks above since_height. Omitting since_height (or
+// passing -1) returns everything, for a first sync.
+func (s *Server) SyncWallet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	address := mux.Vars(r)["address"]
+
+	since := -1
+	if v := r.URL.Query().Get("since_height"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < -1 {
+			httpError(w, r, "invalid since_height", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	balance, pubKeyHash, err := s.balanceForAddress(address)
+	if err != nil {
+		httpError(w, r, "invalid address", http.StatusBadRequest)
+		return
+	}
+
+	blocks := s.BC.Blocks
+	height := len(blocks) - 1
+	if since > height {
+		httpError(w, r, "since_height is above the chain height", http.StatusBadRequest)
+		return
+	}
+
+	resp := walletSyncResponse{
+		WalletAddress: address,
+		SinceHeight:   since,
+		Height:        height,
+		Balance:       balance,
+		Transactions:  []syncTransaction{},
+		ZakatRecords:  []models.ZakatRecord{},
+	}
+
+	newBlocks := make(map[string]bool)
+	for h := since + 1; h <= height; h++ {
+		b := blocks[h]
+		newBlocks[fmt.Sprintf("%x", b.Hash)] = true
+
+		for _, tx := range b.Transactions {
+			st := syncTransaction{
+				Txid:        fmt.Sprintf("%x", tx.ID),
+				BlockHeight: h,
+				BlockHash:   fmt.Sprintf("%x", b.Hash),
+				Timestamp:   b.Timestamp,
+			}
+
+			if !tx.IsCoinbase() {
+				for _, in := range tx.Vin {
+					prev, err := s.BC.FindTransaction(in.Txid)
+					if err != nil || in.Vout < 0 || in.Vout >= len(prev.Vout) {
+						continue
+					}
+					if out := prev.Vout[in.Vout]; out.IsLockedWith(pubKeyHash) {
+						st.Sent += out.Value
+					}
+				}
+			}
+			for _, out := range tx.Vout {
+				if out.IsLockedWith(pubKeyHash) {
+					st.Received += out.Value
+				}
+			}
+
+			if st.Sent == 0 && st.Received == 0 {
+				continue
+			}
+			resp.BalanceDelta += st.Received - st.Sent
+			resp.Transactions = append(resp.Transactions, st)
+		}
+	}
+
+	// zakat records are matched to the new blocks by block hash
+	if s.DB != nil && len(resp.Transactions) > 0 {
+		records, err := s.DB.ListZakatByWallet(ctx, blockchain.EncodeAddress(pubKeyHash))
+		if err != nil {
+			httpError(w, r, "failed to list zakat records", http.StatusInternalServerError)
+			s.logEvent(ctx, "error", "wallet_sync_list_zakat_failed", err.Error(), r.RemoteAddr)
+			return
+		}
+		for _, zr := range records {
+			if newBlocks[zr.BlockHash] {
+				resp.ZakatRecords = append(resp.ZakatRecords, zr)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
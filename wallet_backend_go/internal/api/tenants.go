@@ -0,0 +1,278 @@
+package api
+
+// tenants.go adds the organization (tenant) dimension that lets several
+// mosques or charities share one deployment. The tenant of a request is
+// stored in the request context; handlers pass it to the db layer so
+// queries and zakat runs only see that tenant's rows. It comes from the
+// credentials of the request: a session is scoped to its user's tenant
+// and an admin key to the tenant ADMIN_TENANTS binds it to, and an
+// X-Tenant-ID header naming another tenant is refused. Only admins of
+// the whole deployment and requests without credentials (registration,
+// public pages) pick the tenant with the header; without it they run
+// unscoped, which keeps single-organization deployments working
+// unchanged.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+)
+
+// tenantHeader carries the tenant id on incoming requests.
+const tenantHeader = "X-Tenant-ID"
+
+type tenantCtxKey struct{}
+
+type createTenantRequest struct {
+	Name               string `json:"name"`
+	ZakatWalletAddress string `json:"zakat_wallet_address"`
+}
+
+type setRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type tenantsResponse struct {
+	Tenants []models.Tenant `json:"tenants"`
+}
+
+// withTenant stores the tenant of the request in its context: that of
+// its session or tenant-bound admin key, else the X-Tenant-ID header.
+func (s *Server) withTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, bound := s.credentialTenant(r)
+		if header := r.Header.Get(tenantHeader); header != "" && header != id {
+			if bound {
+				httpError(w, r, "tenant does not match your credentials", http.StatusForbidden)
+				return
+			}
+			id = header
+		}
+		if id != "" {
+			r = r.WithContext(context.WithValue(r.Context(), tenantCtxKey{}, id))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// credentialTenant returns the tenant the bearer token of r is bound
+// to. bound is false for requests without a valid session or admin key
+// and for admins of the whole deployment, who may choose the tenant.
+func (s *Server) credentialTenant(r *http.Request) (tenant string, bound bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+	if claims, err := s.parseSession(token); err == nil {
+		return claims.TenantID, true
+	}
+	if tenant := adminTenant(adminFor(s.allAdminKeys(), r)); tenant != "" {
+		return tenant, true
+	}
+	return "", false
+}
+
+// tenantID returns the tenant of the current request, or "" if unscoped.
+func tenantID(ctx context.Context) string {
+	id, _ := ctx.Value(tenantCtxKey{}).(string)
+	return id
+}
+
+// zakatAddressFor resolves the zakat pool address of a tenant, falling
+// back to ZAKAT_WALLET_ADDRESS when the tenant has none configured. A
+// pool configured by its hex address is returned in the current
+// encoding, as the chain reports it.
+func (s *Server) zakatAddressFor(ctx context.Context, tenant string) (string, error) {
+	if tenant != "" && s.DB != nil {
+		t, err := s.DB.GetTenant(ctx, tenant)
+		if err != nil {
+			return "", err
+		}
+		if t == nil {
+			return "", fmt.Errorf("unknown tenant %s", tenant)
+		}
+		if t.ZakatWalletAddress != "" {
+			return blockchain.CanonicalAddress(t.ZakatWalletAddress), nil
+		}
+	}
+
+	addr := os.Getenv("ZAKAT_WALLET_ADDRESS")
+	if addr == "" {
+		return "", fmt.Errorf("ZAKAT_WALLET_ADDRESS not set")
+	}
+	return blockchain.CanonicalAddress(addr), nil
+}
+
+// requireTenantAdmin lets through to next the admins of the tenant in
+// the path: a session of one of its users holding the tenant_admin
+// role, or an admin key of the whole deployment or bound to it.
+func (s *Server) requireTenantAdmin(next http.HandlerFunc) http.HandlerFunc {
+	admin := s.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		if tenant := adminTenant(adminName(r.Context())); tenant != "" && tenant != mux.Vars(r)["id"] {
+			s.denyAdmin(w, r, "admin access denied", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		claims, err := s.parseSession(token)
+		if err != nil {
+			admin(w, r)
+			return
+		}
+		ctx := r.Context()
+		if s.DB == nil {
+			httpError(w, r, "database not configured", http.StatusInternalServerError)
+			return
+		}
+		// the role is read from the user, not the session, so that a
+		// demotion applies at once
+		u, err := s.DB.GetUser(ctx, claims.Subject)
+		if err != nil {
+			httpError(w, r, "failed to load user", http.StatusInternalServerError)
+			s.logEvent(ctx, "error", "user_get_failed", err.Error(), r.RemoteAddr)
+			return
+		}
+		if u == nil || u.TenantID == "" || u.TenantID != mux.Vars(r)["id"] || u.Role != models.RoleTenantAdmin {
+			httpError(w, r, "tenant admin role required", http.StatusForbidden)
+			s.logEvent(ctx, "warn", "unauthorized_admin_access",
+				fmt.Sprintf("%s %s refused: user %s is not an admin of the tenant", r.Method, r.URL.Path, claims.Subject),
+				r.RemoteAddr)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(ctx, sessionCtxKey{}, claims)))
+	}
+}
+
+// tenantActor names who is acting on a tenant route, for the logs.
+func tenantActor(ctx context.Context) string {
+	if name := adminName(ctx); name != "" {
+		return "admin " + name
+	}
+	if claims := sessionFrom(ctx); claims != nil {
+		return "user " + claims.Subject
+	}
+	return "unknown"
+}
+
+// CreateTenant registers a new organization. Admins bound to a tenant
+// cannot create others.
+func (s *Server) CreateTenant(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if adminTenant(adminName(ctx)) != "" {
+		s.denyAdmin(w, r, "admin access denied", http.StatusForbidden)
+		return
+	}
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req createTenantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		httpError(w, r, "name is required", http.StatusBadRequest)
+		return
+	}
+	if req.ZakatWalletAddress != "" && !blockchain.ValidateAddress(req.ZakatWalletAddress) {
+		httpError(w, r, "invalid address", http.StatusBadRequest)
+		return
+	}
+
+	t := &models.Tenant{
+		ID:                 uuid.NewString(),
+		Name:               req.Name,
+		ZakatWalletAddress: req.ZakatWalletAddress,
+		CreatedAt:          s.Clock.Now().UTC(),
+	}
+
+	if err := s.DB.CreateTenant(ctx, t); err != nil {
+		httpError(w, r, "failed to create tenant", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "tenant_create_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	s.logEvent(ctx, "info", "tenant_created",
+		fmt.Sprintf("tenant %s (%s) created by %s", t.ID, t.Name, adminName(ctx)),
+		r.RemoteAddr,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(t)
+}
+
+// ListTenants returns all organizations hosted on this deployment.
+func (s *Server) ListTenants(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	tenants, err := s.DB.ListTenants(ctx)
+	if err != nil {
+		httpError(w, r, "failed to list tenants", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "tenant_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(tenantsResponse{Tenants: tenants})
+}
+
+// SetTenantUserRole promotes or demotes a user of the tenant between the
+// user and tenant_admin roles.
+func (s *Server) SetTenantUserRole(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	tenant, userID := vars["id"], vars["userID"]
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req setRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Role != models.RoleUser && req.Role != models.RoleTenantAdmin {
+		httpError(w, r, "role must be user or tenant_admin", http.StatusBadRequest)
+		return
+	}
+
+	found, err := s.DB.SetUserRole(ctx, tenant, userID, req.Role)
+	if err != nil {
+		httpError(w, r, "failed to update role", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "tenant_role_update_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if !found {
+		httpError(w, r, "user not found", http.StatusNotFound)
+		return
+	}
+
+	s.logEvent(ctx, "info", "tenant_role_updated",
+		fmt.Sprintf("user %s in tenant %s is now %s, set by %s", userID, tenant, req.Role, tenantActor(ctx)),
+		r.RemoteAddr,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"user_id": userID, "tenant_id": tenant, "role": req.Role})
+}
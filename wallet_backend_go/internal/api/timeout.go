@@ -0,0 +1,173 @@
+package api
+
+// timeout.go bounds how long a request may take. Reads get a short
+// deadline, other mutations a longer one and routes that mine blocks
+// (or run zakat, which mines one block per wallet) the longest. The
+// deadline is set on the request context, which mining and every
+// Supabase call honour, so the work of an abandoned request stops
+// instead of running on; the client gets 504 with a JSON error as soon
+// as the deadline passes.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/i18n"
+)
+
+const (
+	defaultReadTimeout   = 10 // seconds
+	defaultWriteTimeout  = 30
+	defaultMiningTimeout = 300
+)
+
+// miningRoutes are the routes that mine blocks, by method and path
+// template.
+var miningRoutes = map[string]bool{
+	"POST /api/v1/transactions":                      true,
+	"POST /api/v1/transactions/offline-batch":        true,
+	"POST /api/v1/transactions/submit":               true,
+	"POST /api/v1/admin/fund":                        true,
+	"POST /api/v1/faucet":                            true,
+	"POST /api/v1/zakat/run":                         true,
+	"POST /api/v1/zakat/runs/{id}/resume":            true,
+	"POST /api/v1/zakat/runs/{id}/confirm":           true,
+	"POST /api/v1/admin/selfcheck":                   true,
+	"POST /api/v1/stealth/claim":                     true,
+	"POST /api/v1/invitations":                       true,
+	"POST /api/v1/admin/cold-transfers/{id}/execute": true,
+}
+
+// streamingRoutes hold their connection open for as long as the client
+// listens, so they get no deadline.
+var streamingRoutes = map[string]bool{
+	"GET /api/v1/ws": true,
+}
+
+type timeoutResponse struct {
+	Error          string `json:"error"`
+	Code           string `json:"code"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+// routeTimeout returns the deadline of the route r matched:
+// REQUEST_TIMEOUT_MINING for mining routes, REQUEST_TIMEOUT_READ for
+// GET, HEAD and OPTIONS and REQUEST_TIMEOUT_WRITE for the rest.
+func routeTimeout(r *http.Request) time.Duration {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil && miningRoutes[r.Method+" "+tpl] {
+			return time.Duration(envLimit("REQUEST_TIMEOUT_MINING", defaultMiningTimeout)) * time.Second
+		}
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return time.Duration(envLimit("REQUEST_TIMEOUT_READ", defaultReadTimeout)) * time.Second
+	}
+	return time.Duration(envLimit("REQUEST_TIMEOUT_WRITE", defaultWriteTimeout)) * time.Second
+}
+
+// timeoutWriter buffers a handler's response so that it can be dropped
+// in favour of the 504 when the deadline passes first.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	code     int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.header }
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.code != 0 {
+		return
+	}
+	tw.code = code
+}
+
+// withDeadline runs the handler under the route's deadline and answers
+// 504 if it has not finished by then.
+func (s *Server) withDeadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if tpl, err := route.GetPathTemplate(); err == nil && streamingRoutes[r.Method+" "+tpl] {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		timeout := routeTimeout(r)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+
+		tw := &timeoutWriter{header: make(http.Header)}
+		done := make(chan struct{})
+		panicked := make(chan any, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			next.ServeHTTP(tw, r)
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			dst := w.Header()
+			for k, v := range tw.header {
+				dst[k] = v
+			}
+			if tw.code == 0 {
+				tw.code = http.StatusOK
+			}
+			w.WriteHeader(tw.code)
+			_, _ = w.Write(tw.buf.Bytes())
+		case <-ctx.Done():
+			tw.mu.Lock()
+			tw.timedOut = true
+			tw.mu.Unlock()
+			if errors.Is(ctx.Err(), context.Canceled) {
+				// the client went away; nobody is left to answer
+				return
+			}
+
+			s.logEvent(context.Background(), "warn", "request_timeout",
+				fmt.Sprintf("%s %s exceeded its %s deadline", r.Method, r.URL.Path, timeout), r.RemoteAddr)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusGatewayTimeout)
+			_ = json.NewEncoder(w).Encode(timeoutResponse{
+				Error:          i18n.T(lang(r), "request timed out"),
+				Code:           "timeout",
+				TimeoutSeconds: int(timeout.Seconds()),
+			})
+		}
+	})
+}
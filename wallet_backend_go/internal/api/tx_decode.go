@@ -0,0 +1,136 @@
+package api
+
+// tx_decode.go lets developers inspect a serialized transaction without
+// submitting it. Inputs are resolved against the chain where possible
+// so the decoded view shows what each input spends.
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+type decodeTxRequest struct {
+	// RawHex is the hex encoding of Transaction.Serialize.
+	RawHex string `json:"raw_hex"`
+}
+
+type decodedPrevOutput struct {
+	Value   int    `json:"value"`
+	Address string `json:"address"`
+}
+
+type decodedInput struct {
+	Txid       string             `json:"txid"`
+	Vout       int                `json:"vout"`
+	Address    string             `json:"address"`
+	PubKey     string             `json:"pubkey"`
+	Signature  string             `json:"signature"`
+	PrevOutput *decodedPrevOutput `json:"prev_output"`
+}
+
+type decodedOutput struct {
+	Index     int    `json:"index"`
+	Value     int    `json:"value"`
+	Address   string `json:"address"`
+	Condition string `json:"condition,omitempty"`
+}
+
+type decodeTxResponse struct {
+	Txid        string          `json:"txid"`
+	DeclaredID  string          `json:"declared_id"`
+	IDValid     bool            `json:"id_valid"`
+	Coinbase    bool            `json:"coinbase"`
+	LockTime    int64           `json:"lock_time,omitempty"`
+	InChain     bool            `json:"in_chain"`
+	Inputs      []decodedInput  `json:"inputs"`
+	Outputs     []decodedOutput `json:"outputs"`
+	TotalInput  *int            `json:"total_input"`
+	TotalOutput int             `json:"total_output"`
+}
+
+// DecodeTransaction decodes a serialized transaction and returns its
+// structure. Nothing is verified beyond the txid and nothing is mined.
+func (s *Server) DecodeTransaction(w http.ResponseWriter, r *http.Request) {
+	var req decodeTxRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	raw, err := hex.DecodeString(req.RawHex)
+	if err != nil || len(raw) == 0 {
+		httpError(w, r, "raw_hex must be a hex-encoded transaction", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := blockchain.DeserializeTransaction(raw)
+	if err != nil {
+		httpError(w, r, "raw_hex must be a hex-encoded transaction", http.StatusBadRequest)
+		return
+	}
+
+	txid := tx.ComputeID()
+	resp := decodeTxResponse{
+		Txid:       fmt.Sprintf("%x", txid),
+		DeclaredID: fmt.Sprintf("%x", tx.ID),
+		IDValid:    bytes.Equal(txid, tx.ID),
+		Coinbase:   tx.IsCoinbase(),
+		LockTime:   tx.LockTime,
+		Inputs:     []decodedInput{},
+		Outputs:    []decodedOutput{},
+	}
+
+	if _, err := s.BC.FindTransaction(tx.ID); err == nil {
+		resp.InChain = true
+	}
+
+	// the input total is only known when every previous output resolves
+	totalIn, resolved := 0, !resp.Coinbase
+	for _, in := range tx.Vin {
+		di := decodedInput{
+			Txid:      fmt.Sprintf("%x", in.Txid),
+			Vout:      in.Vout,
+			PubKey:    fmt.Sprintf("%x", in.PubKey),
+			Signature: fmt.Sprintf("%x", in.Signature),
+		}
+		if !resp.Coinbase {
+			di.Address = blockchain.PubKeyAddress(in.PubKey)
+			if prev, err := s.BC.FindTransaction(in.Txid); err == nil && in.Vout >= 0 && in.Vout < len(prev.Vout) {
+				out := prev.Vout[in.Vout]
+				di.PrevOutput = &decodedPrevOutput{Value: out.Value, Address: blockchain.EncodeAddress(out.Owner())}
+				totalIn += out.Value
+			} else {
+				resolved = false
+			}
+		}
+		resp.Inputs = append(resp.Inputs, di)
+	}
+	if resolved {
+		resp.TotalInput = &totalIn
+	}
+
+	for i, out := range tx.Vout {
+		do := decodedOutput{
+			Index:   i,
+			Value:   out.Value,
+			Address: blockchain.EncodeAddress(out.Owner()),
+		}
+		if len(out.Script) > 0 {
+			if cond, err := out.Condition(); err == nil {
+				do.Condition = cond.String()
+			} else {
+				do.Condition = "invalid"
+			}
+		}
+		resp.Outputs = append(resp.Outputs, do)
+		resp.TotalOutput += out.Value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
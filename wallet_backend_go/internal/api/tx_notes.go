@@ -0,0 +1,130 @@
+package api
+
+// tx_notes.go lets compliance staff annotate transactions. Every PATCH
+// appends a note to transaction_notes (so the investigation history and
+// its authors are kept) and updates the compliance status on the
+// transaction row.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/models"
+)
+
+type txNoteRequest struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+	Author string `json:"author"`
+}
+
+type txNotesResponse struct {
+	TxID             string                   `json:"txid"`
+	ComplianceStatus string                   `json:"compliance_status"`
+	Notes            []models.TransactionNote `json:"notes"`
+}
+
+// AnnotateTransaction appends a compliance note to a transaction and
+// sets its status to cleared or flagged.
+func (s *Server) AnnotateTransaction(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	txid := mux.Vars(r)["txid"]
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req txNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	req.Author = strings.TrimSpace(req.Author)
+	if req.Author == "" {
+		req.Author = adminName(ctx)
+	}
+	if req.Status != models.ComplianceCleared && req.Status != models.ComplianceFlagged {
+		httpError(w, r, "status must be cleared or flagged", http.StatusBadRequest)
+		return
+	}
+	if req.Note == "" || req.Author == "" {
+		httpError(w, r, "note and author are required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := s.DB.GetTransactionRecord(ctx, txid)
+	if err != nil {
+		httpError(w, r, "failed to load transaction", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "tx_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if tx == nil {
+		httpError(w, r, "transaction not found", http.StatusNotFound)
+		return
+	}
+
+	note := &models.TransactionNote{
+		ID:        uuid.NewString(),
+		TenantID:  tenantID(ctx),
+		TxID:      txid,
+		Status:    req.Status,
+		Note:      req.Note,
+		Author:    req.Author,
+		CreatedAt: s.Clock.Now().UTC(),
+	}
+	if err := s.DB.CreateTransactionNote(ctx, note); err != nil {
+		httpError(w, r, "failed to save transaction note", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "tx_note_save_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if err := s.DB.SetTransactionComplianceStatus(ctx, txid, req.Status); err != nil {
+		httpError(w, r, "failed to save transaction note", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "tx_compliance_update_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	s.logEvent(ctx, "info", "tx_annotated",
+		fmt.Sprintf("transaction %s marked %s by %s", txid, req.Status, req.Author),
+		r.RemoteAddr,
+	)
+
+	s.writeTransactionNotes(w, r, txid)
+}
+
+// GetTransactionNotes returns the note history of a transaction.
+func (s *Server) GetTransactionNotes(w http.ResponseWriter, r *http.Request) {
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	s.writeTransactionNotes(w, r, mux.Vars(r)["txid"])
+}
+
+func (s *Server) writeTransactionNotes(w http.ResponseWriter, r *http.Request, txid string) {
+	ctx := r.Context()
+
+	notes, err := s.DB.ListTransactionNotes(ctx, tenantID(ctx), txid)
+	if err != nil {
+		httpError(w, r, "failed to load transaction notes", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "tx_notes_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	resp := txNotesResponse{TxID: txid, Notes: notes}
+	if resp.Notes == nil {
+		resp.Notes = []models.TransactionNote{}
+	}
+	if len(notes) > 0 {
+		resp.ComplianceStatus = notes[len(notes)-1].Status
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,92 @@
+package api
+
+// tx_receipts.go builds the receipt POST /transactions answers with and
+// serves the stored copy. A receipt lists the outputs a send spent and
+// the outputs it created, so wallets can show the change that went back
+// to the sender and the fee without decoding the transaction.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+)
+
+// sendResponse is the answer to POST /transactions.
+type sendResponse struct {
+	Status string `json:"status"`
+	models.TransactionReceipt
+}
+
+// newTransactionReceipt builds the receipt of tx, mined in b at height,
+// sending amount from one address to another. Outputs paying from are
+// change. Inputs whose previous output is not on the chain count as
+// zero, which cannot happen for a transaction that verified.
+func (s *Server) newTransactionReceipt(tx *blockchain.Transaction, b *blockchain.Block, height int, from, to string, amount int) models.TransactionReceipt {
+	rc := models.TransactionReceipt{
+		TxID:        fmt.Sprintf("%x", tx.ID),
+		BlockHash:   fmt.Sprintf("%x", b.Hash),
+		BlockHeight: height,
+		From:        from,
+		To:          to,
+		Amount:      amount,
+		Inputs:      []models.ReceiptInput{},
+		Outputs:     []models.ReceiptOutput{},
+		Timestamp:   time.Unix(b.Timestamp, 0).UTC(),
+	}
+
+	totalIn := 0
+	for _, in := range tx.Vin {
+		ri := models.ReceiptInput{Txid: fmt.Sprintf("%x", in.Txid), Vout: in.Vout}
+		if prev, err := s.BC.FindTransaction(in.Txid); err == nil && in.Vout >= 0 && in.Vout < len(prev.Vout) {
+			out := prev.Vout[in.Vout]
+			ri.Address = blockchain.EncodeAddress(out.Owner())
+			ri.Value = out.Value
+		}
+		totalIn += ri.Value
+		rc.Inputs = append(rc.Inputs, ri)
+	}
+
+	fromHash, _ := blockchain.DecodeAddress(from)
+	totalOut := 0
+	for i, out := range tx.Vout {
+		rc.Outputs = append(rc.Outputs, models.ReceiptOutput{
+			Index:   i,
+			Address: blockchain.EncodeAddress(out.Owner()),
+			Value:   out.Value,
+			Change:  out.IsLockedWith(fromHash),
+		})
+		totalOut += out.Value
+	}
+	rc.Fee = totalIn - totalOut
+	return rc
+}
+
+// GetTransactionReceipt returns the stored receipt of a send.
+func (s *Server) GetTransactionReceipt(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	txid := mux.Vars(r)["txid"]
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	rc, err := s.DB.GetTransactionReceipt(ctx, tenantID(ctx), txid)
+	if err != nil {
+		httpError(w, r, "failed to load receipt", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "tx_receipt_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if rc == nil {
+		httpError(w, r, "receipt not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rc)
+}
@@ -0,0 +1,209 @@
+package api
+
+// tx_signing.go lets wallets keep their private keys: instead of
+// sending the key with POST /transactions, a client asks
+// POST /transactions/prepare for the unsigned transaction of a send and
+// the digest each input must be signed over, signs them on the device
+// and hands the signatures to POST /transactions/submit, which verifies
+// the transaction and then holds, queues or mines it like any send.
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+type prepareTxRequest struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Amount int    `json:"amount"`
+	Fee    int    `json:"fee,omitempty"`
+}
+
+type preparedInput struct {
+	Index int    `json:"index"`
+	Txid  string `json:"txid"`
+	Vout  int    `json:"vout"`
+	Value int    `json:"value"`
+	// Digest is the hex hash the input's signature signs.
+	Digest string `json:"digest"`
+}
+
+type prepareTxResponse struct {
+	Txid   string          `json:"txid"`
+	RawHex string          `json:"raw_hex"` // unsigned
+	From   string          `json:"from"`
+	To     string          `json:"to"`
+	Amount int             `json:"amount"`
+	Fee    int             `json:"fee"`
+	Inputs []preparedInput `json:"inputs"`
+}
+
+type inputSignature struct {
+	Signature string `json:"signature"` // hex r||s, 32 bytes each
+	PubKey    string `json:"pubkey"`    // hex X||Y of the signing key
+}
+
+type submitTxRequest struct {
+	// RawHex is the prepared transaction, or a transaction signed in
+	// full by the client.
+	RawHex string `json:"raw_hex"`
+	// Signatures, one per input in order, sign a prepared transaction.
+	Signatures []inputSignature `json:"signatures,omitempty"`
+	PIN        string           `json:"pin,omitempty"` // when the sender has a transaction PIN
+	// PINs holds, by address, the PINs of senders whose PIN is not
+	// PIN, when the inputs are signed by several wallets.
+	PINs map[string]string `json:"pins,omitempty"`
+}
+
+// PrepareTransaction builds the unsigned transaction sending amount
+// from one address to another and returns it with the digest each
+// input must be signed over. Nothing is reserved: if the inputs are
+// spent before the transaction is submitted, it is rejected and must be
+// prepared again.
+func (s *Server) PrepareTransaction(w http.ResponseWriter, r *http.Request) {
+	var body prepareTxRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpError(w, r, "invalid request payload", http.StatusBadRequest)
+		return
+	}
+	req := txRequest{From: body.From, To: body.To, Amount: body.Amount, Fee: body.Fee}
+	if !s.validSendRequest(w, r, &req) {
+		return
+	}
+
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+
+	fromPubKeyHash, _ := blockchain.DecodeAddress(req.From)
+	amount, spendable := s.UTXO.FindSpendableOutputsExcluding(fromPubKeyHash, req.Amount+req.Fee, s.reservedOutputs())
+	if amount < req.Amount+req.Fee {
+		httpError(w, r, "insufficient funds", http.StatusBadRequest)
+		return
+	}
+	payments := []blockchain.Payment{{To: req.To, Amount: req.Amount}}
+	tx, prevTXs, err := blockchain.NewUnsignedTransaction(payments, req.Fee, s.BC, spendable, fromPubKeyHash, amount)
+	if err != nil {
+		httpError(w, r, "failed to create transaction", http.StatusBadRequest)
+		return
+	}
+	digests, err := tx.SigningDigests(prevTXs)
+	if err != nil {
+		httpError(w, r, "failed to create transaction", http.StatusBadRequest)
+		return
+	}
+
+	resp := prepareTxResponse{
+		Txid:   fmt.Sprintf("%x", tx.ID),
+		RawHex: hex.EncodeToString(tx.Serialize()),
+		From:   req.From,
+		To:     req.To,
+		Amount: req.Amount,
+		Fee:    req.Fee,
+		Inputs: make([]preparedInput, len(tx.Vin)),
+	}
+	for i, in := range tx.Vin {
+		prevID := fmt.Sprintf("%x", in.Txid)
+		resp.Inputs[i] = preparedInput{
+			Index:  i,
+			Txid:   prevID,
+			Vout:   in.Vout,
+			Value:  prevTXs[prevID].Vout[in.Vout].Value,
+			Digest: hex.EncodeToString(digests[i]),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// SubmitTransaction verifies a transaction signed by the client, with
+// the signatures attached or given alongside, and holds, queues or
+// mines it like POST /transactions. The sender, recipient and amount
+// are those txParties reads from the transaction.
+func (s *Server) SubmitTransaction(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req submitTxRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request payload", http.StatusBadRequest)
+		return
+	}
+	tx, err := decodeRawTx(req.RawHex)
+	if err != nil {
+		httpError(w, r, "raw_hex must be a hex-encoded transaction", http.StatusBadRequest)
+		return
+	}
+	if msg := attachSignatures(tx, req.Signatures); msg != "" {
+		httpError(w, r, msg, http.StatusBadRequest)
+		return
+	}
+
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+
+	batch := &offlineBatch{
+		accepted: make(map[string]*blockchain.Transaction),
+		spent:    make(map[string]bool),
+	}
+	if reason := s.validateRawTx(ctx, tx, batch); reason != "" {
+		status := http.StatusBadRequest
+		if reason == "transaction already mined" {
+			status = http.StatusConflict
+		}
+		httpError(w, r, reason, status)
+		return
+	}
+	noteAuditTx(ctx, tx.ID)
+
+	// every wallet signing an input is a sender, charged and asked
+	// for its PIN; the PINs are checked once the signatures show the
+	// senders' keys signed, so a stranger cannot use up the owners'
+	// attempts
+	from, to, amount, _ := txParties(tx)
+	senders := txSenders(tx)
+	for _, sender := range senders {
+		if !s.allowRate(w, r, rateTx, "address", sender) {
+			return
+		}
+	}
+	pins := make(map[string]string, len(req.PINs))
+	for addr, pin := range req.PINs {
+		pins[blockchain.CanonicalAddress(addr)] = pin
+	}
+	for _, sender := range senders {
+		pin, ok := pins[sender]
+		if !ok {
+			pin = req.PIN
+		}
+		if !s.requireTransactionPIN(w, r, sender, pin) {
+			return
+		}
+	}
+	s.finishSend(w, r, tx, txRequest{From: from, To: to, Amount: amount}, duplicateSendWindow())
+}
+
+// attachSignatures sets the signatures, one per input in order, on a
+// prepared transaction. It returns the error message, or "" when they
+// were attached; no signatures leave tx as it is.
+func attachSignatures(tx *blockchain.Transaction, sigs []inputSignature) string {
+	if len(sigs) == 0 {
+		return ""
+	}
+	if len(sigs) != len(tx.Vin) {
+		return "signatures must match the transaction inputs"
+	}
+	for i, sig := range sigs {
+		signature, err1 := hex.DecodeString(sig.Signature)
+		pubKey, err2 := hex.DecodeString(sig.PubKey)
+		if err1 != nil || err2 != nil || len(signature) == 0 || len(pubKey) == 0 {
+			return "invalid signature"
+		}
+		tx.Vin[i].Signature = signature
+		tx.Vin[i].PubKey = pubKey
+	}
+	return ""
+}
@@ -0,0 +1,144 @@
+package api
+
+// users.go exposes per-user views that aggregate over all wallets
+// owned by a user.
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/zakat"
+)
+
+// zakatProjection estimates the user's next zakat deduction.
+type zakatProjection struct {
+	TotalBalance   int       `json:"total_balance"`
+	Nisab          int       `json:"nisab"`
+	Eligible       bool      `json:"eligible"`
+	ExpectedAmount int       `json:"expected_amount"`
+	HawlStart      time.Time `json:"hawl_start"`
+	DueDate        time.Time `json:"due_date"`
+	DaysUntilDue   int       `json:"days_until_due"`
+}
+
+type userZakatResponse struct {
+	UserID       string               `json:"user_id"`
+	TotalPaid    int                  `json:"total_paid"`
+	ZakatRecords []models.ZakatRecord `json:"zakat_records"`
+	Projection   zakatProjection      `json:"projection"`
+}
+
+// UserZakat returns every zakat record across the user's wallets and a
+// projection of the next deduction under the tenant's zakat policy. The
+// hawl (lunar year) is counted from the user's last deduction, or from
+// their first wallet's creation if they have never paid, and the
+// projected amount is the cash rule's rate applied to the combined
+// balance of their active wallets when it reaches the rule's threshold.
+// Only the user's own session, or an admin, can read it.
+func (s *Server) UserZakat(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["id"]
+
+	if session := sessionFrom(ctx); session != nil && session.Subject != userID {
+		httpError(w, r, "zakat records belong to another user", http.StatusForbidden)
+		return
+	}
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	profiles, err := s.DB.ListWalletProfilesByUser(ctx, userID)
+	if err != nil {
+		httpError(w, r, "failed to list wallet profiles", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "user_zakat_list_wallets_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if len(profiles) == 0 || (tenantID(ctx) != "" && profiles[0].TenantID != tenantID(ctx)) {
+		httpError(w, r, "user not found", http.StatusNotFound)
+		return
+	}
+
+	records, err := s.DB.ListZakatByUser(ctx, userID)
+	if err != nil {
+		httpError(w, r, "failed to list zakat records", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "user_zakat_list_records_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	totalPaid := 0
+	for _, zr := range records {
+		totalPaid += zr.Amount
+	}
+
+	projection, err := s.projectZakat(ctx, profiles, records)
+	if err != nil {
+		httpError(w, r, "failed to load zakat policy", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "zakat_policy_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	if records == nil {
+		records = []models.ZakatRecord{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(userZakatResponse{
+		UserID:       userID,
+		TotalPaid:    totalPaid,
+		ZakatRecords: records,
+		Projection:   projection,
+	})
+}
+
+// projectZakat projects the next zakat deduction of the user owning
+// profiles (oldest first, at least one) from their zakat records
+// (newest first); see UserZakat.
+func (s *Server) projectZakat(ctx context.Context, profiles []models.WalletProfile, records []models.ZakatRecord) (zakatProjection, error) {
+	// combined balance of the user's active wallets
+	totalBalance := 0
+	for _, wp := range profiles {
+		if wp.Status == models.WalletStatusDeactivated {
+			continue
+		}
+		balance, _, err := s.balanceForAddress(wp.WalletAddress)
+		if err != nil {
+			continue
+		}
+		totalBalance += balance
+	}
+
+	// records are newest first; profiles oldest first
+	hawlStart := profiles[0].CreatedAt
+	if len(records) > 0 {
+		hawlStart = records[0].CreatedAt
+	}
+
+	policy, _, err := s.zakatPolicyFor(ctx, profiles[0].TenantID, 0)
+	if err != nil {
+		return zakatProjection{}, err
+	}
+	cash, _ := policy.Rule(zakat.AssetCash)
+	dueDate := cash.DueDate(hawlStart)
+
+	daysUntilDue := int(dueDate.Sub(s.Clock.Now()).Hours() / 24)
+	if daysUntilDue < 0 {
+		daysUntilDue = 0
+	}
+
+	assessment := policy.Assess(zakat.AssetCash, totalBalance)
+	return zakatProjection{
+		TotalBalance:   totalBalance,
+		Nisab:          cash.Threshold,
+		Eligible:       assessment.Reason == "",
+		ExpectedAmount: assessment.Amount,
+		HawlStart:      hawlStart,
+		DueDate:        dueDate,
+		DaysUntilDue:   daysUntilDue,
+	}, nil
+}
@@ -0,0 +1,264 @@
+package api
+
+// view_keys.go lets a wallet's owner hand an auditor read-only access
+// to the wallet's history. A view key is a bearer secret bound to one
+// wallet: it opens the wallet's balance and incoming and outgoing
+// transactions through GET /view/wallet and nothing else, so it can
+// never be used to spend. Owners issue, list and revoke keys with their
+// session; only the SHA-256 of a key is stored.
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+)
+
+const viewKeyPrefix = "vk_"
+
+type createViewKeyRequest struct {
+	Auditor       string `json:"auditor"`
+	ExpiresInDays int    `json:"expires_in_days"` // 0 for no expiry
+}
+
+// viewKeyView is a view key as shown to the wallet's owner.
+type viewKeyView struct {
+	ID            string     `json:"id"`
+	WalletAddress string     `json:"wallet_address"`
+	Auditor       string     `json:"auditor"`
+	ViewKey       string     `json:"view_key,omitempty"` // only when issued
+	CreatedAt     time.Time  `json:"created_at"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+}
+
+func newViewKeyView(k *models.ViewKey) viewKeyView {
+	return viewKeyView{
+		ID:            k.ID,
+		WalletAddress: k.WalletAddress,
+		Auditor:       k.Auditor,
+		CreatedAt:     k.CreatedAt,
+		ExpiresAt:     k.ExpiresAt,
+		RevokedAt:     k.RevokedAt,
+	}
+}
+
+type viewKeyListResponse struct {
+	ViewKeys []viewKeyView `json:"view_keys"`
+}
+
+type viewWalletResponse struct {
+	Auditor   string     `json:"auditor"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	explorerAddressResponse
+}
+
+// hashViewKey returns the stored form of a view key.
+func hashViewKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// requireWalletOwner checks that the session user owns the registered
+// wallet at address. On failure it writes the error response and
+// returns false.
+func (s *Server) requireWalletOwner(w http.ResponseWriter, r *http.Request, address string) bool {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return false
+	}
+	wp, err := s.DB.GetWalletProfileByAddress(ctx, address)
+	if err != nil {
+		httpError(w, r, "failed to load wallet", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "wallet_profile_get_failed", err.Error(), r.RemoteAddr)
+		return false
+	}
+	if wp == nil {
+		httpError(w, r, "wallet not found", http.StatusNotFound)
+		return false
+	}
+	if wp.UserID == "" || wp.UserID != sessionFrom(ctx).Subject {
+		httpError(w, r, "wallet does not belong to this user", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// CreateViewKey issues a view key of the session user's wallet for an
+// auditor. The key is returned once.
+func (s *Server) CreateViewKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	address := mux.Vars(r)["address"]
+
+	var req createViewKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Auditor = strings.TrimSpace(req.Auditor)
+	if req.Auditor == "" {
+		httpError(w, r, "auditor is required", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		httpError(w, r, "expires_in_days must not be negative", http.StatusBadRequest)
+		return
+	}
+	if !s.requireWalletOwner(w, r, address) {
+		return
+	}
+
+	buf := make([]byte, 32)
+	if _, err := io.ReadFull(s.Entropy, buf); err != nil {
+		httpError(w, r, "failed to create view key", http.StatusInternalServerError)
+		return
+	}
+	key := viewKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	now := s.Clock.Now().UTC()
+	vk := &models.ViewKey{
+		ID:            uuid.NewString(),
+		TenantID:      tenantID(ctx),
+		WalletAddress: address,
+		Auditor:       req.Auditor,
+		KeyHash:       hashViewKey(key),
+		CreatedBy:     sessionFrom(ctx).Subject,
+		CreatedAt:     now,
+	}
+	if req.ExpiresInDays > 0 {
+		expires := now.AddDate(0, 0, req.ExpiresInDays)
+		vk.ExpiresAt = &expires
+	}
+	if err := s.DB.CreateViewKey(ctx, vk); err != nil {
+		httpError(w, r, "failed to create view key", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "view_key_create_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	s.logEvent(ctx, "info", "view_key_created",
+		fmt.Sprintf("view key %s of wallet %s issued to auditor %q", vk.ID, address, vk.Auditor), r.RemoteAddr)
+
+	resp := newViewKeyView(vk)
+	resp.ViewKey = key
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// ListViewKeys lists the view keys of the session user's wallet.
+func (s *Server) ListViewKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	address := mux.Vars(r)["address"]
+
+	if !s.requireWalletOwner(w, r, address) {
+		return
+	}
+	keys, err := s.DB.ListViewKeys(ctx, tenantID(ctx), address)
+	if err != nil {
+		httpError(w, r, "failed to load view keys", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "view_key_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	resp := viewKeyListResponse{ViewKeys: []viewKeyView{}}
+	for i := range keys {
+		resp.ViewKeys = append(resp.ViewKeys, newViewKeyView(&keys[i]))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// RevokeViewKey ends an auditor's access to the session user's wallet.
+func (s *Server) RevokeViewKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	address, id := vars["address"], vars["id"]
+
+	if !s.requireWalletOwner(w, r, address) {
+		return
+	}
+	found, err := s.DB.RevokeViewKey(ctx, tenantID(ctx), address, id, s.Clock.Now().UTC())
+	if err != nil {
+		httpError(w, r, "failed to revoke view key", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "view_key_revoke_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if !found {
+		httpError(w, r, "view key not found", http.StatusNotFound)
+		return
+	}
+	s.logEvent(ctx, "info", "view_key_revoked",
+		fmt.Sprintf("view key %s of wallet %s revoked", id, address), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"id": id, "status": "revoked"})
+}
+
+// ViewWallet returns the balance, totals and a page of the incoming and
+// outgoing transactions of the wallet a view key (X-View-Key header)
+// was issued for. Every use is logged.
+func (s *Server) ViewWallet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	key := r.Header.Get("X-View-Key")
+	if !strings.HasPrefix(key, viewKeyPrefix) {
+		httpError(w, r, "view key required", http.StatusUnauthorized)
+		return
+	}
+	offset, limit, ok := pageParams(r)
+	if !ok {
+		httpError(w, r, "invalid offset or limit", http.StatusBadRequest)
+		return
+	}
+
+	vk, err := s.DB.GetViewKeyByHash(ctx, hashViewKey(key))
+	if err != nil {
+		httpError(w, r, "failed to check view key", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "view_key_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if vk == nil || vk.RevokedAt != nil || (vk.ExpiresAt != nil && !s.Clock.Now().Before(*vk.ExpiresAt)) {
+		httpError(w, r, "invalid or expired view key", http.StatusUnauthorized)
+		return
+	}
+	if !blockchain.ValidateAddress(vk.WalletAddress) {
+		httpError(w, r, "invalid address", http.StatusBadRequest)
+		return
+	}
+
+	s.syncAddressIndex()
+	summary, txs := s.addrs.Address(vk.WalletAddress, offset, limit)
+	resp := viewWalletResponse{
+		Auditor:   vk.Auditor,
+		ExpiresAt: vk.ExpiresAt,
+		explorerAddressResponse: explorerAddressResponse{
+			AddressSummary: summary,
+			Transactions:   txs,
+			Offset:         offset,
+			Limit:          limit,
+		},
+	}
+	if next := offset + len(txs); next < summary.TxCount {
+		resp.NextOffset = &next
+	}
+	s.logEvent(ctx, "info", "view_key_used",
+		fmt.Sprintf("auditor %q viewed wallet %s with view key %s", vk.Auditor, vk.WalletAddress, vk.ID), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
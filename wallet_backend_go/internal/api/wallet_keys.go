@@ -0,0 +1,54 @@
+package api
+
+// wallet_keys.go seals the private keys of the wallets the server
+// creates for its users and opens them when the server signs for a
+// wallet (zakat deductions, pledge payments), through the master keys
+// of internal/crypto.
+
+import (
+	"crypto/ecdsa"
+	"sync"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/crypto"
+	"wallet_backend_go/internal/models"
+)
+
+// walletKeys holds the master keys, loaded on first use. The server
+// binary checks them at startup, so a bad WALLET_MASTER_KEYS stops it
+// before any request.
+type walletKeys struct {
+	once sync.Once
+	ring *crypto.Keyring
+	err  error
+}
+
+func (k *walletKeys) keyring() (*crypto.Keyring, error) {
+	k.once.Do(func() {
+		k.ring, k.err = crypto.LoadKeyring()
+	})
+	return k.ring, k.err
+}
+
+// sealWalletKey returns the stored form of the hex private key of the
+// wallet at address.
+func (s *Server) sealWalletKey(address, privHex string) (string, error) {
+	ring, err := s.walletKeys.keyring()
+	if err != nil {
+		return "", err
+	}
+	return ring.Seal(address, privHex)
+}
+
+// walletPrivateKey opens the stored private key of wp.
+func (s *Server) walletPrivateKey(wp *models.WalletProfile) (*ecdsa.PrivateKey, error) {
+	ring, err := s.walletKeys.keyring()
+	if err != nil {
+		return nil, err
+	}
+	privHex, err := ring.Open(wp.WalletAddress, wp.EncryptedPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return blockchain.PrivateKeyFromHex(privHex)
+}
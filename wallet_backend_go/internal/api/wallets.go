@@ -0,0 +1,73 @@
+package api
+
+// wallets.go manages the lifecycle of registered wallet profiles.
+// Deactivated wallets stay visible (balance, history, reports) but can
+// no longer send and are skipped by zakat runs.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+)
+
+// walletActive reports whether the wallet may send funds. Wallets
+// without a profile (created via POST /wallets) are always active.
+func (s *Server) walletActive(ctx context.Context, address string) (bool, error) {
+	if s.DB == nil {
+		return true, nil
+	}
+
+	wp, err := s.DB.GetWalletProfileByAddress(ctx, address)
+	if err != nil {
+		return false, err
+	}
+	return wp == nil || wp.Status != models.WalletStatusDeactivated, nil
+}
+
+// DeactivateWallet retires a registered wallet, on behalf of its owner
+// or of an admin.
+func (s *Server) DeactivateWallet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	address := mux.Vars(r)["address"]
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	if !blockchain.ValidateAddress(address) {
+		httpError(w, r, "invalid address", http.StatusBadRequest)
+		return
+	}
+	if sessionFrom(ctx) != nil && !s.requireWalletOwner(w, r, address) {
+		return
+	}
+
+	found, err := s.DB.DeactivateWalletProfile(ctx, tenantID(ctx), address)
+	if err != nil {
+		httpError(w, r, "failed to deactivate wallet", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "wallet_deactivate_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if !found {
+		httpError(w, r, "wallet not found", http.StatusNotFound)
+		return
+	}
+
+	s.logEvent(ctx, "info", "wallet_deactivated",
+		fmt.Sprintf("wallet %s deactivated by %s", address, tenantActor(ctx)),
+		r.RemoteAddr,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"wallet_address": address,
+		"status":         models.WalletStatusDeactivated,
+	})
+}
@@ -0,0 +1,483 @@
+package api
+
+// webauthn.go adds passkeys as a phishing-resistant alternative to OTP
+// login. A signed-in user registers a passkey with register/begin and
+// register/finish; anyone can then log in with login/begin and
+// login/finish, which returns the same session token as OTP
+// verification. Passkeys are created as discoverable credentials, so
+// login needs no email and reveals nothing about which accounts exist.
+// Credential public keys are stored in webauthn_credentials; pending
+// challenges are kept in memory for webauthnChallengeTTL and can be
+// used once.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/webauthn"
+)
+
+const (
+	webauthnChallengeTTL = 5 * time.Minute
+	webauthnMaxPending   = 10000
+
+	ceremonyRegister = "register"
+	ceremonyLogin    = "login"
+)
+
+// webauthnConfig reads the relying party from WEBAUTHN_RP_ID (default
+// localhost), WEBAUTHN_RP_NAME (default ZakatWallet) and the
+// comma-separated WEBAUTHN_ORIGINS (default http://localhost:3000).
+func webauthnConfig() webauthn.Config {
+	cfg := webauthn.Config{
+		RPID:    os.Getenv("WEBAUTHN_RP_ID"),
+		RPName:  os.Getenv("WEBAUTHN_RP_NAME"),
+		Origins: []string{"http://localhost:3000"},
+	}
+	if cfg.RPID == "" {
+		cfg.RPID = "localhost"
+	}
+	if cfg.RPName == "" {
+		cfg.RPName = "ZakatWallet"
+	}
+	if list := os.Getenv("WEBAUTHN_ORIGINS"); list != "" {
+		cfg.Origins = nil
+		for _, o := range strings.Split(list, ",") {
+			if o = strings.TrimSpace(o); o != "" {
+				cfg.Origins = append(cfg.Origins, o)
+			}
+		}
+	}
+	return cfg
+}
+
+type webauthnCeremony struct {
+	kind    string
+	userID  string // registrations only
+	expires time.Time
+}
+
+// webauthnState holds the pending challenges, keyed by challenge.
+type webauthnState struct {
+	mu      sync.Mutex
+	pending map[string]webauthnCeremony
+}
+
+// start records a ceremony. It returns false when too many are pending.
+func (st *webauthnState) start(challenge string, c webauthnCeremony, now time.Time) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.pending == nil {
+		st.pending = make(map[string]webauthnCeremony)
+	}
+	for k, p := range st.pending {
+		if now.After(p.expires) {
+			delete(st.pending, k)
+		}
+	}
+	if len(st.pending) >= webauthnMaxPending {
+		return false
+	}
+	st.pending[challenge] = c
+	return true
+}
+
+// take removes and returns the ceremony of challenge if it is of the
+// given kind and has not expired.
+func (st *webauthnState) take(challenge, kind string, now time.Time) (webauthnCeremony, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	c, ok := st.pending[challenge]
+	if !ok || c.kind != kind {
+		return webauthnCeremony{}, false
+	}
+	delete(st.pending, challenge)
+	return c, !now.After(c.expires)
+}
+
+type credentialParam struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type credentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type relyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type webauthnUser struct {
+	ID          string `json:"id"` // base64url user handle
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type authenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// creationOptions is PublicKeyCredentialCreationOptions with binary
+// fields base64url encoded.
+type creationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     relyingParty           `json:"rp"`
+	User                   webauthnUser           `json:"user"`
+	PubKeyCredParams       []credentialParam      `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	Attestation            string                 `json:"attestation"`
+	ExcludeCredentials     []credentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection authenticatorSelection `json:"authenticatorSelection"`
+}
+
+// requestOptions is PublicKeyCredentialRequestOptions with binary
+// fields base64url encoded.
+type requestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	UserVerification string                 `json:"userVerification"`
+	AllowCredentials []credentialDescriptor `json:"allowCredentials"`
+}
+
+// publicKeyCredential is the JSON form of a PublicKeyCredential
+// returned by navigator.credentials.create or get.
+type publicKeyCredential struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"` // registration
+		AuthenticatorData string `json:"authenticatorData"` // login
+		Signature         string `json:"signature"`         // login
+		UserHandle        string `json:"userHandle"`        // login
+	} `json:"response"`
+}
+
+type registerFinishRequest struct {
+	Name       string              `json:"name"`
+	Credential publicKeyCredential `json:"credential"`
+}
+
+type loginFinishRequest struct {
+	Credential publicKeyCredential `json:"credential"`
+}
+
+type webauthnCredentialsResponse struct {
+	Credentials []models.WebAuthnCredential `json:"credentials"`
+}
+
+// beginCeremony creates and records a challenge, writing an error and
+// returning "" on failure.
+func (s *Server) beginCeremony(w http.ResponseWriter, r *http.Request, c webauthnCeremony) string {
+	challenge, err := webauthn.NewChallenge(s.Entropy)
+	if err != nil {
+		httpError(w, r, "failed to create passkey challenge", http.StatusInternalServerError)
+		return ""
+	}
+	now := s.Clock.Now()
+	c.expires = now.Add(webauthnChallengeTTL)
+	if !s.webauthn.start(challenge, c, now) {
+		httpError(w, r, "too many pending passkey requests, try again later", http.StatusTooManyRequests)
+		return ""
+	}
+	return challenge
+}
+
+// takeCeremony finds the pending ceremony a clientDataJSON answers.
+func (s *Server) takeCeremony(clientDataJSON []byte, kind string) (string, webauthnCeremony, bool) {
+	cd, err := webauthn.ParseClientData(clientDataJSON)
+	if err != nil {
+		return "", webauthnCeremony{}, false
+	}
+	c, ok := s.webauthn.take(cd.Challenge, kind, s.Clock.Now())
+	return cd.Challenge, c, ok
+}
+
+// BeginPasskeyRegistration returns the options for creating a passkey
+// for the signed-in user.
+func (s *Server) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session := sessionFrom(ctx)
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := s.DB.GetUser(ctx, session.Subject)
+	if err != nil {
+		httpError(w, r, "failed to load user", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "user_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if user == nil {
+		httpError(w, r, "user not found", http.StatusNotFound)
+		return
+	}
+	existing, err := s.DB.ListWebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		httpError(w, r, "failed to load passkeys", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "webauthn_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	challenge := s.beginCeremony(w, r, webauthnCeremony{kind: ceremonyRegister, userID: user.ID})
+	if challenge == "" {
+		return
+	}
+
+	cfg := webauthnConfig()
+	opts := creationOptions{
+		Challenge:          challenge,
+		RP:                 relyingParty{ID: cfg.RPID, Name: cfg.RPName},
+		User:               webauthnUser{ID: webauthn.Encode([]byte(user.ID)), Name: user.Email, DisplayName: user.FullName},
+		Timeout:            webauthnChallengeTTL.Milliseconds(),
+		Attestation:        "none",
+		ExcludeCredentials: []credentialDescriptor{},
+		AuthenticatorSelection: authenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   "preferred",
+		},
+	}
+	for _, alg := range webauthn.SupportedAlgorithms {
+		opts.PubKeyCredParams = append(opts.PubKeyCredParams, credentialParam{Type: "public-key", Alg: alg})
+	}
+	for _, c := range existing {
+		opts.ExcludeCredentials = append(opts.ExcludeCredentials, credentialDescriptor{Type: "public-key", ID: c.ID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]creationOptions{"publicKey": opts})
+}
+
+// FinishPasskeyRegistration verifies a new passkey and stores its
+// public key.
+func (s *Server) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session := sessionFrom(ctx)
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req registerFinishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	clientData, err1 := webauthn.Decode(req.Credential.Response.ClientDataJSON)
+	attestation, err2 := webauthn.Decode(req.Credential.Response.AttestationObject)
+	rawID, err3 := webauthn.Decode(req.Credential.RawID)
+	if err1 != nil || err2 != nil || err3 != nil || len(rawID) == 0 {
+		httpError(w, r, "invalid passkey credential", http.StatusBadRequest)
+		return
+	}
+
+	challenge, ceremony, ok := s.takeCeremony(clientData, ceremonyRegister)
+	if !ok || ceremony.userID != session.Subject {
+		httpError(w, r, "passkey challenge not found or expired", http.StatusBadRequest)
+		return
+	}
+	cred, err := webauthnConfig().VerifyRegistration(challenge, clientData, attestation)
+	if err != nil || string(cred.ID) != string(rawID) {
+		httpError(w, r, "passkey registration failed", http.StatusBadRequest)
+		detail := "credential id mismatch"
+		if err != nil {
+			detail = err.Error()
+		}
+		s.logEvent(ctx, "warn", "webauthn_register_rejected",
+			fmt.Sprintf("user %s: %s", session.Subject, detail), r.RemoteAddr)
+		return
+	}
+
+	id := webauthn.Encode(cred.ID)
+	if existing, err := s.DB.GetWebAuthnCredential(ctx, id); err != nil {
+		httpError(w, r, "failed to save passkey", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "webauthn_get_failed", err.Error(), r.RemoteAddr)
+		return
+	} else if existing != nil {
+		httpError(w, r, "passkey already registered", http.StatusConflict)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	record := &models.WebAuthnCredential{
+		ID:        id,
+		UserID:    session.Subject,
+		TenantID:  session.TenantID,
+		Name:      name,
+		PublicKey: webauthn.Encode(cred.PublicKey),
+		Algorithm: cred.Algorithm,
+		SignCount: cred.SignCount,
+		CreatedAt: s.Clock.Now().UTC(),
+	}
+	if err := s.DB.CreateWebAuthnCredential(ctx, record); err != nil {
+		httpError(w, r, "failed to save passkey", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "webauthn_save_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	s.logEvent(ctx, "info", "webauthn_registered",
+		fmt.Sprintf("user %s registered passkey %q", session.Subject, name), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(record)
+}
+
+// ListPasskeys returns the passkeys of the signed-in user.
+func (s *Server) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	creds, err := s.DB.ListWebAuthnCredentials(ctx, sessionFrom(ctx).Subject)
+	if err != nil {
+		httpError(w, r, "failed to load passkeys", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "webauthn_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if creds == nil {
+		creds = []models.WebAuthnCredential{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(webauthnCredentialsResponse{Credentials: creds})
+}
+
+// BeginPasskeyLogin returns the options for signing in with any
+// passkey registered for this site.
+func (s *Server) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	challenge := s.beginCeremony(w, r, webauthnCeremony{kind: ceremonyLogin})
+	if challenge == "" {
+		return
+	}
+
+	opts := requestOptions{
+		Challenge:        challenge,
+		RPID:             webauthnConfig().RPID,
+		Timeout:          webauthnChallengeTTL.Milliseconds(),
+		UserVerification: "preferred",
+		AllowCredentials: []credentialDescriptor{},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]requestOptions{"publicKey": opts})
+}
+
+// FinishPasskeyLogin verifies a passkey assertion and returns a
+// session token.
+func (s *Server) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req loginFinishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	resp := req.Credential.Response
+	clientData, err1 := webauthn.Decode(resp.ClientDataJSON)
+	authData, err2 := webauthn.Decode(resp.AuthenticatorData)
+	signature, err3 := webauthn.Decode(resp.Signature)
+	rawID, err4 := webauthn.Decode(req.Credential.RawID)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || len(rawID) == 0 {
+		httpError(w, r, "invalid passkey credential", http.StatusBadRequest)
+		return
+	}
+
+	// every failure below gets the same answer; the log says why
+	reject := func(detail string) {
+		httpError(w, r, "passkey login failed", http.StatusUnauthorized)
+		s.logEvent(ctx, "warn", "webauthn_login_rejected", detail, r.RemoteAddr)
+	}
+
+	challenge, _, ok := s.takeCeremony(clientData, ceremonyLogin)
+	if !ok {
+		reject("challenge not found or expired")
+		return
+	}
+	id := webauthn.Encode(rawID)
+	stored, err := s.DB.GetWebAuthnCredential(ctx, id)
+	if err != nil {
+		httpError(w, r, "failed to load passkey", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "webauthn_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if stored == nil {
+		reject(fmt.Sprintf("unknown credential %s", id))
+		return
+	}
+	if resp.UserHandle != "" {
+		if handle, err := webauthn.Decode(resp.UserHandle); err != nil || string(handle) != stored.UserID {
+			reject(fmt.Sprintf("credential %s: user handle mismatch", id))
+			return
+		}
+	}
+	publicKey, err := webauthn.Decode(stored.PublicKey)
+	if err != nil {
+		reject(fmt.Sprintf("credential %s: stored key unreadable", id))
+		return
+	}
+
+	cred := &webauthn.Credential{ID: rawID, PublicKey: publicKey, Algorithm: stored.Algorithm, SignCount: stored.SignCount}
+	count, err := webauthnConfig().VerifyAssertion(challenge, cred, clientData, authData, signature)
+	if err != nil {
+		reject(fmt.Sprintf("credential %s: %v", id, err))
+		return
+	}
+
+	user, err := s.DB.GetUser(ctx, stored.UserID)
+	if err != nil || user == nil {
+		httpError(w, r, "failed to load user", http.StatusInternalServerError)
+		if err != nil {
+			s.logEvent(ctx, "error", "user_get_failed", err.Error(), r.RemoteAddr)
+		}
+		return
+	}
+	if err := s.DB.UpdateWebAuthnCredentialUsage(ctx, id, count, s.Clock.Now().UTC()); err != nil {
+		s.logEvent(ctx, "error", "webauthn_usage_update_failed", err.Error(), r.RemoteAddr)
+	}
+
+	session, err := s.issueSession(user, authMethodWebAuthn)
+	if err != nil {
+		httpError(w, r, "failed to create session", http.StatusInternalServerError)
+		return
+	}
+	s.logEvent(context.WithoutCancel(ctx), "info", "webauthn_login",
+		fmt.Sprintf("user %s signed in with passkey %s", user.ID, id), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(session)
+}
@@ -0,0 +1,102 @@
+package api
+
+// worker.go runs background jobs that should not block the HTTP
+// request that triggered them, such as the "pay zakat as you earn"
+// follow-up transactions. Jobs are queued on a buffered channel and
+// executed one at a time by a single goroutine.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/zakat"
+)
+
+// backgroundJob is a unit of work executed by the worker goroutine.
+type backgroundJob struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// jobQueueSize bounds the number of pending background jobs. When the
+// queue is full new jobs are dropped and logged.
+const jobQueueSize = 256
+
+// runWorker drains the job queue until it is closed.
+func (s *Server) runWorker() {
+	for job := range s.jobs {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		if err := job.Run(ctx); err != nil {
+			log.Printf("background job %s failed: %v", job.Name, err)
+			if s.DB != nil {
+				s.logEvent(ctx, "error", job.Name+"_failed", err.Error(), "worker")
+			}
+		}
+		cancel()
+	}
+}
+
+// enqueue schedules a job on the background worker without blocking.
+// It reports false if the queue was full and the job was dropped.
+func (s *Server) enqueue(name string, run func(ctx context.Context) error) bool {
+	select {
+	case s.jobs <- backgroundJob{Name: name, Run: run}:
+		return true
+	default:
+		log.Printf("background queue full, dropping job %s", name)
+		return false
+	}
+}
+
+// maybeAutoZakat queues a "pay zakat as you earn" deduction for a wallet
+// that just received amount units. The job only deducts if the wallet
+// opted in and the incoming amount meets its configured threshold.
+func (s *Server) maybeAutoZakat(address string, amount int) {
+	if s.DB == nil || amount <= 0 {
+		return
+	}
+
+	s.enqueue("auto_zakat", func(ctx context.Context) error {
+		wp, err := s.DB.GetWalletProfileByAddress(ctx, address)
+		if err != nil {
+			return err
+		}
+		if wp == nil || wp.Status == models.WalletStatusDeactivated || !wp.AutoZakat || amount < wp.AutoZakatThreshold {
+			return nil
+		}
+		if !s.flagEnabled(ctx, wp.TenantID, flagAutoZakat) {
+			return nil
+		}
+
+		zakatAddress, err := s.zakatAddressFor(ctx, wp.TenantID)
+		if err != nil {
+			return err
+		}
+		if address == zakatAddress {
+			return nil
+		}
+
+		policy, _, err := s.zakatPolicyFor(ctx, wp.TenantID, 0)
+		if err != nil {
+			return err
+		}
+		zakatAmount := policy.Assess(zakat.AssetIncome, amount).Amount
+		if zakatAmount <= 0 {
+			return nil
+		}
+
+		blockHash, err := s.deductZakat(ctx, wp, zakatAmount, zakatAddress, "", "worker", nil, nil)
+		if err != nil {
+			return err
+		}
+
+		s.logEvent(ctx, "info", "auto_zakat",
+			fmt.Sprintf("auto zakat %d from %s in block %s", zakatAmount, address, blockHash),
+			"worker",
+		)
+		return nil
+	})
+}
@@ -0,0 +1,200 @@
+package api
+
+// zakat.go holds the zakat deduction primitive shared by the manual
+// zakat run and the "pay zakat as you earn" background job, plus the
+// per-wallet zakat settings endpoint.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/db"
+	"wallet_backend_go/internal/models"
+)
+
+// nisabThreshold returns the minimum balance on which zakat is due
+// under the default policy, configured with ZAKAT_NISAB (default 0:
+// every positive balance).
+func nisabThreshold() int {
+	n, err := strconv.Atoi(os.Getenv("ZAKAT_NISAB"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+type walletSettingsRequest struct {
+	AutoZakat          bool `json:"auto_zakat"`
+	AutoZakatThreshold int  `json:"auto_zakat_threshold"`
+}
+
+// deductZakat builds, mines and persists a transaction moving
+// zakatAmount from the wallet profile to the zakat pool. runID links
+// the resulting zakat record to a zakat run and may be empty. It
+// returns the hex hash of the mined block. Failures are logged to
+// system_logs with a step-specific type before being returned. With a
+// batch the block, transaction and zakat record rows are queued on it
+// instead of being written one by one; the caller flushes it. inFlight,
+// when not nil, is handed the id of the transaction before it is mined,
+// so the caller can record it durably; an error from it aborts the
+// deduction.
+func (s *Server) deductZakat(ctx context.Context, wp *models.WalletProfile, zakatAmount int, zakatAddress, runID, ip string, batch *db.Batch, inFlight func(txid string) error) (string, error) {
+	addr := wp.WalletAddress
+
+	pubKeyHash, err := blockchain.DecodeAddress(addr)
+	if err != nil {
+		s.logEvent(ctx, "error", "zakat_balance_failed", err.Error(), ip)
+		return "", err
+	}
+
+	privKey, err := s.walletPrivateKey(wp)
+	if err != nil {
+		s.logEvent(ctx, "error", "zakat_privkey_open_failed", err.Error(), ip)
+		return "", err
+	}
+
+	s.chainMu.Lock()
+
+	// Find spendable outputs for zakat amount
+	amount, spendable := s.UTXO.FindSpendableOutputsExcluding(pubKeyHash, zakatAmount, s.reservedOutputs())
+	if amount < zakatAmount {
+		s.chainMu.Unlock()
+		return "", fmt.Errorf("insufficient funds for zakat in %s", addr)
+	}
+
+	// Create zakat transaction
+	tx, err := blockchain.NewUTXOTransaction(*privKey, zakatAddress, zakatAmount, s.BC, spendable, pubKeyHash, amount)
+	if err != nil {
+		s.chainMu.Unlock()
+		s.logEvent(ctx, "error", "zakat_tx_create_failed", err.Error(), ip)
+		return "", err
+	}
+
+	// Verify transaction
+	if !s.BC.VerifyTransaction(tx) {
+		s.chainMu.Unlock()
+		s.logEvent(ctx, "error", "zakat_tx_verify_failed", "verification failed", ip)
+		return "", fmt.Errorf("zakat transaction verification failed")
+	}
+	if inFlight != nil {
+		if err := inFlight(fmt.Sprintf("%x", tx.ID)); err != nil {
+			s.chainMu.Unlock()
+			return "", err
+		}
+	}
+
+	// Mine block with this zakat transaction and rebuild the UTXO set
+	newBlock, err := s.BC.AddBlockContext(ctx, []*blockchain.Transaction{tx})
+	if err != nil {
+		s.chainMu.Unlock()
+		return "", fmt.Errorf("zakat block not mined: %w", err)
+	}
+	height := len(s.BC.Blocks) - 1
+	s.reports.invalidateBlock(newBlock)
+	_ = s.UTXO.Reindex()
+	s.chainMu.Unlock()
+	noteAuditTx(ctx, tx.ID)
+
+	blockHashHex := fmt.Sprintf("%x", newBlock.Hash)
+
+	// Without a database the deduction only exists on chain
+	if s.DB == nil {
+		return blockHashHex, nil
+	}
+
+	zr := &models.ZakatRecord{
+		ID:            uuid.NewString(),
+		UserID:        wp.UserID,
+		TenantID:      wp.TenantID,
+		WalletAddress: addr,
+		Amount:        zakatAmount,
+		BlockHash:     blockHashHex,
+		RunID:         runID,
+		CreatedAt:     s.Clock.Now().UTC(),
+	}
+
+	if batch != nil {
+		if err := batch.AddBlock(ctx, height, newBlock); err != nil {
+			s.logEvent(ctx, "error", "zakat_block_save_failed", err.Error(), ip)
+		}
+		if err := batch.AddTransaction(ctx, blockHashHex, tx, addr, zakatAddress, zakatAmount, "zakat_deduction"); err != nil {
+			s.logEvent(ctx, "error", "zakat_tx_save_failed", err.Error(), ip)
+		}
+		if err := batch.AddZakatRecord(ctx, zr); err != nil {
+			s.logEvent(ctx, "error", "zakat_record_save_failed", err.Error(), ip)
+		}
+		return blockHashHex, nil
+	}
+
+	// Save block & transaction as zakat_deduction
+	if err := s.DB.SaveBlock(ctx, height, newBlock); err != nil {
+		s.logEvent(ctx, "error", "zakat_block_save_failed", err.Error(), ip)
+	}
+
+	if err := s.DB.SaveTransaction(ctx, blockHashHex, tx, addr, zakatAddress, zakatAmount, "zakat_deduction"); err != nil {
+		s.logEvent(ctx, "error", "zakat_tx_save_failed", err.Error(), ip)
+	}
+
+	// Save zakat record
+	if err := s.DB.SaveZakatRecord(ctx, zr); err != nil {
+		s.logEvent(ctx, "error", "zakat_record_save_failed", err.Error(), ip)
+	} else {
+		s.notifyZakatReceipt(zr)
+	}
+	s.reports.invalidateBlock(newBlock)
+
+	return blockHashHex, nil
+}
+
+// UpdateWalletSettings lets the session user opt one of their wallets
+// into "pay zakat as you earn". When enabled, every incoming transfer of at least the
+// threshold triggers a 2.5% follow-up transaction to the zakat pool.
+func (s *Server) UpdateWalletSettings(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	address := mux.Vars(r)["address"]
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	if !blockchain.ValidateAddress(address) {
+		httpError(w, r, "invalid address", http.StatusBadRequest)
+		return
+	}
+
+	var req walletSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.AutoZakatThreshold < 0 {
+		httpError(w, r, "auto_zakat_threshold must not be negative", http.StatusBadRequest)
+		return
+	}
+	if !s.requireWalletOwner(w, r, address) {
+		return
+	}
+
+	if err := s.DB.UpdateWalletAutoZakat(ctx, tenantID(ctx), address, req.AutoZakat, req.AutoZakatThreshold); err != nil {
+		httpError(w, r, "failed to update wallet settings", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "wallet_settings_update_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	s.logEvent(ctx, "info", "wallet_settings_updated",
+		fmt.Sprintf("auto_zakat=%t threshold=%d for %s", req.AutoZakat, req.AutoZakatThreshold, address),
+		r.RemoteAddr,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(req)
+}
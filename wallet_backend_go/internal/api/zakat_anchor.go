@@ -0,0 +1,155 @@
+package api
+
+// zakat_anchor.go anchors the report of every finished zakat run on
+// chain and checks the stored run against it. The report root (see
+// zakat.RunReport) goes into an anchor transaction mined in a block of
+// its own; GET /zakat/runs/{id}/verify recomputes the root from the
+// run and items in Supabase and compares it with the latest anchor of
+// the run on chain, so an edit to those rows after the run shows.
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/zakat"
+)
+
+// Verification outcomes.
+const (
+	anchorVerified    = "verified"
+	anchorMismatch    = "mismatch"
+	anchorNotAnchored = "not_anchored"
+)
+
+// zakatAnchorTag is the anchor tag of a run's report.
+func zakatAnchorTag(runID string) string {
+	return "zakat-run:" + runID
+}
+
+// zakatRunReport is the report of run as its items stand.
+func zakatRunReport(run *models.ZakatRun, items []models.ZakatRunItem) zakat.RunReport {
+	rep := zakat.RunReport{
+		RunID:         run.ID,
+		TenantID:      run.TenantID,
+		PoolAddress:   run.ZakatWalletAddress,
+		PolicyVersion: run.PolicyVersion,
+	}
+	for _, item := range items {
+		rep.Lines = append(rep.Lines, zakat.ReportLine{
+			WalletAddress: item.WalletAddress,
+			Status:        item.Status,
+			Amount:        item.Amount,
+			BlockHash:     item.BlockHash,
+		})
+	}
+	return rep
+}
+
+// anchorZakatRun mines an anchor of the run's report and records it on
+// run, which the caller then stores. A run whose report is already
+// anchored is left alone. Failures are logged; the run stands without
+// an anchor.
+func (s *Server) anchorZakatRun(ctx context.Context, run *models.ZakatRun, items []models.ZakatRunItem, ip string) {
+	root := zakatRunReport(run, items).Root()
+	rootHex := hex.EncodeToString(root)
+	if run.ReportRoot == rootHex && run.AnchorTxID != "" {
+		return
+	}
+	tx := blockchain.NewAnchorTx(zakatAnchorTag(run.ID), root)
+
+	s.chainMu.Lock()
+	newBlock, err := s.BC.AddBlockContext(ctx, []*blockchain.Transaction{tx})
+	if err != nil {
+		s.chainMu.Unlock()
+		s.logEvent(ctx, "error", "zakat_run_anchor_failed", fmt.Sprintf("zakat run %s: %v", run.ID, err), ip)
+		return
+	}
+	height := len(s.BC.Blocks) - 1
+	_ = s.UTXO.Reindex()
+	s.chainMu.Unlock()
+
+	blockHash := hex.EncodeToString(newBlock.Hash)
+	run.ReportRoot = rootHex
+	run.AnchorTxID = hex.EncodeToString(tx.ID)
+	run.AnchorBlockHash = blockHash
+
+	if err := s.DB.SaveBlock(ctx, height, newBlock); err != nil {
+		s.logEvent(ctx, "error", "zakat_block_save_failed", err.Error(), ip)
+	}
+	if err := s.DB.SaveTransaction(ctx, blockHash, tx, "SYSTEM", "", 0, "anchor"); err != nil {
+		s.logEvent(ctx, "error", "zakat_tx_save_failed", err.Error(), ip)
+	}
+	s.logEvent(ctx, "info", "zakat_run_anchored",
+		fmt.Sprintf("zakat run %s report %s anchored in block %d", run.ID, rootHex, height),
+		ip,
+	)
+}
+
+type zakatRunVerification struct {
+	RunID           string     `json:"run_id"`
+	Status          string     `json:"status"` // verified, mismatch, not_anchored
+	Items           int        `json:"items"`
+	ReportRoot      string     `json:"report_root"`             // recomputed from Supabase
+	AnchoredRoot    string     `json:"anchored_root,omitempty"` // found on chain
+	AnchorTxID      string     `json:"anchor_txid,omitempty"`
+	AnchorBlockHash string     `json:"anchor_block_hash,omitempty"`
+	AnchorHeight    *int       `json:"anchor_height,omitempty"`
+	AnchoredAt      *time.Time `json:"anchored_at,omitempty"`
+	Anchors         int        `json:"anchors"` // anchors of the run on chain, one per finish
+}
+
+// VerifyZakatRun recomputes the report root of a run from Supabase and
+// checks it against the run's latest anchor on chain.
+func (s *Server) VerifyZakatRun(w http.ResponseWriter, r *http.Request) {
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	run, items, ok := s.loadZakatRun(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	root := zakatRunReport(run, items).Root()
+	resp := zakatRunVerification{
+		RunID:      run.ID,
+		Status:     anchorNotAnchored,
+		Items:      len(items),
+		ReportRoot: hex.EncodeToString(root),
+	}
+
+	s.chainMu.Lock()
+	anchors := s.BC.FindAnchors(zakatAnchorTag(run.ID))
+	s.chainMu.Unlock()
+	resp.Anchors = len(anchors)
+	if len(anchors) > 0 {
+		// a resumed run is anchored again when it finishes; the latest counts
+		a := anchors[len(anchors)-1]
+		height := a.Height
+		at := time.Unix(a.Block.Timestamp, 0).UTC()
+		resp.AnchoredRoot = hex.EncodeToString(a.Digest)
+		resp.AnchorTxID = hex.EncodeToString(a.Tx.ID)
+		resp.AnchorBlockHash = hex.EncodeToString(a.Block.Hash)
+		resp.AnchorHeight = &height
+		resp.AnchoredAt = &at
+		resp.Status = anchorVerified
+		if resp.AnchoredRoot != resp.ReportRoot {
+			resp.Status = anchorMismatch
+			s.logEvent(r.Context(), "warn", "zakat_run_verify_mismatch",
+				fmt.Sprintf("zakat run %s: stored report %s does not match anchor %s", run.ID, resp.ReportRoot, resp.AnchoredRoot),
+				r.RemoteAddr,
+			)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
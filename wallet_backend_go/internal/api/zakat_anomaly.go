@@ -0,0 +1,141 @@
+package api
+
+// zakat_anomaly.go adds sanity checks to new zakat runs. Before any
+// wallet is deducted, the run's planned deductions are compared against
+// two limits:
+//
+//   - ZAKAT_RUN_MAX_DEVIATION_PCT: the planned total may not differ from
+//     the previous finished run's total by more than this percentage
+//     (not checked for anniversary runs).
+//   - ZAKAT_RUN_MAX_WALLET_DEDUCTION: no single wallet may be deducted
+//     more than this many units.
+//
+// Either limit is disabled when unset or 0. A run that breaks a limit is
+// paused with its anomalies recorded and an alert logged; it only
+// proceeds once an administrator confirms it.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/zakat"
+)
+
+// zakatAnomalyLimits returns the configured deviation percentage and
+// per-wallet cap (0 when disabled).
+func zakatAnomalyLimits() (float64, int) {
+	pct, err := strconv.ParseFloat(os.Getenv("ZAKAT_RUN_MAX_DEVIATION_PCT"), 64)
+	if err != nil || pct < 0 {
+		pct = 0
+	}
+	maxWallet, err := strconv.Atoi(os.Getenv("ZAKAT_RUN_MAX_WALLET_DEDUCTION"))
+	if err != nil || maxWallet < 0 {
+		maxWallet = 0
+	}
+	return pct, maxWallet
+}
+
+// plannedZakat returns the amount the run would deduct from wp right
+// now under policy, mirroring processZakatItem.
+func (s *Server) plannedZakat(wp *models.WalletProfile, policy zakat.Policy) int {
+	if wp == nil || wp.Status == models.WalletStatusDeactivated {
+		return 0
+	}
+	balance, _, err := s.balanceForAddress(wp.WalletAddress)
+	if err != nil {
+		return 0
+	}
+	return policy.Assess(zakat.AssetCash, balance).Amount
+}
+
+// detectZakatRunAnomalies checks the planned deductions of a new run
+// against the configured limits and describes every violation.
+func (s *Server) detectZakatRunAnomalies(ctx context.Context, run *models.ZakatRun, profiles map[string]*models.WalletProfile, policy zakat.Policy) ([]string, error) {
+	maxDeviation, maxWallet := zakatAnomalyLimits()
+	if maxDeviation == 0 && maxWallet == 0 {
+		return nil, nil
+	}
+
+	var anomalies []string
+	total := 0
+	for addr, wp := range profiles {
+		amount := s.plannedZakat(wp, policy)
+		total += amount
+		if maxWallet > 0 && amount > maxWallet {
+			anomalies = append(anomalies,
+				fmt.Sprintf("wallet %s would be deducted %d, above the cap of %d", addr, amount, maxWallet))
+		}
+	}
+
+	// anniversary runs deduct a different handful of wallets every day,
+	// so their totals are not comparable
+	if maxDeviation > 0 && run.Trigger != models.ZakatTriggerAnniversary {
+		prev, err := s.DB.GetLatestFinishedZakatRun(ctx, run.TenantID)
+		if err != nil {
+			return nil, err
+		}
+		if prev != nil && prev.TotalZakat > 0 {
+			deviation := math.Abs(float64(total-prev.TotalZakat)) / float64(prev.TotalZakat) * 100
+			if deviation > maxDeviation {
+				anomalies = append(anomalies,
+					fmt.Sprintf("total deduction %d deviates %.1f%% from run %s (%d), above %.1f%%",
+						total, deviation, prev.ID, prev.TotalZakat, maxDeviation))
+			}
+		}
+	}
+	return anomalies, nil
+}
+
+// ConfirmZakatRun lets an administrator release a run that was paused
+// by the anomaly checks.
+func (s *Server) ConfirmZakatRun(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	if active, ok := s.zakatGuard.acquire(id); !ok {
+		httpError(w, r, fmt.Sprintf("zakat run %s is already in progress", active), http.StatusConflict)
+		return
+	}
+	defer s.zakatGuard.release()
+
+	run, items, ok := s.loadZakatRun(w, r, id)
+	if !ok {
+		return
+	}
+	if run.Status != models.ZakatRunPaused {
+		httpError(w, r, "zakat run is not awaiting confirmation", http.StatusConflict)
+		return
+	}
+
+	now := s.Clock.Now().UTC()
+	run.ConfirmedAt = &now
+	run.Status = models.ZakatRunRunning
+	if err := s.DB.UpdateZakatRun(ctx, run); err != nil {
+		httpError(w, r, "failed to update zakat run", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "zakat_run_update_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	s.logEvent(ctx, "info", "zakat_run_confirmed",
+		fmt.Sprintf("zakat run %s confirmed by %s despite %d anomalies", run.ID, adminName(ctx), len(run.Anomalies)),
+		r.RemoteAddr,
+	)
+
+	resp := s.processZakatRun(ctx, run, items, nil, r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
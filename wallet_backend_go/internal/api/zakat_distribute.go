@@ -0,0 +1,352 @@
+package api
+
+// zakat_distribute.go pays out the zakat pool. POST /zakat/distribute
+// splits an amount, by default all the pool can spend, across the
+// tenant's approved beneficiaries as the distribution section of the
+// zakat policy in force says (see zakat.Distribution), pays every part
+// in one transaction from the pool and records the parts in the
+// disbursements table. Beneficiaries paid through an external provider
+// are paid on chain to the settlement wallet, and their payouts are
+// queued (see payouts.go). As with disbursement templates the pool's key
+// is given with every distribution; the server does not keep it.
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/payout"
+	"wallet_backend_go/internal/zakat"
+)
+
+type distributeRequest struct {
+	Amount  int    `json:"amount"`        // 0 distributes the pool's spendable balance
+	PrivKey string `json:"private_key"`   // the zakat pool's key
+	DryRun  bool   `json:"dry_run"`       // compute the payouts without sending
+	PIN     string `json:"pin,omitempty"` // when the pool's owner has a transaction PIN
+	// Channels picks, by beneficiary id, how a beneficiary is paid this
+	// time: wallet or a payout method they have an account for.
+	Channels map[string]string `json:"channels"`
+}
+
+type distributionPayout struct {
+	BeneficiaryID string `json:"beneficiary_id"`
+	FullName      string `json:"full_name"`
+	Category      string `json:"category"`
+	WalletAddress string `json:"wallet_address"`
+	PayoutMethod  string `json:"payout_method,omitempty"` // paid on through a provider
+	Burned        bool   `json:"burned,omitempty"`        // burned on chain for the provider's payout
+	NeedsScore    int    `json:"needs_score"`
+	Amount        int    `json:"amount"`
+}
+
+type distributeResponse struct {
+	DistributionID string               `json:"distribution_id,omitempty"`
+	PoolAddress    string               `json:"pool_address"`
+	PoolBalance    int                  `json:"pool_balance"` // spendable before the distribution
+	Amount         int                  `json:"amount"`
+	Distributed    int                  `json:"distributed"`
+	Undistributed  int                  `json:"undistributed"` // shares of categories without approved beneficiaries
+	PolicyVersion  int                  `json:"policy_version"`
+	Distribution   zakat.Distribution   `json:"distribution"`
+	Payouts        []distributionPayout `json:"payouts"`
+	DryRun         bool                 `json:"dry_run"`
+	TxID           string               `json:"txid,omitempty"`
+	BlockHash      string               `json:"block_hash,omitempty"`
+	BlockHeight    int                  `json:"block_height,omitempty"`
+}
+
+type disbursementsResponse struct {
+	Disbursements []models.Disbursement `json:"disbursements"`
+}
+
+// DistributeZakat splits the zakat pool across the approved
+// beneficiaries and pays them in one transaction. With dry_run it only
+// returns the payouts.
+func (s *Server) DistributeZakat(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tenant := tenantID(ctx)
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+	var req distributeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Amount < 0 {
+		httpError(w, r, "amount must not be negative", http.StatusBadRequest)
+		return
+	}
+	for _, channel := range req.Channels {
+		if channel != channelWallet && !payout.Known(channel) {
+			httpError(w, r, "invalid payout channel", http.StatusBadRequest)
+			return
+		}
+	}
+
+	policy, version, err := s.zakatPolicyFor(ctx, tenant, 0)
+	if err != nil {
+		httpError(w, r, "failed to load zakat policy", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "zakat_policy_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	dist := policy.DistributionOrDefault()
+	if dist.Method == "" {
+		dist.Method = zakat.DistributeEqual
+	}
+
+	approved, err := s.DB.ListBeneficiaries(ctx, tenant, beneficiaryApproved, "")
+	if err != nil {
+		httpError(w, r, "failed to list beneficiaries", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "beneficiary_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	var payable []models.Beneficiary
+	var payTo []blockchain.Payment
+	var payMethod []string
+	recipients := make([]zakat.Recipient, 0, len(approved))
+	for _, b := range approved {
+		channel, picked := req.Channels[b.ID]
+		if !picked {
+			channel = defaultChannel(&b)
+		}
+		to, why := s.payoutRecipient(b, channel)
+		if why != "" && picked {
+			httpError(w, r, fmt.Sprintf("beneficiary %s %s", b.ID, why), http.StatusBadRequest)
+			return
+		}
+		if why != "" {
+			s.logEvent(ctx, "warn", "zakat_distribute_skipped",
+				fmt.Sprintf("beneficiary %s %s", b.ID, why), r.RemoteAddr)
+			continue
+		}
+		if channel == channelWallet {
+			channel = ""
+		}
+		payable = append(payable, b)
+		payTo = append(payTo, to)
+		payMethod = append(payMethod, channel)
+		recipients = append(recipients, zakat.Recipient{ID: b.ID, Category: b.Category, NeedsScore: b.NeedsScore})
+	}
+	if len(payable) == 0 {
+		httpError(w, r, "no approved beneficiaries", http.StatusBadRequest)
+		return
+	}
+
+	pool, err := s.zakatAddressFor(ctx, tenant)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	poolHash, _ := blockchain.DecodeAddress(pool)
+
+	var priv ecdsa.PrivateKey
+	if !req.DryRun {
+		dBytes, err := hex.DecodeString(req.PrivKey)
+		if err != nil || len(dBytes) == 0 {
+			httpError(w, r, "invalid private key", http.StatusBadRequest)
+			return
+		}
+		priv = blockchain.BigIntToPrivateKey(dBytes, blockchain.GetDefaultCurve())
+		if !blockchain.KeyControlsAddress(&priv.PublicKey, pool) {
+			s.logEvent(ctx, "warn", "sender_mismatch",
+				fmt.Sprintf("zakat distribution with a key of %s, not the pool %s", blockchain.AddressOf(&priv.PublicKey), pool), r.RemoteAddr)
+			httpError(w, r, "private key does not match the zakat pool", http.StatusForbidden)
+			return
+		}
+		if !s.requireTransactionPIN(w, r, pool, req.PIN) {
+			return
+		}
+	}
+
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+
+	balance, spendable := s.UTXO.FindSpendableOutputsExcluding(poolHash, math.MaxInt, s.reservedOutputs())
+	amount := req.Amount
+	if amount == 0 {
+		amount = balance
+	}
+	resp := distributeResponse{
+		PoolAddress:   pool,
+		PoolBalance:   balance,
+		Amount:        amount,
+		PolicyVersion: version,
+		Distribution:  dist,
+		Payouts:       []distributionPayout{},
+		DryRun:        req.DryRun,
+	}
+	if amount == 0 {
+		httpError(w, r, "nothing to distribute", http.StatusBadRequest)
+		return
+	}
+	if amount > balance {
+		httpError(w, r, insufficientPoolFunds(pool), http.StatusBadRequest)
+		return
+	}
+
+	parts, left := dist.Allocate(amount, recipients)
+	var payments []blockchain.Payment
+	for i, part := range parts {
+		if part == 0 {
+			continue
+		}
+		b := payable[i]
+		resp.Payouts = append(resp.Payouts, distributionPayout{
+			BeneficiaryID: b.ID,
+			FullName:      b.FullName,
+			Category:      b.Category,
+			WalletAddress: payTo[i].To,
+			PayoutMethod:  payMethod[i],
+			Burned:        payTo[i].Burn,
+			NeedsScore:    b.NeedsScore,
+			Amount:        part,
+		})
+		pay := payTo[i]
+		pay.Amount = part
+		payments = append(payments, pay)
+		resp.Distributed += part
+	}
+	resp.Undistributed = left
+	if len(payments) == 0 {
+		if left == amount {
+			// every category with a share lacks approved beneficiaries
+			httpError(w, r, "no approved beneficiaries", http.StatusBadRequest)
+			return
+		}
+		httpError(w, r, "amount too small to split", http.StatusBadRequest)
+		return
+	}
+	if req.DryRun {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	resp.DistributionID = uuid.NewString()
+	if denial := s.askPolicyHooks(ctx, s.distributionAction(ctx, resp)); denial != nil {
+		httpError(w, r, denial.Reason, http.StatusForbidden)
+		return
+	}
+	tx, err := blockchain.NewSplitTransaction(priv, payments, s.BC, spendable, poolHash, balance)
+	if err != nil {
+		httpError(w, r, "failed to create transaction", http.StatusBadRequest)
+		return
+	}
+	noteAuditTx(ctx, tx.ID)
+	if !s.BC.VerifyTransaction(tx) {
+		httpError(w, r, "invalid transaction", http.StatusBadRequest)
+		return
+	}
+	if err := s.BC.CheckPolicy(ctx, tx); err != nil {
+		policyError(w, r, err)
+		return
+	}
+	newBlock, err := s.BC.AddBlockContext(ctx, []*blockchain.Transaction{tx})
+	if err != nil {
+		mineError(w, r, err)
+		return
+	}
+	height := len(s.BC.Blocks) - 1
+	s.reports.invalidateBlock(newBlock)
+	_ = s.UTXO.Reindex()
+	s.persistMinedBlock(newBlock, height, []*blockchain.Transaction{tx}, "disbursement")
+
+	resp.TxID = fmt.Sprintf("%x", tx.ID)
+	resp.BlockHash = fmt.Sprintf("%x", newBlock.Hash)
+	resp.BlockHeight = height
+
+	byID := make(map[string]models.Beneficiary, len(payable))
+	for _, b := range payable {
+		byID[b.ID] = b
+	}
+	now := s.Clock.Now().UTC()
+	records := make([]models.Disbursement, 0, len(resp.Payouts))
+	for _, p := range resp.Payouts {
+		// the score is copied so that a later re-assessment does not
+		// change why this payment was weighed as it was
+		b := byID[p.BeneficiaryID]
+		records = append(records, models.Disbursement{
+			ID:             uuid.NewString(),
+			TenantID:       tenant,
+			DistributionID: resp.DistributionID,
+			BeneficiaryID:  p.BeneficiaryID,
+			WalletAddress:  p.WalletAddress,
+			PayoutMethod:   p.PayoutMethod,
+			Category:       p.Category,
+			NeedsScore:     b.NeedsScore,
+			ScoreCriteria:  b.ScoreCriteria,
+			Amount:         p.Amount,
+			PoolAddress:    pool,
+			Method:         dist.Method,
+			PolicyVersion:  version,
+			TxID:           resp.TxID,
+			BlockHash:      resp.BlockHash,
+			CreatedBy:      adminName(ctx),
+			CreatedAt:      now,
+		})
+	}
+	if err := s.DB.CreateDisbursements(ctx, records); err != nil {
+		// the payment is on chain; the records can be rebuilt from it
+		s.logEvent(ctx, "error", "disbursement_save_failed",
+			fmt.Sprintf("distribution %s in tx %s: %v", resp.DistributionID, resp.TxID, err), r.RemoteAddr)
+	}
+	s.recordPayouts(ctx, records, byID, r.RemoteAddr)
+
+	s.logEvent(ctx, "info", "zakat_distributed",
+		fmt.Sprintf("distribution %s paid %d of %d from %s to %d beneficiaries (%s, policy version %d) in tx %s by %s",
+			resp.DistributionID, resp.Distributed, amount, pool, len(payments), dist.Method, version, resp.TxID, adminName(ctx)), r.RemoteAddr)
+	for _, p := range payments {
+		if !p.Burn {
+			s.notifyIncomingFunds(p.To, p.Amount)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// ListDisbursements returns the tenant's recorded disbursements, newest
+// first, optionally only those to ?beneficiary_id= and at most ?limit=.
+func (s *Server) ListDisbursements(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	limit := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 0 {
+			httpError(w, r, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	list, err := s.DB.ListDisbursements(ctx, tenantID(ctx), r.URL.Query().Get("beneficiary_id"), limit)
+	if err != nil {
+		httpError(w, r, "failed to load disbursements", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "disbursement_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if list == nil {
+		list = []models.Disbursement{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(disbursementsResponse{Disbursements: list})
+}
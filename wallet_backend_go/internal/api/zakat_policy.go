@@ -0,0 +1,203 @@
+package api
+
+// zakat_policy.go stores each tenant's declarative zakat policy and
+// resolves the policy zakat runs, auto zakat and the user projection
+// evaluate. Policies are versioned in the zakat_policies table: saving
+// a policy appends a new version, the highest version is in force, and
+// a run keeps applying the version it started with when resumed. A
+// tenant without a stored policy uses zakat.Default with ZAKAT_NISAB
+// (version 0).
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"wallet_backend_go/internal/i18n"
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/zakat"
+)
+
+type zakatPolicyRequest struct {
+	Policy    zakat.Policy `json:"policy"`
+	CreatedBy string       `json:"created_by"`
+}
+
+type zakatPolicyResponse struct {
+	Version   int          `json:"version"` // 0 for the built-in default
+	Policy    zakat.Policy `json:"policy"`
+	CreatedBy string       `json:"created_by,omitempty"`
+	CreatedAt *time.Time   `json:"created_at,omitempty"`
+}
+
+type zakatPolicyVersionsResponse struct {
+	Versions []zakatPolicyResponse `json:"versions"`
+}
+
+// zakatPolicyFor returns version of the tenant's policy, or the policy
+// in force when version is 0, together with its version number.
+func (s *Server) zakatPolicyFor(ctx context.Context, tenant string, version int) (zakat.Policy, int, error) {
+	if s.DB == nil {
+		return zakat.Default(nisabThreshold()), 0, nil
+	}
+
+	stored, err := s.DB.GetZakatPolicy(ctx, tenant, version)
+	if err != nil {
+		return zakat.Policy{}, 0, err
+	}
+	if stored == nil {
+		if version > 0 {
+			return zakat.Policy{}, 0, fmt.Errorf("zakat policy version %d not found", version)
+		}
+		return zakat.Default(nisabThreshold()), 0, nil
+	}
+
+	policy, err := zakat.Parse(stored.Document)
+	if err != nil {
+		return zakat.Policy{}, 0, fmt.Errorf("zakat policy version %d: %w", stored.Version, err)
+	}
+	return policy, stored.Version, nil
+}
+
+// policyResponse converts a stored version for the API.
+func policyResponse(p models.ZakatPolicy) (zakatPolicyResponse, error) {
+	policy, err := zakat.Parse(p.Document)
+	if err != nil {
+		return zakatPolicyResponse{}, err
+	}
+	createdAt := p.CreatedAt
+	return zakatPolicyResponse{Version: p.Version, Policy: policy, CreatedBy: p.CreatedBy, CreatedAt: &createdAt}, nil
+}
+
+// GetZakatPolicy returns the zakat policy in force for the tenant.
+func (s *Server) GetZakatPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	stored, err := s.DB.GetZakatPolicy(ctx, tenantID(ctx), 0)
+	if err != nil {
+		httpError(w, r, "failed to load zakat policy", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "zakat_policy_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	resp := zakatPolicyResponse{Policy: zakat.Default(nisabThreshold())}
+	if stored != nil {
+		if resp, err = policyResponse(*stored); err != nil {
+			httpError(w, r, "failed to load zakat policy", http.StatusInternalServerError)
+			s.logEvent(ctx, "error", "zakat_policy_get_failed", err.Error(), r.RemoteAddr)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// ListZakatPolicyVersions returns every stored version of the tenant's
+// policy, newest first.
+func (s *Server) ListZakatPolicyVersions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	stored, err := s.DB.ListZakatPolicies(ctx, tenantID(ctx))
+	if err != nil {
+		httpError(w, r, "failed to load zakat policy", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "zakat_policy_list_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	resp := zakatPolicyVersionsResponse{Versions: []zakatPolicyResponse{}}
+	for _, p := range stored {
+		v, err := policyResponse(p)
+		if err != nil {
+			s.logEvent(ctx, "error", "zakat_policy_invalid",
+				fmt.Sprintf("version %d: %v", p.Version, err), r.RemoteAddr)
+			continue
+		}
+		resp.Versions = append(resp.Versions, v)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// SaveZakatPolicy validates a policy document and stores it as the
+// tenant's next version.
+func (s *Server) SaveZakatPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tenant := tenantID(ctx)
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req zakatPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Policy.Validate(); err != nil {
+		httpError(w, r, i18n.Tf(lang(r), "invalid zakat policy: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	latest, err := s.DB.GetZakatPolicy(ctx, tenant, 0)
+	if err != nil {
+		httpError(w, r, "failed to load zakat policy", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "zakat_policy_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	version := 1
+	if latest != nil {
+		version = latest.Version + 1
+	}
+
+	doc, err := json.Marshal(req.Policy)
+	if err != nil {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	p := &models.ZakatPolicy{
+		ID:        uuid.NewString(),
+		TenantID:  tenant,
+		Version:   version,
+		Document:  doc,
+		CreatedBy: req.CreatedBy,
+		CreatedAt: s.Clock.Now().UTC(),
+	}
+	if p.CreatedBy == "" {
+		p.CreatedBy = adminName(ctx)
+	}
+	if err := s.DB.CreateZakatPolicy(ctx, p); err != nil {
+		httpError(w, r, "failed to save zakat policy", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "zakat_policy_save_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+
+	s.logEvent(ctx, "info", "zakat_policy_saved",
+		fmt.Sprintf("zakat policy version %d saved for tenant %q by %q", version, tenant, p.CreatedBy),
+		r.RemoteAddr,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(zakatPolicyResponse{
+		Version:   p.Version,
+		Policy:    req.Policy,
+		CreatedBy: p.CreatedBy,
+		CreatedAt: &p.CreatedAt,
+	})
+}
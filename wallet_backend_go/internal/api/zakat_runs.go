@@ -0,0 +1,577 @@
+package api
+
+// zakat_runs.go implements zakat runs. Each run is persisted in the
+// zakat_runs table together with one zakat_run_items row per wallet,
+// and every item moves through pending -> processing -> done/skipped/
+// failed as the run progresses. If the process crashes midway, or some
+// wallets fail, the run can be resumed: items that are not yet done are
+// processed again, and items caught in "processing" are first checked
+// against zakat_records so a wallet is never deducted twice.
+//
+// Only one run (new or resumed) executes at a time; concurrent attempts
+// get 409 Conflict. Clients may supply their own run_id so that retrying
+// a request returns the existing run instead of deducting again.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"wallet_backend_go/internal/db"
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/zakat"
+)
+
+// zakatRunGuard ensures that only one zakat run executes at a time.
+type zakatRunGuard struct {
+	mu     sync.Mutex
+	active string // id of the executing run, "" when idle
+}
+
+// acquire marks runID as executing. If another run is already
+// executing it returns that run's id and false.
+func (g *zakatRunGuard) acquire(runID string) (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.active != "" {
+		return g.active, false
+	}
+	g.active = runID
+	return "", true
+}
+
+// release marks the guard idle again.
+func (g *zakatRunGuard) release() {
+	g.mu.Lock()
+	g.active = ""
+	g.mu.Unlock()
+}
+
+type zakatRunRequest struct {
+	RunID string `json:"run_id"` // optional client-chosen idempotency id (uuid)
+}
+
+// zakatRunFailure reports a wallet whose deduction failed.
+type zakatRunFailure struct {
+	WalletAddress string `json:"wallet_address"`
+	Error         string `json:"error"`
+}
+
+// Zakat run response
+type zakatRunResponse struct {
+	RunID        string            `json:"run_id"`
+	Status       string            `json:"status"`
+	TotalWallets int               `json:"total_wallets"`
+	Processed    int               `json:"processed"`
+	Failed       int               `json:"failed"`
+	TotalZakat   int               `json:"total_zakat"`
+	BlockHashes  []string          `json:"block_hashes"`
+	Failures     []zakatRunFailure `json:"failures"`
+	Anomalies    []string          `json:"anomalies,omitempty"`
+}
+
+type zakatRunDetailResponse struct {
+	Run   *models.ZakatRun      `json:"run"`
+	Items []models.ZakatRunItem `json:"items"`
+}
+
+// RunZakat calculates the zakat due on each wallet under the tenant's
+// zakat policy and sends it to the Zakat pool wallet.
+func (s *Server) RunZakat(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	// optional client-supplied run id makes retries idempotent
+	var req zakatRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		httpError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.RunID == "" {
+		req.RunID = uuid.NewString()
+	} else if _, err := uuid.Parse(req.RunID); err != nil {
+		httpError(w, r, "run_id must be a uuid", http.StatusBadRequest)
+		return
+	}
+
+	if active, ok := s.zakatGuard.acquire(req.RunID); !ok {
+		httpError(w, r, fmt.Sprintf("zakat run %s is already in progress", active), http.StatusConflict)
+		return
+	}
+	defer s.zakatGuard.release()
+	held := s.lockZakatRun(w, r)
+	if held == nil {
+		return
+	}
+	defer held.Release()
+
+	existing, err := s.DB.GetZakatRun(ctx, req.RunID)
+	if err != nil {
+		httpError(w, r, "failed to load zakat run", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "zakat_run_get_failed", err.Error(), r.RemoteAddr)
+		return
+	}
+	if existing != nil {
+		// replayed request: report the stored run instead of deducting again
+		items, err := s.DB.ListZakatRunItems(ctx, existing.ID)
+		if err != nil {
+			httpError(w, r, "failed to load zakat run", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(summarizeZakatRun(existing, items))
+		return
+	}
+
+	resp, err := s.startZakatRun(ctx, zakatRunStart{ID: req.RunID, Tenant: tenantID(ctx), Trigger: models.ZakatTriggerManual}, r.RemoteAddr)
+	var startErr *zakatRunStartError
+	if errors.As(err, &startErr) {
+		httpError(w, r, startErr.msg, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status == models.ZakatRunPaused {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// zakatRunStart describes a new zakat run.
+type zakatRunStart struct {
+	ID           string
+	Tenant       string
+	Trigger      string
+	ScheduledFor *time.Time
+	// include selects the wallets the run deducts; nil selects all
+	include func(wp *models.WalletProfile, policy zakat.Policy) bool
+}
+
+// zakatRunStartError is returned when a run could not be started. msg
+// is the message reported to clients.
+type zakatRunStartError struct {
+	msg string
+	err error
+}
+
+func (e *zakatRunStartError) Error() string { return e.msg + ": " + e.err.Error() }
+func (e *zakatRunStartError) Unwrap() error { return e.err }
+
+// startZakatRun persists a new run of the tenant's wallets and, unless
+// the anomaly checks pause it, deducts it. The caller holds the zakat
+// run guard and lock.
+func (s *Server) startZakatRun(ctx context.Context, start zakatRunStart, ip string) (zakatRunResponse, error) {
+	// zakat pool of the tenant (or ZAKAT_WALLET_ADDRESS)
+	tenant := start.Tenant
+	zakatAddress, err := s.zakatAddressFor(ctx, tenant)
+	if err != nil {
+		return zakatRunResponse{}, &zakatRunStartError{msg: err.Error(), err: err}
+	}
+
+	// zakat policy in force; the run records its version
+	policy, policyVersion, err := s.zakatPolicyFor(ctx, tenant, 0)
+	if err != nil {
+		s.logEvent(ctx, "error", "zakat_policy_get_failed", err.Error(), ip)
+		return zakatRunResponse{}, &zakatRunStartError{msg: "failed to load zakat policy", err: err}
+	}
+
+	// 1) Fetch the tenant's wallet profiles from Supabase
+	profiles, err := s.DB.ListWalletProfiles(ctx, tenant)
+	if err != nil {
+		s.logEvent(ctx, "error", "zakat_list_wallets_failed", err.Error(), ip)
+		return zakatRunResponse{}, &zakatRunStartError{msg: "failed to list wallet profiles", err: err}
+	}
+	if start.include != nil {
+		selected := profiles[:0]
+		for i := range profiles {
+			if start.include(&profiles[i], policy) {
+				selected = append(selected, profiles[i])
+			}
+		}
+		profiles = selected
+	}
+
+	// 2) Persist the run and one pending item per wallet before touching the chain
+	now := s.Clock.Now().UTC()
+	run := &models.ZakatRun{
+		ID:                 start.ID,
+		TenantID:           tenant,
+		ZakatWalletAddress: zakatAddress,
+		Status:             models.ZakatRunRunning,
+		TotalWallets:       len(profiles),
+		PolicyVersion:      policyVersion,
+		Trigger:            start.Trigger,
+		ScheduledFor:       start.ScheduledFor,
+		StartedAt:          now,
+	}
+
+	items := make([]models.ZakatRunItem, 0, len(profiles))
+	byAddress := make(map[string]*models.WalletProfile, len(profiles))
+	for i := range profiles {
+		wp := &profiles[i]
+		byAddress[wp.WalletAddress] = wp
+		items = append(items, models.ZakatRunItem{
+			ID:            uuid.NewString(),
+			RunID:         run.ID,
+			WalletAddress: wp.WalletAddress,
+			UserID:        wp.UserID,
+			Status:        models.ZakatItemPending,
+			UpdatedAt:     now,
+		})
+	}
+
+	if err := s.DB.CreateZakatRun(ctx, run, items); err != nil {
+		s.logEvent(ctx, "error", "zakat_run_create_failed", err.Error(), ip)
+		return zakatRunResponse{}, &zakatRunStartError{msg: "failed to create zakat run", err: err}
+	}
+
+	// 3) Pause for admin review if the planned deductions look wrong
+	anomalies, err := s.detectZakatRunAnomalies(ctx, run, byAddress, policy)
+	if err != nil {
+		s.logEvent(ctx, "error", "zakat_run_anomaly_check_failed", err.Error(), ip)
+	}
+	if len(anomalies) > 0 {
+		run.Status = models.ZakatRunPaused
+		run.Anomalies = anomalies
+		s.metrics.zakatRuns.Inc(run.Status)
+		if err := s.DB.UpdateZakatRun(ctx, run); err != nil {
+			s.logEvent(ctx, "error", "zakat_run_update_failed", err.Error(), ip)
+			return zakatRunResponse{}, &zakatRunStartError{msg: "failed to update zakat run", err: err}
+		}
+		for _, a := range anomalies {
+			s.logEvent(ctx, "warn", "zakat_run_anomaly",
+				fmt.Sprintf("zakat run %s paused: %s", run.ID, a),
+				ip,
+			)
+		}
+		return summarizeZakatRun(run, items), nil
+	}
+
+	// 4) Deduct wallet by wallet
+	return s.processZakatRun(ctx, run, items, byAddress, ip), nil
+}
+
+// ResumeZakatRun continues a zakat run that was interrupted or left
+// wallets in the failed state.
+func (s *Server) ResumeZakatRun(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	if active, ok := s.zakatGuard.acquire(id); !ok {
+		httpError(w, r, fmt.Sprintf("zakat run %s is already in progress", active), http.StatusConflict)
+		return
+	}
+	defer s.zakatGuard.release()
+	held := s.lockZakatRun(w, r)
+	if held == nil {
+		return
+	}
+	defer held.Release()
+
+	run, items, ok := s.loadZakatRun(w, r, id)
+	if !ok {
+		return
+	}
+	if run.Status == models.ZakatRunCompleted {
+		httpError(w, r, "zakat run already completed", http.StatusConflict)
+		return
+	}
+	if run.Status == models.ZakatRunPaused {
+		httpError(w, r, "zakat run is paused for review", http.StatusConflict)
+		return
+	}
+
+	s.logEvent(ctx, "info", "zakat_run_resumed",
+		fmt.Sprintf("resuming zakat run %s by %s", run.ID, adminName(ctx)),
+		r.RemoteAddr,
+	)
+
+	resp := s.processZakatRun(ctx, run, items, nil, r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// GetZakatRun returns a zakat run with its per-wallet items.
+func (s *Server) GetZakatRun(w http.ResponseWriter, r *http.Request) {
+	if s.DB == nil {
+		httpError(w, r, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	run, items, ok := s.loadZakatRun(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(zakatRunDetailResponse{Run: run, Items: items})
+}
+
+// loadZakatRun fetches a run of the requesting tenant and its items,
+// writing an error response and returning false on failure.
+func (s *Server) loadZakatRun(w http.ResponseWriter, r *http.Request, id string) (*models.ZakatRun, []models.ZakatRunItem, bool) {
+	ctx := r.Context()
+
+	run, err := s.DB.GetZakatRun(ctx, id)
+	if err != nil {
+		httpError(w, r, "failed to load zakat run", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "zakat_run_get_failed", err.Error(), r.RemoteAddr)
+		return nil, nil, false
+	}
+	if run == nil || (tenantID(ctx) != "" && run.TenantID != tenantID(ctx)) {
+		httpError(w, r, "zakat run not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	items, err := s.DB.ListZakatRunItems(ctx, run.ID)
+	if err != nil {
+		httpError(w, r, "failed to load zakat run", http.StatusInternalServerError)
+		s.logEvent(ctx, "error", "zakat_run_items_failed", err.Error(), r.RemoteAddr)
+		return nil, nil, false
+	}
+	return run, items, true
+}
+
+// processZakatRun deducts zakat for every item of the run that is not
+// yet done or skipped, then updates the run record. Deductions follow
+// the policy version recorded on the run. profiles may hold already
+// loaded wallet profiles keyed by address; missing profiles are fetched
+// from Supabase.
+func (s *Server) processZakatRun(ctx context.Context, run *models.ZakatRun, items []models.ZakatRunItem, profiles map[string]*models.WalletProfile, ip string) zakatRunResponse {
+	policy, _, policyErr := s.zakatPolicyFor(ctx, run.TenantID, run.PolicyVersion)
+	if policyErr != nil {
+		s.logEvent(ctx, "error", "zakat_policy_get_failed", policyErr.Error(), ip)
+	}
+
+	// block, transaction and zakat record rows are written in bulk;
+	// receipts go out once a record is stored
+	batch := db.NewBatch(s.DB)
+	batch.AfterZakat = func(zr models.ZakatRecord) { s.notifyZakatReceipt(&zr) }
+
+	for i := range items {
+		item := &items[i]
+		switch item.Status {
+		case models.ZakatItemDone, models.ZakatItemSkipped:
+			continue
+		case models.ZakatItemProcessing:
+			// interrupted mid-deduction: the block may already be mined
+			if s.recoverZakatItem(ctx, run, item) {
+				continue
+			}
+		}
+
+		if policyErr != nil {
+			// never deduct under a different policy than the run started with
+			s.finishZakatItem(ctx, item, models.ZakatItemFailed, 0, "", policyErr.Error(), ip)
+			continue
+		}
+		s.processZakatItem(ctx, run, item, profiles[item.WalletAddress], policy, ip, batch)
+	}
+	if err := batch.Flush(ctx); err != nil {
+		s.logEvent(ctx, "error", "zakat_run_flush_failed", fmt.Sprintf("zakat run %s: %v", run.ID, err), ip)
+	}
+
+	resp := summarizeZakatRun(run, items)
+	resp.Status = models.ZakatRunCompleted
+	if resp.Failed > 0 {
+		resp.Status = models.ZakatRunPartial
+	}
+
+	finished := s.Clock.Now().UTC()
+	run.Status = resp.Status
+	s.metrics.zakatRuns.Inc(run.Status)
+	run.TotalWallets = resp.TotalWallets
+	run.Processed = resp.Processed
+	run.Failed = resp.Failed
+	run.TotalZakat = resp.TotalZakat
+	run.FinishedAt = &finished
+	s.anchorZakatRun(ctx, run, items, ip)
+	if err := s.DB.UpdateZakatRun(ctx, run); err != nil {
+		s.logEvent(ctx, "error", "zakat_run_update_failed", err.Error(), ip)
+	}
+
+	s.logEvent(ctx, "info", "zakat_run",
+		fmt.Sprintf("zakat run %s tenant=%q status=%s processed=%d failed=%d total_zakat=%d",
+			run.ID, run.TenantID, run.Status, run.Processed, run.Failed, run.TotalZakat),
+		ip,
+	)
+
+	return resp
+}
+
+// summarizeZakatRun aggregates the per-wallet items of a run into the
+// response body. Status is taken from the stored run.
+func summarizeZakatRun(run *models.ZakatRun, items []models.ZakatRunItem) zakatRunResponse {
+	resp := zakatRunResponse{
+		RunID:        run.ID,
+		Status:       run.Status,
+		TotalWallets: len(items),
+		BlockHashes:  []string{},
+		Failures:     []zakatRunFailure{},
+		Anomalies:    run.Anomalies,
+	}
+	for _, item := range items {
+		// nothing has been attempted yet while a run awaits review
+		if run.Status == models.ZakatRunPaused {
+			break
+		}
+		switch item.Status {
+		case models.ZakatItemDone:
+			resp.Processed++
+			resp.TotalZakat += item.Amount
+			resp.BlockHashes = append(resp.BlockHashes, item.BlockHash)
+		case models.ZakatItemFailed, models.ZakatItemPending, models.ZakatItemProcessing:
+			resp.Failed++
+			resp.Failures = append(resp.Failures, zakatRunFailure{WalletAddress: item.WalletAddress, Error: item.Error})
+		}
+	}
+	return resp
+}
+
+// processZakatItem deducts zakat for a single wallet of the run, as
+// assessed by policy, and records the outcome on the item.
+func (s *Server) processZakatItem(ctx context.Context, run *models.ZakatRun, item *models.ZakatRunItem, wp *models.WalletProfile, policy zakat.Policy, ip string, batch *db.Batch) {
+	if wp == nil {
+		loaded, err := s.DB.GetWalletProfileByAddress(ctx, item.WalletAddress)
+		if err != nil {
+			s.finishZakatItem(ctx, item, models.ZakatItemFailed, 0, "", err.Error(), ip)
+			return
+		}
+		wp = loaded
+	}
+	if wp == nil || wp.Status == models.WalletStatusDeactivated {
+		s.finishZakatItem(ctx, item, models.ZakatItemSkipped, 0, "", "wallet inactive or missing", ip)
+		return
+	}
+
+	// compute balance
+	balance, _, err := s.balanceForAddress(wp.WalletAddress)
+	if err != nil {
+		s.logEvent(ctx, "error", "zakat_balance_failed", err.Error(), ip)
+		s.finishZakatItem(ctx, item, models.ZakatItemFailed, 0, "", err.Error(), ip)
+		return
+	}
+
+	assessment := policy.Assess(zakat.AssetCash, balance)
+	if assessment.Reason == zakat.ReasonBelowNisab {
+		s.finishZakatItem(ctx, item, models.ZakatItemSkipped, 0, "", "below nisab", ip)
+		return
+	}
+
+	zakatAmount := assessment.Amount
+	if zakatAmount <= 0 {
+		s.finishZakatItem(ctx, item, models.ZakatItemSkipped, 0, "", "", ip)
+		return
+	}
+
+	// the item is marked "processing" with the id of its transaction
+	// before the block is mined, so that recovery can find the
+	// deduction on chain even when its zakat record was never stored;
+	// without this durable marker a crash could double-deduct
+	markInFlight := func(txid string) error {
+		item.Status = models.ZakatItemProcessing
+		item.Amount = zakatAmount
+		item.TxID = txid
+		item.UpdatedAt = s.Clock.Now().UTC()
+		return s.DB.UpdateZakatRunItem(ctx, item)
+	}
+	blockHash, err := s.deductZakat(ctx, wp, zakatAmount, run.ZakatWalletAddress, run.ID, ip, batch, markInFlight)
+	if err != nil {
+		s.finishZakatItem(ctx, item, models.ZakatItemFailed, 0, "", err.Error(), ip)
+		return
+	}
+	s.finishZakatItem(ctx, item, models.ZakatItemDone, zakatAmount, blockHash, "", ip)
+}
+
+// recoverZakatItem resolves an item left in "processing" by a crash. If
+// the item's transaction is on chain, or a zakat record for this run
+// already exists, the item is marked done and true is returned;
+// otherwise the item must be processed again. Items marked before
+// transaction ids were recorded only have the zakat record to go by.
+func (s *Server) recoverZakatItem(ctx context.Context, run *models.ZakatRun, item *models.ZakatRunItem) bool {
+	records, err := s.DB.ListZakatByWallet(ctx, item.WalletAddress)
+	if err != nil {
+		return false
+	}
+	for _, zr := range records {
+		if zr.RunID == run.ID {
+			s.finishZakatItem(ctx, item, models.ZakatItemDone, zr.Amount, zr.BlockHash, "", "recovery")
+			return true
+		}
+	}
+	if item.TxID == "" {
+		return false
+	}
+
+	blockHash := s.zakatTxBlock(item.TxID)
+	if blockHash == "" {
+		// never mined: its inputs are still unspent
+		return false
+	}
+	// mined, but the zakat record was lost with the crash
+	zr := &models.ZakatRecord{
+		ID:            uuid.NewString(),
+		UserID:        item.UserID,
+		TenantID:      run.TenantID,
+		WalletAddress: item.WalletAddress,
+		Amount:        item.Amount,
+		BlockHash:     blockHash,
+		RunID:         run.ID,
+		CreatedAt:     s.Clock.Now().UTC(),
+	}
+	if err := s.DB.SaveZakatRecord(ctx, zr); err != nil {
+		s.logEvent(ctx, "error", "zakat_record_save_failed", err.Error(), "recovery")
+	}
+	s.logEvent(ctx, "warn", "zakat_run_item_recovered",
+		fmt.Sprintf("zakat run %s: deduction of %d from %s found on chain in tx %s, block %s",
+			run.ID, item.Amount, item.WalletAddress, item.TxID, blockHash), "recovery")
+	s.finishZakatItem(ctx, item, models.ZakatItemDone, item.Amount, blockHash, "", "recovery")
+	return true
+}
+
+// zakatTxBlock returns the hex hash of the block holding the
+// transaction txid, or "" when it is not on chain.
+func (s *Server) zakatTxBlock(txid string) string {
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+
+	for _, b := range s.BC.Blocks {
+		for _, tx := range b.Transactions {
+			if fmt.Sprintf("%x", tx.ID) == txid {
+				return fmt.Sprintf("%x", b.Hash)
+			}
+		}
+	}
+	return ""
+}
+
+// finishZakatItem stores the final state of a run item.
+func (s *Server) finishZakatItem(ctx context.Context, item *models.ZakatRunItem, status string, amount int, blockHash, errMsg, ip string) {
+	item.Status = status
+	item.Amount = amount
+	item.BlockHash = blockHash
+	item.Error = errMsg
+	item.UpdatedAt = s.Clock.Now().UTC()
+	if err := s.DB.UpdateZakatRunItem(ctx, item); err != nil {
+		s.logEvent(ctx, "error", "zakat_run_item_update_failed", err.Error(), ip)
+	}
+	s.recordZakatItem(status, amount)
+}
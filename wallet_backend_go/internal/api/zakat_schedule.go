@@ -0,0 +1,218 @@
+package api
+
+// zakat_schedule.go starts zakat runs automatically. ZAKAT_SCHEDULE is
+// a cron expression evaluated in UTC, such as "0 3 1 9 *", or
+// "anniversary", which starts a run every day covering the wallets
+// whose hawl anniversary it is. Runs start once per tenant listed in
+// ZAKAT_SCHEDULE_TENANTS, or once unscoped like a request without
+// X-Tenant-ID.
+//
+// A scheduled run's id is derived from its tenant and the schedule slot
+// it belongs to, so every instance and every restart agree on it: a
+// slot whose run exists is never started again, and a run that the
+// process left "running" when it stopped is resumed, with the recovery
+// of resumed runs keeping wallets from being deducted twice. Runs that
+// are paused for review or finished as partial wait for an
+// administrator, like manual runs.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"wallet_backend_go/internal/lock"
+	"wallet_backend_go/internal/models"
+	"wallet_backend_go/internal/zakat"
+)
+
+const (
+	zakatScheduleTick = time.Minute
+	// a slot is only started this long after it is due, so that
+	// enabling a yearly schedule does not deduct at once for a slot
+	// months in the past
+	zakatScheduleGrace = 24 * time.Hour
+)
+
+// zakatScheduleNamespace derives the ids of scheduled runs.
+var zakatScheduleNamespace = uuid.MustParse("6f1c1c2e-8f4b-4b9a-9d57-2a9e5f0c7d31")
+
+// zakatSchedule is the configured schedule of automatic zakat runs.
+type zakatSchedule struct {
+	sched   zakat.RunSchedule
+	tenants []string // "" is the unscoped run
+}
+
+// zakatScheduleFromEnv reads ZAKAT_SCHEDULE and ZAKAT_SCHEDULE_TENANTS.
+// It returns nil when no schedule is configured.
+func zakatScheduleFromEnv() (*zakatSchedule, error) {
+	spec := strings.TrimSpace(os.Getenv("ZAKAT_SCHEDULE"))
+	if spec == "" {
+		return nil, nil
+	}
+	sched, err := zakat.ParseRunSchedule(spec)
+	if err != nil {
+		return nil, err
+	}
+	zs := &zakatSchedule{sched: sched}
+	for _, t := range strings.Split(os.Getenv("ZAKAT_SCHEDULE_TENANTS"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			zs.tenants = append(zs.tenants, t)
+		}
+	}
+	if len(zs.tenants) == 0 {
+		zs.tenants = []string{""}
+	}
+	return zs, nil
+}
+
+// startZakatSchedule starts the zakat scheduler if ZAKAT_SCHEDULE is set.
+func (s *Server) startZakatSchedule() {
+	zs, err := zakatScheduleFromEnv()
+	if err != nil {
+		log.Printf("warning: ZAKAT_SCHEDULE is invalid, zakat runs are not scheduled: %v", err)
+		return
+	}
+	if zs == nil {
+		return
+	}
+	log.Printf("zakat runs scheduled: %s", zs.sched.Spec)
+	s.zakatSchedule = zs
+	go s.runZakatSchedule()
+}
+
+// runZakatSchedule checks for due zakat runs every zakatScheduleTick.
+func (s *Server) runZakatSchedule() {
+	ticker := time.NewTicker(zakatScheduleTick)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.runScheduled("zakat-schedule", s.runDueZakat)
+	}
+}
+
+// scheduledZakatRunID returns the id of the tenant's run for slot.
+func scheduledZakatRunID(tenant string, slot time.Time) string {
+	return uuid.NewSHA1(zakatScheduleNamespace, []byte(tenant+"|"+slot.UTC().Format(time.RFC3339))).String()
+}
+
+// runDueZakat starts or resumes the run of the current slot of every
+// scheduled tenant.
+func (s *Server) runDueZakat() {
+	zs := s.zakatSchedule
+	if s.DB == nil || zs == nil {
+		return
+	}
+	now := s.Clock.Now().UTC()
+	slot, ok := zs.sched.Slot(now)
+	if !ok {
+		return
+	}
+	for _, tenant := range zs.tenants {
+		s.runScheduledZakat(tenant, slot, now)
+	}
+}
+
+// runScheduledZakat makes sure the tenant's run for slot has been
+// carried out, starting or resuming it as needed.
+func (s *Server) runScheduledZakat(tenant string, slot, now time.Time) {
+	runID := scheduledZakatRunID(tenant, slot)
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Hour)
+	defer cancel()
+
+	if _, ok := s.zakatGuard.acquire(runID); !ok {
+		return // a manual run; try again on the next tick
+	}
+	defer s.zakatGuard.release()
+	held, err := lock.TryLock(ctx, s.locks, lockZakatRun, zakatRunLockTTL)
+	if err != nil {
+		log.Printf("skipping scheduled zakat run: lock failed: %v", err)
+		return
+	}
+	if held == nil {
+		return
+	}
+	defer held.Release()
+
+	existing, err := s.DB.GetZakatRun(ctx, runID)
+	if err != nil {
+		s.logEvent(ctx, "error", "zakat_run_get_failed", err.Error(), "scheduler")
+		return
+	}
+	if existing != nil {
+		if existing.Status != models.ZakatRunRunning {
+			return
+		}
+		// the process stopped midway through this run
+		items, err := s.DB.ListZakatRunItems(ctx, existing.ID)
+		if err != nil {
+			s.logEvent(ctx, "error", "zakat_run_items_failed", err.Error(), "scheduler")
+			return
+		}
+		s.logEvent(ctx, "info", "zakat_run_resumed",
+			fmt.Sprintf("resuming scheduled zakat run %s", existing.ID),
+			"scheduler",
+		)
+		s.processZakatRun(ctx, existing, items, nil, "scheduler")
+		return
+	}
+	if now.Sub(slot) > zakatScheduleGrace {
+		return
+	}
+
+	start := zakatRunStart{ID: runID, Tenant: tenant, Trigger: models.ZakatTriggerSchedule, ScheduledFor: &slot}
+	if s.zakatSchedule.sched.Anniversary {
+		start.Trigger = models.ZakatTriggerAnniversary
+		start.include = func(wp *models.WalletProfile, policy zakat.Policy) bool {
+			rule, _ := policy.Rule(zakat.AssetCash)
+			return rule.AnniversaryDue(wp.CreatedAt, slot)
+		}
+	}
+	s.logEvent(ctx, "info", "zakat_run_scheduled",
+		fmt.Sprintf("starting scheduled zakat run %s tenant=%q slot=%s", runID, tenant, slot.Format(time.RFC3339)),
+		"scheduler",
+	)
+	if _, err := s.startZakatRun(ctx, start, "scheduler"); err != nil {
+		log.Printf("scheduled zakat run %s failed to start: %v", runID, err)
+	}
+}
+
+type zakatScheduleResponse struct {
+	Enabled   bool       `json:"enabled"`
+	Schedule  string     `json:"schedule,omitempty"`
+	Tenants   []string   `json:"tenants,omitempty"`
+	LastSlot  *time.Time `json:"last_slot,omitempty"`
+	NextSlot  *time.Time `json:"next_slot,omitempty"`
+	LastRunID string     `json:"last_run_id,omitempty"`
+}
+
+// GetZakatSchedule describes the schedule of automatic zakat runs and
+// the id of the requesting tenant's run for the latest slot.
+func (s *Server) GetZakatSchedule(w http.ResponseWriter, r *http.Request) {
+	resp := zakatScheduleResponse{}
+	if zs := s.zakatSchedule; zs != nil {
+		now := s.Clock.Now().UTC()
+		resp.Enabled = true
+		resp.Schedule = zs.sched.Spec
+		for _, t := range zs.tenants {
+			if t != "" {
+				resp.Tenants = append(resp.Tenants, t)
+			}
+		}
+		if slot, ok := zs.sched.Slot(now); ok {
+			resp.LastSlot = &slot
+			resp.LastRunID = scheduledZakatRunID(tenantID(r.Context()), slot)
+		}
+		if next, ok := zs.sched.Next(now); ok {
+			resp.NextSlot = &next
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
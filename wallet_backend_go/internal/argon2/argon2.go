@@ -0,0 +1,327 @@
+// Package argon2 implements the Argon2id password hash (RFC 9106,
+// version 0x13) with the standard library only. IDKey has the same
+// signature and output as golang.org/x/crypto/argon2.IDKey, so the two
+// are interchangeable; this version is unoptimized and meant for short
+// secrets such as PINs, hashed with moderate memory.
+//
+// Hash and Verify wrap IDKey in the PHC string format used by other
+// Argon2 libraries:
+//
+//	$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+package argon2
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"strings"
+	"sync"
+)
+
+const (
+	version    = 0x13
+	typeID     = 2 // Argon2id
+	syncPoints = 4
+	blockWords = 128 // 1 KiB blocks
+)
+
+type block [blockWords]uint64
+
+// IDKey derives a keyLen-byte key from password and salt with Argon2id,
+// making time passes over memory KiB using threads lanes.
+func IDKey(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	return deriveKey(password, salt, nil, nil, time, memory, threads, keyLen)
+}
+
+// deriveKey is IDKey with the optional secret and associated data of
+// RFC 9106.
+func deriveKey(password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	if time < 1 {
+		panic("argon2: number of rounds too small")
+	}
+	if threads < 1 {
+		panic("argon2: parallelism degree too low")
+	}
+	p := uint32(threads)
+	h0 := initHash(password, salt, secret, data, time, memory, p, keyLen)
+
+	memory = memory / (syncPoints * p) * (syncPoints * p)
+	if memory < 2*syncPoints*p {
+		memory = 2 * syncPoints * p
+	}
+	B := initBlocks(h0, memory, p)
+	processBlocks(B, time, memory, p)
+	return extractKey(B, memory, p, keyLen)
+}
+
+func initHash(password, salt, secret, data []byte, time, memory, threads, keyLen uint32) []byte {
+	le := func(v uint32) []byte {
+		return binary.LittleEndian.AppendUint32(nil, v)
+	}
+	return blake2bSum(64,
+		le(threads), le(keyLen), le(memory), le(time), le(version), le(typeID),
+		le(uint32(len(password))), password,
+		le(uint32(len(salt))), salt,
+		le(uint32(len(secret))), secret,
+		le(uint32(len(data))), data,
+	)
+}
+
+// hashPrime is the variable-length hash H' of RFC 9106 section 3.3.
+func hashPrime(out []byte, in ...[]byte) {
+	prefix := binary.LittleEndian.AppendUint32(nil, uint32(len(out)))
+	if len(out) <= 64 {
+		copy(out, blake2bSum(len(out), append([][]byte{prefix}, in...)...))
+		return
+	}
+	v := blake2bSum(64, append([][]byte{prefix}, in...)...)
+	for len(out) > 64 {
+		copy(out, v[:32])
+		out = out[32:]
+		if len(out) > 64 {
+			v = blake2bSum(64, v)
+		}
+	}
+	copy(out, blake2bSum(len(out), v))
+}
+
+func initBlocks(h0 []byte, memory, threads uint32) []block {
+	B := make([]block, memory)
+	lanes := memory / threads
+	var buf [1024]byte
+	for lane := uint32(0); lane < threads; lane++ {
+		for i := uint32(0); i < 2; i++ {
+			hashPrime(buf[:], h0,
+				binary.LittleEndian.AppendUint32(nil, i),
+				binary.LittleEndian.AppendUint32(nil, lane))
+			for w := range B[lane*lanes+i] {
+				B[lane*lanes+i][w] = binary.LittleEndian.Uint64(buf[w*8:])
+			}
+		}
+	}
+	return B
+}
+
+func processBlocks(B []block, time, memory, threads uint32) {
+	lanes := memory / threads
+	segments := lanes / syncPoints
+
+	processSegment := func(n, slice, lane uint32) {
+		// Argon2id addresses the first half of the first pass
+		// independently of the data, like Argon2i.
+		independent := n == 0 && slice < syncPoints/2
+
+		var addresses, in, zero block
+		if independent {
+			in[0] = uint64(n)
+			in[1] = uint64(lane)
+			in[2] = uint64(slice)
+			in[3] = uint64(memory)
+			in[4] = uint64(time)
+			in[5] = uint64(typeID)
+		}
+
+		index := uint32(0)
+		if n == 0 && slice == 0 {
+			index = 2 // the first two blocks come from initBlocks
+			if independent {
+				in[6]++
+				compress(&addresses, &in, &zero, false)
+				compress(&addresses, &addresses, &zero, false)
+			}
+		}
+
+		offset := lane*lanes + slice*segments + index
+		for index < segments {
+			prev := offset - 1
+			if index == 0 && slice == 0 {
+				prev += lanes // last block of the lane
+			}
+			var random uint64
+			if independent {
+				if index%blockWords == 0 {
+					in[6]++
+					compress(&addresses, &in, &zero, false)
+					compress(&addresses, &addresses, &zero, false)
+				}
+				random = addresses[index%blockWords]
+			} else {
+				random = B[prev][0]
+			}
+			ref := indexAlpha(random, lanes, segments, threads, n, slice, lane, index)
+			compress(&B[offset], &B[prev], &B[ref], true)
+			index, offset = index+1, offset+1
+		}
+	}
+
+	for n := uint32(0); n < time; n++ {
+		for slice := uint32(0); slice < syncPoints; slice++ {
+			var wg sync.WaitGroup
+			for lane := uint32(0); lane < threads; lane++ {
+				wg.Add(1)
+				go func(lane uint32) {
+					defer wg.Done()
+					processSegment(n, slice, lane)
+				}(lane)
+			}
+			wg.Wait()
+		}
+	}
+}
+
+// indexAlpha maps a pseudo-random value to the reference block, per
+// RFC 9106 section 3.4.
+func indexAlpha(random uint64, lanes, segments, threads, n, slice, lane, index uint32) uint32 {
+	refLane := uint32(random>>32) % threads
+	if n == 0 && slice == 0 {
+		refLane = lane
+	}
+	m, s := 3*segments, ((slice+1)%syncPoints)*segments
+	if lane == refLane {
+		m += index
+	}
+	if n == 0 {
+		m, s = slice*segments, 0
+		if slice == 0 || lane == refLane {
+			m += index
+		}
+	}
+	if index == 0 || lane == refLane {
+		m--
+	}
+
+	x := random & 0xffffffff
+	x = x * x >> 32
+	x = x * uint64(m) >> 32
+	return refLane*lanes + uint32((uint64(s)+uint64(m)-(x+1))%uint64(lanes))
+}
+
+// compress is the compression function G, writing (or with xor, XORing)
+// G(x, y) into out.
+func compress(out, x, y *block, xor bool) {
+	var r block
+	for i := range r {
+		r[i] = x[i] ^ y[i]
+	}
+	z := r
+	for i := 0; i < blockWords; i += 16 {
+		blamka(&z, i, i+1, i+2, i+3, i+4, i+5, i+6, i+7, i+8, i+9, i+10, i+11, i+12, i+13, i+14, i+15)
+	}
+	for i := 0; i < blockWords/8; i += 2 {
+		blamka(&z, i, i+1, 16+i, 16+i+1, 32+i, 32+i+1, 48+i, 48+i+1,
+			64+i, 64+i+1, 80+i, 80+i+1, 96+i, 96+i+1, 112+i, 112+i+1)
+	}
+	for i := range out {
+		if xor {
+			out[i] ^= r[i] ^ z[i]
+		} else {
+			out[i] = r[i] ^ z[i]
+		}
+	}
+}
+
+// blamka is the BLAKE2b round with multiplications, applied to 16 words
+// of b.
+func blamka(b *block, w ...int) {
+	g := func(a, bb, c, d int) {
+		fBlaMka := func(x, y uint64) uint64 {
+			return x + y + 2*uint64(uint32(x))*uint64(uint32(y))
+		}
+		b[a] = fBlaMka(b[a], b[bb])
+		b[d] = bits.RotateLeft64(b[d]^b[a], -32)
+		b[c] = fBlaMka(b[c], b[d])
+		b[bb] = bits.RotateLeft64(b[bb]^b[c], -24)
+		b[a] = fBlaMka(b[a], b[bb])
+		b[d] = bits.RotateLeft64(b[d]^b[a], -16)
+		b[c] = fBlaMka(b[c], b[d])
+		b[bb] = bits.RotateLeft64(b[bb]^b[c], -63)
+	}
+	g(w[0], w[4], w[8], w[12])
+	g(w[1], w[5], w[9], w[13])
+	g(w[2], w[6], w[10], w[14])
+	g(w[3], w[7], w[11], w[15])
+	g(w[0], w[5], w[10], w[15])
+	g(w[1], w[6], w[11], w[12])
+	g(w[2], w[7], w[8], w[13])
+	g(w[3], w[4], w[9], w[14])
+}
+
+func extractKey(B []block, memory, threads, keyLen uint32) []byte {
+	lanes := memory / threads
+	final := B[memory-1]
+	for lane := uint32(0); lane < threads-1; lane++ {
+		for i, v := range B[lane*lanes+lanes-1] {
+			final[i] ^= v
+		}
+	}
+	var buf [1024]byte
+	for i, v := range final {
+		binary.LittleEndian.PutUint64(buf[i*8:], v)
+	}
+	key := make([]byte, keyLen)
+	hashPrime(key, buf[:])
+	return key
+}
+
+// Params are the cost parameters of Hash.
+type Params struct {
+	Time    uint32 // passes over memory
+	Memory  uint32 // KiB
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// DefaultParams follow the OWASP minimum for Argon2id: 19 MiB, two
+// passes, one lane.
+var DefaultParams = Params{Time: 2, Memory: 19 * 1024, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+var b64 = base64.RawStdEncoding
+
+// Hash returns the PHC-encoded Argon2id hash of password with a random
+// salt read from rand.
+func Hash(rand io.Reader, password []byte, p Params) (string, error) {
+	salt := make([]byte, p.SaltLen)
+	if _, err := io.ReadFull(rand, salt); err != nil {
+		return "", err
+	}
+	key := IDKey(password, salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		version, p.Memory, p.Time, p.Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+// ErrMalformed is returned by Verify for hashes it cannot parse.
+var ErrMalformed = errors.New("argon2: malformed hash")
+
+// maxMemory bounds the memory cost Verify accepts, so a tampered hash
+// cannot exhaust the server.
+const maxMemory = 1 << 20 // 1 GiB
+
+// Verify reports whether password matches the PHC-encoded hash.
+func Verify(encoded string, password []byte) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" || parts[2] != fmt.Sprintf("v=%d", version) {
+		return false, ErrMalformed
+	}
+	var p Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return false, ErrMalformed
+	}
+	if p.Time < 1 || p.Threads < 1 || p.Memory > maxMemory {
+		return false, ErrMalformed
+	}
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrMalformed
+	}
+	want, err := b64.DecodeString(parts[5])
+	if err != nil || len(want) == 0 {
+		return false, ErrMalformed
+	}
+	got := IDKey(password, salt, p.Time, p.Memory, p.Threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
@@ -0,0 +1,105 @@
+package argon2
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func fill(b byte, n int) []byte {
+	return bytes.Repeat([]byte{b}, n)
+}
+
+func TestBlake2b(t *testing.T) {
+	tests := []struct {
+		msg  []byte
+		want string
+	}{
+		{nil, "786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce"},
+		{[]byte("abc"), "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"},
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString(blake2bSum(64, tt.msg)); got != tt.want {
+			t.Errorf("BLAKE2b-512(%q) = %s, want %s", tt.msg, got, tt.want)
+		}
+	}
+	// parts hash as their concatenation, across block boundaries
+	long := fill('x', 3*blake2bBlockSize+7)
+	if !bytes.Equal(blake2bSum(32, long[:100], long[100:]), blake2bSum(32, long)) {
+		t.Error("BLAKE2b of split message differs from the whole")
+	}
+}
+
+// TestRFC9106 is the Argon2id test vector of RFC 9106 section 5.3.
+func TestRFC9106(t *testing.T) {
+	const want = "0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659"
+	got := deriveKey(fill(0x01, 32), fill(0x02, 16), fill(0x03, 8), fill(0x04, 12), 3, 32, 4, 32)
+	if hex.EncodeToString(got) != want {
+		t.Errorf("tag = %x, want %s", got, want)
+	}
+}
+
+func TestIDKey(t *testing.T) {
+	a := IDKey([]byte("1234"), []byte("somesalt"), 1, 64, 1, 32)
+	if len(a) != 32 {
+		t.Fatalf("key length %d, want 32", len(a))
+	}
+	if b := IDKey([]byte("1234"), []byte("somesalt"), 1, 64, 1, 32); !bytes.Equal(a, b) {
+		t.Error("IDKey is not deterministic")
+	}
+	for name, b := range map[string][]byte{
+		"password": IDKey([]byte("1235"), []byte("somesalt"), 1, 64, 1, 32),
+		"salt":     IDKey([]byte("1234"), []byte("othersalt"), 1, 64, 1, 32),
+		"time":     IDKey([]byte("1234"), []byte("somesalt"), 2, 64, 1, 32),
+		"memory":   IDKey([]byte("1234"), []byte("somesalt"), 1, 128, 1, 32),
+		"threads":  IDKey([]byte("1234"), []byte("somesalt"), 1, 64, 2, 32),
+	} {
+		if bytes.Equal(a, b) {
+			t.Errorf("changing the %s does not change the key", name)
+		}
+	}
+	// a key longer than a BLAKE2b digest goes through H'
+	if long := IDKey([]byte("1234"), []byte("somesalt"), 1, 64, 1, 100); len(long) != 100 {
+		t.Errorf("key length %d, want 100", len(long))
+	}
+}
+
+func TestHashVerify(t *testing.T) {
+	p := Params{Time: 1, Memory: 64, Threads: 1, SaltLen: 16, KeyLen: 32}
+	encoded, err := Hash(bytes.NewReader(fill(0x2a, 16)), []byte("1234"), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$KioqKioqKioqKioqKioqKg$") {
+		t.Errorf("encoded = %s, want the PHC format with the salt", encoded)
+	}
+	if ok, err := Verify(encoded, []byte("1234")); !ok || err != nil {
+		t.Errorf("Verify(right PIN) = %v, %v", ok, err)
+	}
+	if ok, err := Verify(encoded, []byte("1235")); ok || err != nil {
+		t.Errorf("Verify(wrong PIN) = %v, %v", ok, err)
+	}
+	if _, err := Hash(bytes.NewReader(nil), []byte("1234"), p); err == nil {
+		t.Error("Hash without entropy succeeded")
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	for _, encoded := range []string{
+		"",
+		"$argon2i$v=19$m=64,t=1,p=1$c29tZXNhbHQ$aGFzaA",
+		"$argon2id$v=16$m=64,t=1,p=1$c29tZXNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=64,t=0,p=1$c29tZXNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=0$c29tZXNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=2097152,t=1,p=1$c29tZXNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=64;t=1;p=1$c29tZXNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$not base64!$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$",
+		"$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$aGFzaA$extra",
+	} {
+		if ok, err := Verify(encoded, []byte("1234")); ok || err != ErrMalformed {
+			t.Errorf("Verify(%q) = %v, %v, want ErrMalformed", encoded, ok, err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package blockchain
+
+// address.go is the single codec between wallet addresses and the
+// public key hashes outputs are locked to. An address is the
+// Base58Check encoding of a version byte and a 32-byte public key
+// hash followed by a 4-byte checksum (the first bytes of the double
+// SHA-256 of the rest), so a mistyped address fails to decode instead
+// of paying a hash nobody holds the key to. Everything that turns an
+// address into output bytes or back (coinbase creation, transaction
+// building, balances, the explorer) goes through DecodeAddress,
+// EncodeAddress and TxOutput.Owner so the two sides cannot drift.
+//
+// Addresses used to be the plain hex encoding of the hash, and wallets
+// created then are stored under their hex address. While
+// AcceptHexAddresses is set DecodeAddress still reads them; AddressForms
+// lists both encodings so lookups find a wallet under either.
+//
+// Older versions of NewCoinbaseTx stored the address text itself when
+// it was not plain hex (for example with a 0x prefix or stray
+// whitespace). Those outputs are still on existing chains and
+// cannot be rewritten without changing block hashes, so Owner maps them
+// to the public key hash the address was meant to encode.
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "math/big"
+    "strings"
+)
+
+// AddressVersion is the version byte of addresses. With it every
+// address is 51 characters long and starts with 4.
+const AddressVersion byte = 0x5a
+
+const addressChecksumLen = 4
+
+// AcceptHexAddresses makes DecodeAddress accept the legacy hex
+// encoding (64 hex digits, no checksum) alongside Base58Check.
+var AcceptHexAddresses = true
+
+// ErrInvalidAddress is returned for strings that are not the encoding
+// of a 32-byte public key hash, including addresses whose checksum
+// does not match.
+var ErrInvalidAddress = errors.New("invalid address")
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// DecodeAddress returns the public key hash encoded by address.
+func DecodeAddress(address string) ([]byte, error) {
+    if AcceptHexAddresses && len(address) == 2*pubKeyHashLen {
+        if h, ok := decodeHexAddress(address); ok {
+            return h, nil
+        }
+    }
+    payload, ok := base58Decode(address)
+    if !ok || len(payload) != 1+pubKeyHashLen+addressChecksumLen || payload[0] != AddressVersion {
+        return nil, ErrInvalidAddress
+    }
+    body, sum := payload[:1+pubKeyHashLen], payload[1+pubKeyHashLen:]
+    if !bytes.Equal(sum, addressChecksum(body)) {
+        return nil, ErrInvalidAddress
+    }
+    return body[1:], nil
+}
+
+// EncodeAddress returns the address of a public key hash.
+func EncodeAddress(pubKeyHash []byte) string {
+    payload := append([]byte{AddressVersion}, pubKeyHash...)
+    return base58Encode(append(payload, addressChecksum(payload)...))
+}
+
+// HexAddress returns the legacy hex encoding of a public key hash.
+func HexAddress(pubKeyHash []byte) string {
+    return hex.EncodeToString(pubKeyHash)
+}
+
+// CanonicalAddress returns address in the current encoding, or address
+// unchanged when it does not decode.
+func CanonicalAddress(address string) string {
+    h, err := DecodeAddress(address)
+    if err != nil {
+        return address
+    }
+    return EncodeAddress(h)
+}
+
+// AddressForms lists the encodings address may be stored under: the
+// current one and the legacy hex one. An address that does not decode
+// is returned alone.
+func AddressForms(address string) []string {
+    h, err := DecodeAddress(address)
+    if err != nil {
+        return []string{address}
+    }
+    return []string{EncodeAddress(h), HexAddress(h)}
+}
+
+// SameAddress reports whether a and b encode the same public key hash.
+func SameAddress(a, b string) bool {
+    if a == b {
+        return true
+    }
+    ha, err := DecodeAddress(a)
+    if err != nil {
+        return false
+    }
+    hb, err := DecodeAddress(b)
+    return err == nil && bytes.Equal(ha, hb)
+}
+
+func addressChecksum(payload []byte) []byte {
+    first := sha256.Sum256(payload)
+    second := sha256.Sum256(first[:])
+    return second[:addressChecksumLen]
+}
+
+func decodeHexAddress(s string) ([]byte, bool) {
+    h, err := hex.DecodeString(s)
+    if err != nil || len(h) != pubKeyHashLen {
+        return nil, false
+    }
+    return h, true
+}
+
+// base58Encode encodes b in base 58, one leading 1 per leading zero
+// byte.
+func base58Encode(b []byte) string {
+    n := new(big.Int).SetBytes(b)
+    base, mod := big.NewInt(58), new(big.Int)
+    var out []byte
+    for n.Sign() > 0 {
+        n.DivMod(n, base, mod)
+        out = append(out, base58Alphabet[mod.Int64()])
+    }
+    for _, c := range b {
+        if c != 0 {
+            break
+        }
+        out = append(out, base58Alphabet[0])
+    }
+    for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+        out[i], out[j] = out[j], out[i]
+    }
+    return string(out)
+}
+
+// base58Decode reverses base58Encode. It reports false for characters
+// outside the alphabet.
+func base58Decode(s string) ([]byte, bool) {
+    if s == "" {
+        return nil, false
+    }
+    n, base := new(big.Int), big.NewInt(58)
+    zeros := 0
+    for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+        zeros++
+    }
+    for i := 0; i < len(s); i++ {
+        d := strings.IndexByte(base58Alphabet, s[i])
+        if d < 0 {
+            return nil, false
+        }
+        n.Mul(n, base)
+        n.Add(n, big.NewInt(int64(d)))
+    }
+    return append(make([]byte, zeros), n.Bytes()...), true
+}
+
+// legacyPubKeyHash reads a public key hash stored as address text by
+// older coinbase transactions. It reports false when b is not such
+// text.
+func legacyPubKeyHash(b []byte) ([]byte, bool) {
+    s := strings.ToLower(strings.TrimSpace(string(b)))
+    s = strings.TrimPrefix(s, "0x")
+    return decodeHexAddress(s)
+}
+
+// Owner returns the public key hash the output pays to, reading the
+// legacy text encoding of old coinbase outputs. Outputs with other
+// malformed hashes are returned unchanged and match no address.
+func (out TxOutput) Owner() []byte {
+    if len(out.PubKeyHash) != pubKeyHashLen {
+        if h, ok := legacyPubKeyHash(out.PubKeyHash); ok {
+            return h
+        }
+    }
+    return out.PubKeyHash
+}
+
+// IsLockedWith reports whether the output pays to pubKeyHash.
+func (out TxOutput) IsLockedWith(pubKeyHash []byte) bool {
+    return bytes.Equal(out.Owner(), pubKeyHash)
+}
+
+// IsLegacyEncoded reports whether the output stores its owner as
+// address text rather than as a public key hash.
+func (out TxOutput) IsLegacyEncoded() bool {
+    _, ok := legacyPubKeyHash(out.PubKeyHash)
+    return ok && len(out.PubKeyHash) != pubKeyHashLen
+}
+
+// LegacyOutput is an output whose owner is stored as address text.
+type LegacyOutput struct {
+    Txid    []byte
+    Vout    int
+    Stored  string // the text as stored in the output
+    Address string // the canonical address it stands for
+}
+
+// LegacyOutputs lists the legacy-encoded outputs in blocks.
+func LegacyOutputs(blocks []*Block) []LegacyOutput {
+    var legacy []LegacyOutput
+    for _, b := range blocks {
+        for _, tx := range b.Transactions {
+            for i, out := range tx.Vout {
+                if out.IsLegacyEncoded() {
+                    legacy = append(legacy, LegacyOutput{
+                        Txid:    tx.ID,
+                        Vout:    i,
+                        Stored:  string(out.PubKeyHash),
+                        Address: EncodeAddress(out.Owner()),
+                    })
+                }
+            }
+        }
+    }
+    return legacy
+}
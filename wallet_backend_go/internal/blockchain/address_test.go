@@ -0,0 +1,153 @@
+package blockchain
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "strings"
+    "testing"
+)
+
+// base58Vectors are from Bitcoin Core's base58_encode_decode.json.
+var base58Vectors = []struct {
+    hex, base58 string
+}{
+    {"61", "2g"},
+    {"626262", "a3gV"},
+    {"636363", "aPEr"},
+    {"73696d706c792061206c6f6e6720737472696e67", "2cFupjhnEsSn59qHXstmK2ffpLv2"},
+    {"00eb15231dfceb60925886b67d065299925915aeb172c06647", "1NS17iag9jJgTHD1VXjvLCEnZuQ3rJDE9L"},
+    {"516b6fcd0f", "ABnLTmg"},
+    {"bf4f89001e670274dd", "3SEo3LWLoPntC"},
+    {"572e4794", "3EFU7m"},
+    {"ecac89cad93923c02321", "EJDM8drfXA6uyA"},
+    {"10c8511e", "Rt5zm"},
+    {"00000000000000000000", "1111111111"},
+}
+
+func TestBase58(t *testing.T) {
+    for _, v := range base58Vectors {
+        b, _ := hex.DecodeString(v.hex)
+        if got := base58Encode(b); got != v.base58 {
+            t.Errorf("base58Encode(%s) = %s, want %s", v.hex, got, v.base58)
+        }
+        got, ok := base58Decode(v.base58)
+        if !ok || !bytes.Equal(got, b) {
+            t.Errorf("base58Decode(%s) = %x, %v, want %s", v.base58, got, ok, v.hex)
+        }
+    }
+    for _, s := range []string{"", "0", "O", "I", "l", "2g!", "a3g V"} {
+        if _, ok := base58Decode(s); ok {
+            t.Errorf("base58Decode(%q) succeeded", s)
+        }
+    }
+}
+
+// TestAddressChecksum checks Base58Check on the Bitcoin genesis
+// address: version 0, the hash of the genesis key and its checksum.
+func TestAddressChecksum(t *testing.T) {
+    payload, ok := base58Decode("1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa")
+    if !ok || hex.EncodeToString(payload) != "0062e907b15cbf27d5425399ebf6f0fb50ebb88f18c29b7d93" {
+        t.Fatalf("decoded payload = %x, %v", payload, ok)
+    }
+    if got := hex.EncodeToString(addressChecksum(payload[:21])); got != "c29b7d93" {
+        t.Errorf("checksum = %s, want c29b7d93", got)
+    }
+}
+
+func TestAddressRoundTrip(t *testing.T) {
+    hashes := [][]byte{
+        make([]byte, pubKeyHashLen),
+        bytes.Repeat([]byte{0xff}, pubKeyHashLen),
+    }
+    for i := 0; i < 8; i++ {
+        hashes = append(hashes, testPubKeyHash([]byte{byte(i)}))
+    }
+    for _, h := range hashes {
+        addr := EncodeAddress(h)
+        if len(addr) != 51 || addr[0] != '4' {
+            t.Errorf("address %s of %x: want 51 characters starting with 4", addr, h)
+        }
+        got, err := DecodeAddress(addr)
+        if err != nil || !bytes.Equal(got, h) {
+            t.Errorf("DecodeAddress(%s) = %x, %v, want %x", addr, got, err, h)
+        }
+        if forms := AddressForms(addr); len(forms) != 2 || forms[0] != addr || forms[1] != HexAddress(h) {
+            t.Errorf("AddressForms(%s) = %v", addr, forms)
+        }
+        if CanonicalAddress(HexAddress(h)) != addr || !SameAddress(addr, HexAddress(h)) {
+            t.Errorf("hex form of %s is not the same address", addr)
+        }
+    }
+}
+
+func TestDecodeAddressRejects(t *testing.T) {
+    h := testPubKeyHash([]byte("key"))
+    addr := EncodeAddress(h)
+
+    // every single-character substitution breaks the checksum
+    for i := 1; i < len(addr); i++ {
+        c := base58Alphabet[(strings.IndexByte(base58Alphabet, addr[i])+1)%len(base58Alphabet)]
+        typo := addr[:i] + string(c) + addr[i+1:]
+        if got, err := DecodeAddress(typo); err != ErrInvalidAddress {
+            t.Errorf("DecodeAddress(%s) = %x, %v, want ErrInvalidAddress", typo, got, err)
+        }
+    }
+
+    otherVersion := append([]byte{0x00}, h...)
+    short := append([]byte{AddressVersion}, h[:31]...)
+    for name, s := range map[string]string{
+        "empty":           "",
+        "not base58":      "0" + addr[1:],
+        "truncated":       addr[:len(addr)-1],
+        "extended":        addr + "1",
+        "other version":   base58Encode(append(otherVersion, addressChecksum(otherVersion)...)),
+        "31-byte hash":    base58Encode(append(short, addressChecksum(short)...)),
+        "short hex":       HexAddress(h)[2:],
+        "hex with prefix": "0x" + HexAddress(h)[2:],
+    } {
+        if _, err := DecodeAddress(s); err != ErrInvalidAddress {
+            t.Errorf("%s: DecodeAddress(%q) error = %v, want ErrInvalidAddress", name, s, err)
+        }
+    }
+    if SameAddress(addr, EncodeAddress(testPubKeyHash([]byte("other key")))) {
+        t.Error("different hashes are the same address")
+    }
+}
+
+func TestHexAddresses(t *testing.T) {
+    h := testPubKeyHash([]byte("key"))
+    defer func(prev bool) { AcceptHexAddresses = prev }(AcceptHexAddresses)
+
+    AcceptHexAddresses = true
+    if got, err := DecodeAddress(HexAddress(h)); err != nil || !bytes.Equal(got, h) {
+        t.Errorf("hex address = %x, %v, want %x", got, err, h)
+    }
+    AcceptHexAddresses = false
+    if _, err := DecodeAddress(HexAddress(h)); err != ErrInvalidAddress {
+        t.Errorf("hex address without AcceptHexAddresses: error = %v, want ErrInvalidAddress", err)
+    }
+    if forms := AddressForms(HexAddress(h)); len(forms) != 1 {
+        t.Errorf("AddressForms of an undecodable address = %v, want it alone", forms)
+    }
+}
+
+func TestOwnerLegacyEncoding(t *testing.T) {
+    h := testPubKeyHash([]byte("key"))
+    for _, text := range []string{HexAddress(h), "0x" + HexAddress(h), " " + strings.ToUpper(HexAddress(h)) + "\n"} {
+        out := TxOutput{Value: 1, PubKeyHash: []byte(text)}
+        if !out.IsLegacyEncoded() || !out.IsLockedWith(h) {
+            t.Errorf("output storing %q: legacy %v, locked with its hash %v", text, out.IsLegacyEncoded(), out.IsLockedWith(h))
+        }
+    }
+    out := TxOutput{Value: 1, PubKeyHash: h}
+    if out.IsLegacyEncoded() || !out.IsLockedWith(h) || out.IsLockedWith(testPubKeyHash([]byte("other"))) {
+        t.Error("plain output does not match exactly its own hash")
+    }
+}
+
+// testPubKeyHash returns a public key hash derived from seed.
+func testPubKeyHash(seed []byte) []byte {
+    h := sha256.Sum256(seed)
+    return h[:]
+}
@@ -0,0 +1,164 @@
+package blockchain
+
+// addrindex.go keeps a per-address index of the chain for the block
+// explorer. Scanning every block for each address page does not scale,
+// so the index remembers, for every address, the transactions touching
+// it with the amounts received and sent, and is brought up to date
+// incrementally as blocks are mined. When the chain was replaced (reset
+// or rebuilt) the index starts over.
+
+import (
+    "bytes"
+    "encoding/hex"
+    "fmt"
+    "sync"
+)
+
+// AddressTx is one transaction as seen by an address. Sent is the value
+// of the address's outputs the transaction spent, Received the value it
+// paid to the address (change included).
+type AddressTx struct {
+    Txid      string `json:"txid"`
+    Height    int    `json:"height"`
+    BlockHash string `json:"block_hash"`
+    Timestamp int64  `json:"timestamp"`
+    Received  int    `json:"received"`
+    Sent      int    `json:"sent"`
+}
+
+// AddressSummary aggregates the activity of an address.
+type AddressSummary struct {
+    Address       string `json:"address"`
+    Balance       int    `json:"balance"`
+    TotalReceived int    `json:"total_received"`
+    TotalSent     int    `json:"total_sent"`
+    TxCount       int    `json:"tx_count"`
+    FirstSeen     *int   `json:"first_seen_height"` // nil when the address never appeared
+    LastSeen      *int   `json:"last_seen_height"`
+}
+
+type indexedOutput struct {
+    address string
+    value   int
+}
+
+type addressEntry struct {
+    received int
+    sent     int
+    txs      []AddressTx // in chain order
+}
+
+// AddressIndex is an incrementally maintained address index. The zero
+// value is empty and ready to use.
+type AddressIndex struct {
+    mu      sync.RWMutex
+    height  int                      // number of blocks indexed
+    tip     []byte                   // hash of the last indexed block
+    outputs map[string]indexedOutput // "txid:vout"
+    entries map[string]*addressEntry
+}
+
+// Sync indexes the blocks not indexed yet. The caller must keep blocks
+// from changing meanwhile (hold the lock that serializes mining).
+func (ix *AddressIndex) Sync(blocks []*Block) {
+    ix.mu.Lock()
+    defer ix.mu.Unlock()
+
+    if ix.height > len(blocks) || (ix.height > 0 && !bytes.Equal(blocks[ix.height-1].Hash, ix.tip)) {
+        ix.height, ix.tip = 0, nil
+    }
+    if ix.height == 0 {
+        ix.outputs = make(map[string]indexedOutput)
+        ix.entries = make(map[string]*addressEntry)
+    }
+
+    for h := ix.height; h < len(blocks); h++ {
+        ix.indexBlock(h, blocks[h])
+    }
+    ix.height = len(blocks)
+    if ix.height > 0 {
+        ix.tip = blocks[ix.height-1].Hash
+    }
+}
+
+func (ix *AddressIndex) indexBlock(height int, b *Block) {
+    for _, tx := range b.Transactions {
+        txid := hex.EncodeToString(tx.ID)
+        touched := make(map[string]*AddressTx)
+        touch := func(address string) *AddressTx {
+            if t, ok := touched[address]; ok {
+                return t
+            }
+            t := &AddressTx{
+                Txid:      txid,
+                Height:    height,
+                BlockHash: hex.EncodeToString(b.Hash),
+                Timestamp: b.Timestamp,
+            }
+            touched[address] = t
+            return t
+        }
+
+        // the outputs this transaction spends, then the ones it creates
+        var order []string
+        if !tx.IsCoinbase() {
+            for _, in := range tx.Vin {
+                key := fmt.Sprintf("%x:%d", in.Txid, in.Vout)
+                out, ok := ix.outputs[key]
+                if !ok {
+                    continue
+                }
+                delete(ix.outputs, key)
+                if _, seen := touched[out.address]; !seen {
+                    order = append(order, out.address)
+                }
+                touch(out.address).Sent += out.value
+            }
+        }
+        for i, out := range tx.Vout {
+            address := EncodeAddress(out.Owner())
+            ix.outputs[fmt.Sprintf("%s:%d", txid, i)] = indexedOutput{address: address, value: out.Value}
+            if _, seen := touched[address]; !seen {
+                order = append(order, address)
+            }
+            touch(address).Received += out.Value
+        }
+
+        for _, address := range order {
+            t := touched[address]
+            e := ix.entries[address]
+            if e == nil {
+                e = &addressEntry{}
+                ix.entries[address] = e
+            }
+            e.received += t.Received
+            e.sent += t.Sent
+            e.txs = append(e.txs, *t)
+        }
+    }
+}
+
+// Address returns the summary of address and up to limit of its
+// transactions, newest first, skipping the offset newest ones.
+func (ix *AddressIndex) Address(address string, offset, limit int) (AddressSummary, []AddressTx) {
+    ix.mu.RLock()
+    defer ix.mu.RUnlock()
+
+    sum := AddressSummary{Address: address}
+    e := ix.entries[address]
+    if e == nil {
+        return sum, []AddressTx{}
+    }
+    first, last := e.txs[0].Height, e.txs[len(e.txs)-1].Height
+    sum.Balance = e.received - e.sent
+    sum.TotalReceived = e.received
+    sum.TotalSent = e.sent
+    sum.TxCount = len(e.txs)
+    sum.FirstSeen, sum.LastSeen = &first, &last
+
+    page := []AddressTx{}
+    for i := len(e.txs) - 1 - offset; i >= 0 && len(page) < limit; i-- {
+        page = append(page, e.txs[i])
+    }
+    return sum, page
+}
@@ -7,6 +7,7 @@ package blockchain
 
 import (
     "bytes"
+    "context"
     "crypto/sha256"
     "time"
 )
@@ -20,18 +21,39 @@ type Block struct {
     PrevHash     []byte
     Hash         []byte
     Nonce        int
+
+    // Producer identity, set by NodeKey.SignBlock after mining.
+    ProducerID     string `json:",omitempty"`
+    ProducerPubKey []byte `json:",omitempty"`
+    Signature      []byte `json:",omitempty"`
 }
 
 // NewBlock creates and returns a new block containing the provided
 // transactions and the given previous hash. A proof‑of‑work is run
 // internally to find a valid nonce and produce the block's hash.
 func NewBlock(transactions []*Transaction, prevHash []byte) *Block {
-    block := &Block{Timestamp: time.Now().Unix(), Transactions: transactions, PrevHash: prevHash, Hash: []byte{}, Nonce: 0}
+    return NewBlockAt(transactions, prevHash, time.Now().Unix())
+}
+
+// NewBlockAt is NewBlock with the given unix timestamp instead of the
+// current time.
+func NewBlockAt(transactions []*Transaction, prevHash []byte, timestamp int64) *Block {
+    block, _ := NewBlockAtContext(context.Background(), transactions, prevHash, timestamp)
+    return block
+}
+
+// NewBlockAtContext is NewBlockAt that stops mining and returns the
+// context's error once ctx is done.
+func NewBlockAtContext(ctx context.Context, transactions []*Transaction, prevHash []byte, timestamp int64) (*Block, error) {
+    block := &Block{Timestamp: timestamp, Transactions: transactions, PrevHash: prevHash, Hash: []byte{}, Nonce: 0}
     pow := NewProofOfWork(block)
-    nonce, hash := pow.Run()
+    nonce, hash, err := pow.RunContext(ctx)
+    if err != nil {
+        return nil, err
+    }
     block.Hash = hash[:]
     block.Nonce = nonce
-    return block
+    return block, nil
 }
 
 // HashTransactions computes a single SHA‑256 hash over all
@@ -1,15 +1,18 @@
 package blockchain
 
 // blockchain.go implements a minimal blockchain with proof‑of‑work and
-// UTXO support. This in‑memory implementation demonstrates block
-// addition, transaction lookup, UTXO scanning and simple PoW mining.
-// For persistence you should store blocks in a database such as
-// Supabase or another PostgreSQL backend via the db package.
+// UTXO support. The chain is kept in memory; with a Storage (see
+// storage.go) every block is also written to disk so the chain survives
+// a restart. The db package mirrors the blocks to Supabase for the
+// explorer and reports.
 
 import (
+    "bytes"
+    "context"
     "crypto/ecdsa"
     "encoding/hex"
     "fmt"
+    "time"
 )
 
 // Blockchain represents a chain of blocks. Blocks are kept in a slice
@@ -17,27 +20,186 @@ import (
 // block hashes, heights, etc. The Genesis block is at index 0.
 type Blockchain struct {
     Blocks []*Block
+
+    // Producer signs every block mined by this node. When it or
+    // TrustedProducers is set, Validate also requires every block to
+    // carry a valid producer signature, and when TrustedProducers is
+    // non-empty the producer must be one of them.
+    Producer         *NodeKey
+    TrustedProducers map[string]bool
+
+    // Validators are the policy checks user transactions must pass
+    // before they are mined (see validator.go).
+    Validators *ValidatorChain
+
+    // Clock stamps mined blocks and decides whether lock times have
+    // passed. Nil means SystemClock.
+    Clock Clock
+
+    // ChainID names the network the chain was created for from a
+    // genesis file (see genesis.go); empty for the built-in genesis.
+    ChainID string
+
+    // MineLock, when set, is taken around mining every block so that
+    // nodes sharing a lock service do not mine at the same time. It
+    // returns the function that releases the lock.
+    MineLock func(ctx context.Context) (func(), error)
+
+    // Store, when set with UseStorage, receives every block before it
+    // joins the chain.
+    Store Storage
+
+    // FeeAddress receives the fees of the transactions in every block
+    // this node mines, in a coinbase at the front of the block (see
+    // NewFeeCoinbaseTx). Empty leaves fees unclaimed.
+    FeeAddress string
+
+    // OnBlock, when set, is called with every block that joins the
+    // chain, mined here or imported, and its height. It runs while the
+    // caller still holds whatever lock guards the chain, so it must not
+    // block.
+    OnBlock func(height int, b *Block)
+
+    // OnMined, when set, is called with how long the proof-of-work of
+    // every block mined here took.
+    OnMined func(elapsed time.Duration)
 }
 
 // NewBlockchain creates a blockchain with a genesis block paying a
 // reward to the provided address. It returns a pointer to the
-// blockchain. Persisting the chain is left to the caller.
+// blockchain. To keep the chain on disk, or resume one kept there,
+// call UseStorage.
 func NewBlockchain(address string) *Blockchain {
+    return NewBlockchainWithClock(address, SystemClock)
+}
+
+// NewBlockchainWithClock is NewBlockchain with the genesis block and
+// every later block stamped by clock.
+func NewBlockchainWithClock(address string, clock Clock) *Blockchain {
     coinbase := NewCoinbaseTx(address, "Genesis Block")
-    genesis := NewBlock([]*Transaction{coinbase}, []byte{})
-    bc := &Blockchain{Blocks: []*Block{genesis}}
+    genesis := NewBlockAt([]*Transaction{coinbase}, []byte{}, clock.Now().Unix())
+    bc := &Blockchain{Blocks: []*Block{genesis}, Clock: clock}
     return bc
 }
 
+// now returns the current time of the chain's clock.
+func (bc *Blockchain) now() time.Time {
+    if bc.Clock == nil {
+        return SystemClock.Now()
+    }
+    return bc.Clock.Now()
+}
+
 // AddBlock mines a new block containing the provided transactions.
 // Proof‑of‑work is performed automatically via the NewBlock call.
-// The new block is appended to the chain and returned. In a real
-// system you'd also validate transactions and persist the block.
+// The new block is appended to the chain and returned. AddBlock panics
+// if the block cannot be stored; AddBlockContext returns the error.
 func (bc *Blockchain) AddBlock(txs []*Transaction) *Block {
+    newBlock, err := bc.AddBlockContext(context.Background(), txs)
+    if err != nil {
+        panic(err)
+    }
+    return newBlock
+}
+
+// AddBlockContext is AddBlock that gives up mining once ctx is done. It
+// then returns the context's error and leaves the chain unchanged, as
+// it does when MineLock fails or the block cannot be stored (an error
+// wrapping ErrStorage).
+func (bc *Blockchain) AddBlockContext(ctx context.Context, txs []*Transaction) (*Block, error) {
+    if bc.MineLock != nil {
+        unlock, err := bc.MineLock(ctx)
+        if err != nil {
+            return nil, err
+        }
+        defer unlock()
+    }
+    if fees := bc.BlockFees(txs); fees > 0 && bc.FeeAddress != "" {
+        txs = append([]*Transaction{NewFeeCoinbaseTx(bc.FeeAddress, fees, len(bc.Blocks))}, txs...)
+    }
     prevHash := bc.Blocks[len(bc.Blocks)-1].Hash
-    newBlock := NewBlock(txs, prevHash)
+    start := time.Now()
+    newBlock, err := NewBlockAtContext(ctx, txs, prevHash, bc.now().Unix())
+    if err != nil {
+        return nil, err
+    }
+    if bc.OnMined != nil {
+        bc.OnMined(time.Since(start))
+    }
+    if bc.Producer != nil {
+        // signing only fails if the system random source does
+        if err := bc.Producer.SignBlock(newBlock); err != nil {
+            panic(err)
+        }
+    }
+    if bc.Store != nil {
+        if err := bc.Store.Put(len(bc.Blocks), newBlock); err != nil {
+            return nil, fmt.Errorf("%w: %v", ErrStorage, err)
+        }
+    }
     bc.Blocks = append(bc.Blocks, newBlock)
-    return newBlock
+    if bc.OnBlock != nil {
+        bc.OnBlock(len(bc.Blocks)-1, newBlock)
+    }
+    return newBlock, nil
+}
+
+// TxFee returns what tx's inputs hold beyond its outputs, or 0 for a
+// coinbase or a transaction spending outputs not on the chain.
+func (bc *Blockchain) TxFee(tx *Transaction) int {
+    return bc.BlockFees([]*Transaction{tx})
+}
+
+// BlockFees adds up the fees of txs, mined together in one block: an
+// input may spend an output of an earlier transaction among them.
+func (bc *Blockchain) BlockFees(txs []*Transaction) int {
+    inBlock := make(map[string]*Transaction, len(txs))
+    for _, tx := range txs {
+        inBlock[hex.EncodeToString(tx.ID)] = tx
+    }
+    fees := 0
+    for _, tx := range txs {
+        if tx.IsCoinbase() {
+            continue
+        }
+        in := 0
+        for _, vin := range tx.Vin {
+            prev, ok := inBlock[hex.EncodeToString(vin.Txid)]
+            if !ok {
+                found, err := bc.FindTransaction(vin.Txid)
+                if err != nil {
+                    in = -1
+                    break
+                }
+                prev = &found
+            }
+            if vin.Vout < 0 || vin.Vout >= len(prev.Vout) {
+                in = -1
+                break
+            }
+            in += prev.Vout[vin.Vout].Value
+        }
+        out := 0
+        for _, o := range tx.Vout {
+            out += o.Value
+        }
+        if in > out {
+            fees += in - out
+        }
+    }
+    return fees
+}
+
+// Reset drops every block after genesis, from the storage too. Any UTXO
+// set built on the chain must be reindexed afterwards.
+func (bc *Blockchain) Reset() error {
+    if bc.Store != nil {
+        if err := bc.Store.Truncate(0); err != nil {
+            return fmt.Errorf("%w: %v", ErrStorage, err)
+        }
+    }
+    bc.Blocks = bc.Blocks[:1]
+    return nil
 }
 
 // FindTransaction searches for a transaction by its ID and returns
@@ -63,6 +225,21 @@ func (bc *Blockchain) FindUTXO(pubKeyHash []byte) map[string][]TxOutput {
     spentTXOs := make(map[string][]int)
     UTXOs := make(map[string][]TxOutput)
 
+    // Blocks are stored oldest first, so an output is always seen
+    // before the input spending it. Collect the spent outputs in a
+    // first pass to avoid counting them as unspent.
+    for _, block := range bc.Blocks {
+        for _, tx := range block.Transactions {
+            if tx.IsCoinbase() {
+                continue
+            }
+            for _, in := range tx.Vin {
+                inTxID := hex.EncodeToString(in.Txid)
+                spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Vout)
+            }
+        }
+    }
+
     for _, block := range bc.Blocks {
         for _, tx := range block.Transactions {
             txIDStr := hex.EncodeToString(tx.ID)
@@ -81,19 +258,10 @@ func (bc *Blockchain) FindUTXO(pubKeyHash []byte) map[string][]TxOutput {
                         continue
                     }
                 }
-                if pubKeyHash == nil || string(out.PubKeyHash) == string(pubKeyHash) {
+                if pubKeyHash == nil || out.IsLockedWith(pubKeyHash) {
                     UTXOs[txIDStr] = append(UTXOs[txIDStr], out)
                 }
             }
-            // record spent outputs
-            if !tx.IsCoinbase() {
-                for _, in := range tx.Vin {
-                    if pubKeyHash == nil || true {
-                        inTxID := hex.EncodeToString(in.Txid)
-                        spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Vout)
-                    }
-                }
-            }
         }
     }
     return UTXOs
@@ -119,11 +287,15 @@ func (bc *Blockchain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey)
 // VerifyTransaction verifies the signatures on the transaction inputs.
 // It looks up the previous transactions referenced by the inputs and
 // passes them to the Verify method. Returns true if all signatures
-// are valid. Coinbase transactions are always valid.
+// are valid and the transaction's lock time has passed. Coinbase
+// transactions are always valid.
 func (bc *Blockchain) VerifyTransaction(tx *Transaction) bool {
     if tx.IsCoinbase() {
         return true
     }
+    if tx.LockTime > bc.now().Unix() {
+        return false
+    }
     prevTXs := make(map[string]Transaction)
     for _, vin := range tx.Vin {
         prevTx, err := bc.FindTransaction(vin.Txid)
@@ -133,4 +305,64 @@ func (bc *Blockchain) VerifyTransaction(tx *Transaction) bool {
         prevTXs[fmt.Sprintf("%x", vin.Txid)] = prevTx
     }
     return tx.Verify(prevTXs)
-}
\ No newline at end of file
+}
+
+// Validate re-checks the whole chain: every block must link to its
+// predecessor, carry a hash that matches its contents and satisfies
+// the proof‑of‑work target, carry a valid producer signature when
+// signed (always, once this node signs blocks or trusts only some
+// producers), and contain only
+// transactions whose signatures verify. The first problem found is returned.
+func (bc *Blockchain) Validate() error {
+    return bc.ValidateFrom(0)
+}
+
+// ValidateFrom is Validate for the blocks from height on, which are
+// checked against the whole chain.
+func (bc *Blockchain) ValidateFrom(height int) error {
+    for i := height; i < len(bc.Blocks); i++ {
+        block := bc.Blocks[i]
+        if i > 0 && !bytes.Equal(block.PrevHash, bc.Blocks[i-1].Hash) {
+            return fmt.Errorf("block %d: prev hash does not match block %d", i, i-1)
+        }
+        pow := NewProofOfWork(block)
+        if !pow.Validate() || !bytes.Equal(pow.hash(), block.Hash) {
+            return fmt.Errorf("block %d: invalid proof-of-work", i)
+        }
+        if len(block.Signature) > 0 || bc.Producer != nil || len(bc.TrustedProducers) > 0 {
+            if err := block.VerifyProducer(); err != nil {
+                return fmt.Errorf("block %d: %v", i, err)
+            }
+            if len(bc.TrustedProducers) > 0 && !bc.TrustedProducers[block.ProducerID] {
+                return fmt.Errorf("block %d: untrusted producer %s", i, block.ProducerID)
+            }
+        }
+        for _, tx := range block.Transactions {
+            if tx.LockTime > block.Timestamp {
+                return fmt.Errorf("block %d: transaction %x mined before its lock time", i, tx.ID)
+            }
+            if !bc.VerifyTransaction(tx) {
+                return fmt.Errorf("block %d: transaction %x failed verification", i, tx.ID)
+            }
+        }
+    }
+    return nil
+}
+
+// IsOutputSpent reports whether output vout of transaction txid is
+// referenced by an input anywhere in the chain.
+func (bc *Blockchain) IsOutputSpent(txid []byte, vout int) bool {
+    for _, block := range bc.Blocks {
+        for _, tx := range block.Transactions {
+            if tx.IsCoinbase() {
+                continue
+            }
+            for _, in := range tx.Vin {
+                if in.Vout == vout && bytes.Equal(in.Txid, txid) {
+                    return true
+                }
+            }
+        }
+    }
+    return false
+}
@@ -0,0 +1,204 @@
+package blockchain
+
+// boltstore.go is a Storage in a BoltDB file, the default backend of a
+// node's chain directory. Blocks are kept as their JSON encoding in the
+// "blocks" bucket under their big-endian height, so a cursor walks them
+// in chain order, and the "heights" bucket maps every block hash to its
+// height. Each Put and Truncate is one transaction, synced before it
+// returns, so a crash leaves the chain at the last block written.
+// BoltDB locks the file: a second process opening it fails after
+// boltOpenTimeout.
+
+import (
+    "encoding/binary"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "time"
+
+    bolt "go.etcd.io/bbolt"
+)
+
+// BoltFileName is the name of the database in a BoltStorage directory.
+const BoltFileName = "chain.db"
+
+// boltOpenTimeout bounds the wait for another process's file lock.
+const boltOpenTimeout = 5 * time.Second
+
+var (
+    boltBlocks  = []byte("blocks")
+    boltHeights = []byte("heights")
+)
+
+// BoltStorage is a Storage in a BoltDB database.
+type BoltStorage struct {
+    db *bolt.DB
+}
+
+// OpenBoltStorage opens the database in dir, creating dir and the
+// database when missing.
+func OpenBoltStorage(dir string) (*BoltStorage, error) {
+    if err := os.MkdirAll(dir, 0o700); err != nil {
+        return nil, err
+    }
+    path := filepath.Join(dir, BoltFileName)
+    db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: boltOpenTimeout})
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    err = db.Update(func(tx *bolt.Tx) error {
+        if _, err := tx.CreateBucketIfNotExists(boltBlocks); err != nil {
+            return err
+        }
+        _, err := tx.CreateBucketIfNotExists(boltHeights)
+        return err
+    })
+    if err != nil {
+        db.Close()
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    return &BoltStorage{db: db}, nil
+}
+
+// heightKey is the key of the block at height.
+func heightKey(height int) []byte {
+    key := make([]byte, 8)
+    binary.BigEndian.PutUint64(key, uint64(height))
+    return key
+}
+
+// boltTip returns the height of the last block in tx, -1 when empty.
+func boltTip(tx *bolt.Tx) int {
+    key, _ := tx.Bucket(boltBlocks).Cursor().Last()
+    if key == nil {
+        return -1
+    }
+    return int(binary.BigEndian.Uint64(key))
+}
+
+// boltBlock decodes a stored block.
+func boltBlock(data []byte) (*Block, error) {
+    var b Block
+    if err := json.Unmarshal(data, &b); err != nil {
+        return nil, err
+    }
+    return &b, nil
+}
+
+// Put implements Storage.
+func (bs *BoltStorage) Put(height int, b *Block) error {
+    data, err := json.Marshal(b)
+    if err != nil {
+        return err
+    }
+    return bs.db.Update(func(tx *bolt.Tx) error {
+        if tip := boltTip(tx); height != tip+1 {
+            return fmt.Errorf("put block at height %d, tip is %d", height, tip)
+        }
+        if err := tx.Bucket(boltBlocks).Put(heightKey(height), data); err != nil {
+            return err
+        }
+        return tx.Bucket(boltHeights).Put(b.Hash, heightKey(height))
+    })
+}
+
+// GetByHeight implements Storage.
+func (bs *BoltStorage) GetByHeight(height int) (*Block, error) {
+    if height < 0 {
+        return nil, ErrBlockNotFound
+    }
+    var b *Block
+    err := bs.db.View(func(tx *bolt.Tx) error {
+        data := tx.Bucket(boltBlocks).Get(heightKey(height))
+        if data == nil {
+            return ErrBlockNotFound
+        }
+        var err error
+        b, err = boltBlock(data)
+        return err
+    })
+    return b, err
+}
+
+// GetByHash implements Storage.
+func (bs *BoltStorage) GetByHash(hash []byte) (*Block, error) {
+    var b *Block
+    err := bs.db.View(func(tx *bolt.Tx) error {
+        key := tx.Bucket(boltHeights).Get(hash)
+        if key == nil {
+            return ErrBlockNotFound
+        }
+        data := tx.Bucket(boltBlocks).Get(key)
+        if data == nil {
+            return ErrBlockNotFound
+        }
+        var err error
+        b, err = boltBlock(data)
+        return err
+    })
+    return b, err
+}
+
+// Height implements Storage.
+func (bs *BoltStorage) Height() int {
+    tip := -1
+    _ = bs.db.View(func(tx *bolt.Tx) error {
+        tip = boltTip(tx)
+        return nil
+    })
+    return tip
+}
+
+// Iterate implements Storage. The blocks are read in one transaction,
+// so fn sees the chain as it was when Iterate started.
+func (bs *BoltStorage) Iterate(fn func(height int, b *Block) error) error {
+    return bs.db.View(func(tx *bolt.Tx) error {
+        c := tx.Bucket(boltBlocks).Cursor()
+        for key, data := c.First(); key != nil; key, data = c.Next() {
+            b, err := boltBlock(data)
+            if err != nil {
+                return fmt.Errorf("stored block %d: %v", binary.BigEndian.Uint64(key), err)
+            }
+            if err := fn(int(binary.BigEndian.Uint64(key)), b); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+// Truncate implements Storage.
+func (bs *BoltStorage) Truncate(height int) error {
+    if height < -1 {
+        height = -1
+    }
+    return bs.db.Update(func(tx *bolt.Tx) error {
+        blocks, heights := tx.Bucket(boltBlocks), tx.Bucket(boltHeights)
+        // collect first: deleting under a cursor skips keys
+        var keys, hashes [][]byte
+        c := blocks.Cursor()
+        for key, data := c.Seek(heightKey(height + 1)); key != nil; key, data = c.Next() {
+            b, err := boltBlock(data)
+            if err != nil {
+                return fmt.Errorf("stored block %d: %v", binary.BigEndian.Uint64(key), err)
+            }
+            keys = append(keys, append([]byte(nil), key...))
+            hashes = append(hashes, b.Hash)
+        }
+        for i := range keys {
+            if err := blocks.Delete(keys[i]); err != nil {
+                return err
+            }
+            if err := heights.Delete(hashes[i]); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+// Close implements Storage.
+func (bs *BoltStorage) Close() error {
+    return bs.db.Close()
+}
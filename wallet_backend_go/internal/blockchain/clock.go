@@ -0,0 +1,22 @@
+package blockchain
+
+// clock.go defines the time source of the chain. Block timestamps and
+// lock-time checks read the chain's Clock instead of the wall clock,
+// so tests can mine at a fixed time and step past lock times without
+// sleeping.
+
+import (
+    "time"
+)
+
+// Clock tells the current time.
+type Clock interface {
+    Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock is the wall clock.
+var SystemClock Clock = systemClock{}
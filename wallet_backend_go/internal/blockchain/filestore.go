@@ -0,0 +1,222 @@
+package blockchain
+
+// filestore.go is a Storage kept in one append-only file. Each block is
+// a record of its JSON encoding preceded by the encoding's length and
+// CRC-32, written and synced before the block joins the chain. Opening
+// the file reads every record to index the blocks by height and hash;
+// a record cut short by a crash, or one whose checksum does not match,
+// ends the chain there and is cut off. Only one process may use a file
+// at a time.
+
+import (
+    "encoding/binary"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "hash/crc32"
+    "io"
+    "log"
+    "os"
+    "path/filepath"
+    "sync"
+)
+
+// ChainFileName is the name of the block file in a FileStorage directory.
+const ChainFileName = "blocks.dat"
+
+const (
+    recordHeaderSize = 8        // length and CRC-32, both big-endian uint32
+    maxRecordSize    = 64 << 20 // larger lengths can only be damage
+)
+
+// FileStorage is a Storage in a single file.
+type FileStorage struct {
+    mu      sync.Mutex
+    f       *os.File
+    offsets []int64        // record offset by height
+    heights map[string]int // height by hex block hash
+    end     int64          // offset past the last record
+}
+
+// OpenFileStorage opens the block file in dir, creating dir and the file
+// when missing.
+func OpenFileStorage(dir string) (*FileStorage, error) {
+    if err := os.MkdirAll(dir, 0o700); err != nil {
+        return nil, err
+    }
+    path := filepath.Join(dir, ChainFileName)
+    f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+    if err != nil {
+        return nil, err
+    }
+    fs := &FileStorage{f: f, heights: make(map[string]int)}
+    if err := fs.load(); err != nil {
+        f.Close()
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    return fs, nil
+}
+
+// load indexes the records and cuts off a damaged tail.
+func (fs *FileStorage) load() error {
+    info, err := fs.f.Stat()
+    if err != nil {
+        return err
+    }
+    size := info.Size()
+    var off int64
+    for off < size {
+        b, n, err := fs.readAt(off)
+        if err != nil {
+            log.Printf("warning: chain file damaged at block %d (%v), dropping %d bytes", len(fs.offsets), err, size-off)
+            if err := fs.f.Truncate(off); err != nil {
+                return err
+            }
+            if err := fs.f.Sync(); err != nil {
+                return err
+            }
+            break
+        }
+        fs.heights[hex.EncodeToString(b.Hash)] = len(fs.offsets)
+        fs.offsets = append(fs.offsets, off)
+        off += n
+    }
+    fs.end = off
+    return nil
+}
+
+// readAt decodes the record at off and returns it with its size.
+func (fs *FileStorage) readAt(off int64) (*Block, int64, error) {
+    var header [recordHeaderSize]byte
+    if _, err := fs.f.ReadAt(header[:], off); err != nil {
+        return nil, 0, err
+    }
+    length := binary.BigEndian.Uint32(header[:4])
+    sum := binary.BigEndian.Uint32(header[4:])
+    if length > maxRecordSize {
+        return nil, 0, fmt.Errorf("record of %d bytes", length)
+    }
+    data := make([]byte, length)
+    if _, err := fs.f.ReadAt(data, off+recordHeaderSize); err != nil {
+        if errors.Is(err, io.EOF) {
+            err = io.ErrUnexpectedEOF
+        }
+        return nil, 0, err
+    }
+    if crc32.ChecksumIEEE(data) != sum {
+        return nil, 0, errors.New("checksum mismatch")
+    }
+    var b Block
+    if err := json.Unmarshal(data, &b); err != nil {
+        return nil, 0, err
+    }
+    return &b, recordHeaderSize + int64(length), nil
+}
+
+// Put implements Storage.
+func (fs *FileStorage) Put(height int, b *Block) error {
+    fs.mu.Lock()
+    defer fs.mu.Unlock()
+
+    if height != len(fs.offsets) {
+        return fmt.Errorf("put block at height %d, tip is %d", height, len(fs.offsets)-1)
+    }
+    data, err := json.Marshal(b)
+    if err != nil {
+        return err
+    }
+    record := make([]byte, recordHeaderSize+len(data))
+    binary.BigEndian.PutUint32(record[:4], uint32(len(data)))
+    binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(data))
+    copy(record[recordHeaderSize:], data)
+    if _, err := fs.f.WriteAt(record, fs.end); err != nil {
+        return err
+    }
+    if err := fs.f.Sync(); err != nil {
+        return err
+    }
+    fs.heights[hex.EncodeToString(b.Hash)] = height
+    fs.offsets = append(fs.offsets, fs.end)
+    fs.end += int64(len(record))
+    return nil
+}
+
+// GetByHeight implements Storage.
+func (fs *FileStorage) GetByHeight(height int) (*Block, error) {
+    fs.mu.Lock()
+    defer fs.mu.Unlock()
+
+    if height < 0 || height >= len(fs.offsets) {
+        return nil, ErrBlockNotFound
+    }
+    b, _, err := fs.readAt(fs.offsets[height])
+    return b, err
+}
+
+// GetByHash implements Storage.
+func (fs *FileStorage) GetByHash(hash []byte) (*Block, error) {
+    fs.mu.Lock()
+    height, ok := fs.heights[hex.EncodeToString(hash)]
+    fs.mu.Unlock()
+    if !ok {
+        return nil, ErrBlockNotFound
+    }
+    return fs.GetByHeight(height)
+}
+
+// Height implements Storage.
+func (fs *FileStorage) Height() int {
+    fs.mu.Lock()
+    defer fs.mu.Unlock()
+    return len(fs.offsets) - 1
+}
+
+// Iterate implements Storage.
+func (fs *FileStorage) Iterate(fn func(height int, b *Block) error) error {
+    for height := 0; ; height++ {
+        b, err := fs.GetByHeight(height)
+        if errors.Is(err, ErrBlockNotFound) {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+        if err := fn(height, b); err != nil {
+            return err
+        }
+    }
+}
+
+// Truncate implements Storage.
+func (fs *FileStorage) Truncate(height int) error {
+    fs.mu.Lock()
+    defer fs.mu.Unlock()
+
+    if height+1 >= len(fs.offsets) {
+        return nil
+    }
+    if height < -1 {
+        height = -1
+    }
+    end := fs.offsets[height+1]
+    if err := fs.f.Truncate(end); err != nil {
+        return err
+    }
+    if err := fs.f.Sync(); err != nil {
+        return err
+    }
+    for hash, h := range fs.heights {
+        if h > height {
+            delete(fs.heights, hash)
+        }
+    }
+    fs.offsets = fs.offsets[:height+1]
+    fs.end = end
+    return nil
+}
+
+// Close implements Storage.
+func (fs *FileStorage) Close() error {
+    return fs.f.Close()
+}
@@ -0,0 +1,113 @@
+package blockchain
+
+// genesis.go builds the genesis block from a chain parameters file, so
+// that every node started from the same file creates the same genesis
+// block: the chain ID and a hash of the whole configuration are part of
+// the genesis transaction, the premine allocations are its outputs and
+// the timestamp and difficulty come from the file instead of the node.
+
+import (
+    "crypto/sha256"
+    "encoding/json"
+    "fmt"
+    "os"
+)
+
+// maxTargetBits bounds the difficulty a genesis file may ask for.
+const maxTargetBits = 32
+
+// GenesisAllocation is one premine output of the genesis block.
+type GenesisAllocation struct {
+    Address string `json:"address"`
+    Amount  int    `json:"amount"`
+}
+
+// GenesisConfig are the chain parameters fixed at the genesis block.
+type GenesisConfig struct {
+    ChainID     string              `json:"chain_id"`
+    Difficulty  int                 `json:"difficulty"` // target bits; 0 means DefaultTargetBits
+    Timestamp   int64               `json:"timestamp"`  // unix seconds
+    Allocations []GenesisAllocation `json:"allocations"`
+}
+
+// LoadGenesisConfig reads and validates a genesis file (JSON).
+func LoadGenesisConfig(path string) (*GenesisConfig, error) {
+    raw, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("read genesis file: %w", err)
+    }
+    var g GenesisConfig
+    if err := json.Unmarshal(raw, &g); err != nil {
+        return nil, fmt.Errorf("parse genesis file: %w", err)
+    }
+    if err := g.Validate(); err != nil {
+        return nil, err
+    }
+    return &g, nil
+}
+
+// Validate checks that the configuration describes a usable chain.
+func (g *GenesisConfig) Validate() error {
+    if g.ChainID == "" {
+        return fmt.Errorf("genesis: chain_id is required")
+    }
+    if g.Timestamp <= 0 {
+        return fmt.Errorf("genesis: timestamp is required")
+    }
+    if g.Difficulty < 0 || g.Difficulty > maxTargetBits {
+        return fmt.Errorf("genesis: difficulty must be between 0 (default) and %d", maxTargetBits)
+    }
+    if len(g.Allocations) == 0 {
+        return fmt.Errorf("genesis: at least one allocation is required")
+    }
+    for i, a := range g.Allocations {
+        if !ValidateAddress(a.Address) {
+            return fmt.Errorf("genesis: allocation %d: invalid address %q", i, a.Address)
+        }
+        if a.Amount <= 0 {
+            return fmt.Errorf("genesis: allocation %d: amount must be positive", i)
+        }
+    }
+    return nil
+}
+
+// TargetBits returns the difficulty the chain is mined at.
+func (g *GenesisConfig) TargetBits() int {
+    if g.Difficulty == 0 {
+        return DefaultTargetBits
+    }
+    return g.Difficulty
+}
+
+// Hash is the SHA-256 of the configuration's canonical JSON encoding.
+func (g *GenesisConfig) Hash() []byte {
+    raw, _ := json.Marshal(g)
+    sum := sha256.Sum256(raw)
+    return sum[:]
+}
+
+// GenesisTx returns the coinbase transaction paying the allocations.
+// Its input data commits to the chain ID and the configuration hash.
+func (g *GenesisConfig) GenesisTx() *Transaction {
+    txin := TxInput{
+        Txid:   []byte{},
+        Vout:   -1,
+        PubKey: []byte(fmt.Sprintf("Genesis Block %s %x", g.ChainID, g.Hash())),
+    }
+    tx := Transaction{Vin: []TxInput{txin}}
+    for _, a := range g.Allocations {
+        pubKeyHash, _ := DecodeAddress(a.Address)
+        tx.Vout = append(tx.Vout, TxOutput{Value: a.Amount, PubKeyHash: pubKeyHash})
+    }
+    tx.SetID()
+    return &tx
+}
+
+// NewBlockchainFromGenesis creates a blockchain whose genesis block is
+// built from g. It sets the mining difficulty to g's (see
+// SetDifficulty), so it must not run while blocks are being mined.
+func NewBlockchainFromGenesis(g *GenesisConfig, clock Clock) *Blockchain {
+    SetDifficulty(g.TargetBits())
+    genesis := NewBlockAt([]*Transaction{g.GenesisTx()}, []byte{}, g.Timestamp)
+    return &Blockchain{Blocks: []*Block{genesis}, Clock: clock, ChainID: g.ChainID}
+}
@@ -0,0 +1,139 @@
+package blockchain
+
+// hdwallet.go derives wallets hierarchically from one seed (see
+// mnemonic.go), as BIP‑32 does, with the SLIP‑0010 rules for the P‑256
+// curve the chain's keys use. Wallets sit on BIP‑44 style paths
+// m/44'/HDCoinType'/account'/0/index, so the n-th wallet of a seed is
+// always the same key.
+
+import (
+    "crypto/elliptic"
+    "crypto/hmac"
+    "crypto/sha512"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "math/big"
+    "strconv"
+    "strings"
+)
+
+// HardenedOffset is added to the index of a hardened child key.
+const HardenedOffset uint32 = 1 << 31
+
+// HDCoinType is the BIP‑44 coin type of wallet paths. The chain has no
+// registered SLIP‑44 type and uses the one for test networks.
+const HDCoinType = 1
+
+// MaxHDIndex is the highest unhardened child index.
+const MaxHDIndex = HardenedOffset - 1
+
+var errHDInvalidPath = errors.New("invalid derivation path")
+
+// HDKey is an extended private key: a P‑256 private key and the chain
+// code its children are derived with.
+type HDKey struct {
+    D         *big.Int
+    ChainCode []byte
+}
+
+// NewMasterKey derives the master key of seed.
+func NewMasterKey(seed []byte) (*HDKey, error) {
+    if len(seed) < 16 || len(seed) > 64 {
+        return nil, fmt.Errorf("seed of %d bytes: must be 16 to 64", len(seed))
+    }
+    n := elliptic.P256().Params().N
+    data := seed
+    for {
+        I := hmacSHA512([]byte("Nist256p1 seed"), data)
+        d := new(big.Int).SetBytes(I[:32])
+        if d.Sign() > 0 && d.Cmp(n) < 0 {
+            return &HDKey{D: d, ChainCode: I[32:]}, nil
+        }
+        data = I
+    }
+}
+
+// Child derives the child key at index i; indexes from HardenedOffset
+// up are hardened, so their public keys cannot be derived from the
+// parent's public key.
+func (k *HDKey) Child(i uint32) *HDKey {
+    curve := elliptic.P256()
+    n := curve.Params().N
+
+    var data []byte
+    if i >= HardenedOffset {
+        data = append([]byte{0}, k.D.FillBytes(make([]byte, 32))...)
+    } else {
+        x, y := curve.ScalarBaseMult(k.D.FillBytes(make([]byte, 32)))
+        data = elliptic.MarshalCompressed(curve, x, y)
+    }
+    data = binary.BigEndian.AppendUint32(data, i)
+    for {
+        I := hmacSHA512(k.ChainCode, data)
+        il := new(big.Int).SetBytes(I[:32])
+        d := new(big.Int).Add(il, k.D)
+        d.Mod(d, n)
+        if il.Cmp(n) < 0 && d.Sign() > 0 {
+            return &HDKey{D: d, ChainCode: I[32:]}
+        }
+        // SLIP‑0010: try again with the right half
+        data = binary.BigEndian.AppendUint32(append([]byte{1}, I[32:]...), i)
+    }
+}
+
+// Derive follows path, e.g. "m/44'/1'/0'/0/5", from k, which must be
+// a master key. An apostrophe or h marks a hardened index.
+func (k *HDKey) Derive(path string) (*HDKey, error) {
+    parts := strings.Split(path, "/")
+    if parts[0] != "m" {
+        return nil, errHDInvalidPath
+    }
+    key := k
+    for _, p := range parts[1:] {
+        hardened := strings.HasSuffix(p, "'") || strings.HasSuffix(p, "h")
+        if hardened {
+            p = p[:len(p)-1]
+        }
+        i, err := strconv.ParseUint(p, 10, 32)
+        if err != nil || uint32(i) > MaxHDIndex {
+            return nil, errHDInvalidPath
+        }
+        if hardened {
+            i += uint64(HardenedOffset)
+        }
+        key = key.Child(uint32(i))
+    }
+    return key, nil
+}
+
+// Wallet returns the wallet of the key.
+func (k *HDKey) Wallet() *Wallet {
+    priv := BigIntToPrivateKey(k.D.Bytes(), elliptic.P256())
+    return &Wallet{PrivateKey: priv, PublicKey: EncodePublicKey(&priv.PublicKey)}
+}
+
+// HDAccountPath is the path of an account's wallets,
+// m/44'/HDCoinType'/account'/0; wallet i is at HDAccountPath/i.
+func HDAccountPath(account uint32) string {
+    return fmt.Sprintf("m/44'/%d'/%d'/0", HDCoinType, account)
+}
+
+// HDAccountKey derives the key of an account's wallets from seed; its
+// children are the wallets.
+func HDAccountKey(seed []byte, account uint32) (*HDKey, error) {
+    if account > MaxHDIndex {
+        return nil, errHDInvalidPath
+    }
+    master, err := NewMasterKey(seed)
+    if err != nil {
+        return nil, err
+    }
+    return master.Derive(HDAccountPath(account))
+}
+
+func hmacSHA512(key, data []byte) []byte {
+    mac := hmac.New(sha512.New, key)
+    mac.Write(data)
+    return mac.Sum(nil)
+}
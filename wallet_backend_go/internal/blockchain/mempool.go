@@ -0,0 +1,232 @@
+package blockchain
+
+// mempool.go queues verified transactions until a miner batches them
+// into a block. The pool reserves the outputs its transactions spend so
+// that no two pending transactions spend the same output, and remembers
+// the transactions it dropped so their senders can learn why.
+
+import (
+    "errors"
+    "fmt"
+    "sync"
+    "time"
+)
+
+// Mempool entry statuses.
+const (
+    MempoolPending = "pending" // waiting for a block
+    MempoolMining  = "mining"  // taken by the miner
+    MempoolDropped = "dropped" // removed without being mined
+)
+
+// maxDropped bounds the dropped entries the pool remembers.
+const maxDropped = 1000
+
+var (
+    // ErrMempoolFull is returned by Add when the pool holds its maximum.
+    ErrMempoolFull = errors.New("mempool is full")
+    // ErrMempoolConflict is returned by Add for a transaction spending an
+    // output a pending transaction already spends.
+    ErrMempoolConflict = errors.New("transaction spends an output of a pending transaction")
+)
+
+// MempoolEntry is a transaction in the pool.
+type MempoolEntry struct {
+    Tx      *Transaction
+    From    string
+    To      string
+    Amount  int
+    AddedAt time.Time
+    Status  string
+    // Reason says why a dropped transaction was not mined.
+    Reason string
+}
+
+// Mempool is a FIFO pool of transactions waiting to be mined.
+type Mempool struct {
+    mu       sync.Mutex
+    max      int
+    entries  []*MempoolEntry          // oldest first
+    byID     map[string]*MempoolEntry // by hex txid
+    reserved map[string]bool          // "txid:vout" spent by entries
+    dropped  map[string]*MempoolEntry
+    dropList []string // dropped txids, oldest first
+    ready    chan struct{}
+}
+
+// NewMempool returns an empty pool holding at most max transactions.
+func NewMempool(max int) *Mempool {
+    return &Mempool{
+        max:      max,
+        byID:     make(map[string]*MempoolEntry),
+        reserved: make(map[string]bool),
+        dropped:  make(map[string]*MempoolEntry),
+        ready:    make(chan struct{}, 1),
+    }
+}
+
+func outpoint(txid []byte, vout int) string {
+    return fmt.Sprintf("%x:%d", txid, vout)
+}
+
+// Add queues e.Tx, which the caller has verified, as pending.
+func (m *Mempool) Add(e MempoolEntry) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    if len(m.entries) >= m.max {
+        return ErrMempoolFull
+    }
+    for _, in := range e.Tx.Vin {
+        if m.reserved[outpoint(in.Txid, in.Vout)] {
+            return ErrMempoolConflict
+        }
+    }
+    for _, in := range e.Tx.Vin {
+        m.reserved[outpoint(in.Txid, in.Vout)] = true
+    }
+    e.Status = MempoolPending
+    entry := &e
+    id := fmt.Sprintf("%x", e.Tx.ID)
+    m.entries = append(m.entries, entry)
+    m.byID[id] = entry
+    delete(m.dropped, id)
+    return nil
+}
+
+// Reserved returns the outputs spent by pooled transactions, keyed
+// "txid:vout", for building new transactions around them.
+func (m *Mempool) Reserved() map[string]bool {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    out := make(map[string]bool, len(m.reserved))
+    for k := range m.reserved {
+        out[k] = true
+    }
+    return out
+}
+
+// Take marks up to max of the oldest pending transactions as mining
+// and returns them.
+func (m *Mempool) Take(max int) []MempoolEntry {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    var out []MempoolEntry
+    for _, e := range m.entries {
+        if len(out) == max {
+            break
+        }
+        if e.Status == MempoolPending {
+            e.Status = MempoolMining
+            out = append(out, *e)
+        }
+    }
+    return out
+}
+
+// Mined removes the transactions txids, which made it into a block.
+func (m *Mempool) Mined(txids []string) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    for _, id := range txids {
+        m.remove(id)
+    }
+}
+
+// Drop removes the transaction txid and remembers why.
+func (m *Mempool) Drop(txid, reason string) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    e := m.remove(txid)
+    if e == nil {
+        return
+    }
+    e.Status, e.Reason = MempoolDropped, reason
+    m.dropped[txid] = e
+    m.dropList = append(m.dropList, txid)
+    if len(m.dropList) > maxDropped {
+        delete(m.dropped, m.dropList[0])
+        m.dropList = m.dropList[1:]
+    }
+}
+
+// Requeue puts transactions taken by a miner that failed back to
+// pending.
+func (m *Mempool) Requeue(txids []string) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    for _, id := range txids {
+        if e, ok := m.byID[id]; ok {
+            e.Status = MempoolPending
+        }
+    }
+}
+
+// remove deletes txid from the pool and releases its outputs.
+func (m *Mempool) remove(txid string) *MempoolEntry {
+    e, ok := m.byID[txid]
+    if !ok {
+        return nil
+    }
+    delete(m.byID, txid)
+    for i, cur := range m.entries {
+        if cur == e {
+            m.entries = append(m.entries[:i], m.entries[i+1:]...)
+            break
+        }
+    }
+    for _, in := range e.Tx.Vin {
+        delete(m.reserved, outpoint(in.Txid, in.Vout))
+    }
+    return e
+}
+
+// Get returns the pooled or dropped transaction txid.
+func (m *Mempool) Get(txid string) (MempoolEntry, bool) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if e, ok := m.byID[txid]; ok {
+        return *e, true
+    }
+    if e, ok := m.dropped[txid]; ok {
+        return *e, true
+    }
+    return MempoolEntry{}, false
+}
+
+// List returns the pooled transactions, oldest first.
+func (m *Mempool) List() []MempoolEntry {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    out := make([]MempoolEntry, len(m.entries))
+    for i, e := range m.entries {
+        out[i] = *e
+    }
+    return out
+}
+
+// Pending returns the number of transactions waiting for a block.
+func (m *Mempool) Pending() int {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    n := 0
+    for _, e := range m.entries {
+        if e.Status == MempoolPending {
+            n++
+        }
+    }
+    return n
+}
+
+// Signal wakes the miner waiting on Ready.
+func (m *Mempool) Signal() {
+    select {
+    case m.ready <- struct{}{}:
+    default:
+    }
+}
+
+// Ready receives after Signal.
+func (m *Mempool) Ready() <-chan struct{} {
+    return m.ready
+}
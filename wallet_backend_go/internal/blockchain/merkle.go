@@ -0,0 +1,47 @@
+package blockchain
+
+// merkle.go provides a plain binary Merkle tree over SHA‑256 used to
+// commit to sets of records (such as the UTXO set) so that external
+// auditors can check a published root against the data they were given.
+// Parents are SHA‑256(left || right); a level with an odd number of
+// nodes carries its last node up unchanged. The root of an empty tree
+// is 32 zero bytes.
+
+import (
+    "crypto/sha256"
+    "encoding/binary"
+)
+
+// MerkleRoot computes the root over already hashed leaves.
+func MerkleRoot(leaves [][]byte) []byte {
+    if len(leaves) == 0 {
+        return make([]byte, sha256.Size)
+    }
+
+    level := leaves
+    for len(level) > 1 {
+        next := make([][]byte, 0, (len(level)+1)/2)
+        for i := 0; i < len(level); i += 2 {
+            if i+1 == len(level) {
+                next = append(next, level[i])
+                continue
+            }
+            h := sha256.Sum256(append(append([]byte{}, level[i]...), level[i+1]...))
+            next = append(next, h[:])
+        }
+        level = next
+    }
+    return level[0]
+}
+
+// UTXOLeaf hashes one unspent output for a UTXO set commitment:
+// SHA‑256(txid || uint32be(vout) || pubKeyHash || uint64be(value)).
+func UTXOLeaf(txid []byte, vout int, out TxOutput) []byte {
+    buf := make([]byte, 0, len(txid)+4+len(out.PubKeyHash)+8)
+    buf = append(buf, txid...)
+    buf = binary.BigEndian.AppendUint32(buf, uint32(vout))
+    buf = append(buf, out.PubKeyHash...)
+    buf = binary.BigEndian.AppendUint64(buf, uint64(out.Value))
+    h := sha256.Sum256(buf)
+    return h[:]
+}
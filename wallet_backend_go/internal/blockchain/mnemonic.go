@@ -0,0 +1,144 @@
+package blockchain
+
+// mnemonic.go encodes the seeds of HD wallets (see hdwallet.go) as
+// BIP‑39 mnemonics: 12 to 24 words of the English word list, the last
+// of which carries a checksum of the entropy. A mnemonic and an
+// optional passphrase stretch into the 64‑byte seed keys are derived
+// from, so the words alone recover every derived wallet.
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "crypto/sha512"
+    _ "embed"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "math/big"
+    "strings"
+)
+
+//go:embed bip39_english.txt
+var bip39English string
+
+var (
+    mnemonicWords = strings.Fields(bip39English)
+    mnemonicIndex = func() map[string]int {
+        idx := make(map[string]int, len(mnemonicWords))
+        for i, w := range mnemonicWords {
+            idx[w] = i
+        }
+        return idx
+    }()
+)
+
+// ErrInvalidMnemonic reports a mnemonic with unknown words, a wrong
+// number of words or a bad checksum.
+var ErrInvalidMnemonic = errors.New("invalid mnemonic")
+
+// MnemonicWordCounts are the valid lengths of a mnemonic.
+var MnemonicWordCounts = []int{12, 15, 18, 21, 24}
+
+// NewMnemonic draws the entropy for a mnemonic of words words from
+// entropy and returns the mnemonic.
+func NewMnemonic(entropy io.Reader, words int) (string, error) {
+    if words%3 != 0 || words < 12 || words > 24 {
+        return "", fmt.Errorf("mnemonic of %d words: must be 12, 15, 18, 21 or 24", words)
+    }
+    ent := make([]byte, words/3*4)
+    if _, err := io.ReadFull(entropy, ent); err != nil {
+        return "", fmt.Errorf("read mnemonic entropy: %w", err)
+    }
+    return EntropyToMnemonic(ent), nil
+}
+
+// EntropyToMnemonic encodes 16 to 32 bytes of entropy (a multiple of
+// 4) as words: the entropy followed by the first len(ent)/4 bits of
+// its SHA‑256, 11 bits a word.
+func EntropyToMnemonic(ent []byte) string {
+    h := sha256.Sum256(ent)
+    csBits := len(ent) * 8 / 32
+    n := new(big.Int).SetBytes(ent)
+    n.Lsh(n, uint(csBits))
+    n.Or(n, big.NewInt(int64(h[0]>>(8-csBits))))
+
+    count := (len(ent)*8 + csBits) / 11
+    words := make([]string, count)
+    mask := big.NewInt(2047)
+    for i := count - 1; i >= 0; i-- {
+        words[i] = mnemonicWords[new(big.Int).And(n, mask).Int64()]
+        n.Rsh(n, 11)
+    }
+    return strings.Join(words, " ")
+}
+
+// MnemonicToEntropy decodes a mnemonic and checks its checksum.
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+    words := strings.Fields(NormalizeMnemonic(mnemonic))
+    if len(words)%3 != 0 || len(words) < 12 || len(words) > 24 {
+        return nil, ErrInvalidMnemonic
+    }
+    n := new(big.Int)
+    for _, w := range words {
+        i, ok := mnemonicIndex[w]
+        if !ok {
+            return nil, ErrInvalidMnemonic
+        }
+        n.Lsh(n, 11)
+        n.Or(n, big.NewInt(int64(i)))
+    }
+    csBits := len(words) / 3
+    checksum := new(big.Int).And(n, big.NewInt(int64(1)<<csBits-1)).Int64()
+    n.Rsh(n, uint(csBits))
+
+    ent := make([]byte, len(words)/3*4)
+    n.FillBytes(ent)
+    h := sha256.Sum256(ent)
+    if int64(h[0]>>(8-csBits)) != checksum {
+        return nil, ErrInvalidMnemonic
+    }
+    return ent, nil
+}
+
+// ValidMnemonic reports whether mnemonic decodes with a good checksum.
+func ValidMnemonic(mnemonic string) bool {
+    _, err := MnemonicToEntropy(mnemonic)
+    return err == nil
+}
+
+// NormalizeMnemonic returns mnemonic in lower case with single spaces.
+func NormalizeMnemonic(mnemonic string) string {
+    return strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+}
+
+// MnemonicSeed stretches a mnemonic and passphrase into the 64‑byte
+// seed of an HD wallet: PBKDF2‑HMAC‑SHA512 with 2048 iterations and
+// the salt "mnemonic"+passphrase. Every passphrase gives a different,
+// valid seed. The passphrase is used as given, without the Unicode
+// normalization BIP‑39 asks of non‑ASCII passphrases.
+func MnemonicSeed(mnemonic, passphrase string) []byte {
+    return pbkdf2SHA512([]byte(NormalizeMnemonic(mnemonic)), []byte("mnemonic"+passphrase), 2048, 64)
+}
+
+func pbkdf2SHA512(password, salt []byte, iter, keyLen int) []byte {
+    prf := hmac.New(sha512.New, password)
+    var key []byte
+    for block := uint32(1); len(key) < keyLen; block++ {
+        prf.Reset()
+        prf.Write(salt)
+        binary.Write(prf, binary.BigEndian, block)
+        u := prf.Sum(nil)
+        t := append([]byte(nil), u...)
+        for i := 1; i < iter; i++ {
+            prf.Reset()
+            prf.Write(u)
+            u = prf.Sum(u[:0])
+            for j := range t {
+                t[j] ^= u[j]
+            }
+        }
+        key = append(key, t...)
+    }
+    return key[:keyLen]
+}
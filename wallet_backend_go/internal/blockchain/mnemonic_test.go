@@ -0,0 +1,127 @@
+package blockchain
+
+import (
+    "bytes"
+    "encoding/hex"
+    "strings"
+    "testing"
+)
+
+// trezorVectors are from the reference test vectors of BIP-39
+// (trezor/python-mnemonic vectors.json), all with passphrase "TREZOR".
+var trezorVectors = []struct {
+    entropy, mnemonic, seed string
+}{
+    {
+        "00000000000000000000000000000000",
+        "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+        "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+    },
+    {
+        "7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+        "legal winner thank year wave sausage worth useful legal winner thank yellow",
+        "2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+    },
+    {
+        "80808080808080808080808080808080",
+        "letter advice cage absurd amount doctor acoustic avoid letter advice cage above",
+        "d71de856f81a8acc65e6fc851a38d4d7ec216fd0796d0a6827a3ad6ed5511a30fa280f12eb2e47ed2ac03b5c462a0358d18d69fe4f985ec81778c1b370b652a8",
+    },
+    {
+        "ffffffffffffffffffffffffffffffff",
+        "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+        "ac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069",
+    },
+    {
+        "9e885d952ad362caeb4efe34a8e91bd2",
+        "ozone drill grab fiber curtain grace pudding thank cruise elder eight picnic",
+        "274ddc525802f7c828d8ef7ddbcdc5304e87ac3535913611fbbfa986d0c9e5476c91689f9c8a54fd55bd38606aa6a8595ad213d4c9c9f9aca3fb217069a41028",
+    },
+    {
+        "0000000000000000000000000000000000000000000000000000000000000000",
+        "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art",
+        "bda85446c68413707090a52022edd26a1c9462295029f2e60cd7c4f2bbd3097170af7a4d73245cafa9c3cca8d561a7c3de6f5d4a10be8ed2a5e608d68f92fcc8",
+    },
+    {
+        "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+        "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+        "dd48c104698c30cfe2b6142103248622fb7bb0ff692eebb00089b32d22484e1613912f0a5b694407be899ffd31ed3992c456cdf60f5d4564b8ba3f05a69890ad",
+    },
+    {
+        "f585c11aec520db57dd353c69554b21a89b20fb0650966fa0a9d6f74fd989d8f",
+        "void come effort suffer camp survey warrior heavy shoot primary clutch crush open amazing screen patrol group space point ten exist slush involve unfold",
+        "01f5bced59dec48e362f2c45b5de68b9fd6c92c6634f44d6d40aab69056506f0e35524a518034ddc1192e1dacd32c1ed3eaa3c3b131c88ed8e7e54c49a5d0998",
+    },
+}
+
+func TestMnemonicTrezorVectors(t *testing.T) {
+    if len(mnemonicWords) != 2048 {
+        t.Fatalf("word list has %d words, want 2048", len(mnemonicWords))
+    }
+    for _, v := range trezorVectors {
+        ent, _ := hex.DecodeString(v.entropy)
+        if got := EntropyToMnemonic(ent); got != v.mnemonic {
+            t.Errorf("EntropyToMnemonic(%s) = %q, want %q", v.entropy, got, v.mnemonic)
+        }
+        got, err := MnemonicToEntropy(v.mnemonic)
+        if err != nil || !bytes.Equal(got, ent) {
+            t.Errorf("MnemonicToEntropy(%q) = %x, %v, want %s", v.mnemonic, got, err, v.entropy)
+        }
+        if seed := hex.EncodeToString(MnemonicSeed(v.mnemonic, "TREZOR")); seed != v.seed {
+            t.Errorf("MnemonicSeed(%q) = %s, want %s", v.mnemonic, seed, v.seed)
+        }
+    }
+}
+
+func TestMnemonicNormalized(t *testing.T) {
+    v := trezorVectors[1]
+    messy := "  " + strings.ToUpper(strings.ReplaceAll(v.mnemonic, " ", " \t ")) + "\n"
+    if !ValidMnemonic(messy) {
+        t.Fatalf("%q does not validate", messy)
+    }
+    if seed := hex.EncodeToString(MnemonicSeed(messy, "TREZOR")); seed != v.seed {
+        t.Errorf("seed of the unnormalized mnemonic = %s, want %s", seed, v.seed)
+    }
+    if bytes.Equal(MnemonicSeed(v.mnemonic, "TREZOR"), MnemonicSeed(v.mnemonic, "trezor")) {
+        t.Error("passphrases differing in case give the same seed")
+    }
+}
+
+func TestMnemonicRejects(t *testing.T) {
+    for name, m := range map[string]string{
+        "bad checksum":   "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+        "unknown word":   "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abut",
+        "11 words":       "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+        "13 words":       "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+        "27 words":       strings.Repeat("abandon ", 26) + "about",
+        "empty":          "",
+        "swapped words":  "legal winner thank year wave sausage worth useful legal winner yellow thank",
+    } {
+        if _, err := MnemonicToEntropy(m); err != ErrInvalidMnemonic {
+            t.Errorf("%s: error = %v, want ErrInvalidMnemonic", name, err)
+        }
+    }
+}
+
+func TestNewMnemonic(t *testing.T) {
+    for _, words := range MnemonicWordCounts {
+        m, err := NewMnemonic(bytes.NewReader(bytes.Repeat([]byte{0x7f}, 32)), words)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if n := len(strings.Fields(m)); n != words || !ValidMnemonic(m) {
+            t.Errorf("NewMnemonic(%d) = %q: %d words, valid %v", words, m, n, ValidMnemonic(m))
+        }
+    }
+    if m, _ := NewMnemonic(bytes.NewReader(bytes.Repeat([]byte{0x7f}, 16)), 12); m != trezorVectors[1].mnemonic {
+        t.Errorf("NewMnemonic of 7f bytes = %q, want %q", m, trezorVectors[1].mnemonic)
+    }
+    for _, words := range []int{0, 9, 13, 27} {
+        if _, err := NewMnemonic(bytes.NewReader(make([]byte, 64)), words); err == nil {
+            t.Errorf("NewMnemonic(%d) succeeded", words)
+        }
+    }
+    if _, err := NewMnemonic(bytes.NewReader(make([]byte, 15)), 12); err == nil {
+        t.Error("NewMnemonic succeeded on short entropy")
+    }
+}
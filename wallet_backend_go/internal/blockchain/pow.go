@@ -8,12 +8,38 @@ package blockchain
 
 import (
     "bytes"
+    "context"
     "crypto/sha256"
     "encoding/binary"
     "math/big"
 )
 
-const targetBits = 20 // adjust difficulty here; lower numbers make mining easier
+// DefaultTargetBits is the production difficulty.
+const DefaultTargetBits = 20
+
+// cancelCheckInterval is how many nonces RunContext tries between
+// checks of its context.
+const cancelCheckInterval = 1 << 14
+
+// targetBits is the difficulty blocks are mined and validated at.
+// Lower numbers make mining easier.
+var targetBits = DefaultTargetBits
+
+// SetDifficulty changes the difficulty blocks are mined and validated
+// at and returns the previous one. The difficulty is part of the hashed
+// header, so a chain only validates at the difficulty it was mined at.
+// It exists for tests and tools that need cheap blocks; it must not be
+// called while blocks are being mined or validated.
+func SetDifficulty(bits int) int {
+    prev := targetBits
+    targetBits = bits
+    return prev
+}
+
+// Difficulty returns the current difficulty in target bits.
+func Difficulty() int {
+    return targetBits
+}
 
 // ProofOfWork ties a block to its difficulty target. The target is a
 // big integer computed from targetBits.
@@ -25,7 +51,7 @@ type ProofOfWork struct {
 // NewProofOfWork initializes a proof‑of‑work for the given block.
 func NewProofOfWork(b *Block) *ProofOfWork {
     target := big.NewInt(1)
-    target.Lsh(target, 256-targetBits)
+    target.Lsh(target, uint(256-targetBits))
     pow := &ProofOfWork{block: b, target: target}
     return pow
 }
@@ -51,11 +77,23 @@ func (pow *ProofOfWork) prepareData(nonce int) []byte {
 // than the target is found. It returns the discovered nonce and the
 // corresponding hash.
 func (pow *ProofOfWork) Run() (int, []byte) {
+    nonce, hash, _ := pow.RunContext(context.Background())
+    return nonce, hash
+}
+
+// RunContext is Run that gives up with the context's error once ctx is
+// done, so that abandoned requests stop mining.
+func (pow *ProofOfWork) RunContext(ctx context.Context) (int, []byte, error) {
     var hashInt big.Int
     var hash [32]byte
     nonce := 0
 
     for {
+        if nonce%cancelCheckInterval == 0 {
+            if err := ctx.Err(); err != nil {
+                return 0, nil, err
+            }
+        }
         data := pow.prepareData(nonce)
         hash = sha256.Sum256(data)
         hashInt.SetBytes(hash[:])
@@ -65,7 +103,7 @@ func (pow *ProofOfWork) Run() (int, []byte) {
             nonce++
         }
     }
-    return nonce, hash[:]
+    return nonce, hash[:], nil
 }
 
 // Validate executes a single hash with the stored nonce and checks
@@ -79,6 +117,12 @@ func (pow *ProofOfWork) Validate() bool {
     return hashInt.Cmp(pow.target) == -1
 }
 
+// hash recomputes the block hash for the stored nonce.
+func (pow *ProofOfWork) hash() []byte {
+    hash := sha256.Sum256(pow.prepareData(pow.block.Nonce))
+    return hash[:]
+}
+
 // IntToHex converts an integer to a byte slice in big‑endian order.
 func IntToHex(n int64) []byte {
     buf := new(bytes.Buffer)
@@ -1,70 +1,177 @@
-package blockchain
-
-// query.go adds helper methods to read data from the blockchain,
-// which we use for the block explorer and wallet history APIs.
-
-import (
-    "bytes"
-    "encoding/hex"
-    "errors"
-)
-
-// BlockSummary is a lightweight view of a block for list endpoints.
-type BlockSummary struct {
-    Index     int    `json:"index"`
-    Timestamp int64  `json:"timestamp"`
-    Hash      string `json:"hash"`
-    PrevHash  string `json:"prev_hash"`
-    TxCount   int    `json:"tx_count"`
-}
-
-// ListBlocks returns basic info about all blocks in the chain.
-func (bc *Blockchain) ListBlocks() []BlockSummary {
-    summaries := make([]BlockSummary, 0, len(bc.Blocks))
-    for i, b := range bc.Blocks {
-        summaries = append(summaries, BlockSummary{
-            Index:     i,
-            Timestamp: b.Timestamp,
-            Hash:      hex.EncodeToString(b.Hash),
-            PrevHash:  hex.EncodeToString(b.PrevHash),
-            TxCount:   len(b.Transactions),
-        })
-    }
-    return summaries
-}
-
-// GetBlockByIndex returns a block by its index in the slice.
-func (bc *Blockchain) GetBlockByIndex(idx int) (*Block, bool) {
-    if idx < 0 || idx >= len(bc.Blocks) {
-        return nil, false
-    }
-    return bc.Blocks[idx], true
-}
-
-// GetTransactionsForAddress returns all transactions that have
-// at least one output paying to the given wallet address.
-func (bc *Blockchain) GetTransactionsForAddress(address string) ([]*Transaction, error) {
-    if !ValidateAddress(address) {
-        return nil, errors.New("invalid address")
-    }
-
-    pubKeyHash, err := hex.DecodeString(address)
-    if err != nil {
-        return nil, errors.New("invalid address encoding")
-    }
-
-    var txs []*Transaction
-    for _, b := range bc.Blocks {
-        for _, tx := range b.Transactions {
-            // Check outputs only (receiving side). We can extend later
-            // to also detect "sent" transactions.
-            for _, out := range tx.Vout {
-                if bytes.Equal(out.PubKeyHash, pubKeyHash) {
-                    txs = append(txs, tx)
-                    break
-                }
-            }
-        }
-    }
-    return txs, nil
-}
+package blockchain
+
+// query.go adds helper methods to read data from the blockchain,
+// which we use for the block explorer and wallet history APIs.
+
+import (
+    "encoding/hex"
+    "errors"
+)
+
+// BlockSummary is a lightweight view of a block for list endpoints.
+type BlockSummary struct {
+    Index     int    `json:"index"`
+    Timestamp int64  `json:"timestamp"`
+    Hash      string `json:"hash"`
+    PrevHash  string `json:"prev_hash"`
+    TxCount   int    `json:"tx_count"`
+    Producer  string `json:"producer,omitempty"`
+}
+
+// ListQuery selects and orders a page of a listing. The zero value
+// selects everything, oldest first.
+type ListQuery struct {
+    Offset int
+    Limit  int      // 0 for no limit
+    Since  int64    // UNIX time, inclusive; 0 for no bound
+    Until  int64    // UNIX time, exclusive; 0 for no bound
+    Types  []string // transaction kinds; empty for all (transactions only)
+    Desc   bool     // newest first
+}
+
+// inRange reports whether a block timestamp falls in the query's range.
+func (q ListQuery) inRange(ts int64) bool {
+    return (q.Since == 0 || ts >= q.Since) && (q.Until == 0 || ts < q.Until)
+}
+
+// hasType reports whether the query selects transactions of kind.
+func (q ListQuery) hasType(kind string) bool {
+    if len(q.Types) == 0 {
+        return true
+    }
+    for _, t := range q.Types {
+        if t == kind {
+            return true
+        }
+    }
+    return false
+}
+
+// pageBounds returns the slice of n ordered matches the query's page
+// covers.
+func (q ListQuery) pageBounds(n int) (start, end int) {
+    start = q.Offset
+    if start > n {
+        start = n
+    }
+    end = n
+    if q.Limit > 0 && start+q.Limit < n {
+        end = start + q.Limit
+    }
+    return start, end
+}
+
+// ListBlocks returns basic info about all blocks in the chain.
+func (bc *Blockchain) ListBlocks() []BlockSummary {
+    summaries, _ := bc.QueryBlocks(ListQuery{})
+    return summaries
+}
+
+// QueryBlocks returns the page of blocks q selects by timestamp, in
+// height order, and the number of blocks it selects in all.
+func (bc *Blockchain) QueryBlocks(q ListQuery) ([]BlockSummary, int) {
+    var heights []int
+    for i, b := range bc.Blocks {
+        if q.inRange(b.Timestamp) {
+            heights = append(heights, i)
+        }
+    }
+    if q.Desc {
+        for i, j := 0, len(heights)-1; i < j; i, j = i+1, j-1 {
+            heights[i], heights[j] = heights[j], heights[i]
+        }
+    }
+
+    start, end := q.pageBounds(len(heights))
+    summaries := make([]BlockSummary, 0, end-start)
+    for _, i := range heights[start:end] {
+        b := bc.Blocks[i]
+        summaries = append(summaries, BlockSummary{
+            Index:     i,
+            Timestamp: b.Timestamp,
+            Hash:      hex.EncodeToString(b.Hash),
+            PrevHash:  hex.EncodeToString(b.PrevHash),
+            TxCount:   len(b.Transactions),
+            Producer:  b.ProducerID,
+        })
+    }
+    return summaries, len(heights)
+}
+
+// GetBlockByIndex returns a block by its index in the slice.
+func (bc *Blockchain) GetBlockByIndex(idx int) (*Block, bool) {
+    if idx < 0 || idx >= len(bc.Blocks) {
+        return nil, false
+    }
+    return bc.Blocks[idx], true
+}
+
+// GetTransactionsForAddress returns all transactions that have
+// at least one output paying to the given wallet address.
+func (bc *Blockchain) GetTransactionsForAddress(address string) ([]*Transaction, error) {
+    txs, _, err := bc.QueryTransactionsForAddress(address, ListQuery{}, nil)
+    return txs, err
+}
+
+// QueryTransactionsForAddress returns the page of transactions paying
+// the address that q selects by block timestamp and kind, in chain
+// order, and the number of transactions it selects in all. kind names
+// the kind of a transaction for q.Types; it may be nil when q has no
+// Types.
+func (bc *Blockchain) QueryTransactionsForAddress(address string, q ListQuery, kind func(*Transaction) string) ([]*Transaction, int, error) {
+    if !ValidateAddress(address) {
+        return nil, 0, errors.New("invalid address")
+    }
+
+    pubKeyHash, _ := DecodeAddress(address)
+
+    var txs []*Transaction
+    for _, b := range bc.Blocks {
+        if !q.inRange(b.Timestamp) {
+            continue
+        }
+        for _, tx := range b.Transactions {
+            if len(q.Types) > 0 && (kind == nil || !q.hasType(kind(tx))) {
+                continue
+            }
+            // Check outputs only (receiving side). We can extend later
+            // to also detect "sent" transactions.
+            for _, out := range tx.Vout {
+                if out.IsLockedWith(pubKeyHash) {
+                    txs = append(txs, tx)
+                    break
+                }
+            }
+        }
+    }
+    if q.Desc {
+        for i, j := 0, len(txs)-1; i < j; i, j = i+1, j-1 {
+            txs[i], txs[j] = txs[j], txs[i]
+        }
+    }
+
+    start, end := q.pageBounds(len(txs))
+    return txs[start:end], len(txs), nil
+}
+
+// AnchorRef locates an anchor transaction on the chain.
+type AnchorRef struct {
+    Height int
+    Block  *Block
+    Tx     *Transaction
+    Digest []byte
+}
+
+// FindAnchors returns the anchor transactions recorded under tag,
+// oldest first.
+func (bc *Blockchain) FindAnchors(tag string) []AnchorRef {
+    var refs []AnchorRef
+    for height, b := range bc.Blocks {
+        for _, tx := range b.Transactions {
+            if t, digest, ok := tx.Anchor(); ok && t == tag {
+                refs = append(refs, AnchorRef{Height: height, Block: b, Tx: tx, Digest: digest})
+            }
+        }
+    }
+    return refs
+}
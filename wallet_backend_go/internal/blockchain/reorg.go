@@ -0,0 +1,167 @@
+package blockchain
+
+// reorg.go lets a node switch to a longer chain mined elsewhere (see
+// internal/p2p). The blocks a peer sends are checked like Validate
+// checks the whole chain, for double spends and for what their
+// coinbases mint, before any of them replaces a block of ours.
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+)
+
+// ErrNotLonger is returned by Adopt when the blocks would not make the
+// chain longer.
+var ErrNotLonger = errors.New("received chain is not longer than ours")
+
+// Adopt replaces the blocks above height fork with blocks, when that
+// makes the chain longer. The new blocks must follow Blocks[fork], pass
+// the checks of Validate, mint no more than checkCoinbases allows and
+// spend only outputs that exist and are not spent before, and no more
+// than those outputs hold, into positive outputs; otherwise the
+// chain is left unchanged. OnBlock is called for every new block. The
+// blocks that were dropped from our chain, if any, are returned.
+func (bc *Blockchain) Adopt(fork int, blocks []*Block) ([]*Block, error) {
+    if fork < 0 || fork >= len(bc.Blocks) {
+        return nil, fmt.Errorf("fork height %d is not on the chain", fork)
+    }
+    if fork+1+len(blocks) <= len(bc.Blocks) {
+        return nil, ErrNotLonger
+    }
+
+    candidate := *bc
+    candidate.Blocks = append(bc.Blocks[:fork+1:fork+1], blocks...)
+    if err := candidate.ValidateFrom(fork + 1); err != nil {
+        return nil, err
+    }
+    if err := candidate.checkCoinbases(fork + 1); err != nil {
+        return nil, err
+    }
+    if err := candidate.checkSpends(fork + 1); err != nil {
+        return nil, err
+    }
+
+    dropped := append([]*Block(nil), bc.Blocks[fork+1:]...)
+    if bc.Store != nil {
+        if err := bc.Store.Truncate(fork); err != nil {
+            return nil, fmt.Errorf("%w: %v", ErrStorage, err)
+        }
+        for i, b := range blocks {
+            if err := bc.Store.Put(fork+1+i, b); err != nil {
+                // keep the chain to what the storage holds
+                bc.Blocks = candidate.Blocks[:fork+1+i]
+                return dropped, fmt.Errorf("%w: %v", ErrStorage, err)
+            }
+        }
+    }
+    bc.Blocks = candidate.Blocks
+    if bc.OnBlock != nil {
+        for i, b := range blocks {
+            bc.OnBlock(fork+1+i, b)
+        }
+    }
+    return dropped, nil
+}
+
+// checkSpends checks that no transaction from height on spends an
+// output spent before it, or more than its inputs hold.
+func (bc *Blockchain) checkSpends(height int) error {
+    spent := make(map[string]bool)
+    for i, block := range bc.Blocks {
+        for _, tx := range block.Transactions {
+            if tx.IsCoinbase() {
+                continue
+            }
+            in := 0
+            for _, vin := range tx.Vin {
+                key := outpoint(vin.Txid, vin.Vout)
+                if i >= height {
+                    if spent[key] {
+                        return fmt.Errorf("block %d: transaction %x spends output %s twice", i, tx.ID, key)
+                    }
+                    prev, err := bc.FindTransaction(vin.Txid)
+                    if err != nil || vin.Vout < 0 || vin.Vout >= len(prev.Vout) {
+                        return fmt.Errorf("block %d: transaction %x spends unknown output %s", i, tx.ID, key)
+                    }
+                    in += prev.Vout[vin.Vout].Value
+                }
+                spent[key] = true
+            }
+            if i < height {
+                continue
+            }
+            out := 0
+            for _, o := range tx.Vout {
+                if o.Value <= 0 {
+                    return fmt.Errorf("block %d: transaction %x has a non-positive output", i, tx.ID)
+                }
+                out += o.Value
+            }
+            if out > in {
+                return fmt.Errorf("block %d: transaction %x pays out more than its inputs", i, tx.ID)
+            }
+        }
+    }
+    return nil
+}
+
+// checkCoinbases checks what the coinbases of the blocks from height on
+// mint, as this node would mint it: at most one subsidy coinbase paying
+// exactly CoinbaseReward and at most one fee coinbase paying no more
+// than the fees of its block, each with a single positive output, and
+// at most one anchor, which mints nothing. Faucet drips and bridge
+// credits are only trusted from our own faucet and bridge watcher (a
+// node with peers runs neither), so peer blocks carrying them are
+// refused, as are blocks with several subsidies like the sandbox's
+// funding block.
+func (bc *Blockchain) checkCoinbases(height int) error {
+    for i := height; i < len(bc.Blocks); i++ {
+        var rewards, feeCoinbases, anchors int
+        var others []*Transaction
+        for _, tx := range bc.Blocks[i].Transactions {
+            if !tx.IsCoinbase() {
+                others = append(others, tx)
+            }
+        }
+        for _, tx := range bc.Blocks[i].Transactions {
+            if !tx.IsCoinbase() {
+                continue
+            }
+            if tx.IsAnchor() {
+                anchors++
+                if anchors > 1 {
+                    return fmt.Errorf("block %d: more than one anchor", i)
+                }
+                continue
+            }
+            if len(tx.Vout) != 1 || tx.Vout[0].Value <= 0 {
+                return fmt.Errorf("block %d: coinbase %x must have one positive output", i, tx.ID)
+            }
+            value := tx.Vout[0].Value
+            switch {
+            case tx.IsFeeCoinbase():
+                feeCoinbases++
+                if feeCoinbases > 1 {
+                    return fmt.Errorf("block %d: more than one fee coinbase", i)
+                }
+                if fees := bc.BlockFees(others); value > fees {
+                    return fmt.Errorf("block %d: fee coinbase %x pays %d, the block's fees are %d", i, tx.ID, value, fees)
+                }
+            case tx.IsFaucet():
+                return fmt.Errorf("block %d: faucet drip %x is not accepted from peers", i, tx.ID)
+            case bytes.HasPrefix(tx.Vin[0].PubKey, []byte(bridgeData)):
+                return fmt.Errorf("block %d: bridge credit %x is not accepted from peers", i, tx.ID)
+            default:
+                rewards++
+                if rewards > 1 {
+                    return fmt.Errorf("block %d: more than one subsidy coinbase", i)
+                }
+                if value != CoinbaseReward {
+                    return fmt.Errorf("block %d: coinbase %x pays %d, not the reward of %d", i, tx.ID, value, CoinbaseReward)
+                }
+            }
+        }
+    }
+    return nil
+}
@@ -0,0 +1,105 @@
+package blockchain
+
+import (
+    "strings"
+    "testing"
+)
+
+// TestAdoptCoinbases mines a block of each kind of coinbase this server
+// produces on a peer's chain and checks whether our chain, which only
+// has the genesis block, adopts it.
+func TestAdoptCoinbases(t *testing.T) {
+    prev := SetDifficulty(8)
+    t.Cleanup(func() { SetDifficulty(prev) })
+    to := NewWallet().GetAddress()
+
+    tests := []struct {
+        name string
+        txs  []*Transaction
+        want string // empty when the block is adopted
+    }{
+        {"admin fund", []*Transaction{NewCoinbaseTx(to, "admin_faucet_reward")}, ""},
+        {"zakat anchor", []*Transaction{NewAnchorTx("zakat-run:1", []byte{1, 2, 3})}, ""},
+        {"reward and anchor", []*Transaction{
+            NewCoinbaseTx(to, "admin_faucet_reward"), NewAnchorTx("zakat-run:1", []byte{1}),
+        }, ""},
+        {"two anchors", []*Transaction{
+            NewAnchorTx("zakat-run:1", []byte{1}), NewAnchorTx("zakat-run:2", []byte{2}),
+        }, "more than one anchor"},
+        {"faucet drip", []*Transaction{NewFaucetTx(to, 100)}, "faucet drip"},
+        {"faucet drip of the reward", []*Transaction{NewFaucetTx(to, CoinbaseReward)}, "faucet drip"},
+        {"bridge credit", []*Transaction{NewBridgeTx(to, 500, "btc:ab:0")}, "bridge credit"},
+        {"sandbox funding", []*Transaction{
+            NewCoinbaseTx(to, "sandbox_funding"), NewCoinbaseTx(NewWallet().GetAddress(), "sandbox_funding"),
+        }, "more than one subsidy"},
+        {"inflated reward", []*Transaction{func() *Transaction {
+            tx := NewCoinbaseTx(to, "")
+            tx.Vout[0].Value = CoinbaseReward + 1
+            tx.SetID()
+            return tx
+        }()}, "not the reward"},
+        {"fee coinbase without fees", []*Transaction{NewFeeCoinbaseTx(to, 10, 1)}, "the block's fees are 0"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            peer := NewBlockchain(to)
+            ours := *peer
+            ours.Blocks = peer.Blocks[:1:1]
+            peer.AddBlock(tt.txs)
+
+            _, err := ours.Adopt(0, peer.Blocks[1:])
+            if tt.want == "" {
+                if err != nil {
+                    t.Fatalf("Adopt: %v", err)
+                }
+                if len(ours.Blocks) != 2 {
+                    t.Errorf("chain has %d blocks after adopting, want 2", len(ours.Blocks))
+                }
+                return
+            }
+            if err == nil || !strings.Contains(err.Error(), tt.want) {
+                t.Errorf("Adopt error = %v, want one mentioning %q", err, tt.want)
+            }
+            if len(ours.Blocks) != 1 {
+                t.Errorf("chain has %d blocks after a refused adoption, want 1", len(ours.Blocks))
+            }
+        })
+    }
+}
+
+// TestAdoptFeeCoinbase checks that the fee coinbase mined with a
+// transfer is adopted as long as it pays no more than the fees.
+func TestAdoptFeeCoinbase(t *testing.T) {
+    prev := SetDifficulty(8)
+    t.Cleanup(func() { SetDifficulty(prev) })
+    from, to, miner := NewWallet(), NewWallet(), NewWallet()
+
+    peer := NewBlockchain(from.GetAddress())
+    peer.FeeAddress = miner.GetAddress()
+    ours := *peer
+    ours.Blocks = peer.Blocks[:1:1]
+
+    fromHash, _ := DecodeAddress(from.GetAddress())
+    acc, spendable := (&UTXOSet{BC: peer}).FindSpendableOutputs(fromHash, 110)
+    tx, err := NewFeeTransaction(from.PrivateKey, to.GetAddress(), 100, 10, peer, spendable, fromHash, acc)
+    if err != nil {
+        t.Fatal(err)
+    }
+    block := peer.AddBlock([]*Transaction{tx})
+    if !block.Transactions[0].IsFeeCoinbase() {
+        t.Fatal("the block has no fee coinbase")
+    }
+    if _, err := ours.Adopt(0, peer.Blocks[1:]); err != nil {
+        t.Fatalf("Adopt: %v", err)
+    }
+
+    // the same block paying itself more than the fees is refused
+    ours.Blocks = ours.Blocks[:1:1]
+    greedy := NewFeeCoinbaseTx(miner.GetAddress(), 11, 1)
+    peer.Blocks = peer.Blocks[:1]
+    peer.FeeAddress = ""
+    peer.AddBlock([]*Transaction{greedy, tx})
+    if _, err := ours.Adopt(0, peer.Blocks[1:]); err == nil || !strings.Contains(err.Error(), "the block's fees are 10") {
+        t.Errorf("Adopt error = %v, want the fee coinbase refused", err)
+    }
+}
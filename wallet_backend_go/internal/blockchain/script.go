@@ -0,0 +1,258 @@
+package blockchain
+
+// script.go defines the spending conditions an output can carry beyond
+// a bare public key hash. Conditions are encoded in a small versioned
+// "script-lite" format stored in TxOutput.Script: one version byte, one
+// kind byte and a kind-specific payload. Outputs without a script keep
+// the original meaning (single-sig on PubKeyHash), so existing chains
+// and wallets are unaffected.
+//
+// Version 1 payloads:
+//
+//	single-sig  32-byte public key hash
+//	multi-sig   threshold m, key count n, n 32-byte public key hashes
+//	time-lock   8-byte big-endian unlock time (unix seconds), 32-byte public key hash
+//	burn        empty; the output can never be spent
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/binary"
+    "fmt"
+)
+
+// ScriptVersion1 is the only script-lite version understood so far.
+const ScriptVersion1 byte = 0x01
+
+// ConditionKind identifies the spending condition of an output.
+type ConditionKind byte
+
+const (
+    CondSingleSig ConditionKind = 0x01
+    CondMultiSig  ConditionKind = 0x02
+    CondTimeLock  ConditionKind = 0x03
+    CondBurn      ConditionKind = 0x04
+)
+
+// maxMultiSigKeys bounds the number of keys in a multi-sig condition.
+const maxMultiSigKeys = 16
+
+const pubKeyHashLen = sha256.Size
+
+// Condition is the decoded form of an output script.
+type Condition struct {
+    Kind         ConditionKind
+    Threshold    int      // signatures required (multi-sig)
+    PubKeyHashes [][]byte // authorised keys; exactly one except for multi-sig
+    UnlockTime   int64    // earliest spending time in unix seconds (time-lock)
+}
+
+// SingleSig returns the condition paying to one public key hash.
+func SingleSig(pubKeyHash []byte) Condition {
+    return Condition{Kind: CondSingleSig, PubKeyHashes: [][]byte{pubKeyHash}}
+}
+
+// MultiSig returns an m-of-n condition over the given public key hashes.
+func MultiSig(m int, pubKeyHashes ...[]byte) Condition {
+    return Condition{Kind: CondMultiSig, Threshold: m, PubKeyHashes: pubKeyHashes}
+}
+
+// TimeLock returns a condition that pubKeyHash can only satisfy in
+// transactions whose LockTime is at or after unlockTime.
+func TimeLock(unlockTime int64, pubKeyHash []byte) Condition {
+    return Condition{Kind: CondTimeLock, UnlockTime: unlockTime, PubKeyHashes: [][]byte{pubKeyHash}}
+}
+
+// Burn returns the condition of a provably unspendable output.
+func Burn() Condition {
+    return Condition{Kind: CondBurn}
+}
+
+// Validate checks the structural rules of the condition.
+func (c Condition) Validate() error {
+    for _, h := range c.PubKeyHashes {
+        if len(h) != pubKeyHashLen {
+            return fmt.Errorf("public key hash must be %d bytes", pubKeyHashLen)
+        }
+    }
+    switch c.Kind {
+    case CondSingleSig:
+        if len(c.PubKeyHashes) != 1 {
+            return fmt.Errorf("single-sig needs exactly one key")
+        }
+    case CondMultiSig:
+        n := len(c.PubKeyHashes)
+        if n == 0 || n > maxMultiSigKeys {
+            return fmt.Errorf("multi-sig needs 1 to %d keys", maxMultiSigKeys)
+        }
+        if c.Threshold < 1 || c.Threshold > n {
+            return fmt.Errorf("multi-sig threshold must be between 1 and %d", n)
+        }
+        for i := range c.PubKeyHashes {
+            for j := i + 1; j < n; j++ {
+                if bytes.Equal(c.PubKeyHashes[i], c.PubKeyHashes[j]) {
+                    return fmt.Errorf("multi-sig keys must be distinct")
+                }
+            }
+        }
+    case CondTimeLock:
+        if len(c.PubKeyHashes) != 1 {
+            return fmt.Errorf("time-lock needs exactly one key")
+        }
+        if c.UnlockTime <= 0 {
+            return fmt.Errorf("time-lock needs a positive unlock time")
+        }
+    case CondBurn:
+        if len(c.PubKeyHashes) != 0 {
+            return fmt.Errorf("burn takes no keys")
+        }
+    default:
+        return fmt.Errorf("unknown condition kind %d", c.Kind)
+    }
+    return nil
+}
+
+// Encode serializes the condition in the version 1 script format.
+func (c Condition) Encode() ([]byte, error) {
+    if err := c.Validate(); err != nil {
+        return nil, err
+    }
+
+    script := []byte{ScriptVersion1, byte(c.Kind)}
+    switch c.Kind {
+    case CondMultiSig:
+        script = append(script, byte(c.Threshold), byte(len(c.PubKeyHashes)))
+    case CondTimeLock:
+        script = binary.BigEndian.AppendUint64(script, uint64(c.UnlockTime))
+    }
+    for _, h := range c.PubKeyHashes {
+        script = append(script, h...)
+    }
+    return script, nil
+}
+
+// DecodeCondition parses a script produced by Condition.Encode.
+func DecodeCondition(script []byte) (Condition, error) {
+    if len(script) < 2 {
+        return Condition{}, fmt.Errorf("script too short")
+    }
+    if script[0] != ScriptVersion1 {
+        return Condition{}, fmt.Errorf("unsupported script version %d", script[0])
+    }
+
+    c := Condition{Kind: ConditionKind(script[1])}
+    payload := script[2:]
+    keys := 0
+    switch c.Kind {
+    case CondSingleSig:
+        keys = 1
+    case CondMultiSig:
+        if len(payload) < 2 {
+            return Condition{}, fmt.Errorf("multi-sig script too short")
+        }
+        c.Threshold, keys = int(payload[0]), int(payload[1])
+        payload = payload[2:]
+    case CondTimeLock:
+        if len(payload) < 8 {
+            return Condition{}, fmt.Errorf("time-lock script too short")
+        }
+        c.UnlockTime = int64(binary.BigEndian.Uint64(payload))
+        keys = 1
+        payload = payload[8:]
+    case CondBurn:
+    default:
+        return Condition{}, fmt.Errorf("unknown condition kind %d", c.Kind)
+    }
+
+    if len(payload) != keys*pubKeyHashLen {
+        return Condition{}, fmt.Errorf("script payload has %d bytes, want %d", len(payload), keys*pubKeyHashLen)
+    }
+    for i := 0; i < keys; i++ {
+        c.PubKeyHashes = append(c.PubKeyHashes, payload[i*pubKeyHashLen:(i+1)*pubKeyHashLen])
+    }
+    if err := c.Validate(); err != nil {
+        return Condition{}, err
+    }
+    return c, nil
+}
+
+// Address returns the public key hash an output with this condition is
+// filed under: the owner's hash for single-sig and time-lock, the hash
+// of the script for multi-sig and none for burn.
+func (c Condition) Address() []byte {
+    switch c.Kind {
+    case CondSingleSig, CondTimeLock:
+        return c.PubKeyHashes[0]
+    case CondMultiSig:
+        script, err := c.Encode()
+        if err != nil {
+            return nil
+        }
+        h := sha256.Sum256(script)
+        return h[:]
+    }
+    return nil
+}
+
+// String describes the condition for humans, e.g. "multisig 2-of-3".
+func (c Condition) String() string {
+    switch c.Kind {
+    case CondSingleSig:
+        return "singlesig"
+    case CondMultiSig:
+        return fmt.Sprintf("multisig %d-of-%d", c.Threshold, len(c.PubKeyHashes))
+    case CondTimeLock:
+        return fmt.Sprintf("timelock %d", c.UnlockTime)
+    case CondBurn:
+        return "burn"
+    }
+    return fmt.Sprintf("unknown(%d)", c.Kind)
+}
+
+// NewConditionOutput builds an output of value guarded by c.
+func NewConditionOutput(value int, c Condition) (TxOutput, error) {
+    script, err := c.Encode()
+    if err != nil {
+        return TxOutput{}, err
+    }
+    return TxOutput{Value: value, PubKeyHash: c.Address(), Script: script}, nil
+}
+
+// Condition returns the spending condition of the output. Outputs
+// without a script are single-sig on PubKeyHash.
+func (out TxOutput) Condition() (Condition, error) {
+    if len(out.Script) == 0 {
+        return SingleSig(out.PubKeyHash), nil
+    }
+    return DecodeCondition(out.Script)
+}
+
+// IsStandard reports whether the output can be spent with the owner's
+// key alone and no further data, which is what wallet coin selection
+// assumes.
+func (out TxOutput) IsStandard() bool {
+    if len(out.Script) == 0 {
+        return true
+    }
+    c, err := DecodeCondition(out.Script)
+    return err == nil && c.Kind == CondSingleSig
+}
+
+// lock is what gets committed to when signing an input that spends the
+// output: the script if there is one, the public key hash otherwise.
+func (out TxOutput) lock() []byte {
+    if len(out.Script) > 0 {
+        return out.Script
+    }
+    return out.PubKeyHash
+}
+
+// hasKey reports whether pubKeyHash is one of the condition's keys.
+func (c Condition) hasKey(pubKeyHash []byte) bool {
+    for _, h := range c.PubKeyHashes {
+        if bytes.Equal(h, pubKeyHash) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,87 @@
+package blockchain
+
+// stealth.go derives one-time receive addresses (stealth addresses).
+// A payer who knows a wallet's public key P picks an ephemeral key r
+// and pays to the address of P' = P + h·G, where h is the hash of the
+// shared secret r·P. Only the ephemeral public key R = r·G is
+// published; the wallet finds its payments by computing the same
+// secret as d·R and spends them with the one-time private key d + h.
+// Nothing on the chain ties the one-time addresses to each other or to
+// the wallet's own address.
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/sha256"
+    "errors"
+    "fmt"
+    "io"
+    "math/big"
+)
+
+// stealthTag separates the stealth tweak from other uses of the hash.
+const stealthTag = "zakatwallet/stealth/v1"
+
+// ParsePublicKey decodes a 64 byte X||Y public key (each coordinate
+// zero-padded to 32 bytes) and checks that it is on the curve.
+func ParsePublicKey(b []byte) (*ecdsa.PublicKey, error) {
+    if len(b) != 64 {
+        return nil, errors.New("public key must be 64 bytes")
+    }
+    curve := elliptic.P256()
+    x := new(big.Int).SetBytes(b[:32])
+    y := new(big.Int).SetBytes(b[32:])
+    if !curve.IsOnCurve(x, y) {
+        return nil, errors.New("public key is not on the curve")
+    }
+    return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// stealthTweak hashes the shared secret point (x, y) to a scalar.
+func stealthTweak(x, y *big.Int) *big.Int {
+    h := sha256.New()
+    h.Write([]byte(stealthTag))
+    h.Write(EncodePublicKey(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}))
+    t := new(big.Int).SetBytes(h.Sum(nil))
+    return t.Mod(t, elliptic.P256().Params().N)
+}
+
+// NewStealthAddress derives a one-time address paying the owner of
+// pub, drawing the ephemeral key from entropy. It returns the address
+// and the ephemeral public key (64 bytes) the owner needs to find it.
+func NewStealthAddress(pub *ecdsa.PublicKey, entropy io.Reader) (string, []byte, error) {
+    curve := elliptic.P256()
+    for {
+        eph, err := NewWalletFrom(entropy)
+        if err != nil {
+            return "", nil, err
+        }
+        sx, sy := curve.ScalarMult(pub.X, pub.Y, eph.PrivateKey.D.Bytes())
+        t := stealthTweak(sx, sy)
+        if t.Sign() == 0 {
+            continue
+        }
+        tx, ty := curve.ScalarBaseMult(t.Bytes())
+        ox, oy := curve.Add(pub.X, pub.Y, tx, ty)
+        return AddressOf(&ecdsa.PublicKey{Curve: curve, X: ox, Y: oy}), EncodePublicKey(&eph.PrivateKey.PublicKey), nil
+    }
+}
+
+// StealthPrivateKey returns the one-time private key of the stealth
+// address derived for priv's public key with the given ephemeral key.
+func StealthPrivateKey(priv *ecdsa.PrivateKey, ephemeral []byte) (*ecdsa.PrivateKey, error) {
+    eph, err := ParsePublicKey(ephemeral)
+    if err != nil {
+        return nil, fmt.Errorf("ephemeral key: %w", err)
+    }
+    curve := elliptic.P256()
+    sx, sy := curve.ScalarMult(eph.X, eph.Y, priv.D.Bytes())
+    d := stealthTweak(sx, sy)
+    d.Add(d, priv.D)
+    d.Mod(d, curve.Params().N)
+    if d.Sign() == 0 {
+        return nil, errors.New("degenerate stealth key")
+    }
+    key := BigIntToPrivateKey(d.Bytes(), curve)
+    return &key, nil
+}
@@ -0,0 +1,132 @@
+package blockchain
+
+// storage.go lets a chain outlive the process. A Storage keeps the
+// blocks by height and hash; once a chain uses one (UseStorage) every
+// mined block is written to it before it joins the chain, so a node
+// that restarts resumes at the tip it had. BoltStorage (boltstore.go)
+// is the default backend; FileStorage (filestore.go), an append-only
+// file with no dependencies, is kept for the data directories it
+// already holds. Other key-value stores can implement the interface.
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+)
+
+// ErrBlockNotFound is returned by Storage lookups that find nothing.
+var ErrBlockNotFound = errors.New("block not found")
+
+// ErrStorage wraps the errors of writing to the chain's storage, so
+// callers of AddBlockContext can tell them from a cancelled mining.
+var ErrStorage = errors.New("block storage failed")
+
+// Storage keeps the blocks of one chain, genesis at height 0.
+type Storage interface {
+    // Put stores b at height, which must be one past the tip.
+    Put(height int, b *Block) error
+    // GetByHeight and GetByHash return a stored block or
+    // ErrBlockNotFound.
+    GetByHeight(height int) (*Block, error)
+    GetByHash(hash []byte) (*Block, error)
+    // Height returns the tip's height, -1 when nothing is stored.
+    Height() int
+    // Iterate calls fn for every block from genesis to the tip,
+    // stopping at the first error fn returns.
+    Iterate(fn func(height int, b *Block) error) error
+    // Truncate drops every block above height.
+    Truncate(height int) error
+    Close() error
+}
+
+// UseStorage makes st the chain's storage. An empty st is given the
+// chain's current blocks; otherwise the chain is replaced by the stored
+// one, whose blocks after genesis must link up and carry valid
+// proof-of-work, and resumes at its tip. Callers that expect a particular genesis block should compare
+// Blocks[0] afterwards.
+func (bc *Blockchain) UseStorage(st Storage) error {
+    if st.Height() < 0 {
+        for height, b := range bc.Blocks {
+            if err := st.Put(height, b); err != nil {
+                return fmt.Errorf("%w: %v", ErrStorage, err)
+            }
+        }
+        bc.Store = st
+        return nil
+    }
+
+    var blocks []*Block
+    err := st.Iterate(func(height int, b *Block) error {
+        var prev *Block
+        if height > 0 {
+            prev = blocks[height-1]
+        }
+        if err := checkLink(prev, b); err != nil {
+            return fmt.Errorf("stored block %d: %v", height, err)
+        }
+        blocks = append(blocks, b)
+        return nil
+    })
+    if err != nil {
+        return err
+    }
+    bc.Blocks = blocks
+    bc.Store = st
+    return nil
+}
+
+// ImportBlock appends a block mined elsewhere, e.g. one read back from
+// the database, after checking that it extends the tip with valid
+// proof-of-work. Its transactions are not re-verified; see Validate.
+func (bc *Blockchain) ImportBlock(b *Block) error {
+    if err := checkLink(bc.Blocks[len(bc.Blocks)-1], b); err != nil {
+        return err
+    }
+    if bc.Store != nil {
+        if err := bc.Store.Put(len(bc.Blocks), b); err != nil {
+            return fmt.Errorf("%w: %v", ErrStorage, err)
+        }
+    }
+    bc.Blocks = append(bc.Blocks, b)
+    if bc.OnBlock != nil {
+        bc.OnBlock(len(bc.Blocks)-1, b)
+    }
+    return nil
+}
+
+// AdoptGenesis replaces the genesis block of a chain that holds nothing
+// else by g, in its storage too. It is how a node seeding its store
+// takes on the genesis its mirrored blocks were mined on.
+func (bc *Blockchain) AdoptGenesis(g *Block) error {
+    if len(bc.Blocks) != 1 {
+        return fmt.Errorf("the chain holds %d blocks above genesis", len(bc.Blocks)-1)
+    }
+    if bc.Store != nil {
+        if err := bc.Store.Truncate(-1); err != nil {
+            return fmt.Errorf("%w: %v", ErrStorage, err)
+        }
+        if err := bc.Store.Put(0, g); err != nil {
+            return fmt.Errorf("%w: %v", ErrStorage, err)
+        }
+    }
+    bc.Blocks[0] = g
+    return nil
+}
+
+// checkLink checks that b follows prev and that its hash is its valid
+// proof-of-work. The genesis block (prev nil) is configuration rather
+// than mined work and is taken as it is, so that a genesis adopted from
+// the link of the first mined block (see AdoptGenesis) loads too.
+func checkLink(prev, b *Block) error {
+    if prev == nil {
+        return nil
+    }
+    if !bytes.Equal(b.PrevHash, prev.Hash) {
+        return fmt.Errorf("prev hash does not match the block before it")
+    }
+    pow := NewProofOfWork(b)
+    if !pow.Validate() || !bytes.Equal(pow.hash(), b.Hash) {
+        return fmt.Errorf("invalid proof-of-work")
+    }
+    return nil
+}
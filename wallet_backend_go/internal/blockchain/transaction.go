@@ -8,7 +8,6 @@ package blockchain
 import (
     "bytes"
     "crypto/ecdsa"
-    "crypto/elliptic"
     "crypto/rand"
     "crypto/sha256"
     "encoding/gob"
@@ -27,24 +26,39 @@ type TxInput struct {
     Vout      int    // index of the referenced output
     Signature []byte // ECDSA signature proving ownership
     PubKey    []byte // raw public key of the spender
+
+    // Endorsements carries one signature per co-signer when the
+    // referenced output is a multi-sig condition.
+    Endorsements []Endorsement
+}
+
+// Endorsement is a single co-signer's signature and public key.
+type Endorsement struct {
+    Signature []byte
+    PubKey    []byte
 }
 
 // TxOutput represents a payment to a public key hash. Value is
 // denominated in arbitrary units (e.g. satoshis). The PubKeyHash
 // encodes the address (often a hashed public key) that must be
-// provided to spend this output.
+// provided to spend this output. Script optionally replaces that rule
+// with a richer spending condition (see script.go).
 type TxOutput struct {
     Value      int
     PubKeyHash []byte
+    Script     []byte
 }
 
 // Transaction bundles one or more inputs and outputs. The ID field is
 // derived from the transaction's serialized form and uniquely
-// identifies the transaction on chain.
+// identifies the transaction on chain. LockTime (unix seconds) is the
+// earliest time the transaction may be mined; it is what time-locked
+// outputs are checked against.
 type Transaction struct {
-    ID   []byte
-    Vin  []TxInput
-    Vout []TxOutput
+    ID       []byte
+    Vin      []TxInput
+    Vout     []TxOutput
+    LockTime int64
 }
 
 // SetID computes and sets the transaction's ID. A gob encoder is used
@@ -64,12 +78,16 @@ func (tx *Transaction) SetID() {
     tx.ID = hash[:]
 }
 
+// CoinbaseReward is the fixed subsidy of NewCoinbaseTx.
+const CoinbaseReward = 15000
+
 // NewCoinbaseTx creates a coinbase transaction awarding a fixed
 // subsidy to the provided address. Coinbase transactions have a single
 // input with an empty Txid and Vout of ‑1. The Signature and PubKey
 // fields can carry arbitrary data; here we store a human‑readable
-// message describing the reward. Coinbase outputs pay to the
-// recipient's address (represented here directly as a byte slice).
+// message describing the reward. The output pays to the public key
+// hash the address decodes to (see DecodeAddress); callers validate
+// the address first, an invalid one leaves the reward unowned.
 func NewCoinbaseTx(to, data string) *Transaction {
     if data == "" {
         data = fmt.Sprintf("Reward to %s", to)
@@ -82,20 +100,10 @@ func NewCoinbaseTx(to, data string) *Transaction {
         PubKey:    []byte(data),
     }
 
-    // IMPORTANT: store the *decoded* address bytes, same as normal txs
-    var pubKeyHash []byte
-    if to != "" {
-        decoded, err := hex.DecodeString(to)
-        if err == nil {
-            pubKeyHash = decoded
-        } else {
-            // fallback – should not happen with normal wallets
-            pubKeyHash = []byte(to)
-        }
-    }
+    pubKeyHash, _ := DecodeAddress(to)
 
     txout := TxOutput{
-        Value:      15000,
+        Value:      CoinbaseReward,
         PubKeyHash: pubKeyHash,
     }
 
@@ -109,6 +117,120 @@ func NewCoinbaseTx(to, data string) *Transaction {
 }
 
 
+// feeCoinbaseData prefixes the data of the coinbases that collect the
+// fees of a block.
+const feeCoinbaseData = "fees of block "
+
+// NewFeeCoinbaseTx creates the coinbase paying the fees of the block at
+// height to the address. The height in its data keeps the IDs of fee
+// coinbases paying the same amount apart.
+func NewFeeCoinbaseTx(to string, fees, height int) *Transaction {
+    pubKeyHash, _ := DecodeAddress(to)
+    tx := Transaction{
+        Vin:  []TxInput{{Txid: []byte{}, Vout: -1, PubKey: []byte(fmt.Sprintf("%s%d", feeCoinbaseData, height))}},
+        Vout: []TxOutput{{Value: fees, PubKeyHash: pubKeyHash}},
+    }
+    tx.SetID()
+    return &tx
+}
+
+// IsFeeCoinbase reports whether tx is a coinbase collecting the fees
+// of its block.
+func (tx *Transaction) IsFeeCoinbase() bool {
+    return tx.IsCoinbase() && bytes.HasPrefix(tx.Vin[0].PubKey, []byte(feeCoinbaseData))
+}
+
+// faucetData is the data of the coinbases that drip testnet funds.
+const faucetData = "testnet_faucet"
+
+// NewFaucetTx creates the coinbase dripping amount testnet units to the
+// address.
+func NewFaucetTx(to string, amount int) *Transaction {
+    tx := NewCoinbaseTx(to, faucetData)
+    tx.Vout[0].Value = amount
+    tx.ID = nil
+    tx.SetID()
+    return tx
+}
+
+// IsFaucet reports whether tx is a testnet faucet drip.
+func (tx *Transaction) IsFaucet() bool {
+    return tx.IsCoinbase() && bytes.Equal(tx.Vin[0].PubKey, []byte(faucetData))
+}
+
+// bridgeData prefixes the data of the coinbases that credit deposits
+// made on another chain.
+const bridgeData = "bridge "
+
+// NewBridgeTx creates the coinbase crediting amount to the address for
+// a deposit made on another chain, identified by ref (e.g.
+// "btc:<txid>:0"). The ref in its data links the credit to the deposit
+// and keeps credits of the same amount apart.
+func NewBridgeTx(to string, amount int, ref string) *Transaction {
+    pubKeyHash, _ := DecodeAddress(to)
+    tx := Transaction{
+        Vin:  []TxInput{{Txid: []byte{}, Vout: -1, PubKey: []byte(bridgeData + ref)}},
+        Vout: []TxOutput{{Value: amount, PubKeyHash: pubKeyHash}},
+    }
+    tx.SetID()
+    return &tx
+}
+
+// BridgeRef returns the deposit a bridge coinbase credits.
+func (tx *Transaction) BridgeRef() (string, bool) {
+    if !tx.IsCoinbase() || len(tx.Vout) != 1 {
+        return "", false
+    }
+    ref, found := bytes.CutPrefix(tx.Vin[0].PubKey, []byte(bridgeData))
+    if !found || len(ref) == 0 {
+        return "", false
+    }
+    return string(ref), true
+}
+
+// anchorData prefixes the data of the transactions that anchor a
+// commitment on chain.
+const anchorData = "anchor "
+
+// NewAnchorTx creates a transaction that records digest on chain under
+// tag, e.g. the root of a report, so that anyone can later check that
+// the report has not changed since. It is shaped like a coinbase
+// without outputs: it moves no coins and needs no signature. The tag
+// must not contain spaces.
+func NewAnchorTx(tag string, digest []byte) *Transaction {
+    tx := Transaction{
+        Vin: []TxInput{{Txid: []byte{}, Vout: -1, PubKey: []byte(fmt.Sprintf("%s%s %x", anchorData, tag, digest))}},
+    }
+    tx.SetID()
+    return &tx
+}
+
+// Anchor returns the tag and digest an anchor transaction records.
+func (tx *Transaction) Anchor() (tag string, digest []byte, ok bool) {
+    if !tx.IsCoinbase() || len(tx.Vout) != 0 {
+        return "", nil, false
+    }
+    rest, found := bytes.CutPrefix(tx.Vin[0].PubKey, []byte(anchorData))
+    if !found {
+        return "", nil, false
+    }
+    t, d, found := bytes.Cut(rest, []byte(" "))
+    if !found {
+        return "", nil, false
+    }
+    digest, err := hex.DecodeString(string(d))
+    if err != nil {
+        return "", nil, false
+    }
+    return string(t), digest, true
+}
+
+// IsAnchor reports whether tx is an anchor transaction.
+func (tx *Transaction) IsAnchor() bool {
+    _, _, ok := tx.Anchor()
+    return ok
+}
+
 // IsCoinbase returns true if the transaction has the structure of a
 // coinbase transaction.
 func (tx *Transaction) IsCoinbase() bool {
@@ -116,10 +238,10 @@ func (tx *Transaction) IsCoinbase() bool {
 }
 
 // TrimmedCopy returns a copy of the transaction with blanked out
-// signatures and public keys. This copy is used to calculate
-// deterministic hashes for signing inputs. Each input's PubKey field
-// will later be filled with the previous output's PubKeyHash before
-// hashing.
+// signatures, public keys and endorsements. This copy is used to
+// calculate deterministic hashes for signing inputs. Each input's
+// PubKey field will later be filled with the previous output's
+// PubKeyHash (or script) before hashing.
 func (tx *Transaction) TrimmedCopy() Transaction {
     var inputs []TxInput
     var outputs []TxOutput
@@ -128,19 +250,21 @@ func (tx *Transaction) TrimmedCopy() Transaction {
         inputs = append(inputs, TxInput{Txid: vin.Txid, Vout: vin.Vout, Signature: nil, PubKey: nil})
     }
     for _, vout := range tx.Vout {
-        outputs = append(outputs, TxOutput{Value: vout.Value, PubKeyHash: vout.PubKeyHash})
+        outputs = append(outputs, TxOutput{Value: vout.Value, PubKeyHash: vout.PubKeyHash, Script: vout.Script})
     }
 
-    txCopy := Transaction{ID: tx.ID, Vin: inputs, Vout: outputs}
+    txCopy := Transaction{ID: tx.ID, Vin: inputs, Vout: outputs, LockTime: tx.LockTime}
     return txCopy
 }
 
 // Sign signs each input of the transaction using the provided
 // private key. prevTXs maps transaction IDs (as hex strings) to
 // previous transactions referenced by this transaction. For each input,
-// the corresponding previous output's PubKeyHash is injected into
-// the trimmed copy, hashed, and then signed. The resulting signature
-// is stored in the original transaction's input.
+// the corresponding previous output's PubKeyHash (or script) is
+// injected into the trimmed copy, hashed, and then signed. The
+// resulting signature is stored in the original transaction's input;
+// inputs spending a multi-sig output collect one endorsement per
+// co-signer instead, so each co-signer calls Sign with their own key.
 func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) error {
     if tx.IsCoinbase() {
         return nil
@@ -153,8 +277,17 @@ func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transac
         if !ok {
             return fmt.Errorf("previous transaction not found")
         }
-        // Set the referenced output's pubKeyHash on the copy
-        txCopy.Vin[inIdx].PubKey = prevTx.Vout[vin.Vout].PubKeyHash
+        prevOut := prevTx.Vout[vin.Vout]
+        cond, err := prevOut.Condition()
+        if err != nil {
+            return err
+        }
+        if cond.Kind == CondBurn {
+            return fmt.Errorf("input %d spends a burn output", inIdx)
+        }
+        pubKey := signingKey(&privKey.PublicKey, cond)
+        // Set the referenced output's lock on the copy
+        txCopy.Vin[inIdx].PubKey = prevOut.lock()
         // Compute hash for signing
         txCopy.ID = txCopy.Hash()
         // Clear the pubkey so the next input doesn't reuse it
@@ -164,59 +297,171 @@ func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transac
         if err != nil {
             return err
         }
-        signature := append(r.Bytes(), s.Bytes()...)
+        // fixed-width halves: Verify splits the signature in the middle
+        signature := make([]byte, 64)
+        r.FillBytes(signature[:32])
+        s.FillBytes(signature[32:])
+
+        if cond.Kind == CondMultiSig {
+            e := Endorsement{Signature: signature, PubKey: pubKey}
+            replaced := false
+            for i, prev := range tx.Vin[inIdx].Endorsements {
+                if bytes.Equal(prev.PubKey, pubKey) {
+                    tx.Vin[inIdx].Endorsements[i] = e
+                    replaced = true
+                }
+            }
+            if !replaced {
+                tx.Vin[inIdx].Endorsements = append(tx.Vin[inIdx].Endorsements, e)
+            }
+            continue
+        }
         tx.Vin[inIdx].Signature = signature
-        tx.Vin[inIdx].PubKey = append(privKey.PublicKey.X.Bytes(), privKey.PublicKey.Y.Bytes()...)
+        tx.Vin[inIdx].PubKey = pubKey
     }
     return nil
 }
 
-// Verify verifies each input's signature against the corresponding
-// previous output's PubKeyHash. A copy of the transaction with
-// signatures blanked out is used to compute the hash. If any
-// signature fails verification, the transaction is invalid.
+// signingKey returns the encoding of pub an input spending an output
+// with condition cond carries: the legacy one if the output is locked
+// to the key's legacy address, the canonical one otherwise.
+func signingKey(pub *ecdsa.PublicKey, cond Condition) []byte {
+    canonical := EncodePublicKey(pub)
+    legacy := legacyPublicKey(pub)
+    if !bytes.Equal(legacy, canonical) {
+        h := sha256.Sum256(legacy)
+        if cond.hasKey(h[:]) {
+            return legacy
+        }
+    }
+    return canonical
+}
+
+// SigningDigests returns, for each input in order, the hash Sign signs
+// for it, so a key held outside the node can sign the transaction: the
+// signature of input i is the ECDSA signature of digest i as r||s, each
+// half zero-padded to 32 bytes. prevTXs is as for Sign.
+func (tx *Transaction) SigningDigests(prevTXs map[string]Transaction) ([][]byte, error) {
+    if tx.IsCoinbase() {
+        return nil, nil
+    }
+
+    txCopy := tx.TrimmedCopy()
+    digests := make([][]byte, len(tx.Vin))
+
+    for inIdx, vin := range tx.Vin {
+        prevTx, ok := prevTXs[fmt.Sprintf("%x", vin.Txid)]
+        if !ok || vin.Vout < 0 || vin.Vout >= len(prevTx.Vout) {
+            return nil, fmt.Errorf("previous transaction not found")
+        }
+        prevOut := prevTx.Vout[vin.Vout]
+        txCopy.Vin[inIdx].PubKey = prevOut.lock()
+        digests[inIdx] = txCopy.Hash()
+        txCopy.Vin[inIdx].PubKey = nil
+    }
+    return digests, nil
+}
+
+// Verify verifies each input against the spending condition of the
+// previous output it references. A copy of the transaction with
+// signatures blanked out is used to compute the hash. Outputs without
+// a script need a valid signature by the key they are locked to, in
+// the canonical or legacy encoding the input carries; scripted
+// single-sig and time-lock outputs also need the key to match the
+// condition (and the transaction's LockTime to have reached the unlock
+// time), multi-sig outputs need Threshold endorsements from distinct
+// listed keys, and burn outputs can never be spent. If any input
+// fails, the transaction is invalid.
 func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
     if tx.IsCoinbase() {
         return true
     }
 
     txCopy := tx.TrimmedCopy()
-    curve := elliptic.P256()
 
     for inIdx, vin := range tx.Vin {
         prevTx := prevTXs[fmt.Sprintf("%x", vin.Txid)]
-        // Inject referenced output's pubKeyHash
-        txCopy.Vin[inIdx].PubKey = prevTx.Vout[vin.Vout].PubKeyHash
+        if vin.Vout < 0 || vin.Vout >= len(prevTx.Vout) {
+            return false
+        }
+        prevOut := prevTx.Vout[vin.Vout]
+        cond, err := prevOut.Condition()
+        if err != nil {
+            return false
+        }
+        // Inject referenced output's lock
+        txCopy.Vin[inIdx].PubKey = prevOut.lock()
         // Hash for verification
         txCopy.ID = txCopy.Hash()
         // Restore blank pubKey
         txCopy.Vin[inIdx].PubKey = nil
 
-        // Split signature
-        r := big.Int{}
-        s := big.Int{}
-        sigLen := len(vin.Signature)
-        r.SetBytes(vin.Signature[:sigLen/2])
-        s.SetBytes(vin.Signature[sigLen/2:])
-
-        // Split public key
-        x := big.Int{}
-        y := big.Int{}
-        keyLen := len(vin.PubKey)
-        if keyLen == 0 {
-            return false
-        }
-        x.SetBytes(vin.PubKey[:keyLen/2])
-        y.SetBytes(vin.PubKey[keyLen/2:])
-        rawPubKey := ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}
-
-        if !ecdsa.Verify(&rawPubKey, txCopy.ID, &r, &s) {
+        switch cond.Kind {
+        case CondBurn:
             return false
+        case CondMultiSig:
+            signed := make(map[string]bool)
+            for _, e := range vin.Endorsements {
+                h := sha256.Sum256(e.PubKey)
+                if !cond.hasKey(h[:]) || signed[string(h[:])] {
+                    continue
+                }
+                if verifySignature(e.Signature, e.PubKey, txCopy.ID) {
+                    signed[string(h[:])] = true
+                }
+            }
+            if len(signed) < cond.Threshold {
+                return false
+            }
+        case CondTimeLock:
+            if tx.LockTime < cond.UnlockTime {
+                return false
+            }
+            fallthrough
+        default:
+            h := sha256.Sum256(vin.PubKey)
+            if len(prevOut.Script) > 0 {
+                if !cond.hasKey(h[:]) {
+                    return false
+                }
+            } else if !prevOut.IsLockedWith(h[:]) {
+                return false
+            }
+            if !verifySignature(vin.Signature, vin.PubKey, txCopy.ID) {
+                return false
+            }
         }
     }
     return true
 }
 
+// VerifyMessage checks an r||s signature of the SHA-256 of message by
+// an X||Y public key, the encoding transaction inputs use. Wallets sign
+// messages this way to prove they control an address off-chain.
+func VerifyMessage(pubKey, signature, message []byte) bool {
+    if len(signature) != 64 || len(pubKey) != 64 {
+        return false
+    }
+    hash := sha256.Sum256(message)
+    return verifySignature(signature, pubKey, hash[:])
+}
+
+// verifySignature checks an r||s signature of hash by an X||Y public key.
+func verifySignature(signature, pubKey, hash []byte) bool {
+    // Split signature
+    r := big.Int{}
+    s := big.Int{}
+    sigLen := len(signature)
+    r.SetBytes(signature[:sigLen/2])
+    s.SetBytes(signature[sigLen/2:])
+
+    rawPubKey, ok := decodePublicKey(pubKey)
+    if !ok {
+        return false
+    }
+    return ecdsa.Verify(rawPubKey, hash, &r, &s)
+}
+
 // Hash returns the SHA‑256 hash of the transaction without its ID. The
 // ID field is blanked before hashing to avoid self‑reference. The
 // serialization uses gob encoding. This function is used by Sign
@@ -239,4 +484,27 @@ func (tx Transaction) Serialize() []byte {
         panic(err)
     }
     return encoded.Bytes()
-}
\ No newline at end of file
+}
+// ComputeID recomputes the ID that SetID assigned when the transaction
+// was built. IDs are derived before signing, so signatures and public
+// keys of regular inputs are blanked first; coinbase inputs keep their
+// data.
+func (tx Transaction) ComputeID() []byte {
+    txCopy := tx.TrimmedCopy()
+    txCopy.ID = nil
+    if tx.IsCoinbase() {
+        txCopy.Vin = tx.Vin
+    }
+    txCopy.SetID()
+    return txCopy.ID
+}
+
+// DeserializeTransaction decodes a transaction produced by Serialize.
+func DeserializeTransaction(data []byte) (*Transaction, error) {
+    var tx Transaction
+    dec := gob.NewDecoder(bytes.NewReader(data))
+    if err := dec.Decode(&tx); err != nil {
+        return nil, fmt.Errorf("decode transaction: %w", err)
+    }
+    return &tx, nil
+}
@@ -29,6 +29,15 @@ func BigIntToPrivateKey(dBytes []byte, curve elliptic.Curve) ecdsa.PrivateKey {
     return ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y}, D: d}
 }
 
+// Payment is one output of a transaction built by NewSplitTransaction.
+// A burn payment takes Amount out of circulation with a burn output;
+// its To is ignored.
+type Payment struct {
+    To     string
+    Amount int
+    Burn   bool
+}
+
 // NewUTXOTransaction creates and signs a new transaction spending
 // existing unspent outputs and sending value to the recipient. It
 // accepts the private key, recipient address, amount, reference to
@@ -36,8 +45,47 @@ func BigIntToPrivateKey(dBytes []byte, curve elliptic.Curve) ecdsa.PrivateKey {
 // UTXO.FindSpendableOutputs and the public key hash of the sender. It
 // returns a signed transaction or an error if something goes wrong.
 func NewUTXOTransaction(privKey ecdsa.PrivateKey, to string, amount int, bc *Blockchain, spendable map[string][]int, fromPubKeyHash []byte, accumulated int) (*Transaction, error) {
-    if amount > accumulated {
-        return nil, errors.New("not enough funds")
+    return NewSplitTransaction(privKey, []Payment{{To: to, Amount: amount}}, bc, spendable, fromPubKeyHash, accumulated)
+}
+
+// NewFeeTransaction is NewUTXOTransaction leaving fee out of the
+// change: the inputs then hold fee more than the outputs, which the
+// miner of the block collects (see Blockchain.FeeAddress).
+func NewFeeTransaction(privKey ecdsa.PrivateKey, to string, amount, fee int, bc *Blockchain, spendable map[string][]int, fromPubKeyHash []byte, accumulated int) (*Transaction, error) {
+    return newTransaction(privKey, []Payment{{To: to, Amount: amount}}, fee, bc, spendable, fromPubKeyHash, accumulated)
+}
+
+// NewSplitTransaction is NewUTXOTransaction with one output per
+// payment, in order, followed by the change.
+func NewSplitTransaction(privKey ecdsa.PrivateKey, payments []Payment, bc *Blockchain, spendable map[string][]int, fromPubKeyHash []byte, accumulated int) (*Transaction, error) {
+    return newTransaction(privKey, payments, 0, bc, spendable, fromPubKeyHash, accumulated)
+}
+
+func newTransaction(privKey ecdsa.PrivateKey, payments []Payment, fee int, bc *Blockchain, spendable map[string][]int, fromPubKeyHash []byte, accumulated int) (*Transaction, error) {
+    tx, prevTXs, err := NewUnsignedTransaction(payments, fee, bc, spendable, fromPubKeyHash, accumulated)
+    if err != nil {
+        return nil, err
+    }
+    if err := tx.Sign(privKey, prevTXs); err != nil {
+        return nil, fmt.Errorf("signing failed: %v", err)
+    }
+    return tx, nil
+}
+
+// NewUnsignedTransaction builds the transaction NewFeeTransaction would
+// for payments without signing it, for a key held elsewhere to sign
+// (see Transaction.SigningDigests). It also returns the transactions
+// the inputs spend from, by hex txid.
+func NewUnsignedTransaction(payments []Payment, fee int, bc *Blockchain, spendable map[string][]int, fromPubKeyHash []byte, accumulated int) (*Transaction, map[string]Transaction, error) {
+    if fee < 0 {
+        return nil, nil, errors.New("negative fee")
+    }
+    total := fee
+    for _, p := range payments {
+        total += p.Amount
+    }
+    if total > accumulated {
+        return nil, nil, errors.New("not enough funds")
     }
     var inputs []TxInput
     var outputs []TxOutput
@@ -45,37 +93,43 @@ func NewUTXOTransaction(privKey ecdsa.PrivateKey, to string, amount int, bc *Blo
     for txidStr, outIdxs := range spendable {
         txIDBytes, err := hex.DecodeString(txidStr)
         if err != nil {
-            return nil, fmt.Errorf("invalid txid: %v", err)
+            return nil, nil, fmt.Errorf("invalid txid: %v", err)
         }
         for _, outIdx := range outIdxs {
             input := TxInput{Txid: txIDBytes, Vout: outIdx, Signature: nil, PubKey: nil}
             inputs = append(inputs, input)
         }
     }
-    // create output to recipient
-    toBytes, err := hex.DecodeString(to)
-    if err != nil {
-        return nil, fmt.Errorf("invalid recipient address: %v", err)
+    // create an output per recipient
+    for _, p := range payments {
+        if p.Burn {
+            out, err := NewConditionOutput(p.Amount, Burn())
+            if err != nil {
+                return nil, nil, err
+            }
+            outputs = append(outputs, out)
+            continue
+        }
+        toBytes, err := DecodeAddress(p.To)
+        if err != nil {
+            return nil, nil, fmt.Errorf("invalid recipient address: %v", err)
+        }
+        outputs = append(outputs, TxOutput{Value: p.Amount, PubKeyHash: toBytes})
     }
-    outputs = append(outputs, TxOutput{Value: amount, PubKeyHash: toBytes})
     // add change back to sender
-    if accumulated > amount {
-        outputs = append(outputs, TxOutput{Value: accumulated - amount, PubKeyHash: fromPubKeyHash})
+    if accumulated > total {
+        outputs = append(outputs, TxOutput{Value: accumulated - total, PubKeyHash: fromPubKeyHash})
     }
     tx := &Transaction{ID: nil, Vin: inputs, Vout: outputs}
     tx.SetID()
-    // sign transaction
     prevTXs := make(map[string]Transaction)
     for txidStr := range spendable {
         txIDBytes, _ := hex.DecodeString(txidStr)
         prevTx, err := bc.FindTransaction(txIDBytes)
         if err != nil {
-            return nil, fmt.Errorf("referenced transaction not found: %v", err)
+            return nil, nil, fmt.Errorf("referenced transaction not found: %v", err)
         }
         prevTXs[txidStr] = prevTx
     }
-    if err := tx.Sign(privKey, prevTXs); err != nil {
-        return nil, fmt.Errorf("signing failed: %v", err)
-    }
-    return tx, nil
+    return tx, prevTXs, nil
 }
\ No newline at end of file
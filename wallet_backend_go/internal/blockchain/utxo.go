@@ -9,7 +9,10 @@ package blockchain
 
 import (
     "bytes"
+    "encoding/hex"
     "fmt"
+    "sort"
+    "time"
 )
 
 // UTXOSet wraps a blockchain and maintains a cache of unspent
@@ -19,6 +22,9 @@ import (
 // blockchain in a database or external store.
 type UTXOSet struct {
     BC *Blockchain
+
+    // OnReindex, when set, is called with how long every Reindex took.
+    OnReindex func(elapsed time.Duration)
 }
 
 // Reindex rebuilds the entire UTXO set by scanning all blocks. It
@@ -31,6 +37,10 @@ func (u *UTXOSet) Reindex() map[string][]TxOutput {
     if u.BC == nil {
         return UTXO
     }
+    if u.OnReindex != nil {
+        start := time.Now()
+        defer func() { u.OnReindex(time.Since(start)) }()
+    }
     unspent := u.BC.FindUTXO(nil)
     for txID, outs := range unspent {
         UTXO[txID] = outs
@@ -41,23 +51,36 @@ func (u *UTXOSet) Reindex() map[string][]TxOutput {
 // FindSpendableOutputs locates enough outputs to cover the given amount.
 // It returns the accumulated value and a map of transaction IDs to
 // output indexes. pubKeyHash identifies the outputs belonging to the
-// requester. This method iterates over the set and stops once the
-// accumulated value meets or exceeds the amount.
+// requester; outputs with a non-standard spending condition (e.g.
+// time-locked) are skipped since a plain signature cannot spend them.
+// This method iterates over the set and stops once the accumulated
+// value meets or exceeds the amount.
 func (u *UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
+    return u.FindSpendableOutputsExcluding(pubKeyHash, amount, nil)
+}
+
+// FindSpendableOutputsExcluding is FindSpendableOutputs skipping the
+// outputs in exclude, keyed "txid:vout" with the txid in hex. Callers
+// use it to leave alone outputs already claimed by transactions that
+// are signed but not yet mined.
+func (u *UTXOSet) FindSpendableOutputsExcluding(pubKeyHash []byte, amount int, exclude map[string]bool) (int, map[string][]int) {
     accumulated := 0
     unspentOuts := make(map[string][]int)
 
-    // scan the entire blockchain for UTXOs owned by pubKeyHash
-    UTXO := u.BC.FindUTXO(pubKeyHash)
-    for txID, outs := range UTXO {
-        for outIdx, out := range outs {
-            if bytes.Equal(out.PubKeyHash, pubKeyHash) && accumulated < amount {
-                accumulated += out.Value
-                unspentOuts[txID] = append(unspentOuts[txID], outIdx)
-                if accumulated >= amount {
-                    return accumulated, unspentOuts
-                }
-            }
+    // UnspentOutputs keeps the real output indexes, which the inputs
+    // built from this map must reference.
+    for _, uo := range u.UnspentOutputs() {
+        if !uo.Output.IsLockedWith(pubKeyHash) || !uo.Output.IsStandard() {
+            continue
+        }
+        txID := hex.EncodeToString(uo.TxID)
+        if exclude[fmt.Sprintf("%s:%d", txID, uo.Vout)] {
+            continue
+        }
+        accumulated += uo.Output.Value
+        unspentOuts[txID] = append(unspentOuts[txID], uo.Vout)
+        if accumulated >= amount {
+            break
         }
     }
     return accumulated, unspentOuts
@@ -107,4 +130,47 @@ func (u *UTXOSet) Update(block *Block, utxo map[string][]TxOutput) {
         copy(newOutputs, tx.Vout)
         utxo[fmt.Sprintf("%x", tx.ID)] = newOutputs
     }
-}
\ No newline at end of file
+}
+// UnspentOutput identifies an unspent output by its transaction and
+// index.
+type UnspentOutput struct {
+    TxID   []byte
+    Vout   int
+    Output TxOutput
+}
+
+// UnspentOutputs lists every unspent output in the chain ordered by
+// transaction ID and output index. Unlike FindUTXO it keeps the output
+// indexes, which a snapshot needs to identify each output.
+func (u *UTXOSet) UnspentOutputs() []UnspentOutput {
+    spent := make(map[string]bool)
+    for _, block := range u.BC.Blocks {
+        for _, tx := range block.Transactions {
+            if tx.IsCoinbase() {
+                continue
+            }
+            for _, in := range tx.Vin {
+                spent[fmt.Sprintf("%x:%d", in.Txid, in.Vout)] = true
+            }
+        }
+    }
+
+    var outs []UnspentOutput
+    for _, block := range u.BC.Blocks {
+        for _, tx := range block.Transactions {
+            for i, out := range tx.Vout {
+                if !spent[fmt.Sprintf("%x:%d", tx.ID, i)] {
+                    outs = append(outs, UnspentOutput{TxID: tx.ID, Vout: i, Output: out})
+                }
+            }
+        }
+    }
+
+    sort.Slice(outs, func(a, b int) bool {
+        if c := bytes.Compare(outs[a].TxID, outs[b].TxID); c != 0 {
+            return c < 0
+        }
+        return outs[a].Vout < outs[b].Vout
+    })
+    return outs
+}
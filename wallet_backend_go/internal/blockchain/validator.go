@@ -0,0 +1,180 @@
+package blockchain
+
+// validator.go lets deployments plug policy checks (limits, blacklists,
+// tenant rules) into transaction admission. Validators are registered
+// on the blockchain and run in registration order on every transaction
+// submitted by a user before it is mined; the first one to veto wins.
+// Signature and spending-condition checks stay in Verify: validators
+// only decide whether an otherwise valid transaction is allowed.
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "errors"
+    "sync"
+)
+
+// Validator is a single policy check. Validate returns a *Rejection to
+// veto the transaction, any other error when the check itself could not
+// be carried out, and nil to let the transaction through.
+type Validator interface {
+    Name() string
+    Validate(ctx context.Context, tx *Transaction) error
+}
+
+type validatorFunc struct {
+    name string
+    fn   func(ctx context.Context, tx *Transaction) error
+}
+
+func (v validatorFunc) Name() string { return v.name }
+
+func (v validatorFunc) Validate(ctx context.Context, tx *Transaction) error {
+    return v.fn(ctx, tx)
+}
+
+// NewValidator wraps fn as a Validator called name.
+func NewValidator(name string, fn func(ctx context.Context, tx *Transaction) error) Validator {
+    return validatorFunc{name: name, fn: fn}
+}
+
+// Rejection is the veto of a validator. Reason is meant for the client.
+type Rejection struct {
+    Validator string
+    Reason    string
+}
+
+func (r *Rejection) Error() string {
+    return r.Validator + ": " + r.Reason
+}
+
+// Reject returns the veto of a validator for reason.
+func Reject(validator, reason string) *Rejection {
+    return &Rejection{Validator: validator, Reason: reason}
+}
+
+// AsRejection reports whether err is a validator veto and returns it.
+func AsRejection(err error) (*Rejection, bool) {
+    var rej *Rejection
+    ok := errors.As(err, &rej)
+    return rej, ok
+}
+
+// ValidatorChain is an ordered, concurrency-safe list of validators.
+type ValidatorChain struct {
+    mu         sync.RWMutex
+    validators []Validator
+}
+
+// Register appends v to the chain, replacing a validator of the same name.
+func (c *ValidatorChain) Register(v Validator) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    for i, existing := range c.validators {
+        if existing.Name() == v.Name() {
+            c.validators[i] = v
+            return
+        }
+    }
+    c.validators = append(c.validators, v)
+}
+
+// Names lists the registered validators in the order they run.
+func (c *ValidatorChain) Names() []string {
+    c.mu.RLock()
+    defer c.mu.RUnlock()
+
+    names := make([]string, 0, len(c.validators))
+    for _, v := range c.validators {
+        names = append(names, v.Name())
+    }
+    return names
+}
+
+// Check runs every validator on tx and returns the first veto or
+// failure. Coinbase transactions are minted by the node itself and are
+// never checked.
+func (c *ValidatorChain) Check(ctx context.Context, tx *Transaction) error {
+    if tx.IsCoinbase() {
+        return nil
+    }
+
+    c.mu.RLock()
+    validators := append([]Validator(nil), c.validators...)
+    c.mu.RUnlock()
+
+    for _, v := range validators {
+        if err := v.Validate(ctx, tx); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// RegisterValidator adds v to the validators run by CheckPolicy.
+func (bc *Blockchain) RegisterValidator(v Validator) {
+    if bc.Validators == nil {
+        bc.Validators = &ValidatorChain{}
+    }
+    bc.Validators.Register(v)
+}
+
+// CheckPolicy runs the registered validators on tx. Callers admitting a
+// user transaction call it after VerifyTransaction and before mining.
+func (bc *Blockchain) CheckPolicy(ctx context.Context, tx *Transaction) error {
+    if bc.Validators == nil {
+        return nil
+    }
+    return bc.Validators.Check(ctx, tx)
+}
+
+// Senders returns the public key hashes of the keys that signed tx's
+// inputs, including multi-sig co-signers, without duplicates.
+func (tx *Transaction) Senders() [][]byte {
+    var senders [][]byte
+    add := func(pubKey []byte) {
+        if len(pubKey) == 0 {
+            return
+        }
+        h := sha256.Sum256(pubKey)
+        for _, s := range senders {
+            if bytes.Equal(s, h[:]) {
+                return
+            }
+        }
+        senders = append(senders, h[:])
+    }
+
+    if tx.IsCoinbase() {
+        return nil
+    }
+    for _, in := range tx.Vin {
+        add(in.PubKey)
+        for _, e := range in.Endorsements {
+            add(e.PubKey)
+        }
+    }
+    return senders
+}
+
+// ExternalOutputs returns the outputs that do not pay change back to
+// one of the senders.
+func (tx *Transaction) ExternalOutputs() []TxOutput {
+    senders := tx.Senders()
+    var outs []TxOutput
+    for _, out := range tx.Vout {
+        change := false
+        for _, s := range senders {
+            if out.IsLockedWith(s) {
+                change = true
+                break
+            }
+        }
+        if !change {
+            outs = append(outs, out)
+        }
+    }
+    return outs
+}
@@ -12,6 +12,7 @@ import (
     "crypto/rand"
     "crypto/sha256"
     "fmt"
+    "io"
     "math/big"
     "encoding/hex"
 )
@@ -26,27 +27,129 @@ type Wallet struct {
 // the P‑256 curve. Any error during key generation will panic,
 // although random failures are extremely unlikely.
 func NewWallet() *Wallet {
-    privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    w, err := NewWalletFrom(rand.Reader)
     if err != nil {
         panic(err)
     }
-    pubKey := append(privKey.PublicKey.X.Bytes(), privKey.PublicKey.Y.Bytes()...)
-    return &Wallet{PrivateKey: *privKey, PublicKey: pubKey}
+    return w
 }
 
-// GetAddress derives a simple address by hashing the public key with
-// SHA‑256 and returning the result as a hexadecimal string. Real
-// blockchain addresses typically use base58check or bech32 encoding
-// with version prefixes and checksums.
+// NewWalletFrom generates a P‑256 key pair from the given entropy
+// source. The same bytes always yield the same key, so a deterministic
+// reader makes key generation reproducible in tests; production code
+// passes crypto/rand.Reader. The key is drawn as in FIPS 186‑4 B.4.1:
+// 64 extra bits keep the reduction modulo the curve order unbiased.
+func NewWalletFrom(entropy io.Reader) (*Wallet, error) {
+    curve := elliptic.P256()
+    params := curve.Params()
+
+    b := make([]byte, params.BitSize/8+8)
+    if _, err := io.ReadFull(entropy, b); err != nil {
+        return nil, fmt.Errorf("read key entropy: %w", err)
+    }
+    one := big.NewInt(1)
+    n := new(big.Int).Sub(params.N, one)
+    d := new(big.Int).SetBytes(b)
+    d.Mod(d, n)
+    d.Add(d, one)
+
+    priv := ecdsa.PrivateKey{D: d}
+    priv.PublicKey.Curve = curve
+    priv.PublicKey.X, priv.PublicKey.Y = curve.ScalarBaseMult(d.Bytes())
+
+    return &Wallet{PrivateKey: priv, PublicKey: EncodePublicKey(&priv.PublicKey)}, nil
+}
+
+// WalletFromSeed derives a wallet deterministically from seed: the
+// private key is the SHA‑256 of the seed. The same seed always yields
+// the same keys and address, which fixtures and tests rely on. Seeds
+// must be kept secret like the keys they produce.
+func WalletFromSeed(seed []byte) *Wallet {
+    d := sha256.Sum256(seed)
+    priv, _ := PrivateKeyFromHex(hex.EncodeToString(d[:])) // cannot fail on valid hex
+    return &Wallet{PrivateKey: *priv, PublicKey: EncodePublicKey(&priv.PublicKey)}
+}
+
+// GetAddress returns the wallet's address: the SHA‑256 of the public
+// key, Base58Check encoded (see EncodeAddress).
 func (w *Wallet) GetAddress() string {
-    pubHash := sha256.Sum256(w.PublicKey)
-    return fmt.Sprintf("%x", pubHash[:])
+    return PubKeyAddress(w.PublicKey)
+}
+
+// PubKeyAddress returns the address of an encoded public key, as
+// carried by transaction inputs.
+func PubKeyAddress(pubKey []byte) string {
+    h := sha256.Sum256(pubKey)
+    return EncodeAddress(h[:])
+}
+
+// EncodePublicKey returns the canonical encoding of a public key: X||Y
+// with each coordinate zero-padded to 32 bytes. Addresses are the
+// SHA‑256 of this encoding and transaction inputs carry it.
+func EncodePublicKey(pub *ecdsa.PublicKey) []byte {
+    buf := make([]byte, 64)
+    pub.X.FillBytes(buf[:32])
+    pub.Y.FillBytes(buf[32:])
+    return buf
+}
+
+// legacyPublicKey is the encoding wallets used before keys were padded:
+// X||Y without leading zero bytes. It differs from the canonical one
+// for about one key in 128, whose wallets keep their old address.
+func legacyPublicKey(pub *ecdsa.PublicKey) []byte {
+    return append(pub.X.Bytes(), pub.Y.Bytes()...)
+}
+
+// AddressOf returns the address of a public key.
+func AddressOf(pub *ecdsa.PublicKey) string {
+    return PubKeyAddress(EncodePublicKey(pub))
+}
+
+// AddressesOf returns the address of pub followed, for keys whose
+// legacy encoding differs, by the legacy address.
+func AddressesOf(pub *ecdsa.PublicKey) []string {
+    addrs := []string{AddressOf(pub)}
+    if legacy := legacyPublicKey(pub); len(legacy) != 64 {
+        addrs = append(addrs, PubKeyAddress(legacy))
+    }
+    return addrs
+}
+
+// KeyControlsAddress reports whether address belongs to pub, under the
+// canonical public key encoding or the legacy one. address may be in
+// either address encoding.
+func KeyControlsAddress(pub *ecdsa.PublicKey, address string) bool {
+    for _, a := range AddressesOf(pub) {
+        if SameAddress(a, address) {
+            return true
+        }
+    }
+    return false
+}
+
+// decodePublicKey splits an X||Y public key. Canonical keys split in
+// the middle; a shorter legacy key is split where both halves form a
+// point on the curve, as either coordinate may have lost zero bytes.
+func decodePublicKey(b []byte) (*ecdsa.PublicKey, bool) {
+    curve := elliptic.P256()
+    if len(b) < 2 || len(b) > 64 {
+        return nil, false
+    }
+    for xLen := max(len(b)-32, 1); xLen <= min(32, len(b)-1); xLen++ {
+        x := new(big.Int).SetBytes(b[:xLen])
+        y := new(big.Int).SetBytes(b[xLen:])
+        if curve.IsOnCurve(x, y) {
+            return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, true
+        }
+    }
+    return nil, false
 }
 
-// ValidateAddress performs a basic length check on the address. In
-// practice you'd also verify the checksum and prefix.
+// ValidateAddress reports whether address decodes to a public key hash
+// (see DecodeAddress).
 func ValidateAddress(address string) bool {
-    return len(address) > 0
+    _, err := DecodeAddress(address)
+    return err == nil
 }
 
 
@@ -0,0 +1,173 @@
+// Package bridge watches addresses on Bitcoin and Ethereum for
+// donations made there. Each address in BRIDGE_ADDRESSES is tied to a
+// campaign; a Watcher lists the deposits to an address through a public
+// API, Esplora for Bitcoin and an Etherscan-compatible API for
+// Ethereum. Crediting the deposits on the internal chain, once they
+// have enough confirmations, is up to the caller.
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Chains.
+const (
+	ChainBTC = "btc"
+	ChainETH = "eth"
+)
+
+// Currencies are the codes of the chains' coins in the price rates.
+var Currencies = map[string]string{ChainBTC: "BTC", ChainETH: "ETH"}
+
+// Decimals are the decimal places of the chains' coins: amounts are in
+// satoshi and wei.
+var Decimals = map[string]int{ChainBTC: 8, ChainETH: 18}
+
+const (
+	defaultBTCAPI = "https://blockstream.info/api"
+	defaultETHAPI = "https://eth.blockscout.com/api"
+
+	requestTimeout = 30 * time.Second
+	maxResponse    = 4 << 20
+)
+
+var (
+	btcAddress = regexp.MustCompile(`^(bc1|tb1|[13mn2])[a-zA-HJ-NP-Z0-9]{25,87}$`)
+	ethAddress = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+)
+
+// Watch is an external address whose deposits go to a campaign.
+type Watch struct {
+	Chain      string `json:"chain"`
+	Address    string `json:"address"`
+	CampaignID string `json:"campaign_id"`
+}
+
+// Deposit is a payment to a watched address.
+type Deposit struct {
+	Chain         string
+	TxID          string
+	Index         int // output index on Bitcoin; 0 on Ethereum
+	Address       string
+	Amount        *big.Int // satoshi or wei
+	Confirmations int      // 0 while unconfirmed
+}
+
+// Ref identifies the deposit, e.g. "btc:<txid>:1".
+func (d Deposit) Ref() string {
+	return fmt.Sprintf("%s:%s:%d", d.Chain, d.TxID, d.Index)
+}
+
+// Watcher lists the deposits to addresses on one chain.
+type Watcher interface {
+	Chain() string
+	// Deposits returns the recent deposits to address, confirmed or
+	// not, newest first.
+	Deposits(ctx context.Context, address string) ([]Deposit, error)
+}
+
+// Config is what the bridge watches and how.
+type Config struct {
+	Watches  []Watch
+	Watchers map[string]Watcher // by chain
+}
+
+// WatchesOf returns the watched addresses of a campaign.
+func (c *Config) WatchesOf(campaignID string) []Watch {
+	var out []Watch
+	for _, w := range c.Watches {
+		if w.CampaignID == campaignID {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// FromEnv returns the bridge configuration, or nil when BRIDGE_ADDRESSES
+// is not set. BRIDGE_ADDRESSES lists chain:address=campaign_id entries,
+// comma-separated, e.g. "btc:bc1q...=<uuid>,eth:0x...=<uuid>".
+// BRIDGE_BTC_API is the base URL of an Esplora API (default
+// blockstream.info), BRIDGE_ETH_API of an Etherscan-compatible API
+// (default Blockscout), sent BRIDGE_ETH_API_KEY when set.
+func FromEnv() (*Config, error) {
+	v := strings.TrimSpace(os.Getenv("BRIDGE_ADDRESSES"))
+	if v == "" {
+		return nil, nil
+	}
+	cfg := &Config{Watchers: make(map[string]Watcher)}
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		w, err := parseWatch(entry)
+		if err != nil {
+			return nil, err
+		}
+		if seen[w.Chain+":"+w.Address] {
+			return nil, fmt.Errorf("BRIDGE_ADDRESSES: %s:%s is listed twice", w.Chain, w.Address)
+		}
+		seen[w.Chain+":"+w.Address] = true
+		cfg.Watches = append(cfg.Watches, w)
+	}
+
+	hc := &http.Client{Timeout: requestTimeout}
+	for _, w := range cfg.Watches {
+		if cfg.Watchers[w.Chain] != nil {
+			continue
+		}
+		switch w.Chain {
+		case ChainBTC:
+			cfg.Watchers[w.Chain] = &Esplora{URL: envURL("BRIDGE_BTC_API", defaultBTCAPI), HTTP: hc}
+		case ChainETH:
+			cfg.Watchers[w.Chain] = &Etherscan{URL: envURL("BRIDGE_ETH_API", defaultETHAPI), APIKey: os.Getenv("BRIDGE_ETH_API_KEY"), HTTP: hc}
+		}
+	}
+	return cfg, nil
+}
+
+// parseWatch parses one chain:address=campaign_id entry.
+func parseWatch(entry string) (Watch, error) {
+	target, campaign, ok := strings.Cut(entry, "=")
+	chain, address, ok2 := strings.Cut(target, ":")
+	campaign = strings.TrimSpace(campaign)
+	if !ok || !ok2 || campaign == "" {
+		return Watch{}, fmt.Errorf("BRIDGE_ADDRESSES: %q: want chain:address=campaign_id", entry)
+	}
+	w := Watch{Chain: strings.ToLower(strings.TrimSpace(chain)), Address: strings.TrimSpace(address), CampaignID: campaign}
+	switch w.Chain {
+	case ChainBTC:
+		if !btcAddress.MatchString(w.Address) {
+			return Watch{}, fmt.Errorf("BRIDGE_ADDRESSES: %q is not a Bitcoin address", w.Address)
+		}
+	case ChainETH:
+		if !ethAddress.MatchString(w.Address) {
+			return Watch{}, fmt.Errorf("BRIDGE_ADDRESSES: %q is not an Ethereum address", w.Address)
+		}
+		w.Address = strings.ToLower(w.Address)
+	default:
+		return Watch{}, fmt.Errorf("BRIDGE_ADDRESSES: unknown chain %q (want btc or eth)", w.Chain)
+	}
+	return w, nil
+}
+
+func envURL(name, def string) string {
+	if v := strings.TrimRight(strings.TrimSpace(os.Getenv(name)), "/"); v != "" {
+		return v
+	}
+	return def
+}
+
+// Coins returns amount, in satoshi or wei, in whole coins of chain.
+func Coins(chain string, amount *big.Int) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(Decimals[chain])), nil)
+	return new(big.Rat).SetFrac(amount, scale)
+}
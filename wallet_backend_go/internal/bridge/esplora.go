@@ -0,0 +1,102 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Esplora watches Bitcoin addresses through an Esplora API
+// (blockstream.info, mempool.space or a self-hosted instance).
+type Esplora struct {
+	URL  string
+	HTTP *http.Client
+}
+
+func (e *Esplora) Chain() string { return ChainBTC }
+
+type esploraTx struct {
+	TxID   string `json:"txid"`
+	Status struct {
+		Confirmed   bool `json:"confirmed"`
+		BlockHeight int  `json:"block_height"`
+	} `json:"status"`
+	Vout []struct {
+		Address string `json:"scriptpubkey_address"`
+		Value   int64  `json:"value"`
+	} `json:"vout"`
+}
+
+// Deposits returns an output per payment to address in the address's
+// unconfirmed and latest 25 confirmed transactions.
+func (e *Esplora) Deposits(ctx context.Context, address string) ([]Deposit, error) {
+	tip, err := e.tipHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var txs []esploraTx
+	if err := e.get(ctx, "/address/"+address+"/txs", func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&txs)
+	}); err != nil {
+		return nil, err
+	}
+
+	var out []Deposit
+	for _, tx := range txs {
+		confirmations := 0
+		if tx.Status.Confirmed && tx.Status.BlockHeight > 0 && tip >= tx.Status.BlockHeight {
+			confirmations = tip - tx.Status.BlockHeight + 1
+		}
+		for i, o := range tx.Vout {
+			if o.Address != address || o.Value <= 0 {
+				continue
+			}
+			out = append(out, Deposit{
+				Chain:         ChainBTC,
+				TxID:          tx.TxID,
+				Index:         i,
+				Address:       address,
+				Amount:        big.NewInt(o.Value),
+				Confirmations: confirmations,
+			})
+		}
+	}
+	return out, nil
+}
+
+func (e *Esplora) tipHeight(ctx context.Context) (int, error) {
+	var height int
+	err := e.get(ctx, "/blocks/tip/height", func(body io.Reader) error {
+		b, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		height, err = strconv.Atoi(strings.TrimSpace(string(b)))
+		return err
+	})
+	return height, err
+}
+
+func (e *Esplora) get(ctx context.Context, path string, decode func(io.Reader) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.URL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := e.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s%s: %s", e.URL, path, resp.Status)
+	}
+	if err := decode(io.LimitReader(resp.Body, maxResponse)); err != nil {
+		return fmt.Errorf("%s%s: %w", e.URL, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Etherscan watches Ethereum addresses through an Etherscan-compatible
+// API (Etherscan or Blockscout). Only plain ether transfers are seen;
+// token transfers and internal transactions are not.
+type Etherscan struct {
+	URL    string
+	APIKey string
+	HTTP   *http.Client
+}
+
+func (e *Etherscan) Chain() string { return ChainETH }
+
+type etherscanResponse struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Result  json.RawMessage `json:"result"`
+}
+
+type etherscanTx struct {
+	Hash          string `json:"hash"`
+	To            string `json:"to"`
+	Value         string `json:"value"`
+	IsError       string `json:"isError"`
+	Confirmations string `json:"confirmations"`
+}
+
+// Deposits returns the latest 100 successful transfers of ether to
+// address.
+func (e *Etherscan) Deposits(ctx context.Context, address string) ([]Deposit, error) {
+	q := url.Values{
+		"module":  {"account"},
+		"action":  {"txlist"},
+		"address": {address},
+		"sort":    {"desc"},
+		"page":    {"1"},
+		"offset":  {"100"},
+	}
+	if e.APIKey != "" {
+		q.Set("apikey", e.APIKey)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.URL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s txlist: %s", e.URL, resp.Status)
+	}
+	var body etherscanResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponse)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%s txlist: %w", e.URL, err)
+	}
+	var txs []etherscanTx
+	if err := json.Unmarshal(body.Result, &txs); err != nil {
+		// an address without transactions comes back as status 0 with
+		// a message; anything else carries the error as the result
+		if body.Message == "No transactions found" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s txlist: %s: %s", e.URL, body.Message, strings.Trim(string(body.Result), `"`))
+	}
+
+	var out []Deposit
+	for _, tx := range txs {
+		if !strings.EqualFold(tx.To, address) || tx.IsError != "0" {
+			continue
+		}
+		value, ok := new(big.Int).SetString(tx.Value, 10)
+		if !ok || value.Sign() <= 0 {
+			continue
+		}
+		confirmations, _ := strconv.Atoi(tx.Confirmations)
+		out = append(out, Deposit{
+			Chain:         ChainETH,
+			TxID:          strings.ToLower(tx.Hash),
+			Address:       address,
+			Amount:        value,
+			Confirmations: confirmations,
+		})
+	}
+	return out, nil
+}
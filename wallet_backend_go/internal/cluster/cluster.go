@@ -0,0 +1,143 @@
+// Package cluster groups addresses likely controlled by the same owner
+// using the common-input-ownership heuristic: all inputs of a
+// transaction are signed by its sender, so the addresses they spend from
+// belong together. Clusters are the connected components of that
+// relation, found with a union-find over one pass of the chain. The
+// heuristic over-links transactions built jointly by several parties,
+// so clusters are leads for compliance staff, not proof of ownership.
+package cluster
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+// Cluster is a set of linked addresses. ID is its lexically smallest
+// member, so it is stable as long as the cluster does not merge.
+type Cluster struct {
+	ID      string   `json:"id"`
+	Size    int      `json:"size"`
+	Balance int      `json:"balance"`  // unspent value held by the members
+	TxCount int      `json:"tx_count"` // transactions spending from the cluster
+	Members []string `json:"members"`
+}
+
+// Result is the clustering of a chain at Height.
+type Result struct {
+	Height   int
+	Clusters []Cluster      // linked clusters (two or more members), largest first
+	byAddr   map[string]int // address -> index in Clusters
+	balances map[string]int // address -> unspent value, all addresses
+	spends   map[string]int // union-find root -> transactions it sent
+}
+
+// Lookup returns the cluster of address. An address that was never
+// linked to another forms a cluster of its own.
+func (r *Result) Lookup(address string) Cluster {
+	if i, ok := r.byAddr[address]; ok {
+		return r.Clusters[i]
+	}
+	return Cluster{ID: address, Size: 1, Balance: r.balances[address], TxCount: r.spends[address], Members: []string{address}}
+}
+
+type output struct {
+	addr  string
+	value int
+}
+
+type unionFind map[string]string
+
+func (u unionFind) find(a string) string {
+	for u[a] != a {
+		u[a] = u[u[a]] // path halving
+		a = u[a]
+	}
+	return a
+}
+
+func (u unionFind) add(a string) {
+	if _, ok := u[a]; !ok {
+		u[a] = a
+	}
+}
+
+func (u unionFind) union(a, b string) {
+	ra, rb := u.find(a), u.find(b)
+	if ra != rb {
+		u[rb] = ra
+	}
+}
+
+// Build clusters the addresses of blocks.
+func Build(blocks []*blockchain.Block) *Result {
+	uf := make(unionFind)
+	outputs := make(map[string]output) // unspent, "txid:vout"
+	var senders []string               // first input address of each transaction
+
+	for _, b := range blocks {
+		for _, tx := range b.Transactions {
+			txid := hex.EncodeToString(tx.ID)
+			if !tx.IsCoinbase() && len(tx.Vin) > 0 {
+				first := blockchain.PubKeyAddress(tx.Vin[0].PubKey)
+				uf.add(first)
+				for _, in := range tx.Vin {
+					addr := blockchain.PubKeyAddress(in.PubKey)
+					uf.add(addr)
+					uf.union(first, addr)
+					delete(outputs, fmt.Sprintf("%x:%d", in.Txid, in.Vout))
+				}
+				senders = append(senders, first)
+			}
+			for i, out := range tx.Vout {
+				outputs[fmt.Sprintf("%s:%d", txid, i)] = output{blockchain.EncodeAddress(out.Owner()), out.Value}
+			}
+		}
+	}
+
+	balances := make(map[string]int)
+	for _, o := range outputs {
+		balances[o.addr] += o.value
+	}
+	spends := make(map[string]int)
+	for _, sender := range senders {
+		spends[uf.find(sender)]++
+	}
+
+	members := make(map[string][]string) // root -> addresses
+	for addr := range uf {
+		root := uf.find(addr)
+		members[root] = append(members[root], addr)
+	}
+
+	res := &Result{Height: len(blocks), byAddr: make(map[string]int), balances: balances, spends: spends}
+	for root, addrs := range members {
+		if len(addrs) < 2 {
+			continue
+		}
+		sort.Strings(addrs)
+		c := Cluster{ID: addrs[0], Size: len(addrs), TxCount: spends[root], Members: addrs}
+		for _, a := range addrs {
+			c.Balance += balances[a]
+		}
+		res.Clusters = append(res.Clusters, c)
+	}
+	sort.Slice(res.Clusters, func(i, j int) bool {
+		a, b := res.Clusters[i], res.Clusters[j]
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		if a.Balance != b.Balance {
+			return a.Balance > b.Balance
+		}
+		return a.ID < b.ID
+	})
+	for i, c := range res.Clusters {
+		for _, a := range c.Members {
+			res.byAddr[a] = i
+		}
+	}
+	return res
+}
@@ -0,0 +1,167 @@
+// Package crypto encrypts the wallet private keys the server keeps for
+// its users (WalletProfile.EncryptedPrivateKey), so that a copy of the
+// database, a backup or a log of its rows does not give away the keys.
+//
+// Keys come from WALLET_MASTER_KEYS, or from the file named by
+// WALLET_MASTER_KEYS_FILE (as mounted by a KMS or secret manager): a
+// comma-separated list of <key id>:<base64 32-byte key>. The first key
+// encrypts; the others only decrypt, which allows rotation. A sealed
+// key is stored as wk:v1:<key id>:<base64 nonce+ciphertext>, sealed
+// with AES-256-GCM and the wallet's public key hash as additional data,
+// so a sealed key copied to another wallet's row does not open.
+//
+// Keys stored before encryption was enabled are the base64 of the hex
+// key; they are still read, and cmd/wallet-key-migrate seals them.
+// Without master keys new keys are stored that way too. This is on top
+// of the database's PII encryption (see internal/db/pii.go), which
+// uses keys of its own.
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+const sealedPrefix = "wk:v1:"
+
+// ErrNoMasterKey is returned when opening a sealed key without master
+// keys.
+var ErrNoMasterKey = errors.New("wallet key is sealed but WALLET_MASTER_KEYS is not set")
+
+// Keyring holds the master keys. A nil Keyring stores keys unsealed.
+type Keyring struct {
+	active string
+	order  []string // key ids, active first
+	aeads  map[string]cipher.AEAD
+}
+
+// LoadKeyring reads the master keys from the environment. It returns
+// nil when none are configured.
+func LoadKeyring() (*Keyring, error) {
+	spec := os.Getenv("WALLET_MASTER_KEYS")
+	if path := os.Getenv("WALLET_MASTER_KEYS_FILE"); path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read WALLET_MASTER_KEYS_FILE: %w", err)
+		}
+		spec = strings.TrimSpace(string(raw))
+	}
+	if spec == "" {
+		return nil, nil
+	}
+	return ParseKeyring(spec)
+}
+
+// ParseKeyring parses a list of <key id>:<base64 32-byte key>.
+func ParseKeyring(spec string) (*Keyring, error) {
+	k := &Keyring{aeads: make(map[string]cipher.AEAD)}
+	for _, part := range strings.Split(spec, ",") {
+		kid, encoded, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || kid == "" {
+			return nil, fmt.Errorf("master key %q: want <key id>:<base64 key>", part)
+		}
+		if _, dup := k.aeads[kid]; dup {
+			return nil, fmt.Errorf("master key id %q is listed twice", kid)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("master key %q: want 32 bytes of base64", kid)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[kid] = aead
+		k.order = append(k.order, kid)
+	}
+	k.active = k.order[0]
+	return k, nil
+}
+
+// ActiveKeyID returns the id of the key that seals, or "" for a nil
+// Keyring.
+func (k *Keyring) ActiveKeyID() string {
+	if k == nil {
+		return ""
+	}
+	return k.active
+}
+
+// Seal returns the stored form of the hex private key of the wallet at
+// address: sealed with the active key, or unsealed without a Keyring.
+func (k *Keyring) Seal(address, privHex string) (string, error) {
+	if k == nil {
+		return base64.StdEncoding.EncodeToString([]byte(privHex)), nil
+	}
+	pubKeyHash, err := blockchain.DecodeAddress(address)
+	if err != nil {
+		return "", fmt.Errorf("seal wallet key: %w", err)
+	}
+	aead := k.aeads[k.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(privHex), pubKeyHash)
+	return sealedPrefix + k.active + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open returns the hex private key of the wallet at address from its
+// stored form, sealed or not.
+func (k *Keyring) Open(address, stored string) (string, error) {
+	rest, ok := strings.CutPrefix(stored, sealedPrefix)
+	if !ok {
+		plain, err := base64.StdEncoding.DecodeString(stored)
+		if err != nil {
+			return "", fmt.Errorf("wallet key is not base64: %w", err)
+		}
+		return string(plain), nil
+	}
+	if k == nil {
+		return "", ErrNoMasterKey
+	}
+	kid, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", fmt.Errorf("malformed sealed wallet key")
+	}
+	aead, ok := k.aeads[kid]
+	if !ok {
+		return "", fmt.Errorf("wallet key sealed with unknown master key %q", kid)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed sealed wallet key")
+	}
+	pubKeyHash, err := blockchain.DecodeAddress(address)
+	if err != nil {
+		return "", fmt.Errorf("open wallet key: %w", err)
+	}
+	n := aead.NonceSize()
+	plain, err := aead.Open(nil, sealed[:n], sealed[n:], pubKeyHash)
+	if err != nil {
+		return "", fmt.Errorf("wallet key does not open: %w", err)
+	}
+	return string(plain), nil
+}
+
+// Current reports whether stored is sealed with the active key, or,
+// without a Keyring, whether it is unsealed.
+func (k *Keyring) Current(stored string) bool {
+	rest, sealed := strings.CutPrefix(stored, sealedPrefix)
+	if k == nil {
+		return !sealed
+	}
+	return sealed && strings.HasPrefix(rest, k.active+":")
+}
@@ -0,0 +1,198 @@
+package db
+
+// batch.go inserts rows in bulk. PostgREST accepts an array body, so
+// a zakat run or a block import that would otherwise issue one request
+// per block, transaction and zakat record sends one request per
+// SUPABASE_BATCH_SIZE rows (default 500). Batch gathers the rows and
+// flushes them whenever a kind reaches the batch size, and on Flush.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+)
+
+const defaultBatchSize = 500
+
+// BatchSize is the number of rows sent per bulk insert.
+func BatchSize() int {
+	if n, err := strconv.Atoi(os.Getenv("SUPABASE_BATCH_SIZE")); err == nil && n > 0 {
+		return n
+	}
+	return defaultBatchSize
+}
+
+// NewBlockRecord converts a mined block to its row in the blocks table.
+func NewBlockRecord(height int, block *blockchain.Block) (BlockRecord, error) {
+	// the full block is kept for the explorer and for details
+	raw, err := json.Marshal(block)
+	if err != nil {
+		return BlockRecord{}, fmt.Errorf("marshal block: %w", err)
+	}
+	return BlockRecord{
+		Hash:      fmt.Sprintf("%x", block.Hash),
+		Height:    height,
+		Timestamp: block.Timestamp,
+		PrevHash:  fmt.Sprintf("%x", block.PrevHash),
+		TxCount:   len(block.Transactions),
+		RawJSON:   raw,
+	}, nil
+}
+
+// NewTransactionRecord converts a mined transaction to its row in the
+// transactions table.
+func NewTransactionRecord(blockHash string, tx *blockchain.Transaction, sender, receiver string, amount int, txType string) (TransactionRecord, error) {
+	raw, err := json.Marshal(tx)
+	if err != nil {
+		return TransactionRecord{}, fmt.Errorf("marshal tx: %w", err)
+	}
+	return TransactionRecord{
+		TxID:      fmt.Sprintf("%x", tx.ID),
+		BlockHash: blockHash,
+		Sender:    sender,
+		Receiver:  receiver,
+		Amount:    amount,
+		Timestamp: time.Now().Unix(),
+		Type:      txType,
+		RawJSON:   raw,
+	}, nil
+}
+
+// insertRows posts rows to table in chunks of BatchSize.
+func insertRows[T any](ctx context.Context, c *SupabaseClient, op, table string, rows []T) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	size := BatchSize()
+	for start := 0; start < len(rows); start += size {
+		end := start + size
+		if end > len(rows) {
+			end = len(rows)
+		}
+		req, err := c.newRequest(ctx, http.MethodPost, table, rows[start:end])
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Prefer", "return=minimal")
+		if err := c.do(req, op, nil); err != nil {
+			return fmt.Errorf("rows %d-%d of %d: %w", start+1, end, len(rows), err)
+		}
+	}
+	return nil
+}
+
+// InsertBlocks inserts block rows in bulk.
+func (c *SupabaseClient) InsertBlocks(ctx context.Context, rows []BlockRecord) error {
+	return insertRows(ctx, c, "InsertBlocks", tableBlocks, rows)
+}
+
+// InsertTransactions inserts transaction rows in bulk.
+func (c *SupabaseClient) InsertTransactions(ctx context.Context, rows []TransactionRecord) error {
+	return insertRows(ctx, c, "InsertTransactions", tableTransactions, rows)
+}
+
+// InsertZakatRecords inserts zakat records in bulk.
+func (c *SupabaseClient) InsertZakatRecords(ctx context.Context, rows []models.ZakatRecord) error {
+	return insertRows(ctx, c, "InsertZakatRecords", tableZakat, rows)
+}
+
+// BulkWriter inserts many rows per call. Store includes it.
+type BulkWriter interface {
+	InsertBlocks(ctx context.Context, rows []BlockRecord) error
+	InsertTransactions(ctx context.Context, rows []TransactionRecord) error
+	InsertZakatRecords(ctx context.Context, rows []models.ZakatRecord) error
+}
+
+// Batch gathers blocks, transactions and zakat records for bulk
+// insertion. Rows are flushed in that order, so a transaction or zakat
+// record never reaches the database before the block it refers to. A
+// Batch is not safe for concurrent use.
+type Batch struct {
+	w    BulkWriter
+	size int
+
+	blocks []BlockRecord
+	txs    []TransactionRecord
+	zakat  []models.ZakatRecord
+
+	// AfterZakat, if set, is called for each zakat record once it has
+	// been stored.
+	AfterZakat func(zr models.ZakatRecord)
+}
+
+// NewBatch returns an empty batch writing to w.
+func NewBatch(w BulkWriter) *Batch {
+	return &Batch{w: w, size: BatchSize()}
+}
+
+// AddBlock queues the row of a mined block.
+func (b *Batch) AddBlock(ctx context.Context, height int, block *blockchain.Block) error {
+	rec, err := NewBlockRecord(height, block)
+	if err != nil {
+		return err
+	}
+	b.blocks = append(b.blocks, rec)
+	return b.flushIfFull(ctx)
+}
+
+// AddTransaction queues the row of a mined transaction.
+func (b *Batch) AddTransaction(ctx context.Context, blockHash string, tx *blockchain.Transaction, sender, receiver string, amount int, txType string) error {
+	rec, err := NewTransactionRecord(blockHash, tx, sender, receiver, amount, txType)
+	if err != nil {
+		return err
+	}
+	b.txs = append(b.txs, rec)
+	return b.flushIfFull(ctx)
+}
+
+// AddZakatRecord queues a zakat record.
+func (b *Batch) AddZakatRecord(ctx context.Context, zr *models.ZakatRecord) error {
+	b.zakat = append(b.zakat, *zr)
+	return b.flushIfFull(ctx)
+}
+
+func (b *Batch) flushIfFull(ctx context.Context) error {
+	if len(b.blocks) < b.size && len(b.txs) < b.size && len(b.zakat) < b.size {
+		return nil
+	}
+	return b.Flush(ctx)
+}
+
+// Flush inserts every queued row and empties the batch. When a kind
+// fails, the kinds after it are not attempted, since they may refer to
+// the missing rows. The error reports what failed; dropped blocks and
+// transactions are restored by POST /admin/rebuild.
+func (b *Batch) Flush(ctx context.Context) error {
+	blocks, txs, zakat := b.blocks, b.txs, b.zakat
+	b.blocks, b.txs, b.zakat = nil, nil, nil
+
+	if len(blocks) > 0 {
+		if err := b.w.InsertBlocks(ctx, blocks); err != nil {
+			return fmt.Errorf("insert %d blocks: %w", len(blocks), err)
+		}
+	}
+	if len(txs) > 0 {
+		if err := b.w.InsertTransactions(ctx, txs); err != nil {
+			return fmt.Errorf("insert %d transactions: %w", len(txs), err)
+		}
+	}
+	if len(zakat) > 0 {
+		if err := b.w.InsertZakatRecords(ctx, zakat); err != nil {
+			return fmt.Errorf("insert %d zakat records: %w", len(zakat), err)
+		}
+		if b.AfterZakat != nil {
+			for _, zr := range zakat {
+				b.AfterZakat(zr)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package db
+
+// breaker.go wraps every Supabase round trip in a circuit breaker and
+// records per-operation call statistics. After
+// SUPABASE_BREAKER_THRESHOLD consecutive failures (transport errors and
+// 5xx responses; default 5) the breaker opens and calls fail at once
+// with ErrCircuitOpen instead of waiting out timeouts. After
+// SUPABASE_BREAKER_COOLDOWN seconds (default 30) one call is let
+// through as a probe: success closes the breaker, failure keeps it open
+// for another cooldown.
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without contacting Supabase while the
+// breaker is open.
+var ErrCircuitOpen = errors.New("supabase circuit breaker is open")
+
+// Breaker states.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// BreakerStats is a snapshot of the circuit breaker.
+type BreakerStats struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Threshold           int        `json:"threshold"`
+	CooldownSeconds     int        `json:"cooldown_seconds"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+// OpStats counts the calls of one client operation.
+type OpStats struct {
+	Calls     int64  `json:"calls"`
+	Errors    int64  `json:"errors"`   // transport errors and non-2xx responses
+	Rejected  int64  `json:"rejected"` // failed fast by the open breaker
+	TotalMS   int64  `json:"total_ms"`
+	MaxMS     int64  `json:"max_ms"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// ClientStats is what the client reports for readiness and metrics.
+type ClientStats struct {
+	Breaker    BreakerStats       `json:"breaker"`
+	Operations map[string]OpStats `json:"operations"`
+}
+
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+
+	state     string
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	lastError string
+
+	ops map[string]*OpStats
+
+	// observe, when set, is told about every call (see ObserveCalls).
+	observe func(op, outcome string, elapsed time.Duration)
+}
+
+func newBreaker() *breaker {
+	b := &breaker{
+		threshold: defaultBreakerThreshold,
+		cooldown:  defaultBreakerCooldown,
+		state:     BreakerClosed,
+		ops:       make(map[string]*OpStats),
+	}
+	if n, err := strconv.Atoi(os.Getenv("SUPABASE_BREAKER_THRESHOLD")); err == nil && n > 0 {
+		b.threshold = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("SUPABASE_BREAKER_COOLDOWN")); err == nil && n > 0 {
+		b.cooldown = time.Duration(n) * time.Second
+	}
+	return b
+}
+
+func (b *breaker) op(name string) *OpStats {
+	st, ok := b.ops[name]
+	if !ok {
+		st = &OpStats{}
+		b.ops[name] = st
+	}
+	return st
+}
+
+// allow reports whether a call may go out. Once the cooldown has
+// passed a single caller is admitted as the probe.
+func (b *breaker) allow(op string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			b.op(op).Rejected++
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			b.op(op).Rejected++
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Call outcomes as the breaker sees them.
+const (
+	callOK      = iota // Supabase answered, even if with a 4xx
+	callFailed         // outage: transport error or 5xx
+	callAborted        // the caller gave up; says nothing about Supabase
+)
+
+// record accounts for a finished call; errMsg is set for any error.
+func (b *breaker) record(op string, elapsed time.Duration, outcome int, errMsg string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := b.op(op)
+	st.Calls++
+	ms := elapsed.Milliseconds()
+	st.TotalMS += ms
+	if ms > st.MaxMS {
+		st.MaxMS = ms
+	}
+	if errMsg != "" {
+		st.Errors++
+		st.LastError = errMsg
+	}
+
+	b.probing = false
+	switch outcome {
+	case callAborted:
+		return
+	case callOK:
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	b.lastError = errMsg
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *breaker) stats() ClientStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bs := BreakerStats{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		Threshold:           b.threshold,
+		CooldownSeconds:     int(b.cooldown.Seconds()),
+		LastError:           b.lastError,
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt.UTC()
+		bs.OpenedAt = &openedAt
+	}
+	ops := make(map[string]OpStats, len(b.ops))
+	for name, st := range b.ops {
+		ops[name] = *st
+	}
+	return ClientStats{Breaker: bs, Operations: ops}
+}
+
+// send performs req through the breaker. op names the calling method.
+// The caller must close the response body.
+func (c *SupabaseClient) send(req *http.Request, op string) (*http.Response, error) {
+	b := c.breaker
+	if b == nil {
+		return http.DefaultClient.Do(req)
+	}
+	if err := b.allow(op); err != nil {
+		if b.observe != nil {
+			b.observe(op, CallRejected, 0)
+		}
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	elapsed := time.Since(start)
+
+	outcome := CallError
+	switch {
+	case err != nil && errors.Is(err, context.Canceled):
+		b.record(op, elapsed, callAborted, err.Error())
+		outcome = CallAborted
+	case err != nil:
+		b.record(op, elapsed, callFailed, err.Error())
+	case resp.StatusCode >= 500:
+		b.record(op, elapsed, callFailed, resp.Status)
+	case resp.StatusCode >= 300:
+		b.record(op, elapsed, callOK, resp.Status)
+	default:
+		b.record(op, elapsed, callOK, "")
+		outcome = CallOK
+	}
+	if b.observe != nil {
+		b.observe(op, outcome, elapsed)
+	}
+	return resp, err
+}
+
+// Outcomes of a call, as passed to ObserveCalls.
+const (
+	CallOK       = "ok"
+	CallError    = "error"    // transport error or non-2xx response
+	CallRejected = "rejected" // failed fast by the open breaker
+	CallAborted  = "aborted"  // the caller gave up
+)
+
+// ObserveCalls has fn called with the operation, outcome and duration
+// of every Supabase call, e.g. to export them as metrics. It must be
+// called before the client is used.
+func (c *SupabaseClient) ObserveCalls(fn func(op, outcome string, elapsed time.Duration)) {
+	if c == nil || c.breaker == nil {
+		return
+	}
+	c.breaker.observe = fn
+}
+
+// Stats returns the breaker state and per-operation call statistics.
+func (c *SupabaseClient) Stats() ClientStats {
+	if c == nil || c.breaker == nil {
+		return ClientStats{Breaker: BreakerStats{State: BreakerClosed}, Operations: map[string]OpStats{}}
+	}
+	return c.breaker.stats()
+}
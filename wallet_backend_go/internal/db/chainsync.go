@@ -0,0 +1,91 @@
+package db
+
+// chainsync.go reads the chain back from the blocks table. A node whose
+// chain store is new seeds it this way, and a read-only explorer node
+// follows the writing node by importing the blocks it mirrors. Nodes
+// that ran without a genesis file built their genesis block at startup
+// and never mirrored it, so SeedGenesis recovers it from the table
+// first.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+// syncPageSize is the number of blocks read per request.
+const syncPageSize = 500
+
+// SyncChain imports the stored blocks above bc's tip in height order
+// and returns how many it imported. It stops at the first block that is
+// missing or does not extend the chain. The caller serializes access to
+// bc.
+func SyncChain(ctx context.Context, store Store, bc *blockchain.Blockchain) (int, error) {
+	imported := 0
+	for {
+		rows, err := store.ListBlocks(ctx, len(bc.Blocks), syncPageSize)
+		if err != nil {
+			return imported, err
+		}
+		for _, row := range rows {
+			height := len(bc.Blocks)
+			if row.Height != height {
+				return imported, fmt.Errorf("expected block %d, found block %d", height, row.Height)
+			}
+			var b blockchain.Block
+			if err := json.Unmarshal(row.RawJSON, &b); err != nil {
+				return imported, fmt.Errorf("block %d: %v", height, err)
+			}
+			if err := bc.ImportBlock(&b); err != nil {
+				if height == 1 {
+					err = fmt.Errorf("%v; the blocks were mined on another genesis than GENESIS_FILE's", err)
+				}
+				return imported, fmt.Errorf("block %d: %v", height, err)
+			}
+			imported++
+		}
+		if len(rows) < syncPageSize {
+			return imported, nil
+		}
+	}
+}
+
+// SeedGenesis makes the genesis of bc, which holds only its genesis
+// block, the one the stored blocks were mined on, and reports whether
+// it changed it. The genesis is the stored height-0 row when there is
+// one; otherwise bc's genesis is taken on with the hash the height-1
+// row links to, which keeps its transactions (the genesis coinbase pays
+// a fixed address, so its id is the same on every node) but not its
+// timestamp and nonce. Only nodes without a genesis file, whose genesis
+// is not pinned, should seed it.
+func SeedGenesis(ctx context.Context, store Store, bc *blockchain.Blockchain) (bool, error) {
+	rows, err := store.ListBlocks(ctx, 0, 2)
+	if err != nil {
+		return false, err
+	}
+	current := bc.Blocks[0]
+	for _, row := range rows {
+		var b blockchain.Block
+		if err := json.Unmarshal(row.RawJSON, &b); err != nil {
+			return false, fmt.Errorf("block %d: %v", row.Height, err)
+		}
+		switch row.Height {
+		case 0:
+			if bytes.Equal(b.Hash, current.Hash) {
+				return false, nil
+			}
+			return true, bc.AdoptGenesis(&b)
+		case 1:
+			if bytes.Equal(b.PrevHash, current.Hash) {
+				return false, nil
+			}
+			g := *current
+			g.Hash = b.PrevHash
+			return true, bc.AdoptGenesis(&g)
+		}
+	}
+	return false, nil
+}
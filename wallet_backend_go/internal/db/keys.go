@@ -0,0 +1,196 @@
+package db
+
+// keys.go chooses the Supabase key sent with each request. The service
+// role key bypasses row level security, so it is only used where the
+// backend needs it: every write and every read of user data. Reads of
+// the public chain mirror (blocks and transactions) are sent with the
+// anon key, which RLS limits to what any visitor may see.
+//
+// SUPABASE_SERVICE_KEY and SUPABASE_ANON_KEY configure the two keys.
+// The legacy SUPABASE_KEY is the fallback for either; when it is the
+// only key set every request uses it, as before.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// publicTables may be read with the anon key.
+var publicTables = map[string]bool{
+	tableBlocks:       true,
+	tableTransactions: true,
+}
+
+// rlsProtectedTables must not return rows to the anon key.
+var rlsProtectedTables = []string{
+	tableUsers,
+	tableWalletProfiles,
+	tableZakat,
+	tableSystemLogs,
+	tableBeneficiaries,
+	tableTenants,
+	tableZakatRuns,
+	tableZakatRunItems,
+	tableSolvencyEpochs,
+	tableTxNotes,
+	tableEmailTemplates,
+	tableNotifications,
+	tableNotifyPrefs,
+	tableZakatPolicies,
+	tableFeatureFlags,
+	tableWebAuthnCreds,
+	tableTxPINs,
+	tableHeldTransfers,
+	tableReceiptAcks,
+	tableAPIAudit,
+	tableStealthReqs,
+	tableViewKeys,
+	tableTxReceipts,
+	tableCampaigns,
+	tableDigestSubs,
+	tablePledges,
+	tableDisbTemplates,
+	tableLocks,
+	tableWalletHandles,
+	tableInvitations,
+	tableDonationTags,
+	tableDeclarations,
+	tableDisbursements,
+	tableChainAnchors,
+	tableIdempotency,
+	tableBridgeDeposits,
+	tablePayouts,
+}
+
+// ErrSharedKey is returned by CheckRLS when the anon and service keys
+// are the same, so every request bypasses row level security.
+var ErrSharedKey = errors.New("anon and service keys are the same key")
+
+// supabaseKeys reads the service and anon keys from the environment.
+func supabaseKeys() (service, anon string) {
+	legacy := os.Getenv("SUPABASE_KEY")
+	service = os.Getenv("SUPABASE_SERVICE_KEY")
+	if service == "" {
+		service = legacy
+	}
+	anon = os.Getenv("SUPABASE_ANON_KEY")
+	if anon == "" {
+		anon = legacy
+	}
+	return service, anon
+}
+
+// SharedKey reports whether one key serves both roles.
+func (c *SupabaseClient) SharedKey() bool {
+	return c.AnonKey == "" || c.AnonKey == c.Key
+}
+
+// keyFor returns the least privileged key allowed to send method to
+// table.
+func (c *SupabaseClient) keyFor(method, table string) string {
+	if c.AnonKey != "" && publicTables[table] && (method == http.MethodGet || method == http.MethodHead) {
+		return c.AnonKey
+	}
+	return c.Key
+}
+
+// authorize sets the key headers of a request built for the REST API.
+func (c *SupabaseClient) authorize(req *http.Request) {
+	key := c.keyFor(req.Method, tableOf(req.URL.Path))
+	req.Header.Set("apikey", key)
+	req.Header.Set("Authorization", "Bearer "+key)
+}
+
+// tableOf extracts the table name from a /rest/v1/<table> path.
+func tableOf(path string) string {
+	i := strings.LastIndex(path, "/rest/v1/")
+	if i < 0 {
+		return ""
+	}
+	table := path[i+len("/rest/v1/"):]
+	if j := strings.IndexByte(table, '/'); j >= 0 {
+		table = table[:j]
+	}
+	return table
+}
+
+// RLSFinding is a row level security expectation that does not hold.
+type RLSFinding struct {
+	Table   string `json:"table"`
+	Problem string `json:"problem"`
+}
+
+// CheckRLS reads one row of every table with the anon key. The public
+// tables must be readable; every other table must refuse the request
+// or return no rows. A table that does not exist is skipped. It returns
+// ErrSharedKey without probing when there is no separate anon key, and
+// an error when Supabase cannot be reached.
+func (c *SupabaseClient) CheckRLS(ctx context.Context) ([]RLSFinding, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+	if c.SharedKey() {
+		return nil, ErrSharedKey
+	}
+
+	var findings []RLSFinding
+	for _, table := range []string{tableBlocks, tableTransactions} {
+		status, _, err := c.probeAnon(ctx, table)
+		if err != nil {
+			return nil, err
+		}
+		if status == http.StatusUnauthorized || status == http.StatusForbidden {
+			findings = append(findings, RLSFinding{Table: table, Problem: "anon key cannot read the public chain mirror"})
+		}
+	}
+	for _, table := range rlsProtectedTables {
+		status, rows, err := c.probeAnon(ctx, table)
+		if err != nil {
+			return nil, err
+		}
+		if status < 300 && rows > 0 {
+			findings = append(findings, RLSFinding{Table: table, Problem: "anon key can read rows"})
+		}
+	}
+	return findings, nil
+}
+
+// probeAnon selects one row of table with the anon key and returns the
+// response status and the number of rows returned.
+func (c *SupabaseClient) probeAnon(ctx context.Context, table string) (int, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/rest/v1/%s?select=*&limit=1", c.URL, table), nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("apikey", c.AnonKey)
+	req.Header.Set("Authorization", "Bearer "+c.AnonKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.send(req, "CheckRLS")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, 0, fmt.Errorf("supabase CheckRLS %s error: %s - %s", table, resp.Status, string(body))
+	}
+	if resp.StatusCode >= 300 {
+		// refused, or the table does not exist
+		return resp.StatusCode, 0, nil
+	}
+
+	var rows []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return 0, 0, fmt.Errorf("decode %s: %w", table, err)
+	}
+	return resp.StatusCode, len(rows), nil
+}
@@ -0,0 +1,522 @@
+package db
+
+// pii.go encrypts the personal data columns of users (email, cnic,
+// phone), wallet_profiles (encrypted_private_key), invitations
+// (escrow_key) and donation_declarations (full_name, home_address,
+// postcode) before they leave the process, and decrypts them on read, so the rest of the code keeps
+// working with plaintext models.
+//
+// Keys come from PII_ENCRYPTION_KEYS, or from the file named by
+// PII_ENCRYPTION_KEYS_FILE (as mounted by a KMS or secret manager): a
+// comma-separated list of <key id>:<base64 32-byte key>. The first key
+// encrypts; the others only decrypt, which allows rotation. Values are
+// stored as enc:v1:<key id>:<base64 nonce+ciphertext>, sealed with
+// AES-256-GCM and the column name as additional data. Values without
+// the prefix were written before encryption was enabled and are read
+// as they are; ReencryptPII rewrites them, and values under an old key,
+// with the active key.
+//
+// Encrypted email and cnic can no longer be matched by the database,
+// so users also carry email_hash and cnic_hash, keyed HMAC-SHA256 blind
+// indexes of the normalized values. Lookups try the hashes of every
+// configured key.
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"wallet_backend_go/internal/models"
+)
+
+const piiPrefix = "enc:v1:"
+
+// Encrypted columns, also used as GCM additional data and as the
+// blind index domain.
+const (
+	colUserEmail         = "users.email"
+	colUserCNIC          = "users.cnic"
+	colUserPhone         = "users.phone"
+	colWalletPrivateKey  = "wallet_profiles.encrypted_private_key"
+	colEscrowKey         = "invitations.escrow_key"
+	colDeclarantName     = "donation_declarations.full_name"
+	colDeclarantAddress  = "donation_declarations.home_address"
+	colDeclarantPostcode = "donation_declarations.postcode"
+)
+
+type fieldCipher struct {
+	active string
+	order  []string // key ids, active first
+	aeads  map[string]cipher.AEAD
+	index  map[string][]byte // blind index key per key id
+}
+
+// loadFieldCipher reads the PII keys from the environment. It returns
+// nil when none are configured.
+func loadFieldCipher() (*fieldCipher, error) {
+	spec := os.Getenv("PII_ENCRYPTION_KEYS")
+	if path := os.Getenv("PII_ENCRYPTION_KEYS_FILE"); path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read PII_ENCRYPTION_KEYS_FILE: %w", err)
+		}
+		spec = strings.TrimSpace(string(raw))
+	}
+	if spec == "" {
+		return nil, nil
+	}
+	return parseFieldKeys(spec)
+}
+
+func parseFieldKeys(spec string) (*fieldCipher, error) {
+	fc := &fieldCipher{
+		aeads: make(map[string]cipher.AEAD),
+		index: make(map[string][]byte),
+	}
+	for _, part := range strings.Split(spec, ",") {
+		kid, encoded, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || kid == "" {
+			return nil, fmt.Errorf("PII key %q: want <key id>:<base64 key>", part)
+		}
+		if _, dup := fc.aeads[kid]; dup {
+			return nil, fmt.Errorf("PII key id %q is listed twice", kid)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("PII key %q: want 32 bytes of base64", kid)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte("zakatwallet/pii-blind-index"))
+
+		fc.aeads[kid] = aead
+		fc.index[kid] = mac.Sum(nil)
+		fc.order = append(fc.order, kid)
+	}
+	fc.active = fc.order[0]
+	return fc, nil
+}
+
+// encrypt seals a column value with the active key. Empty values stay
+// empty; without a cipher values are returned as they are.
+func (fc *fieldCipher) encrypt(column, value string) (string, error) {
+	if fc == nil || value == "" {
+		return value, nil
+	}
+	aead := fc.aeads[fc.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(column))
+	return piiPrefix + fc.active + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt opens a value written by encrypt. Plaintext values are
+// returned unchanged.
+func (fc *fieldCipher) decrypt(column, value string) (string, error) {
+	if !strings.HasPrefix(value, piiPrefix) {
+		return value, nil
+	}
+	if fc == nil {
+		return "", fmt.Errorf("%s is encrypted but PII_ENCRYPTION_KEYS is not set", column)
+	}
+	kid, encoded, ok := strings.Cut(value[len(piiPrefix):], ":")
+	aead := fc.aeads[kid]
+	if !ok || aead == nil {
+		return "", fmt.Errorf("%s is encrypted with unknown key %q", column, kid)
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("%s: malformed ciphertext", column)
+	}
+	n := aead.NonceSize()
+	plain, err := aead.Open(nil, sealed[:n], sealed[n:], []byte(column))
+	if err != nil {
+		return "", fmt.Errorf("%s: decryption failed", column)
+	}
+	return string(plain), nil
+}
+
+// current reports whether value needs no rewrite: it is empty or
+// encrypted with the active key.
+func (fc *fieldCipher) current(value string) bool {
+	return value == "" || strings.HasPrefix(value, piiPrefix+fc.active+":")
+}
+
+// blindIndex returns the lookup hash of value under key kid.
+func (fc *fieldCipher) blindIndex(kid, column, value string) string {
+	if fc == nil || value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, fc.index[kid])
+	mac.Write([]byte(column))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// blindIndexes returns the lookup hashes of value under every key,
+// active first.
+func (fc *fieldCipher) blindIndexes(column, value string) []string {
+	hashes := make([]string, 0, len(fc.order))
+	for _, kid := range fc.order {
+		hashes = append(hashes, fc.blindIndex(kid, column, value))
+	}
+	return hashes
+}
+
+// EncryptsPII reports whether personal data columns are encrypted.
+func (c *SupabaseClient) EncryptsPII() bool {
+	return c != nil && c.pii != nil
+}
+
+// userRow is a users row as stored: the model with encrypted columns
+// plus the blind indexes, which are omitted without encryption.
+type userRow struct {
+	models.User
+	EmailHash string `json:"email_hash,omitempty"`
+	CNICHash  string `json:"cnic_hash,omitempty"`
+}
+
+// sealUser returns the stored form of u.
+func (c *SupabaseClient) sealUser(u *models.User) (*userRow, error) {
+	row := &userRow{User: *u}
+	if c.pii == nil {
+		return row, nil
+	}
+	var err error
+	if row.Email, err = c.pii.encrypt(colUserEmail, u.Email); err != nil {
+		return nil, err
+	}
+	if row.CNIC, err = c.pii.encrypt(colUserCNIC, u.CNIC); err != nil {
+		return nil, err
+	}
+	if row.Phone, err = c.pii.encrypt(colUserPhone, u.Phone); err != nil {
+		return nil, err
+	}
+	row.EmailHash = c.pii.blindIndex(c.pii.active, colUserEmail, u.Email)
+	row.CNICHash = c.pii.blindIndex(c.pii.active, colUserCNIC, u.CNIC)
+	return row, nil
+}
+
+// openUser decrypts the columns of a user read from the database.
+func (c *SupabaseClient) openUser(u *models.User) error {
+	var err error
+	if u.Email, err = c.pii.decrypt(colUserEmail, u.Email); err != nil {
+		return err
+	}
+	if u.CNIC, err = c.pii.decrypt(colUserCNIC, u.CNIC); err != nil {
+		return err
+	}
+	u.Phone, err = c.pii.decrypt(colUserPhone, u.Phone)
+	return err
+}
+
+// sealWalletProfile returns the stored form of wp.
+func (c *SupabaseClient) sealWalletProfile(wp *models.WalletProfile) (*models.WalletProfile, error) {
+	row := *wp
+	var err error
+	if row.EncryptedPrivateKey, err = c.pii.encrypt(colWalletPrivateKey, wp.EncryptedPrivateKey); err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// openWalletProfiles decrypts wallet profiles read from the database.
+func (c *SupabaseClient) openWalletProfiles(rows []models.WalletProfile) error {
+	for i := range rows {
+		key, err := c.pii.decrypt(colWalletPrivateKey, rows[i].EncryptedPrivateKey)
+		if err != nil {
+			return fmt.Errorf("wallet %s: %w", rows[i].WalletAddress, err)
+		}
+		rows[i].EncryptedPrivateKey = key
+	}
+	return nil
+}
+
+// sealInvitation returns the stored form of inv.
+func (c *SupabaseClient) sealInvitation(inv *models.Invitation) (*models.Invitation, error) {
+	row := *inv
+	var err error
+	if row.EscrowKey, err = c.pii.encrypt(colEscrowKey, inv.EscrowKey); err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// openInvitations decrypts invitations read from the database.
+func (c *SupabaseClient) openInvitations(rows []models.Invitation) error {
+	for i := range rows {
+		key, err := c.pii.decrypt(colEscrowKey, rows[i].EscrowKey)
+		if err != nil {
+			return fmt.Errorf("invitation %s: %w", rows[i].ID, err)
+		}
+		rows[i].EscrowKey = key
+	}
+	return nil
+}
+
+// sealDeclaration returns the stored form of d.
+func (c *SupabaseClient) sealDeclaration(d *models.DonationDeclaration) (*models.DonationDeclaration, error) {
+	row := *d
+	var err error
+	if row.FullName, err = c.pii.encrypt(colDeclarantName, d.FullName); err != nil {
+		return nil, err
+	}
+	if row.HomeAddress, err = c.pii.encrypt(colDeclarantAddress, d.HomeAddress); err != nil {
+		return nil, err
+	}
+	if row.Postcode, err = c.pii.encrypt(colDeclarantPostcode, d.Postcode); err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// openDeclarations decrypts declarations read from the database.
+func (c *SupabaseClient) openDeclarations(rows []models.DonationDeclaration) error {
+	for i := range rows {
+		d := &rows[i]
+		var err error
+		if d.FullName, err = c.pii.decrypt(colDeclarantName, d.FullName); err != nil {
+			return fmt.Errorf("declaration %s: %w", d.ID, err)
+		}
+		if d.HomeAddress, err = c.pii.decrypt(colDeclarantAddress, d.HomeAddress); err != nil {
+			return fmt.Errorf("declaration %s: %w", d.ID, err)
+		}
+		if d.Postcode, err = c.pii.decrypt(colDeclarantPostcode, d.Postcode); err != nil {
+			return fmt.Errorf("declaration %s: %w", d.ID, err)
+		}
+	}
+	return nil
+}
+
+// emailFilter is the PostgREST filter matching a user's email: its
+// blind index under any key, or the plaintext of rows written before
+// encryption was enabled.
+func (c *SupabaseClient) emailFilter(email string) string {
+	if c.pii == nil {
+		return "email=eq." + url.QueryEscape(email)
+	}
+	quoted := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(email)
+	return "or=" + url.QueryEscape(fmt.Sprintf(`(email_hash.in.(%s),email.eq."%s")`,
+		strings.Join(c.pii.blindIndexes(colUserEmail, email), ","), quoted))
+}
+
+// PIIMigrationReport counts the rows visited and rewritten by
+// ReencryptPII.
+type PIIMigrationReport struct {
+	DryRun                bool `json:"dry_run"`
+	Users                 int  `json:"users"`
+	UsersUpdated          int  `json:"users_updated"`
+	WalletProfiles        int  `json:"wallet_profiles"`
+	WalletProfilesUpdated int  `json:"wallet_profiles_updated"`
+}
+
+// ReencryptPII rewrites every users and wallet_profiles row whose
+// personal data is plaintext or encrypted with an old key, and fills
+// in missing or stale blind indexes. With dryRun it only counts them.
+// Rows are paged by id, BatchSize at a time; it is safe to run again
+// after a failure.
+func (c *SupabaseClient) ReencryptPII(ctx context.Context, dryRun bool) (PIIMigrationReport, error) {
+	rep := PIIMigrationReport{DryRun: dryRun}
+	if c == nil {
+		return rep, fmt.Errorf("supabase client is nil")
+	}
+	if c.pii == nil {
+		return rep, fmt.Errorf("PII_ENCRYPTION_KEYS is not set")
+	}
+
+	size := BatchSize()
+	for offset := 0; ; offset += size {
+		req, err := c.newRequest(ctx, http.MethodGet,
+			fmt.Sprintf("%s?select=*&order=id.asc&limit=%d&offset=%d", tableUsers, size, offset), nil)
+		if err != nil {
+			return rep, err
+		}
+		var rows []userRow
+		if err := c.do(req, "ReencryptPII users", &rows); err != nil {
+			return rep, err
+		}
+		for _, row := range rows {
+			rep.Users++
+			if err := c.reencryptUser(ctx, row, dryRun, &rep); err != nil {
+				return rep, fmt.Errorf("user %s: %w", row.ID, err)
+			}
+		}
+		if len(rows) < size {
+			break
+		}
+	}
+
+	for offset := 0; ; offset += size {
+		req, err := c.newRequest(ctx, http.MethodGet,
+			fmt.Sprintf("%s?select=id,wallet_address,encrypted_private_key&order=id.asc&limit=%d&offset=%d", tableWalletProfiles, size, offset), nil)
+		if err != nil {
+			return rep, err
+		}
+		var rows []models.WalletProfile
+		if err := c.do(req, "ReencryptPII wallet_profiles", &rows); err != nil {
+			return rep, err
+		}
+		for _, row := range rows {
+			rep.WalletProfiles++
+			if c.pii.current(row.EncryptedPrivateKey) {
+				continue
+			}
+			rep.WalletProfilesUpdated++
+			if dryRun {
+				continue
+			}
+			plain, err := c.pii.decrypt(colWalletPrivateKey, row.EncryptedPrivateKey)
+			if err != nil {
+				return rep, fmt.Errorf("wallet %s: %w", row.WalletAddress, err)
+			}
+			sealed, err := c.pii.encrypt(colWalletPrivateKey, plain)
+			if err != nil {
+				return rep, err
+			}
+			patch := map[string]string{"encrypted_private_key": sealed}
+			req, err := c.newRequest(ctx, http.MethodPatch, fmt.Sprintf("%s?id=eq.%s", tableWalletProfiles, row.ID), patch)
+			if err != nil {
+				return rep, err
+			}
+			req.Header.Set("Prefer", "return=minimal")
+			if err := c.do(req, "ReencryptPII wallet_profiles", nil); err != nil {
+				return rep, fmt.Errorf("wallet %s: %w", row.WalletAddress, err)
+			}
+		}
+		if len(rows) < size {
+			break
+		}
+	}
+	return rep, nil
+}
+
+// WalletKeyMigrationReport counts the wallet_profiles rows visited and
+// rewritten by MigrateWalletKeys.
+type WalletKeyMigrationReport struct {
+	DryRun         bool `json:"dry_run"`
+	WalletProfiles int  `json:"wallet_profiles"`
+	Updated        int  `json:"updated"`
+}
+
+// MigrateWalletKeys passes the private key of every wallet profile, as
+// the API stores it, to rewrap and writes back the keys it changes.
+// rewrap returns the new stored form and whether it differs. With
+// dryRun it only counts them. Rows are paged by id, BatchSize at a
+// time; it is safe to run again after a failure.
+func (c *SupabaseClient) MigrateWalletKeys(ctx context.Context, dryRun bool, rewrap func(address, key string) (string, bool, error)) (WalletKeyMigrationReport, error) {
+	rep := WalletKeyMigrationReport{DryRun: dryRun}
+	if c == nil {
+		return rep, fmt.Errorf("supabase client is nil")
+	}
+
+	size := BatchSize()
+	for offset := 0; ; offset += size {
+		req, err := c.newRequest(ctx, http.MethodGet,
+			fmt.Sprintf("%s?select=id,wallet_address,encrypted_private_key&order=id.asc&limit=%d&offset=%d", tableWalletProfiles, size, offset), nil)
+		if err != nil {
+			return rep, err
+		}
+		var rows []models.WalletProfile
+		if err := c.do(req, "MigrateWalletKeys", &rows); err != nil {
+			return rep, err
+		}
+		if err := c.openWalletProfiles(rows); err != nil {
+			return rep, err
+		}
+		for _, row := range rows {
+			rep.WalletProfiles++
+			key, changed, err := rewrap(row.WalletAddress, row.EncryptedPrivateKey)
+			if err != nil {
+				return rep, fmt.Errorf("wallet %s: %w", row.WalletAddress, err)
+			}
+			if !changed {
+				continue
+			}
+			rep.Updated++
+			if dryRun {
+				continue
+			}
+			sealed, err := c.pii.encrypt(colWalletPrivateKey, key)
+			if err != nil {
+				return rep, err
+			}
+			patch := map[string]string{"encrypted_private_key": sealed}
+			req, err := c.newRequest(ctx, http.MethodPatch, fmt.Sprintf("%s?id=eq.%s", tableWalletProfiles, row.ID), patch)
+			if err != nil {
+				return rep, err
+			}
+			req.Header.Set("Prefer", "return=minimal")
+			if err := c.do(req, "MigrateWalletKeys", nil); err != nil {
+				return rep, fmt.Errorf("wallet %s: %w", row.WalletAddress, err)
+			}
+		}
+		if len(rows) < size {
+			break
+		}
+	}
+	return rep, nil
+}
+
+func (c *SupabaseClient) reencryptUser(ctx context.Context, row userRow, dryRun bool, rep *PIIMigrationReport) error {
+	u := row.User
+	if err := c.openUser(&u); err != nil {
+		return err
+	}
+	stale := !c.pii.current(row.Email) || !c.pii.current(row.CNIC) || !c.pii.current(row.Phone) ||
+		row.EmailHash != c.pii.blindIndex(c.pii.active, colUserEmail, u.Email) ||
+		row.CNICHash != c.pii.blindIndex(c.pii.active, colUserCNIC, u.CNIC)
+	if !stale {
+		return nil
+	}
+	rep.UsersUpdated++
+	if dryRun {
+		return nil
+	}
+
+	sealed, err := c.sealUser(&u)
+	if err != nil {
+		return err
+	}
+	patch := map[string]interface{}{
+		"email":      nullable(sealed.Email),
+		"cnic":       nullable(sealed.CNIC),
+		"phone":      nullable(sealed.Phone),
+		"email_hash": nullable(sealed.EmailHash),
+		"cnic_hash":  nullable(sealed.CNICHash),
+	}
+	req, err := c.newRequest(ctx, http.MethodPatch, fmt.Sprintf("%s?id=eq.%s", tableUsers, row.ID), patch)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "ReencryptPII users", nil)
+}
+
+// nullable maps an empty column value to null, as omitempty does on
+// insert.
+func nullable(v string) interface{} {
+	if v == "" {
+		return nil
+	}
+	return v
+}
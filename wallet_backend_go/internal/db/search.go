@@ -0,0 +1,77 @@
+package db
+
+// search.go backs the admin support search. It returns candidate rows
+// from users, wallet_profiles, beneficiaries and transactions whose
+// email, CNIC, wallet address or txid contains the query; the API ranks
+// them. Encrypted emails and CNICs (see pii.go) can only be found by an
+// exact match on their blind index.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"wallet_backend_go/internal/models"
+)
+
+// SearchMatches holds the rows of each table that may match a search.
+// Wallet profiles are returned without their private key.
+type SearchMatches struct {
+	Users         []models.User
+	Wallets       []models.WalletProfile
+	Beneficiaries []models.Beneficiary
+	Transactions  []TransactionRecord
+}
+
+// Search looks for q in every searchable column, returning at most
+// limit rows per table. q must not contain PostgREST syntax characters
+// (commas, parentheses, quotes, asterisks); callers validate it.
+// Transactions are not tenant scoped.
+func (c *SupabaseClient) Search(ctx context.Context, tenantID, q string, limit int) (*SearchMatches, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	esc := url.QueryEscape(q)
+	like := "%22*" + esc + "*%22" // quoted, as q may contain dots
+	userFilters := []string{"email.ilike." + like, "cnic.ilike." + like}
+	if c.pii != nil {
+		userFilters = append(userFilters,
+			"email_hash.in.("+strings.Join(c.pii.blindIndexes(colUserEmail, q), ",")+")",
+			"cnic_hash.in.("+strings.Join(c.pii.blindIndexes(colUserCNIC, q), ",")+")")
+	}
+
+	m := &SearchMatches{}
+	queries := []struct {
+		op   string
+		path string
+		out  interface{}
+	}{
+		{"Search users", fmt.Sprintf("%s?select=*&or=(%s)%s&limit=%d",
+			tableUsers, strings.Join(userFilters, ","), tenantFilter(tenantID), limit), &m.Users},
+		{"Search wallet_profiles", fmt.Sprintf("%s?select=id,user_id,tenant_id,wallet_address,status,created_at&wallet_address=ilike.*%s*%s&limit=%d",
+			tableWalletProfiles, esc, tenantFilter(tenantID), limit), &m.Wallets},
+		{"Search beneficiaries", fmt.Sprintf("%s?select=*&or=(cnic.ilike.%s,wallet_address.ilike.%s)%s&limit=%d",
+			tableBeneficiaries, like, like, tenantFilter(tenantID), limit), &m.Beneficiaries},
+		{"Search transactions", fmt.Sprintf("%s?select=txid,block_hash,sender,receiver,amount,timestamp,type&txid=ilike.*%s*&limit=%d",
+			tableTransactions, esc, limit), &m.Transactions},
+	}
+	for _, query := range queries {
+		req, err := c.newRequest(ctx, http.MethodGet, query.path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.do(req, query.op, query.out); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range m.Users {
+		if err := c.openUser(&m.Users[i]); err != nil {
+			return nil, fmt.Errorf("user %s: %w", m.Users[i].ID, err)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,202 @@
+package db
+
+// store.go defines Store, the persistence the API depends on.
+// SupabaseClient is the production implementation; tests and
+// alternative backends provide their own.
+
+import (
+	"context"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+	"wallet_backend_go/internal/models"
+)
+
+// Store is everything the API reads from and writes to its database.
+// Lookups return nil and no error when the row does not exist. Test
+// fakes can embed Store and implement only the methods they exercise.
+type Store interface {
+	// chain mirror
+	SaveBlock(ctx context.Context, height int, block *blockchain.Block) error
+	SaveTransaction(ctx context.Context, blockHash string, tx *blockchain.Transaction, sender, receiver string, amount int, txType string) error
+	BulkWriter
+	ListBlockHashes(ctx context.Context) (map[string]bool, error)
+	ListBlocks(ctx context.Context, fromHeight, limit int) ([]BlockRecord, error)
+	QueryBlocks(ctx context.Context, q blockchain.ListQuery) ([]BlockRecord, error)
+	ListTransactionIDs(ctx context.Context) (map[string]bool, error)
+	DropBlocks(ctx context.Context, blockHashes, revertedTxIDs []string) error
+	ListTransactionsByWallet(ctx context.Context, address string) ([]TransactionRecord, error)
+	QueryTransactionsByWallet(ctx context.Context, address string, q blockchain.ListQuery) ([]TransactionRecord, error)
+	GetTransactionRecord(ctx context.Context, txid string) (*TransactionRecord, error)
+	SetTransactionComplianceStatus(ctx context.Context, txid, status string) error
+	SetTransactionReceiver(ctx context.Context, txid, receiver string) error
+	SaveIdempotencyKey(ctx context.Context, k *models.IdempotencyKey) error
+	GetIdempotencyKey(ctx context.Context, scope, key string) (*models.IdempotencyKey, error)
+	CreateTransactionNote(ctx context.Context, n *models.TransactionNote) error
+	ListTransactionNotes(ctx context.Context, tenantID, txid string) ([]models.TransactionNote, error)
+	CreateTransactionReceipt(ctx context.Context, rc *models.TransactionReceipt) error
+	GetTransactionReceipt(ctx context.Context, tenantID, txid string) (*models.TransactionReceipt, error)
+	SaveDonationTag(ctx context.Context, t *models.DonationTag) error
+	ListDonationTags(ctx context.Context, userID string, from, to time.Time) ([]models.DonationTag, error)
+	CreateDonationDeclaration(ctx context.Context, d *models.DonationDeclaration) error
+	GetDonationDeclaration(ctx context.Context, txid string) (*models.DonationDeclaration, error)
+	WithdrawDonationDeclaration(ctx context.Context, txid string, at time.Time) (bool, error)
+	ListDonationDeclarations(ctx context.Context, tenantID string, from, to time.Time) ([]models.DonationDeclaration, error)
+	CreateChainAnchor(ctx context.Context, a *models.ChainAnchor) error
+	GetChainAnchor(ctx context.Context, id string) (*models.ChainAnchor, error)
+	ListChainAnchors(ctx context.Context, status string, limit int) ([]models.ChainAnchor, error)
+	UpdateChainAnchor(ctx context.Context, a *models.ChainAnchor) error
+	CreateBridgeDeposit(ctx context.Context, d *models.BridgeDeposit) error
+	GetBridgeDeposit(ctx context.Context, id string) (*models.BridgeDeposit, error)
+	ListBridgeDeposits(ctx context.Context, tenantID, campaignID, status string, limit int) ([]models.BridgeDeposit, error)
+	UpdateBridgeDeposit(ctx context.Context, d *models.BridgeDeposit) error
+
+	// tenants and users
+	CreateTenant(ctx context.Context, t *models.Tenant) error
+	GetTenant(ctx context.Context, id string) (*models.Tenant, error)
+	ListTenants(ctx context.Context) ([]models.Tenant, error)
+	UpdateTenantBranding(ctx context.Context, id string, branding map[string]string) (bool, error)
+	UpdateTenantProfile(ctx context.Context, id, description, category string, verified bool) (bool, error)
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUser(ctx context.Context, id string) (*models.User, error)
+	GetUserByEmail(ctx context.Context, tenantID, email string) (*models.User, error)
+	SetUserRole(ctx context.Context, tenantID, userID, role string) (bool, error)
+
+	// passkeys
+	CreateWebAuthnCredential(ctx context.Context, cred *models.WebAuthnCredential) error
+	GetWebAuthnCredential(ctx context.Context, id string) (*models.WebAuthnCredential, error)
+	ListWebAuthnCredentials(ctx context.Context, userID string) ([]models.WebAuthnCredential, error)
+	UpdateWebAuthnCredentialUsage(ctx context.Context, id string, signCount uint32, at time.Time) error
+
+	// transaction PINs
+	GetTransactionPIN(ctx context.Context, userID string) (*models.TransactionPIN, error)
+	SaveTransactionPIN(ctx context.Context, pin *models.TransactionPIN) error
+	UpdateTransactionPINAttempts(ctx context.Context, userID string, failedAttempts int, lockedUntil *time.Time) error
+	DeleteTransactionPIN(ctx context.Context, userID string) error
+
+	// cooling-off holds
+	CreateHeldTransfer(ctx context.Context, ht *models.HeldTransfer) error
+	GetHeldTransfer(ctx context.Context, id string) (*models.HeldTransfer, error)
+	ListHeldTransfers(ctx context.Context, status string) ([]models.HeldTransfer, error)
+	ResolveHeldTransfer(ctx context.Context, ht *models.HeldTransfer, fromStatus string) (bool, error)
+
+	// invitations
+	CreateInvitation(ctx context.Context, inv *models.Invitation) error
+	GetInvitation(ctx context.Context, id string) (*models.Invitation, error)
+	ListInvitationsBySender(ctx context.Context, userID string) ([]models.Invitation, error)
+	ListPendingInvitations(ctx context.Context, tenantID, contactHash string) ([]models.Invitation, error)
+	ResolveInvitation(ctx context.Context, inv *models.Invitation, fromStatus string) (bool, error)
+
+	// wallets
+	CreateWalletProfile(ctx context.Context, wp *models.WalletProfile) error
+	GetWalletProfileByAddress(ctx context.Context, address string) (*models.WalletProfile, error)
+	ListWalletProfiles(ctx context.Context, tenantID string) ([]models.WalletProfile, error)
+	ListWalletProfilesByUser(ctx context.Context, userID string) ([]models.WalletProfile, error)
+	UpdateWalletAutoZakat(ctx context.Context, tenantID, address string, enabled bool, threshold int) error
+	DeactivateWalletProfile(ctx context.Context, tenantID, address string) (bool, error)
+	CreateViewKey(ctx context.Context, k *models.ViewKey) error
+	GetViewKeyByHash(ctx context.Context, keyHash string) (*models.ViewKey, error)
+	ListViewKeys(ctx context.Context, tenantID, address string) ([]models.ViewKey, error)
+	RevokeViewKey(ctx context.Context, tenantID, address, id string, at time.Time) (bool, error)
+	CreateWalletHandle(ctx context.Context, h *models.WalletHandle) error
+	GetWalletHandle(ctx context.Context, handle string) (*models.WalletHandle, error)
+	GetWalletHandleByAddress(ctx context.Context, address string) (*models.WalletHandle, error)
+	UpdateWalletHandle(ctx context.Context, h *models.WalletHandle) (bool, error)
+
+	// zakat
+	SaveZakatRecord(ctx context.Context, zr *models.ZakatRecord) error
+	GetZakatRecord(ctx context.Context, id string) (*models.ZakatRecord, error)
+	ListZakatByWallet(ctx context.Context, address string) ([]models.ZakatRecord, error)
+	ListZakatByUser(ctx context.Context, userID string) ([]models.ZakatRecord, error)
+	ListZakatBetween(ctx context.Context, tenantID string, from, to time.Time) ([]models.ZakatRecord, error)
+	CreateZakatRun(ctx context.Context, run *models.ZakatRun, items []models.ZakatRunItem) error
+	GetZakatRun(ctx context.Context, id string) (*models.ZakatRun, error)
+	GetLatestFinishedZakatRun(ctx context.Context, tenantID string) (*models.ZakatRun, error)
+	UpdateZakatRun(ctx context.Context, run *models.ZakatRun) error
+	ListZakatRunItems(ctx context.Context, runID string) ([]models.ZakatRunItem, error)
+	UpdateZakatRunItem(ctx context.Context, item *models.ZakatRunItem) error
+	ListZakatPolicies(ctx context.Context, tenantID string) ([]models.ZakatPolicy, error)
+	GetZakatPolicy(ctx context.Context, tenantID string, version int) (*models.ZakatPolicy, error)
+	CreateZakatPolicy(ctx context.Context, p *models.ZakatPolicy) error
+
+	// beneficiaries
+	CreateBeneficiary(ctx context.Context, b *models.Beneficiary) error
+	GetBeneficiary(ctx context.Context, id string) (*models.Beneficiary, error)
+	UpdateBeneficiary(ctx context.Context, b *models.Beneficiary) error
+	ListBeneficiariesRanked(ctx context.Context, tenantID string, limit int) ([]models.Beneficiary, error)
+	ListBeneficiaries(ctx context.Context, tenantID, status, category string) ([]models.Beneficiary, error)
+	DeleteBeneficiary(ctx context.Context, id string) (bool, error)
+	CreateDisbursementAck(ctx context.Context, ack *models.DisbursementAck) (bool, error)
+	GetDisbursementAck(ctx context.Context, id string) (*models.DisbursementAck, error)
+	ListDisbursementAcks(ctx context.Context, tenantID string) ([]models.DisbursementAck, error)
+	CreateDisbursementTemplate(ctx context.Context, t *models.DisbursementTemplate) error
+	GetDisbursementTemplate(ctx context.Context, id string) (*models.DisbursementTemplate, error)
+	ListDisbursementTemplates(ctx context.Context, tenantID string) ([]models.DisbursementTemplate, error)
+	UpdateDisbursementTemplate(ctx context.Context, t *models.DisbursementTemplate) (bool, error)
+	DeleteDisbursementTemplate(ctx context.Context, id string) (bool, error)
+	CreateDisbursements(ctx context.Context, ds []models.Disbursement) error
+	ListDisbursements(ctx context.Context, tenantID, beneficiaryID string, limit int) ([]models.Disbursement, error)
+	CreatePayouts(ctx context.Context, ps []models.Payout) error
+	GetPayout(ctx context.Context, id string) (*models.Payout, error)
+	FindPayout(ctx context.Context, method, externalRef string) (*models.Payout, error)
+	ListPayouts(ctx context.Context, tenantID, status string, limit int) ([]models.Payout, error)
+	UpdatePayout(ctx context.Context, p *models.Payout) error
+	CreateColdTransfer(ctx context.Context, ct *models.ColdTransfer) error
+	GetColdTransfer(ctx context.Context, id string) (*models.ColdTransfer, error)
+	ListColdTransfers(ctx context.Context, status string, limit int) ([]models.ColdTransfer, error)
+	UpdateColdTransfer(ctx context.Context, ct *models.ColdTransfer, version int) (bool, error)
+
+	// campaigns
+	CreateCampaign(ctx context.Context, cp *models.Campaign) error
+	GetCampaign(ctx context.Context, id string) (*models.Campaign, error)
+	ListCampaigns(ctx context.Context, tenantID string, activeOnly bool) ([]models.Campaign, error)
+	UpdateCampaign(ctx context.Context, cp *models.Campaign) (bool, error)
+	CreatePledge(ctx context.Context, p *models.Pledge) error
+	GetPledge(ctx context.Context, id string) (*models.Pledge, error)
+	ListPledgesByUser(ctx context.Context, userID string) ([]models.Pledge, error)
+	ListPledgesByStatus(ctx context.Context, status string) ([]models.Pledge, error)
+	UpdatePledge(ctx context.Context, p *models.Pledge, fromStatus string) (bool, error)
+
+	// stealth addresses
+	CreateStealthRequest(ctx context.Context, sr *models.StealthPaymentRequest) error
+	ListStealthRequests(ctx context.Context, tenantID string) ([]models.StealthPaymentRequest, error)
+
+	// solvency proofs
+	CreateSolvencyEpoch(ctx context.Context, e *models.SolvencyEpoch) error
+	GetSolvencyEpoch(ctx context.Context, tenantID, id string) (*models.SolvencyEpoch, error)
+
+	// notifications
+	ListEmailTemplates(ctx context.Context, tenantID string) ([]models.EmailTemplate, error)
+	SaveEmailTemplate(ctx context.Context, t *models.EmailTemplate) error
+	CreateNotificationDelivery(ctx context.Context, d *models.NotificationDelivery) error
+	UpdateNotificationStatus(ctx context.Context, providerMessageID, status, errMsg string, at time.Time) (bool, error)
+	GetNotificationPreferences(ctx context.Context, userID string) (*models.NotificationPreferences, error)
+	SaveNotificationPreferences(ctx context.Context, p *models.NotificationPreferences) error
+	GetDigestSubscription(ctx context.Context, id string) (*models.DigestSubscription, error)
+	SaveDigestSubscription(ctx context.Context, sub *models.DigestSubscription) error
+	ListDigestSubscriptions(ctx context.Context) ([]models.DigestSubscription, error)
+	MarkDigestSent(ctx context.Context, id string, sentThrough, at time.Time) error
+
+	// digest statistics
+	CountUsersCreatedBetween(ctx context.Context, tenantID string, from, to time.Time) (int, error)
+	CountSystemLogsBetween(ctx context.Context, level string, from, to time.Time) (int, error)
+
+	// support
+	Search(ctx context.Context, tenantID, q string, limit int) (*SearchMatches, error)
+
+	// operations
+	LogSystemEvent(ctx context.Context, level, typ, message, ip string)
+	ListSystemLogs(ctx context.Context, limit int) ([]models.SystemLog, error)
+	CreateAPIAudit(ctx context.Context, a *models.APIAudit) error
+	ListAPIAudit(ctx context.Context, tenantID, userID, txid string, limit int) ([]models.APIAudit, error)
+	ListFeatureFlags(ctx context.Context, environment string) ([]models.FeatureFlag, error)
+	SaveFeatureFlag(ctx context.Context, f *models.FeatureFlag) error
+	WipeSandboxData(ctx context.Context) error
+
+	// distributed locks (see package lock)
+	AcquireLock(ctx context.Context, name, token string, ttl time.Duration) (bool, error)
+	ExtendLock(ctx context.Context, name, token string, ttl time.Duration) (bool, error)
+	ReleaseLock(ctx context.Context, name, token string) error
+}
+
+var _ Store = (*SupabaseClient)(nil)
@@ -6,8 +6,10 @@ import (
     "encoding/json"
     "fmt"
     "net/http"
+    "net/url"
     "os"
     "io"
+    "strings"
     "time"
    "wallet_backend_go/internal/models" 
     "wallet_backend_go/internal/blockchain"
@@ -19,27 +21,96 @@ const (
 	tableWalletProfiles = "wallet_profiles"
 	tableZakat          = "zakat_records"
 	tableSystemLogs     = "system_logs"
+	tableBeneficiaries  = "beneficiaries"
+	tableTenants        = "tenants"
+	tableZakatRuns      = "zakat_runs"
+	tableZakatRunItems  = "zakat_run_items"
+	tableBlocks         = "blocks"
+	tableTransactions   = "transactions"
+	tableSolvencyEpochs = "solvency_epochs"
+	tableTxNotes        = "transaction_notes"
+	tableEmailTemplates = "email_templates"
+	tableNotifications  = "notification_deliveries"
+	tableNotifyPrefs    = "notification_preferences"
+	tableZakatPolicies  = "zakat_policies"
+	tableFeatureFlags   = "feature_flags"
+	tableWebAuthnCreds  = "webauthn_credentials"
+	tableTxPINs         = "transaction_pins"
+	tableHeldTransfers  = "held_transfers"
+	tableReceiptAcks    = "disbursement_acknowledgements"
+	tableAPIAudit       = "api_audit"
+	tableStealthReqs    = "stealth_payment_requests"
+	tableViewKeys       = "wallet_view_keys"
+	tableTxReceipts     = "transaction_receipts"
+	tableCampaigns      = "campaigns"
+	tableDigestSubs     = "digest_subscriptions"
+	tablePledges        = "pledges"
+	tableDisbTemplates  = "disbursement_templates"
+	tableLocks          = "distributed_locks"
+	tableWalletHandles  = "wallet_handles"
+	tableInvitations    = "invitations"
+	tableDonationTags   = "donation_tags"
+	tableDeclarations   = "donation_declarations"
+	tableDisbursements  = "disbursements"
+	tableChainAnchors   = "chain_anchors"
+	tableIdempotency    = "idempotency_keys"
+	tableBridgeDeposits = "bridge_deposits"
+	tablePayouts        = "payouts"
+	tableColdTransfers  = "cold_transfers"
 )
+
+// tenantFilter returns a PostgREST filter restricting rows to the given
+// tenant, or an empty string when tenantID is empty (single-tenant mode).
+func tenantFilter(tenantID string) string {
+	if tenantID == "" {
+		return ""
+	}
+	return "&tenant_id=eq." + tenantID
+}
+
+// addressIn is the PostgREST filter matching a wallet address stored in
+// either address encoding (see blockchain.AddressForms), so wallets
+// stored under their legacy hex address are still found.
+func addressIn(address string) string {
+	forms := blockchain.AddressForms(address)
+	for i, f := range forms {
+		forms[i] = url.QueryEscape(f)
+	}
+	return "in.(" + strings.Join(forms, ",") + ")"
+}
 // SupabaseClient is a minimal client that only knows how to
-// talk to Supabase REST using the URL and API key.
+// talk to Supabase REST using the URL and API keys.
 type SupabaseClient struct {
-    URL string
-    Key string
+    URL     string
+    Key     string // service role key; see keys.go
+    AnonKey string // used for public reads; empty means Key
+
+    breaker *breaker     // see breaker.go; nil disables it
+    pii     *fieldCipher // see pii.go; nil stores personal data in plaintext
 }
 
-// NewSupabaseClient reads SUPABASE_URL and SUPABASE_KEY from the
-// environment and returns a SupabaseClient.
+// NewSupabaseClient reads SUPABASE_URL and the keys (SUPABASE_SERVICE_KEY,
+// SUPABASE_ANON_KEY, or the legacy SUPABASE_KEY) from the environment
+// and returns a SupabaseClient.
 func NewSupabaseClient() (*SupabaseClient, error) {
     url := os.Getenv("SUPABASE_URL")
-    key := os.Getenv("SUPABASE_KEY")
+    key, anon := supabaseKeys()
 
     if url == "" || key == "" {
-        return nil, fmt.Errorf("SUPABASE_URL or SUPABASE_KEY is not set")
+        return nil, fmt.Errorf("SUPABASE_URL or SUPABASE_SERVICE_KEY is not set")
+    }
+
+    pii, err := loadFieldCipher()
+    if err != nil {
+        return nil, err
     }
 
     return &SupabaseClient{
-        URL: url,
-        Key: key,
+        URL:     url,
+        Key:     key,
+        AnonKey: anon,
+        breaker: newBreaker(),
+        pii:     pii,
     }, nil
 }
 
@@ -60,49 +131,11 @@ func (s *SupabaseClient) SaveBlock(ctx context.Context, height int, block *block
         return fmt.Errorf("Supabase client is nil")
     }
 
-    // Serialize full block to JSON for explorer/details
-    raw, err := json.Marshal(block)
-    if err != nil {
-        return fmt.Errorf("marshal block: %w", err)
-    }
-
-    rec := BlockRecord{
-        Hash:      fmt.Sprintf("%x", block.Hash),
-        Height:    height,
-        Timestamp: block.Timestamp,
-        PrevHash:  fmt.Sprintf("%x", block.PrevHash),
-        TxCount:   len(block.Transactions),
-        RawJSON:   raw,
-    }
-
-    payload, err := json.Marshal([]BlockRecord{rec}) // Supabase expects an array
+    rec, err := NewBlockRecord(height, block)
     if err != nil {
-        return fmt.Errorf("marshal payload: %w", err)
+        return err
     }
-
-    url := fmt.Sprintf("%s/rest/v1/blocks", s.URL)
-
-    req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
-    if err != nil {
-        return fmt.Errorf("new request: %w", err)
-    }
-
-    req.Header.Set("apikey", s.Key)
-    req.Header.Set("Authorization", "Bearer "+s.Key)
-    req.Header.Set("Content-Type", "application/json")
-    req.Header.Set("Prefer", "return=minimal")
-
-    resp, err := http.DefaultClient.Do(req)
-    if err != nil {
-        return fmt.Errorf("do request: %w", err)
-    }
-    defer resp.Body.Close()
-
-    if resp.StatusCode >= 300 {
-        return fmt.Errorf("supabase insert failed: %s", resp.Status)
-    }
-
-    return nil
+    return s.InsertBlocks(ctx, []BlockRecord{rec})
 }
 
 
@@ -134,50 +167,11 @@ func (s *SupabaseClient) SaveTransaction(
         return fmt.Errorf("Supabase client is nil")
     }
 
-    raw, err := json.Marshal(tx)
-    if err != nil {
-        return fmt.Errorf("marshal tx: %w", err)
-    }
-
-    rec := TransactionRecord{
-        TxID:      fmt.Sprintf("%x", tx.ID),
-        BlockHash: blockHash,
-        Sender:    sender,
-        Receiver:  receiver,
-        Amount:    amount,
-        Timestamp: time.Now().Unix(),
-        Type:      txType,
-        RawJSON:   raw,
-    }
-
-    payload, err := json.Marshal([]TransactionRecord{rec}) // Supabase expects an array
-    if err != nil {
-        return fmt.Errorf("marshal payload: %w", err)
-    }
-
-    url := fmt.Sprintf("%s/rest/v1/transactions", s.URL)
-
-    req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
-    if err != nil {
-        return fmt.Errorf("new request: %w", err)
-    }
-
-    req.Header.Set("apikey", s.Key)
-    req.Header.Set("Authorization", "Bearer "+s.Key)
-    req.Header.Set("Content-Type", "application/json")
-    req.Header.Set("Prefer", "return=minimal")
-
-    resp, err := http.DefaultClient.Do(req)
+    rec, err := NewTransactionRecord(blockHash, tx, sender, receiver, amount, txType)
     if err != nil {
-        return fmt.Errorf("do request: %w", err)
-    }
-    defer resp.Body.Close()
-
-    if resp.StatusCode >= 300 {
-        return fmt.Errorf("supabase tx insert failed: %s", resp.Status)
+        return err
     }
-
-    return nil
+    return s.InsertTransactions(ctx, []TransactionRecord{rec})
 }
 
 // CreateUser inserts a new user row.
@@ -186,7 +180,11 @@ func (c *SupabaseClient) CreateUser(ctx context.Context, user *models.User) erro
 		return nil // no-op if Supabase not configured
 	}
 
-	payload, err := json.Marshal(user)
+	row, err := c.sealUser(user)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(row)
 	if err != nil {
 		return err
 	}
@@ -199,13 +197,12 @@ func (c *SupabaseClient) CreateUser(ctx context.Context, user *models.User) erro
 		return err
 	}
 
-	req.Header.Set("apikey", c.Key)
-	req.Header.Set("Authorization", "Bearer "+c.Key)
+	c.authorize(req)
 	req.Header.Set("Content-Type", "application/json")
 	// Prefer: return inserted object
 	req.Header.Set("Prefer", "return=minimal")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.send(req, "CreateUser")
 	if err != nil {
 		return err
 	}
@@ -223,7 +220,11 @@ func (c *SupabaseClient) CreateWalletProfile(ctx context.Context, wp *models.Wal
 		return nil
 	}
 
-	payload, err := json.Marshal(wp)
+	row, err := c.sealWalletProfile(wp)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(row)
 	if err != nil {
 		return err
 	}
@@ -236,12 +237,11 @@ func (c *SupabaseClient) CreateWalletProfile(ctx context.Context, wp *models.Wal
 		return err
 	}
 
-	req.Header.Set("apikey", c.Key)
-	req.Header.Set("Authorization", "Bearer "+c.Key)
+	c.authorize(req)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Prefer", "return=minimal")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.send(req, "CreateWalletProfile")
 	if err != nil {
 		return err
 	}
@@ -280,12 +280,14 @@ func (c *SupabaseClient) LogSystemEvent(ctx context.Context, level, typ, message
 		return
 	}
 
-	req.Header.Set("apikey", c.Key)
-	req.Header.Set("Authorization", "Bearer "+c.Key)
+	c.authorize(req)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Prefer", "return=minimal")
 
-	_, _ = http.DefaultClient.Do(req) // fire-and-forget
+	// fire-and-forget
+	if resp, err := c.send(req, "LogSystemEvent"); err == nil {
+		resp.Body.Close()
+	}
 }
 
 // SaveZakatRecord inserts zakat deduction info.
@@ -307,12 +309,11 @@ func (c *SupabaseClient) SaveZakatRecord(ctx context.Context, zr *models.ZakatRe
 		return err
 	}
 
-	req.Header.Set("apikey", c.Key)
-	req.Header.Set("Authorization", "Bearer "+c.Key)
+	c.authorize(req)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Prefer", "return=minimal")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.send(req, "SaveZakatRecord")
 	if err != nil {
 		return err
 	}
@@ -331,18 +332,17 @@ func (c *SupabaseClient) ListZakatByWallet(ctx context.Context, address string)
         return nil, fmt.Errorf("supabase client is nil")
     }
 
-    url := fmt.Sprintf("%s/rest/v1/%s?select=*&wallet_address=eq.%s", c.URL, tableZakat, address)
+    url := fmt.Sprintf("%s/rest/v1/%s?select=*&wallet_address=%s", c.URL, tableZakat, addressIn(address))
 
     req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
     if err != nil {
         return nil, err
     }
 
-    req.Header.Set("apikey", c.Key)
-    req.Header.Set("Authorization", "Bearer "+c.Key)
+    c.authorize(req)
     req.Header.Set("Accept", "application/json")
 
-    resp, err := http.DefaultClient.Do(req)
+    resp, err := c.send(req, "ListZakatByWallet")
     if err != nil {
         return nil, err
     }
@@ -376,11 +376,10 @@ func (c *SupabaseClient) ListSystemLogs(ctx context.Context, limit int) ([]model
         return nil, err
     }
 
-    req.Header.Set("apikey", c.Key)
-    req.Header.Set("Authorization", "Bearer "+c.Key)
+    c.authorize(req)
     req.Header.Set("Accept", "application/json")
 
-    resp, err := http.DefaultClient.Do(req)
+    resp, err := c.send(req, "ListSystemLogs")
     if err != nil {
         return nil, err
     }
@@ -408,18 +407,17 @@ func (c *SupabaseClient) ListTransactionsByWallet(ctx context.Context, address s
     }
 
     // PostgREST OR filter: sender == address OR receiver == address
-    url := fmt.Sprintf("%s/rest/v1/transactions?select=*&or=(sender.eq.%s,receiver.eq.%s)", c.URL, address, address)
+    url := fmt.Sprintf("%s/rest/v1/transactions?select=*&or=(sender.%s,receiver.%s)", c.URL, addressIn(address), addressIn(address))
 
     req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
     if err != nil {
         return nil, err
     }
 
-    req.Header.Set("apikey", c.Key)
-    req.Header.Set("Authorization", "Bearer "+c.Key)
+    c.authorize(req)
     req.Header.Set("Accept", "application/json")
 
-    resp, err := http.DefaultClient.Do(req)
+    resp, err := c.send(req, "ListTransactionsByWallet")
     if err != nil {
         return nil, err
     }
@@ -440,25 +438,28 @@ func (c *SupabaseClient) ListTransactionsByWallet(ctx context.Context, address s
 
 
 
-// ListWalletProfiles fetches all wallet_profiles from Supabase.
-func (c *SupabaseClient) ListWalletProfiles(ctx context.Context) ([]models.WalletProfile, error) {
+// ListWalletProfiles fetches the active wallet_profiles of a tenant from
+// Supabase. An empty tenantID returns every tenant's profiles.
+// Deactivated wallets are filtered out; rows created before the status
+// column existed (status is null) count as active.
+func (c *SupabaseClient) ListWalletProfiles(ctx context.Context, tenantID string) ([]models.WalletProfile, error) {
     if c == nil {
         return nil, fmt.Errorf("supabase client is nil")
     }
 
     // Basic: select all columns from wallet_profiles
-    url := fmt.Sprintf("%s/rest/v1/%s?select=*", c.URL, tableWalletProfiles)
+    url := fmt.Sprintf("%s/rest/v1/%s?select=*&or=(status.is.null,status.neq.%s)%s",
+        c.URL, tableWalletProfiles, models.WalletStatusDeactivated, tenantFilter(tenantID))
 
     req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
     if err != nil {
         return nil, err
     }
 
-    req.Header.Set("apikey", c.Key)
-    req.Header.Set("Authorization", "Bearer "+c.Key)
+    c.authorize(req)
     req.Header.Set("Accept", "application/json")
 
-    resp, err := http.DefaultClient.Do(req)
+    resp, err := c.send(req, "ListWalletProfiles")
     if err != nil {
         return nil, err
     }
@@ -473,6 +474,2984 @@ func (c *SupabaseClient) ListWalletProfiles(ctx context.Context) ([]models.Walle
     if err := json.NewDecoder(resp.Body).Decode(&profiles); err != nil {
         return nil, err
     }
+    if err := c.openWalletProfiles(profiles); err != nil {
+        return nil, err
+    }
 
     return profiles, nil
 }
+
+
+// newRequest builds a PostgREST request for the given path (relative
+// to /rest/v1/) with the standard Supabase auth headers set. A non-nil
+// body is JSON encoded.
+func (c *SupabaseClient) newRequest(ctx context.Context, method, path string, body interface{}) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("marshal payload: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/rest/v1/%s", c.URL, path), reader)
+	if err != nil {
+		return nil, err
+	}
+
+	c.authorize(req)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// do executes req and decodes the JSON response into out (if non-nil).
+// op names the calling method in error messages.
+func (c *SupabaseClient) do(req *http.Request, op string, out interface{}) error {
+	resp, err := c.send(req, op)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("supabase %s error: %s - %s", op, resp.Status, string(body))
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// GetWalletProfileByAddress returns the wallet profile owning the given
+// address, or nil if no profile exists.
+func (c *SupabaseClient) GetWalletProfileByAddress(ctx context.Context, address string) (*models.WalletProfile, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&wallet_address=%s&limit=1", tableWalletProfiles, addressIn(address)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []models.WalletProfile
+	if err := c.do(req, "GetWalletProfileByAddress", &profiles); err != nil {
+		return nil, err
+	}
+	if len(profiles) == 0 {
+		return nil, nil
+	}
+	if err := c.openWalletProfiles(profiles); err != nil {
+		return nil, err
+	}
+	return &profiles[0], nil
+}
+
+// UpdateWalletAutoZakat stores the "pay zakat as you earn" settings
+// for a wallet profile.
+func (c *SupabaseClient) UpdateWalletAutoZakat(ctx context.Context, tenantID, address string, enabled bool, threshold int) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	patch := map[string]interface{}{
+		"auto_zakat":           enabled,
+		"auto_zakat_threshold": threshold,
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?wallet_address=%s%s", tableWalletProfiles, addressIn(address), tenantFilter(tenantID)), patch)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+
+	return c.do(req, "UpdateWalletAutoZakat", nil)
+}
+
+// CreateBeneficiary inserts a beneficiary row.
+func (c *SupabaseClient) CreateBeneficiary(ctx context.Context, b *models.Beneficiary) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableBeneficiaries, b)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+
+	return c.do(req, "CreateBeneficiary", nil)
+}
+
+// GetBeneficiary returns a beneficiary by id, or nil if it does not exist.
+func (c *SupabaseClient) GetBeneficiary(ctx context.Context, id string) (*models.Beneficiary, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&id=eq.%s&limit=1", tableBeneficiaries, id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Beneficiary
+	if err := c.do(req, "GetBeneficiary", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// UpdateBeneficiary overwrites a beneficiary row identified by b.ID.
+func (c *SupabaseClient) UpdateBeneficiary(ctx context.Context, b *models.Beneficiary) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s", tableBeneficiaries, b.ID), b)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+
+	return c.do(req, "UpdateBeneficiary", nil)
+}
+
+// ListBeneficiariesRanked returns a tenant's beneficiaries ordered by
+// needs score, highest first. A limit of zero returns all rows.
+func (c *SupabaseClient) ListBeneficiariesRanked(ctx context.Context, tenantID string, limit int) ([]models.Beneficiary, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	path := fmt.Sprintf("%s?select=*&order=needs_score.desc,created_at.asc%s", tableBeneficiaries, tenantFilter(tenantID))
+	if limit > 0 {
+		path += fmt.Sprintf("&limit=%d", limit)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Beneficiary
+	if err := c.do(req, "ListBeneficiariesRanked", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ListBeneficiaries returns a tenant's beneficiaries, oldest first,
+// optionally only those with the given status and category. Rows
+// stored before beneficiaries had a status count as pending.
+func (c *SupabaseClient) ListBeneficiaries(ctx context.Context, tenantID, status, category string) ([]models.Beneficiary, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	path := fmt.Sprintf("%s?select=*&order=created_at.asc%s", tableBeneficiaries, tenantFilter(tenantID))
+	switch status {
+	case "":
+	case "pending":
+		path += "&or=(status.eq.pending,status.is.null,status.eq.)"
+	default:
+		path += "&status=eq." + url.QueryEscape(status)
+	}
+	if category != "" {
+		path += "&category=eq." + url.QueryEscape(category)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Beneficiary
+	if err := c.do(req, "ListBeneficiaries", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// DeleteBeneficiary removes a beneficiary. It returns false if no
+// matching beneficiary exists.
+func (c *SupabaseClient) DeleteBeneficiary(ctx context.Context, id string) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodDelete,
+		fmt.Sprintf("%s?id=eq.%s", tableBeneficiaries, url.QueryEscape(id)), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "return=representation")
+
+	var rows []models.Beneficiary
+	if err := c.do(req, "DeleteBeneficiary", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// CreateTenant inserts a tenant (organization) row.
+func (c *SupabaseClient) CreateTenant(ctx context.Context, t *models.Tenant) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableTenants, t)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+
+	return c.do(req, "CreateTenant", nil)
+}
+
+// GetTenant returns a tenant by id, or nil if it does not exist.
+func (c *SupabaseClient) GetTenant(ctx context.Context, id string) (*models.Tenant, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&id=eq.%s&limit=1", tableTenants, id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Tenant
+	if err := c.do(req, "GetTenant", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// ListTenants returns all tenants.
+func (c *SupabaseClient) ListTenants(ctx context.Context) ([]models.Tenant, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, tableTenants+"?select=*&order=created_at.asc", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Tenant
+	if err := c.do(req, "ListTenants", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// SetUserRole changes the role of a user within a tenant. It returns
+// false if no matching user exists.
+func (c *SupabaseClient) SetUserRole(ctx context.Context, tenantID, userID, role string) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s%s", tableUsers, userID, tenantFilter(tenantID)),
+		map[string]string{"role": role})
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "return=representation")
+
+	var rows []models.User
+	if err := c.do(req, "SetUserRole", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// DeactivateWalletProfile marks a wallet profile as deactivated. It
+// returns false if no matching profile exists.
+func (c *SupabaseClient) DeactivateWalletProfile(ctx context.Context, tenantID, address string) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	now := time.Now().UTC()
+	patch := map[string]interface{}{
+		"status":         models.WalletStatusDeactivated,
+		"deactivated_at": now,
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?wallet_address=%s%s", tableWalletProfiles, addressIn(address), tenantFilter(tenantID)), patch)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "return=representation")
+
+	var rows []models.WalletProfile
+	if err := c.do(req, "DeactivateWalletProfile", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// CreateZakatRun inserts a zakat run together with its per-wallet items.
+func (c *SupabaseClient) CreateZakatRun(ctx context.Context, run *models.ZakatRun, items []models.ZakatRunItem) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableZakatRuns, run)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	if err := c.do(req, "CreateZakatRun", nil); err != nil {
+		return err
+	}
+
+	if len(items) == 0 {
+		return nil
+	}
+
+	req, err = c.newRequest(ctx, http.MethodPost, tableZakatRunItems, items) // PostgREST accepts arrays
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateZakatRunItems", nil)
+}
+
+// GetZakatRun returns a zakat run by id, or nil if it does not exist.
+func (c *SupabaseClient) GetZakatRun(ctx context.Context, id string) (*models.ZakatRun, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&id=eq.%s&limit=1", tableZakatRuns, id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.ZakatRun
+	if err := c.do(req, "GetZakatRun", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// UpdateZakatRun overwrites a zakat run row identified by run.ID.
+func (c *SupabaseClient) UpdateZakatRun(ctx context.Context, run *models.ZakatRun) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s", tableZakatRuns, run.ID), run)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+
+	return c.do(req, "UpdateZakatRun", nil)
+}
+
+// ListZakatRunItems returns the per-wallet items of a zakat run.
+func (c *SupabaseClient) ListZakatRunItems(ctx context.Context, runID string) ([]models.ZakatRunItem, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&run_id=eq.%s&order=wallet_address.asc", tableZakatRunItems, runID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.ZakatRunItem
+	if err := c.do(req, "ListZakatRunItems", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// UpdateZakatRunItem overwrites a zakat run item identified by item.ID.
+func (c *SupabaseClient) UpdateZakatRunItem(ctx context.Context, item *models.ZakatRunItem) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s", tableZakatRunItems, item.ID), item)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+
+	return c.do(req, "UpdateZakatRunItem", nil)
+}
+
+// ListWalletProfilesByUser returns every wallet profile of a user,
+// including deactivated ones.
+func (c *SupabaseClient) ListWalletProfilesByUser(ctx context.Context, userID string) ([]models.WalletProfile, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&user_id=eq.%s&order=created_at.asc", tableWalletProfiles, userID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.WalletProfile
+	if err := c.do(req, "ListWalletProfilesByUser", &rows); err != nil {
+		return nil, err
+	}
+	if err := c.openWalletProfiles(rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ListZakatByUser returns all zakat_records of a user across wallets,
+// newest first.
+func (c *SupabaseClient) ListZakatByUser(ctx context.Context, userID string) ([]models.ZakatRecord, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&user_id=eq.%s&order=created_at.desc", tableZakat, userID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.ZakatRecord
+	if err := c.do(req, "ListZakatByUser", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ListBlockHashes returns the set of block hashes stored in Supabase.
+func (c *SupabaseClient) ListBlockHashes(ctx context.Context) (map[string]bool, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, tableBlocks+"?select=hash", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Hash string `json:"hash"`
+	}
+	if err := c.do(req, "ListBlockHashes", &rows); err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[string]bool, len(rows))
+	for _, r := range rows {
+		hashes[r.Hash] = true
+	}
+	return hashes, nil
+}
+
+// ListBlocks returns up to limit blocks from height fromHeight on,
+// lowest first.
+func (c *SupabaseClient) ListBlocks(ctx context.Context, fromHeight, limit int) ([]BlockRecord, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&height=gte.%d&order=height.asc&limit=%d", tableBlocks, fromHeight, limit), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []BlockRecord
+	if err := c.do(req, "ListBlocks", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// QueryBlocks returns the page of mirrored blocks q selects by
+// timestamp, in height order. Types does not apply to blocks.
+func (c *SupabaseClient) QueryBlocks(ctx context.Context, q blockchain.ListQuery) ([]BlockRecord, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, tableBlocks+"?select=*"+listQueryFilter(q, "height"), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []BlockRecord
+	if err := c.do(req, "QueryBlocks", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// QueryTransactionsByWallet returns the page of transactions where the
+// wallet is the sender or the receiver that q selects by timestamp and
+// type, in time order.
+func (c *SupabaseClient) QueryTransactionsByWallet(ctx context.Context, address string, q blockchain.ListQuery) ([]TransactionRecord, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	path := fmt.Sprintf("%s?select=*&or=(sender.%s,receiver.%s)", tableTransactions, addressIn(address), addressIn(address))
+	if len(q.Types) > 0 {
+		types := make([]string, len(q.Types))
+		for i, t := range q.Types {
+			types[i] = url.QueryEscape(t)
+		}
+		path += "&type=in.(" + strings.Join(types, ",") + ")"
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, path+listQueryFilter(q, "timestamp"), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []TransactionRecord
+	if err := c.do(req, "QueryTransactionsByWallet", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// listQueryFilter returns the PostgREST filters for q's time range,
+// order (by column) and page.
+func listQueryFilter(q blockchain.ListQuery, order string) string {
+	var f strings.Builder
+	if q.Since != 0 {
+		fmt.Fprintf(&f, "&timestamp=gte.%d", q.Since)
+	}
+	if q.Until != 0 {
+		fmt.Fprintf(&f, "&timestamp=lt.%d", q.Until)
+	}
+	if q.Desc {
+		fmt.Fprintf(&f, "&order=%s.desc", order)
+	} else {
+		fmt.Fprintf(&f, "&order=%s.asc", order)
+	}
+	if q.Offset > 0 {
+		fmt.Fprintf(&f, "&offset=%d", q.Offset)
+	}
+	if q.Limit > 0 {
+		fmt.Fprintf(&f, "&limit=%d", q.Limit)
+	}
+	return f.String()
+}
+
+// ListTransactionIDs returns the set of txids stored in Supabase.
+func (c *SupabaseClient) ListTransactionIDs(ctx context.Context) (map[string]bool, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, tableTransactions+"?select=txid", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		TxID string `json:"txid"`
+	}
+	if err := c.do(req, "ListTransactionIDs", &rows); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool, len(rows))
+	for _, r := range rows {
+		ids[r.TxID] = true
+	}
+	return ids, nil
+}
+
+// DropBlocks removes blocks a reorg took off the chain: their rows,
+// the rows of their transactions (fee records included) and the zakat
+// records of the deductions they mined, and the receipts of
+// revertedTxIDs, the transactions the new chain does not carry.
+func (c *SupabaseClient) DropBlocks(ctx context.Context, blockHashes, revertedTxIDs []string) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+	if len(blockHashes) == 0 {
+		return nil
+	}
+
+	hashes := "in.(" + strings.Join(blockHashes, ",") + ")"
+	paths := []string{
+		tableTransactions + "?block_hash=" + hashes,
+		tableZakat + "?block_hash=" + hashes,
+		tableBlocks + "?hash=" + hashes,
+	}
+	if len(revertedTxIDs) > 0 {
+		paths = append(paths, tableTxReceipts+"?txid=in.("+strings.Join(revertedTxIDs, ",")+")")
+	}
+	for _, path := range paths {
+		req, err := c.newRequest(ctx, http.MethodDelete, path, nil)
+		if err != nil {
+			return err
+		}
+		if err := c.do(req, "DropBlocks", nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetZakatRecord returns the zakat record with the given id, or nil.
+func (c *SupabaseClient) GetZakatRecord(ctx context.Context, id string) (*models.ZakatRecord, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&id=eq.%s&limit=1", tableZakat, id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.ZakatRecord
+	if err := c.do(req, "GetZakatRecord", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// ListZakatBetween returns the zakat records of a tenant created in
+// [from, to), oldest first.
+func (c *SupabaseClient) ListZakatBetween(ctx context.Context, tenantID string, from, to time.Time) ([]models.ZakatRecord, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	path := fmt.Sprintf("%s?select=*&created_at=gte.%s&created_at=lt.%s&order=created_at.asc%s",
+		tableZakat, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339), tenantFilter(tenantID))
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.ZakatRecord
+	if err := c.do(req, "ListZakatBetween", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// GetLatestFinishedZakatRun returns the most recent completed or partial
+// zakat run of a tenant, or nil if there is none.
+func (c *SupabaseClient) GetLatestFinishedZakatRun(ctx context.Context, tenantID string) (*models.ZakatRun, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	path := fmt.Sprintf("%s?select=*&status=in.(completed,partial)&order=started_at.desc&limit=1%s",
+		tableZakatRuns, tenantFilter(tenantID))
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.ZakatRun
+	if err := c.do(req, "GetLatestFinishedZakatRun", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// CreateSolvencyEpoch inserts a solvency epoch.
+func (c *SupabaseClient) CreateSolvencyEpoch(ctx context.Context, e *models.SolvencyEpoch) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableSolvencyEpochs, e)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateSolvencyEpoch", nil)
+}
+
+// GetSolvencyEpoch returns the epoch with the given id, or the latest
+// epoch of the tenant when id is "latest". It returns nil if none exists.
+func (c *SupabaseClient) GetSolvencyEpoch(ctx context.Context, tenantID, id string) (*models.SolvencyEpoch, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	path := fmt.Sprintf("%s?select=*&id=eq.%s&limit=1", tableSolvencyEpochs, id)
+	if id == "latest" {
+		path = fmt.Sprintf("%s?select=*&order=created_at.desc&limit=1%s", tableSolvencyEpochs, tenantFilter(tenantID))
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.SolvencyEpoch
+	if err := c.do(req, "GetSolvencyEpoch", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// GetTransactionRecord returns the transactions row with the given txid,
+// or nil if it does not exist.
+func (c *SupabaseClient) GetTransactionRecord(ctx context.Context, txid string) (*TransactionRecord, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&txid=eq.%s&limit=1", tableTransactions, txid), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []TransactionRecord
+	if err := c.do(req, "GetTransactionRecord", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// SetTransactionComplianceStatus records the current compliance status
+// on the transactions row.
+func (c *SupabaseClient) SetTransactionComplianceStatus(ctx context.Context, txid, status string) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?txid=eq.%s", tableTransactions, txid),
+		map[string]string{"compliance_status": status})
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "SetTransactionComplianceStatus", nil)
+}
+
+// SetTransactionReceiver rewrites the receiver of the transactions row,
+// for the address migration of the admin rebuild.
+func (c *SupabaseClient) SetTransactionReceiver(ctx context.Context, txid, receiver string) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?txid=eq.%s", tableTransactions, txid),
+		map[string]string{"receiver": receiver})
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "SetTransactionReceiver", nil)
+}
+
+// CreateTransactionNote appends a compliance note.
+func (c *SupabaseClient) CreateTransactionNote(ctx context.Context, n *models.TransactionNote) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableTxNotes, n)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateTransactionNote", nil)
+}
+
+// ListTransactionNotes returns the tenant's notes on a transaction,
+// oldest first.
+func (c *SupabaseClient) ListTransactionNotes(ctx context.Context, tenantID, txid string) ([]models.TransactionNote, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&txid=eq.%s&order=created_at.asc%s", tableTxNotes, txid, tenantFilter(tenantID)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.TransactionNote
+	if err := c.do(req, "ListTransactionNotes", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// UpdateTenantBranding replaces the email branding variables of a
+// tenant. It returns false if the tenant does not exist.
+func (c *SupabaseClient) UpdateTenantBranding(ctx context.Context, id string, branding map[string]string) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s", tableTenants, id),
+		map[string]interface{}{"branding": branding})
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "return=representation")
+
+	var rows []models.Tenant
+	if err := c.do(req, "UpdateTenantBranding", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// ListEmailTemplates returns the template overrides of a tenant. An
+// empty tenantID returns the unscoped overrides.
+func (c *SupabaseClient) ListEmailTemplates(ctx context.Context, tenantID string) ([]models.EmailTemplate, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	filter := tenantFilter(tenantID)
+	if tenantID == "" {
+		filter = "&tenant_id=is.null"
+	}
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&order=name.asc%s", tableEmailTemplates, filter), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.EmailTemplate
+	if err := c.do(req, "ListEmailTemplates", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// SaveEmailTemplate inserts or replaces a template override.
+func (c *SupabaseClient) SaveEmailTemplate(ctx context.Context, t *models.EmailTemplate) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableEmailTemplates+"?on_conflict=id", t)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "resolution=merge-duplicates,return=minimal")
+	return c.do(req, "SaveEmailTemplate", nil)
+}
+
+// GetUser returns a user by id, or nil if it does not exist.
+func (c *SupabaseClient) GetUser(ctx context.Context, id string) (*models.User, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&id=eq.%s&limit=1", tableUsers, id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.User
+	if err := c.do(req, "GetUser", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	if err := c.openUser(&rows[0]); err != nil {
+		return nil, err
+	}
+	return &rows[0], nil
+}
+
+// GetUserByEmail returns the user registered with email in the tenant,
+// or nil if there is none.
+func (c *SupabaseClient) GetUserByEmail(ctx context.Context, tenantID, email string) (*models.User, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&%s%s&limit=1", tableUsers, c.emailFilter(email), tenantFilter(tenantID)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.User
+	if err := c.do(req, "GetUserByEmail", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	if err := c.openUser(&rows[0]); err != nil {
+		return nil, err
+	}
+	return &rows[0], nil
+}
+
+// CreateNotificationDelivery records a sent notification.
+func (c *SupabaseClient) CreateNotificationDelivery(ctx context.Context, d *models.NotificationDelivery) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableNotifications, d)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateNotificationDelivery", nil)
+}
+
+// UpdateNotificationStatus sets the status of the delivery with the
+// given provider message id. It returns false if no delivery matches.
+func (c *SupabaseClient) UpdateNotificationStatus(ctx context.Context, providerMessageID, status, errMsg string, at time.Time) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	body := map[string]interface{}{"status": status, "updated_at": at}
+	if errMsg != "" {
+		body["error"] = errMsg
+	}
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?provider_message_id=eq.%s", tableNotifications, url.QueryEscape(providerMessageID)), body)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "return=representation")
+
+	var rows []models.NotificationDelivery
+	if err := c.do(req, "UpdateNotificationStatus", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// GetNotificationPreferences returns the stored preferences of a user,
+// or nil if they never set any.
+func (c *SupabaseClient) GetNotificationPreferences(ctx context.Context, userID string) (*models.NotificationPreferences, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&user_id=eq.%s&limit=1", tableNotifyPrefs, userID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.NotificationPreferences
+	if err := c.do(req, "GetNotificationPreferences", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// SaveNotificationPreferences inserts or replaces a user's preferences.
+func (c *SupabaseClient) SaveNotificationPreferences(ctx context.Context, p *models.NotificationPreferences) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableNotifyPrefs+"?on_conflict=user_id", p)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "resolution=merge-duplicates,return=minimal")
+	return c.do(req, "SaveNotificationPreferences", nil)
+}
+
+// zakatPolicyTenantFilter restricts zakat policies to a tenant. Unlike
+// tenantFilter, the unscoped deployment has policies of its own (rows
+// without a tenant) rather than seeing every tenant's.
+func zakatPolicyTenantFilter(tenantID string) string {
+	if tenantID == "" {
+		return "&tenant_id=is.null"
+	}
+	return tenantFilter(tenantID)
+}
+
+// ListZakatPolicies returns every policy version of a tenant, newest first.
+func (c *SupabaseClient) ListZakatPolicies(ctx context.Context, tenantID string) ([]models.ZakatPolicy, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	path := fmt.Sprintf("%s?select=*&order=version.desc%s", tableZakatPolicies, zakatPolicyTenantFilter(tenantID))
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.ZakatPolicy
+	if err := c.do(req, "ListZakatPolicies", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// GetZakatPolicy returns version of a tenant's zakat policy, or the
+// latest version when version is 0. It returns nil if there is none.
+func (c *SupabaseClient) GetZakatPolicy(ctx context.Context, tenantID string, version int) (*models.ZakatPolicy, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	path := fmt.Sprintf("%s?select=*&order=version.desc&limit=1%s", tableZakatPolicies, zakatPolicyTenantFilter(tenantID))
+	if version > 0 {
+		path += fmt.Sprintf("&version=eq.%d", version)
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.ZakatPolicy
+	if err := c.do(req, "GetZakatPolicy", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// CreateZakatPolicy inserts a new policy version. A unique
+// (tenant_id, version) constraint rejects concurrent writers racing for
+// the same version.
+func (c *SupabaseClient) CreateZakatPolicy(ctx context.Context, p *models.ZakatPolicy) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableZakatPolicies, p)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateZakatPolicy", nil)
+}
+
+// ListFeatureFlags returns every stored flag of an environment, for all
+// tenants.
+func (c *SupabaseClient) ListFeatureFlags(ctx context.Context, environment string) ([]models.FeatureFlag, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&environment=eq.%s&order=key.asc", tableFeatureFlags, url.QueryEscape(environment)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.FeatureFlag
+	if err := c.do(req, "ListFeatureFlags", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// SaveFeatureFlag inserts or replaces a flag.
+func (c *SupabaseClient) SaveFeatureFlag(ctx context.Context, f *models.FeatureFlag) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableFeatureFlags+"?on_conflict=id", f)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "resolution=merge-duplicates,return=minimal")
+	return c.do(req, "SaveFeatureFlag", nil)
+}
+
+// sandboxWipeOrder lists the tables emptied by WipeSandboxData, children
+// before parents, with a column that is never null on any row.
+var sandboxWipeOrder = []struct{ table, key string }{
+	{tableZakatRunItems, "id"},
+	{tableWebAuthnCreds, "id"},
+	{tableTxPINs, "user_id"},
+	{tableHeldTransfers, "id"},
+	{tableInvitations, "id"},
+	{tableReceiptAcks, "id"},
+	{tableIdempotency, "key"},
+	{tablePayouts, "id"},
+	{tableColdTransfers, "id"},
+	{tableDisbursements, "id"},
+	{tableStealthReqs, "id"},
+	{tableViewKeys, "id"},
+	{tableWalletHandles, "id"},
+	{tableTxReceipts, "txid"},
+	{tableBridgeDeposits, "id"},
+	{tableDonationTags, "txid"},
+	{tableDeclarations, "id"},
+	{tablePledges, "id"},
+	{tableCampaigns, "id"},
+	{tableDigestSubs, "id"},
+	{tableDisbTemplates, "id"},
+	{tableZakatRuns, "id"},
+	{tableZakat, "id"},
+	{tableNotifications, "id"},
+	{tableNotifyPrefs, "user_id"},
+	{tableTxNotes, "id"},
+	{tableSolvencyEpochs, "id"},
+	{tableEmailTemplates, "id"},
+	{tableZakatPolicies, "id"},
+	{tableFeatureFlags, "id"},
+	{tableWalletProfiles, "id"},
+	{tableBeneficiaries, "id"},
+	{tableUsers, "id"},
+	{tableTransactions, "txid"},
+	{tableChainAnchors, "id"},
+	{tableBlocks, "hash"},
+	{tableTenants, "id"},
+}
+
+// WipeSandboxData deletes every row of the application tables except
+// the logs, system_logs and api_audit. It is only meant for sandbox
+// deployments, which are re-seeded with fixtures afterwards.
+func (c *SupabaseClient) WipeSandboxData(ctx context.Context) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	for _, t := range sandboxWipeOrder {
+		// PostgREST refuses unfiltered deletes
+		req, err := c.newRequest(ctx, http.MethodDelete, fmt.Sprintf("%s?%s=not.is.null", t.table, t.key), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Prefer", "return=minimal")
+		if err := c.do(req, "WipeSandboxData "+t.table, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateWebAuthnCredential stores a newly registered passkey.
+func (c *SupabaseClient) CreateWebAuthnCredential(ctx context.Context, cred *models.WebAuthnCredential) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableWebAuthnCreds, cred)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateWebAuthnCredential", nil)
+}
+
+// GetWebAuthnCredential returns a passkey by credential id, or nil if
+// it is not registered.
+func (c *SupabaseClient) GetWebAuthnCredential(ctx context.Context, id string) (*models.WebAuthnCredential, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&id=eq.%s&limit=1", tableWebAuthnCreds, url.QueryEscape(id)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.WebAuthnCredential
+	if err := c.do(req, "GetWebAuthnCredential", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// ListWebAuthnCredentials returns the passkeys of a user, oldest first.
+func (c *SupabaseClient) ListWebAuthnCredentials(ctx context.Context, userID string) ([]models.WebAuthnCredential, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&user_id=eq.%s&order=created_at.asc", tableWebAuthnCreds, userID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.WebAuthnCredential
+	if err := c.do(req, "ListWebAuthnCredentials", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// UpdateWebAuthnCredentialUsage records a successful login with a
+// passkey.
+func (c *SupabaseClient) UpdateWebAuthnCredentialUsage(ctx context.Context, id string, signCount uint32, at time.Time) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	patch := map[string]interface{}{"sign_count": signCount, "last_used_at": at}
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s", tableWebAuthnCreds, url.QueryEscape(id)), patch)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "UpdateWebAuthnCredentialUsage", nil)
+}
+
+// GetTransactionPIN returns the transaction PIN of a user, or nil if
+// they have not set one.
+func (c *SupabaseClient) GetTransactionPIN(ctx context.Context, userID string) (*models.TransactionPIN, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&user_id=eq.%s&limit=1", tableTxPINs, url.QueryEscape(userID)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.TransactionPIN
+	if err := c.do(req, "GetTransactionPIN", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// SaveTransactionPIN inserts or replaces the transaction PIN of a user.
+func (c *SupabaseClient) SaveTransactionPIN(ctx context.Context, pin *models.TransactionPIN) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableTxPINs+"?on_conflict=user_id", pin)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "resolution=merge-duplicates,return=minimal")
+	return c.do(req, "SaveTransactionPIN", nil)
+}
+
+// UpdateTransactionPINAttempts records the failed attempt count and
+// lockout of a transaction PIN.
+func (c *SupabaseClient) UpdateTransactionPINAttempts(ctx context.Context, userID string, failedAttempts int, lockedUntil *time.Time) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	patch := map[string]interface{}{"failed_attempts": failedAttempts, "locked_until": lockedUntil}
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?user_id=eq.%s", tableTxPINs, url.QueryEscape(userID)), patch)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "UpdateTransactionPINAttempts", nil)
+}
+
+// DeleteTransactionPIN removes the transaction PIN of a user.
+func (c *SupabaseClient) DeleteTransactionPIN(ctx context.Context, userID string) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodDelete,
+		fmt.Sprintf("%s?user_id=eq.%s", tableTxPINs, url.QueryEscape(userID)), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "DeleteTransactionPIN", nil)
+}
+
+// CreateHeldTransfer inserts a transfer held for cooling-off.
+func (c *SupabaseClient) CreateHeldTransfer(ctx context.Context, ht *models.HeldTransfer) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableHeldTransfers, ht)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateHeldTransfer", nil)
+}
+
+// GetHeldTransfer returns a held transfer by id, or nil if it does not
+// exist.
+func (c *SupabaseClient) GetHeldTransfer(ctx context.Context, id string) (*models.HeldTransfer, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&id=eq.%s&limit=1", tableHeldTransfers, url.QueryEscape(id)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.HeldTransfer
+	if err := c.do(req, "GetHeldTransfer", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// ListHeldTransfers returns the held transfers with the given status,
+// earliest release first.
+func (c *SupabaseClient) ListHeldTransfers(ctx context.Context, status string) ([]models.HeldTransfer, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&status=eq.%s&order=release_at.asc", tableHeldTransfers, url.QueryEscape(status)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.HeldTransfer
+	if err := c.do(req, "ListHeldTransfers", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ResolveHeldTransfer writes the status, resolution time, block hash
+// and error of ht, provided the stored transfer still has fromStatus.
+// It returns false when another request or instance resolved it first.
+func (c *SupabaseClient) ResolveHeldTransfer(ctx context.Context, ht *models.HeldTransfer, fromStatus string) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	patch := map[string]interface{}{
+		"status":      ht.Status,
+		"resolved_at": ht.ResolvedAt,
+		"block_hash":  ht.BlockHash,
+		"error":       ht.Error,
+	}
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s&status=eq.%s", tableHeldTransfers, url.QueryEscape(ht.ID), url.QueryEscape(fromStatus)), patch)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "return=representation")
+
+	var rows []models.HeldTransfer
+	if err := c.do(req, "ResolveHeldTransfer", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// CreateInvitation stores an invitation; its escrow key is encrypted
+// like wallet keys.
+func (c *SupabaseClient) CreateInvitation(ctx context.Context, inv *models.Invitation) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	row, err := c.sealInvitation(inv)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, tableInvitations, row)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateInvitation", nil)
+}
+
+// GetInvitation returns an invitation by id, or nil if it does not
+// exist.
+func (c *SupabaseClient) GetInvitation(ctx context.Context, id string) (*models.Invitation, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&id=eq.%s&limit=1", tableInvitations, url.QueryEscape(id)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Invitation
+	if err := c.do(req, "GetInvitation", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	if err := c.openInvitations(rows); err != nil {
+		return nil, err
+	}
+	return &rows[0], nil
+}
+
+// ListInvitationsBySender returns the invitations a user sent, newest
+// first.
+func (c *SupabaseClient) ListInvitationsBySender(ctx context.Context, userID string) ([]models.Invitation, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&sender_user_id=eq.%s&order=created_at.desc", tableInvitations, url.QueryEscape(userID)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Invitation
+	if err := c.do(req, "ListInvitationsBySender", &rows); err != nil {
+		return nil, err
+	}
+	if err := c.openInvitations(rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ListPendingInvitations returns the pending invitations, oldest
+// first. A non-empty contactHash restricts them to one contact within
+// the tenant.
+func (c *SupabaseClient) ListPendingInvitations(ctx context.Context, tenantID, contactHash string) ([]models.Invitation, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	path := fmt.Sprintf("%s?select=*&status=eq.%s&order=created_at.asc", tableInvitations, models.InvitationPending)
+	if contactHash != "" {
+		path += "&contact_hash=eq." + url.QueryEscape(contactHash) + tenantFilter(tenantID)
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Invitation
+	if err := c.do(req, "ListPendingInvitations", &rows); err != nil {
+		return nil, err
+	}
+	if err := c.openInvitations(rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ResolveInvitation writes the outcome of inv provided the stored
+// invitation still has fromStatus, and reports whether it did.
+func (c *SupabaseClient) ResolveInvitation(ctx context.Context, inv *models.Invitation, fromStatus string) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	patch := map[string]interface{}{
+		"status":      inv.Status,
+		"to_address":  inv.ToAddress,
+		"payout_txid": inv.PayoutTxID,
+		"last_error":  inv.LastError,
+		"resolved_at": inv.ResolvedAt,
+	}
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s&status=eq.%s", tableInvitations, url.QueryEscape(inv.ID), url.QueryEscape(fromStatus)), patch)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "return=representation")
+
+	var rows []models.Invitation
+	if err := c.do(req, "ResolveInvitation", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// CreateDisbursementAck stores a receipt acknowledgement. It returns
+// false when the disbursement was already acknowledged.
+func (c *SupabaseClient) CreateDisbursementAck(ctx context.Context, ack *models.DisbursementAck) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableReceiptAcks+"?on_conflict=id", ack)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "resolution=ignore-duplicates,return=representation")
+
+	var rows []models.DisbursementAck
+	if err := c.do(req, "CreateDisbursementAck", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// GetDisbursementAck returns the acknowledgement with the given id, or
+// nil if the disbursement has not been acknowledged.
+func (c *SupabaseClient) GetDisbursementAck(ctx context.Context, id string) (*models.DisbursementAck, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&id=eq.%s&limit=1", tableReceiptAcks, url.QueryEscape(id)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.DisbursementAck
+	if err := c.do(req, "GetDisbursementAck", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// ListDisbursementAcks returns a tenant's acknowledgements, oldest
+// first.
+func (c *SupabaseClient) ListDisbursementAcks(ctx context.Context, tenantID string) ([]models.DisbursementAck, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&order=acknowledged_at.asc%s", tableReceiptAcks, tenantFilter(tenantID)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.DisbursementAck
+	if err := c.do(req, "ListDisbursementAcks", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// CreateAPIAudit stores the audit record of an API request.
+func (c *SupabaseClient) CreateAPIAudit(ctx context.Context, a *models.APIAudit) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableAPIAudit, a)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateAPIAudit", nil)
+}
+
+// ListAPIAudit returns up to limit audit records of a tenant, newest
+// first, made by userID or referencing txid (either may be empty).
+func (c *SupabaseClient) ListAPIAudit(ctx context.Context, tenantID, userID, txid string, limit int) ([]models.APIAudit, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	query := fmt.Sprintf("%s?select=*&order=created_at.desc&limit=%d%s", tableAPIAudit, limit, tenantFilter(tenantID))
+	if userID != "" {
+		query += "&user_id=eq." + url.QueryEscape(userID)
+	}
+	if txid != "" {
+		query += "&txids=cs." + url.QueryEscape("{"+txid+"}")
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.APIAudit
+	if err := c.do(req, "ListAPIAudit", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// CreateStealthRequest stores a stealth payment request.
+func (c *SupabaseClient) CreateStealthRequest(ctx context.Context, sr *models.StealthPaymentRequest) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableStealthReqs, sr)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateStealthRequest", nil)
+}
+
+// ListStealthRequests returns a tenant's stealth payment requests,
+// oldest first.
+func (c *SupabaseClient) ListStealthRequests(ctx context.Context, tenantID string) ([]models.StealthPaymentRequest, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&order=created_at.asc%s", tableStealthReqs, tenantFilter(tenantID)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.StealthPaymentRequest
+	if err := c.do(req, "ListStealthRequests", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// CreateViewKey stores a wallet view key.
+func (c *SupabaseClient) CreateViewKey(ctx context.Context, k *models.ViewKey) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableViewKeys, k)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateViewKey", nil)
+}
+
+// GetViewKeyByHash returns the view key with the given SHA-256, or nil
+// if there is none.
+func (c *SupabaseClient) GetViewKeyByHash(ctx context.Context, keyHash string) (*models.ViewKey, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&key_hash=eq.%s&limit=1", tableViewKeys, url.QueryEscape(keyHash)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.ViewKey
+	if err := c.do(req, "GetViewKeyByHash", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// ListViewKeys returns the view keys issued for a wallet, newest first.
+func (c *SupabaseClient) ListViewKeys(ctx context.Context, tenantID, address string) ([]models.ViewKey, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&wallet_address=%s&order=created_at.desc%s",
+			tableViewKeys, addressIn(address), tenantFilter(tenantID)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.ViewKey
+	if err := c.do(req, "ListViewKeys", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// RevokeViewKey revokes a wallet's view key at the given time. It
+// reports whether an unrevoked key matched.
+func (c *SupabaseClient) RevokeViewKey(ctx context.Context, tenantID, address, id string, at time.Time) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s&wallet_address=%s&revoked_at=is.null%s",
+			tableViewKeys, url.QueryEscape(id), addressIn(address), tenantFilter(tenantID)),
+		map[string]interface{}{"revoked_at": at})
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "return=representation")
+
+	var rows []models.ViewKey
+	if err := c.do(req, "RevokeViewKey", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// CreateWalletHandle stores a claimed wallet handle.
+func (c *SupabaseClient) CreateWalletHandle(ctx context.Context, h *models.WalletHandle) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableWalletHandles, h)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateWalletHandle", nil)
+}
+
+// GetWalletHandle returns the newest row of a handle, active or
+// released, or nil if the handle was never claimed.
+func (c *SupabaseClient) GetWalletHandle(ctx context.Context, handle string) (*models.WalletHandle, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&handle=eq.%s&order=created_at.desc&limit=1", tableWalletHandles, url.QueryEscape(handle)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.WalletHandle
+	if err := c.do(req, "GetWalletHandle", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// GetWalletHandleByAddress returns the active handle of a wallet, or
+// nil if it has none.
+func (c *SupabaseClient) GetWalletHandleByAddress(ctx context.Context, address string) (*models.WalletHandle, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&wallet_address=%s&status=eq.%s&limit=1",
+			tableWalletHandles, addressIn(address), models.HandleActive), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.WalletHandle
+	if err := c.do(req, "GetWalletHandleByAddress", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// UpdateWalletHandle moves or releases an active handle. It reports
+// whether the row was still active.
+func (c *SupabaseClient) UpdateWalletHandle(ctx context.Context, h *models.WalletHandle) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	patch := map[string]interface{}{
+		"wallet_address": h.WalletAddress,
+		"status":         h.Status,
+		"updated_at":     h.UpdatedAt,
+		"released_at":    h.ReleasedAt,
+	}
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s&status=eq.%s", tableWalletHandles, url.QueryEscape(h.ID), models.HandleActive), patch)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "return=representation")
+
+	var rows []models.WalletHandle
+	if err := c.do(req, "UpdateWalletHandle", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// SaveDonationTag creates or replaces the tag of a transaction.
+func (c *SupabaseClient) SaveDonationTag(ctx context.Context, t *models.DonationTag) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableDonationTags+"?on_conflict=txid", t)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "resolution=merge-duplicates,return=minimal")
+	return c.do(req, "SaveDonationTag", nil)
+}
+
+// ListDonationTags returns the tags a user set on transfers mined in
+// [from, to), oldest first.
+func (c *SupabaseClient) ListDonationTags(ctx context.Context, userID string, from, to time.Time) ([]models.DonationTag, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&user_id=eq.%s&mined_at=gte.%s&mined_at=lt.%s&order=mined_at.asc",
+			tableDonationTags, url.QueryEscape(userID), from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.DonationTag
+	if err := c.do(req, "ListDonationTags", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// CreateDonationDeclaration inserts a declaration.
+func (c *SupabaseClient) CreateDonationDeclaration(ctx context.Context, d *models.DonationDeclaration) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	row, err := c.sealDeclaration(d)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, tableDeclarations, row)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateDonationDeclaration", nil)
+}
+
+// GetDonationDeclaration returns the latest declaration of a
+// transaction, or nil if it has none.
+func (c *SupabaseClient) GetDonationDeclaration(ctx context.Context, txid string) (*models.DonationDeclaration, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&txid=eq.%s&order=created_at.desc&limit=1", tableDeclarations, url.QueryEscape(txid)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.DonationDeclaration
+	if err := c.do(req, "GetDonationDeclaration", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	if err := c.openDeclarations(rows); err != nil {
+		return nil, err
+	}
+	return &rows[0], nil
+}
+
+// WithdrawDonationDeclaration marks the declaration of a transaction
+// withdrawn at the given time. It reports false when there is no
+// declaration still in force.
+func (c *SupabaseClient) WithdrawDonationDeclaration(ctx context.Context, txid string, at time.Time) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?txid=eq.%s&withdrawn_at=is.null", tableDeclarations, url.QueryEscape(txid)),
+		map[string]interface{}{"withdrawn_at": at})
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "return=representation")
+
+	var rows []models.DonationDeclaration
+	if err := c.do(req, "WithdrawDonationDeclaration", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// ListDonationDeclarations returns a charity's declarations in force
+// for donations made in [from, to), oldest first.
+func (c *SupabaseClient) ListDonationDeclarations(ctx context.Context, tenantID string, from, to time.Time) ([]models.DonationDeclaration, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&withdrawn_at=is.null&donated_at=gte.%s&donated_at=lt.%s&order=donated_at.asc%s",
+			tableDeclarations, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339), tenantFilter(tenantID)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.DonationDeclaration
+	if err := c.do(req, "ListDonationDeclarations", &rows); err != nil {
+		return nil, err
+	}
+	if err := c.openDeclarations(rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// CreateTransactionReceipt stores the receipt of a mined send.
+func (c *SupabaseClient) CreateTransactionReceipt(ctx context.Context, rc *models.TransactionReceipt) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableTxReceipts, rc)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateTransactionReceipt", nil)
+}
+
+// GetTransactionReceipt returns the receipt of the transaction with the
+// given txid, or nil if there is none.
+func (c *SupabaseClient) GetTransactionReceipt(ctx context.Context, tenantID, txid string) (*models.TransactionReceipt, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&txid=eq.%s%s&limit=1", tableTxReceipts, url.QueryEscape(txid), tenantFilter(tenantID)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.TransactionReceipt
+	if err := c.do(req, "GetTransactionReceipt", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// UpdateTenantProfile sets the public profile of a tenant. It returns
+// false if the tenant does not exist.
+func (c *SupabaseClient) UpdateTenantProfile(ctx context.Context, id, description, category string, verified bool) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s", tableTenants, url.QueryEscape(id)),
+		map[string]interface{}{"description": description, "category": category, "verified": verified})
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "return=representation")
+
+	var rows []models.Tenant
+	if err := c.do(req, "UpdateTenantProfile", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// CreateCampaign stores a campaign.
+func (c *SupabaseClient) CreateCampaign(ctx context.Context, cp *models.Campaign) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableCampaigns, cp)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateCampaign", nil)
+}
+
+// GetCampaign returns the campaign with the given id, or nil if there
+// is none.
+func (c *SupabaseClient) GetCampaign(ctx context.Context, id string) (*models.Campaign, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&id=eq.%s&limit=1", tableCampaigns, url.QueryEscape(id)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Campaign
+	if err := c.do(req, "GetCampaign", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// ListCampaigns returns the campaigns of a tenant (all tenants when
+// tenantID is empty), newest first, optionally only the active ones.
+func (c *SupabaseClient) ListCampaigns(ctx context.Context, tenantID string, activeOnly bool) ([]models.Campaign, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	filter := tenantFilter(tenantID)
+	if activeOnly {
+		filter += "&active=is.true"
+	}
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&order=created_at.desc%s", tableCampaigns, filter), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Campaign
+	if err := c.do(req, "ListCampaigns", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// UpdateCampaign replaces the editable fields of a campaign. It returns
+// false if no matching campaign exists.
+func (c *SupabaseClient) UpdateCampaign(ctx context.Context, cp *models.Campaign) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s", tableCampaigns, url.QueryEscape(cp.ID)),
+		map[string]interface{}{
+			"name":        cp.Name,
+			"description": cp.Description,
+			"category":    cp.Category,
+			"goal_amount": cp.GoalAmount,
+			"active":      cp.Active,
+			"ends_at":     cp.EndsAt,
+		})
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "return=representation")
+
+	var rows []models.Campaign
+	if err := c.do(req, "UpdateCampaign", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// GetDigestSubscription returns a digest subscription by id, or nil if
+// it does not exist.
+func (c *SupabaseClient) GetDigestSubscription(ctx context.Context, id string) (*models.DigestSubscription, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&id=eq.%s&limit=1", tableDigestSubs, url.QueryEscape(id)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.DigestSubscription
+	if err := c.do(req, "GetDigestSubscription", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// SaveDigestSubscription creates or replaces a digest subscription.
+func (c *SupabaseClient) SaveDigestSubscription(ctx context.Context, sub *models.DigestSubscription) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableDigestSubs+"?on_conflict=id", sub)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "resolution=merge-duplicates,return=minimal")
+	return c.do(req, "SaveDigestSubscription", nil)
+}
+
+// ListDigestSubscriptions returns the active digest subscriptions of
+// every tenant.
+func (c *SupabaseClient) ListDigestSubscriptions(ctx context.Context) ([]models.DigestSubscription, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&active=is.true&order=id.asc", tableDigestSubs), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.DigestSubscription
+	if err := c.do(req, "ListDigestSubscriptions", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// MarkDigestSent records that the digest of the period ending at
+// sentThrough was sent at at.
+func (c *SupabaseClient) MarkDigestSent(ctx context.Context, id string, sentThrough, at time.Time) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s", tableDigestSubs, url.QueryEscape(id)),
+		map[string]interface{}{"sent_through": sentThrough.UTC(), "last_sent_at": at.UTC()})
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "MarkDigestSent", nil)
+}
+
+// CountUsersCreatedBetween counts the tenant's users registered in
+// [from, to).
+func (c *SupabaseClient) CountUsersCreatedBetween(ctx context.Context, tenantID string, from, to time.Time) (int, error) {
+	if c == nil {
+		return 0, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=id&created_at=gte.%s&created_at=lt.%s%s",
+			tableUsers, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339), tenantFilter(tenantID)), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var rows []struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(req, "CountUsersCreatedBetween", &rows); err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// CountSystemLogsBetween counts the system log entries of level logged
+// in [from, to).
+func (c *SupabaseClient) CountSystemLogsBetween(ctx context.Context, level string, from, to time.Time) (int, error) {
+	if c == nil {
+		return 0, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=id&level=eq.%s&timestamp=gte.%s&timestamp=lt.%s",
+			tableSystemLogs, url.QueryEscape(level), from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339)), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var rows []struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(req, "CountSystemLogsBetween", &rows); err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// CreatePledge stores a new pledge.
+func (c *SupabaseClient) CreatePledge(ctx context.Context, p *models.Pledge) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tablePledges, p)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreatePledge", nil)
+}
+
+// GetPledge returns a pledge by id, or nil if it does not exist.
+func (c *SupabaseClient) GetPledge(ctx context.Context, id string) (*models.Pledge, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&id=eq.%s&limit=1", tablePledges, url.QueryEscape(id)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Pledge
+	if err := c.do(req, "GetPledge", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// ListPledgesByUser returns a user's pledges, newest first.
+func (c *SupabaseClient) ListPledgesByUser(ctx context.Context, userID string) ([]models.Pledge, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&user_id=eq.%s&order=created_at.desc", tablePledges, url.QueryEscape(userID)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Pledge
+	if err := c.do(req, "ListPledgesByUser", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ListPledgesByStatus returns the pledges in a status, earliest due
+// first.
+func (c *SupabaseClient) ListPledgesByStatus(ctx context.Context, status string) ([]models.Pledge, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&status=eq.%s&order=due_date.asc", tablePledges, url.QueryEscape(status)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Pledge
+	if err := c.do(req, "ListPledgesByStatus", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// UpdatePledge writes the progress of a pledge if it is still in
+// fromStatus, and reports whether it was.
+func (c *SupabaseClient) UpdatePledge(ctx context.Context, p *models.Pledge, fromStatus string) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	patch := map[string]interface{}{
+		"status":          p.Status,
+		"attempts":        p.Attempts,
+		"last_attempt_at": p.LastAttemptAt,
+		"last_error":      p.LastError,
+		"reminded_at":     p.RemindedAt,
+		"txid":            p.TxID,
+		"block_hash":      p.BlockHash,
+		"fulfilled_at":    p.FulfilledAt,
+	}
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s&status=eq.%s", tablePledges, url.QueryEscape(p.ID), url.QueryEscape(fromStatus)), patch)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "return=representation")
+
+	var rows []models.Pledge
+	if err := c.do(req, "UpdatePledge", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// CreateDisbursementTemplate stores a disbursement template.
+func (c *SupabaseClient) CreateDisbursementTemplate(ctx context.Context, t *models.DisbursementTemplate) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableDisbTemplates, t)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateDisbursementTemplate", nil)
+}
+
+// GetDisbursementTemplate returns the template with the given id, or
+// nil if there is none.
+func (c *SupabaseClient) GetDisbursementTemplate(ctx context.Context, id string) (*models.DisbursementTemplate, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&id=eq.%s&limit=1", tableDisbTemplates, url.QueryEscape(id)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.DisbursementTemplate
+	if err := c.do(req, "GetDisbursementTemplate", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// ListDisbursementTemplates returns the templates of a tenant (all
+// tenants when tenantID is empty) by name.
+func (c *SupabaseClient) ListDisbursementTemplates(ctx context.Context, tenantID string) ([]models.DisbursementTemplate, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&order=name.asc%s", tableDisbTemplates, tenantFilter(tenantID)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.DisbursementTemplate
+	if err := c.do(req, "ListDisbursementTemplates", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// UpdateDisbursementTemplate replaces the name and shares of a
+// template. It returns false if no matching template exists.
+func (c *SupabaseClient) UpdateDisbursementTemplate(ctx context.Context, t *models.DisbursementTemplate) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s", tableDisbTemplates, url.QueryEscape(t.ID)),
+		map[string]interface{}{
+			"name":       t.Name,
+			"shares":     t.Shares,
+			"updated_at": t.UpdatedAt,
+		})
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "return=representation")
+
+	var rows []models.DisbursementTemplate
+	if err := c.do(req, "UpdateDisbursementTemplate", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// DeleteDisbursementTemplate removes a template. It returns false if no
+// matching template exists.
+func (c *SupabaseClient) DeleteDisbursementTemplate(ctx context.Context, id string) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodDelete,
+		fmt.Sprintf("%s?id=eq.%s", tableDisbTemplates, url.QueryEscape(id)), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "return=representation")
+
+	var rows []models.DisbursementTemplate
+	if err := c.do(req, "DeleteDisbursementTemplate", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// CreateDisbursements stores the parts of a distribution in one
+// request.
+func (c *SupabaseClient) CreateDisbursements(ctx context.Context, ds []models.Disbursement) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+	if len(ds) == 0 {
+		return nil
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableDisbursements, ds)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateDisbursements", nil)
+}
+
+// ListDisbursements returns a tenant's disbursements, newest first,
+// optionally only those to one beneficiary. A limit of zero returns
+// all rows.
+func (c *SupabaseClient) ListDisbursements(ctx context.Context, tenantID, beneficiaryID string, limit int) ([]models.Disbursement, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	path := fmt.Sprintf("%s?select=*&order=created_at.desc,wallet_address.asc%s", tableDisbursements, tenantFilter(tenantID))
+	if beneficiaryID != "" {
+		path += "&beneficiary_id=eq." + url.QueryEscape(beneficiaryID)
+	}
+	if limit > 0 {
+		path += fmt.Sprintf("&limit=%d", limit)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Disbursement
+	if err := c.do(req, "ListDisbursements", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// CreatePayouts stores the external payouts of a distribution in one
+// request.
+func (c *SupabaseClient) CreatePayouts(ctx context.Context, ps []models.Payout) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+	if len(ps) == 0 {
+		return nil
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tablePayouts, ps)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreatePayouts", nil)
+}
+
+// GetPayout returns the payout with the given id, or nil.
+func (c *SupabaseClient) GetPayout(ctx context.Context, id string) (*models.Payout, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&id=eq.%s&limit=1", tablePayouts, url.QueryEscape(id)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Payout
+	if err := c.do(req, "GetPayout", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// FindPayout returns the payout the provider of method knows as
+// externalRef, or nil.
+func (c *SupabaseClient) FindPayout(ctx context.Context, method, externalRef string) (*models.Payout, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&method=eq.%s&external_ref=eq.%s&limit=1", tablePayouts, url.QueryEscape(method), url.QueryEscape(externalRef)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Payout
+	if err := c.do(req, "FindPayout", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// ListPayouts returns a tenant's payouts, oldest first, optionally only
+// those with the given status. A limit of zero returns all rows.
+func (c *SupabaseClient) ListPayouts(ctx context.Context, tenantID, status string, limit int) ([]models.Payout, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	path := fmt.Sprintf("%s?select=*&order=created_at.asc,id.asc%s", tablePayouts, tenantFilter(tenantID))
+	if status != "" {
+		path += "&status=eq." + url.QueryEscape(status)
+	}
+	if limit > 0 {
+		path += fmt.Sprintf("&limit=%d", limit)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Payout
+	if err := c.do(req, "ListPayouts", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// UpdatePayout overwrites a payout row identified by p.ID.
+func (c *SupabaseClient) UpdatePayout(ctx context.Context, p *models.Payout) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s", tablePayouts, url.QueryEscape(p.ID)), p)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "UpdatePayout", nil)
+}
+
+// CreateColdTransfer inserts a cold-to-hot transfer request.
+func (c *SupabaseClient) CreateColdTransfer(ctx context.Context, ct *models.ColdTransfer) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableColdTransfers, ct)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateColdTransfer", nil)
+}
+
+// GetColdTransfer returns the cold transfer with the given id, or nil.
+func (c *SupabaseClient) GetColdTransfer(ctx context.Context, id string) (*models.ColdTransfer, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&id=eq.%s&limit=1", tableColdTransfers, url.QueryEscape(id)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.ColdTransfer
+	if err := c.do(req, "GetColdTransfer", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// ListColdTransfers returns the cold transfers, newest first,
+// optionally only those with the given status. A limit of zero returns
+// all rows.
+func (c *SupabaseClient) ListColdTransfers(ctx context.Context, status string, limit int) ([]models.ColdTransfer, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	path := fmt.Sprintf("%s?select=*&order=created_at.desc,id.asc", tableColdTransfers)
+	if status != "" {
+		path += "&status=eq." + url.QueryEscape(status)
+	}
+	if limit > 0 {
+		path += fmt.Sprintf("&limit=%d", limit)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.ColdTransfer
+	if err := c.do(req, "ListColdTransfers", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// UpdateColdTransfer overwrites the cold transfer ct.ID, provided the
+// stored row is still at version. It returns false when another
+// request or instance updated it first.
+func (c *SupabaseClient) UpdateColdTransfer(ctx context.Context, ct *models.ColdTransfer, version int) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s&version=eq.%d", tableColdTransfers, url.QueryEscape(ct.ID), version), ct)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "return=representation")
+
+	var rows []models.ColdTransfer
+	if err := c.do(req, "UpdateColdTransfer", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// SaveIdempotencyKey inserts the outcome of a request made with an
+// idempotency key, replacing an earlier one under the same scope and
+// key (which has expired, or it would have been replayed).
+func (c *SupabaseClient) SaveIdempotencyKey(ctx context.Context, k *models.IdempotencyKey) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableIdempotency+"?on_conflict=scope,key", k)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "resolution=merge-duplicates,return=minimal")
+	return c.do(req, "SaveIdempotencyKey", nil)
+}
+
+// GetIdempotencyKey returns the stored outcome of key under scope, or
+// nil. Expired outcomes are returned too.
+func (c *SupabaseClient) GetIdempotencyKey(ctx context.Context, scope, key string) (*models.IdempotencyKey, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&scope=eq.%s&key=eq.%s&limit=1", tableIdempotency, url.QueryEscape(scope), url.QueryEscape(key)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.IdempotencyKey
+	if err := c.do(req, "GetIdempotencyKey", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// CreateChainAnchor inserts an anchor of the chain.
+func (c *SupabaseClient) CreateChainAnchor(ctx context.Context, a *models.ChainAnchor) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableChainAnchors, a)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateChainAnchor", nil)
+}
+
+// GetChainAnchor returns the anchor with the given id, or nil.
+func (c *SupabaseClient) GetChainAnchor(ctx context.Context, id string) (*models.ChainAnchor, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&id=eq.%s&limit=1", tableChainAnchors, url.QueryEscape(id)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.ChainAnchor
+	if err := c.do(req, "GetChainAnchor", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// ListChainAnchors returns anchors of the chain, newest first,
+// optionally only those with the given status. A limit of zero returns
+// all rows.
+func (c *SupabaseClient) ListChainAnchors(ctx context.Context, status string, limit int) ([]models.ChainAnchor, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	path := tableChainAnchors + "?select=*&order=created_at.desc"
+	if status != "" {
+		path += "&status=eq." + url.QueryEscape(status)
+	}
+	if limit > 0 {
+		path += fmt.Sprintf("&limit=%d", limit)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.ChainAnchor
+	if err := c.do(req, "ListChainAnchors", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// UpdateChainAnchor overwrites an anchor row identified by a.ID.
+func (c *SupabaseClient) UpdateChainAnchor(ctx context.Context, a *models.ChainAnchor) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s", tableChainAnchors, url.QueryEscape(a.ID)), a)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "UpdateChainAnchor", nil)
+}
+
+// CreateBridgeDeposit inserts a deposit made on another chain.
+func (c *SupabaseClient) CreateBridgeDeposit(ctx context.Context, d *models.BridgeDeposit) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, tableBridgeDeposits, d)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "CreateBridgeDeposit", nil)
+}
+
+// GetBridgeDeposit returns the deposit with the given ref, or nil.
+func (c *SupabaseClient) GetBridgeDeposit(ctx context.Context, id string) (*models.BridgeDeposit, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s?select=*&id=eq.%s&limit=1", tableBridgeDeposits, url.QueryEscape(id)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.BridgeDeposit
+	if err := c.do(req, "GetBridgeDeposit", &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// ListBridgeDeposits returns a tenant's deposits made on other chains,
+// newest first, optionally only those of a campaign or with the given
+// status. A limit of zero returns all rows.
+func (c *SupabaseClient) ListBridgeDeposits(ctx context.Context, tenantID, campaignID, status string, limit int) ([]models.BridgeDeposit, error) {
+	if c == nil {
+		return nil, fmt.Errorf("supabase client is nil")
+	}
+
+	path := fmt.Sprintf("%s?select=*&order=detected_at.desc%s", tableBridgeDeposits, tenantFilter(tenantID))
+	if campaignID != "" {
+		path += "&campaign_id=eq." + url.QueryEscape(campaignID)
+	}
+	if status != "" {
+		path += "&status=eq." + url.QueryEscape(status)
+	}
+	if limit > 0 {
+		path += fmt.Sprintf("&limit=%d", limit)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.BridgeDeposit
+	if err := c.do(req, "ListBridgeDeposits", &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// UpdateBridgeDeposit overwrites a deposit row identified by d.ID.
+func (c *SupabaseClient) UpdateBridgeDeposit(ctx context.Context, d *models.BridgeDeposit) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?id=eq.%s", tableBridgeDeposits, url.QueryEscape(d.ID)), d)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "UpdateBridgeDeposit", nil)
+}
+
+// AcquireLock takes the lease on the lock name for token: it inserts
+// the lock's row, or takes over the row if its lease has expired. It
+// reports false while another token holds an unexpired lease.
+func (c *SupabaseClient) AcquireLock(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	now := time.Now().UTC()
+	lease := &models.DistributedLock{Name: name, Token: token, ExpiresAt: now.Add(ttl)}
+
+	// take over an expired lease
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?name=eq.%s&expires_at=lt.%s", tableLocks, url.QueryEscape(name), url.QueryEscape(now.Format(time.RFC3339Nano))),
+		map[string]interface{}{"token": lease.Token, "expires_at": lease.ExpiresAt})
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "return=representation")
+	var rows []models.DistributedLock
+	if err := c.do(req, "AcquireLock", &rows); err != nil {
+		return false, err
+	}
+	if len(rows) > 0 {
+		return true, nil
+	}
+
+	// or create the lock; the primary key admits one holder
+	req, err = c.newRequest(ctx, http.MethodPost, tableLocks+"?on_conflict=name", lease)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "resolution=ignore-duplicates,return=representation")
+	if err := c.do(req, "AcquireLock", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// ExtendLock renews the lease token holds on the lock name. It reports
+// false if token no longer holds it.
+func (c *SupabaseClient) ExtendLock(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("supabase client is nil")
+	}
+
+	now := time.Now().UTC()
+	req, err := c.newRequest(ctx, http.MethodPatch,
+		fmt.Sprintf("%s?name=eq.%s&token=eq.%s&expires_at=gt.%s", tableLocks,
+			url.QueryEscape(name), url.QueryEscape(token), url.QueryEscape(now.Format(time.RFC3339Nano))),
+		map[string]interface{}{"expires_at": now.Add(ttl)})
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Prefer", "return=representation")
+
+	var rows []models.DistributedLock
+	if err := c.do(req, "ExtendLock", &rows); err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// ReleaseLock deletes the lease token holds on the lock name, if any.
+func (c *SupabaseClient) ReleaseLock(ctx context.Context, name, token string) error {
+	if c == nil {
+		return fmt.Errorf("supabase client is nil")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodDelete,
+		fmt.Sprintf("%s?name=eq.%s&token=eq.%s", tableLocks, url.QueryEscape(name), url.QueryEscape(token)), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=minimal")
+	return c.do(req, "ReleaseLock", nil)
+}
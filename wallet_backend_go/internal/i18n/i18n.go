@@ -0,0 +1,493 @@
+// Package i18n localizes API messages and formats fiat amounts for the
+// languages supported by the wallet backend. Messages are looked up by
+// their English text, so untranslated strings fall back to English.
+package i18n
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Supported languages.
+const (
+	English = "en"
+	Urdu    = "ur"
+)
+
+// Default is used when the client expresses no supported preference.
+const Default = English
+
+// catalog maps language -> English message -> translation.
+var catalog = map[string]map[string]string{
+	Urdu: {
+		// validation
+		"invalid request body":                                         "درخواست کا مواد درست نہیں",
+		"invalid request payload":                                      "درخواست کا مواد درست نہیں",
+		"invalid address":                                              "والیٹ ایڈریس درست نہیں",
+		"too many addresses":                                           "بہت زیادہ ایڈریس",
+		"unknown event type":                                           "نامعلوم ایونٹ کی قسم",
+		"streaming not supported":                                      "اسٹریمنگ دستیاب نہیں",
+		"too many feed clients":                                        "فیڈ سے بہت زیادہ کلائنٹ جڑے ہیں",
+		"invalid from or limit":                                        "from یا limit درست نہیں",
+		"peer sync is not enabled":                                     "پیئر ہم آہنگی فعال نہیں",
+		"unsupported websocket handshake":                              "ویب ساکٹ ہینڈ شیک درست نہیں",
+		"invalid private key":                                          "پرائیویٹ کی درست نہیں",
+		"invalid transaction":                                          "ٹرانزیکشن درست نہیں",
+		"invalid block index":                                          "بلاک نمبر درست نہیں",
+		"invalid since_height":                                         "since_height درست نہیں",
+		"since_height is above the chain height":                       "since_height چین کی بلندی سے زیادہ ہے",
+		"invalid year":                                                 "سال درست نہیں",
+		"format must be json or csv":                                   "فارمیٹ json یا csv ہونا چاہیے",
+		"invalid limit":                                                "حد درست نہیں",
+		"insufficient funds":                                           "ناکافی بیلنس",
+		"fee must not be negative":                                     "فیس منفی نہیں ہو سکتی",
+		"this node does not collect fees":                              "یہ نوڈ فیس وصول نہیں کرتا",
+		"amount must be positive":                                      "رقم مثبت ہونی چاہیے",
+		"address is required":                                          "ایڈریس درکار ہے",
+		"email is required":                                            "ای میل درکار ہے",
+		"name is required":                                             "نام درکار ہے",
+		"email and otp are required":                                   "ای میل اور او ٹی پی درکار ہیں",
+		"address and positive amount are required":                     "ایڈریس اور مثبت رقم درکار ہیں",
+		"full_name, email and cnic are required":                       "نام، ای میل اور شناختی کارڈ نمبر درکار ہیں",
+		"full_name, cnic and wallet_address are required":              "نام، شناختی کارڈ نمبر اور والیٹ ایڈریس درکار ہیں",
+		"household_size and monthly_income must not be negative":       "گھر کے افراد اور ماہانہ آمدنی منفی نہیں ہو سکتی",
+		"auto_zakat_threshold must not be negative":                    "خودکار زکوٰۃ کی حد منفی نہیں ہو سکتی",
+		"each allocation needs a beneficiary_id and a positive amount": "ہر مختص رقم کے لیے beneficiary_id اور مثبت رقم درکار ہے",
+		"duplicate beneficiary in allocations":                         "مختص رقوم میں مستحق دہرایا گیا ہے",
+		"status must be cleared or flagged":                            "اسٹیٹس cleared یا flagged ہونا چاہیے",
+		"note and author are required":                                 "نوٹ اور مصنف درکار ہیں",
+		"subject and body are required":                                "موضوع اور متن درکار ہیں",
+		"invalid template: %s":                                         "ٹیمپلیٹ درست نہیں: %s",
+		"invalid branding variable":                                    "برانڈنگ متغیر درست نہیں",
+		"invalid phone number":                                         "فون نمبر درست نہیں",
+		"notify_channel must be email or whatsapp":                     "notify_channel ای میل یا whatsapp ہونا چاہیے",
+		"phone is required for whatsapp notifications":                 "واٹس ایپ اطلاعات کے لیے فون نمبر درکار ہے",
+		"invalid verify token":                                         "تصدیقی ٹوکن درست نہیں",
+		"invalid signature":                                            "دستخط درست نہیں",
+		"whatsapp webhook not configured":                              "واٹس ایپ ویب ہک ترتیب نہیں دیا گیا",
+		"unknown notification event":                                   "نامعلوم اطلاع ایونٹ",
+		"unknown notification channel":                                 "نامعلوم اطلاع چینل",
+		"a phone number is required for sms and whatsapp":              "ایس ایم ایس اور واٹس ایپ کے لیے فون نمبر درکار ہے",
+		"captcha_token is required":                                    "captcha_token درکار ہے",
+		"captcha verification failed":                                  "کیپچا کی تصدیق ناکام رہی",
+		"invalid captcha":                                              "کیپچا درست نہیں",
+		"address was funded in the last 24 hours":                      "اس پتے کو پچھلے 24 گھنٹوں میں فنڈ کیا جا چکا ہے",
+		"role must be user or tenant_admin":                            "کردار user یا tenant_admin ہونا چاہیے",
+		"raw_hex must be a hex-encoded transaction":                    "raw_hex ہیکس میں انکوڈ شدہ ٹرانزیکشن ہونا چاہیے",
+
+		// offline batch verdicts
+		"coinbase transactions are not accepted":     "کوائن بیس ٹرانزیکشنز قبول نہیں کی جاتیں",
+		"transaction id does not match its contents": "ٹرانزیکشن آئی ڈی اس کے مواد سے مطابقت نہیں رکھتی",
+		"transaction has no inputs or outputs":       "ٹرانزیکشن میں ان پٹ یا آؤٹ پٹ موجود نہیں",
+		"duplicate transaction in batch":             "بیچ میں ٹرانزیکشن دہرائی گئی ہے",
+		"transaction already mined":                  "ٹرانزیکشن پہلے ہی مائن ہو چکی ہے",
+		"output amounts must be positive":            "آؤٹ پٹ کی رقم مثبت ہونی چاہیے",
+		"input references an unknown transaction":    "ان پٹ نامعلوم ٹرانزیکشن کا حوالہ دیتا ہے",
+		"input references an unknown output":         "ان پٹ نامعلوم آؤٹ پٹ کا حوالہ دیتا ہے",
+		"input already spent":                        "ان پٹ پہلے ہی خرچ ہو چکا ہے",
+		"input spent twice":                          "ان پٹ دو بار خرچ کیا گیا ہے",
+		"input is not owned by the signer":           "ان پٹ دستخط کنندہ کی ملکیت نہیں",
+		"outputs exceed inputs":                      "آؤٹ پٹ ان پٹ سے زیادہ ہیں",
+		"transaction lock time has not passed":       "ٹرانزیکشن کا لاک ٹائم ابھی نہیں گزرا",
+
+		// not found
+		"block not found":                                               "بلاک نہیں ملا",
+		"beneficiary not found":                                         "مستحق نہیں ملا",
+		"receipt not found":                                             "رسید نہیں ملی",
+		"solvency epoch not found":                                      "سالوینسی ایپک نہیں ملا",
+		"allocation not found":                                          "مختص رقم نہیں ملی",
+		"transaction not found":                                         "ٹرانزیکشن نہیں ملی",
+		"tenant not found":                                              "ادارہ نہیں ملا",
+		"email template not found":                                      "ای میل ٹیمپلیٹ نہیں ملا",
+		"failed to load zakat policy":                                   "زکوٰۃ پالیسی لوڈ کرنے میں ناکامی",
+		"failed to save zakat policy":                                   "زکوٰۃ پالیسی محفوظ کرنے میں ناکامی",
+		"invalid zakat policy: %s":                                      "زکوٰۃ پالیسی درست نہیں: %s",
+		"feature is disabled":                                           "یہ فیچر بند ہے",
+		"unknown feature flag":                                          "نامعلوم فیچر فلیگ",
+		"failed to save feature flag":                                   "فیچر فلیگ محفوظ کرنے میں ناکامی",
+		"service is under maintenance, please retry later":              "سروس کی دیکھ بھال جاری ہے، براہ کرم بعد میں کوشش کریں",
+		"retry_after_seconds must not be negative":                      "retry_after_seconds منفی نہیں ہو سکتا",
+		"failed to create wallet":                                       "والٹ بنانے میں ناکامی",
+		"admin access is not configured":                                "ایڈمن رسائی ترتیب نہیں دی گئی",
+		"admin authentication required":                                 "ایڈمن تصدیق درکار ہے",
+		"admin access denied":                                           "ایڈمن رسائی سے انکار",
+		"admin role required":                                           "اس کام کے لیے ایڈمن کردار درکار ہے",
+		"q must be 3 to 128 characters":                                 "تلاش 3 سے 128 حروف کی ہونی چاہیے",
+		"q may only contain letters, digits and @ . _ + -":              "تلاش میں صرف حروف، ہندسے اور @ . _ + - ہو سکتے ہیں",
+		"search failed":                                                 "تلاش ناکام ہو گئی",
+		"if the email is registered, a one-time password has been sent": "اگر یہ ای میل رجسٹرڈ ہے تو ایک بار استعمال ہونے والا پاس ورڈ بھیج دیا گیا ہے",
+		"failed to create session":                                      "سیشن بنانے میں ناکامی",
+		"session required":                                              "سیشن درکار ہے",
+		"invalid or expired session":                                    "غلط یا میعاد ختم شدہ سیشن",
+		"failed to create passkey challenge":                            "پاس کی چیلنج بنانے میں ناکامی",
+		"too many pending passkey requests, try again later":            "بہت زیادہ زیر التواء پاس کی درخواستیں، بعد میں دوبارہ کوشش کریں",
+		"failed to load passkeys":                                       "پاس کیز لوڈ کرنے میں ناکامی",
+		"failed to load passkey":                                        "پاس کی لوڈ کرنے میں ناکامی",
+		"invalid passkey credential":                                    "غلط پاس کی اسناد",
+		"passkey challenge not found or expired":                        "پاس کی چیلنج نہیں ملا یا میعاد ختم ہو گئی",
+		"passkey registration failed":                                   "پاس کی رجسٹریشن ناکام ہو گئی",
+		"failed to save passkey":                                        "پاس کی محفوظ کرنے میں ناکامی",
+		"passkey already registered":                                    "پاس کی پہلے سے رجسٹرڈ ہے",
+		"passkey login failed":                                          "پاس کی سے لاگ ان ناکام ہو گیا",
+		"transaction pin locked, try again later":                       "ٹرانزیکشن پن مقفل ہے، بعد میں دوبارہ کوشش کریں",
+		"transaction pin required":                                      "ٹرانزیکشن پن درکار ہے",
+		"invalid transaction pin":                                       "غلط ٹرانزیکشن پن",
+		"failed to check transaction pin":                               "ٹرانزیکشن پن چیک کرنے میں ناکامی",
+		"failed to save transaction pin":                                "ٹرانزیکشن پن محفوظ کرنے میں ناکامی",
+		"failed to load transaction pin":                                "ٹرانزیکشن پن لوڈ کرنے میں ناکامی",
+		"failed to remove transaction pin":                              "ٹرانزیکشن پن ہٹانے میں ناکامی",
+		"no transaction pin set":                                        "کوئی ٹرانزیکشن پن مقرر نہیں",
+		"pin must be 4 to 8 digits":                                     "پن 4 سے 8 ہندسوں کا ہونا چاہیے",
+		"otp is required":                                               "او ٹی پی درکار ہے",
+		"failed to hold transfer":                                       "منتقلی روکنے میں ناکامی",
+		"failed to load held transfer":                                  "روکی گئی منتقلی لوڈ کرنے میں ناکامی",
+		"failed to load held transfers":                                 "روکی گئی منتقلیاں لوڈ کرنے میں ناکامی",
+		"held transfer not found":                                       "روکی گئی منتقلی نہیں ملی",
+		"transfer is no longer held":                                    "منتقلی اب روکی ہوئی نہیں ہے",
+		"failed to cancel transfer":                                     "منتقلی منسوخ کرنے میں ناکامی",
+		"duplicate transaction":                                         "ڈپلیکیٹ ٹرانزیکشن",
+		"disbursement not found":                                        "تقسیم نہیں ملی",
+		"failed to load acknowledgement":                                "وصولی کی تصدیق لوڈ کرنے میں ناکامی",
+		"disbursement already acknowledged":                             "اس تقسیم کی وصولی پہلے ہی تصدیق ہو چکی ہے",
+		"failed to create challenge":                                    "چیلنج بنانے میں ناکامی",
+		"too many pending challenges":                                   "بہت زیادہ زیر التواء چیلنجز",
+		"invalid or expired challenge":                                  "غلط یا میعاد ختم چیلنج",
+		"invalid public key":                                            "غلط پبلک کی",
+		"public key does not match the wallet":                          "پبلک کی والیٹ سے مطابقت نہیں رکھتی",
+		"failed to save acknowledgement":                                "وصولی کی تصدیق محفوظ کرنے میں ناکامی",
+		"invalid offset or limit":                                       "غلط آفسیٹ یا حد",
+		"invalid order":                                                 "ترتیب درست نہیں",
+		"invalid type":                                                  "قسم درست نہیں",
+		"unknown chart metric":                                          "نامعلوم چارٹ پیمانہ",
+		"invalid window":                                                "غلط مدت",
+		"address clusters not built yet":                                "ایڈریس کلسٹرز ابھی نہیں بنے",
+		"request timed out":                                             "درخواست کا وقت ختم ہو گیا",
+		"user_id or txid is required":                                   "user_id یا txid درکار ہے",
+		"failed to load audit records":                                  "آڈٹ ریکارڈ لوڈ نہیں ہو سکے",
+		"amount must not be negative":                                   "رقم منفی نہیں ہو سکتی",
+		"memo is too long":                                              "نوٹ بہت لمبا ہے",
+		"failed to create payment request":                              "ادائیگی کی درخواست بنانے میں ناکامی",
+		"failed to load payment requests":                               "ادائیگی کی درخواستیں لوڈ کرنے میں ناکامی",
+		"nothing to claim":                                              "وصول کرنے کے لیے کچھ نہیں",
+		"wallet does not belong to this user":                           "یہ والیٹ اس صارف کا نہیں",
+		"auditor is required":                                           "آڈیٹر درکار ہے",
+		"expires_in_days must not be negative":                          "expires_in_days منفی نہیں ہو سکتا",
+		"failed to load wallet":                                         "والیٹ لوڈ کرنے میں ناکامی",
+		"failed to create view key":                                     "ویو کی بنانے میں ناکامی",
+		"failed to load view keys":                                      "ویو کیز لوڈ کرنے میں ناکامی",
+		"failed to revoke view key":                                     "ویو کی منسوخ کرنے میں ناکامی",
+		"view key not found":                                            "ویو کی نہیں ملی",
+		"view key required":                                             "ویو کی درکار ہے",
+		"failed to check view key":                                      "ویو کی جانچنے میں ناکامی",
+		"invalid or expired view key":                                   "ویو کی غلط ہے یا اس کی مدت ختم ہو چکی ہے",
+		"private key does not match from address":                       "پرائیویٹ کی بھیجنے والے ایڈریس سے مطابقت نہیں رکھتی",
+		"failed to update tenant":                                       "ادارہ اپ ڈیٹ کرنے میں ناکامی",
+		"campaign not found":                                            "مہم نہیں ملی",
+		"failed to load campaigns":                                      "مہمات حاصل کرنے میں ناکامی",
+		"failed to create campaign":                                     "مہم بنانے میں ناکامی",
+		"failed to update campaign":                                     "مہم اپ ڈیٹ کرنے میں ناکامی",
+		"goal_amount must be positive":                                  "ہدف کی رقم مثبت ہونی چاہیے",
+		"invalid email":                                                 "ای میل درست نہیں",
+		"frequency must be weekly or monthly":                           "تعدد ہفتہ وار یا ماہانہ ہونا چاہیے",
+		"digest subscription not found":                                 "ڈائجسٹ کی رکنیت نہیں ملی",
+		"failed to load digest subscription":                            "ڈائجسٹ کی رکنیت حاصل کرنے میں ناکامی",
+		"failed to save digest subscription":                            "ڈائجسٹ کی رکنیت محفوظ کرنے میں ناکامی",
+		"failed to build digest":                                        "ڈائجسٹ تیار کرنے میں ناکامی",
+		"exchange rates unavailable":                                    "شرح تبادلہ دستیاب نہیں",
+		"unsupported currency":                                          "کرنسی تعاون یافتہ نہیں",
+		"due_date must be in the future":                                "ادائیگی کی تاریخ مستقبل میں ہونی چاہیے",
+		"due_date is after the campaign ends":                           "ادائیگی کی تاریخ مہم کے اختتام کے بعد ہے",
+		"pledge not found":                                              "وعدہ نہیں ملا",
+		"pledge is not pending":                                         "وعدہ زیر التوا نہیں ہے",
+		"failed to create pledge":                                       "وعدہ بنانے میں ناکامی",
+		"failed to load pledges":                                        "وعدے لوڈ کرنے میں ناکامی",
+		"failed to update pledge":                                       "وعدہ اپ ڈیٹ کرنے میں ناکامی",
+		"at least one share is required":                                "کم از کم ایک حصہ درکار ہے",
+		"too many shares":                                               "حصے بہت زیادہ ہیں",
+		"share percent must be positive":                                "حصے کا فیصد مثبت ہونا چاہیے",
+		"duplicate beneficiary in shares":                               "حصوں میں مستحق دو بار شامل ہے",
+		"share percentages must add up to 100":                          "حصوں کے فیصد کا مجموعہ 100 ہونا چاہیے",
+		"beneficiary has no wallet":                                     "مستحق کا کوئی والیٹ نہیں",
+		"failed to load disbursement templates":                         "تقسیم کے سانچے لوڈ کرنے میں ناکامی",
+		"disbursement template not found":                               "تقسیم کا سانچہ نہیں ملا",
+		"failed to save disbursement template":                          "تقسیم کا سانچہ محفوظ کرنے میں ناکامی",
+		"failed to delete disbursement template":                        "تقسیم کا سانچہ حذف کرنے میں ناکامی",
+		"amount too small to split":                                     "رقم تقسیم کے لیے بہت کم ہے",
+		"private key does not match the zakat pool":                     "نجی کلید زکوٰۃ پول سے مطابقت نہیں رکھتی",
+		"invalid category":                                              "زمرہ درست نہیں",
+		"invalid status":                                                "حیثیت درست نہیں",
+		"failed to delete beneficiary":                                  "مستحق کو حذف کرنے میں ناکامی",
+		"no approved beneficiaries":                                     "کوئی منظور شدہ مستحق نہیں",
+		"nothing to distribute":                                         "تقسیم کے لیے کچھ نہیں",
+		"failed to load disbursements":                                  "تقسیم کا ریکارڈ لوڈ کرنے میں ناکامی",
+		"invalid idempotency key":                                       "آئیڈیمپوٹینسی کی درست نہیں",
+		"failed to check idempotency key":                               "آئیڈیمپوٹینسی کی جانچنے میں ناکامی",
+		"idempotency key was used for a different request":              "یہ آئیڈیمپوٹینسی کی کسی اور درخواست کے لیے استعمال ہو چکی ہے",
+		"failed to load bridge deposits":                                "بیرونی چین کے عطیات لوڈ کرنے میں ناکامی",
+		"payout_account needs a payout_method":                          "payout_account کے ساتھ payout_method درکار ہے",
+		"invalid payout method":                                         "ادائیگی کا طریقہ درست نہیں",
+		"invalid payout account":                                        "ادائیگی کا اکاؤنٹ درست نہیں",
+		"payout webhook not configured":                                 "ادائیگی کا ویب ہک ترتیب نہیں دیا گیا",
+		"failed to update payout":                                       "ادائیگی اپ ڈیٹ کرنے میں ناکامی",
+		"failed to load payouts":                                        "ادائیگیاں لوڈ کرنے میں ناکامی",
+		"payout not found":                                              "ادائیگی نہیں ملی",
+		"only failed payouts can be retried":                            "صرف ناکام ادائیگیاں دوبارہ کی جا سکتی ہیں",
+		"payout already retried":                                        "یہ ادائیگی پہلے ہی دوبارہ کی جا چکی ہے",
+		"beneficiary has no approved payout account":                    "مستحق کا کوئی منظور شدہ ادائیگی اکاؤنٹ نہیں",
+		"failed to retry payout":                                        "ادائیگی دوبارہ کرنے میں ناکامی",
+		"invalid bank code":                                             "بینک کوڈ درست نہیں",
+		"wallet_address, payout_method or mobile_number is required":    "والیٹ ایڈریس، ادائیگی کا طریقہ یا موبائل نمبر درکار ہے",
+		"invalid mobile provider":                                       "موبائل والیٹ فراہم کنندہ درست نہیں",
+		"invalid mobile number":                                         "موبائل نمبر درست نہیں",
+		"invalid payout channel":                                        "ادائیگی کا ذریعہ درست نہیں",
+		"signatures must match the transaction inputs":                  "دستخط ٹرانزیکشن کے ان پٹس کے مطابق نہیں",
+		"policy service unavailable":                                    "پالیسی سروس دستیاب نہیں",
+		"denied by policy":                                              "پالیسی کے تحت مسترد",
+		"invalid metrics token":                                         "میٹرکس ٹوکن درست نہیں",
+		"cold storage is not configured":                                "کولڈ اسٹوریج ترتیب نہیں دیا گیا",
+		"reason is required":                                            "وجہ درکار ہے",
+		"insufficient hot wallet funds, request a cold-to-hot transfer": "ہاٹ والیٹ میں ناکافی بیلنس، کولڈ سے ہاٹ منتقلی کی درخواست کریں",
+		"failed to save cold transfer":                                  "کولڈ منتقلی محفوظ کرنے میں ناکامی",
+		"failed to load cold transfers":                                 "کولڈ منتقلیاں لوڈ کرنے میں ناکامی",
+		"failed to load cold transfer":                                  "کولڈ منتقلی لوڈ کرنے میں ناکامی",
+		"cold transfer not found":                                       "کولڈ منتقلی نہیں ملی",
+		"cold transfer changed meanwhile, retry":                        "کولڈ منتقلی اس دوران تبدیل ہو گئی، دوبارہ کوشش کریں",
+		"cold transfer is not awaiting approval":                        "کولڈ منتقلی منظوری کی منتظر نہیں",
+		"admin already approved this cold transfer":                     "ایڈمن یہ کولڈ منتقلی پہلے ہی منظور کر چکا ہے",
+		"cold transfer is already resolved":                             "کولڈ منتقلی پہلے ہی طے ہو چکی ہے",
+		"cold transfer is not approved":                                 "کولڈ منتقلی منظور نہیں ہوئی",
+		"transaction must spend the cold wallet only":                   "ٹرانزیکشن صرف کولڈ والیٹ سے خرچ کر سکتی ہے",
+		"transaction must pay the zakat pool only":                      "ٹرانزیکشن صرف زکوٰۃ پول کو ادائیگی کر سکتی ہے",
+		"too many requests, try again later":                            "بہت زیادہ درخواستیں، بعد میں دوبارہ کوشش کریں",
+		"tenant does not match your credentials":                        "تنظیم آپ کی اسناد سے مطابقت نہیں رکھتی",
+		"tenant admin role required":                                    "اس کام کے لیے تنظیم کے ایڈمن کا کردار درکار ہے",
+		"preferences belong to another user":                            "ترجیحات کسی دوسرے صارف کی ہیں",
+		"zakat records belong to another user":                          "زکوٰۃ کے ریکارڈ کسی دوسرے صارف کے ہیں",
+		"words must be 12, 15, 18, 21 or 24":                            "الفاظ کی تعداد 12، 15، 18، 21 یا 24 ہونی چاہیے",
+		"invalid derivation range":                                      "اخذ کرنے کی حد درست نہیں",
+		"invalid mnemonic":                                              "یادداشتی جملہ درست نہیں",
+		"external anchoring is not enabled":                             "بیرونی اینکرنگ فعال نہیں",
+		"anchor not found":                                              "اینکر نہیں ملا",
+		"failed to load anchors":                                        "اینکر لوڈ کرنے میں ناکامی",
+		"failed to anchor the chain":                                    "چین کو اینکر کرنے میں ناکامی",
+		"failed to verify anchor":                                       "اینکر کی تصدیق میں ناکامی",
+		"anchor made with another client":                               "یہ اینکر کسی اور کلائنٹ سے بنایا گیا تھا",
+		"anchor is not an OpenTimestamps proof":                         "یہ اینکر OpenTimestamps ثبوت نہیں",
+		"lock service unavailable":                                      "لاک سروس دستیاب نہیں",
+		"a zakat run is in progress on another instance":                "ایک اور انسٹینس پر زکوٰۃ کی کارروائی جاری ہے",
+		"failed to store block":                                         "بلاک محفوظ نہیں ہو سکا",
+		"mempool is full":                                               "میم پول بھر چکا ہے",
+		"transaction spends an output of a pending transaction":         "یہ ٹرانزیکشن ایک زیر التوا ٹرانزیکشن کا آؤٹ پٹ خرچ کرتی ہے",
+		"this is a read-only explorer node":                             "یہ صرف پڑھنے والا ایکسپلورر نوڈ ہے",
+		"invalid handle":                                                "ہینڈل درست نہیں",
+		"handle not found":                                              "ہینڈل نہیں ملا",
+		"handle is taken":                                               "یہ ہینڈل پہلے سے لیا جا چکا ہے",
+		"handle is reserved":                                            "یہ ہینڈل محفوظ ہے",
+		"handle was released recently":                                  "یہ ہینڈل حال ہی میں چھوڑا گیا ہے",
+		"wallet already has a handle":                                   "اس والیٹ کا پہلے سے ایک ہینڈل ہے",
+		"wallet has no handle":                                          "اس والیٹ کا کوئی ہینڈل نہیں",
+		"to_address must be another wallet":                             "to_address کوئی دوسرا والیٹ ہونا چاہیے",
+		"contact must be an email address or phone number":              "رابطہ ای میل ایڈریس یا فون نمبر ہونا چاہیے",
+		"contact is already registered":                                 "یہ رابطہ پہلے سے رجسٹرڈ ہے",
+		"message is too long":                                           "پیغام بہت طویل ہے",
+		"failed to create invitation":                                   "دعوت نامہ بنانے میں ناکامی",
+		"failed to load invitations":                                    "دعوت نامے لوڈ کرنے میں ناکامی",
+		"donor consent is required":                                     "عطیہ دہندہ کی رضامندی ضروری ہے",
+		"full_name, home_address and postcode are required":             "full_name، home_address اور postcode ضروری ہیں",
+		"declared_at is in the future":                                  "declared_at مستقبل میں ہے",
+		"transaction did not pay this campaign":                         "اس لین دین نے اس مہم کو ادائیگی نہیں کی",
+		"donation already has a declaration":                            "اس عطیے کا اعلامیہ پہلے سے موجود ہے",
+		"declaration not found":                                         "اعلامیہ نہیں ملا",
+		"failed to load declaration":                                    "اعلامیہ لوڈ کرنے میں ناکامی",
+		"failed to save declaration":                                    "اعلامیہ محفوظ کرنے میں ناکامی",
+		"failed to withdraw declaration":                                "اعلامیہ واپس لینے میں ناکامی",
+		"failed to load declarations":                                   "اعلامیے لوڈ کرنے میں ناکامی",
+		"invalid from date":                                             "غلط from تاریخ",
+		"invalid to date":                                               "غلط to تاریخ",
+		"category must be zakat, sadaqah or other":                      "زمرہ زکوٰۃ، صدقہ یا دیگر ہونا چاہیے",
+		"zakat deductions are counted without a tag":                    "زکوٰۃ کی کٹوتیاں ٹیگ کے بغیر شمار ہوتی ہیں",
+		"failed to save donation tag":                                   "عطیہ کا ٹیگ محفوظ کرنے میں ناکامی",
+		"failed to load donation tags":                                  "عطیات کے ٹیگ لوڈ کرنے میں ناکامی",
+		"user not found":                                                "صارف نہیں ملا",
+
+		// server side
+		"database not configured":                "ڈیٹا بیس ترتیب نہیں دیا گیا",
+		"ZAKAT_WALLET_ADDRESS not set":           "زکوٰۃ والیٹ ایڈریس مقرر نہیں",
+		"failed to create transaction":           "ٹرانزیکشن بنانے میں ناکامی",
+		"failed to generate otp":                 "او ٹی پی بنانے میں ناکامی",
+		"failed to create user":                  "صارف بنانے میں ناکامی",
+		"failed to create wallet profile":        "والیٹ پروفائل بنانے میں ناکامی",
+		"failed to create beneficiary":           "مستحق کا اندراج ناکام رہا",
+		"failed to create tenant":                "ادارہ بنانے میں ناکامی",
+		"failed to load beneficiary":             "مستحق کی معلومات حاصل کرنے میں ناکامی",
+		"failed to update beneficiary":           "مستحق کی معلومات محفوظ کرنے میں ناکامی",
+		"failed to update role":                  "کردار تبدیل کرنے میں ناکامی",
+		"failed to update wallet settings":       "والیٹ کی ترتیبات محفوظ کرنے میں ناکامی",
+		"failed to list transactions":            "ٹرانزیکشنز حاصل کرنے میں ناکامی",
+		"failed to list zakat records":           "زکوٰۃ ریکارڈ حاصل کرنے میں ناکامی",
+		"failed to list wallet profiles":         "والیٹ پروفائلز حاصل کرنے میں ناکامی",
+		"failed to list system logs":             "سسٹم لاگز حاصل کرنے میں ناکامی",
+		"failed to list beneficiaries":           "مستحقین کی فہرست حاصل کرنے میں ناکامی",
+		"failed to load receipt":                 "رسید حاصل کرنے میں ناکامی",
+		"failed to render receipt":               "رسید تیار کرنے میں ناکامی",
+		"failed to create solvency epoch":        "سالوینسی ایپک بنانے میں ناکامی",
+		"failed to load solvency epoch":          "سالوینسی ایپک حاصل کرنے میں ناکامی",
+		"failed to load transaction":             "ٹرانزیکشن حاصل کرنے میں ناکامی",
+		"failed to save transaction note":        "ٹرانزیکشن نوٹ محفوظ کرنے میں ناکامی",
+		"failed to load transaction notes":       "ٹرانزیکشن نوٹس حاصل کرنے میں ناکامی",
+		"failed to load email templates":         "ای میل ٹیمپلیٹس حاصل کرنے میں ناکامی",
+		"failed to save email template":          "ای میل ٹیمپلیٹ محفوظ کرنے میں ناکامی",
+		"failed to update branding":              "برانڈنگ محفوظ کرنے میں ناکامی",
+		"failed to load user":                    "صارف حاصل کرنے میں ناکامی",
+		"failed to load preferences":             "ترجیحات حاصل کرنے میں ناکامی",
+		"failed to save preferences":             "ترجیحات محفوظ کرنے میں ناکامی",
+		"failed to load sandbox fixtures":        "سینڈ باکس فکسچرز حاصل کرنے میں ناکامی",
+		"failed to list tenants":                 "اداروں کی فہرست حاصل کرنے میں ناکامی",
+		"failed to encode response":              "جواب تیار کرنے میں ناکامی",
+		"failed to deactivate wallet":            "والیٹ غیر فعال کرنے میں ناکامی",
+		"failed to validate transaction":         "ٹرانزیکشن کی جانچ میں ناکامی",
+		"amount exceeds the transaction limit":   "رقم ٹرانزیکشن کی حد سے زیادہ ہے",
+		"address is blocked by AML screening":    "یہ پتہ اینٹی منی لانڈرنگ جانچ کے تحت بلاک ہے",
+		"wallet is deactivated":                  "یہ والیٹ غیر فعال ہے",
+		"wallet not found":                       "والیٹ نہیں ملا",
+		"failed to create zakat run":             "زکوٰۃ رن بنانے میں ناکامی",
+		"failed to load zakat run":               "زکوٰۃ رن حاصل کرنے میں ناکامی",
+		"zakat run not found":                    "زکوٰۃ رن نہیں ملا",
+		"zakat run already completed":            "زکوٰۃ رن پہلے ہی مکمل ہو چکا ہے",
+		"zakat run is paused for review":         "زکوٰۃ رن جائزے کے لیے روکا گیا ہے",
+		"zakat run is not awaiting confirmation": "زکوٰۃ رن تصدیق کا منتظر نہیں",
+		"failed to update zakat run":             "زکوٰۃ رن محفوظ کرنے میں ناکامی",
+		"run_id must be a uuid":                  "run_id درست uuid ہونا چاہیے",
+		"a rebuild is already in progress":       "ری بلڈ پہلے ہی جاری ہے",
+		"job not found":                          "کام نہیں ملا",
+
+		// OTP / notifications
+		"invalid or expired otp":                              "او ٹی پی غلط ہے یا اس کی میعاد ختم ہو چکی ہے",
+		"otp verified":                                        "او ٹی پی کی تصدیق ہو گئی",
+		"Your one-time password is %s":                        "آپ کا یک وقتی پاس ورڈ %s ہے",
+		"You received %s in wallet %s":                        "آپ کے والیٹ %[2]s میں %[1]s موصول ہوئے",
+		"Zakat of %s was deducted from wallet %s":             "والیٹ %[2]s سے %[1]s زکوٰۃ منہا کی گئی",
+		"Your pledge of %s will be paid from wallet %s on %s": "آپ کا %[1]s کا وعدہ %[3]s کو والیٹ %[2]s سے ادا کیا جائے گا",
+		"Your pledge of %s was paid from wallet %s":           "آپ کا %[1]s کا وعدہ والیٹ %[2]s سے ادا کر دیا گیا",
+		"Your pledge of %s could not be paid from wallet %s":  "آپ کا %[1]s کا وعدہ والیٹ %[2]s سے ادا نہیں ہو سکا",
+		"A transfer of %s from wallet %s to %s is on hold until %s. If you did not make it, cancel it now:":       "والیٹ %[2]s سے %[3]s کو %[1]s کی منتقلی %[4]s تک روکی گئی ہے۔ اگر یہ آپ نے نہیں کی تو ابھی منسوخ کریں:",
+		"Transfer of %s from wallet %s to %s, on hold until %s.":                                                  "والیٹ %[2]s سے %[3]s کو %[1]s کی منتقلی، %[4]s تک روکی گئی۔",
+		"Your transfer of %s to %s (transaction %s) was reverted by a chain reorganization; please send it again": "%[2]s کو آپ کی %[1]s کی منتقلی (ٹرانزیکشن %[3]s) چین کی تنظیم نو کی وجہ سے واپس ہو گئی؛ براہ کرم دوبارہ بھیجیں",
+		"%s sent you %s on ZakatWallet. Register with this contact before %s to receive it.":                      "%[1]s نے آپ کو ZakatWallet پر %[2]s بھیجے ہیں۔ وصول کرنے کے لیے %[3]s سے پہلے اسی رابطے سے رجسٹر کریں۔",
+		"You have been sent funds":                                                                  "آپ کو رقم بھیجی گئی ہے",
+		"Cancel transfer":                                                                           "منتقلی منسوخ کریں",
+		"The transfer has been cancelled.":                                                          "منتقلی منسوخ کر دی گئی ہے۔",
+		"This address received more than one payment.":                                              "اس ایڈریس پر ایک سے زیادہ ادائیگیاں آئی ہیں۔",
+		"Receive each payment on a new address derived from your wallet.":                           "ہر ادائیگی اپنے والیٹ سے بنائے گئے نئے ایڈریس پر وصول کریں۔",
+		"Several payers sent to this address and can see each other's payments.":                    "کئی ادا کنندگان نے اس ایڈریس پر رقم بھیجی ہے اور وہ ایک دوسرے کی ادائیگیاں دیکھ سکتے ہیں۔",
+		"Give each payer their own address.":                                                        "ہر ادا کنندہ کو الگ ایڈریس دیں۔",
+		"Change of sends from this address went back to it.":                                        "اس ایڈریس سے بھیجی گئی رقم کا بقایا اسی ایڈریس پر واپس آیا۔",
+		"Send change to a new address derived from your wallet.":                                    "بقایا اپنے والیٹ سے بنائے گئے نئے ایڈریس پر بھیجیں۔",
+		"This address was spent together with other addresses, which links them to the same owner.": "یہ ایڈریس دوسرے ایڈریسز کے ساتھ مل کر خرچ ہوا، جس سے وہ ایک ہی مالک سے جڑ جاتے ہیں۔",
+		"Avoid sends that combine funds from several addresses.":                                    "ایسی ادائیگیوں سے بچیں جو کئی ایڈریسز کی رقم ملاتی ہوں۔",
+	},
+}
+
+// T returns msg translated into lang, or msg itself if no translation
+// exists.
+func T(lang, msg string) string {
+	if tr, ok := catalog[lang][msg]; ok {
+		return tr
+	}
+	return msg
+}
+
+// Tf translates a format string and applies args to it.
+func Tf(lang, format string, args ...interface{}) string {
+	return fmt.Sprintf(T(lang, format), args...)
+}
+
+// Negotiate picks the best supported language from an Accept-Language
+// header value such as "ur-PK,ur;q=0.9,en;q=0.8".
+func Negotiate(acceptLanguage string) string {
+	type pref struct {
+		lang string
+		q    float64
+	}
+
+	var prefs []pref
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		q := 1.0
+		tag := part
+		if i := strings.Index(part, ";"); i >= 0 {
+			tag = strings.TrimSpace(part[:i])
+			if v := strings.TrimSpace(part[i+1:]); strings.HasPrefix(v, "q=") {
+				if parsed, err := strconv.ParseFloat(v[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		base := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+		prefs = append(prefs, pref{lang: base, q: q})
+	}
+
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+	for _, p := range prefs {
+		if p.q <= 0 {
+			continue
+		}
+		if p.lang == English || p.lang == Urdu {
+			return p.lang
+		}
+	}
+	return Default
+}
+
+// FormatMoney renders a fiat amount with two decimals using the digit
+// grouping of the language: western (1,234,567.00) for English and
+// South Asian lakh/crore grouping (12,34,567.00) for Urdu.
+func FormatMoney(lang, currency string, amount float64) string {
+	neg := amount < 0
+	cents := int64(math.Round(math.Abs(amount) * 100))
+	whole := strconv.FormatInt(cents/100, 10)
+	frac := fmt.Sprintf("%02d", cents%100)
+
+	var grouped string
+	if lang == Urdu {
+		grouped = groupLakh(whole)
+	} else {
+		grouped = groupThousands(whole)
+	}
+
+	num := grouped + "." + frac
+	if neg {
+		num = "-" + num
+	}
+
+	if lang == Urdu && currency == "PKR" {
+		return num + " روپے"
+	}
+	return currency + " " + num
+}
+
+func groupThousands(s string) string {
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+func groupLakh(s string) string {
+	if len(s) <= 3 {
+		return s
+	}
+	head, tail := s[:len(s)-3], s[len(s)-3:]
+	for i := len(head) - 2; i > 0; i -= 2 {
+		head = head[:i] + "," + head[i:]
+	}
+	return head + "," + tail
+}
@@ -0,0 +1,118 @@
+package lock
+
+// leader.go elects one leader among the instances sharing a Locker.
+// Leadership is a lease like any lock: the leader renews it every third
+// of its time to live, and the other instances try to take it as often,
+// so when the leader stops or loses the lock service another instance
+// takes over within about one time to live. An instance considers
+// itself leader only while its last renewal is fresh enough that the
+// lease cannot have passed to someone else.
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Elector campaigns for leadership on behalf of one instance.
+type Elector struct {
+	l     Locker
+	name  string
+	ttl   time.Duration
+	token string
+	now   func() time.Time
+
+	mu         sync.Mutex
+	validUntil time.Time // zero while not leader
+}
+
+// NewElector returns an Elector for the lock name. Nothing happens
+// until Run is called.
+func NewElector(l Locker, name string, ttl time.Duration) *Elector {
+	return &Elector{l: l, name: name, ttl: ttl, token: NewToken(), now: time.Now}
+}
+
+// Run campaigns until ctx is done, then resigns.
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+	for {
+		e.campaign(ctx)
+		select {
+		case <-ctx.Done():
+			e.resign()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// campaign renews the lease when leading and tries to take it
+// otherwise.
+func (e *Elector) campaign(ctx context.Context) {
+	start := e.now()
+	callCtx, cancel := context.WithTimeout(ctx, e.ttl/3)
+	defer cancel()
+
+	e.mu.Lock()
+	holding := !e.validUntil.IsZero()
+	e.mu.Unlock()
+
+	var ok bool
+	var err error
+	if holding {
+		ok, err = e.l.Extend(callCtx, e.name, e.token, e.ttl)
+	} else {
+		ok, err = e.l.Acquire(callCtx, e.name, e.token, e.ttl)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	wasLeader := !e.validUntil.IsZero()
+	switch {
+	case err != nil:
+		// the lease may still be ours until it runs out
+		log.Printf("leader election: %v", err)
+		if wasLeader && !e.now().Before(e.validUntil) {
+			e.validUntil = time.Time{}
+		}
+	case ok:
+		// the lease was granted no earlier than start; leave a third of
+		// it as margin for clock drift between instances
+		e.validUntil = start.Add(e.ttl - e.ttl/3)
+	default:
+		e.validUntil = time.Time{}
+	}
+	if leader := !e.validUntil.IsZero(); leader != wasLeader {
+		if leader {
+			log.Printf("leader election: this instance is now the leader")
+		} else {
+			log.Printf("leader election: this instance is no longer the leader")
+		}
+	}
+}
+
+// resign gives up leadership so that another instance takes over
+// without waiting for the lease to expire.
+func (e *Elector) resign() {
+	e.mu.Lock()
+	leader := !e.validUntil.IsZero()
+	e.validUntil = time.Time{}
+	e.mu.Unlock()
+	if !leader {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.l.Release(ctx, e.name, e.token); err != nil {
+		log.Printf("leader election: failed to resign: %v", err)
+	}
+}
+
+// IsLeader reports whether this instance currently leads.
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return !e.validUntil.IsZero() && e.now().Before(e.validUntil)
+}
@@ -0,0 +1,270 @@
+// Package lock provides named locks shared by every API replica, so
+// that work which must happen once (zakat runs, faucet drips, the
+// background schedulers, mining) is not done by two replicas at the
+// same time, and elects the replica that runs the background schedulers
+// (see leader.go). Locks are leases: a holder gets a lock for a time to
+// live and must extend it to keep it, so a crashed replica's locks
+// expire on their own. The backend is chosen with LOCK_BACKEND: "local" (the
+// default, in-process only), "redis" (REDIS_URL) or "postgres" (a lease
+// table in the Supabase database).
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// retryInterval spaces the attempts of Lock while the lock is taken.
+const retryInterval = 100 * time.Millisecond
+
+// Locker is a lock service. A lock is held by whoever acquired it with
+// token until its time to live runs out or it is released.
+type Locker interface {
+	// Acquire takes the lock name for token unless another token holds
+	// it. It reports whether the lock was taken.
+	Acquire(ctx context.Context, name, token string, ttl time.Duration) (bool, error)
+	// Extend renews a lock token still holds. It reports false if the
+	// lock expired and was taken by someone else meanwhile.
+	Extend(ctx context.Context, name, token string, ttl time.Duration) (bool, error)
+	// Release gives up a lock token holds. Releasing a lock held by
+	// another token does nothing.
+	Release(ctx context.Context, name, token string) error
+}
+
+// Name returns the configured backend's name for logs.
+func Name(l Locker) string {
+	switch l.(type) {
+	case *Redis:
+		return "redis"
+	case *Postgres:
+		return "postgres"
+	default:
+		return "local"
+	}
+}
+
+// Shared reports whether l coordinates several processes.
+func Shared(l Locker) bool {
+	_, local := l.(*Local)
+	return !local
+}
+
+// NewFromEnv returns the backend selected by LOCK_BACKEND. store is the
+// lease table used by the postgres backend; it may be nil when no
+// database is configured. A misconfigured backend falls back to local
+// locks with a warning.
+func NewFromEnv(store LeaseStore) Locker {
+	switch kind := strings.ToLower(os.Getenv("LOCK_BACKEND")); kind {
+	case "", "local":
+		return NewLocal()
+	case "redis":
+		r, err := NewRedis(os.Getenv("REDIS_URL"))
+		if err != nil {
+			log.Printf("warning: LOCK_BACKEND=redis: %v, locks are local to this instance", err)
+			return NewLocal()
+		}
+		return r
+	case "postgres":
+		if store == nil {
+			log.Println("warning: LOCK_BACKEND=postgres needs the database, locks are local to this instance")
+			return NewLocal()
+		}
+		return NewPostgres(store)
+	default:
+		log.Printf("warning: unknown LOCK_BACKEND %q (want local, redis or postgres), locks are local to this instance", kind)
+		return NewLocal()
+	}
+}
+
+// NewToken returns a token that identifies one holding of a lock. It
+// names the host and process to help operators find a stuck holder.
+func NewToken() string {
+	host, _ := os.Hostname()
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b[:]))
+}
+
+// Held is a lock taken with TryLock or Lock. It is extended in the
+// background every third of its time to live until it is released.
+type Held struct {
+	l     Locker
+	name  string
+	token string
+
+	stop chan struct{}
+	done chan struct{}
+	lost chan struct{}
+	once sync.Once
+}
+
+// TryLock takes the lock name if it is free. It returns nil and no
+// error when another holder has it.
+func TryLock(ctx context.Context, l Locker, name string, ttl time.Duration) (*Held, error) {
+	token := NewToken()
+	ok, err := l.Acquire(ctx, name, token, ttl)
+	if err != nil || !ok {
+		return nil, err
+	}
+	h := &Held{
+		l:     l,
+		name:  name,
+		token: token,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+		lost:  make(chan struct{}),
+	}
+	go h.keepAlive(ttl)
+	return h, nil
+}
+
+// Lock waits until it takes the lock name or ctx is done.
+func Lock(ctx context.Context, l Locker, name string, ttl time.Duration) (*Held, error) {
+	for {
+		h, err := TryLock(ctx, l, name, ttl)
+		if err != nil || h != nil {
+			return h, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// Lost is closed when the lock could not be extended and may now be
+// held by someone else. Work under the lock should stop.
+func (h *Held) Lost() <-chan struct{} {
+	return h.lost
+}
+
+// Release stops extending the lock and gives it up.
+func (h *Held) Release() {
+	h.once.Do(func() {
+		close(h.stop)
+		<-h.done
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := h.l.Release(ctx, h.name, h.token); err != nil {
+			log.Printf("failed to release lock %s: %v", h.name, err)
+		}
+	})
+}
+
+func (h *Held) keepAlive(ttl time.Duration) {
+	defer close(h.done)
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), ttl/3)
+			ok, err := h.l.Extend(ctx, h.name, h.token, ttl)
+			cancel()
+			if err != nil {
+				// the lease may survive a failed call; try again next tick
+				log.Printf("failed to extend lock %s: %v", h.name, err)
+				continue
+			}
+			if !ok {
+				log.Printf("lost lock %s", h.name)
+				close(h.lost)
+				return
+			}
+		}
+	}
+}
+
+// Run runs fn under the lock name if it is free and reports whether it
+// ran. fn's context is cancelled if the lock is lost.
+func Run(ctx context.Context, l Locker, name string, ttl time.Duration, fn func(ctx context.Context)) (bool, error) {
+	h, err := TryLock(ctx, l, name, ttl)
+	if err != nil || h == nil {
+		return false, err
+	}
+	defer h.Release()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-h.Lost():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	fn(ctx)
+	return true, nil
+}
+
+// Local is an in-process Locker. It coordinates the goroutines of one
+// instance only.
+type Local struct {
+	mu    sync.Mutex
+	locks map[string]localLease
+	now   func() time.Time
+}
+
+type localLease struct {
+	token   string
+	expires time.Time
+}
+
+// NewLocal returns an empty in-process Locker.
+func NewLocal() *Local {
+	return &Local{locks: make(map[string]localLease), now: time.Now}
+}
+
+// Acquire implements Locker.
+func (l *Local) Acquire(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if cur, ok := l.locks[name]; ok && cur.token != token && now.Before(cur.expires) {
+		return false, nil
+	}
+	// drop expired leases so the map does not grow without bound
+	for n, cur := range l.locks {
+		if !now.Before(cur.expires) {
+			delete(l.locks, n)
+		}
+	}
+	l.locks[name] = localLease{token: token, expires: now.Add(ttl)}
+	return true, nil
+}
+
+// Extend implements Locker.
+func (l *Local) Extend(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	cur, ok := l.locks[name]
+	if !ok || cur.token != token || !now.Before(cur.expires) {
+		return false, nil
+	}
+	l.locks[name] = localLease{token: token, expires: now.Add(ttl)}
+	return true, nil
+}
+
+// Release implements Locker.
+func (l *Local) Release(ctx context.Context, name, token string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if cur, ok := l.locks[name]; ok && cur.token == token {
+		delete(l.locks, name)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package lock
+
+// postgres.go implements Locker on the Supabase database. The server
+// reaches Postgres through PostgREST, which runs every request on a
+// pooled connection, so session advisory locks would not outlive the
+// request that took them. Locks are instead rows of the
+// distributed_locks table, one per name: the primary key lets a single
+// holder insert a row, and an expired row is taken over by a
+// conditional update.
+
+import (
+	"context"
+	"time"
+)
+
+// LeaseStore keeps lock leases. db.Store implements it.
+type LeaseStore interface {
+	AcquireLock(ctx context.Context, name, token string, ttl time.Duration) (bool, error)
+	ExtendLock(ctx context.Context, name, token string, ttl time.Duration) (bool, error)
+	ReleaseLock(ctx context.Context, name, token string) error
+}
+
+// Postgres is a Locker backed by a lease table.
+type Postgres struct {
+	store LeaseStore
+}
+
+// NewPostgres returns a Locker keeping its leases in store.
+func NewPostgres(store LeaseStore) *Postgres {
+	return &Postgres{store: store}
+}
+
+// Acquire implements Locker.
+func (p *Postgres) Acquire(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	return p.store.AcquireLock(ctx, name, token, ttl)
+}
+
+// Extend implements Locker.
+func (p *Postgres) Extend(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	return p.store.ExtendLock(ctx, name, token, ttl)
+}
+
+// Release implements Locker.
+func (p *Postgres) Release(ctx context.Context, name, token string) error {
+	return p.store.ReleaseLock(ctx, name, token)
+}
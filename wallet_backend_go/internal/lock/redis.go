@@ -0,0 +1,189 @@
+package lock
+
+// redis.go implements Locker on Redis with SET NX PX, the single-node
+// Redis locking recipe. Extending and releasing compare the token in a
+// Lua script so a holder never touches a lock that expired and was
+// taken by someone else. It speaks RESP itself over one connection per
+// call, which is plenty for the few lock calls the server makes.
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRedisPort = "6379"
+	redisKeyPrefix   = "zakatwallet:lock:"
+	redisDialTimeout = 5 * time.Second
+)
+
+const (
+	extendScript  = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+	releaseScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+)
+
+// Redis is a Locker backed by a Redis server.
+type Redis struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	DB       int
+	TLS      bool
+}
+
+// NewRedis configures a Redis locker from a redis:// or rediss:// URL,
+// e.g. redis://:password@localhost:6379/0.
+func NewRedis(rawURL string) (*Redis, error) {
+	if rawURL == "" {
+		return nil, errors.New("REDIS_URL is not set")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("invalid REDIS_URL scheme %q (want redis or rediss)", u.Scheme)
+	}
+	r := &Redis{TLS: u.Scheme == "rediss"}
+	host, port := u.Hostname(), u.Port()
+	if host == "" {
+		return nil, errors.New("REDIS_URL has no host")
+	}
+	if port == "" {
+		port = defaultRedisPort
+	}
+	r.Addr = net.JoinHostPort(host, port)
+	if u.User != nil {
+		r.Username = u.User.Username()
+		r.Password, _ = u.User.Password()
+	}
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if r.DB, err = strconv.Atoi(path); err != nil {
+			return nil, fmt.Errorf("invalid REDIS_URL database %q", path)
+		}
+	}
+	return r, nil
+}
+
+// Acquire implements Locker.
+func (r *Redis) Acquire(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	reply, err := r.do(ctx, "SET", redisKeyPrefix+name, token, "NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return false, err
+	}
+	// nil when the key exists
+	return reply == "OK", nil
+}
+
+// Extend implements Locker.
+func (r *Redis) Extend(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	reply, err := r.do(ctx, "EVAL", extendScript, "1", redisKeyPrefix+name, token, strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return false, err
+	}
+	return reply == int64(1), nil
+}
+
+// Release implements Locker.
+func (r *Redis) Release(ctx context.Context, name, token string) error {
+	_, err := r.do(ctx, "EVAL", releaseScript, "1", redisKeyPrefix+name, token)
+	return err
+}
+
+// do connects, authenticates, selects the database and runs one
+// command, returning its reply: a string, an int64 or nil.
+func (r *Redis) do(ctx context.Context, args ...string) (interface{}, error) {
+	dialer := &net.Dialer{Timeout: redisDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", r.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("redis dial: %w", err)
+	}
+	if r.TLS {
+		host, _, _ := net.SplitHostPort(r.Addr)
+		conn = tls.Client(conn, &tls.Config{ServerName: host})
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else {
+		_ = conn.SetDeadline(time.Now().Add(redisDialTimeout))
+	}
+
+	rd := bufio.NewReader(conn)
+	call := func(args ...string) (interface{}, error) {
+		if _, err := conn.Write(encodeCommand(args)); err != nil {
+			return nil, fmt.Errorf("redis write: %w", err)
+		}
+		return readReply(rd)
+	}
+	if r.Password != "" {
+		auth := []string{"AUTH", r.Password}
+		if r.Username != "" {
+			auth = []string{"AUTH", r.Username, r.Password}
+		}
+		if _, err := call(auth...); err != nil {
+			return nil, err
+		}
+	}
+	if r.DB != 0 {
+		if _, err := call("SELECT", strconv.Itoa(r.DB)); err != nil {
+			return nil, err
+		}
+	}
+	return call(args...)
+}
+
+// encodeCommand encodes a command as a RESP array of bulk strings.
+func encodeCommand(args []string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	return []byte(b.String())
+}
+
+// readReply reads one RESP reply. Arrays are not used by the lock
+// commands and are rejected.
+func readReply(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis read: %w", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch body := line[1:]; line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, fmt.Errorf("redis: %s", body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad bulk length %q", body)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, fmt.Errorf("redis read: %w", err)
+		}
+		return string(buf[:n]), nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
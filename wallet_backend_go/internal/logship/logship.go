@@ -0,0 +1,205 @@
+// Package logship forwards system log events to an external log
+// collector (a SIEM) in near real time, in addition to the system_logs
+// table. Events are queued without blocking the caller, sent in
+// batches and retried with backoff while the sink is unavailable; when
+// the queue is full new events are dropped rather than slowing the API
+// down.
+package logship
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wallet_backend_go/internal/models"
+)
+
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = 2 * time.Second
+	defaultRetries       = 5
+	queueSize            = 10000
+
+	maxBackoff = 30 * time.Second
+)
+
+// Sink delivers a batch of events to a collector.
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, events []models.SystemLog) error
+}
+
+// Shipper batches events and sends them to a sink. A nil Shipper
+// discards everything, so callers need not check whether shipping is
+// configured.
+type Shipper struct {
+	sink          Sink
+	batchSize     int
+	flushInterval time.Duration
+	retries       int
+
+	queue   chan models.SystemLog
+	done    chan struct{}
+	closing sync.Once
+
+	mu      sync.Mutex
+	dropped int // events dropped since the last report
+}
+
+// New returns a started Shipper sending to sink.
+func New(sink Sink, batchSize int, flushInterval time.Duration, retries int) *Shipper {
+	s := &Shipper{
+		sink:          sink,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		retries:       retries,
+		queue:         make(chan models.SystemLog, queueSize),
+		done:          make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// NewFromEnv configures a Shipper from LOG_SHIP_SINK (syslog, loki or
+// http), LOG_SHIP_URL, LOG_SHIP_TOKEN, LOG_SHIP_BATCH_SIZE,
+// LOG_SHIP_FLUSH_SECONDS and LOG_SHIP_RETRIES. It returns nil when
+// shipping is not configured or misconfigured, which is logged.
+func NewFromEnv() *Shipper {
+	kind := strings.ToLower(os.Getenv("LOG_SHIP_SINK"))
+	if kind == "" {
+		return nil
+	}
+	target := os.Getenv("LOG_SHIP_URL")
+	if target == "" {
+		log.Printf("warning: LOG_SHIP_SINK=%s needs LOG_SHIP_URL, system logs are not shipped", kind)
+		return nil
+	}
+
+	var sink Sink
+	var err error
+	switch kind {
+	case "syslog":
+		sink, err = NewSyslogSink(target)
+	case "loki":
+		sink = NewLokiSink(target, os.Getenv("LOG_SHIP_TOKEN"))
+	case "http":
+		sink = NewHTTPSink(target, os.Getenv("LOG_SHIP_TOKEN"))
+	default:
+		err = fmt.Errorf("unknown sink %q (want syslog, loki or http)", kind)
+	}
+	if err != nil {
+		log.Printf("warning: LOG_SHIP_SINK: %v, system logs are not shipped", err)
+		return nil
+	}
+
+	flush := defaultFlushInterval
+	if n := envInt("LOG_SHIP_FLUSH_SECONDS", 0); n > 0 {
+		flush = time.Duration(n) * time.Second
+	}
+	s := New(sink, envInt("LOG_SHIP_BATCH_SIZE", defaultBatchSize), flush, envInt("LOG_SHIP_RETRIES", defaultRetries))
+	log.Printf("shipping system logs to %s sink %s", sink.Name(), target)
+	return s
+}
+
+func envInt(name string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || n <= 0 {
+		return def
+	}
+	return n
+}
+
+// Ship queues an event. It never blocks: when the queue is full the
+// event is dropped and counted.
+func (s *Shipper) Ship(e models.SystemLog) {
+	if s == nil {
+		return
+	}
+	select {
+	case s.queue <- e:
+	default:
+		s.mu.Lock()
+		s.dropped++
+		s.mu.Unlock()
+	}
+}
+
+// Close stops accepting events and sends the queued ones, giving up
+// when ctx is done.
+func (s *Shipper) Close(ctx context.Context) {
+	if s == nil {
+		return
+	}
+	s.closing.Do(func() { close(s.queue) })
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+	}
+}
+
+func (s *Shipper) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.SystemLog, 0, s.batchSize)
+	for {
+		select {
+		case e, ok := <-s.queue:
+			if !ok {
+				s.send(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) < s.batchSize {
+				continue
+			}
+		case <-ticker.C:
+			s.reportDropped()
+		}
+		if len(batch) > 0 {
+			s.send(batch)
+			batch = make([]models.SystemLog, 0, s.batchSize)
+		}
+	}
+}
+
+// send delivers a batch, retrying with exponential backoff. A batch
+// that still fails after the last retry is dropped. Delivery is at
+// least once: a retry resends events a sink may already have accepted.
+func (s *Shipper) send(batch []models.SystemLog) {
+	if len(batch) == 0 {
+		return
+	}
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := s.sink.Send(ctx, batch)
+		cancel()
+		if err == nil {
+			return
+		}
+		if attempt >= s.retries {
+			log.Printf("log shipping: dropped %d events after %d attempts: %v", len(batch), attempt+1, err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func (s *Shipper) reportDropped() {
+	s.mu.Lock()
+	n := s.dropped
+	s.dropped = 0
+	s.mu.Unlock()
+	if n > 0 {
+		log.Printf("log shipping: queue full, dropped %d events", n)
+	}
+}
@@ -0,0 +1,201 @@
+package logship
+
+// sinks.go implements the supported collectors: syslog (RFC 5424 over
+// UDP or TCP), Grafana Loki's push API and a generic HTTP endpoint that
+// receives each batch as a JSON array.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wallet_backend_go/internal/models"
+)
+
+const appName = "zakatwallet"
+
+// HTTPSink posts each batch as a JSON array of system logs.
+type HTTPSink struct {
+	URL    string
+	Token  string // sent as a bearer token when set
+	Client *http.Client
+}
+
+// NewHTTPSink returns a sink posting to endpoint.
+func NewHTTPSink(endpoint, token string) *HTTPSink {
+	return &HTTPSink{URL: endpoint, Token: token, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Name implements Sink.
+func (h *HTTPSink) Name() string { return "http" }
+
+// Send implements Sink.
+func (h *HTTPSink) Send(ctx context.Context, events []models.SystemLog) error {
+	return postJSON(ctx, h.Client, h.URL, h.Token, events)
+}
+
+// LokiSink pushes batches to Grafana Loki, one stream per level.
+type LokiSink struct {
+	URL    string // base URL of Loki
+	Token  string
+	Client *http.Client
+}
+
+// NewLokiSink returns a sink pushing to the Loki at baseURL.
+func NewLokiSink(baseURL, token string) *LokiSink {
+	return &LokiSink{URL: strings.TrimRight(baseURL, "/"), Token: token, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Name implements Sink.
+func (l *LokiSink) Name() string { return "loki" }
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"` // unix nanoseconds, line
+}
+
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+// Send implements Sink.
+func (l *LokiSink) Send(ctx context.Context, events []models.SystemLog) error {
+	byLevel := make(map[string]int) // level -> index in push.Streams
+	var push lokiPush
+	for _, e := range events {
+		i, ok := byLevel[e.Level]
+		if !ok {
+			i = len(push.Streams)
+			byLevel[e.Level] = i
+			push.Streams = append(push.Streams, lokiStream{Stream: map[string]string{"app": appName, "level": e.Level}})
+		}
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		push.Streams[i].Values = append(push.Streams[i].Values, [2]string{strconv.FormatInt(e.Timestamp.UnixNano(), 10), string(line)})
+	}
+	return postJSON(ctx, l.Client, l.URL+"/loki/api/v1/push", l.Token, push)
+}
+
+func postJSON(ctx context.Context, client *http.Client, endpoint, token string, body any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s: %s", endpoint, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// SyslogSink writes RFC 5424 messages with facility local0 to a syslog
+// server over UDP or TCP (octet-counting framing, RFC 6587).
+type SyslogSink struct {
+	Network string // udp or tcp
+	Addr    string
+	host    string
+
+	mu   sync.Mutex
+	conn net.Conn // reused until a write fails
+}
+
+// NewSyslogSink parses target as udp://host:port or tcp://host:port.
+func NewSyslogSink(target string) (*SyslogSink, error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+		return nil, fmt.Errorf("syslog LOG_SHIP_URL must be udp://host:port or tcp://host:port")
+	}
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "-"
+	}
+	return &SyslogSink{Network: u.Scheme, Addr: u.Host, host: host}, nil
+}
+
+// Name implements Sink.
+func (s *SyslogSink) Name() string { return "syslog" }
+
+// syslogSeverity maps log levels to syslog severities.
+func syslogSeverity(level string) int {
+	switch level {
+	case "error":
+		return 3
+	case "warn":
+		return 4
+	default:
+		return 6 // informational
+	}
+}
+
+// format renders e as an RFC 5424 message.
+func (s *SyslogSink) format(e models.SystemLog) string {
+	const local0 = 16
+	msgID := e.Type
+	if msgID == "" {
+		msgID = "-"
+	}
+	msg := e.Message
+	if e.IP != "" {
+		msg = fmt.Sprintf("ip=%s %s", e.IP, msg)
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		local0*8+syslogSeverity(e.Level), e.Timestamp.UTC().Format(time.RFC3339Nano),
+		s.host, appName, os.Getpid(), msgID, msg)
+}
+
+// Send implements Sink.
+func (s *SyslogSink) Send(ctx context.Context, events []models.SystemLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, s.Network, s.Addr)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.conn.SetWriteDeadline(deadline)
+	}
+
+	for _, e := range events {
+		msg := s.format(e)
+		if s.Network == "tcp" {
+			msg = fmt.Sprintf("%d %s", len(msg), msg)
+		}
+		if _, err := io.WriteString(s.conn, msg); err != nil {
+			// reconnect on the retry, which resends the whole batch
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
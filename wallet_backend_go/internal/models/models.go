@@ -1,43 +1,800 @@
-package models
-
-import "time"
-
-// User represents an application user (NOT blockchain only).
-// This will be stored in a "users" table in Supabase.
-type User struct {
-	ID        string    `json:"id"`         // uuid in Supabase
-	FullName  string    `json:"full_name"`
-	Email     string    `json:"email"`
-	CNIC      string    `json:"cnic"`       // National ID
-	CreatedAt time.Time `json:"created_at"`
-}
-
-// WalletProfile links a user to a blockchain wallet.
-type WalletProfile struct {
-	ID                  string    `json:"id"`                     // uuid
-	UserID              string    `json:"user_id"`                // foreign key -> users.id
-	WalletAddress       string    `json:"wallet_address"`         // hash of pub key (your existing address)
-	PublicKeyHex        string    `json:"public_key_hex"`         // hex-encoded
-	EncryptedPrivateKey string    `json:"encrypted_private_key"`  // we'll just store raw for now, can "pretend" it's encrypted
-	CreatedAt           time.Time `json:"created_at"`
-}
-
-// ZakatRecord stores each zakat deduction operation.
-type ZakatRecord struct {
-	ID            string    `json:"id"`             // uuid
-	UserID        string    `json:"user_id"`
-	WalletAddress string    `json:"wallet_address"`
-	Amount        int       `json:"amount"`         // integer amount of "coins"
-	BlockHash     string    `json:"block_hash"`
-	CreatedAt     time.Time `json:"created_at"`
-}
-
-// SystemLog stores system-level log events.
-type SystemLog struct {
-	ID        string    `json:"id"`        // uuid
-	Level     string    `json:"level"`     // info, warn, error
-	Type      string    `json:"type"`      // login_attempt, otp_failed, invalid_wallet, rejected_tx, mining_event, zakat_run, etc.
-	Message   string    `json:"message"`
-	IP        string    `json:"ip"`
-	Timestamp time.Time `json:"timestamp"`
-}
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// User represents an application user (NOT blockchain only).
+// This will be stored in a "users" table in Supabase.
+type User struct {
+	ID            string    `json:"id"`                       // uuid in Supabase
+	TenantID      string    `json:"tenant_id,omitempty"`      // organization the user belongs to
+	FullName      string    `json:"full_name"`
+	Email         string    `json:"email"`
+	CNIC          string    `json:"cnic"`                     // National ID
+	Phone         string    `json:"phone,omitempty"`          // E.164 digits, used for WhatsApp
+	NotifyChannel string    `json:"notify_channel,omitempty"` // preferred channel: email (default), whatsapp
+	Role          string    `json:"role"`                     // user, tenant_admin
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// User roles.
+const (
+	RoleUser        = "user"
+	RoleTenantAdmin = "tenant_admin"
+)
+
+// Tenant is an organization (mosque, charity) hosted on a shared
+// deployment. Users, wallets, zakat records and beneficiaries are
+// scoped to a tenant.
+type Tenant struct {
+	ID                 string            `json:"id"`                   // uuid
+	Name               string            `json:"name"`
+	ZakatWalletAddress string            `json:"zakat_wallet_address"` // tenant's zakat pool; falls back to ZAKAT_WALLET_ADDRESS
+	Branding           map[string]string `json:"branding,omitempty"`   // email branding variables (organization_name, primary_color, logo_url, ...)
+	Description        string            `json:"description,omitempty"` // public profile on the donation portal
+	Category           string            `json:"category,omitempty"`
+	Verified           bool              `json:"verified"`              // listed on the donation portal
+	CreatedAt          time.Time         `json:"created_at"`
+}
+
+// WalletProfile links a user to a blockchain wallet.
+type WalletProfile struct {
+	ID                  string    `json:"id"`                     // uuid
+	UserID              string    `json:"user_id"`                // foreign key -> users.id
+	TenantID            string    `json:"tenant_id,omitempty"`    // foreign key -> tenants.id
+	WalletAddress       string    `json:"wallet_address"`         // hash of pub key (your existing address)
+	PublicKeyHex        string    `json:"public_key_hex"`         // hex-encoded
+	EncryptedPrivateKey string    `json:"encrypted_private_key"`  // we'll just store raw for now, can "pretend" it's encrypted
+	AutoZakat           bool      `json:"auto_zakat"`             // "pay zakat as you earn" opt-in
+	AutoZakatThreshold  int       `json:"auto_zakat_threshold"`   // minimum incoming amount that triggers auto zakat
+	Status              string    `json:"status"`                 // active, deactivated
+	DeactivatedAt       *time.Time `json:"deactivated_at,omitempty"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// Wallet profile statuses. Deactivated wallets keep their history but
+// are excluded from zakat runs and cannot send.
+const (
+	WalletStatusActive      = "active"
+	WalletStatusDeactivated = "deactivated"
+)
+
+// ZakatRecord stores each zakat deduction operation.
+type ZakatRecord struct {
+	ID            string    `json:"id"`             // uuid
+	UserID        string    `json:"user_id"`
+	TenantID      string    `json:"tenant_id,omitempty"`
+	WalletAddress string    `json:"wallet_address"`
+	Amount        int       `json:"amount"`         // integer amount of "coins"
+	BlockHash     string    `json:"block_hash"`
+	RunID         string    `json:"run_id,omitempty"` // zakat run that produced the deduction, if any
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ZakatRun records one execution of the zakat deduction over a
+// tenant's wallets so that an interrupted run can be resumed.
+type ZakatRun struct {
+	ID                 string     `json:"id"`                   // uuid
+	TenantID           string     `json:"tenant_id,omitempty"`
+	ZakatWalletAddress string     `json:"zakat_wallet_address"` // pool the run pays into
+	Status             string     `json:"status"`               // running, paused, completed, partial
+	TotalWallets       int        `json:"total_wallets"`
+	Processed          int        `json:"processed"`
+	Failed             int        `json:"failed"`
+	TotalZakat         int        `json:"total_zakat"`
+	Anomalies          []string   `json:"anomalies,omitempty"` // why the run was paused for review
+	PolicyVersion      int        `json:"policy_version"`      // zakat policy applied, 0 = built-in default
+	Trigger            string     `json:"trigger,omitempty"`       // manual, schedule or anniversary
+	ScheduledFor       *time.Time `json:"scheduled_for,omitempty"` // schedule slot of an automatic run
+	ConfirmedAt        *time.Time `json:"confirmed_at,omitempty"`
+	StartedAt          time.Time  `json:"started_at"`
+	FinishedAt         *time.Time `json:"finished_at,omitempty"`
+	ReportRoot         string     `json:"report_root,omitempty"`       // root of the run's report, anchored on chain
+	AnchorTxID         string     `json:"anchor_txid,omitempty"`       // anchor transaction of ReportRoot
+	AnchorBlockHash    string     `json:"anchor_block_hash,omitempty"` // block holding the anchor
+}
+
+// ZakatRunItem is the per-wallet state of a zakat run.
+type ZakatRunItem struct {
+	ID            string    `json:"id"`      // uuid
+	RunID         string    `json:"run_id"`  // foreign key -> zakat_runs.id
+	WalletAddress string    `json:"wallet_address"`
+	UserID        string    `json:"user_id"`
+	Status        string    `json:"status"`  // pending, processing, done, skipped, failed
+	Amount        int       `json:"amount"`
+	TxID          string    `json:"txid,omitempty"` // the deduction, recorded before it is mined
+	BlockHash     string    `json:"block_hash,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Zakat run and run item statuses.
+const (
+	ZakatRunRunning   = "running"
+	ZakatRunCompleted = "completed"
+	ZakatRunPartial   = "partial"
+	ZakatRunPaused    = "paused"
+
+	ZakatTriggerManual      = "manual"
+	ZakatTriggerSchedule    = "schedule"
+	ZakatTriggerAnniversary = "anniversary"
+
+	ZakatItemPending    = "pending"
+	ZakatItemProcessing = "processing"
+	ZakatItemDone       = "done"
+	ZakatItemSkipped    = "skipped"
+	ZakatItemFailed     = "failed"
+)
+
+// SystemLog stores system-level log events.
+type SystemLog struct {
+	ID        string    `json:"id"`        // uuid
+	Level     string    `json:"level"`     // info, warn, error
+	Type      string    `json:"type"`      // login_attempt, otp_failed, invalid_wallet, rejected_tx, mining_event, zakat_run, etc.
+	Message   string    `json:"message"`
+	IP        string    `json:"ip"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Beneficiary is a recipient of zakat disbursements. The needs
+// assessment fields feed a score used to rank beneficiaries.
+type Beneficiary struct {
+	ID                string     `json:"id"` // uuid
+	TenantID          string     `json:"tenant_id,omitempty"`
+	FullName          string     `json:"full_name"`
+	CNIC              string     `json:"cnic"`
+	Category          string     `json:"category"` // fuqara, masakin, etc.
+	WalletAddress     string     `json:"wallet_address"`
+	PayoutMethod      string     `json:"payout_method"`       // "" for the wallet, or an external method such as stablecoin or bank
+	PayoutAccount     string     `json:"payout_account"`      // the beneficiary's account for PayoutMethod, e.g. an IBAN
+	PayoutAccountName string     `json:"payout_account_name"` // the account holder, when not the beneficiary
+	PayoutBankCode    string     `json:"payout_bank_code"`    // the BIC of the bank, for bank payouts
+	MobileNumber      string     `json:"mobile_number"`       // mobile wallet number, e.g. 923001234567
+	MobileProvider    string     `json:"mobile_provider"`     // jazzcash or easypaisa
+	HouseholdSize     int        `json:"household_size"`
+	MonthlyIncome     int        `json:"monthly_income"` // household income in local currency
+	DocumentsVerified bool       `json:"documents_verified"`
+	NeedsScore        int        `json:"needs_score"`    // computed, higher = more need
+	ScoreCriteria     []string   `json:"score_criteria"` // criteria that contributed to the score
+	Status            string     `json:"status"`         // pending, approved or suspended; only approved ones are paid
+	ApprovedBy        string     `json:"approved_by"`    // admin key name
+	ApprovedAt        *time.Time `json:"approved_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// SolvencyEpoch is a published proof-of-solvency commitment: the zakat
+// pool's on-chain holdings and the Merkle-sum root over the liabilities
+// (allocations pledged to beneficiaries) at one point in time.
+type SolvencyEpoch struct {
+	ID               string         `json:"id"` // uuid
+	TenantID         string         `json:"tenant_id,omitempty"`
+	PoolAddress      string         `json:"pool_address"`
+	PoolHoldings     int            `json:"pool_holdings"`
+	TotalLiabilities int            `json:"total_liabilities"`
+	RootHash         string         `json:"root_hash"`
+	Solvent          bool           `json:"solvent"`
+	Height           int            `json:"height"`    // chain height of the holdings
+	UTXORoot         string         `json:"utxo_root"` // Merkle root of the UTXO set at Height
+	Leaves           []SolvencyLeaf `json:"leaves"`    // private; needed to build inclusion proofs
+	CreatedAt        time.Time      `json:"created_at"`
+}
+
+// SolvencyLeaf is one committed liability of a solvency epoch.
+type SolvencyLeaf struct {
+	BeneficiaryID string `json:"beneficiary_id"`
+	Amount        int    `json:"amount"`
+	Salt          string `json:"salt"`
+}
+
+// TransactionNote is one compliance annotation on a transaction. Notes
+// are append-only; the latest one carries the transaction's current
+// compliance status.
+type TransactionNote struct {
+	ID        string    `json:"id"`         // uuid
+	TenantID  string    `json:"tenant_id,omitempty"`
+	TxID      string    `json:"txid"`       // foreign key -> transactions.txid
+	Status    string    `json:"status"`     // cleared, flagged
+	Note      string    `json:"note"`
+	Author    string    `json:"author"`     // compliance staff member who wrote the note
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Transaction compliance statuses.
+const (
+	ComplianceCleared = "cleared"
+	ComplianceFlagged = "flagged"
+)
+
+// EmailTemplate is a tenant's override of an embedded notification
+// email template. ID is "<tenant_id>/<name>" ("<name>" when unscoped) so
+// saving a template replaces the previous override.
+type EmailTemplate struct {
+	ID        string    `json:"id"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+	Name      string    `json:"name"`       // otp, receipt, zakat_reminder, disbursement_notice, admin_digest, pool_alert
+	Subject   string    `json:"subject"`    // text/template
+	Body      string    `json:"body"`       // html/template fragment
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NotificationDelivery records one notification sent to a user through
+// an external provider; provider status callbacks update Status.
+type NotificationDelivery struct {
+	ID                string    `json:"id"` // uuid
+	TenantID          string    `json:"tenant_id,omitempty"`
+	UserID            string    `json:"user_id"`
+	Channel           string    `json:"channel"` // whatsapp
+	Event             string    `json:"event"`   // otp or a preference event (incoming_funds, zakat_deduction, ...)
+	Recipient         string    `json:"recipient"`
+	ProviderMessageID string    `json:"provider_message_id,omitempty"`
+	Status            string    `json:"status"` // sent, delivered, read, failed
+	Error             string    `json:"error,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Notification events and delivery statuses. OTPs, held transfer and
+// reverted transfer notices always go to the user's notify_channel;
+// the other events follow their preferences.
+const (
+	NotifyEventOTP            = "otp"
+	NotifyEventTransferHeld   = "transfer_held"
+	NotifyEventTransferReverted = "transfer_reverted"
+	NotifyEventIncomingFunds  = "incoming_funds"
+	NotifyEventZakatDeduction = "zakat_deduction"
+	NotifyEventReminders      = "reminders"
+	NotifyEventMarketing      = "marketing"
+
+	DeliverySent   = "sent"
+	DeliveryFailed = "failed"
+)
+
+// NotificationPreferences maps each notification event of a user to the
+// channels (email, sms, push, whatsapp) it is delivered on.
+type NotificationPreferences struct {
+	UserID    string              `json:"user_id"` // primary key, foreign key -> users.id
+	TenantID  string              `json:"tenant_id,omitempty"`
+	Events    map[string][]string `json:"events"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+// ZakatPolicy is one version of a tenant's declarative zakat policy.
+// Versions are append-only; the highest version is in force and runs
+// record the version they applied.
+type ZakatPolicy struct {
+	ID        string          `json:"id"` // uuid
+	TenantID  string          `json:"tenant_id,omitempty"`
+	Version   int             `json:"version"`
+	Document  json.RawMessage `json:"document"` // zakat.Policy
+	CreatedBy string          `json:"created_by,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// FeatureFlag is a stored feature switch. A row without a tenant applies
+// to the whole environment and a tenant row overrides it. ID is
+// "<environment>/<tenant_id>/<key>" (tenant empty when unscoped) so
+// toggling a flag replaces the previous row.
+type FeatureFlag struct {
+	ID          string    `json:"id"`
+	Environment string    `json:"environment"`
+	TenantID    string    `json:"tenant_id,omitempty"`
+	Key         string    `json:"key"`
+	Enabled     bool      `json:"enabled"`
+	UpdatedBy   string    `json:"updated_by,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebAuthnCredential is a passkey registered by a user. ID is the
+// credential id and PublicKey the COSE key, both base64url encoded.
+type WebAuthnCredential struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	TenantID   string     `json:"tenant_id,omitempty"`
+	Name       string     `json:"name"`
+	PublicKey  string     `json:"public_key"`
+	Algorithm  int64      `json:"algorithm"` // COSE algorithm, e.g. -7 for ES256
+	SignCount  uint32     `json:"sign_count"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// TransactionPIN is a user's optional PIN for authorizing sends,
+// separate from login. Hash is the Argon2id hash in PHC format; after
+// too many wrong PINs LockedUntil is set.
+type TransactionPIN struct {
+	UserID         string     `json:"user_id"`
+	TenantID       string     `json:"tenant_id,omitempty"`
+	Hash           string     `json:"pin_hash"`
+	FailedAttempts int        `json:"failed_attempts"`
+	LockedUntil    *time.Time `json:"locked_until"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// HeldTransfer is a signed transfer held back for a cooling-off period
+// before it is mined. The sender's owner can cancel it until ReleaseAt
+// with the token whose SHA-256 is CancelTokenHash.
+type HeldTransfer struct {
+	ID              string     `json:"id"`
+	TenantID        string     `json:"tenant_id,omitempty"`
+	UserID          string     `json:"user_id,omitempty"` // owner of the sending wallet
+	FromAddress     string     `json:"from_address"`
+	ToAddress       string     `json:"to_address"`
+	Amount          int        `json:"amount"`
+	RawTx           string     `json:"raw_tx"` // hex of Transaction.Serialize
+	Reason          string     `json:"reason"` // amount, new_recipient
+	Status          string     `json:"status"`
+	CancelTokenHash string     `json:"cancel_token_hash"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ReleaseAt       time.Time  `json:"release_at"`
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+	BlockHash       string     `json:"block_hash,omitempty"`
+	Error           string     `json:"error,omitempty"`
+}
+
+// Held transfer statuses.
+const (
+	HeldTransferHeld      = "held"
+	HeldTransferReleased  = "released"
+	HeldTransferCancelled = "cancelled"
+	HeldTransferFailed    = "failed"
+)
+
+// DisbursementAck is a beneficiary's signed confirmation that a
+// disbursement from the zakat pool reached them. ID is
+// "<txid>/<wallet_address>" as one transaction may pay several
+// beneficiaries; Signature is the r||s ECDSA signature of Message by
+// PublicKey, whose SHA-256 is WalletAddress.
+type DisbursementAck struct {
+	ID             string    `json:"id"`
+	TenantID       string    `json:"tenant_id,omitempty"`
+	TxID           string    `json:"txid"`
+	WalletAddress  string    `json:"wallet_address"`
+	BeneficiaryID  string    `json:"beneficiary_id,omitempty"` // empty when the address is no registered beneficiary
+	Amount         int       `json:"amount"`
+	Message        string    `json:"message"`    // signed challenge
+	PublicKey      string    `json:"public_key"` // hex X||Y
+	Signature      string    `json:"signature"`  // hex r||s
+	AcknowledgedAt time.Time `json:"acknowledged_at"`
+}
+
+// APIAudit records one mutating API request for dispute resolution:
+// the request body with keys, PINs and other secrets redacted and a
+// summary of the response.
+type APIAudit struct {
+	ID              string    `json:"id"` // uuid
+	TenantID        string    `json:"tenant_id,omitempty"`
+	UserID          string    `json:"user_id,omitempty"` // session user, if any
+	Admin           string    `json:"admin,omitempty"`   // admin API key name, if any
+	Method          string    `json:"method"`
+	Path            string    `json:"path"`
+	Route           string    `json:"route"` // path template, e.g. /api/v1/zakat/runs/{id}/resume
+	WalletAddress   string    `json:"wallet_address,omitempty"`
+	TxIDs           []string  `json:"txids"` // transactions the request created or referenced
+	RequestBody     string    `json:"request_body"`
+	Status          int       `json:"status"`
+	ResponseSummary string    `json:"response_summary"`
+	IP              string    `json:"ip"`
+	DurationMS      int64     `json:"duration_ms"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// StealthPaymentRequest announces a one-time receive address. It holds
+// the ephemeral public key the receiving wallet scans with, but not the
+// wallet, so the stored requests do not link a beneficiary's payments
+// either.
+type StealthPaymentRequest struct {
+	ID                 string    `json:"id"` // uuid
+	TenantID           string    `json:"tenant_id,omitempty"`
+	Address            string    `json:"address"`              // one-time address
+	EphemeralPublicKey string    `json:"ephemeral_public_key"` // hex X||Y
+	Amount             int       `json:"amount,omitempty"`     // requested, 0 for any
+	Memo               string    `json:"memo,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// ViewKey grants an auditor read-only access to one wallet's history.
+// Only the SHA-256 of the key is stored; the key itself is shown to the
+// wallet's owner once, when it is issued.
+type ViewKey struct {
+	ID            string     `json:"id"` // uuid
+	TenantID      string     `json:"tenant_id,omitempty"`
+	WalletAddress string     `json:"wallet_address"`
+	Auditor       string     `json:"auditor"`
+	KeyHash       string     `json:"key_hash"`
+	CreatedBy     string     `json:"created_by"` // user id of the wallet's owner
+	CreatedAt     time.Time  `json:"created_at"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+}
+
+// WalletHandle maps a human-readable handle such as @amna to a wallet.
+// A handle has at most one active row; released rows are kept so that a
+// released handle can be held back from other users for a while.
+type WalletHandle struct {
+	ID            string     `json:"id"`     // uuid
+	Handle        string     `json:"handle"` // lower case, without the @
+	TenantID      string     `json:"tenant_id,omitempty"`
+	WalletAddress string     `json:"wallet_address"`
+	UserID        string     `json:"user_id"` // owner of the wallet when claimed
+	Status        string     `json:"status"`  // active, released
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	ReleasedAt    *time.Time `json:"released_at,omitempty"`
+}
+
+// Wallet handle statuses.
+const (
+	HandleActive   = "active"
+	HandleReleased = "released"
+)
+
+// Invitation is a send to the email or phone of someone who has not
+// registered yet. The funds wait on a one-time escrow address whose key
+// the server keeps; they go to the recipient's first wallet when they
+// register, or back to the sender once the invitation expires. Only a
+// hash of the contact is stored, plus a masked form for display.
+type Invitation struct {
+	ID            string     `json:"id"` // uuid
+	TenantID      string     `json:"tenant_id,omitempty"`
+	SenderUserID  string     `json:"sender_user_id,omitempty"`
+	FromAddress   string     `json:"from_address"`
+	ContactType   string     `json:"contact_type"` // email, phone
+	ContactHash   string     `json:"contact_hash"` // hex SHA-256 of the normalized contact
+	ContactMasked string     `json:"contact_masked"`
+	Amount        int        `json:"amount"`
+	Message       string     `json:"message,omitempty"`
+	EscrowAddress string     `json:"escrow_address"`
+	EscrowKey     string     `json:"escrow_key"` // hex private key; encrypted at rest with the PII keys
+	EscrowTxID    string     `json:"escrow_txid"`
+	Status        string     `json:"status"`               // pending, claimed, refunded, failed
+	ToAddress     string     `json:"to_address,omitempty"` // recipient wallet or, on refund, from
+	PayoutTxID    string     `json:"payout_txid,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+}
+
+// Invitation contact types and statuses.
+const (
+	ContactEmail = "email"
+	ContactPhone = "phone"
+
+	InvitationPending  = "pending"
+	InvitationClaimed  = "claimed"
+	InvitationRefunded = "refunded"
+	InvitationFailed   = "failed"
+)
+
+// DonationTag is a sender's classification of one of their transfers,
+// which the year-end tax summary adds up.
+type DonationTag struct {
+	TxID          string    `json:"txid"`
+	TenantID      string    `json:"tenant_id,omitempty"`
+	UserID        string    `json:"user_id"`
+	WalletAddress string    `json:"wallet_address"` // sending wallet
+	Recipient     string    `json:"recipient"`
+	Amount        int       `json:"amount"`
+	Category      string    `json:"category"` // zakat, sadaqah, other
+	TaxDeductible bool      `json:"tax_deductible"`
+	MinedAt       time.Time `json:"mined_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Donation categories.
+const (
+	DonationZakat   = "zakat"
+	DonationSadaqah = "sadaqah"
+	DonationOther   = "other"
+)
+
+// DonationDeclaration is a donor's declaration attached to a donation
+// to a charity's campaign, as government matching schemes (Gift Aid and
+// the like) require before the charity can claim on it. The donor's
+// name, home address and postcode are encrypted at rest.
+type DonationDeclaration struct {
+	ID            string     `json:"id"` // uuid
+	TxID          string     `json:"txid"`
+	TenantID      string     `json:"tenant_id,omitempty"` // the charity
+	CampaignID    string     `json:"campaign_id"`
+	UserID        string     `json:"user_id"`
+	WalletAddress string     `json:"wallet_address"` // donating wallet
+	Amount        int        `json:"amount"`
+	DonatedAt     time.Time  `json:"donated_at"`
+	FullName      string     `json:"full_name"`
+	HomeAddress   string     `json:"home_address"`
+	Postcode      string     `json:"postcode"`
+	Consent       bool       `json:"consent"`
+	DeclaredAt    time.Time  `json:"declared_at"`
+	WithdrawnAt   *time.Time `json:"withdrawn_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// TransactionReceipt records what a mined send did: the outputs it
+// spent, the outputs it created (including change back to the sender)
+// and the fee, which is whatever the inputs hold beyond the outputs.
+type TransactionReceipt struct {
+	TxID        string          `json:"txid"`
+	TenantID    string          `json:"tenant_id,omitempty"`
+	BlockHash   string          `json:"block_hash"`
+	BlockHeight int             `json:"block_height"`
+	From        string          `json:"from"`
+	To          string          `json:"to"`
+	Amount      int             `json:"amount"`
+	Inputs      []ReceiptInput  `json:"inputs"`
+	Outputs     []ReceiptOutput `json:"outputs"`
+	Fee         int             `json:"fee"`
+	Timestamp   time.Time       `json:"timestamp"` // of the block
+}
+
+// ReceiptInput is an output a transaction spent.
+type ReceiptInput struct {
+	Txid    string `json:"txid"`
+	Vout    int    `json:"vout"`
+	Address string `json:"address"`
+	Value   int    `json:"value"`
+}
+
+// ReceiptOutput is an output a transaction created.
+type ReceiptOutput struct {
+	Index   int    `json:"index"`
+	Address string `json:"address"`
+	Value   int    `json:"value"`
+	Change  bool   `json:"change"` // paid back to the sender
+}
+
+// Campaign is a fundraising appeal of an organization (tenant), listed
+// on the public donation portal while it is active. Donations are sent
+// to its wallet address; progress is what that address has received.
+type Campaign struct {
+	ID            string     `json:"id"` // uuid
+	TenantID      string     `json:"tenant_id,omitempty"`
+	Name          string     `json:"name"`
+	Description   string     `json:"description"`
+	Category      string     `json:"category"`
+	GoalAmount    int        `json:"goal_amount"`
+	WalletAddress string     `json:"wallet_address"`
+	Active        bool       `json:"active"`
+	EndsAt        *time.Time `json:"ends_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Digest frequencies.
+const (
+	DigestWeekly  = "weekly"
+	DigestMonthly = "monthly"
+)
+
+// DigestSubscription is an admin's subscription to the report email
+// digest of a tenant. ID is "<tenant_id>/<admin>" ("<admin>" when
+// unscoped), Admin the name of the admin API key. SentThrough is the
+// end of the last period a digest went out for.
+type DigestSubscription struct {
+	ID          string     `json:"id"`
+	TenantID    string     `json:"tenant_id,omitempty"`
+	Admin       string     `json:"admin"`
+	Email       string     `json:"email"`
+	Frequency   string     `json:"frequency"` // weekly, monthly
+	Active      bool       `json:"active"`
+	SentThrough time.Time  `json:"sent_through"`
+	LastSentAt  *time.Time `json:"last_sent_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Pledge statuses.
+const (
+	PledgePending   = "pending"
+	PledgeFulfilled = "fulfilled"
+	PledgeFailed    = "failed"
+	PledgeCancelled = "cancelled"
+)
+
+// Pledge is a commitment to give Amount to a campaign on DueDate. On
+// the due date the server pays it from the pledger's custodial wallet,
+// retrying a few times while the wallet lacks the funds.
+type Pledge struct {
+	ID            string     `json:"id"` // uuid
+	TenantID      string     `json:"tenant_id,omitempty"`
+	CampaignID    string     `json:"campaign_id"`
+	UserID        string     `json:"user_id"`
+	WalletAddress string     `json:"wallet_address"` // paid from
+	Amount        int        `json:"amount"`
+	DueDate       time.Time  `json:"due_date"`
+	Status        string     `json:"status"` // pending, fulfilled, failed, cancelled
+	Attempts      int        `json:"attempts"`
+	LastAttemptAt *time.Time `json:"last_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	RemindedAt    *time.Time `json:"reminded_at"`
+	TxID          string     `json:"txid,omitempty"`
+	BlockHash     string     `json:"block_hash,omitempty"`
+	FulfilledAt   *time.Time `json:"fulfilled_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// DisbursementShare is one beneficiary of a disbursement template and
+// the percentage of each disbursement it receives. A share names a
+// registered beneficiary, whose current wallet is paid, or a wallet
+// address directly.
+type DisbursementShare struct {
+	BeneficiaryID string  `json:"beneficiary_id,omitempty"`
+	WalletAddress string  `json:"wallet_address"`
+	Label         string  `json:"label,omitempty"`
+	Percent       float64 `json:"percent"`
+}
+
+// DisbursementTemplate is a fixed split of zakat pool disbursements
+// between beneficiaries. The percentages add up to 100.
+type DisbursementTemplate struct {
+	ID        string              `json:"id"`
+	TenantID  string              `json:"tenant_id,omitempty"`
+	Name      string              `json:"name"`
+	Shares    []DisbursementShare `json:"shares"`
+	CreatedBy string              `json:"created_by"` // admin key name
+	CreatedAt time.Time           `json:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+// Disbursement is one beneficiary's part of a distribution of the zakat
+// pool (POST /zakat/distribute). The parts of one distribution share
+// DistributionID and are paid in one transaction.
+type Disbursement struct {
+	ID             string    `json:"id"` // uuid
+	TenantID       string    `json:"tenant_id,omitempty"`
+	DistributionID string    `json:"distribution_id"`
+	BeneficiaryID  string    `json:"beneficiary_id"`
+	WalletAddress  string    `json:"wallet_address"`
+	PayoutMethod   string    `json:"payout_method"` // "" when paid to the beneficiary's wallet
+	Category       string    `json:"category"`
+	NeedsScore     int       `json:"needs_score"`    // the beneficiary's score when paid
+	ScoreCriteria  []string  `json:"score_criteria"` // and the criteria behind it
+	Amount         int       `json:"amount"`
+	PoolAddress    string    `json:"pool_address"`
+	Method         string    `json:"method"` // equal or needs
+	PolicyVersion  int       `json:"policy_version"`
+	TxID           string    `json:"txid"`
+	BlockHash      string    `json:"block_hash"`
+	CreatedBy      string    `json:"created_by"` // admin key name
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Payout statuses.
+const (
+	PayoutPending   = "pending"   // not yet accepted by the provider
+	PayoutSubmitted = "submitted" // accepted, awaiting the outcome
+	PayoutCompleted = "completed"
+	PayoutFailed    = "failed"
+)
+
+// Payout is the external transfer paying a disbursement to a
+// beneficiary who is paid outside the chain (see package payout). The
+// disbursement itself goes on chain to the settlement wallet that
+// funds the provider, or is burned when PAYOUT_POOL_MODE is burn.
+type Payout struct {
+	ID             string     `json:"id"` // uuid; the reference sent to the provider
+	TenantID       string     `json:"tenant_id,omitempty"`
+	DisbursementID string     `json:"disbursement_id"`
+	BeneficiaryID  string     `json:"beneficiary_id"`
+	Method         string     `json:"method"`
+	Account        string     `json:"account"`
+	Name           string     `json:"name"`      // the account holder's name
+	BankCode       string     `json:"bank_code"` // BIC, for bank payouts
+	Units          int        `json:"units"`
+	Burned         bool       `json:"burned"` // the units were burned on chain rather than moved to the settlement wallet
+	Amount         string     `json:"amount"` // in Currency, set when submitted
+	Currency       string     `json:"currency"`
+	Rate           float64    `json:"rate"`
+	Status         string     `json:"status"`
+	ExternalRef    string     `json:"external_ref"`
+	ProviderStatus string     `json:"provider_status"` // the provider's last reported status, e.g. processing
+	Error          string     `json:"error"`
+	Attempts       int        `json:"attempts"`
+	RetryID        string     `json:"retry_id"` // the payout retrying this failed one
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	CompletedAt    *time.Time `json:"completed_at"`
+}
+
+// ColdTransfer is a request to move funds from the cold wallet back to
+// the hot zakat pool. The cold wallet's key is kept offline, so the
+// transfer is signed by hand once enough admins approved it.
+type ColdTransfer struct {
+	ID          string     `json:"id"` // uuid
+	ColdAddress string     `json:"cold_address"`
+	PoolAddress string     `json:"pool_address"`
+	Amount      int        `json:"amount"`
+	Reason      string     `json:"reason"`
+	Status      string     `json:"status"`
+	RequestedBy string     `json:"requested_by"` // admin name
+	Approvals   []string   `json:"approvals"`    // admins who approved, the requester first
+	Required    int        `json:"required_approvals"`
+	Version     int        `json:"version"` // bumped by every update, for compare-and-set
+	CreatedAt   time.Time  `json:"created_at"`
+	ResolvedAt  *time.Time `json:"resolved_at"`
+	ResolvedBy  string     `json:"resolved_by"` // admin who rejected or executed it
+	TxID        string     `json:"txid"`
+	BlockHash   string     `json:"block_hash"`
+}
+
+// Cold transfer statuses.
+const (
+	ColdTransferPending  = "pending"  // waiting for approvals
+	ColdTransferApproved = "approved" // may be executed
+	ColdTransferExecuted = "executed"
+	ColdTransferRejected = "rejected"
+)
+
+// ChainAnchor is the hash of a block stamped with an external
+// timestamping service (see package notary). Proof is the service's
+// proof, hex-encoded, upgraded in place until it is confirmed.
+type ChainAnchor struct {
+	ID          string    `json:"id"` // uuid
+	Height      int       `json:"height"`
+	BlockHash   string    `json:"block_hash"`
+	Client      string    `json:"client"` // opentimestamps or http
+	Proof       string    `json:"proof"`
+	Status      string    `json:"status"`      // pending, attested, verified or invalid
+	Attestation string    `json:"attestation"` // e.g. "bitcoin block 812345"
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// IdempotencyKey is the outcome of a request made with an
+// Idempotency-Key, replayed to retries of the request until ExpiresAt.
+// Keys are scoped to the tenant and the sending address (Scope).
+type IdempotencyKey struct {
+	Key         string          `json:"key"`
+	TenantID    string          `json:"tenant_id,omitempty"`
+	Scope       string          `json:"scope"`
+	RequestHash string          `json:"request_hash"` // SHA-256 of the request's parameters
+	StatusCode  int             `json:"status_code"`
+	Response    json.RawMessage `json:"response"` // secrets redacted when stored
+	TxID        string          `json:"txid"`
+	BlockHash   string          `json:"block_hash"` // empty until mined
+	CreatedAt   time.Time       `json:"created_at"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+}
+
+// Bridge deposit statuses.
+const (
+	BridgeDepositPending   = "pending"   // waiting for confirmations or a price
+	BridgeDepositCrediting = "crediting" // credit being mined
+	BridgeDepositCredited  = "credited"
+	BridgeDepositIgnored   = "ignored" // worth less than one unit
+)
+
+// BridgeDeposit is a donation made on Bitcoin or Ethereum to an address
+// watched for a campaign (see package bridge), and its credit to the
+// campaign's wallet. ID is the deposit's ref, "<chain>:<txid>:<index>";
+// ExternalAmount is in satoshi or wei. Units is the credit, priced at
+// Rate units of the chain's coin per internal unit; TxID is the bridge
+// coinbase that paid it.
+type BridgeDeposit struct {
+	ID              string     `json:"id"`
+	TenantID        string     `json:"tenant_id,omitempty"`
+	Chain           string     `json:"chain"` // btc or eth
+	ExternalTxID    string     `json:"external_txid"`
+	ExternalIndex   int        `json:"external_index"`
+	ExternalAddress string     `json:"external_address"`
+	ExternalAmount  string     `json:"external_amount"`
+	Confirmations   int        `json:"confirmations"`
+	CampaignID      string     `json:"campaign_id"`
+	WalletAddress   string     `json:"wallet_address"`
+	Units           int        `json:"units"`
+	Rate            float64    `json:"rate"`
+	Status          string     `json:"status"`
+	Error           string     `json:"error,omitempty"`
+	TxID            string     `json:"txid,omitempty"`
+	BlockHash       string     `json:"block_hash,omitempty"`
+	DetectedAt      time.Time  `json:"detected_at"`
+	CreditedAt      *time.Time `json:"credited_at"`
+}
+
+// DistributedLock is a lease on a named lock shared by the API
+// replicas (see package lock). Token identifies the holder.
+type DistributedLock struct {
+	Name      string    `json:"name"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,98 @@
+package notary
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// HTTPClient stamps digests with a timestamping service speaking a
+// small JSON protocol, for services other than OpenTimestamps:
+//
+//	POST {URL}/stamp   {"digest": hex}          -> {"proof": base64}
+//	POST {URL}/upgrade {"digest": hex, "proof"} -> {"proof": base64}
+//	POST {URL}/verify  {"digest": hex, "proof"} -> Result
+//
+// Token, when set, is sent as a bearer token.
+type HTTPClient struct {
+	URL   string
+	Token string
+	HTTP  *http.Client
+}
+
+func (c *HTTPClient) Name() string { return ClientHTTP }
+
+type httpRequest struct {
+	Digest string `json:"digest"`
+	Proof  []byte `json:"proof,omitempty"`
+}
+
+type httpProof struct {
+	Proof []byte `json:"proof"`
+}
+
+func (c *HTTPClient) Stamp(ctx context.Context, digest []byte) ([]byte, error) {
+	var resp httpProof
+	if err := c.post(ctx, "/stamp", httpRequest{Digest: hex.EncodeToString(digest)}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Proof) == 0 {
+		return nil, fmt.Errorf("%s/stamp: empty proof", c.URL)
+	}
+	return resp.Proof, nil
+}
+
+func (c *HTTPClient) Upgrade(ctx context.Context, digest, proof []byte) ([]byte, error) {
+	var resp httpProof
+	if err := c.post(ctx, "/upgrade", httpRequest{Digest: hex.EncodeToString(digest), Proof: proof}, &resp); err != nil {
+		return proof, err
+	}
+	if len(resp.Proof) == 0 {
+		return proof, nil
+	}
+	return resp.Proof, nil
+}
+
+func (c *HTTPClient) Verify(ctx context.Context, digest, proof []byte) (Result, error) {
+	var res Result
+	if err := c.post(ctx, "/verify", httpRequest{Digest: hex.EncodeToString(digest), Proof: proof}, &res); err != nil {
+		return Result{}, err
+	}
+	switch res.Status {
+	case StatusPending, StatusAttested, StatusVerified, StatusInvalid:
+	default:
+		return Result{}, fmt.Errorf("%s/verify: unknown status %q", c.URL, res.Status)
+	}
+	if res.Attestations == nil {
+		res.Attestations = []Attestation{}
+	}
+	return res, nil
+}
+
+func (c *HTTPClient) post(ctx context.Context, path string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s%s: %s", c.URL, path, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponse)).Decode(out)
+}
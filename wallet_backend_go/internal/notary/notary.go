@@ -0,0 +1,147 @@
+// Package notary anchors the chain in a public network through an
+// external timestamping service, so that anyone can check that the
+// chain up to an anchored block existed at the time and has not been
+// rewritten since. The hash of the tip block is stamped with a Client
+// (ANCHOR_CLIENT): "opentimestamps" submits it to OpenTimestamps
+// calendars, which commit it to Bitcoin within hours, and "http" to a
+// timestamping service speaking the small JSON protocol of HTTPClient.
+// A stamp starts out pending; Upgrade fetches the completed proof once
+// the service has committed it, and Verify checks a proof.
+package notary
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Verification outcomes of a proof.
+const (
+	// StatusPending means the service has the digest but has not yet
+	// committed it to the public network.
+	StatusPending = "pending"
+	// StatusAttested means the proof ends in an attestation of the
+	// public network that was not checked against it (no
+	// ANCHOR_BITCOIN_API).
+	StatusAttested = "attested"
+	// StatusVerified means the proof was checked against the public
+	// network.
+	StatusVerified = "verified"
+	// StatusInvalid means the proof does not commit to the digest or
+	// disagrees with the public network.
+	StatusInvalid = "invalid"
+)
+
+// Client names, the values of ANCHOR_CLIENT.
+const (
+	ClientOpenTimestamps = "opentimestamps"
+	ClientHTTP           = "http"
+)
+
+// requestTimeout bounds every call to a service.
+const requestTimeout = 30 * time.Second
+
+// Client stamps digests with an external timestamping service. Proofs
+// are opaque bytes in the client's own format.
+type Client interface {
+	// Name identifies the client in stored anchors.
+	Name() string
+	// Stamp submits digest and returns the service's proof of receipt.
+	Stamp(ctx context.Context, digest []byte) ([]byte, error)
+	// Upgrade returns proof completed with whatever the service has
+	// committed since, or proof itself when nothing changed.
+	Upgrade(ctx context.Context, digest, proof []byte) ([]byte, error)
+	// Verify checks that proof commits digest to the public network.
+	Verify(ctx context.Context, digest, proof []byte) (Result, error)
+}
+
+// Result is the outcome of verifying a proof.
+type Result struct {
+	Status       string        `json:"status"` // pending, attested, verified or invalid
+	Attestations []Attestation `json:"attestations"`
+	Reason       string        `json:"reason,omitempty"` // why the proof is invalid
+}
+
+// Attestation is one statement a proof ends in.
+type Attestation struct {
+	Kind          string `json:"kind"`                     // pending, bitcoin or the service's own
+	Calendar      string `json:"calendar,omitempty"`       // service that will complete a pending attestation
+	BitcoinHeight int    `json:"bitcoin_height,omitempty"` // block whose Merkle root commits the digest
+	BitcoinBlock  string `json:"bitcoin_block,omitempty"`  // hash of that block, when checked
+}
+
+// Summary describes the strongest attestation of r, e.g. "bitcoin
+// block 812345".
+func (r Result) Summary() string {
+	for _, a := range r.Attestations {
+		if a.Kind == "bitcoin" {
+			return fmt.Sprintf("bitcoin block %d", a.BitcoinHeight)
+		}
+	}
+	for _, a := range r.Attestations {
+		if a.Kind != "pending" {
+			return a.Kind
+		}
+	}
+	if len(r.Attestations) > 0 {
+		return "pending at " + r.Attestations[0].Calendar
+	}
+	return ""
+}
+
+// NewFromEnv returns the client selected by ANCHOR_CLIENT, or nil when
+// anchoring is not configured. ANCHOR_URL lists the OpenTimestamps
+// calendars (comma-separated, by default the public ones) or the base
+// URL of the HTTP service, sent ANCHOR_TOKEN as a bearer token.
+// ANCHOR_BITCOIN_API is the base URL of an Esplora API (e.g.
+// https://blockstream.info/api) used to check Bitcoin attestations.
+func NewFromEnv() (Client, error) {
+	kind := strings.ToLower(strings.TrimSpace(os.Getenv("ANCHOR_CLIENT")))
+	if kind == "" {
+		return nil, nil
+	}
+	urls, err := splitURLs(os.Getenv("ANCHOR_URL"))
+	if err != nil {
+		return nil, err
+	}
+	hc := &http.Client{Timeout: requestTimeout}
+	switch kind {
+	case ClientOpenTimestamps:
+		if len(urls) == 0 {
+			urls = DefaultCalendars
+		}
+		return &OpenTimestamps{
+			Calendars:  urls,
+			BitcoinAPI: strings.TrimRight(strings.TrimSpace(os.Getenv("ANCHOR_BITCOIN_API")), "/"),
+			HTTP:       hc,
+		}, nil
+	case ClientHTTP:
+		if len(urls) != 1 {
+			return nil, fmt.Errorf("ANCHOR_CLIENT=http needs one ANCHOR_URL")
+		}
+		return &HTTPClient{URL: urls[0], Token: os.Getenv("ANCHOR_TOKEN"), HTTP: hc}, nil
+	default:
+		return nil, fmt.Errorf("unknown ANCHOR_CLIENT %q (want opentimestamps or http)", kind)
+	}
+}
+
+// splitURLs parses a comma-separated list of http or https base URLs.
+func splitURLs(v string) ([]string, error) {
+	var urls []string
+	for _, u := range strings.Split(v, ",") {
+		u = strings.TrimRight(strings.TrimSpace(u), "/")
+		if u == "" {
+			continue
+		}
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("ANCHOR_URL %q: want an http or https base URL", u)
+		}
+		urls = append(urls, u)
+	}
+	return urls, nil
+}
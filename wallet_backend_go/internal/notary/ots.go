@@ -0,0 +1,591 @@
+package notary
+
+// ots.go is a client for OpenTimestamps calendars. A calendar answers
+// a submitted digest with a timestamp: the operations (append, prepend,
+// sha256) that lead from the digest to a commitment of the calendar,
+// ending in a pending attestation. Once the calendar has put a Merkle
+// root of its commitments into a Bitcoin transaction, hours later, it
+// serves the rest of the path, from the commitment to the Merkle root
+// of the Bitcoin block, ending in a Bitcoin attestation. Proofs are
+// kept in the OpenTimestamps timestamp encoding, so OTSFile turns one
+// into a file the standard ots tool verifies.
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultCalendars are the public OpenTimestamps calendars the
+// reference client submits to.
+var DefaultCalendars = []string{
+	"https://a.pool.opentimestamps.org",
+	"https://b.pool.opentimestamps.org",
+	"https://a.pool.eternitywall.com",
+	"https://ots.btc.catallaxy.com",
+}
+
+// trustedCalendarHosts are the domains whose calendars may complete a
+// pending attestation, besides the configured calendars. The pools
+// above aggregate for calendars under these.
+var trustedCalendarHosts = []string{
+	".calendar.opentimestamps.org",
+	".calendar.eternitywall.com",
+	".calendar.catallaxy.com",
+}
+
+// Encoding of OpenTimestamps timestamps.
+const (
+	tagAttestation = 0x00
+	tagFork        = 0xff
+
+	opSHA256  = 0x08
+	opAppend  = 0xf0
+	opPrepend = 0xf1
+	opReverse = 0xf2
+	opHexlify = 0xf3
+
+	maxMsgLen   = 4096
+	maxOpArg    = 4096
+	maxPayload  = 8192
+	maxDepth    = 1024
+	maxResponse = 1 << 16
+)
+
+var (
+	attPending = []byte{0x83, 0xdf, 0xe3, 0x0d, 0x2e, 0xf9, 0x0c, 0x8e}
+	attBitcoin = []byte{0x05, 0x88, 0x96, 0x0d, 0x73, 0xd7, 0x19, 0x01}
+
+	otsMagic = []byte("\x00OpenTimestamps\x00\x00Proof\x00\xbf\x89\xe2\xe8\x84\xe8\x92\x94")
+)
+
+// OpenTimestamps stamps digests with OpenTimestamps calendars.
+type OpenTimestamps struct {
+	Calendars  []string
+	BitcoinAPI string // Esplora base URL; empty leaves Bitcoin attestations unchecked
+	HTTP       *http.Client
+}
+
+func (c *OpenTimestamps) Name() string { return ClientOpenTimestamps }
+
+// Stamp submits digest to every calendar and returns their receipts
+// merged into one timestamp. It fails only when no calendar answered.
+func (c *OpenTimestamps) Stamp(ctx context.Context, digest []byte) ([]byte, error) {
+	root := &timestamp{}
+	var errs []error
+	for _, cal := range c.Calendars {
+		body, _, err := c.fetch(ctx, http.MethodPost, cal+"/digest", digest)
+		if err == nil {
+			var t *timestamp
+			if t, err = decodeTimestamp(body); err == nil {
+				err = t.walk(digest, func(*timestamp, attestation, []byte) {})
+			}
+			if err == nil {
+				root.merge(t)
+				continue
+			}
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", cal, err))
+	}
+	if root.empty() {
+		return nil, fmt.Errorf("no calendar stamped the digest: %w", errors.Join(errs...))
+	}
+	return root.encode(nil), nil
+}
+
+// Upgrade asks the calendar of every pending attestation not yet
+// completed for the rest of the path and merges what it serves.
+func (c *OpenTimestamps) Upgrade(ctx context.Context, digest, proof []byte) ([]byte, error) {
+	root, err := decodeTimestamp(proof)
+	if err != nil {
+		return proof, err
+	}
+	type pending struct {
+		node       *timestamp
+		calendar   string
+		commitment []byte
+	}
+	var todo []pending
+	err = root.walk(digest, func(node *timestamp, a attestation, msg []byte) {
+		if !bytes.Equal(a.tag, attPending) || node.has(attBitcoin) {
+			return
+		}
+		if uri, ok := pendingURI(a.payload); ok && c.trusted(uri) {
+			todo = append(todo, pending{node: node, calendar: uri, commitment: msg})
+		}
+	})
+	if err != nil {
+		return proof, err
+	}
+
+	changed := false
+	var errs []error
+	for _, p := range todo {
+		body, found, err := c.fetch(ctx, http.MethodGet, p.calendar+"/timestamp/"+hex.EncodeToString(p.commitment), nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.calendar, err))
+			continue
+		}
+		if !found {
+			continue // not in a Bitcoin block yet
+		}
+		t, err := decodeTimestamp(body)
+		if err == nil {
+			err = t.walk(p.commitment, func(*timestamp, attestation, []byte) {})
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.calendar, err))
+			continue
+		}
+		p.node.merge(t)
+		changed = true
+	}
+	if !changed {
+		return proof, errors.Join(errs...)
+	}
+	return root.encode(nil), nil
+}
+
+// Verify follows proof from digest to its attestations. Bitcoin
+// attestations are checked against the block's Merkle root when
+// BitcoinAPI is set.
+func (c *OpenTimestamps) Verify(ctx context.Context, digest, proof []byte) (Result, error) {
+	res := Result{Status: StatusPending, Attestations: []Attestation{}}
+	root, err := decodeTimestamp(proof)
+	if err != nil {
+		res.Status, res.Reason = StatusInvalid, err.Error()
+		return res, nil
+	}
+	type claim struct {
+		at     int
+		height int
+		root   []byte
+	}
+	var claims []claim
+	err = root.walk(digest, func(_ *timestamp, a attestation, msg []byte) {
+		switch {
+		case bytes.Equal(a.tag, attPending):
+			uri, _ := pendingURI(a.payload)
+			res.Attestations = append(res.Attestations, Attestation{Kind: "pending", Calendar: uri})
+		case bytes.Equal(a.tag, attBitcoin):
+			height, ok := bitcoinHeight(a.payload)
+			if !ok {
+				return
+			}
+			claims = append(claims, claim{at: len(res.Attestations), height: height, root: msg})
+			res.Attestations = append(res.Attestations, Attestation{Kind: "bitcoin", BitcoinHeight: height})
+		default:
+			res.Attestations = append(res.Attestations, Attestation{Kind: "unknown"})
+		}
+	})
+	if err != nil {
+		res.Status, res.Reason = StatusInvalid, err.Error()
+		return res, nil
+	}
+	if len(claims) == 0 {
+		return res, nil
+	}
+	res.Status = StatusAttested
+	if c.BitcoinAPI == "" {
+		return res, nil
+	}
+
+	for _, cl := range claims {
+		hash, merkleRoot, err := c.bitcoinBlock(ctx, cl.height)
+		if err != nil {
+			return res, fmt.Errorf("bitcoin block %d: %w", cl.height, err)
+		}
+		// the attested message is the Merkle root in internal byte
+		// order; block explorers show it reversed
+		if len(cl.root) != sha256.Size || merkleRoot != hex.EncodeToString(reversed(cl.root)) {
+			res.Status = StatusInvalid
+			res.Reason = fmt.Sprintf("bitcoin block %d does not commit the digest", cl.height)
+			return res, nil
+		}
+		res.Attestations[cl.at].BitcoinBlock = hash
+	}
+	res.Status = StatusVerified
+	return res, nil
+}
+
+// OTSFile returns proof as a detached .ots file for digest, taken as
+// the SHA-256 of the stamped data, for `ots verify -d <digest>`.
+func OTSFile(digest, proof []byte) []byte {
+	buf := append([]byte(nil), otsMagic...)
+	buf = appendVaruint(buf, 1)
+	buf = append(buf, opSHA256)
+	buf = append(buf, digest...)
+	return append(buf, proof...)
+}
+
+// trusted reports whether uri may complete a pending attestation: a
+// configured calendar or an https calendar of a known operator.
+func (c *OpenTimestamps) trusted(uri string) bool {
+	for _, cal := range c.Calendars {
+		if uri == cal {
+			return true
+		}
+	}
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Port() != "" || strings.Trim(u.Path, "/") != "" {
+		return false
+	}
+	for _, suffix := range trustedCalendarHosts {
+		if strings.HasSuffix(u.Host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetch sends a request to a calendar and returns the response body,
+// or found=false for 404, which calendars answer for commitments not
+// yet in a Bitcoin block.
+func (c *OpenTimestamps) fetch(ctx context.Context, method, u string, body []byte) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Accept", "application/vnd.opentimestamps.v1")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound && method == http.MethodGet:
+		return nil, false, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, false, fmt.Errorf("%s %s: %s", method, u, resp.Status)
+	}
+	out, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	return out, true, err
+}
+
+// bitcoinBlock returns the hash and Merkle root of the Bitcoin block at
+// height from the Esplora API.
+func (c *OpenTimestamps) bitcoinBlock(ctx context.Context, height int) (string, string, error) {
+	hash, _, err := c.fetch(ctx, http.MethodGet, c.BitcoinAPI+"/block-height/"+strconv.Itoa(height), nil)
+	if err != nil {
+		return "", "", err
+	}
+	if hash == nil {
+		return "", "", fmt.Errorf("no block at height %d", height)
+	}
+	body, _, err := c.fetch(ctx, http.MethodGet, c.BitcoinAPI+"/block/"+url.PathEscape(strings.TrimSpace(string(hash))), nil)
+	if err != nil {
+		return "", "", err
+	}
+	var block struct {
+		ID         string `json:"id"`
+		MerkleRoot string `json:"merkle_root"`
+	}
+	if err := json.Unmarshal(body, &block); err != nil {
+		return "", "", err
+	}
+	return block.ID, strings.ToLower(block.MerkleRoot), nil
+}
+
+// timestamp is a node of an OpenTimestamps proof: the attestations of
+// the message at this node and the operations leading on from it.
+type timestamp struct {
+	attestations []attestation
+	ops          []branch
+}
+
+type attestation struct {
+	tag     []byte // 8 bytes
+	payload []byte
+}
+
+type branch struct {
+	op   op
+	next *timestamp
+}
+
+type op struct {
+	tag byte
+	arg []byte // append and prepend only
+}
+
+func (t *timestamp) empty() bool {
+	return len(t.attestations) == 0 && len(t.ops) == 0
+}
+
+// has reports whether t or a node after it carries an attestation
+// tagged tag.
+func (t *timestamp) has(tag []byte) bool {
+	for _, a := range t.attestations {
+		if bytes.Equal(a.tag, tag) {
+			return true
+		}
+	}
+	for _, b := range t.ops {
+		if b.next.has(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// merge adds the attestations and operations of o to t.
+func (t *timestamp) merge(o *timestamp) {
+	for _, a := range o.attestations {
+		dup := false
+		for _, mine := range t.attestations {
+			dup = dup || (bytes.Equal(a.tag, mine.tag) && bytes.Equal(a.payload, mine.payload))
+		}
+		if !dup {
+			t.attestations = append(t.attestations, a)
+		}
+	}
+next:
+	for _, b := range o.ops {
+		for _, mine := range t.ops {
+			if mine.op.tag == b.op.tag && bytes.Equal(mine.op.arg, b.op.arg) {
+				mine.next.merge(b.next)
+				continue next
+			}
+		}
+		t.ops = append(t.ops, b)
+	}
+}
+
+// walk calls fn with every attestation after t and the message it
+// attests, t's message being msg.
+func (t *timestamp) walk(msg []byte, fn func(node *timestamp, a attestation, msg []byte)) error {
+	for _, a := range t.attestations {
+		fn(t, a, msg)
+	}
+	for _, b := range t.ops {
+		next, err := b.op.apply(msg)
+		if err != nil {
+			return err
+		}
+		if err := b.next.walk(next, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o op) apply(msg []byte) ([]byte, error) {
+	var out []byte
+	switch o.tag {
+	case opSHA256:
+		h := sha256.Sum256(msg)
+		out = h[:]
+	case opAppend:
+		out = append(append([]byte(nil), msg...), o.arg...)
+	case opPrepend:
+		out = append(append([]byte(nil), o.arg...), msg...)
+	case opReverse:
+		out = reversed(msg)
+	case opHexlify:
+		out = []byte(hex.EncodeToString(msg))
+	default:
+		return nil, fmt.Errorf("unsupported operation 0x%02x", o.tag)
+	}
+	if len(out) > maxMsgLen {
+		return nil, errors.New("timestamp message too long")
+	}
+	return out, nil
+}
+
+// encode appends the OpenTimestamps encoding of t to buf: every item
+// but the last is preceded by a fork marker.
+func (t *timestamp) encode(buf []byte) []byte {
+	n := len(t.attestations) + len(t.ops)
+	i := 0
+	for _, a := range t.attestations {
+		if i++; i < n {
+			buf = append(buf, tagFork)
+		}
+		buf = append(buf, tagAttestation)
+		buf = append(buf, a.tag...)
+		buf = appendVarbytes(buf, a.payload)
+	}
+	for _, b := range t.ops {
+		if i++; i < n {
+			buf = append(buf, tagFork)
+		}
+		buf = append(buf, b.op.tag)
+		if b.op.tag == opAppend || b.op.tag == opPrepend {
+			buf = appendVarbytes(buf, b.op.arg)
+		}
+		buf = b.next.encode(buf)
+	}
+	return buf
+}
+
+// decodeTimestamp parses an encoded timestamp, which must use all of
+// data.
+func decodeTimestamp(data []byte) (*timestamp, error) {
+	r := &reader{b: data}
+	t, err := r.timestamp(0)
+	if err != nil {
+		return nil, fmt.Errorf("decode timestamp: %w", err)
+	}
+	if r.pos != len(data) {
+		return nil, errors.New("decode timestamp: trailing data")
+	}
+	return t, nil
+}
+
+type reader struct {
+	b   []byte
+	pos int
+}
+
+func (r *reader) timestamp(depth int) (*timestamp, error) {
+	if depth > maxDepth {
+		return nil, errors.New("timestamp too deep")
+	}
+	t := &timestamp{}
+	for {
+		tag, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		fork := tag == tagFork
+		if fork {
+			if tag, err = r.byte(); err != nil {
+				return nil, err
+			}
+		}
+		if err := r.item(t, tag, depth); err != nil {
+			return nil, err
+		}
+		if !fork {
+			return t, nil
+		}
+	}
+}
+
+func (r *reader) item(t *timestamp, tag byte, depth int) error {
+	if tag == tagAttestation {
+		atag, err := r.bytes(len(attPending))
+		if err != nil {
+			return err
+		}
+		payload, err := r.varbytes(maxPayload)
+		if err != nil {
+			return err
+		}
+		t.attestations = append(t.attestations, attestation{tag: atag, payload: payload})
+		return nil
+	}
+	o := op{tag: tag}
+	switch tag {
+	case opAppend, opPrepend:
+		arg, err := r.varbytes(maxOpArg)
+		if err != nil {
+			return err
+		}
+		o.arg = arg
+	case opSHA256, opReverse, opHexlify:
+	default:
+		return fmt.Errorf("unsupported operation 0x%02x", tag)
+	}
+	next, err := r.timestamp(depth + 1)
+	if err != nil {
+		return err
+	}
+	t.ops = append(t.ops, branch{op: o, next: next})
+	return nil
+}
+
+func (r *reader) byte() (byte, error) {
+	if r.pos >= len(r.b) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	r.pos++
+	return r.b[r.pos-1], nil
+}
+
+func (r *reader) bytes(n int) ([]byte, error) {
+	if n < 0 || len(r.b)-r.pos < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	r.pos += n
+	return append([]byte(nil), r.b[r.pos-n:r.pos]...), nil
+}
+
+// varuint reads an unsigned LEB128 number.
+func (r *reader) varuint() (uint64, error) {
+	var n uint64
+	for shift := uint(0); shift < 63; shift += 7 {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		n |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return n, nil
+		}
+	}
+	return 0, errors.New("varuint too long")
+}
+
+func (r *reader) varbytes(max int) ([]byte, error) {
+	n, err := r.varuint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(max) {
+		return nil, errors.New("value too long")
+	}
+	return r.bytes(int(n))
+}
+
+func appendVaruint(buf []byte, n uint64) []byte {
+	for n >= 0x80 {
+		buf = append(buf, byte(n)|0x80)
+		n >>= 7
+	}
+	return append(buf, byte(n))
+}
+
+func appendVarbytes(buf, b []byte) []byte {
+	return append(appendVaruint(buf, uint64(len(b))), b...)
+}
+
+// pendingURI returns the calendar URI of a pending attestation.
+func pendingURI(payload []byte) (string, bool) {
+	r := &reader{b: payload}
+	uri, err := r.varbytes(1000)
+	if err != nil || r.pos != len(payload) {
+		return "", false
+	}
+	return string(uri), true
+}
+
+// bitcoinHeight returns the block height of a Bitcoin attestation.
+func bitcoinHeight(payload []byte) (int, bool) {
+	r := &reader{b: payload}
+	n, err := r.varuint()
+	if err != nil || r.pos != len(payload) || n > 1<<31 {
+		return 0, false
+	}
+	return int(n), true
+}
+
+func reversed(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[len(b)-1-i] = b[i]
+	}
+	return out
+}
@@ -0,0 +1,78 @@
+package notify
+
+// email.go sends HTML emails over SMTP. It is used for the messages
+// rendered from the email templates (see package templates).
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultSMTPPort = "587"
+
+// Email is an SMTP provider.
+type Email struct {
+	Addr     string // host:port
+	From     string
+	Username string
+	Password string
+}
+
+// NewEmailFromEnv configures the provider from SMTP_HOST, EMAIL_FROM
+// and optionally SMTP_PORT, SMTP_USERNAME and SMTP_PASSWORD. It returns
+// nil when email is not configured.
+func NewEmailFromEnv() *Email {
+	host := os.Getenv("SMTP_HOST")
+	from := os.Getenv("EMAIL_FROM")
+	if host == "" || from == "" {
+		return nil
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = defaultSMTPPort
+	}
+	return &Email{
+		Addr:     net.JoinHostPort(host, port),
+		From:     from,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+	}
+}
+
+// SendHTML sends an HTML email to one recipient. smtp.SendMail does not
+// take a context, so ctx is only checked before sending.
+func (e *Email) SendHTML(ctx context.Context, to, subject, html string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("invalid recipient %q", to)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=utf-8\r\n\r\n")
+	msg.WriteString(html)
+
+	var auth smtp.Auth
+	if e.Username != "" {
+		host, _, _ := net.SplitHostPort(e.Addr)
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+	if err := smtp.SendMail(e.Addr, auth, e.From, []string{to}, msg.Bytes()); err != nil {
+		return fmt.Errorf("smtp send error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Package notify delivers user notifications (OTPs, zakat receipts)
+// over external messaging channels. Each channel is a Notifier; the API
+// picks one per user from their preferred channel and records every
+// delivery so provider status callbacks can be matched to it.
+package notify
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// Channels.
+const (
+	ChannelEmail    = "email"
+	ChannelSMS      = "sms"
+	ChannelPush     = "push"
+	ChannelWhatsApp = "whatsapp"
+)
+
+// Channels lists every channel a user may choose.
+var Channels = []string{ChannelEmail, ChannelSMS, ChannelPush, ChannelWhatsApp}
+
+// ValidChannel reports whether c is one of Channels.
+func ValidChannel(c string) bool {
+	for _, ch := range Channels {
+		if ch == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Message is a plain-text notification to one recipient.
+type Message struct {
+	To   string // channel-specific address (phone number for WhatsApp)
+	Text string
+}
+
+// Notifier sends messages over one channel.
+type Notifier interface {
+	// Channel names the channel, e.g. ChannelWhatsApp.
+	Channel() string
+	// Send delivers msg and returns the provider's message id, which
+	// later status callbacks refer to.
+	Send(ctx context.Context, msg Message) (string, error)
+}
+
+var phonePattern = regexp.MustCompile(`^[1-9][0-9]{7,14}$`)
+
+// NormalizePhone returns phone as E.164 digits without the leading "+",
+// spaces or dashes, or "" if it is not a valid international number.
+func NormalizePhone(phone string) string {
+	p := strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(phone)
+	p = strings.TrimPrefix(p, "+")
+	if !phonePattern.MatchString(p) {
+		return ""
+	}
+	return p
+}
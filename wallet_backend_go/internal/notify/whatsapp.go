@@ -0,0 +1,185 @@
+package notify
+
+// whatsapp.go sends text messages through the WhatsApp Business Cloud
+// API and parses its delivery status webhooks.
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultWhatsAppAPIURL = "https://graph.facebook.com/v19.0"
+
+// WhatsApp is the WhatsApp Business Cloud API provider.
+type WhatsApp struct {
+	APIURL        string
+	PhoneNumberID string
+	Token         string
+	Client        *http.Client
+}
+
+// NewWhatsAppFromEnv configures the provider from WHATSAPP_TOKEN,
+// WHATSAPP_PHONE_NUMBER_ID and optionally WHATSAPP_API_URL. It returns
+// nil when the channel is not configured.
+func NewWhatsAppFromEnv() *WhatsApp {
+	token := os.Getenv("WHATSAPP_TOKEN")
+	phoneID := os.Getenv("WHATSAPP_PHONE_NUMBER_ID")
+	if token == "" || phoneID == "" {
+		return nil
+	}
+
+	apiURL := os.Getenv("WHATSAPP_API_URL")
+	if apiURL == "" {
+		apiURL = defaultWhatsAppAPIURL
+	}
+	return &WhatsApp{
+		APIURL:        strings.TrimRight(apiURL, "/"),
+		PhoneNumberID: phoneID,
+		Token:         token,
+		Client:        &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Channel implements Notifier.
+func (w *WhatsApp) Channel() string { return ChannelWhatsApp }
+
+type whatsAppText struct {
+	Body string `json:"body"`
+}
+
+type whatsAppSendRequest struct {
+	MessagingProduct string       `json:"messaging_product"`
+	To               string       `json:"to"`
+	Type             string       `json:"type"`
+	Text             whatsAppText `json:"text"`
+}
+
+type whatsAppSendResponse struct {
+	Messages []struct {
+		ID string `json:"id"`
+	} `json:"messages"`
+}
+
+// Send implements Notifier.
+func (w *WhatsApp) Send(ctx context.Context, msg Message) (string, error) {
+	payload, err := json.Marshal(whatsAppSendRequest{
+		MessagingProduct: "whatsapp",
+		To:               msg.To,
+		Type:             "text",
+		Text:             whatsAppText{Body: msg.Text},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/%s/messages", w.APIURL, w.PhoneNumberID), bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+w.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("whatsapp send error: %s - %s", resp.Status, string(body))
+	}
+
+	var out whatsAppSendResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("decode whatsapp response: %w", err)
+	}
+	if len(out.Messages) == 0 {
+		return "", fmt.Errorf("whatsapp response has no message id")
+	}
+	return out.Messages[0].ID, nil
+}
+
+// DeliveryStatus is one status update from a provider callback.
+type DeliveryStatus struct {
+	MessageID string
+	Status    string // sent, delivered, read, failed
+	Recipient string
+	Timestamp time.Time
+	Error     string
+}
+
+type whatsAppWebhook struct {
+	Entry []struct {
+		Changes []struct {
+			Value struct {
+				Statuses []struct {
+					ID          string `json:"id"`
+					Status      string `json:"status"`
+					Timestamp   string `json:"timestamp"`
+					RecipientID string `json:"recipient_id"`
+					Errors      []struct {
+						Code  int    `json:"code"`
+						Title string `json:"title"`
+					} `json:"errors"`
+				} `json:"statuses"`
+			} `json:"value"`
+		} `json:"changes"`
+	} `json:"entry"`
+}
+
+// ParseWhatsAppWebhook extracts the delivery statuses from a webhook
+// payload. Payloads without statuses (e.g. incoming messages) yield an
+// empty slice.
+func ParseWhatsAppWebhook(body []byte) ([]DeliveryStatus, error) {
+	var hook whatsAppWebhook
+	if err := json.Unmarshal(body, &hook); err != nil {
+		return nil, err
+	}
+
+	var out []DeliveryStatus
+	for _, e := range hook.Entry {
+		for _, c := range e.Changes {
+			for _, st := range c.Value.Statuses {
+				ds := DeliveryStatus{MessageID: st.ID, Status: st.Status, Recipient: st.RecipientID}
+				if ts, err := strconv.ParseInt(st.Timestamp, 10, 64); err == nil {
+					ds.Timestamp = time.Unix(ts, 0).UTC()
+				}
+				if len(st.Errors) > 0 {
+					ds.Error = fmt.Sprintf("%d: %s", st.Errors[0].Code, st.Errors[0].Title)
+				}
+				out = append(out, ds)
+			}
+		}
+	}
+	return out, nil
+}
+
+// VerifyWhatsAppSignature checks the X-Hub-Signature-256 header
+// ("sha256=<hex hmac>") of a webhook body against the app secret.
+func VerifyWhatsAppSignature(appSecret string, body []byte, header string) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
@@ -0,0 +1,137 @@
+// Package p2p keeps several writing nodes on one chain. Each node lists
+// the others in PEER_ADDRS, a comma-separated list of their base URLs
+// (e.g. http://node2:8080). A node announces every block it adds to its
+// peers; a peer that hears of a chain longer than its own, or finds one
+// when it polls, fetches the missing blocks over the peers' HTTP API
+// and adopts them once they pass validation (Blockchain.Adopt). The
+// longest valid chain wins. Nodes must share their genesis block
+// (GENESIS_FILE).
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+// BasePath is where a node serves the peer API.
+const BasePath = "/api/v1/p2p"
+
+// Limits on one request of the peer API.
+const (
+	MaxHeaders = 500
+	MaxBlocks  = 100
+)
+
+// Header identifies a block by height and hash. A node's tip and its
+// announcements are Headers.
+type Header struct {
+	Height   int    `json:"height"`
+	Hash     string `json:"hash"`
+	PrevHash string `json:"prev_hash"`
+}
+
+// HeaderOf returns the Header of b at height.
+func HeaderOf(height int, b *blockchain.Block) Header {
+	return Header{Height: height, Hash: fmt.Sprintf("%x", b.Hash), PrevHash: fmt.Sprintf("%x", b.PrevHash)}
+}
+
+// PeersFromEnv returns the peer base URLs in PEER_ADDRS, without a
+// trailing slash. It returns nil when none are configured.
+func PeersFromEnv() ([]string, error) {
+	var peers []string
+	for _, p := range strings.Split(os.Getenv("PEER_ADDRS"), ",") {
+		p = strings.TrimRight(strings.TrimSpace(p), "/")
+		if p == "" {
+			continue
+		}
+		u, err := url.Parse(p)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("peer %q: want an http or https base URL", p)
+		}
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
+
+// Client calls the peer API of other nodes.
+type Client struct {
+	HTTP *http.Client
+}
+
+// NewClient returns a Client whose requests time out after timeout.
+func NewClient(timeout time.Duration) *Client {
+	return &Client{HTTP: &http.Client{Timeout: timeout}}
+}
+
+// Tip returns the tip of peer's chain.
+func (c *Client) Tip(ctx context.Context, peer string) (Header, error) {
+	var h Header
+	err := c.get(ctx, peer+BasePath+"/tip", &h)
+	return h, err
+}
+
+// Headers returns up to limit headers of peer's chain from height from.
+func (c *Client) Headers(ctx context.Context, peer string, from, limit int) ([]Header, error) {
+	var hs []Header
+	err := c.get(ctx, pageURL(peer+BasePath+"/headers", from, limit), &hs)
+	return hs, err
+}
+
+// Blocks returns up to limit blocks of peer's chain from height from.
+func (c *Client) Blocks(ctx context.Context, peer string, from, limit int) ([]*blockchain.Block, error) {
+	var bs []*blockchain.Block
+	err := c.get(ctx, pageURL(peer+BasePath+"/blocks", from, limit), &bs)
+	return bs, err
+}
+
+// Announce tells peer about the block h.
+func (c *Client) Announce(ctx context.Context, peer string, h Header) error {
+	body, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer+BasePath+"/announce", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("announce to %s: %s", peer, resp.Status)
+	}
+	return nil
+}
+
+func (c *Client) get(ctx context.Context, u string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func pageURL(base string, from, limit int) string {
+	return base + "?from=" + strconv.Itoa(from) + "&limit=" + strconv.Itoa(limit)
+}
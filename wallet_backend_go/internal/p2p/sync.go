@@ -0,0 +1,126 @@
+package p2p
+
+// sync.go pulls a longer chain from a peer: it finds the last block
+// both chains share, fetches the peer's blocks after it and hands them
+// to the local chain as soon as they make it longer.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+// ErrForeignChain is returned when a peer's chain shares no block with
+// ours, not even genesis.
+var ErrForeignChain = errors.New("peer is on a chain with another genesis block")
+
+// Chain is the local chain as a Syncer sees it. Its methods serialize
+// access to the chain themselves.
+type Chain interface {
+	// Tip returns the header of the last block.
+	Tip() Header
+	// Header returns the header of the block at height, if there is one.
+	Header(height int) (Header, bool)
+	// Adopt replaces the blocks above fork with blocks; see
+	// blockchain.Blockchain.Adopt.
+	Adopt(fork int, blocks []*blockchain.Block) error
+}
+
+// Syncer pulls blocks from peers into a Chain.
+type Syncer struct {
+	Peers  []string
+	Client *Client
+	Chain  Chain
+}
+
+// Sync pulls from every peer in turn and returns how many blocks were
+// adopted and the error of each peer that failed.
+func (s *Syncer) Sync(ctx context.Context) (int, map[string]error) {
+	total := 0
+	errs := make(map[string]error)
+	for _, peer := range s.Peers {
+		n, err := s.SyncPeer(ctx, peer)
+		total += n
+		if err != nil {
+			errs[peer] = err
+		}
+	}
+	return total, errs
+}
+
+// SyncPeer adopts peer's chain if it is longer than ours and returns
+// how many of its blocks joined our chain.
+func (s *Syncer) SyncPeer(ctx context.Context, peer string) (int, error) {
+	remote, err := s.Client.Tip(ctx, peer)
+	if err != nil {
+		return 0, err
+	}
+	local := s.Chain.Tip()
+	if remote.Height <= local.Height {
+		return 0, nil
+	}
+	fork, err := s.forkPoint(ctx, peer, local.Height)
+	if err != nil {
+		return 0, err
+	}
+
+	adopted := 0
+	var pending []*blockchain.Block
+	next := fork + 1
+	for next <= remote.Height {
+		blocks, err := s.Client.Blocks(ctx, peer, next, min(MaxBlocks, remote.Height-next+1))
+		if err != nil {
+			return adopted, err
+		}
+		if len(blocks) == 0 {
+			break
+		}
+		pending = append(pending, blocks...)
+		next += len(blocks)
+		// adopt as soon as the received blocks outgrow ours, so a long
+		// download keeps its progress
+		if fork+len(pending) > s.Chain.Tip().Height {
+			if err := s.Chain.Adopt(fork, pending); err != nil {
+				return adopted, fmt.Errorf("blocks %d to %d: %w", fork+1, fork+len(pending), err)
+			}
+			adopted += len(pending)
+			fork += len(pending)
+			pending = nil
+		}
+	}
+	return adopted, nil
+}
+
+// forkPoint returns the height of the last block at or below top that
+// peer's chain shares with ours.
+func (s *Syncer) forkPoint(ctx context.Context, peer string, top int) (int, error) {
+	for top >= 0 {
+		from := max(0, top-MaxHeaders+1)
+		headers, err := s.Client.Headers(ctx, peer, from, top-from+1)
+		if err != nil {
+			return 0, err
+		}
+		for i := len(headers) - 1; i >= 0; i-- {
+			mine, ok := s.Chain.Header(headers[i].Height)
+			if ok && mine.Hash == headers[i].Hash {
+				return mine.Height, nil
+			}
+		}
+		top = from - 1
+	}
+	return 0, ErrForeignChain
+}
+
+// Announce tells every peer about the block h and returns the error of
+// each peer that could not be told.
+func (s *Syncer) Announce(ctx context.Context, h Header) map[string]error {
+	errs := make(map[string]error)
+	for _, peer := range s.Peers {
+		if err := s.Client.Announce(ctx, peer, h); err != nil {
+			errs[peer] = err
+		}
+	}
+	return errs
+}
@@ -0,0 +1,100 @@
+package payout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Bank sends fiat transfers to IBANs through a bank's or a payout
+// platform's API:
+//
+//	POST {URL}/payouts
+//	Authorization: Bearer {APIKey}
+//	Idempotency-Key: {reference}
+//	{"client_reference", "amount", "currency", "iban", "bic", "account_name"}
+//
+// answered with {"payout_id", "status", "reason"}. The provider's
+// webhooks post {"payout_id", "client_reference", "status", "reason"},
+// signed in X-Webhook-Signature as "sha256=<hex HMAC-SHA256 of the
+// body>" with WebhookSecret. Provider statuses paid and settled map to
+// completed; failed, rejected, returned and cancelled to failed; the
+// rest (e.g. pending, processing, sent) to submitted, and are kept as
+// the transfer's settlement progress.
+type Bank struct {
+	URL           string
+	APIKey        string
+	WebhookSecret string
+	FiatCurrency  string // e.g. PKR
+	HTTP          *http.Client
+}
+
+func (b *Bank) Method() string   { return MethodBank }
+func (b *Bank) Currency() string { return strings.ToUpper(b.FiatCurrency) }
+
+type bankPayout struct {
+	Reference   string `json:"client_reference"`
+	Amount      string `json:"amount"`
+	Currency    string `json:"currency"`
+	IBAN        string `json:"iban"`
+	BIC         string `json:"bic,omitempty"`
+	AccountName string `json:"account_name"`
+}
+
+type bankStatus struct {
+	ID        string `json:"payout_id"`
+	Reference string `json:"client_reference"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason"`
+}
+
+// Send submits t. A 4xx answer other than 409 and 429 is ErrRejected;
+// other failures may be retried with the same reference.
+func (b *Bank) Send(ctx context.Context, t Transfer) (Result, error) {
+	var st bankStatus
+	err := postTransfer(ctx, b.HTTP, b.URL+"/payouts", b.APIKey, t.Reference, bankPayout{
+		Reference:   t.Reference,
+		Amount:      t.Amount,
+		Currency:    b.Currency(),
+		IBAN:        t.Account,
+		BIC:         t.BankCode,
+		AccountName: t.Name,
+	}, &st)
+	if err != nil {
+		return Result{}, err
+	}
+	if st.ID == "" {
+		return Result{}, fmt.Errorf("%s/payouts: no payout id in the answer", b.URL)
+	}
+	return Result{ExternalRef: st.ID, Status: bankStatusOf(st.Status), ProviderStatus: st.Status, Detail: st.Reason}, nil
+}
+
+// VerifyWebhook checks the X-Webhook-Signature of a webhook body.
+// Without a WebhookSecret no webhook is accepted.
+func (b *Bank) VerifyWebhook(h http.Header, body []byte) bool {
+	return validSignature(b.WebhookSecret, h.Get("X-Webhook-Signature"), body)
+}
+
+// ParseWebhook reads the status change in a webhook body.
+func (b *Bank) ParseWebhook(body []byte) ([]Update, error) {
+	var st bankStatus
+	if err := json.Unmarshal(body, &st); err != nil {
+		return nil, err
+	}
+	if st.ID == "" && st.Reference == "" {
+		return nil, fmt.Errorf("webhook names no payout")
+	}
+	return []Update{{Reference: st.Reference, ExternalRef: st.ID, Status: bankStatusOf(st.Status), ProviderStatus: st.Status, Detail: st.Reason}}, nil
+}
+
+func bankStatusOf(status string) string {
+	switch strings.ToLower(status) {
+	case "paid", "settled":
+		return StatusCompleted
+	case "failed", "rejected", "returned", "cancelled":
+		return StatusFailed
+	}
+	return StatusSubmitted
+}
@@ -0,0 +1,97 @@
+package payout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MobileWallet sends rupees to a mobile wallet (JazzCash or Easypaisa)
+// through the provider's disbursement API:
+//
+//	POST {URL}/disbursements
+//	Authorization: Bearer {APIKey}
+//	Idempotency-Key: {reference}
+//	{"reference", "amount", "currency", "msisdn", "name"}
+//
+// answered with {"transaction_id", "status", "message"}. The provider
+// calls back with {"transaction_id", "reference", "status", "message"},
+// signed in X-Callback-Signature as "sha256=<hex HMAC-SHA256 of the
+// body>" with CallbackSecret. Provider statuses success and completed
+// map to completed; failed, rejected, reversed and expired to failed;
+// the rest (e.g. pending) to submitted.
+type MobileWallet struct {
+	Provider       string // MethodJazzCash or MethodEasypaisa
+	URL            string
+	APIKey         string
+	CallbackSecret string
+	HTTP           *http.Client
+}
+
+func (m *MobileWallet) Method() string   { return m.Provider }
+func (m *MobileWallet) Currency() string { return "PKR" }
+
+type mobileDisbursement struct {
+	Reference string `json:"reference"`
+	Amount    string `json:"amount"`
+	Currency  string `json:"currency"`
+	MSISDN    string `json:"msisdn"`
+	Name      string `json:"name,omitempty"`
+}
+
+type mobileStatus struct {
+	ID        string `json:"transaction_id"`
+	Reference string `json:"reference"`
+	Status    string `json:"status"`
+	Message   string `json:"message"`
+}
+
+// Send submits t. A 4xx answer other than 409 and 429 is ErrRejected;
+// other failures may be retried with the same reference.
+func (m *MobileWallet) Send(ctx context.Context, t Transfer) (Result, error) {
+	var st mobileStatus
+	err := postTransfer(ctx, m.HTTP, m.URL+"/disbursements", m.APIKey, t.Reference, mobileDisbursement{
+		Reference: t.Reference,
+		Amount:    t.Amount,
+		Currency:  m.Currency(),
+		MSISDN:    t.Account,
+		Name:      t.Name,
+	}, &st)
+	if err != nil {
+		return Result{}, err
+	}
+	if st.ID == "" {
+		return Result{}, fmt.Errorf("%s/disbursements: no transaction id in the answer", m.URL)
+	}
+	return Result{ExternalRef: st.ID, Status: mobileStatusOf(st.Status), ProviderStatus: st.Status, Detail: st.Message}, nil
+}
+
+// VerifyWebhook checks the X-Callback-Signature of a callback body.
+// Without a CallbackSecret no callback is accepted.
+func (m *MobileWallet) VerifyWebhook(h http.Header, body []byte) bool {
+	return validSignature(m.CallbackSecret, h.Get("X-Callback-Signature"), body)
+}
+
+// ParseWebhook reads the status change in a callback body.
+func (m *MobileWallet) ParseWebhook(body []byte) ([]Update, error) {
+	var st mobileStatus
+	if err := json.Unmarshal(body, &st); err != nil {
+		return nil, err
+	}
+	if st.ID == "" && st.Reference == "" {
+		return nil, fmt.Errorf("callback names no transaction")
+	}
+	return []Update{{Reference: st.Reference, ExternalRef: st.ID, Status: mobileStatusOf(st.Status), ProviderStatus: st.Status, Detail: st.Message}}, nil
+}
+
+func mobileStatusOf(status string) string {
+	switch strings.ToLower(status) {
+	case "success", "completed":
+		return StatusCompleted
+	case "failed", "rejected", "reversed", "expired":
+		return StatusFailed
+	}
+	return StatusSubmitted
+}
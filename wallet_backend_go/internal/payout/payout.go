@@ -0,0 +1,323 @@
+// Package payout pays disbursements to beneficiaries outside the
+// chain, through external transfer providers: stablecoin remittance,
+// bank transfers and mobile wallets. An Adapter sends one
+// transfer to a beneficiary's account with a provider and reads the
+// provider's webhooks, which report how the transfer ends. Which
+// beneficiaries are paid this way, and when, is up to the caller.
+package payout
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Methods.
+const (
+	MethodStablecoin = "stablecoin"
+	MethodBank       = "bank"
+	MethodJazzCash   = "jazzcash"
+	MethodEasypaisa  = "easypaisa"
+)
+
+// Methods lists the known payout methods.
+var Methods = []string{MethodStablecoin, MethodBank, MethodJazzCash, MethodEasypaisa}
+
+// MobileMethods are the methods paying mobile wallets, whose accounts
+// are phone numbers.
+var MobileMethods = []string{MethodJazzCash, MethodEasypaisa}
+
+// Statuses of a transfer with a provider.
+const (
+	StatusSubmitted = "submitted"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+const (
+	requestTimeout = 30 * time.Second
+	maxResponse    = 1 << 20
+)
+
+// ErrRejected marks a transfer the provider refused outright; sending
+// it again will not help.
+var ErrRejected = errors.New("payout: transfer rejected")
+
+var (
+	evmAddress = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+	ibanFormat = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z0-9]{11,30}$`)
+	bicFormat  = regexp.MustCompile(`^[A-Z]{4}[A-Z]{2}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+	msisdn     = regexp.MustCompile(`^923[0-9]{9}$`)
+)
+
+// Transfer is one payment to send.
+type Transfer struct {
+	// Reference is the caller's id of the transfer. Providers use it
+	// as the idempotency key, so a transfer sent twice is paid once.
+	Reference string
+	Amount    string // decimal, in Currency
+	Currency  string
+	Account   string // the beneficiary's account with the provider
+	Name      string // the account holder's name
+	BankCode  string // the BIC of the account's bank, for bank transfers
+}
+
+// Result is the provider's answer to a transfer.
+type Result struct {
+	ExternalRef string // the provider's id of the transfer
+	Status      string // StatusSubmitted, StatusCompleted or StatusFailed
+	// ProviderStatus is the provider's own status, which tells how far
+	// a submitted transfer has got, e.g. whether it left the bank.
+	ProviderStatus string
+	Detail         string
+}
+
+// Update is a change of a transfer's status reported by a webhook.
+type Update struct {
+	Reference      string // the caller's reference, when the provider echoes it
+	ExternalRef    string
+	Status         string
+	ProviderStatus string
+	Detail         string
+}
+
+// Adapter sends transfers with one provider.
+type Adapter interface {
+	Method() string
+	// Currency is the currency transfers are sent in.
+	Currency() string
+	Send(ctx context.Context, t Transfer) (Result, error)
+	// VerifyWebhook checks the signature of a webhook body.
+	VerifyWebhook(h http.Header, body []byte) bool
+	ParseWebhook(body []byte) ([]Update, error)
+}
+
+// Known reports whether method is a payout method.
+func Known(method string) bool {
+	return contains(Methods, method)
+}
+
+// IsMobile reports whether method pays mobile wallets.
+func IsMobile(method string) bool {
+	return contains(MobileMethods, method)
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeAccount returns account in the form ValidAccount checks and
+// providers are sent: IBANs upper-case without spaces, phone numbers
+// as international numbers without the plus (see NormalizePhone).
+func NormalizeAccount(method, account string) string {
+	account = strings.TrimSpace(account)
+	switch {
+	case method == MethodBank:
+		account = strings.ToUpper(strings.Join(strings.Fields(account), ""))
+	case IsMobile(method):
+		account = NormalizePhone(account)
+	}
+	return account
+}
+
+// NormalizePhone returns a Pakistani mobile number written as
+// 0300 1234567, +92 300 1234567 or 92-300-1234567 as 923001234567.
+// Other text is returned without its spaces and dashes.
+func NormalizePhone(phone string) string {
+	phone = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(strings.TrimSpace(phone))
+	phone = strings.TrimPrefix(phone, "+")
+	switch {
+	case strings.HasPrefix(phone, "0092"):
+		phone = phone[2:]
+	case strings.HasPrefix(phone, "03"):
+		phone = "92" + phone[1:]
+	}
+	return phone
+}
+
+// ValidAccount reports whether account is a valid destination for
+// method: an EVM address for stablecoin, an IBAN for bank and a
+// Pakistani mobile number for the mobile wallets.
+func ValidAccount(method, account string) bool {
+	switch {
+	case method == MethodStablecoin:
+		return evmAddress.MatchString(account)
+	case method == MethodBank:
+		return ValidIBAN(account)
+	case IsMobile(method):
+		return msisdn.MatchString(account)
+	}
+	return false
+}
+
+// ValidIBAN reports whether iban, in normalized form, is well formed
+// and passes the ISO 13616 mod-97 check.
+func ValidIBAN(iban string) bool {
+	if !ibanFormat.MatchString(iban) {
+		return false
+	}
+	// move the country code and check digits to the end, read the
+	// letters as 10 to 35 and take the number mod 97 digit by digit
+	rem := 0
+	for _, c := range iban[4:] + iban[:4] {
+		if c >= 'A' && c <= 'Z' {
+			rem = (rem*100 + int(c-'A') + 10) % 97
+		} else {
+			rem = (rem*10 + int(c-'0')) % 97
+		}
+	}
+	return rem == 1
+}
+
+// ValidBankCode reports whether code is a BIC (SWIFT code) of 8 or 11
+// characters.
+func ValidBankCode(code string) bool {
+	return bicFormat.MatchString(code)
+}
+
+// Pegs are the currencies stablecoins track, whose rates price them
+// when the rates do not list the stablecoin itself.
+var Pegs = map[string]string{"USDC": "USD", "USDT": "USD", "EURC": "EUR"}
+
+// FromEnv returns the adapters configured in the environment, by
+// method. STABLECOIN_PAYOUT_URL enables stablecoin payouts (see
+// Stablecoin); STABLECOIN_WEBHOOK_SECRET is then required, since the
+// outcome of a transfer is only learnt from the webhooks. Likewise
+// BANK_PAYOUT_URL enables bank transfers (see Bank) and requires
+// BANK_WEBHOOK_SECRET, and JAZZCASH_PAYOUT_URL and EASYPAISA_PAYOUT_URL
+// enable the mobile wallets (see MobileWallet) and require
+// JAZZCASH_CALLBACK_SECRET and EASYPAISA_CALLBACK_SECRET.
+func FromEnv() (map[string]Adapter, error) {
+	adapters := make(map[string]Adapter)
+	hc := &http.Client{Timeout: requestTimeout}
+	if u := envURL("STABLECOIN_PAYOUT_URL"); u != "" {
+		if os.Getenv("STABLECOIN_WEBHOOK_SECRET") == "" {
+			return nil, errors.New("STABLECOIN_WEBHOOK_SECRET must be set with STABLECOIN_PAYOUT_URL")
+		}
+		adapters[MethodStablecoin] = &Stablecoin{
+			URL:           u,
+			APIKey:        os.Getenv("STABLECOIN_PAYOUT_API_KEY"),
+			WebhookSecret: os.Getenv("STABLECOIN_WEBHOOK_SECRET"),
+			Token:         envOr("STABLECOIN_PAYOUT_CURRENCY", "USDC"),
+			Network:       envOr("STABLECOIN_PAYOUT_NETWORK", "polygon"),
+			HTTP:          hc,
+		}
+	}
+	if u := envURL("BANK_PAYOUT_URL"); u != "" {
+		if os.Getenv("BANK_WEBHOOK_SECRET") == "" {
+			return nil, errors.New("BANK_WEBHOOK_SECRET must be set with BANK_PAYOUT_URL")
+		}
+		adapters[MethodBank] = &Bank{
+			URL:           u,
+			APIKey:        os.Getenv("BANK_PAYOUT_API_KEY"),
+			WebhookSecret: os.Getenv("BANK_WEBHOOK_SECRET"),
+			FiatCurrency:  envOr("BANK_PAYOUT_CURRENCY", "PKR"),
+			HTTP:          hc,
+		}
+	}
+	for _, method := range MobileMethods {
+		prefix := strings.ToUpper(method)
+		u := envURL(prefix + "_PAYOUT_URL")
+		if u == "" {
+			continue
+		}
+		if os.Getenv(prefix+"_CALLBACK_SECRET") == "" {
+			return nil, fmt.Errorf("%s_CALLBACK_SECRET must be set with %s_PAYOUT_URL", prefix, prefix)
+		}
+		adapters[method] = &MobileWallet{
+			Provider:       method,
+			URL:            u,
+			APIKey:         os.Getenv(prefix + "_PAYOUT_API_KEY"),
+			CallbackSecret: os.Getenv(prefix + "_CALLBACK_SECRET"),
+			HTTP:           hc,
+		}
+	}
+	return adapters, nil
+}
+
+// postTransfer posts payload as JSON to url with reference as the
+// Idempotency-Key and decodes a 2xx answer into out. A 4xx answer other
+// than 409 and 429 is ErrRejected.
+func postTransfer(ctx context.Context, hc *http.Client, url, apiKey, reference string, payload, out any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", reference)
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	answer, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+
+	if resp.StatusCode/100 != 2 {
+		msg := strings.TrimSpace(string(answer))
+		if len(msg) > 200 {
+			msg = msg[:200]
+		}
+		err := fmt.Errorf("%s: %s: %s", url, resp.Status, msg)
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusConflict && resp.StatusCode != http.StatusTooManyRequests {
+			return fmt.Errorf("%w: %v", ErrRejected, err)
+		}
+		return err
+	}
+	if err := json.Unmarshal(answer, out); err != nil {
+		return fmt.Errorf("%s: %w", url, err)
+	}
+	return nil
+}
+
+// validSignature checks a "sha256=<hex HMAC-SHA256 of body>" signature
+// made with secret. Without a secret nothing is valid.
+func validSignature(secret, signature string, body []byte) bool {
+	if secret == "" {
+		return false
+	}
+	sig, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+func envURL(name string) string {
+	return strings.TrimRight(strings.TrimSpace(os.Getenv(name)), "/")
+}
+
+func envOr(name, def string) string {
+	if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+		return v
+	}
+	return def
+}
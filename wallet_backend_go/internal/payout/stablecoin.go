@@ -0,0 +1,99 @@
+package payout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Stablecoin sends stablecoin transfers through a remittance API:
+//
+//	POST {URL}/transfers
+//	Authorization: Bearer {APIKey}
+//	Idempotency-Key: {reference}
+//	{"reference", "amount", "currency", "network", "address", "name"}
+//
+// answered with {"id", "status", "reason"}. The provider's webhooks
+// post {"id", "reference", "status", "reason"}, signed in
+// X-Signature as "sha256=<hex HMAC-SHA256 of the body>" with
+// WebhookSecret. Provider statuses pending and processing map to
+// submitted; completed and confirmed to completed; failed, rejected,
+// cancelled and returned to failed.
+type Stablecoin struct {
+	URL           string
+	APIKey        string
+	WebhookSecret string
+	Token         string // e.g. USDC
+	Network       string // e.g. polygon
+	HTTP          *http.Client
+}
+
+func (s *Stablecoin) Method() string   { return MethodStablecoin }
+func (s *Stablecoin) Currency() string { return strings.ToUpper(s.Token) }
+
+type stablecoinTransfer struct {
+	Reference string `json:"reference"`
+	Amount    string `json:"amount"`
+	Currency  string `json:"currency"`
+	Network   string `json:"network"`
+	Address   string `json:"address"`
+	Name      string `json:"name,omitempty"`
+}
+
+type stablecoinStatus struct {
+	ID        string `json:"id"`
+	Reference string `json:"reference"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason"`
+}
+
+// Send submits t. A 4xx answer other than 409 and 429 is ErrRejected;
+// other failures may be retried with the same reference.
+func (s *Stablecoin) Send(ctx context.Context, t Transfer) (Result, error) {
+	var st stablecoinStatus
+	err := postTransfer(ctx, s.HTTP, s.URL+"/transfers", s.APIKey, t.Reference, stablecoinTransfer{
+		Reference: t.Reference,
+		Amount:    t.Amount,
+		Currency:  s.Currency(),
+		Network:   s.Network,
+		Address:   t.Account,
+		Name:      t.Name,
+	}, &st)
+	if err != nil {
+		return Result{}, err
+	}
+	if st.ID == "" {
+		return Result{}, fmt.Errorf("%s/transfers: no transfer id in the answer", s.URL)
+	}
+	return Result{ExternalRef: st.ID, Status: stablecoinStatusOf(st.Status), ProviderStatus: st.Status, Detail: st.Reason}, nil
+}
+
+// VerifyWebhook checks the X-Signature of a webhook body. Without a
+// WebhookSecret no webhook is accepted.
+func (s *Stablecoin) VerifyWebhook(h http.Header, body []byte) bool {
+	return validSignature(s.WebhookSecret, h.Get("X-Signature"), body)
+}
+
+// ParseWebhook reads the status change in a webhook body.
+func (s *Stablecoin) ParseWebhook(body []byte) ([]Update, error) {
+	var st stablecoinStatus
+	if err := json.Unmarshal(body, &st); err != nil {
+		return nil, err
+	}
+	if st.ID == "" && st.Reference == "" {
+		return nil, fmt.Errorf("webhook names no transfer")
+	}
+	return []Update{{Reference: st.Reference, ExternalRef: st.ID, Status: stablecoinStatusOf(st.Status), ProviderStatus: st.Status, Detail: st.Reason}}, nil
+}
+
+func stablecoinStatusOf(status string) string {
+	switch strings.ToLower(status) {
+	case "completed", "confirmed":
+		return StatusCompleted
+	case "failed", "rejected", "cancelled", "returned":
+		return StatusFailed
+	}
+	return StatusSubmitted
+}
@@ -0,0 +1,263 @@
+// Package policyhook asks external policy services whether an action
+// may go ahead. Operators register services that hold business rules
+// of their own (sanctions screening, tenant budgets, four-eyes rules)
+// without changing the server: before a transaction is mined or a
+// disbursement is paid, the proposed action is posted to each service
+// handling its type, in order, and the first denial stops it. A service
+// that cannot be asked in time denies the action when it fails closed,
+// the default, and is skipped when it fails open.
+//
+// A service is posted the Action as JSON, signed in X-Policy-Signature
+// as "sha256=<hex HMAC-SHA256 of the body>" when it has a secret, and
+// answers 200 with {"allow": true} or {"allow": false, "reason": "..."}.
+// Any other answer is a failure.
+package policyhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Action types.
+const (
+	ActionTransaction  = "transaction"
+	ActionDisbursement = "disbursement"
+)
+
+// ActionTypes lists the action types services can be asked about.
+var ActionTypes = []string{ActionTransaction, ActionDisbursement}
+
+const (
+	defaultTimeout = 2 * time.Second
+	maxResponse    = 64 << 10
+)
+
+// ReasonUnavailable is the reason of a denial by a service failing
+// closed that could not be asked.
+const ReasonUnavailable = "policy service unavailable"
+
+var serviceName = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// Action is a proposed action, as posted to the services.
+type Action struct {
+	Type     string `json:"type"` // ActionTransaction or ActionDisbursement
+	ID       string `json:"id"`   // txid, or the distribution or template id
+	TenantID string `json:"tenant_id,omitempty"`
+	// Actor is the admin disbursing; empty for transactions.
+	Actor string `json:"actor,omitempty"`
+	// Source tells what proposes a disbursement, e.g. zakat_distribution.
+	Source  string    `json:"source,omitempty"`
+	From    string    `json:"from"`
+	Amount  int       `json:"amount"` // paid to others, change excluded
+	Outputs []Output  `json:"outputs"`
+	Time    time.Time `json:"time"`
+}
+
+// Output is one payment of an action.
+type Output struct {
+	Address       string `json:"address,omitempty"` // empty for burns
+	Amount        int    `json:"amount"`
+	Change        bool   `json:"change,omitempty"`
+	BeneficiaryID string `json:"beneficiary_id,omitempty"`
+	Category      string `json:"category,omitempty"`
+	PayoutMethod  string `json:"payout_method,omitempty"`
+}
+
+// Decision is a service's answer.
+type Decision struct {
+	Allow  *bool  `json:"allow"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Denial is the veto of a service.
+type Denial struct {
+	Service string
+	Reason  string
+}
+
+func (d *Denial) Error() string {
+	return "policy service " + d.Service + ": " + d.Reason
+}
+
+// Service is one external policy service.
+type Service struct {
+	Name     string
+	URL      string
+	Secret   string
+	Timeout  time.Duration
+	FailOpen bool
+	Actions  []string // the action types it is asked about
+	HTTP     *http.Client
+}
+
+// Handles reports whether s is asked about actions of type typ.
+func (s *Service) Handles(typ string) bool {
+	for _, a := range s.Actions {
+		if a == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Decide asks s about a.
+func (s *Service) Decide(ctx context.Context, a Action) (Decision, error) {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return Decision{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(s.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Policy-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := s.HTTP.Do(req)
+	if err != nil {
+		return Decision{}, err
+	}
+	defer resp.Body.Close()
+	answer, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if resp.StatusCode != http.StatusOK {
+		return Decision{}, fmt.Errorf("%s: %s", s.URL, resp.Status)
+	}
+	var d Decision
+	if err := json.Unmarshal(answer, &d); err != nil {
+		return Decision{}, fmt.Errorf("%s: %w", s.URL, err)
+	}
+	if d.Allow == nil {
+		return Decision{}, fmt.Errorf("%s: answer has no allow", s.URL)
+	}
+	return d, nil
+}
+
+// Services are the configured services, in the order they are asked.
+type Services []*Service
+
+// Check asks every service handling a.Type, in order, and returns the
+// first denial, or nil when all allow the action. A service that
+// cannot be asked is passed to onError with the failure and then
+// denies the action if it fails closed, or is skipped if it fails open.
+func (ss Services) Check(ctx context.Context, a Action, onError func(s *Service, err error)) *Denial {
+	for _, s := range ss {
+		if !s.Handles(a.Type) {
+			continue
+		}
+		d, err := s.Decide(ctx, a)
+		if err != nil {
+			if onError != nil {
+				onError(s, err)
+			}
+			if s.FailOpen {
+				continue
+			}
+			return &Denial{Service: s.Name, Reason: ReasonUnavailable}
+		}
+		if !*d.Allow {
+			reason := strings.TrimSpace(d.Reason)
+			if reason == "" {
+				reason = "denied by policy"
+			}
+			return &Denial{Service: s.Name, Reason: reason}
+		}
+	}
+	return nil
+}
+
+// Handles reports whether any service is asked about actions of type
+// typ.
+func (ss Services) Handles(typ string) bool {
+	for _, s := range ss {
+		if s.Handles(typ) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromEnv returns the services named, in order, by the comma-separated
+// POLICY_HOOKS. Each name (lower-case letters, digits and underscores)
+// is configured by POLICY_HOOK_<NAME>_URL (required), _SECRET, _ACTIONS
+// (comma-separated action types, default all), _TIMEOUT_MS (default
+// 2000) and _FAIL (closed, the default, or open).
+func FromEnv() (Services, error) {
+	var ss Services
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(os.Getenv("POLICY_HOOKS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !serviceName.MatchString(name) {
+			return nil, fmt.Errorf("POLICY_HOOKS: invalid name %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("POLICY_HOOKS: %s listed twice", name)
+		}
+		seen[name] = true
+		s, err := serviceFromEnv(name)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
+
+func serviceFromEnv(name string) (*Service, error) {
+	prefix := "POLICY_HOOK_" + strings.ToUpper(name) + "_"
+	s := &Service{
+		Name:    name,
+		URL:     strings.TrimSpace(os.Getenv(prefix + "URL")),
+		Secret:  os.Getenv(prefix + "SECRET"),
+		Timeout: defaultTimeout,
+		Actions: ActionTypes,
+	}
+	if !strings.HasPrefix(s.URL, "http://") && !strings.HasPrefix(s.URL, "https://") {
+		return nil, fmt.Errorf("%sURL must be an http(s) URL", prefix)
+	}
+	if v := strings.TrimSpace(os.Getenv(prefix + "TIMEOUT_MS")); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms <= 0 {
+			return nil, fmt.Errorf("%sTIMEOUT_MS must be a positive number of milliseconds", prefix)
+		}
+		s.Timeout = time.Duration(ms) * time.Millisecond
+	}
+	switch strings.TrimSpace(os.Getenv(prefix + "FAIL")) {
+	case "", "closed":
+	case "open":
+		s.FailOpen = true
+	default:
+		return nil, fmt.Errorf("%sFAIL must be open or closed", prefix)
+	}
+	if v := strings.TrimSpace(os.Getenv(prefix + "ACTIONS")); v != "" {
+		s.Actions = nil
+		for _, a := range strings.Split(v, ",") {
+			a = strings.TrimSpace(a)
+			if a != ActionTransaction && a != ActionDisbursement {
+				return nil, fmt.Errorf("%sACTIONS: unknown action %q", prefix, a)
+			}
+			s.Actions = append(s.Actions, a)
+		}
+	}
+	s.HTTP = &http.Client{Timeout: s.Timeout}
+	return s, nil
+}
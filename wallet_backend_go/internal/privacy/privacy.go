@@ -0,0 +1,192 @@
+// Package privacy rates how much the chain reveals about the owner of
+// an address. Every transaction is public, so an address that receives
+// many payments, from many payers, lets each payer see the others and
+// the whole balance; change sent back to the paying address marks which
+// output of a send is the payment; and spending from several addresses
+// at once links them (the common-input heuristic of package cluster).
+// Analyze counts these patterns over the chain and turns them into a
+// score from 0 (fully linkable) to 100 with warnings naming what to
+// change, chiefly receiving each payment on a fresh address.
+package privacy
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+// Warning codes.
+const (
+	WarnAddressReused = "address_reused"
+	WarnManyPayers    = "many_payers"
+	WarnChangeReuse   = "change_to_same_address"
+	WarnLinkedInputs  = "inputs_linked"
+)
+
+// Score levels.
+const (
+	LevelGood = "good"
+	LevelFair = "fair"
+	LevelPoor = "poor"
+)
+
+// maxLinked bounds the linked addresses listed in a Report.
+const maxLinked = 20
+
+// Penalties, each capped, taken off a perfect score of 100.
+const (
+	penaltyPerReuse  = 10 // each payment received after the first
+	maxReusePenalty  = 40
+	penaltyPerPayer  = 5 // each distinct payer after the first
+	maxPayerPenalty  = 20
+	penaltyChange    = 20 // change ever sent back to the address
+	penaltyPerLinked = 5  // each address spent together with it
+	maxLinkedPenalty = 20
+)
+
+// Warning is one privacy problem found.
+type Warning struct {
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion"`
+}
+
+// Report is the privacy analysis of one address.
+type Report struct {
+	Address          string    `json:"address"`
+	Height           int       `json:"height"`            // blocks analyzed
+	PaymentsReceived int       `json:"payments_received"` // transactions paying the address, change excluded
+	DistinctPayers   int       `json:"distinct_payers"`   // addresses that paid it; coinbases not counted
+	Sends            int       `json:"sends"`             // transactions spending from it
+	ChangeToSelf     int       `json:"change_to_self"`    // sends returning change to the address
+	Counterparties   int       `json:"counterparties"`    // addresses it paid
+	LinkedAddresses  []string  `json:"linked_addresses"`  // spent together with it, at most 20
+	LinkedCount      int       `json:"linked_count"`
+	Score            int       `json:"score"` // 0 to 100, higher is more private
+	Level            string    `json:"level"` // good, fair, poor
+	Warnings         []Warning `json:"warnings"`
+}
+
+// Analyze rates address, which must be in the canonical encoding, over
+// blocks.
+func Analyze(blocks []*blockchain.Block, address string) Report {
+	rep := Report{Address: address, Height: len(blocks), LinkedAddresses: []string{}, Warnings: []Warning{}}
+	owners := make(map[string]string) // "txid:vout" -> address
+	payers := make(map[string]bool)
+	paid := make(map[string]bool)
+	linked := make(map[string]bool)
+
+	for _, b := range blocks {
+		for _, tx := range b.Transactions {
+			txid := hex.EncodeToString(tx.ID)
+			var inputs []string
+			spends := false
+			if !tx.IsCoinbase() {
+				seen := make(map[string]bool)
+				for _, in := range tx.Vin {
+					key := fmt.Sprintf("%x:%d", in.Txid, in.Vout)
+					owner, ok := owners[key]
+					if !ok {
+						owner = blockchain.PubKeyAddress(in.PubKey)
+					}
+					delete(owners, key)
+					if owner == address {
+						spends = true
+					}
+					if !seen[owner] {
+						seen[owner] = true
+						inputs = append(inputs, owner)
+					}
+				}
+			}
+
+			receives, change := false, false
+			for i, out := range tx.Vout {
+				to := blockchain.EncodeAddress(out.Owner())
+				owners[fmt.Sprintf("%s:%d", txid, i)] = to
+				switch {
+				case to == address && spends:
+					change = true
+				case to == address:
+					receives = true
+				case spends:
+					paid[to] = true
+				}
+			}
+
+			if spends {
+				rep.Sends++
+				if change {
+					rep.ChangeToSelf++
+				}
+				for _, a := range inputs {
+					if a != address {
+						linked[a] = true
+					}
+				}
+			}
+			if receives {
+				rep.PaymentsReceived++
+				for _, a := range inputs {
+					payers[a] = true
+				}
+			}
+		}
+	}
+
+	rep.DistinctPayers = len(payers)
+	rep.Counterparties = len(paid)
+	rep.LinkedCount = len(linked)
+	for a := range linked {
+		rep.LinkedAddresses = append(rep.LinkedAddresses, a)
+	}
+	sort.Strings(rep.LinkedAddresses)
+	if len(rep.LinkedAddresses) > maxLinked {
+		rep.LinkedAddresses = rep.LinkedAddresses[:maxLinked]
+	}
+
+	rep.Score = 100
+	if n := rep.PaymentsReceived - 1; n > 0 {
+		rep.Score -= min(n*penaltyPerReuse, maxReusePenalty)
+		rep.Warnings = append(rep.Warnings, Warning{
+			Code:       WarnAddressReused,
+			Message:    "This address received more than one payment.",
+			Suggestion: "Receive each payment on a new address derived from your wallet.",
+		})
+	}
+	if n := rep.DistinctPayers - 1; n > 0 {
+		rep.Score -= min(n*penaltyPerPayer, maxPayerPenalty)
+		rep.Warnings = append(rep.Warnings, Warning{
+			Code:       WarnManyPayers,
+			Message:    "Several payers sent to this address and can see each other's payments.",
+			Suggestion: "Give each payer their own address.",
+		})
+	}
+	if rep.ChangeToSelf > 0 {
+		rep.Score -= penaltyChange
+		rep.Warnings = append(rep.Warnings, Warning{
+			Code:       WarnChangeReuse,
+			Message:    "Change of sends from this address went back to it.",
+			Suggestion: "Send change to a new address derived from your wallet.",
+		})
+	}
+	if rep.LinkedCount > 0 {
+		rep.Score -= min(rep.LinkedCount*penaltyPerLinked, maxLinkedPenalty)
+		rep.Warnings = append(rep.Warnings, Warning{
+			Code:       WarnLinkedInputs,
+			Message:    "This address was spent together with other addresses, which links them to the same owner.",
+			Suggestion: "Avoid sends that combine funds from several addresses.",
+		})
+	}
+	switch {
+	case rep.Score >= 80:
+		rep.Level = LevelGood
+	case rep.Score >= 50:
+		rep.Level = LevelFair
+	default:
+		rep.Level = LevelPoor
+	}
+	return rep
+}
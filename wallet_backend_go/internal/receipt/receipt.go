@@ -0,0 +1,160 @@
+// Package receipt renders zakat receipts as single-page PDF documents
+// suitable for tax and charity records. The PDF is written by hand
+// using the standard Helvetica font, so no font files are embedded and
+// text is limited to ASCII; the QR code linking to the public
+// verification endpoint is drawn as filled squares.
+package receipt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Receipt holds the data printed on a zakat receipt.
+type Receipt struct {
+	ID            string
+	Organization  string
+	WalletAddress string
+	Amount        int
+	FiatAmount    string // optional formatted fiat equivalent
+	Date          time.Time
+	BlockHash     string
+	VerifyURL     string
+}
+
+// A4 page size in points.
+const (
+	pageWidth  = 595
+	pageHeight = 842
+	margin     = 56
+)
+
+// RenderPDF renders r as a PDF document.
+func RenderPDF(r Receipt) ([]byte, error) {
+	qr, err := qrcode.New(r.VerifyURL, qrcode.Medium)
+	if err != nil {
+		return nil, fmt.Errorf("encode qr: %w", err)
+	}
+
+	var c bytes.Buffer
+
+	// header band
+	c.WriteString("0.07 0.40 0.27 rg\n")
+	fmt.Fprintf(&c, "0 %d %d 90 re f\n", pageHeight-90, pageWidth)
+	c.WriteString("1 1 1 rg\n")
+	text(&c, "F2", 22, margin, pageHeight-52, r.Organization)
+	text(&c, "F1", 12, margin, pageHeight-72, "Zakat Receipt")
+	c.WriteString("0 0 0 rg\n")
+
+	y := pageHeight - 140
+	line := func(label, value string) {
+		text(&c, "F2", 11, margin, y, label)
+		text(&c, "F1", 11, margin+120, y, value)
+		y -= 22
+	}
+
+	line("Receipt ID", r.ID)
+	line("Date", r.Date.UTC().Format("02 Jan 2006 15:04 MST"))
+	line("Amount", fmt.Sprintf("%d units", r.Amount))
+	if r.FiatAmount != "" {
+		line("Fiat equivalent", r.FiatAmount)
+	}
+	line("Wallet", r.WalletAddress)
+	line("Block hash", r.BlockHash)
+
+	// QR code with the verification link
+	bitmap := qr.Bitmap()
+	const qrSize = 160
+	module := float64(qrSize) / float64(len(bitmap))
+	qrX, qrY := float64(margin), float64(y-20-qrSize)
+	for row, cols := range bitmap {
+		for col, dark := range cols {
+			if dark {
+				fmt.Fprintf(&c, "%.2f %.2f %.2f %.2f re\n",
+					qrX+float64(col)*module,
+					qrY+float64(len(bitmap)-1-row)*module,
+					module, module)
+			}
+		}
+	}
+	c.WriteString("f\n")
+
+	tx := margin + qrSize + 20
+	text(&c, "F2", 11, tx, int(qrY)+qrSize-30, "Verify this receipt")
+	text(&c, "F1", 9, tx, int(qrY)+qrSize-48, "Scan the code or open:")
+	for i, part := range wrap(r.VerifyURL, 60) {
+		text(&c, "F1", 9, tx, int(qrY)+qrSize-62-i*12, part)
+	}
+
+	text(&c, "F1", 8, margin, margin,
+		"This receipt was generated from the on-chain zakat record and can be verified at any time using the link above.")
+
+	return assemble(c.Bytes()), nil
+}
+
+// text appends a single line of text at (x, y).
+func text(c *bytes.Buffer, font string, size, x, y int, s string) {
+	fmt.Fprintf(c, "BT /%s %d Tf %d %d Td (%s) Tj ET\n", font, size, x, y, escape(s))
+}
+
+// escape makes s safe for a PDF literal string, replacing characters
+// outside printable ASCII.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// wrap splits s into chunks of at most n bytes.
+func wrap(s string, n int) []string {
+	var parts []string
+	for len(s) > n {
+		parts = append(parts, s[:n])
+		s = s[n:]
+	}
+	return append(parts, s)
+}
+
+// assemble wraps a page content stream into a complete PDF file.
+func assemble(content []byte) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] "+
+			"/Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents 6 0 R >>", pageWidth, pageHeight),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
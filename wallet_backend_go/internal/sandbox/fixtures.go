@@ -0,0 +1,83 @@
+// Package sandbox defines the fixture data a sandbox deployment is
+// re-seeded with on every reset. Identities are derived from fixed
+// seeds, so user ids, keys and wallet addresses are the same after each
+// reset and integrators can hard-code them in their tests. Block hashes
+// and transaction signatures still change, since blocks carry their
+// mining time and ECDSA signatures are randomized.
+package sandbox
+
+import (
+	"encoding/hex"
+
+	"github.com/google/uuid"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+// namespace scopes the name-based UUIDs of the fixtures.
+var namespace = uuid.MustParse("6f1d3c2a-9b7e-4c55-8a21-3e0f5d9c7b10")
+
+// TenantName is the name of the tenant fixtures belong to.
+const TenantName = "Sandbox"
+
+// TenantID is the id of the sandbox tenant.
+var TenantID = uuid.NewSHA1(namespace, []byte("tenant")).String()
+
+// User is a fixture user with one wallet.
+type User struct {
+	ID            string `json:"user_id"`
+	FullName      string `json:"full_name"`
+	Email         string `json:"email"`
+	CNIC          string `json:"cnic"`
+	WalletAddress string `json:"wallet_address"`
+	PublicKeyHex  string `json:"public_key_hex"`
+	PrivateKeyHex string `json:"private_key"`
+	Funded        bool   `json:"-"` // receives a coinbase reward when seeding
+}
+
+// Transfer moves Amount from Users()[From] to Users()[To].
+type Transfer struct {
+	From   int
+	To     int
+	Amount int
+}
+
+var people = []struct {
+	name, email, cnic string
+	funded            bool
+}{
+	{"Ayesha Khan", "ayesha@sandbox.zakatwallet.test", "35202-0000001-1", true},
+	{"Bilal Ahmed", "bilal@sandbox.zakatwallet.test", "35202-0000002-2", true},
+	{"Fatima Malik", "fatima@sandbox.zakatwallet.test", "35202-0000003-3", false},
+	{"Usman Raza", "usman@sandbox.zakatwallet.test", "35202-0000004-4", false},
+}
+
+// Users returns the fixture users, in a stable order.
+func Users() ([]User, error) {
+	users := make([]User, 0, len(people))
+	for _, p := range people {
+		w := blockchain.WalletFromSeed([]byte("zakatwallet-sandbox/" + p.email))
+
+		users = append(users, User{
+			ID:            uuid.NewSHA1(namespace, []byte("user/"+p.email)).String(),
+			FullName:      p.name,
+			Email:         p.email,
+			CNIC:          p.cnic,
+			WalletAddress: w.GetAddress(),
+			PublicKeyHex:  hex.EncodeToString(w.PublicKey),
+			PrivateKeyHex: blockchain.PrivateKeyToHex(&w.PrivateKey),
+			Funded:        p.funded,
+		})
+	}
+	return users, nil
+}
+
+// Transfers returns the transfers mined after funding, in order.
+func Transfers() []Transfer {
+	return []Transfer{
+		{From: 0, To: 2, Amount: 2500},
+		{From: 1, To: 3, Amount: 4000},
+		{From: 2, To: 3, Amount: 500},
+		{From: 3, To: 0, Amount: 750},
+	}
+}
@@ -0,0 +1,126 @@
+// Package solvency implements the Merkle-sum tree used for the zakat
+// pool's proof of solvency. Every leaf commits to one liability (an
+// amount pledged to a beneficiary) and every node carries the sum of
+// the liabilities below it, so the published root commits to both the
+// set of liabilities and their total. A beneficiary given the path from
+// their leaf to the root can check that their allocation is included
+// and counted in the total, without learning anyone else's identity.
+package solvency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// Node is a Merkle-sum tree node.
+type Node struct {
+	Hash []byte
+	Sum  uint64
+}
+
+// Leaf is one liability committed to the tree. Salt is a random value
+// that stops others from guessing the leaf from its hash.
+type Leaf struct {
+	ID     string
+	Amount uint64
+	Salt   string
+}
+
+// ProofStep is a sibling on the path from a leaf to the root. Left is
+// true when the sibling is on the left of the running node.
+type ProofStep struct {
+	Hash []byte
+	Sum  uint64
+	Left bool
+}
+
+// LeafNode hashes a leaf: SHA‑256("leaf" || id || 0x00 || salt || uint64be(amount)).
+func LeafNode(l Leaf) Node {
+	buf := []byte("leaf")
+	buf = append(buf, l.ID...)
+	buf = append(buf, 0)
+	buf = append(buf, l.Salt...)
+	buf = binary.BigEndian.AppendUint64(buf, l.Amount)
+	h := sha256.Sum256(buf)
+	return Node{Hash: h[:], Sum: l.Amount}
+}
+
+// parent combines two nodes:
+// SHA‑256("node" || left.hash || uint64be(left.sum) || right.hash || uint64be(right.sum)).
+func parent(left, right Node) Node {
+	buf := []byte("node")
+	buf = append(buf, left.Hash...)
+	buf = binary.BigEndian.AppendUint64(buf, left.Sum)
+	buf = append(buf, right.Hash...)
+	buf = binary.BigEndian.AppendUint64(buf, right.Sum)
+	h := sha256.Sum256(buf)
+	return Node{Hash: h[:], Sum: left.Sum + right.Sum}
+}
+
+// levels builds every level of the tree, leaves first. A level with an
+// odd number of nodes carries its last node up unchanged.
+func levels(leaves []Leaf) [][]Node {
+	level := make([]Node, len(leaves))
+	for i, l := range leaves {
+		level[i] = LeafNode(l)
+	}
+
+	all := [][]Node{level}
+	for len(level) > 1 {
+		next := make([]Node, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, parent(level[i], level[i+1]))
+		}
+		all = append(all, next)
+		level = next
+	}
+	return all
+}
+
+// Root returns the root of the tree over leaves. The root of an empty
+// tree has a zero hash and sum.
+func Root(leaves []Leaf) Node {
+	if len(leaves) == 0 {
+		return Node{Hash: make([]byte, sha256.Size)}
+	}
+	all := levels(leaves)
+	return all[len(all)-1][0]
+}
+
+// Prove returns the path from leaves[index] to the root.
+func Prove(leaves []Leaf, index int) ([]ProofStep, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, fmt.Errorf("leaf %d out of range", index)
+	}
+
+	var path []ProofStep
+	all := levels(leaves)
+	for _, level := range all[:len(all)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			path = append(path, ProofStep{Hash: level[sibling].Hash, Sum: level[sibling].Sum, Left: sibling < index})
+		}
+		index /= 2
+	}
+	return path, nil
+}
+
+// Verify checks that leaf is included under root via path.
+func Verify(leaf Leaf, path []ProofStep, root Node) bool {
+	node := LeafNode(leaf)
+	for _, step := range path {
+		sibling := Node{Hash: step.Hash, Sum: step.Sum}
+		if step.Left {
+			node = parent(sibling, node)
+		} else {
+			node = parent(node, sibling)
+		}
+	}
+	return bytes.Equal(node.Hash, root.Hash) && node.Sum == root.Sum
+}
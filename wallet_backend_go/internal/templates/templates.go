@@ -0,0 +1,197 @@
+// Package templates renders notification emails. Every message has a
+// subject (text/template) and an HTML body (html/template) that is
+// wrapped in a shared branded layout. Defaults are embedded in the
+// binary; a tenant may override any of them, and each tenant supplies
+// branding variables (organization name, colours, logo) that every
+// template can reference as {{.Brand.<key>}}. Message specific values
+// are available as {{.Data.<key>}}; missing keys render empty.
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed defaults/*.tmpl
+var defaults embed.FS
+
+// Template names.
+const (
+	OTP                = "otp"
+	Receipt            = "receipt"
+	ZakatReminder      = "zakat_reminder"
+	DisbursementNotice = "disbursement_notice"
+	AdminDigest        = "admin_digest"
+	PoolAlert          = "pool_alert"
+)
+
+// Names lists every template, in display order.
+var Names = []string{OTP, Receipt, ZakatReminder, DisbursementNotice, AdminDigest, PoolAlert}
+
+// Template is the source of one email.
+type Template struct {
+	Subject string
+	Body    string // HTML fragment placed inside the layout
+}
+
+// Message is a rendered email.
+type Message struct {
+	Subject string
+	HTML    string
+}
+
+// Context is what templates are executed with.
+type Context struct {
+	Brand map[string]string
+	Data  map[string]string
+}
+
+// DefaultBrand holds the branding variables used when a tenant does not
+// set them.
+var DefaultBrand = map[string]string{
+	"organization_name": "ZakatWallet",
+	"primary_color":     "#047857",
+	"logo_url":          "",
+	"support_email":     "",
+	"footer":            "",
+}
+
+// sampleData is the data used to preview each template.
+var sampleData = map[string]map[string]string{
+	OTP: {
+		"code":           "123456",
+		"expires_in":     "5 minutes",
+		"recipient_name": "Ayesha Khan",
+	},
+	Receipt: {
+		"recipient_name": "Ayesha Khan",
+		"receipt_id":     "3f0c2a8e-0000-4000-8000-000000000000",
+		"amount":         "250",
+		"date":           "2026-03-01",
+		"verify_url":     "http://localhost:8080/api/v1/zakat/receipts/3f0c2a8e-0000-4000-8000-000000000000",
+	},
+	ZakatReminder: {
+		"recipient_name":  "Ayesha Khan",
+		"wallet_address":  "9f2c0b7c1d4e5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b",
+		"due_date":        "2026-04-12",
+		"expected_amount": "250",
+	},
+	DisbursementNotice: {
+		"recipient_name": "Bilal Ahmed",
+		"amount":         "1000",
+		"category":       "fuqara",
+		"block_hash":     "00000a1b2c3d4e5f",
+	},
+	AdminDigest: {
+		"admin":           "ops",
+		"frequency":       "weekly",
+		"from":            "2026-02-23",
+		"to":              "2026-03-02",
+		"zakat_collected": "12500",
+		"zakat_records":   "48",
+		"disbursed":       "9000",
+		"disbursements":   "17",
+		"registrations":   "6",
+		"errors":          "2",
+	},
+	PoolAlert: {
+		"pool_address":   "1ZakatPoo1xxxxxxxxxxxxxxxxxxxxxxxx",
+		"peak_balance":   "50000",
+		"peak_at":        "2026-03-01 09:00",
+		"balance":        "20000",
+		"drop_pct":       "60.0",
+		"threshold_pct":  "25.0",
+		"window_minutes": "60",
+	},
+}
+
+// Known reports whether name is a template name.
+func Known(name string) bool {
+	for _, n := range Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SampleData returns a copy of the preview data of a template.
+func SampleData(name string) map[string]string {
+	out := make(map[string]string, len(sampleData[name]))
+	for k, v := range sampleData[name] {
+		out[k] = v
+	}
+	return out
+}
+
+// Default returns the embedded template of name. The files start with a
+// "Subject: ..." line followed by a blank line and the body.
+func Default(name string) (Template, error) {
+	raw, err := defaults.ReadFile("defaults/" + name + ".tmpl")
+	if err != nil {
+		return Template{}, fmt.Errorf("unknown template %q", name)
+	}
+
+	header, body, _ := strings.Cut(strings.ReplaceAll(string(raw), "\r\n", "\n"), "\n\n")
+	subject, ok := strings.CutPrefix(header, "Subject:")
+	if !ok {
+		return Template{}, fmt.Errorf("template %q has no subject line", name)
+	}
+	return Template{Subject: strings.TrimSpace(subject), Body: body}, nil
+}
+
+// Brand merges tenant branding variables over DefaultBrand.
+func Brand(vars map[string]string) map[string]string {
+	out := make(map[string]string, len(DefaultBrand)+len(vars))
+	for k, v := range DefaultBrand {
+		out[k] = v
+	}
+	for k, v := range vars {
+		if v != "" {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Render executes t with ctx and wraps the body in the layout.
+func Render(t Template, ctx Context) (Message, error) {
+	subjectTmpl, err := texttemplate.New("subject").Option("missingkey=zero").Parse(t.Subject)
+	if err != nil {
+		return Message{}, fmt.Errorf("parse subject: %w", err)
+	}
+	bodyTmpl, err := htmltemplate.New("body").Option("missingkey=zero").Parse(t.Body)
+	if err != nil {
+		return Message{}, fmt.Errorf("parse body: %w", err)
+	}
+	layoutSrc, err := defaults.ReadFile("defaults/layout.html.tmpl")
+	if err != nil {
+		return Message{}, err
+	}
+	layout, err := htmltemplate.New("layout").Option("missingkey=zero").Parse(string(layoutSrc))
+	if err != nil {
+		return Message{}, fmt.Errorf("parse layout: %w", err)
+	}
+
+	var subject, body, page bytes.Buffer
+	if err := subjectTmpl.Execute(&subject, ctx); err != nil {
+		return Message{}, fmt.Errorf("render subject: %w", err)
+	}
+	if err := bodyTmpl.Execute(&body, ctx); err != nil {
+		return Message{}, fmt.Errorf("render body: %w", err)
+	}
+	err = layout.Execute(&page, struct {
+		Brand   map[string]string
+		Subject string
+		Content htmltemplate.HTML
+	}{ctx.Brand, subject.String(), htmltemplate.HTML(body.String())})
+	if err != nil {
+		return Message{}, fmt.Errorf("render layout: %w", err)
+	}
+
+	return Message{Subject: strings.TrimSpace(subject.String()), HTML: page.String()}, nil
+}
@@ -0,0 +1,79 @@
+package testutil
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+)
+
+// Epoch is the time test clocks start at.
+var Epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Clock is a manually advanced blockchain.Clock.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a clock standing at start.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the clock's time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// Set moves the clock to t.
+func (c *Clock) Set(t time.Time) {
+	c.mu.Lock()
+	c.now = t
+	c.mu.Unlock()
+}
+
+// Entropy returns an endless deterministic byte stream derived from
+// seed, for use wherever the code takes an entropy source. It is not
+// random and must never reach production code.
+func Entropy(seed string) io.Reader {
+	return &entropy{seed: []byte(seed)}
+}
+
+// entropy is SHA-256 in counter mode over the seed.
+type entropy struct {
+	mu      sync.Mutex
+	seed    []byte
+	counter uint64
+	buf     []byte
+}
+
+func (e *entropy) Read(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	n := 0
+	for n < len(p) {
+		if len(e.buf) == 0 {
+			var ctr [8]byte
+			binary.BigEndian.PutUint64(ctr[:], e.counter)
+			e.counter++
+			block := sha256.Sum256(append(append([]byte{}, e.seed...), ctr[:]...))
+			e.buf = block[:]
+		}
+		c := copy(p[n:], e.buf)
+		e.buf = e.buf[c:]
+		n += c
+	}
+	return n, nil
+}
@@ -0,0 +1,73 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"wallet_backend_go/internal/api"
+	"wallet_backend_go/internal/db"
+)
+
+// NewServer returns an API server around the chain with no database.
+func NewServer(tb testing.TB, c *Chain) *api.Server {
+	tb.Helper()
+	return NewServerWithStore(tb, c, nil)
+}
+
+// NewServerWithStore returns an API server around the chain backed by
+// store, typically a fake that embeds db.Store and overrides only the
+// methods the test reaches. The server shares the chain's clock and
+// draws wallet keys and OTP codes from Entropy(tb.Name()).
+func NewServerWithStore(tb testing.TB, c *Chain, store db.Store) *api.Server {
+	tb.Helper()
+	s := api.NewEphemeralServer(c.BC, store)
+	s.Clock = c.Clock
+	s.Entropy = Entropy(tb.Name())
+	return s
+}
+
+// Serve starts an HTTP server for s's router that is closed when the
+// test ends. Tests that only need responses can use Do instead.
+func Serve(tb testing.TB, s *api.Server) *httptest.Server {
+	tb.Helper()
+	ts := httptest.NewServer(s.Router())
+	tb.Cleanup(ts.Close)
+	return ts
+}
+
+// Do sends a request through h without a network round trip. path is
+// relative to /api/v1, and body, when not nil, is encoded as JSON.
+func Do(tb testing.TB, h http.Handler, method, path string, body interface{}) *httptest.ResponseRecorder {
+	tb.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			tb.Fatalf("encode %s %s body: %v", method, path, err)
+		}
+	}
+	req := httptest.NewRequest(method, "/api/v1"+path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// DecodeJSON fails the test unless rec has status want, then decodes
+// the body into out.
+func DecodeJSON(tb testing.TB, rec *httptest.ResponseRecorder, want int, out interface{}) {
+	tb.Helper()
+
+	if rec.Code != want {
+		tb.Fatalf("status %d, want %d: %s", rec.Code, want, bytes.TrimSpace(rec.Body.Bytes()))
+	}
+	if out == nil {
+		return
+	}
+	if err := json.NewDecoder(rec.Body).Decode(out); err != nil {
+		tb.Fatalf("decode response: %v", err)
+	}
+}
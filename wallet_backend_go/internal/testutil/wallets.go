@@ -0,0 +1,18 @@
+package testutil
+
+import (
+	"wallet_backend_go/internal/blockchain"
+)
+
+// Wallet returns the deterministic wallet called name. The same name
+// yields the same keys and address in every run, so expected addresses
+// can be written into tests.
+func Wallet(name string) *blockchain.Wallet {
+	return blockchain.WalletFromSeed([]byte("zakatwallet-testutil/" + name))
+}
+
+// PrivateKeyHex returns the private key of w as the API expects it in
+// request bodies.
+func PrivateKeyHex(w *blockchain.Wallet) string {
+	return blockchain.PrivateKeyToHex(&w.PrivateKey)
+}
@@ -0,0 +1,146 @@
+package webauthn
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustHex(tb testing.TB, s string) []byte {
+	tb.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+// TestDecodeCBOR checks the examples of RFC 8949 appendix A that fall
+// in the supported subset.
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		hex  string
+		want interface{}
+	}{
+		{"00", int64(0)},
+		{"01", int64(1)},
+		{"0a", int64(10)},
+		{"17", int64(23)},
+		{"1818", int64(24)},
+		{"1819", int64(25)},
+		{"1864", int64(100)},
+		{"1903e8", int64(1000)},
+		{"1a000f4240", int64(1000000)},
+		{"1b000000e8d4a51000", int64(1000000000000)},
+		{"20", int64(-1)},
+		{"29", int64(-10)},
+		{"3863", int64(-100)},
+		{"3903e7", int64(-1000)},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"f7", nil},
+		{"40", []byte(nil)}, // empty byte strings decode to nil
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"60", ""},
+		{"6161", "a"},
+		{"6449455446", "IETF"},
+		{"62c3bc", "ü"},
+		{"80", []interface{}{}},
+		{"83010203", []interface{}{int64(1), int64(2), int64(3)}},
+		{"8301820203820405", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+		{"a0", map[interface{}]interface{}{}},
+		{"a201020304", map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}},
+		{"a26161016162820203", map[interface{}]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+		{"826161a161626163", []interface{}{"a", map[interface{}]interface{}{"b": "c"}}},
+		{"c11a514b67b0", int64(1363896240)}, // tag 1, epoch time
+	}
+	for _, tt := range tests {
+		got, rest, err := decodeCBOR(mustHex(t, tt.hex))
+		if err != nil {
+			t.Errorf("%s: %v", tt.hex, err)
+			continue
+		}
+		if len(rest) != 0 {
+			t.Errorf("%s: %d bytes left over", tt.hex, len(rest))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.hex, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeCBORRest(t *testing.T) {
+	got, rest, err := decodeCBOR(mustHex(t, "6161ff00"))
+	if err != nil || got != "a" || !bytes.Equal(rest, []byte{0xff, 0x00}) {
+		t.Errorf("decodeCBOR = %v, %x, %v, want \"a\" followed by ff00", got, rest, err)
+	}
+}
+
+func TestDecodeCBORRejects(t *testing.T) {
+	tests := []struct {
+		name, hex, want string
+	}{
+		{"empty", "", "unexpected end"},
+		{"truncated argument", "19e8", "unexpected end"},
+		{"truncated bytes", "44010203", "unexpected end"},
+		{"truncated text", "64494554", "unexpected end"},
+		{"truncated array", "830102", "unexpected end"},
+		{"truncated map", "a2010203", "unexpected end"},
+		{"huge array length", "9bffffffffffffffff", "unexpected end"},
+		{"huge byte string length", "5bffffffffffffffff00", "unexpected end"},
+		{"integer overflow", "1bffffffffffffffff", "overflows int64"},
+		{"negative overflow", "3b8000000000000000", "overflows int64"},
+		{"indefinite byte string", "5f42010243030405ff", "indefinite"},
+		{"indefinite array", "9f01ff", "indefinite"},
+		{"reserved argument", "1c", "indefinite"},
+		{"half float", "f93c00", "simple value"},
+		{"double", "fb3ff199999999999a", "simple value"},
+		{"simple value 16", "f0", "simple value"},
+		{"array map key", "a1800102", "map key"},
+		{"byte string map key", "a1400102", "map key"},
+		{"nested too deeply", strings.Repeat("81", maxCBORDepth+2) + "00", "too deeply"},
+		{"tags nested too deeply", strings.Repeat("c1", maxCBORDepth+2) + "00", "too deeply"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := decodeCBOR(mustHex(t, tt.hex))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzDecodeCBOR(f *testing.F) {
+	for _, seed := range []string{
+		"00", "3903e7", "4401020304", "6449455446", "8301820203820405",
+		"a26161016162820203", "c11a514b67b0", "f5", "9bffffffffffffffff",
+		"a50102032620012158200000000000000000000000000000000000000000000000000000000000000000225820" +
+			"0000000000000000000000000000000000000000000000000000000000000000",
+	} {
+		f.Add(mustHex(f, seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		v, rest, err := decodeCBOR(data)
+		if err != nil {
+			if v != nil || rest != nil {
+				t.Fatalf("error %v came with a value or rest", err)
+			}
+			return
+		}
+		if len(rest) >= len(data) || !bytes.HasSuffix(data, rest) {
+			t.Fatalf("rest %x is not a proper suffix of %x", rest, data)
+		}
+		// decoding what was consumed alone gives the same item
+		again, left, err := decodeCBOR(data[:len(data)-len(rest)])
+		if err != nil || len(left) != 0 || !reflect.DeepEqual(again, v) {
+			t.Fatalf("item %x decodes differently on its own: %#v, %x, %v", data[:len(data)-len(rest)], again, left, err)
+		}
+		// COSE parsing of arbitrary input must not panic either
+		_, _, _ = parsePublicKey(data)
+		_, _ = parseAuthenticatorData(data)
+	})
+}
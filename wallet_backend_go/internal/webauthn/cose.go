@@ -0,0 +1,126 @@
+package webauthn
+
+// cose.go parses credential public keys, which authenticators encode
+// as COSE_Key maps (RFC 9053), and verifies signatures made with them.
+// ES256, EdDSA (Ed25519) and RS256 are supported, which covers platform
+// authenticators and security keys in practice.
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// SupportedAlgorithms lists the algorithms offered to authenticators,
+// in order of preference.
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters.
+const (
+	coseKty = 1
+	coseAlg = 3
+
+	coseCrv = -1 // EC2 and OKP
+	coseX   = -2
+	coseY   = -3
+	coseN   = -1 // RSA
+	coseE   = -2
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+// publicKey is a parsed credential public key.
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE_Key. It returns the key and the bytes
+// following it.
+func parsePublicKey(b []byte) (*publicKey, []byte, error) {
+	v, rest, err := decodeCBOR(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, nil, errors.New("cose: key is not a map")
+	}
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, nil, errors.New("cose: invalid P-256 key")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, nil, errors.New("cose: P-256 point is not on the curve")
+		}
+		return &publicKey{alg: alg, key: pub}, rest, nil
+
+	case kty == ktyOKP && alg == AlgEdDSA:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, nil, errors.New("cose: invalid Ed25519 key")
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, rest, nil
+
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := m[int64(coseN)].([]byte)
+		e, _ := m[int64(coseE)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, nil, errors.New("cose: invalid RSA key")
+		}
+		exp := 0
+		for _, c := range e {
+			exp = exp<<8 | int(c)
+		}
+		return &publicKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}}, rest, nil
+	}
+	return nil, nil, fmt.Errorf("cose: unsupported key type %d with algorithm %d", kty, alg)
+}
+
+// verify checks sig over data.
+func (k *publicKey) verify(data, sig []byte) error {
+	switch pub := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		if ecdsa.VerifyASN1(pub, digest[:], sig) {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if ed25519.Verify(pub, data, sig) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil {
+			return nil
+		}
+	}
+	return errors.New("webauthn: invalid signature")
+}
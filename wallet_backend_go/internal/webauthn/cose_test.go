@@ -0,0 +1,199 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/binary"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// cborHead encodes the head of an item of major type major with
+// argument n.
+func cborHead(major byte, n int) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 1<<8:
+		return []byte{major<<5 | 24, byte(n)}
+	case n < 1<<16:
+		b := []byte{major<<5 | 25, 0, 0}
+		binary.BigEndian.PutUint16(b[1:], uint16(n))
+		return b
+	}
+	b := []byte{major<<5 | 26, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[1:], uint32(n))
+	return b
+}
+
+func cborInt(v int) []byte {
+	if v < 0 {
+		return cborHead(1, -1-v)
+	}
+	return cborHead(0, v)
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, len(b)), b...) }
+func cborText(s string) []byte  { return append(cborHead(3, len(s)), s...) }
+
+// cborMap encodes a map from alternating encoded keys and values.
+func cborMap(kv ...[]byte) []byte {
+	out := cborHead(5, len(kv)/2)
+	for _, item := range kv {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func ec2Key(x, y []byte) []byte {
+	return cborMap(
+		cborInt(coseKty), cborInt(ktyEC2),
+		cborInt(coseAlg), cborInt(AlgES256),
+		cborInt(coseCrv), cborInt(crvP256),
+		cborInt(coseX), cborBytes(x),
+		cborInt(coseY), cborBytes(y),
+	)
+}
+
+func okpKey(x []byte) []byte {
+	return cborMap(
+		cborInt(coseKty), cborInt(ktyOKP),
+		cborInt(coseAlg), cborInt(AlgEdDSA),
+		cborInt(coseCrv), cborInt(crvEd25519),
+		cborInt(coseX), cborBytes(x),
+	)
+}
+
+func rsaKey(n, e []byte) []byte {
+	return cborMap(
+		cborInt(coseKty), cborInt(ktyRSA),
+		cborInt(coseAlg), cborInt(AlgRS256),
+		cborInt(coseN), cborBytes(n),
+		cborInt(coseE), cborBytes(e),
+	)
+}
+
+// TestES256 verifies the P-256/SHA-256 signature of "sample" from
+// RFC 6979 appendix A.2.5.
+func TestES256(t *testing.T) {
+	x := mustHex(t, "60fed4ba255a9d31c961eb74c6356d68c049b8923b61fa6ce669622e60f29fb6")
+	y := mustHex(t, "7903fe1008b8bc99a41ae9e95628bc64f2f1b20c2d7e9f5177a3c294d4462299")
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{
+		new(big.Int).SetBytes(mustHex(t, "efd48b2aacb6a8fd1140dd9cd45e81d69d2c877b56aaf991c34d0ea84eaf3716")),
+		new(big.Int).SetBytes(mustHex(t, "f7cb1c942d657c41d436c7a1b6e29f65f3e900dbb9aff4064dc4ab2f843acda8")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, rest, err := parsePublicKey(append(ec2Key(x, y), 0xff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.alg != AlgES256 || len(rest) != 1 {
+		t.Errorf("alg %d with %d bytes after the key, want %d with 1", key.alg, len(rest), AlgES256)
+	}
+	if err := key.verify([]byte("sample"), sig); err != nil {
+		t.Errorf("RFC 6979 signature: %v", err)
+	}
+	if err := key.verify([]byte("test"), sig); err == nil {
+		t.Error("signature verified over another message")
+	}
+}
+
+// TestEdDSA verifies the first test vector of RFC 8032 section 7.1.
+func TestEdDSA(t *testing.T) {
+	x := mustHex(t, "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a")
+	sig := mustHex(t, "e5564300c360ac729086e2cc806e828a84877f1eb8e5d974d873e06522490155"+
+		"5fb8821590a33bacc61e39701cf9b46bd25bf5f0595bbe24655141438e7a100b")
+
+	key, _, err := parsePublicKey(okpKey(x))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := key.verify(nil, sig); err != nil {
+		t.Errorf("RFC 8032 signature: %v", err)
+	}
+	sig[0] ^= 1
+	if err := key.verify(nil, sig); err == nil {
+		t.Error("tampered signature verified")
+	}
+}
+
+func TestRS256(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := big.NewInt(int64(priv.E)).Bytes()
+	key, _, err := parsePublicKey(rsaKey(priv.N.Bytes(), e))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("data"))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := key.verify([]byte("data"), sig); err != nil {
+		t.Errorf("RS256 signature: %v", err)
+	}
+	if err := key.verify([]byte("date"), sig); err == nil {
+		t.Error("signature verified over another message")
+	}
+}
+
+func TestParsePublicKeyRejects(t *testing.T) {
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	x, y := p256.X.FillBytes(make([]byte, 32)), p256.Y.FillBytes(make([]byte, 32))
+	offCurve := append([]byte(nil), y...)
+	offCurve[31] ^= 1
+	ed, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name string
+		key  []byte
+		want string
+	}{
+		{"not cbor", []byte{0x1c}, "cbor"},
+		{"not a map", cborBytes(x), "not a map"},
+		{"no key type", cborMap(cborInt(coseAlg), cborInt(AlgES256)), "unsupported key type"},
+		{"EC2 with EdDSA", cborMap(
+			cborInt(coseKty), cborInt(ktyEC2), cborInt(coseAlg), cborInt(AlgEdDSA),
+			cborInt(coseCrv), cborInt(crvP256), cborInt(coseX), cborBytes(x), cborInt(coseY), cborBytes(y),
+		), "unsupported key type"},
+		{"P-384 curve", cborMap(
+			cborInt(coseKty), cborInt(ktyEC2), cborInt(coseAlg), cborInt(AlgES256),
+			cborInt(coseCrv), cborInt(2), cborInt(coseX), cborBytes(x), cborInt(coseY), cborBytes(y),
+		), "invalid P-256 key"},
+		{"short x", ec2Key(x[1:], y), "invalid P-256 key"},
+		{"text x", cborMap(
+			cborInt(coseKty), cborInt(ktyEC2), cborInt(coseAlg), cborInt(AlgES256),
+			cborInt(coseCrv), cborInt(crvP256), cborInt(coseX), cborText(string(x)), cborInt(coseY), cborBytes(y),
+		), "invalid P-256 key"},
+		{"point off the curve", ec2Key(x, offCurve), "not on the curve"},
+		{"short Ed25519 key", okpKey([]byte(ed)[:31]), "invalid Ed25519 key"},
+		{"X25519 curve", cborMap(
+			cborInt(coseKty), cborInt(ktyOKP), cborInt(coseAlg), cborInt(AlgEdDSA),
+			cborInt(coseCrv), cborInt(4), cborInt(coseX), cborBytes(ed),
+		), "invalid Ed25519 key"},
+		{"RSA-1024", rsaKey(make([]byte, 128), []byte{1, 0, 1}), "invalid RSA key"},
+		{"RSA without exponent", rsaKey(make([]byte, 256), nil), "invalid RSA key"},
+		{"RSA huge exponent", rsaKey(make([]byte, 256), make([]byte, 5)), "invalid RSA key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parsePublicKey(tt.key)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+// Package webauthn verifies WebAuthn (passkey) registration and
+// authentication ceremonies on the relying party side, using only the
+// standard library.
+//
+// Registration checks the client data, the relying party id hash and
+// the user presence flag, and extracts the credential id and public
+// key. Attestation statements are not verified: the server requests
+// attestation "none", so authenticators are not vouched for by their
+// manufacturer, which is the usual choice for consumer passkeys.
+// Authentication checks the same properties plus the signature and the
+// signature counter.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Client data types of the two ceremonies.
+const (
+	TypeCreate = "webauthn.create"
+	TypeGet    = "webauthn.get"
+)
+
+// Authenticator data flags.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+	flagExtensions   = 0x80
+)
+
+// Config identifies the relying party.
+type Config struct {
+	RPID    string   // domain the credentials are scoped to, e.g. "example.org"
+	RPName  string   // shown by the authenticator
+	Origins []string // origins allowed to run the ceremonies, e.g. "https://example.org"
+}
+
+// Credential is a registered public key credential.
+type Credential struct {
+	ID           []byte
+	PublicKey    []byte // COSE_Key
+	Algorithm    int64
+	SignCount    uint32
+	UserVerified bool
+}
+
+// ClientData is the part of clientDataJSON the relying party checks.
+type ClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// Encode returns b in the unpadded base64url form WebAuthn uses on the
+// wire.
+func Encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Decode parses unpadded (or padded) base64url.
+func Decode(s string) ([]byte, error) {
+	if b, err := base64.RawURLEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
+
+// NewChallenge returns 32 random bytes from entropy, base64url encoded.
+func NewChallenge(entropy io.Reader) (string, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(entropy, b); err != nil {
+		return "", err
+	}
+	return Encode(b), nil
+}
+
+// ParseClientData decodes clientDataJSON. Servers use it to find the
+// challenge, and with it the pending ceremony, before verifying.
+func ParseClientData(raw []byte) (*ClientData, error) {
+	var cd ClientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, fmt.Errorf("webauthn: invalid client data: %w", err)
+	}
+	return &cd, nil
+}
+
+func (c Config) checkClientData(raw []byte, typ, challenge string) error {
+	cd, err := ParseClientData(raw)
+	if err != nil {
+		return err
+	}
+	if cd.Type != typ {
+		return fmt.Errorf("webauthn: client data type is %q, want %q", cd.Type, typ)
+	}
+	if cd.Challenge != challenge {
+		return errors.New("webauthn: challenge mismatch")
+	}
+	if cd.CrossOrigin {
+		return errors.New("webauthn: cross-origin ceremonies are not allowed")
+	}
+	for _, o := range c.Origins {
+		if cd.Origin == o {
+			return nil
+		}
+	}
+	return fmt.Errorf("webauthn: origin %q is not allowed", cd.Origin)
+}
+
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+
+	credentialID []byte
+	publicKey    []byte
+	parsedKey    *publicKey
+}
+
+func parseAuthenticatorData(b []byte) (*authenticatorData, error) {
+	if len(b) < 37 {
+		return nil, errors.New("webauthn: authenticator data too short")
+	}
+	ad := &authenticatorData{
+		rpIDHash:  b[:32],
+		flags:     b[32],
+		signCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+	rest := b[37:]
+
+	if ad.flags&flagAttested != 0 {
+		// aaguid (16), credential id length (2), credential id, key
+		if len(rest) < 18 {
+			return nil, errors.New("webauthn: attested credential data too short")
+		}
+		n := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < n {
+			return nil, errors.New("webauthn: credential id truncated")
+		}
+		ad.credentialID = rest[:n]
+		rest = rest[n:]
+
+		key, after, err := parsePublicKey(rest)
+		if err != nil {
+			return nil, err
+		}
+		ad.publicKey = rest[:len(rest)-len(after)]
+		ad.parsedKey = key
+		rest = after
+	}
+	if ad.flags&flagExtensions != 0 {
+		var err error
+		if _, rest, err = decodeCBOR(rest); err != nil {
+			return nil, fmt.Errorf("webauthn: extensions: %w", err)
+		}
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("webauthn: trailing bytes in authenticator data")
+	}
+	return ad, nil
+}
+
+func (c Config) checkAuthenticatorData(ad *authenticatorData) error {
+	want := sha256.Sum256([]byte(c.RPID))
+	if !bytes.Equal(ad.rpIDHash, want[:]) {
+		return errors.New("webauthn: relying party id mismatch")
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return errors.New("webauthn: user not present")
+	}
+	return nil
+}
+
+// VerifyRegistration checks the response to a credential creation with
+// the given challenge and returns the new credential.
+func (c Config) VerifyRegistration(challenge string, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := c.checkClientData(clientDataJSON, TypeCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	v, rest, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: attestation object: %w", err)
+	}
+	att, ok := v.(map[interface{}]interface{})
+	if !ok || len(rest) != 0 {
+		return nil, errors.New("webauthn: malformed attestation object")
+	}
+	raw, ok := att["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("webauthn: attestation object has no authData")
+	}
+
+	ad, err := parseAuthenticatorData(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkAuthenticatorData(ad); err != nil {
+		return nil, err
+	}
+	if ad.parsedKey == nil {
+		return nil, errors.New("webauthn: no attested credential data")
+	}
+
+	return &Credential{
+		ID:           append([]byte(nil), ad.credentialID...),
+		PublicKey:    append([]byte(nil), ad.publicKey...),
+		Algorithm:    ad.parsedKey.alg,
+		SignCount:    ad.signCount,
+		UserVerified: ad.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// ErrCounterRegressed is returned when a credential's signature counter
+// did not increase, which indicates a cloned authenticator.
+var ErrCounterRegressed = errors.New("webauthn: signature counter did not increase")
+
+// VerifyAssertion checks the response to an authentication with the
+// given challenge, made with cred. It returns the new signature
+// counter to store.
+func (c Config) VerifyAssertion(challenge string, cred *Credential, clientDataJSON, authenticatorDataRaw, signature []byte) (uint32, error) {
+	if err := c.checkClientData(clientDataJSON, TypeGet, challenge); err != nil {
+		return 0, err
+	}
+
+	ad, err := parseAuthenticatorData(authenticatorDataRaw)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.checkAuthenticatorData(ad); err != nil {
+		return 0, err
+	}
+
+	key, _, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authenticatorDataRaw...), clientDataHash[:]...)
+	if err := key.verify(signed, signature); err != nil {
+		return 0, err
+	}
+
+	// authenticators without a counter always report zero
+	if (ad.signCount != 0 || cred.SignCount != 0) && ad.signCount <= cred.SignCount {
+		return 0, ErrCounterRegressed
+	}
+	return ad.signCount, nil
+}
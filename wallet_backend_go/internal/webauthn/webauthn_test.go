@@ -0,0 +1,166 @@
+package webauthn
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testConfig = Config{RPID: "example.org", RPName: "Example", Origins: []string{"https://example.org"}}
+
+// authenticator is a software Ed25519 authenticator.
+type authenticator struct {
+	id    []byte
+	priv  ed25519.PrivateKey
+	count uint32
+}
+
+func newAuthenticator() *authenticator {
+	seed := sha256.Sum256([]byte("webauthn test authenticator"))
+	return &authenticator{id: []byte("credential-1"), priv: ed25519.NewKeyFromSeed(seed[:])}
+}
+
+func clientData(typ, challenge, origin string) []byte {
+	b, _ := json.Marshal(ClientData{Type: typ, Challenge: challenge, Origin: origin})
+	return b
+}
+
+// authData builds authenticator data for rpID with flags, attesting
+// the credential when flagAttested is set.
+func (a *authenticator) authData(rpID string, flags byte) []byte {
+	hash := sha256.Sum256([]byte(rpID))
+	b := append(hash[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(b[33:], a.count)
+	if flags&flagAttested != 0 {
+		b = append(b, make([]byte, 16)...) // aaguid
+		b = binary.BigEndian.AppendUint16(b, uint16(len(a.id)))
+		b = append(b, a.id...)
+		b = append(b, okpKey(a.priv.Public().(ed25519.PublicKey))...)
+	}
+	return b
+}
+
+func attestationObject(authData []byte) []byte {
+	return cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(authData),
+	)
+}
+
+func (a *authenticator) sign(authData, clientDataJSON []byte) []byte {
+	hash := sha256.Sum256(clientDataJSON)
+	return ed25519.Sign(a.priv, append(append([]byte(nil), authData...), hash[:]...))
+}
+
+func TestCeremonies(t *testing.T) {
+	a := newAuthenticator()
+	cd := clientData(TypeCreate, "reg-challenge", "https://example.org")
+	cred, err := testConfig.VerifyRegistration("reg-challenge", cd,
+		attestationObject(a.authData("example.org", flagUserPresent|flagUserVerified|flagAttested)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cred.ID) != "credential-1" || cred.Algorithm != AlgEdDSA || !cred.UserVerified || cred.SignCount != 0 {
+		t.Fatalf("credential = %+v", cred)
+	}
+
+	for i := 0; i < 2; i++ {
+		a.count++
+		ad := a.authData("example.org", flagUserPresent)
+		cd := clientData(TypeGet, "login", "https://example.org")
+		count, err := testConfig.VerifyAssertion("login", cred, cd, ad, a.sign(ad, cd))
+		if err != nil {
+			t.Fatalf("assertion %d: %v", i, err)
+		}
+		if count != a.count {
+			t.Errorf("assertion %d: counter %d, want %d", i, count, a.count)
+		}
+		cred.SignCount = count
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	a := newAuthenticator()
+	attested := a.authData("example.org", flagUserPresent|flagAttested)
+	good := clientData(TypeCreate, "c", "https://example.org")
+
+	tests := []struct {
+		name       string
+		clientData []byte
+		attObj     []byte
+		want       string
+	}{
+		{"client data not json", []byte("{"), attestationObject(attested), "invalid client data"},
+		{"get instead of create", clientData(TypeGet, "c", "https://example.org"), attestationObject(attested), "client data type"},
+		{"other challenge", clientData(TypeCreate, "d", "https://example.org"), attestationObject(attested), "challenge mismatch"},
+		{"other origin", clientData(TypeCreate, "c", "https://evil.example"), attestationObject(attested), "origin"},
+		{"cross origin", []byte(`{"type":"webauthn.create","challenge":"c","origin":"https://example.org","crossOrigin":true}`),
+			attestationObject(attested), "cross-origin"},
+		{"attestation not cbor", good, []byte{0xff}, "attestation object"},
+		{"attestation not a map", good, cborBytes(attested), "malformed attestation object"},
+		{"trailing bytes after attestation", good, append(attestationObject(attested), 0), "malformed attestation object"},
+		{"no authData", good, cborMap(cborText("fmt"), cborText("none")), "no authData"},
+		{"short authData", good, attestationObject(attested[:36]), "too short"},
+		{"other relying party", good, attestationObject(a.authData("evil.example", flagUserPresent|flagAttested)), "relying party"},
+		{"user not present", good, attestationObject(a.authData("example.org", flagAttested)), "not present"},
+		{"no credential", good, attestationObject(a.authData("example.org", flagUserPresent)), "no attested credential"},
+		{"credential id cut", good, attestationObject(attested[:37+18+4]), "credential id truncated"},
+		{"trailing bytes in authData", good, attestationObject(append(append([]byte(nil), attested...), 0)), "trailing bytes"},
+		{"extensions flag without extensions", good,
+			attestationObject(a.authData("example.org", flagUserPresent|flagAttested|flagExtensions)), "extensions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := testConfig.VerifyRegistration("c", tt.clientData, tt.attObj)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	a := newAuthenticator()
+	cred := &Credential{ID: a.id, PublicKey: okpKey(a.priv.Public().(ed25519.PublicKey)), Algorithm: AlgEdDSA, SignCount: 5}
+	cd := clientData(TypeGet, "c", "https://example.org")
+
+	a.count = 6
+	ad := a.authData("example.org", flagUserPresent)
+	sig := a.sign(ad, cd)
+	if _, err := testConfig.VerifyAssertion("c", cred, cd, ad, sig); err != nil {
+		t.Fatalf("valid assertion: %v", err)
+	}
+
+	tamperedAD := append([]byte(nil), ad...)
+	tamperedAD[32] |= flagUserVerified
+	if _, err := testConfig.VerifyAssertion("c", cred, cd, tamperedAD, sig); err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Errorf("tampered flags: error = %v, want an invalid signature", err)
+	}
+	otherCD := clientData(TypeGet, "c", "https://example.org ")
+	if _, err := testConfig.VerifyAssertion("c", cred, otherCD, ad, sig); err == nil {
+		t.Error("assertion verified with another origin")
+	}
+	if _, err := testConfig.VerifyAssertion("c", cred, clientData(TypeCreate, "c", "https://example.org"), ad, sig); err == nil {
+		t.Error("registration client data accepted for an assertion")
+	}
+
+	a.count = 5
+	ad = a.authData("example.org", flagUserPresent)
+	if _, err := testConfig.VerifyAssertion("c", cred, cd, ad, a.sign(ad, cd)); !errors.Is(err, ErrCounterRegressed) {
+		t.Errorf("repeated counter: error = %v, want ErrCounterRegressed", err)
+	}
+
+	// authenticators without a counter keep reporting zero
+	a.count = 0
+	ad = a.authData("example.org", flagUserPresent)
+	noCounter := *cred
+	noCounter.SignCount = 0
+	if _, err := testConfig.VerifyAssertion("c", &noCounter, cd, ad, a.sign(ad, cd)); err != nil {
+		t.Errorf("zero counter: %v", err)
+	}
+}
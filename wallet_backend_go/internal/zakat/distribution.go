@@ -0,0 +1,191 @@
+package zakat
+
+// distribution.go splits the zakat pool across approved beneficiaries.
+// A policy may carry a distribution section that weighs beneficiaries
+// equally or by needs score and, optionally, first divides the pool
+// between the eight categories of recipients (asnaf) in fixed basis
+// points. Parts are rounded down and the units left over go to the
+// largest remainders, so the parts add up to what is distributed.
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Beneficiary categories, the eight asnaf of zakat recipients.
+const (
+	CategoryFuqara       = "fuqara"        // the poor
+	CategoryMasakin      = "masakin"       // the needy
+	CategoryAmilin       = "amilin"        // zakat administrators
+	CategoryMuallafah    = "muallafah"     // those whose hearts are to be reconciled
+	CategoryRiqab        = "riqab"         // freeing captives
+	CategoryGharimin     = "gharimin"      // debtors
+	CategoryFiSabilillah = "fi_sabilillah" // in the cause of God
+	CategoryIbnSabil     = "ibn_sabil"     // stranded travellers
+)
+
+// Categories lists the beneficiary categories.
+var Categories = []string{
+	CategoryFuqara, CategoryMasakin, CategoryAmilin, CategoryMuallafah,
+	CategoryRiqab, CategoryGharimin, CategoryFiSabilillah, CategoryIbnSabil,
+}
+
+// ValidCategory reports whether c is a beneficiary category.
+func ValidCategory(c string) bool {
+	for _, known := range Categories {
+		if c == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Distribution methods.
+const (
+	// DistributeEqual gives every beneficiary the same part.
+	DistributeEqual = "equal"
+	// DistributeNeeds weighs beneficiaries by their needs score.
+	DistributeNeeds = "needs"
+)
+
+// Distribution says how the pool is split across beneficiaries.
+type Distribution struct {
+	Method string `json:"method"` // equal or needs, default equal
+	// CategoryBPS divides the pool between categories first, in basis
+	// points adding up to 10000. Without it all beneficiaries share the
+	// pool regardless of category.
+	CategoryBPS map[string]int `json:"category_bps,omitempty"`
+}
+
+// DefaultDistribution is the distribution of a policy without one: the
+// pool in equal parts.
+func DefaultDistribution() Distribution {
+	return Distribution{Method: DistributeEqual}
+}
+
+// Validate checks the method and the category shares.
+func (d Distribution) Validate() error {
+	switch d.Method {
+	case "", DistributeEqual, DistributeNeeds:
+	default:
+		return fmt.Errorf("distribution: unknown method %q", d.Method)
+	}
+	if len(d.CategoryBPS) == 0 {
+		return nil
+	}
+	total := 0
+	for c, bps := range d.CategoryBPS {
+		if !ValidCategory(c) {
+			return fmt.Errorf("distribution: unknown category %q", c)
+		}
+		if bps < 0 || bps > maxRateBPS {
+			return fmt.Errorf("distribution: %s must be between 0 and %d basis points", c, maxRateBPS)
+		}
+		total += bps
+	}
+	if total != maxRateBPS {
+		return fmt.Errorf("distribution: category shares add up to %d basis points, not %d", total, maxRateBPS)
+	}
+	return nil
+}
+
+// Recipient is a beneficiary as Allocate sees it.
+type Recipient struct {
+	ID         string
+	Category   string
+	NeedsScore int
+}
+
+// Allocate splits amount across recipients and returns the part of
+// each, in the order given, and what is left undistributed: the shares
+// of categories without recipients, or the pool when there are none.
+// Recipients in a category the distribution gives no share get 0.
+func (d Distribution) Allocate(amount int, recipients []Recipient) ([]int, int) {
+	parts := make([]int, len(recipients))
+	if amount <= 0 {
+		return parts, max(amount, 0)
+	}
+	if len(d.CategoryBPS) == 0 {
+		all := make([]int, len(recipients))
+		for i := range all {
+			all[i] = i
+		}
+		return parts, d.allocateGroup(amount, recipients, all, parts)
+	}
+
+	groups := make(map[string][]int)
+	for i, rc := range recipients {
+		groups[rc.Category] = append(groups[rc.Category], i)
+	}
+	cats := make([]string, 0, len(d.CategoryBPS))
+	weights := make([]int, 0, len(d.CategoryBPS))
+	for _, c := range Categories {
+		if bps, ok := d.CategoryBPS[c]; ok {
+			cats = append(cats, c)
+			weights = append(weights, bps)
+		}
+	}
+	left := 0
+	for i, share := range largestRemainder(amount, weights) {
+		left += d.allocateGroup(share, recipients, groups[cats[i]], parts)
+	}
+	return parts, left
+}
+
+// allocateGroup splits amount across the recipients at idx into parts
+// and returns what could not be given to anyone.
+func (d Distribution) allocateGroup(amount int, recipients []Recipient, idx []int, parts []int) int {
+	if len(idx) == 0 {
+		return amount
+	}
+	weights := make([]int, len(idx))
+	total := 0
+	for i, j := range idx {
+		weights[i] = 1
+		if d.Method == DistributeNeeds {
+			weights[i] = max(recipients[j].NeedsScore, 0)
+		}
+		total += weights[i]
+	}
+	if total == 0 {
+		// nobody scored; share equally rather than not at all
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+	for i, part := range largestRemainder(amount, weights) {
+		parts[idx[i]] += part
+	}
+	return 0
+}
+
+// largestRemainder divides amount in proportion to weights, which must
+// not all be zero. Each part is rounded down; the units left over go
+// one each to the largest remainders, earlier parts first on ties.
+func largestRemainder(amount int, weights []int) []int {
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	parts := make([]int, len(weights))
+	if total == 0 {
+		return parts
+	}
+	rems := make([]int, len(weights))
+	left := amount
+	for i, w := range weights {
+		parts[i] = amount * w / total
+		rems[i] = amount * w % total
+		left -= parts[i]
+	}
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return rems[order[a]] > rems[order[b]] })
+	for i := 0; left > 0; i++ {
+		parts[order[i]]++
+		left--
+	}
+	return parts
+}
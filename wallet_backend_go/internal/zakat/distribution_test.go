@@ -0,0 +1,51 @@
+package zakat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAllocate(t *testing.T) {
+	recipients := []Recipient{
+		{ID: "a", Category: CategoryFuqara, NeedsScore: 3},
+		{ID: "b", Category: CategoryFuqara, NeedsScore: 1},
+		{ID: "c", Category: CategoryGharimin, NeedsScore: 0},
+	}
+
+	tests := []struct {
+		name       string
+		d          Distribution
+		amount     int
+		recipients []Recipient
+		want       []int
+		left       int
+	}{
+		{"equal", DefaultDistribution(), 100, recipients, []int{34, 33, 33}, 0},
+		{"needs", Distribution{Method: DistributeNeeds}, 100, recipients, []int{75, 25, 0}, 0},
+		{"needs without scores shares equally", Distribution{Method: DistributeNeeds}, 10,
+			[]Recipient{{ID: "x"}, {ID: "y"}}, []int{5, 5}, 0},
+		{"by category", Distribution{Method: DistributeNeeds, CategoryBPS: map[string]int{
+			CategoryFuqara: 6000, CategoryGharimin: 4000,
+		}}, 100, recipients, []int{45, 15, 40}, 0},
+		{"category without recipients", Distribution{CategoryBPS: map[string]int{
+			CategoryFuqara: 5000, CategoryIbnSabil: 5000,
+		}}, 101, recipients, []int{26, 25, 0}, 50},
+		{"nobody", DefaultDistribution(), 100, nil, []int{}, 100},
+		{"nothing", DefaultDistribution(), 0, recipients, []int{0, 0, 0}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, left := tt.d.Allocate(tt.amount, tt.recipients)
+			if !reflect.DeepEqual(parts, tt.want) || left != tt.left {
+				t.Errorf("Allocate(%d) = %v, %d left, want %v, %d left", tt.amount, parts, left, tt.want, tt.left)
+			}
+			total := left
+			for _, p := range parts {
+				total += p
+			}
+			if total != tt.amount {
+				t.Errorf("parts and remainder add up to %d, want %d", total, tt.amount)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+// Package zakat evaluates declarative zakat policies. A policy is a
+// small JSON document listing one rule per asset class (rate,
+// threshold, schedule); the API stores one versioned policy per tenant
+// and asks the engine how much zakat is due instead of hardcoding the
+// nisab, hawl and rate. The package has no dependency on the chain or
+// the database.
+package zakat
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Asset classes known to the engine.
+const (
+	// AssetCash is the balance held in a wallet; zakat runs and the
+	// user projection assess it.
+	AssetCash = "cash"
+	// AssetIncome is an incoming transfer; "pay zakat as you earn"
+	// assesses it.
+	AssetIncome = "income"
+)
+
+// Schedule kinds.
+const (
+	// ScheduleHawl makes zakat due once wealth has been held for Days.
+	ScheduleHawl = "hawl"
+	// ScheduleOnReceipt makes zakat due as soon as the asset arrives.
+	ScheduleOnReceipt = "on_receipt"
+)
+
+const (
+	// DefaultHawlDays is the length of the lunar year that wealth must
+	// be held before zakat becomes due.
+	DefaultHawlDays = 354
+	// DefaultRateBPS is the standard rate of 2.5%.
+	DefaultRateBPS = 250
+
+	maxRateBPS = 10000
+)
+
+// Reasons an assessment owes nothing.
+const (
+	ReasonNoRule     = "no rule"
+	ReasonNothing    = "nothing to assess"
+	ReasonBelowNisab = "below nisab"
+)
+
+// Schedule says when a rule's zakat becomes due.
+type Schedule struct {
+	Kind string `json:"kind"`           // hawl or on_receipt
+	Days int    `json:"days,omitempty"` // hawl length, default DefaultHawlDays
+}
+
+// Rule is the policy of one asset class.
+type Rule struct {
+	AssetClass string   `json:"asset_class"`
+	RateBPS    int      `json:"rate_bps"`  // basis points, 250 = 2.5%
+	Threshold  int      `json:"threshold"` // nisab: smaller amounts owe nothing
+	Schedule   Schedule `json:"schedule"`
+}
+
+// Policy is a declarative zakat policy document.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+	// Distribution splits the pool across beneficiaries; see
+	// DefaultDistribution when it is absent.
+	Distribution *Distribution `json:"distribution,omitempty"`
+}
+
+// Assessment is the outcome of evaluating an amount against a rule.
+type Assessment struct {
+	AssetClass string `json:"asset_class"`
+	Base       int    `json:"base"`
+	Amount     int    `json:"amount"`           // zakat due, 0 when exempt
+	Reason     string `json:"reason,omitempty"` // why nothing is due
+}
+
+// Default returns the policy the deployment used before policies were
+// configurable: 2.5% of cash held for a hawl above nisab, and 2.5% of
+// every incoming transfer for wallets that opted into auto zakat.
+func Default(nisab int) Policy {
+	return Policy{Rules: []Rule{
+		{AssetClass: AssetCash, RateBPS: DefaultRateBPS, Threshold: nisab, Schedule: Schedule{Kind: ScheduleHawl, Days: DefaultHawlDays}},
+		{AssetClass: AssetIncome, RateBPS: DefaultRateBPS, Schedule: Schedule{Kind: ScheduleOnReceipt}},
+	}}
+}
+
+// Parse decodes and validates a policy document.
+func Parse(doc []byte) (Policy, error) {
+	var p Policy
+	if err := json.Unmarshal(doc, &p); err != nil {
+		return Policy{}, fmt.Errorf("decode policy: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return Policy{}, err
+	}
+	return p, nil
+}
+
+// Validate checks that every rule is well formed, that each asset
+// class appears at most once and that the distribution, if any, is
+// valid.
+func (p Policy) Validate() error {
+	if len(p.Rules) == 0 {
+		return fmt.Errorf("policy has no rules")
+	}
+	seen := make(map[string]bool)
+	for _, r := range p.Rules {
+		if r.AssetClass != AssetCash && r.AssetClass != AssetIncome {
+			return fmt.Errorf("unknown asset class %q", r.AssetClass)
+		}
+		if seen[r.AssetClass] {
+			return fmt.Errorf("asset class %q has more than one rule", r.AssetClass)
+		}
+		seen[r.AssetClass] = true
+
+		if r.RateBPS < 0 || r.RateBPS > maxRateBPS {
+			return fmt.Errorf("%s: rate_bps must be between 0 and %d", r.AssetClass, maxRateBPS)
+		}
+		if r.Threshold < 0 {
+			return fmt.Errorf("%s: threshold must not be negative", r.AssetClass)
+		}
+		switch r.Schedule.Kind {
+		case ScheduleHawl:
+			if r.Schedule.Days < 0 {
+				return fmt.Errorf("%s: schedule days must not be negative", r.AssetClass)
+			}
+		case ScheduleOnReceipt:
+		default:
+			return fmt.Errorf("%s: unknown schedule %q", r.AssetClass, r.Schedule.Kind)
+		}
+	}
+	if p.Distribution != nil {
+		return p.Distribution.Validate()
+	}
+	return nil
+}
+
+// DistributionOrDefault returns the policy's distribution, or
+// DefaultDistribution without one.
+func (p Policy) DistributionOrDefault() Distribution {
+	if p.Distribution == nil {
+		return DefaultDistribution()
+	}
+	return *p.Distribution
+}
+
+// Rule returns the rule of assetClass, if the policy has one.
+func (p Policy) Rule(assetClass string) (Rule, bool) {
+	for _, r := range p.Rules {
+		if r.AssetClass == assetClass {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Assess evaluates amount of assetClass. Asset classes without a rule
+// owe nothing.
+func (p Policy) Assess(assetClass string, amount int) Assessment {
+	r, ok := p.Rule(assetClass)
+	if !ok {
+		return Assessment{AssetClass: assetClass, Base: amount, Reason: ReasonNoRule}
+	}
+	return r.Assess(amount)
+}
+
+// Assess evaluates amount against the rule's threshold and rate. The
+// result is rounded down.
+func (r Rule) Assess(amount int) Assessment {
+	a := Assessment{AssetClass: r.AssetClass, Base: amount}
+	switch {
+	case amount <= 0:
+		a.Reason = ReasonNothing
+	case amount < r.Threshold:
+		a.Reason = ReasonBelowNisab
+	default:
+		a.Amount = amount * r.RateBPS / maxRateBPS
+	}
+	return a
+}
+
+// DueDate returns when zakat on an asset held since start becomes due.
+func (r Rule) DueDate(start time.Time) time.Time {
+	if r.Schedule.Kind != ScheduleHawl {
+		return start
+	}
+	days := r.Schedule.Days
+	if days == 0 {
+		days = DefaultHawlDays
+	}
+	return start.AddDate(0, 0, days)
+}
@@ -0,0 +1,122 @@
+package zakat
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultAssess(t *testing.T) {
+	p := Default(1000)
+
+	tests := []struct {
+		assetClass string
+		amount     int
+		want       Assessment
+	}{
+		{AssetCash, 40000, Assessment{AssetClass: AssetCash, Base: 40000, Amount: 1000}},
+		{AssetCash, 1000, Assessment{AssetClass: AssetCash, Base: 1000, Amount: 25}},
+		{AssetCash, 999, Assessment{AssetClass: AssetCash, Base: 999, Reason: ReasonBelowNisab}},
+		{AssetCash, 1039, Assessment{AssetClass: AssetCash, Base: 1039, Amount: 25}}, // rounded down
+		{AssetCash, 0, Assessment{AssetClass: AssetCash, Reason: ReasonNothing}},
+		{AssetCash, -5, Assessment{AssetClass: AssetCash, Base: -5, Reason: ReasonNothing}},
+		// income has no threshold
+		{AssetIncome, 200, Assessment{AssetClass: AssetIncome, Base: 200, Amount: 5}},
+		{AssetIncome, 39, Assessment{AssetClass: AssetIncome, Base: 39}},
+		{"gold", 5000, Assessment{AssetClass: "gold", Base: 5000, Reason: ReasonNoRule}},
+	}
+	for _, tt := range tests {
+		if got := p.Assess(tt.assetClass, tt.amount); got != tt.want {
+			t.Errorf("Assess(%q, %d) = %+v, want %+v", tt.assetClass, tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(`{
+		"rules": [
+			{"asset_class": "cash", "rate_bps": 300, "threshold": 500, "schedule": {"kind": "hawl", "days": 365}},
+			{"asset_class": "income", "rate_bps": 0, "schedule": {"kind": "on_receipt"}}
+		],
+		"distribution": {"method": "needs"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Assess(AssetCash, 1000); got.Amount != 30 {
+		t.Errorf("cash assessment = %+v, want 30 at 3%%", got)
+	}
+	if got := p.Assess(AssetIncome, 1000); got.Amount != 0 || got.Reason != "" {
+		t.Errorf("income assessment = %+v, want 0 at a 0 rate", got)
+	}
+	if d := p.DistributionOrDefault(); d.Method != DistributeNeeds {
+		t.Errorf("distribution method = %q, want %q", d.Method, DistributeNeeds)
+	}
+	if d := Default(0).DistributionOrDefault(); !reflect.DeepEqual(d, DefaultDistribution()) {
+		t.Errorf("default distribution = %+v, want %+v", d, DefaultDistribution())
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		name, doc, want string
+	}{
+		{"not json", `{`, "decode policy"},
+		{"no rules", `{"rules": []}`, "no rules"},
+		{"unknown asset", `{"rules": [{"asset_class": "gold", "schedule": {"kind": "hawl"}}]}`, "unknown asset class"},
+		{"duplicate asset", `{"rules": [
+			{"asset_class": "cash", "schedule": {"kind": "hawl"}},
+			{"asset_class": "cash", "schedule": {"kind": "hawl"}}]}`, "more than one rule"},
+		{"negative rate", `{"rules": [{"asset_class": "cash", "rate_bps": -1, "schedule": {"kind": "hawl"}}]}`, "rate_bps"},
+		{"rate above 100%", `{"rules": [{"asset_class": "cash", "rate_bps": 10001, "schedule": {"kind": "hawl"}}]}`, "rate_bps"},
+		{"negative threshold", `{"rules": [{"asset_class": "cash", "threshold": -1, "schedule": {"kind": "hawl"}}]}`, "threshold"},
+		{"negative days", `{"rules": [{"asset_class": "cash", "schedule": {"kind": "hawl", "days": -1}}]}`, "days"},
+		{"unknown schedule", `{"rules": [{"asset_class": "cash", "schedule": {"kind": "monthly"}}]}`, "unknown schedule"},
+		{"unknown method", `{"rules": [{"asset_class": "cash", "schedule": {"kind": "hawl"}}],
+			"distribution": {"method": "lottery"}}`, "unknown method"},
+		{"unknown category", `{"rules": [{"asset_class": "cash", "schedule": {"kind": "hawl"}}],
+			"distribution": {"category_bps": {"fuqara": 5000, "nobody": 5000}}}`, "unknown category"},
+		{"shares not 100%", `{"rules": [{"asset_class": "cash", "schedule": {"kind": "hawl"}}],
+			"distribution": {"category_bps": {"fuqara": 5000, "masakin": 4000}}}`, "add up to 9000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.doc))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDueDate(t *testing.T) {
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		rule Rule
+		want time.Time
+	}{
+		{"default hawl", Rule{Schedule: Schedule{Kind: ScheduleHawl}}, start.AddDate(0, 0, DefaultHawlDays)},
+		{"custom hawl", Rule{Schedule: Schedule{Kind: ScheduleHawl, Days: 30}}, start.AddDate(0, 0, 30)},
+		{"on receipt", Rule{Schedule: Schedule{Kind: ScheduleOnReceipt}}, start},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.DueDate(start); !got.Equal(tt.want) {
+			t.Errorf("%s: DueDate = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAnniversaryDue(t *testing.T) {
+	r := Rule{Schedule: Schedule{Kind: ScheduleHawl, Days: 10}}
+	created := time.Date(2024, time.January, 1, 23, 30, 0, 0, time.UTC)
+
+	for days, want := range map[int]bool{0: false, 9: false, 10: true, 15: false, 20: true} {
+		day := time.Date(2024, time.January, 1+days, 8, 0, 0, 0, time.UTC)
+		if got := r.AnniversaryDue(created, day); got != want {
+			t.Errorf("AnniversaryDue %d days after creation = %v, want %v", days, got, want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package zakat
+
+// report.go commits to the outcome of a zakat run. The report of a run
+// is a Merkle tree (see blockchain.MerkleRoot) over a header leaf, for
+// the run itself, followed by one leaf per wallet in address order. Its
+// root is anchored on chain after the run, so an edit to the stored run
+// or its items afterwards changes the root and no longer matches.
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+
+	"wallet_backend_go/internal/blockchain"
+)
+
+// reportVersion names the leaf encoding below.
+const reportVersion = "zakat-run-report-v1"
+
+// RunReport is what a zakat run did to each of its wallets.
+type RunReport struct {
+	RunID         string
+	TenantID      string
+	PoolAddress   string
+	PolicyVersion int
+	Lines         []ReportLine
+}
+
+// ReportLine is the outcome of a zakat run for one wallet.
+type ReportLine struct {
+	WalletAddress string
+	Status        string
+	Amount        int
+	BlockHash     string
+}
+
+// Leaves returns the hashed leaves of the report: the header, then the
+// lines sorted by wallet address.
+func (r RunReport) Leaves() [][]byte {
+	lines := append([]ReportLine(nil), r.Lines...)
+	sort.Slice(lines, func(i, j int) bool { return lines[i].WalletAddress < lines[j].WalletAddress })
+
+	leaves := make([][]byte, 0, len(lines)+1)
+	leaves = append(leaves, leaf(reportVersion, r.RunID, r.TenantID, r.PoolAddress, uint64(r.PolicyVersion)))
+	for _, l := range lines {
+		leaves = append(leaves, leaf(l.WalletAddress, l.Status, uint64(l.Amount), l.BlockHash))
+	}
+	return leaves
+}
+
+// Root returns the Merkle root of the report.
+func (r RunReport) Root() []byte {
+	return blockchain.MerkleRoot(r.Leaves())
+}
+
+// leaf hashes fields, each string prefixed with its length and each
+// number as 8 big-endian bytes, so no two field lists hash alike.
+func leaf(fields ...any) []byte {
+	var buf []byte
+	for _, f := range fields {
+		switch v := f.(type) {
+		case string:
+			buf = binary.BigEndian.AppendUint32(buf, uint32(len(v)))
+			buf = append(buf, v...)
+		case uint64:
+			buf = binary.BigEndian.AppendUint64(buf, v)
+		}
+	}
+	h := sha256.Sum256(buf)
+	return h[:]
+}
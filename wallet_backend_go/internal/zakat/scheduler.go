@@ -0,0 +1,238 @@
+package zakat
+
+// scheduler.go parses the schedules of automatic zakat runs. A run
+// schedule is either a five-field cron expression evaluated in UTC
+// ("minute hour day-of-month month day-of-week", with the usual *, -, /
+// and , forms and the @yearly, @monthly, @weekly, @daily and @hourly
+// shorthands) or "anniversary", which fires daily and deducts each
+// wallet on the hawl anniversaries of its creation.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScheduleAnniversary is the run schedule that deducts every wallet on
+// the anniversaries of its creation.
+const ScheduleAnniversary = "anniversary"
+
+// maxCronLookback bounds the search for a cron fire time; a day of the
+// month that falls on a given weekday recurs well within it.
+const maxCronLookback = 30 // years
+
+var cronShorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField is the set of values a cron field matches.
+type cronField uint64
+
+func (f cronField) has(v int) bool {
+	return f&(1<<uint(v)) != 0
+}
+
+// Cron is a parsed cron expression.
+type Cron struct {
+	minute, hour, dom, month, dow cronField
+	// a restricted day of the month and day of the week match either,
+	// as in cron
+	domAny, dowAny bool
+}
+
+// ParseCron parses a five-field cron expression or shorthand.
+func ParseCron(expr string) (Cron, error) {
+	expr = strings.TrimSpace(expr)
+	if full, ok := cronShorthands[expr]; ok {
+		expr = full
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return Cron{}, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+	var c Cron
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return Cron{}, fmt.Errorf("minute: %w", err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return Cron{}, fmt.Errorf("hour: %w", err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return Cron{}, fmt.Errorf("day of month: %w", err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return Cron{}, fmt.Errorf("month: %w", err)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return Cron{}, fmt.Errorf("day of week: %w", err)
+	}
+	if c.dow.has(7) {
+		c.dow |= 1 // 7 is Sunday too
+	}
+	c.domAny = fields[2] == "*"
+	c.dowAny = fields[4] == "*"
+	return c, nil
+}
+
+// parseCronField parses a comma-separated list of values, ranges and
+// steps between min and max.
+func parseCronField(s string, min, max int) (cronField, error) {
+	var f cronField
+	for _, part := range strings.Split(s, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rng, step = part[:i], n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				hi = max // "5/15" runs from 5 to the end
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			f |= 1 << uint(v)
+		}
+	}
+	return f, nil
+}
+
+func (c Cron) dayMatches(t time.Time) bool {
+	if !c.month.has(int(t.Month())) {
+		return false
+	}
+	dom, dow := c.dom.has(t.Day()), c.dow.has(int(t.Weekday()))
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// Prev returns the latest fire time at or before t, in UTC, and false
+// if the expression never fires (such as 30 February).
+func (c Cron) Prev(t time.Time) (time.Time, bool) {
+	t = t.UTC().Truncate(time.Minute)
+	limit := t.AddDate(-maxCronLookback, 0, 0)
+	for !t.Before(limit) {
+		switch {
+		case !c.dayMatches(t):
+			// last minute of the previous day
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Add(-time.Minute)
+		case !c.hour.has(t.Hour()):
+			t = t.Truncate(time.Hour).Add(-time.Minute)
+		case !c.minute.has(t.Minute()):
+			t = t.Add(-time.Minute)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Next returns the first fire time after t, in UTC, and false if the
+// expression never fires.
+func (c Cron) Next(t time.Time) (time.Time, bool) {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxCronLookback, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !c.hour.has(t.Hour()):
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case !c.minute.has(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// RunSchedule says when automatic zakat runs start.
+type RunSchedule struct {
+	Spec        string
+	Anniversary bool
+	cron        Cron
+}
+
+// ParseRunSchedule parses a cron expression or "anniversary".
+func ParseRunSchedule(spec string) (RunSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == ScheduleAnniversary {
+		return RunSchedule{Spec: spec, Anniversary: true}, nil
+	}
+	c, err := ParseCron(spec)
+	if err != nil {
+		return RunSchedule{}, err
+	}
+	if _, ok := c.Next(time.Now()); !ok {
+		return RunSchedule{}, fmt.Errorf("cron expression %q never fires", spec)
+	}
+	return RunSchedule{Spec: spec, cron: c}, nil
+}
+
+// Slot returns the start of the latest run due at or before t: the
+// cron fire time, or midnight UTC for anniversary schedules, which run
+// once a day.
+func (s RunSchedule) Slot(t time.Time) (time.Time, bool) {
+	if s.Anniversary {
+		t = t.UTC()
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), true
+	}
+	return s.cron.Prev(t)
+}
+
+// Next returns the start of the first run due after t.
+func (s RunSchedule) Next(t time.Time) (time.Time, bool) {
+	if s.Anniversary {
+		slot, _ := s.Slot(t)
+		return slot.AddDate(0, 0, 1), true
+	}
+	return s.cron.Next(t)
+}
+
+// AnniversaryDue reports whether day (in UTC) is a hawl anniversary of
+// created under the rule: a whole number of hawls, of at least one,
+// after the day of creation. Rules without a hawl use DefaultHawlDays.
+func (r Rule) AnniversaryDue(created, day time.Time) bool {
+	hawl := DefaultHawlDays
+	if r.Schedule.Kind == ScheduleHawl && r.Schedule.Days > 0 {
+		hawl = r.Schedule.Days
+	}
+	created, day = created.UTC(), day.UTC()
+	from := time.Date(created.Year(), created.Month(), created.Day(), 0, 0, 0, 0, time.UTC)
+	to := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(to.Sub(from).Hours() / 24)
+	return days > 0 && days%hawl == 0
+}